@@ -49,4 +49,25 @@ const (
 
 	// Deploy is the string value for the deploy action when logging.
 	Deploy = "deploy"
+
+	// Extend is the string value for the extend action when logging.
+	Extend = "extend"
+
+	// Replicate is the string value for the replicate action when logging.
+	Replicate = "replicate"
+
+	// Promote is the string value for the promote action when logging.
+	Promote = "promote"
+
+	// Export is the string value for the export action when logging.
+	Export = "export"
+
+	// Import is the string value for the import action when logging.
+	Import = "import"
+
+	// Verify is the string value for the verify action when logging.
+	Verify = "verify"
+
+	// Repair is the string value for the repair action when logging.
+	Repair = "repair"
 )
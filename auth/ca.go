@@ -0,0 +1,451 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/fsnotify/fsnotify"
+)
+
+/*
+   Connections between hosts over the TCP mux are authenticated with
+   certificates issued by a certificate authority that is managed by the
+   master.  Each delegate sends a certificate request to the master, signed
+   with its delegate key, and gets back a certificate naming its host and pool
+   along with the CA certificate that it uses to verify its peers.
+*/
+
+const (
+	// MuxCAFileName is the file on the master that holds the CA certificate
+	// and private key.
+	MuxCAFileName = ".keys/mux-ca.pem"
+
+	// MuxCertFileName is the file on the delegate that holds the host's
+	// certificate, private key and the CA certificate.
+	MuxCertFileName = "mux.pem"
+
+	// MuxCertificateExpiration is how long a host certificate is valid.
+	MuxCertificateExpiration = 30 * 24 * time.Hour
+
+	muxCAExpiration = 10 * 365 * 24 * time.Hour
+	muxCertKeyBits  = 2048
+)
+
+var (
+	// ErrNoMuxCA is thrown when a certificate is requested from a host that
+	// does not have the CA keys.
+	ErrNoMuxCA = errors.New("No mux certificate authority available")
+	// ErrNoMuxCertificate is thrown when the host has not loaded its mux
+	// certificate.
+	ErrNoMuxCertificate = errors.New("No mux certificate available")
+	// ErrBadMuxCertificate is thrown when a peer certificate was not issued by
+	// the mux certificate authority.
+	ErrBadMuxCertificate = errors.New("Mux certificate was not issued by the certificate authority")
+
+	muxCA     *muxAuthority
+	muxCALock sync.RWMutex
+
+	muxCert     *muxCertificate
+	muxCertLock sync.RWMutex
+)
+
+type muxAuthority struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     *rsa.PrivateKey
+}
+
+type muxCertificate struct {
+	cert tls.Certificate
+	leaf *x509.Certificate
+	pool *x509.CertPool
+}
+
+// MuxCertificateFunc returns a certificate signed by the mux CA and the CA
+// certificate, given a PEM-encoded certificate request.
+type MuxCertificateFunc func(csrPEM []byte) (certPEM, caPEM []byte, err error)
+
+// GenerateMuxCA creates a new self-signed certificate authority for the mux.
+func GenerateMuxCA() (certPEM, keyPEM []byte, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, muxCertKeyBits)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"serviced"}, CommonName: "serviced mux CA"},
+		NotBefore:             now.Add(-ClockDriftDelta),
+		NotAfter:              now.Add(muxCAExpiration),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return certPEM, keyPEM, nil
+}
+
+// CreateOrLoadMuxCA loads the mux certificate authority from disk. If the
+// file does not exist, it generates a new one and writes it to disk.
+func CreateOrLoadMuxCA(filename string) error {
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		if err = os.MkdirAll(path.Dir(filename), os.ModeDir|0755); err != nil {
+			return err
+		}
+		certPEM, keyPEM, err := GenerateMuxCA()
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filename, append(certPEM, keyPEM...), 0600); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	certPEM, keyPEM := splitPEM(data)
+	return LoadMuxCAFromPEM(certPEM, keyPEM)
+}
+
+// LoadMuxCAFromPEM sets the mux certificate authority from PEM data.
+func LoadMuxCAFromPEM(certPEM, keyPEM []byte) error {
+	cert, err := parseCertificatePEM(certPEM)
+	if err != nil {
+		return err
+	}
+	key, err := RSAPrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		return err
+	}
+	muxCALock.Lock()
+	defer muxCALock.Unlock()
+	muxCA = &muxAuthority{cert: cert, certPEM: certPEM, key: key}
+	return nil
+}
+
+// IssueMuxCertificate signs the certificate request for the host. The
+// subject of the request is ignored; the certificate is always issued to the
+// host and pool given.
+func IssueMuxCertificate(hostID, poolID string, csrPEM []byte, expiration time.Duration) (certPEM, caPEM []byte, err error) {
+	muxCALock.RLock()
+	ca := muxCA
+	muxCALock.RUnlock()
+	if ca == nil {
+		return nil, nil, ErrNoMuxCA
+	}
+
+	block, _ := pem.Decode(csrPEM)
+	if block == nil {
+		return nil, nil, ErrNotPEMEncoded
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization:       []string{"serviced"},
+			OrganizationalUnit: []string{poolID},
+			CommonName:         hostID,
+		},
+		NotBefore:   now.Add(-ClockDriftDelta),
+		NotAfter:    now.Add(expiration),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, csr.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return certPEM, ca.certPEM, nil
+}
+
+// NewMuxCertificateRequest generates a private key for the host and a
+// certificate request for it.
+func NewMuxCertificateRequest(hostID string) (csrPEM, keyPEM []byte, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, muxCertKeyBits)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{Organization: []string{"serviced"}, CommonName: hostID},
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	csrPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return csrPEM, keyPEM, nil
+}
+
+// LoadMuxCertificateFromPEM sets the host's mux certificate and the CA
+// certificate used to verify peers.
+func LoadMuxCertificateFromPEM(certPEM, keyPEM, caPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	ca, err := parseCertificatePEM(caPEM)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	muxCertLock.Lock()
+	defer muxCertLock.Unlock()
+	muxCert = &muxCertificate{cert: cert, leaf: leaf, pool: pool}
+	return nil
+}
+
+// LoadMuxCertificateFile loads the host's mux certificate from a file
+// written by WriteMuxCertificateFile.
+func LoadMuxCertificateFile(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var certPEM, keyPEM, caPEM []byte
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		switch {
+		case block.Type == "CERTIFICATE" && certPEM == nil:
+			certPEM = pem.EncodeToMemory(block)
+		case block.Type == "CERTIFICATE":
+			caPEM = pem.EncodeToMemory(block)
+		default:
+			keyPEM = pem.EncodeToMemory(block)
+		}
+	}
+	return LoadMuxCertificateFromPEM(certPEM, keyPEM, caPEM)
+}
+
+// WriteMuxCertificateFile stores the host's certificate, followed by its
+// private key and the CA certificate.
+func WriteMuxCertificateFile(filename string, certPEM, keyPEM, caPEM []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModeDir|0755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.Write(certPEM)
+	buf.Write(keyPEM)
+	buf.Write(caPEM)
+	return ioutil.WriteFile(filename, buf.Bytes(), 0600)
+}
+
+// MuxCertificate returns the host's mux certificate.
+func MuxCertificate() (*tls.Certificate, error) {
+	muxCertLock.RLock()
+	defer muxCertLock.RUnlock()
+	if muxCert == nil {
+		return nil, ErrNoMuxCertificate
+	}
+	return &muxCert.cert, nil
+}
+
+// MuxCertificateExpires returns when the host's mux certificate expires, or
+// the zero time if there is none.
+func MuxCertificateExpires() time.Time {
+	muxCertLock.RLock()
+	defer muxCertLock.RUnlock()
+	if muxCert == nil {
+		return time.Time{}
+	}
+	return muxCert.leaf.NotAfter
+}
+
+// VerifyMuxCertificate checks that the certificate chain presented by a peer
+// on the mux was issued by the mux CA, and returns the host it was issued to.
+func VerifyMuxCertificate(chain []*x509.Certificate) (string, error) {
+	muxCertLock.RLock()
+	current := muxCert
+	muxCertLock.RUnlock()
+	if current == nil {
+		return "", ErrNoMuxCertificate
+	}
+	if len(chain) == 0 {
+		return "", ErrBadMuxCertificate
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         current.pool,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, cert := range chain[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := chain[0].Verify(opts); err != nil {
+		log.WithError(err).Debug("Could not verify mux certificate")
+		return "", ErrBadMuxCertificate
+	}
+	return chain[0].Subject.CommonName, nil
+}
+
+// MuxCertificateLoop requests a mux certificate for the host and renews it
+// when half of its lifetime has passed, until the done channel is closed.
+func MuxCertificateLoop(hostID string, f MuxCertificateFunc, filename string, done <-chan interface{}) {
+	log := log.WithFields(logrus.Fields{
+		"hostid":   hostID,
+		"certfile": filename,
+	})
+	for {
+		expires := MuxCertificateExpires()
+		renew := expires.Sub(time.Now()) - MuxCertificateExpiration/2
+		if !expires.IsZero() && renew > 0 {
+			select {
+			case <-done:
+				return
+			case <-time.After(renew):
+			}
+		}
+
+		if err := refreshMuxCertificate(hostID, f, filename); err != nil {
+			log.WithError(err).Warn("Unable to obtain mux certificate. Retrying in 10s")
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Second):
+			}
+			continue
+		}
+		log.WithField("expires", MuxCertificateExpires()).Info("Obtained mux certificate")
+	}
+}
+
+func refreshMuxCertificate(hostID string, f MuxCertificateFunc, filename string) error {
+	csrPEM, keyPEM, err := NewMuxCertificateRequest(hostID)
+	if err != nil {
+		return err
+	}
+	certPEM, caPEM, err := f(csrPEM)
+	if err != nil {
+		return err
+	}
+	if err := LoadMuxCertificateFromPEM(certPEM, keyPEM, caPEM); err != nil {
+		return err
+	}
+	if filename != "" {
+		return WriteMuxCertificateFile(filename, certPEM, keyPEM, caPEM)
+	}
+	return nil
+}
+
+// WatchMuxCertificateFile watches the mux certificate file on the filesystem
+// and reloads the certificate when changes are detected.
+func WatchMuxCertificateFile(filename string, cancel <-chan interface{}) error {
+	filename = filepath.Clean(filename)
+
+	log := log.WithFields(logrus.Fields{
+		"certfile": filename,
+	})
+
+	loadCert := func() {
+		if err := LoadMuxCertificateFile(filename); err != nil {
+			log.WithError(err).Debug("Unable to load mux certificate from file. Continuing to watch for changes")
+		} else {
+			log.Debug("Loaded mux certificate from file")
+		}
+	}
+
+	// Try an initial load without any file changes
+	loadCert()
+
+	filechanges, err := NotifyOnChange(filename, fsnotify.Write|fsnotify.Create, cancel)
+	if err != nil {
+		return err
+	}
+	for _ = range filechanges {
+		loadCert()
+	}
+	return nil
+}
+
+// ClearMuxCertificates wipes the current state
+func ClearMuxCertificates() {
+	muxCALock.Lock()
+	muxCA = nil
+	muxCALock.Unlock()
+	muxCertLock.Lock()
+	muxCert = nil
+	muxCertLock.Unlock()
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func parseCertificatePEM(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrNotPEMEncoded
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// splitPEM separates the certificate and the private key in PEM data.
+func splitPEM(data []byte) (certPEM, keyPEM []byte) {
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			certPEM = pem.EncodeToMemory(block)
+		} else {
+			keyPEM = pem.EncodeToMemory(block)
+		}
+	}
+	return certPEM, keyPEM
+}
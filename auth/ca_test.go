@@ -0,0 +1,97 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package auth_test
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/control-center/serviced/auth"
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestAuthSuite) TestMuxCertificates(c *C) {
+	defer auth.ClearMuxCertificates()
+
+	tmpdir, err := ioutil.TempDir("", "serviced-mux-ca-")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmpdir)
+
+	// no CA, no certificates
+	csrPEM, keyPEM, err := auth.NewMuxCertificateRequest(s.hostId)
+	c.Assert(err, IsNil)
+	_, _, err = auth.IssueMuxCertificate(s.hostId, s.poolId, csrPEM, time.Hour)
+	c.Assert(err, Equals, auth.ErrNoMuxCA)
+
+	// the CA is created once and reloaded after that
+	cafile := filepath.Join(tmpdir, auth.MuxCAFileName)
+	c.Assert(auth.CreateOrLoadMuxCA(cafile), IsNil)
+	data, err := ioutil.ReadFile(cafile)
+	c.Assert(err, IsNil)
+	c.Assert(auth.CreateOrLoadMuxCA(cafile), IsNil)
+	reloaded, err := ioutil.ReadFile(cafile)
+	c.Assert(err, IsNil)
+	c.Assert(reloaded, DeepEquals, data)
+
+	// issue a certificate to the host, whatever the request says
+	csrPEM, keyPEM, err = auth.NewMuxCertificateRequest("SomeoneElse")
+	c.Assert(err, IsNil)
+	certPEM, caPEM, err := auth.IssueMuxCertificate(s.hostId, s.poolId, csrPEM, time.Hour)
+	c.Assert(err, IsNil)
+
+	certfile := filepath.Join(tmpdir, auth.MuxCertFileName)
+	c.Assert(auth.WriteMuxCertificateFile(certfile, certPEM, keyPEM, caPEM), IsNil)
+	c.Assert(auth.LoadMuxCertificateFile(certfile), IsNil)
+
+	cert, err := auth.MuxCertificate()
+	c.Assert(err, IsNil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	c.Assert(err, IsNil)
+	c.Assert(leaf.Subject.CommonName, Equals, s.hostId)
+	c.Assert(leaf.Subject.OrganizationalUnit, DeepEquals, []string{s.poolId})
+	c.Assert(auth.MuxCertificateExpires().After(time.Now()), Equals, true)
+
+	hostID, err := auth.VerifyMuxCertificate([]*x509.Certificate{leaf})
+	c.Assert(err, IsNil)
+	c.Assert(hostID, Equals, s.hostId)
+
+	// certificates from another CA are rejected
+	otherCertPEM, otherKeyPEM, err := auth.GenerateMuxCA()
+	c.Assert(err, IsNil)
+	c.Assert(auth.LoadMuxCAFromPEM(otherCertPEM, otherKeyPEM), IsNil)
+	csrPEM, _, err = auth.NewMuxCertificateRequest(s.hostId)
+	c.Assert(err, IsNil)
+	otherPEM, _, err := auth.IssueMuxCertificate(s.hostId, s.poolId, csrPEM, time.Hour)
+	c.Assert(err, IsNil)
+	otherCert, err := tlsLeaf(otherPEM)
+	c.Assert(err, IsNil)
+	_, err = auth.VerifyMuxCertificate([]*x509.Certificate{otherCert})
+	c.Assert(err, Equals, auth.ErrBadMuxCertificate)
+	_, err = auth.VerifyMuxCertificate(nil)
+	c.Assert(err, Equals, auth.ErrBadMuxCertificate)
+}
+
+func tlsLeaf(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, auth.ErrNotPEMEncoded
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
@@ -14,9 +14,11 @@
 package auth
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"io"
+	"strings"
 )
 
 /*
@@ -27,14 +29,32 @@ import (
    ---------------------------------------------------------------------------------------------------------
    | Auth Token length (4 bytes)  |     Auth Token (N bytes)  | Address (6 bytes) |  Signature (256 bytes) |
    ---------------------------------------------------------------------------------------------------------
+
+   A connection that relays UDP datagrams appends a single protocol flag byte
+   to the address. A connection that carries a multiplexed session of many
+   streams sets the session flag instead, and each stream names its own
+   address.
+
+   The caller may name the tenant and application it is trying to reach
+   after the protocol flag, so that the receiving mux can check that the
+   address is an export of that application:
+
+   ----------------------------------------------------------------------------------------
+   | Address (6 bytes) | Protocol flag (1 byte) | Tenant ID | 0x00 | Application (N bytes) |
+   ----------------------------------------------------------------------------------------
 */
 
 const (
 	ADDRESS_BYTES = 6
+	TCP_FLAG      = 't'
+	UDP_FLAG      = 'u'
+	SESSION_FLAG  = 's'
 )
 
 var (
-	ErrBadMuxAddress = errors.New("Bad mux address")
+	ErrBadMuxAddress  = errors.New("Bad mux address")
+	ErrBadMuxProtocol = errors.New("Bad mux protocol")
+	ErrBadMuxScope    = errors.New("Bad mux scope")
 
 	endian = binary.BigEndian
 )
@@ -52,3 +72,101 @@ func ReadMuxHeader(r io.Reader) ([]byte, Identity, error) {
 	sender, _, address, err := ReadAuthHeader(r)
 	return address, sender, err
 }
+
+// AddSignedMuxHeaderProtocol writes a signed mux header asking the receiving
+// mux to relay the connection to the address over the given protocol, "tcp"
+// or "udp", or to start a multiplexed "session".
+func AddSignedMuxHeaderProtocol(w io.Writer, address []byte, protocol, token string) error {
+	payload, err := PackMuxAddress(address, protocol)
+	if err != nil {
+		return err
+	}
+	header := NewAuthHeaderWriterTo([]byte(token), payload, &delegateKeys)
+	_, err = header.WriteTo(w)
+	return err
+}
+
+// PackMuxAddress adds the protocol flag to a packed address.
+func PackMuxAddress(address []byte, protocol string) ([]byte, error) {
+	if len(address) != ADDRESS_BYTES {
+		return nil, ErrBadMuxAddress
+	}
+	var flag byte
+	switch protocol {
+	case "", "tcp":
+		return address, nil
+	case "udp":
+		flag = UDP_FLAG
+	case "session":
+		flag = SESSION_FLAG
+	default:
+		return nil, ErrBadMuxProtocol
+	}
+	return append(append([]byte{}, address...), flag), nil
+}
+
+// AddSignedMuxSessionHeader writes a signed mux header asking the receiving
+// mux to start a multiplexed session.
+func AddSignedMuxSessionHeader(w io.Writer, token string) error {
+	return AddSignedMuxHeaderProtocol(w, make([]byte, ADDRESS_BYTES), "session", token)
+}
+
+// MuxProtocol returns the protocol requested by the address read off of a
+// mux header.
+func MuxProtocol(address []byte) string {
+	if len(address) > ADDRESS_BYTES {
+		switch address[ADDRESS_BYTES] {
+		case UDP_FLAG:
+			return "udp"
+		case SESSION_FLAG:
+			return "session"
+		}
+	}
+	return "tcp"
+}
+
+// AddSignedMuxHeaderScope writes a signed mux header like
+// AddSignedMuxHeaderProtocol, naming the tenant and application that the
+// caller expects to reach at the address.
+func AddSignedMuxHeaderScope(w io.Writer, address []byte, protocol, tenantID, application, token string) error {
+	payload, err := PackMuxAddressScope(address, protocol, tenantID, application)
+	if err != nil {
+		return err
+	}
+	header := NewAuthHeaderWriterTo([]byte(token), payload, &delegateKeys)
+	_, err = header.WriteTo(w)
+	return err
+}
+
+// PackMuxAddressScope adds the protocol flag, tenant and application to a
+// packed address.
+func PackMuxAddressScope(address []byte, protocol, tenantID, application string) ([]byte, error) {
+	if strings.IndexByte(tenantID, 0) >= 0 {
+		return nil, ErrBadMuxScope
+	}
+	payload, err := PackMuxAddress(address, protocol)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) == ADDRESS_BYTES {
+		payload = append(append([]byte{}, payload...), TCP_FLAG)
+	}
+	payload = append(payload, tenantID...)
+	payload = append(payload, 0)
+	payload = append(payload, application...)
+	return payload, nil
+}
+
+// MuxScope returns the tenant and application named by the address read off
+// of a mux header, if any.
+func MuxScope(address []byte) (tenantID, application string, ok bool) {
+	if len(address) <= ADDRESS_BYTES+1 {
+		return "", "", false
+	}
+	scope := address[ADDRESS_BYTES+1:]
+	i := bytes.IndexByte(scope, 0)
+	if i < 0 {
+		return "", "", false
+	}
+	return string(scope[:i]), string(scope[i+1:]), true
+}
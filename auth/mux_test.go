@@ -58,3 +58,63 @@ func (s *TestAuthSuite) TestBuildAndExtractHeader(c *C) {
 	c.Assert(s.admin, Equals, ident.HasAdminAccess())
 	c.Assert(s.dfs, Equals, ident.HasDFSAccess())
 }
+
+func (s *TestAuthSuite) TestBuildAndExtractUDPHeader(c *C) {
+	token, _, _ := auth.CreateJWTIdentity(s.hostId, s.poolId, s.admin, s.dfs, s.delegatePubPEM, time.Hour)
+	addr := "zenoss"
+	var b bytes.Buffer
+
+	err := auth.AddSignedMuxHeaderProtocol(&b, []byte(addr), "udp", token)
+	c.Assert(err, IsNil)
+
+	extractedAddr, _, err := auth.ReadMuxHeader(&b)
+	c.Assert(err, IsNil)
+	c.Assert(string(extractedAddr[:auth.ADDRESS_BYTES]), Equals, addr)
+	c.Assert(auth.MuxProtocol(extractedAddr), Equals, "udp")
+
+	// tcp headers are unchanged
+	b.Reset()
+	err = auth.AddSignedMuxHeaderProtocol(&b, []byte(addr), "tcp", token)
+	c.Assert(err, IsNil)
+	extractedAddr, _, err = auth.ReadMuxHeader(&b)
+	c.Assert(err, IsNil)
+	c.Assert(string(extractedAddr), Equals, addr)
+	c.Assert(auth.MuxProtocol(extractedAddr), Equals, "tcp")
+
+	err = auth.AddSignedMuxHeaderProtocol(&b, []byte(addr), "sctp", token)
+	c.Assert(err, Equals, auth.ErrBadMuxProtocol)
+}
+
+func (s *TestAuthSuite) TestBuildAndExtractScopeHeader(c *C) {
+	token, _, _ := auth.CreateJWTIdentity(s.hostId, s.poolId, s.admin, s.dfs, s.delegatePubPEM, time.Hour)
+	addr := "zenoss"
+	var b bytes.Buffer
+
+	err := auth.AddSignedMuxHeaderScope(&b, []byte(addr), "tcp", "tenant", "app", token)
+	c.Assert(err, IsNil)
+
+	extractedAddr, _, err := auth.ReadMuxHeader(&b)
+	c.Assert(err, IsNil)
+	c.Assert(string(extractedAddr[:auth.ADDRESS_BYTES]), Equals, addr)
+	c.Assert(auth.MuxProtocol(extractedAddr), Equals, "tcp")
+	tenantID, application, ok := auth.MuxScope(extractedAddr)
+	c.Assert(ok, Equals, true)
+	c.Assert(tenantID, Equals, "tenant")
+	c.Assert(application, Equals, "app")
+
+	// the scope follows the protocol flag
+	payload, err := auth.PackMuxAddressScope([]byte(addr), "udp", "tenant", "app")
+	c.Assert(err, IsNil)
+	c.Assert(auth.MuxProtocol(payload), Equals, "udp")
+	tenantID, application, ok = auth.MuxScope(payload)
+	c.Assert(ok, Equals, true)
+	c.Assert(tenantID, Equals, "tenant")
+	c.Assert(application, Equals, "app")
+
+	// headers without a scope
+	_, _, ok = auth.MuxScope([]byte(addr))
+	c.Assert(ok, Equals, false)
+	payload, _ = auth.PackMuxAddress([]byte(addr), "udp")
+	_, _, ok = auth.MuxScope(payload)
+	c.Assert(ok, Equals, false)
+}
@@ -3,6 +3,8 @@ package mocks
 import api "github.com/control-center/serviced/cli/api"
 import applicationendpoint "github.com/control-center/serviced/domain/applicationendpoint"
 import dao "github.com/control-center/serviced/dao"
+import dfs "github.com/control-center/serviced/dfs"
+import doctor "github.com/control-center/serviced/doctor"
 import host "github.com/control-center/serviced/domain/host"
 import io "io"
 import isvcs "github.com/control-center/serviced/isvcs"
@@ -340,6 +342,20 @@ func (_m *API) Backup(_a0 string, _a1 []string, _a2 bool) (string, error) {
 	return r0, r1
 }
 
+// CancelRestore provides a mock function with given fields:
+func (_m *API) CancelRestore() error {
+	ret := _m.Called()
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // CloneService provides a mock function with given fields: _a0, _a1
 func (_m *API) CloneService(_a0 string, _a1 string) (*service.ServiceDetails, error) {
 	ret := _m.Called(_a0, _a1)
@@ -363,6 +379,29 @@ func (_m *API) CloneService(_a0 string, _a1 string) (*service.ServiceDetails, er
 	return r0, r1
 }
 
+// CollectRegistryGarbage provides a mock function with given fields: dryRun
+func (_m *API) CollectRegistryGarbage(dryRun bool) (*dfs.RegistryGCReport, error) {
+	ret := _m.Called(dryRun)
+
+	var r0 *dfs.RegistryGCReport
+	if rf, ok := ret.Get(0).(func(bool) *dfs.RegistryGCReport); ok {
+		r0 = rf(dryRun)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*dfs.RegistryGCReport)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(bool) error); ok {
+		r1 = rf(dryRun)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // CompileServiceTemplate provides a mock function with given fields: _a0
 func (_m *API) CompileServiceTemplate(_a0 api.CompileTemplateConfig) (*servicetemplate.ServiceTemplate, error) {
 	ret := _m.Called(_a0)
@@ -465,6 +504,29 @@ func (_m *API) DockerOverride(newImage string, oldImage string) error {
 	return r0
 }
 
+// Doctor provides a mock function with given fields: repair
+func (_m *API) Doctor(repair bool) (*doctor.Report, error) {
+	ret := _m.Called(repair)
+
+	var r0 *doctor.Report
+	if rf, ok := ret.Get(0).(func(bool) *doctor.Report); ok {
+		r0 = rf(repair)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*doctor.Report)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(bool) error); ok {
+		r1 = rf(repair)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // EnablePublicEndpointPort provides a mock function with given fields: serviceid, endpointName, portAddr, isEnabled
 func (_m *API) EnablePublicEndpointPort(serviceid string, endpointName string, portAddr string, isEnabled bool) error {
 	ret := _m.Called(serviceid, endpointName, portAddr, isEnabled)
@@ -493,6 +555,27 @@ func (_m *API) EnablePublicEndpointVHost(serviceid string, endpointName string,
 	return r0
 }
 
+// ExportApp provides a mock function with given fields: tenantID, path
+func (_m *API) ExportApp(tenantID string, path string) (string, error) {
+	ret := _m.Called(tenantID, path)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string, string) string); ok {
+		r0 = rf(tenantID, path)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(tenantID, path)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // ExportLogs provides a mock function with given fields: config
 func (_m *API) ExportLogs(config api.ExportLogsConfig) error {
 	ret := _m.Called(config)
@@ -507,6 +590,20 @@ func (_m *API) ExportLogs(config api.ExportLogsConfig) error {
 	return r0
 }
 
+// TailLogs provides a mock function with given fields: config, stopChan
+func (_m *API) TailLogs(config api.TailLogsConfig, stopChan chan struct{}) error {
+	ret := _m.Called(config, stopChan)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(api.TailLogsConfig, chan struct{}) error); ok {
+		r0 = rf(config, stopChan)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // GetAllPublicEndpoints provides a mock function with given fields:
 func (_m *API) GetAllPublicEndpoints() ([]service.PublicEndpoint, error) {
 	ret := _m.Called()
@@ -806,6 +903,29 @@ func (_m *API) GetResourcePools() ([]pool.ResourcePool, error) {
 	return r0, r1
 }
 
+// GetRestoreStatus provides a mock function with given fields:
+func (_m *API) GetRestoreStatus() (*dfs.RestoreStatus, error) {
+	ret := _m.Called()
+
+	var r0 *dfs.RestoreStatus
+	if rf, ok := ret.Get(0).(func() *dfs.RestoreStatus); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*dfs.RestoreStatus)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetService provides a mock function with given fields: _a0
 func (_m *API) GetService(_a0 string) (*service.Service, error) {
 	ret := _m.Called(_a0)
@@ -1034,6 +1154,27 @@ func (_m *API) GetVolumeStatus() (*volume.Statuses, error) {
 	return r0, r1
 }
 
+// ImportApp provides a mock function with given fields: path, poolID
+func (_m *API) ImportApp(path string, poolID string) (string, error) {
+	ret := _m.Called(path, poolID)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string, string) string); ok {
+		r0 = rf(path, poolID)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(path, poolID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // LogsForServiceInstance provides a mock function with given fields: serviceID, instanceID, command, args
 func (_m *API) LogsForServiceInstance(serviceID string, instanceID int, command string, args []string) error {
 	ret := _m.Called(serviceID, instanceID, command, args)
@@ -1325,6 +1466,20 @@ func (_m *API) RestartService(_a0 api.SchedulerConfig) (int, error) {
 	return r0, r1
 }
 
+// PromoteReplica provides a mock function with given fields:
+func (_m *API) PromoteReplica() error {
+	ret := _m.Called()
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // RebalanceService provides a mock function with given fields: _a0
 func (_m *API) RebalanceService(_a0 api.SchedulerConfig) (int, error) {
 	ret := _m.Called(_a0)
@@ -1360,6 +1515,20 @@ func (_m *API) Restore(_a0 string) error {
 	return r0
 }
 
+// ResumeRestore provides a mock function with given fields: _a0
+func (_m *API) ResumeRestore(_a0 string) error {
+	ret := _m.Called(_a0)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Rollback provides a mock function with given fields: _a0, _a1
 func (_m *API) Rollback(_a0 string, _a1 bool) error {
 	ret := _m.Called(_a0, _a1)
@@ -1593,6 +1762,73 @@ func (_m *API) TagSnapshot(_a0 string, _a1 string) error {
 	return r0
 }
 
+// ListSnapshotFiles provides a mock function with given fields: _a0, _a1
+func (_m *API) ListSnapshotFiles(_a0 string, _a1 string) ([]volume.SnapshotFile, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 []volume.SnapshotFile
+	if rf, ok := ret.Get(0).(func(string, string) []volume.SnapshotFile); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]volume.SnapshotFile)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DiffSnapshots provides a mock function with given fields: _a0, _a1, _a2
+func (_m *API) DiffSnapshots(_a0 string, _a1 string, _a2 string) ([]volume.SnapshotChange, error) {
+	ret := _m.Called(_a0, _a1, _a2)
+
+	var r0 []volume.SnapshotChange
+	if rf, ok := ret.Get(0).(func(string, string, string) []volume.SnapshotChange); ok {
+		r0 = rf(_a0, _a1, _a2)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]volume.SnapshotChange)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, string) error); ok {
+		r1 = rf(_a0, _a1, _a2)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreSnapshotPath provides a mock function with given fields: _a0, _a1, _a2
+func (_m *API) RestoreSnapshotPath(_a0 string, _a1 string, _a2 string) (int, error) {
+	ret := _m.Called(_a0, _a1, _a2)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(string, string, string) int); ok {
+		r0 = rf(_a0, _a1, _a2)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, string) error); ok {
+		r1 = rf(_a0, _a1, _a2)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // UpdateResourcePool provides a mock function with given fields: _a0
 func (_m *API) UpdateResourcePool(_a0 pool.ResourcePool) error {
 	ret := _m.Called(_a0)
@@ -1644,6 +1880,29 @@ func (_m *API) UpgradeRegistry(endpoint string, override bool) error {
 	return r0
 }
 
+// VerifyBackup provides a mock function with given fields: path
+func (_m *API) VerifyBackup(path string) (*dfs.BackupReport, error) {
+	ret := _m.Called(path)
+
+	var r0 *dfs.BackupReport
+	if rf, ok := ret.Get(0).(func(string) *dfs.BackupReport); ok {
+		r0 = rf(path)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*dfs.BackupReport)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(path)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // WriteDelegateKey provides a mock function with given fields: _a0, _a1
 func (_m *API) WriteDelegateKey(_a0 string, _a1 []byte) error {
 	ret := _m.Called(_a0, _a1)
@@ -0,0 +1,57 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/control-center/serviced/config"
+)
+
+// ExportApp writes a tenant application to an archive and returns the path
+// of the archive.  If path is empty, the archive is named after the tenant
+// and written to the current directory.
+func (a *api) ExportApp(tenantID, path string) (string, error) {
+	client, err := a.connectMaster()
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		path = fmt.Sprintf("app-%s-%s.tgz", tenantID, time.Now().UTC().Format("2006-01-02-150405"))
+	}
+	fp, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if err := client.ExportApp(tenantID, fp, config.GetOptions().SnapshotSpacePercent); err != nil {
+		return "", err
+	}
+	return fp, nil
+}
+
+// ImportApp loads an application archive into a resource pool and returns
+// the tenant id of the imported application.
+func (a *api) ImportApp(path, poolID string) (string, error) {
+	client, err := a.connectMaster()
+	if err != nil {
+		return "", err
+	}
+	fp, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return client.ImportApp(fp, poolID)
+}
@@ -19,6 +19,7 @@ import (
 
 	"github.com/control-center/serviced/config"
 	"github.com/control-center/serviced/dao"
+	"github.com/control-center/serviced/dfs"
 	"errors"
 )
 
@@ -65,6 +66,40 @@ func (a *api) Restore(path string) error {
 	return client.Restore(dao.RestoreRequest{Filename: filepath.Clean(fp)}, &unusedInt)
 }
 
+// ResumeRestore restores from a tgz file, skipping the phases that an
+// earlier restore of the same file completed.
+func (a *api) ResumeRestore(path string) error {
+	client, err := a.connectDAO()
+	if err != nil {
+		return err
+	}
+
+	fp, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("could not convert '%s' to an absolute file path: %v", path, err)
+	}
+
+	return client.Restore(dao.RestoreRequest{Filename: filepath.Clean(fp), Resume: true}, &unusedInt)
+}
+
+// GetRestoreStatus returns the progress of the running or last restore
+func (a *api) GetRestoreStatus() (*dfs.RestoreStatus, error) {
+	client, err := a.connectMaster()
+	if err != nil {
+		return nil, err
+	}
+	return client.GetRestoreStatus()
+}
+
+// CancelRestore stops the running restore
+func (a *api) CancelRestore() error {
+	client, err := a.connectMaster()
+	if err != nil {
+		return err
+	}
+	return client.CancelRestore()
+}
+
 
 func (a *api) GetBackupEstimate(dirpath string, excludes []string) (*dao.BackupEstimate, error) {
 	client, err := a.connectDAO()
@@ -82,4 +117,17 @@ func (a *api) GetBackupEstimate(dirpath string, excludes []string) (*dao.BackupE
 	}
 
 	return &est, nil
-}
\ No newline at end of file
+}
+// VerifyBackup test-restores a backup without changing any application and
+// reports its problems.
+func (a *api) VerifyBackup(path string) (*dfs.BackupReport, error) {
+	client, err := a.connectMaster()
+	if err != nil {
+		return nil, err
+	}
+	fp, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert '%s' to an absolute file path: %v", path, err)
+	}
+	return client.VerifyBackup(filepath.Clean(fp))
+}
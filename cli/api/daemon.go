@@ -18,29 +18,37 @@ import (
 	"errors"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/audit"
 	"github.com/control-center/serviced/auth"
 	commonsdocker "github.com/control-center/serviced/commons/docker"
 	"github.com/control-center/serviced/config"
 	coordclient "github.com/control-center/serviced/coordinator/client"
+	coordetcd "github.com/control-center/serviced/coordinator/client/etcd"
 	coordzk "github.com/control-center/serviced/coordinator/client/zookeeper"
 	"github.com/control-center/serviced/coordinator/storage"
 	"github.com/control-center/serviced/dao"
 	"github.com/control-center/serviced/dao/elasticsearch"
 	"github.com/control-center/serviced/datastore"
 	"github.com/control-center/serviced/datastore/elastic"
+	"github.com/control-center/serviced/datastore/embedded"
+	"github.com/control-center/serviced/datastore/migration"
 	"github.com/control-center/serviced/dfs"
 	"github.com/control-center/serviced/dfs/docker"
 	"github.com/control-center/serviced/dfs/nfs"
+	"github.com/control-center/serviced/dfs/ninep"
 	"github.com/control-center/serviced/dfs/registry"
+	"github.com/control-center/serviced/dfs/replica"
 	"github.com/control-center/serviced/domain/addressassignment"
 	"github.com/control-center/serviced/domain/host"
 	"github.com/control-center/serviced/domain/pool"
 	"github.com/control-center/serviced/domain/properties"
 	"github.com/control-center/serviced/domain/service"
 	"github.com/control-center/serviced/domain/serviceconfigfile"
+	"github.com/control-center/serviced/domain/servicedefinition"
 	"github.com/control-center/serviced/domain/servicetemplate"
 	"github.com/control-center/serviced/domain/user"
 	"github.com/control-center/serviced/facade"
+	"github.com/control-center/serviced/ha"
 	"github.com/control-center/serviced/health"
 	"github.com/control-center/serviced/isvcs"
 	"github.com/control-center/serviced/logging"
@@ -80,6 +88,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -103,6 +112,10 @@ type daemon struct {
 	staticIPs        []string
 	cpDao            dao.ControlPlane
 	dsDriver         datastore.Driver
+	dsStore          *embedded.Store
+	migrateES        bool
+	esHost           string
+	esPort           uint16
 	dsContext        datastore.Context
 	hostID           string
 	zClient          *coordclient.Client
@@ -113,6 +126,8 @@ type daemon struct {
 	waitGroup        *sync.WaitGroup
 	rpcServer        *rpc.Server
 	tokenExpiration  time.Duration
+	masterRPC        sync.Once
+	masterActive     int32
 
 	facade *facade.Facade
 	ssm    servicestatemanager.ServiceStateManager
@@ -169,15 +184,30 @@ func (d *daemon) getEsClusterName(name string) string {
 
 func (d *daemon) startISVCS() {
 	options := config.GetOptions()
-	startZK := options.StartZK
-	bigtable := options.BigTableMetrics
-	isvcs.Init(options.ESStartupTimeout, options.DockerLogDriver, convertStringSliceToMap(options.DockerLogConfigList), d.docker, startZK, bigtable)
+	startES := d.dsStore == nil || d.migrateES
+	isvcsOpts := isvcs.Options{
+		ESStartupTimeout: time.Duration(options.ESStartupTimeout) * time.Second,
+		DockerLogDriver:  options.DockerLogDriver,
+		DockerLogConfig:  convertStringSliceToMap(options.DockerLogConfigList),
+		Docker:           d.docker,
+		StartZK:          options.StartZK && len(options.Etcd) == 0,
+		BigTable:         options.BigTableMetrics,
+	}
+	if !startES {
+		isvcsOpts.Skip = append(isvcsOpts.Skip, "elasticsearch-serviced")
+	}
+	if options.DockerRegistryExternal {
+		isvcsOpts.Skip = append(isvcsOpts.Skip, "docker-registry")
+	}
+	isvcs.Init(isvcsOpts)
 	isvcs.Mgr.SetVolumesDir(options.IsvcsPath)
-	servicedClusterName := d.getEsClusterName("elasticsearch-serviced")
-	if err := isvcs.Mgr.SetConfigurationOption("elasticsearch-serviced", "cluster", servicedClusterName); err != nil {
-		log.WithFields(logrus.Fields{
-			"clustername": servicedClusterName,
-		}).WithError(err).Fatal("Could not set Elastic configuration")
+	if startES {
+		servicedClusterName := d.getEsClusterName("elasticsearch-serviced")
+		if err := isvcs.Mgr.SetConfigurationOption("elasticsearch-serviced", "cluster", servicedClusterName); err != nil {
+			log.WithFields(logrus.Fields{
+				"clustername": servicedClusterName,
+			}).WithError(err).Fatal("Could not set Elastic configuration")
+		}
 	}
 	logstashClusterName := d.getEsClusterName("elasticsearch-logstash")
 	if err := isvcs.Mgr.SetConfigurationOption("elasticsearch-logstash", "cluster", logstashClusterName); err != nil {
@@ -266,7 +296,11 @@ func (d *daemon) startRPC() {
 			if err != nil {
 				logger.WithError(err).Fatal("Error accepting RPC connection")
 			}
-			go d.rpcServer.ServeCodec(rpcutils.NewDefaultAuthServerCodec(conn))
+			codec := rpcutils.NewDefaultAuthServerCodec(conn)
+			if options.MasterHA {
+				codec = newStandbyServerCodec(codec, d.isActiveMaster)
+			}
+			go d.rpcServer.ServeCodec(codec)
 		}
 	}()
 }
@@ -287,9 +321,14 @@ func (d *daemon) run() (err error) {
 	dockerlogger := log.WithFields(logrus.Fields{
 		"address": docker.DefaultSocket,
 	})
-	if d.docker, err = docker.NewDockerClient(); err != nil {
+	dockerClient, err := docker.NewDockerClient()
+	if err != nil {
 		dockerlogger.WithError(err).Fatal("Unable to connect to Docker")
 	}
+	if options.DockerRegistryUsername != "" {
+		dockerClient.SetRegistryAuth(registryHost(options.DockerRegistry), options.DockerRegistryUsername, options.DockerRegistryPassword)
+	}
+	d.docker = dockerClient
 	dockerlogger.Info("Established connection to Docker")
 
 	// Set up the Docker registry
@@ -328,6 +367,9 @@ func (d *daemon) run() (err error) {
 	log.Info("Established ZooKeeper connection")
 
 	if options.Master {
+		if options.Datastore == embedded.DriverName {
+			d.openDatastore()
+		}
 		d.startISVCS()
 		if err := d.startMaster(); err != nil {
 			log.WithError(err).Fatal("Unable to start as a serviced master")
@@ -378,6 +420,12 @@ func (d *daemon) run() (err error) {
 	zzk.ShutdownConnections()
 	log.Info("Disconnected from ZooKeeper")
 
+	if d.dsStore != nil {
+		if err := d.dsStore.Close(); err != nil {
+			log.WithError(err).Warn("Unable to close the embedded datastore")
+		}
+	}
+
 	switch sig {
 	case syscall.SIGHUP:
 		command := os.Args
@@ -406,6 +454,18 @@ func (d *daemon) initContext() datastore.Context {
 
 func (d *daemon) initZK(zks []string) (*coordclient.Client, error) {
 	options := config.GetOptions()
+	if len(options.Etcd) > 0 {
+		dsn := coordetcd.NewDSN(options.Etcd,
+			time.Duration(options.ZKSessionTimeout)*time.Second,
+			time.Duration(options.ZKConnectTimeout)*time.Second,
+		).String()
+		log.WithFields(logrus.Fields{
+			"dsn":            dsn,
+			"sessiontimeout": options.ZKSessionTimeout,
+			"endpoints":      options.Etcd,
+		}).Debug("Establishing connection to etcd")
+		return coordclient.New(coordetcd.DriverName, dsn, "/", nil)
+	}
 	coordzk.RegisterZKLogger()
 	dsn := coordzk.NewDSN(zks,
 		time.Duration(options.ZKSessionTimeout)*time.Second,
@@ -457,6 +517,12 @@ func (d *daemon) startMaster() (err error) {
 
 	keylog.Info("Loaded master keys from disk")
 
+	// Load the certificate authority for mux connections
+	muxCAFile := filepath.Join(options.IsvcsPath, auth.MuxCAFileName)
+	if err = auth.CreateOrLoadMuxCA(muxCAFile); err != nil {
+		log.WithField("cafile", muxCAFile).WithError(err).Fatal("Unable to load or create mux certificate authority")
+	}
+
 	// This is storage related
 	storagelogger := log.WithFields(logrus.Fields{
 		"path":   options.VolumesPath,
@@ -473,7 +539,12 @@ func (d *daemon) startMaster() (err error) {
 		storagelogger.WithError(err).Fatal("Unable to access application storage")
 	}
 
-	if d.net, err = nfs.NewServer(options.VolumesPath, "serviced_volumes_v2", "0.0.0.0/0"); err != nil {
+	if options.DFSTransport == ninep.TransportName {
+		timeout := time.Duration(options.DFSMountTimeout) * time.Second
+		if d.net, err = ninep.NewServer(options.VolumesPath, "serviced_volumes_v2", options.DFSPort, timeout); err != nil {
+			storagelogger.WithError(err).Fatal("Unable to initialize 9p server")
+		}
+	} else if d.net, err = nfs.NewServer(options.VolumesPath, "serviced_volumes_v2", "0.0.0.0/0"); err != nil {
 		storagelogger.WithError(err).Fatal("Unable to initialize NFS server")
 	}
 
@@ -486,79 +557,65 @@ func (d *daemon) startMaster() (err error) {
 	d.facade = d.initFacade()
 	d.cpDao = d.initDAO()
 
-	// Initialize service state manager
-	d.initServiceStateManager(time.Duration(options.ServiceRunLevelTimeout) * time.Second)
-	d.facade.SetServiceStateManager(d.ssm)
-
-	// Update current states
-	d.facade.SyncCurrentStates(d.dsContext)
-
-	if err = d.checkVersion(); err != nil {
-		log.WithError(err).Fatal("Unable to initialize version")
+	validator := facade.NewDfsClientValidator(d.facade, d.dsContext)
+	switch server := d.net.(type) {
+	case *nfs.Server:
+		server.SetClientValidator(validator)
+	case *ninep.Server:
+		server.SetClientValidator(validator)
 	}
 
-	// Create tenant volumes if they do not already exist
-	tenantIDs, err := d.facade.GetTenantIDs(d.dsContext)
-	if err != nil {
-		log.WithError(err).Fatal("Unable to get deployed services")
+	if options.MasterVIP != "" {
+		vip, _, _ := net.ParseCIDR(options.MasterVIP)
+		d.storageHandler.SetExportIP(vip.String())
 	}
 
-	for _, tenantID := range tenantIDs {
-		tenantLogger := log.WithField("tenantid", tenantID)
-		// This is a tenant and should have a volume
-		_, err := d.disk.Get(tenantID)
-		if err == volume.ErrVolumeNotExists {
-			tenantLogger.Warn("Tenant volume not found")
-			if _, err := d.disk.Create(tenantID); err != nil {
-				tenantLogger.WithError(err).Fatal("Could not re-create tenant volume")
-			}
-			tenantLogger.Warn("Created new tenant volume")
-		} else if err != nil {
-			tenantLogger.WithError(err).Fatal("Could not get volume for tenant")
-		}
+	if options.MasterHA {
+		d.startElector(agentIP)
+	} else {
+		d.activateMaster(d.shutdown)
+		go d.runActiveMaster(d.shutdown)
 	}
 
-	// Set tenant volumes on nfs storagedriver
-	log.Debug("Exporting tenant volumes via NFS")
-	tenantVolumes := make(map[string]struct{})
-	for _, vol := range d.disk.List() {
-		tenantlogger := storagelogger.WithFields(logrus.Fields{"tenant": vol})
-		tenantlogger.Debug("Exporting tenant volume")
-		if tVol, err := d.disk.GetTenant(vol); err == nil {
-			if _, found := tenantVolumes[tVol.Path()]; !found {
-				tenantVolumes[tVol.Path()] = struct{}{}
-				d.net.AddVolume(tVol.Path())
-				tenantlogger.Info("Exported tenant volume via NFS")
-			}
-		} else {
-			tenantlogger.WithError(err).Error("Unable to export tenant volume via NFS. Application data will not be available on remote hosts")
-		}
-	}
+	log.Info("Started serviced master")
 
-	if err = d.facade.CreateDefaultPool(d.dsContext, d.masterPoolID); err != nil {
-		log.WithError(err).Fatal("Unable to create default pool")
-	}
+	return nil
+}
 
-	if err = d.facade.UpgradeRegistry(d.dsContext, "", false); err != nil {
-		log.WithError(err).Fatal("Unable to upgrade internal Docker image registry")
+// migrateSchema brings the stored entities up to the latest schema version,
+// or performs the dry run or rollback requested on the command line and
+// exits.
+func (d *daemon) migrateSchema() error {
+	options := config.GetOptions()
+	conn, err := zzk.GetLocalConnection("/")
+	if err != nil {
+		return err
 	}
-
-	if err = d.registerMasterRPC(); err != nil {
-		log.WithError(err).Fatal("Unable to register RPC services")
+	mutex, err := migration.Lock(conn)
+	if err != nil {
+		return err
 	}
-
-	nfsServer, ok := d.net.(*nfs.Server)
-	if ok {
-		nfsServer.SetClientValidator(facade.NewDfsClientValidator(d.facade, d.dsContext))
+	if err := mutex.Lock(); err != nil {
+		return err
 	}
+	defer mutex.Unlock()
 
-	d.initWeb()
-	d.addTemplates()
-	d.startScheduler()
-	d.startPoolListener()
-
-	log.Info("Started serviced master")
-
+	runner := migration.NewRunner(migration.Default(), properties.NewStore())
+	if len(options.SchemaRollback) == 0 {
+		if _, err := runner.Migrate(d.dsContext, options.SchemaDryRun); err != nil || !options.SchemaDryRun {
+			return err
+		}
+	}
+	for _, rollback := range options.SchemaRollback {
+		kind, version, _ := parseSchemaRollback(rollback)
+		if _, err := runner.Rollback(d.dsContext, kind, version, options.SchemaDryRun); err != nil {
+			return err
+		}
+	}
+	mutex.Unlock()
+	log.Info("Finished requested schema changes, exiting")
+	d.stopISVCS()
+	os.Exit(0)
 	return nil
 }
 
@@ -690,9 +747,11 @@ func createMuxListener() net.Listener {
 	)
 
 	muxDisableTLS, _ := strconv.ParseBool(options.MuxDisableTLS)
+	muxVerify, _ := strconv.ParseBool(options.MuxVerify)
 	log := log.WithFields(logrus.Fields{
-		"tls":  !muxDisableTLS,
-		"port": options.MuxPort,
+		"tls":    !muxDisableTLS,
+		"verify": muxVerify,
+		"port":   options.MuxPort,
 	})
 	log.Debug("Starting traffic multiplexer")
 
@@ -701,6 +760,7 @@ func createMuxListener() net.Listener {
 		if err != nil {
 			log.WithError(err).Fatal("Invalid TLS configuration")
 		}
+		tlsConfig = proxy.MuxServerTLSConfig(tlsConfig)
 		listener, err = tls.Listen("tcp", fmt.Sprintf(":%d", options.MuxPort), tlsConfig)
 		log = log.WithFields(logrus.Fields{
 			"ciphersuite": strings.Join(utils.CipherSuitesByName(tlsConfig), ","),
@@ -718,7 +778,11 @@ func createMuxListener() net.Listener {
 func (d *daemon) startAgent() error {
 	options := config.GetOptions()
 	muxListener := createMuxListener()
-	mux, err := proxy.NewTCPMux(muxListener)
+	var muxAuth proxy.MuxAuthorizer
+	if muxVerify, _ := strconv.ParseBool(options.MuxVerify); muxVerify {
+		muxAuth = newMuxAuthorizer(d.servicedEndpoint, options.UIPort)
+	}
+	mux, err := proxy.NewTCPMux(muxListener, muxAuth)
 	if err != nil {
 		log.WithError(err).Fatal("Could not start TCP multiplexer")
 	}
@@ -762,6 +826,7 @@ func (d *daemon) startAgent() error {
 	// Load delegate keys if they exist
 	delegateKeyFile := filepath.Join(options.EtcPath, auth.DelegateKeyFileName)
 	tokenFile := filepath.Join(options.EtcPath, auth.TokenFileName)
+	muxCertFile := filepath.Join(options.EtcPath, auth.MuxCertFileName)
 
 	// Start watching for delegate keys to be loaded
 	go auth.WatchDelegateKeyFile(delegateKeyFile, d.shutdown)
@@ -794,6 +859,25 @@ func (d *daemon) startAgent() error {
 		auth.TokenLoop(getToken, tokenFile, d.shutdown, forceRefresh)
 	}()
 
+	go func() {
+		select {
+		case <-auth.WaitForDelegateKeys(d.shutdown):
+		case <-d.shutdown:
+			return
+		}
+
+		// Get a certificate for the mux from the master
+		getMuxCert := func(csrPEM []byte) ([]byte, []byte, error) {
+			masterClient, err := master.NewClient(d.servicedEndpoint)
+			if err != nil {
+				return nil, nil, err
+			}
+			defer masterClient.Close()
+			return masterClient.IssueMuxCertificate(myHostID, csrPEM)
+		}
+		auth.MuxCertificateLoop(myHostID, getMuxCert, muxCertFile, d.shutdown)
+	}()
+
 	// initialize a listener to watch the master leader
 	leaderListener := zzk.NewLeaderListener("/scheduler")
 
@@ -938,7 +1022,7 @@ func (d *daemon) startAgent() error {
 			log := log.WithFields(logrus.Fields{
 				"path": options.VolumesPath,
 			})
-			nfsClient, err := storage.NewClient(thisHost, options.VolumesPath)
+			nfsClient, err := storage.NewClient(thisHost, options.VolumesPath, time.Duration(options.DFSMountTimeout)*time.Second)
 			if err != nil {
 				log.WithError(err).Fatal("Unable to connect to NFS server on the master")
 			}
@@ -978,6 +1062,7 @@ func (d *daemon) startAgent() error {
 		}
 
 		muxDisableTLS, _ := strconv.ParseBool(options.MuxDisableTLS)
+		muxMultiplex, _ := strconv.ParseBool(options.MuxMultiplex)
 		conntrackFlush, _ := strconv.ParseBool(options.ConntrackFlush)
 
 		agentOptions := node.AgentOptions{
@@ -992,9 +1077,11 @@ func (d *daemon) startAgent() error {
 			Mount:                 options.Mount,
 			FSType:                options.FSType,
 			Zookeepers:            options.Zookeepers,
+			Etcd:                  options.Etcd,
 			Mux:                   mux,
 			MuxPort:               fmt.Sprintf("%d", options.MuxPort),
 			UseTLS:                !muxDisableTLS,
+			MuxMultiplex:          muxMultiplex,
 			DockerRegistry:        options.DockerRegistry,
 			MaxContainerAge:       time.Duration(int(time.Second) * options.MaxContainerAge),
 			VirtualAddressSubnet:  options.VirtualAddressSubnet,
@@ -1010,9 +1097,14 @@ func (d *daemon) startAgent() error {
 			ZKReconnectMaxDelay:   options.ZKReconnectMaxDelay,
 			DelegateKeyFile:       delegateKeyFile,
 			TokenFile:             tokenFile,
+			DrainTimeout:          time.Duration(options.DrainTimeout) * time.Second,
 		}
+		// the agent pulls images from the docker registry of its pool
+		pullreg := registry.NewRegistryListener(d.docker, options.DockerRegistry, d.hostID)
+		pullreg.SetPoolID(thisHost.PoolID)
+
 		// creates a zClient that is not pool based!
-		hostAgent, err := node.NewHostAgent(agentOptions, d.reg)
+		hostAgent, err := node.NewHostAgent(agentOptions, pullreg)
 		d.hostAgent = hostAgent
 
 		d.waitGroup.Add(1)
@@ -1076,6 +1168,15 @@ func (d *daemon) startAgent() error {
 			reporter := iostat.NewReporter(time.Duration(options.StorageReportInterval)*time.Second, d.shutdown)
 			go volume.InitIOStat(reporter, d.shutdown)
 			go d.startStorageMonitor()
+			if options.StorageAutoExtend {
+				go d.startThinPoolMonitor()
+			}
+			if options.ReplicaListen != "" {
+				go d.startReplicaServer()
+			}
+			if options.ReplicaTarget != "" {
+				go d.startReplication()
+			}
 		}
 
 	}()
@@ -1166,9 +1267,11 @@ func (d *daemon) registerMasterRPC() error {
 	log.Debug("Registering master RPC services")
 	options := config.GetOptions()
 
-	server := master.NewServer(d.facade, d.tokenExpiration)
+	server := master.NewServer(d.facade, d.hostID, d.tokenExpiration)
+	// with master HA, calls from this host go through the rpc server, which
+	// refuses them while another host is the active master
 	disableLocal := os.Getenv("DISABLE_RPC_BYPASS")
-	if disableLocal == "" {
+	if disableLocal == "" && !options.MasterHA {
 		rpcutils.RegisterLocalAddress(options.Endpoint, fmt.Sprintf("localhost:%s", options.RPCPort),
 			fmt.Sprintf("127.0.0.1:%s", options.RPCPort))
 	} else {
@@ -1192,12 +1295,76 @@ func (d *daemon) registerMasterRPC() error {
 }
 
 func (d *daemon) initDriver() datastore.Driver {
+	d.initElasticAddress()
+	if d.dsStore != nil {
+		if d.migrateES {
+			d.migrateDatastore()
+		}
+		log.WithField("path", config.GetOptions().DatastorePath).Info("Using the embedded datastore")
+		return embedded.New(d.dsStore)
+	}
+	return d.initElasticDriver()
+}
+
+// openDatastore opens the embedded datastore.  If it is empty and
+// elasticsearch-serviced has data, the data is copied over once the master
+// starts.
+func (d *daemon) openDatastore() {
+	options := config.GetOptions()
+	logger := log.WithField("path", options.DatastorePath)
+	store, err := embedded.Open(options.DatastorePath)
+	if err != nil {
+		logger.WithError(err).Fatal("Unable to open the embedded datastore")
+	}
+	d.dsStore = store
+	if store.Empty() {
+		esData := filepath.Join(options.IsvcsPath, "elasticsearch-serviced", "data")
+		if files, err := ioutil.ReadDir(esData); err == nil && len(files) > 0 {
+			logger.WithField("esdata", esData).Info("Embedded datastore is empty; starting elasticsearch-serviced to migrate its data")
+			d.migrateES = true
+		}
+	}
+}
+
+// migrateDatastore copies every entity from elasticsearch-serviced into the
+// embedded datastore
+func (d *daemon) migrateDatastore() {
+	d.initElasticDriver()
+	count, err := d.dsStore.Import(func(put func(kind, id string, version int, data json.RawMessage) error) error {
+		return elastic.Export("controlplane", put)
+	})
+	if err != nil {
+		log.WithError(err).Fatal("Unable to migrate data from Elastic to the embedded datastore")
+	}
+	log.WithField("entities", count).Info("Migrated data from Elastic to the embedded datastore; elasticsearch-serviced will not be started again")
+}
+
+// initElasticAddress sets the address of elasticsearch-serviced, which is
+// either the isvc on this host or an external cluster.
+func (d *daemon) initElasticAddress() {
+	d.esHost, d.esPort = "localhost", 9200
+	endpoints := isvcs.ExternalEndpoints("elasticsearch-serviced")
+	if len(endpoints) == 0 {
+		return
+	}
+	tlsConfig, err := isvcs.ExternalTLSConfig()
+	if err != nil {
+		log.WithError(err).Fatal("Unable to load the certificate authority for external internal services")
+	}
+	host, port, err := elastic.UseExternal(endpoints, tlsConfig)
+	if err != nil {
+		log.WithError(err).Fatal("Unable to use the external Elastic cluster")
+	}
+	d.esHost, d.esPort = host, port
+}
+
+func (d *daemon) initElasticDriver() datastore.Driver {
 	log := log.WithFields(logrus.Fields{
-		"address": "localhost:9200",
+		"address": fmt.Sprintf("%s:%d", d.esHost, d.esPort),
 		"index":   "controlplane",
 	})
 	log.Debug("Establishing connection with Elastic")
-	eDriver := elastic.New("localhost", 9200, "controlplane")
+	eDriver := elastic.New(d.esHost, d.esPort, "controlplane")
 	eDriver.AddMapping(host.MAPPING)
 	eDriver.AddMapping(pool.MAPPING)
 	eDriver.AddMapping(servicetemplate.MAPPING)
@@ -1212,8 +1379,16 @@ func (d *daemon) initDriver() datastore.Driver {
 	return eDriver
 }
 
+// metricsAddress returns the url of the metrics query service
+func metricsAddress() string {
+	if endpoints := isvcs.ExternalEndpoints("opentsdb"); len(endpoints) > 0 {
+		return endpoints[0]
+	}
+	return fmt.Sprintf("http://%s:8888", localhost)
+}
+
 func initMetricsClient() *metrics.Client {
-	addr := fmt.Sprintf("http://%s:8888", localhost)
+	addr := metricsAddress()
 	log := log.WithFields(logrus.Fields{
 		"metricsaddr": addr,
 	})
@@ -1226,14 +1401,46 @@ func initMetricsClient() *metrics.Client {
 	return client
 }
 
+// registryHost returns the host:port of a docker registry address that may
+// include a namespace.
+func registryHost(address string) string {
+	return strings.SplitN(address, "/", 2)[0]
+}
+
+// initRegistryCollector sets up garbage collection for the docker registry.
+// An external registry deletes its own blobs.
+func initRegistryCollector() *registry.RegistryCollector {
+	options := config.GetOptions()
+	if !options.DockerRegistryExternal {
+		return registry.NewRegistryCollector(options.DockerRegistry, isvcs.CollectRegistryGarbage)
+	}
+	collector := registry.NewRegistryCollector(options.DockerRegistry, nil)
+	collector.SetCredentials(options.DockerRegistryUsername, options.DockerRegistryPassword)
+	if !options.DockerRegistryInsecure {
+		if err := collector.SetTLS(options.DockerRegistryCA); err != nil {
+			log.WithField("cafile", options.DockerRegistryCA).WithError(err).Fatal("Unable to load the certificate authority of the docker registry")
+		}
+	}
+	return collector
+}
+
 func (d *daemon) initFacade() *facade.Facade {
 	options := config.GetOptions()
 	f := facade.New()
 	index := registry.NewRegistryIndexClient(f)
 	dfs := dfs.NewDistributedFilesystem(d.docker, index, d.reg, d.disk, d.net, time.Duration(options.MaxDFSTimeout)*time.Second)
 	dfs.SetTmp(os.Getenv("TMP"))
+	dfs.SetCollector(initRegistryCollector())
 	f.SetDFS(dfs)
 	f.SetIsvcsPath(options.IsvcsPath)
+	f.SetExternalRegistry(options.DockerRegistryExternal)
+	if options.LogOutputsFile != "" {
+		outputs, err := loadLogOutputs(options.LogOutputsFile)
+		if err != nil {
+			log.WithError(err).WithField("file", options.LogOutputsFile).Fatal("Unable to load the log outputs")
+		}
+		f.SetLogOutputs(outputs)
+	}
 	d.hcache = health.New()
 	d.hcache.SetPurgeFrequency(5 * time.Second)
 	f.SetHealthCache(d.hcache)
@@ -1249,6 +1456,22 @@ func (d *daemon) initFacade() *facade.Facade {
 	return f
 }
 
+// loadLogOutputs reads the cluster-wide log forwarding outputs from a json file
+func loadLogOutputs(path string) ([]servicedefinition.LogOutput, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []servicedefinition.LogOutput
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		return nil, err
+	}
+	if err := servicedefinition.ValidLogOutputs(outputs); err != nil {
+		return nil, err
+	}
+	return outputs, nil
+}
+
 // startLogstashPurger purges logstash based on days and size
 func (d *daemon) startLogstashPurger(initialStart, cycleTime time.Duration) {
 	options := config.GetOptions()
@@ -1272,6 +1495,7 @@ func (d *daemon) startStorageMonitor() {
 	options := config.GetOptions()
 	defer log.Info("Stopped monitoring application storage availability")
 	for {
+		d.enforceStorageQuotas()
 		lookahead := time.Duration(options.StorageLookaheadPeriod) * time.Second
 		log.WithField("period", lookahead).Debug("Estimating future storage availability")
 		if avail, err := d.facade.PredictStorageAvailability(d.dsContext, lookahead); err != nil {
@@ -1386,6 +1610,181 @@ func (d *daemon) startStorageMonitor() {
 	}
 }
 
+// enforceStorageQuotas emergency stops applications that have used up their
+// storage quota, so that they are stopped cleanly instead of failing on the
+// writes that the filesystem refuses.
+func (d *daemon) enforceStorageQuotas() {
+	status, err := d.disk.Status()
+	if err != nil {
+		log.WithError(err).Debug("Unable to get volume status to check storage quotas")
+		return
+	}
+	simple, ok := status.(*volume.SimpleStatus)
+	if !ok {
+		// devicemapper enforces quotas with the size of the device
+		return
+	}
+	for _, tss := range simple.Tenants {
+		if tss.Quota == 0 || tss.FilesystemUsed < tss.Quota {
+			continue
+		}
+		log := log.WithFields(logrus.Fields{
+			"service": tss.TenantID,
+			"quota":   tss.Quota,
+			"used":    tss.FilesystemUsed,
+		})
+		svc, _ := d.facade.GetService(d.dsContext, tss.TenantID)
+		if svc != nil && svc.EmergencyShutdown {
+			log.Debug("Skipping emergency stop of already stopped service")
+			continue
+		}
+		log.Error("Application has used up its storage quota")
+		if n, err := d.facade.EmergencyStopService(d.dsContext, dao.ScheduleServiceRequest{
+			ServiceIDs:  []string{tss.TenantID},
+			AutoLaunch:  true,
+			Synchronous: false,
+		}); err != nil {
+			log.WithError(err).Error("Unable to perform emergency stop of application")
+		} else {
+			log.WithField("numservices", n).Info("Emergency stop initiated")
+		}
+	}
+}
+
+// startThinPoolMonitor extends the devicemapper thin pool from the free space
+// in its volume group as it fills up, so that applications are not emergency
+// stopped while there is still space on the host.  Each extension is audited,
+// as is each new reason that the thin pool could not be extended.
+func (d *daemon) startThinPoolMonitor() {
+	options := config.GetOptions()
+	monitor, err := devicemapper.NewThinPoolMonitor(d.disk, devicemapper.ExtendPolicy{
+		DataThreshold:     options.StorageExtendDataThreshold,
+		MetadataThreshold: options.StorageExtendMetaThreshold,
+		ExtendPercent:     options.StorageExtendPercent,
+	})
+	if err != nil {
+		log.WithError(err).Warn("Unable to monitor the thin pool for automatic extension")
+		return
+	}
+	auditLogger := audit.NewLogger()
+	log.Info("Started monitoring the thin pool for automatic extension")
+	defer log.Info("Stopped monitoring the thin pool for automatic extension")
+	var lastErr error
+	for {
+		ext, err := monitor.Check()
+		fields := logrus.Fields{
+			"pool":              ext.Usage.PoolName,
+			"datapercent":       ext.Usage.DataPercent(),
+			"metadatapercent":   ext.Usage.MetadataPercent(),
+			"datarequested":     ext.DataRequested,
+			"metadatarequested": ext.MetadataRequested,
+			"dataadded":         ext.DataAdded,
+			"metadataadded":     ext.MetadataAdded,
+		}
+		log := log.WithFields(fields)
+		if ext.DataAdded > 0 || ext.MetadataAdded > 0 {
+			log.Warn("Extended the thin pool")
+			auditLogger.Message(d.dsContext, "Extended Thin Pool").Action(audit.Extend).
+				Type("thinpool").ID(ext.Usage.PoolName).WithFields(fields).Succeeded()
+		}
+		if err != nil && (lastErr == nil || err.Error() != lastErr.Error()) {
+			log.WithError(err).Error("Unable to extend the thin pool; applications will be emergency stopped if it fills up")
+			auditLogger.Message(d.dsContext, "Unable to Extend Thin Pool").Action(audit.Extend).
+				Type("thinpool").ID(ext.Usage.PoolName).WithFields(fields).WithField("error", err.Error()).Failed()
+		} else if err == nil && lastErr != nil {
+			log.Info("The thin pool is no longer at risk of filling up")
+		}
+		lastErr = err
+		select {
+		case <-d.shutdown:
+			return
+		case <-time.After(time.Duration(options.StorageReportInterval) * time.Second):
+		}
+	}
+}
+
+// getReplicaKey reads the key shared by the primary and standby masters
+func getReplicaKey() (string, error) {
+	options := config.GetOptions()
+	if options.ReplicaKeyFile == "" {
+		return "", errors.New("SERVICED_REPLICA_KEY_FILE is not set")
+	}
+	data, err := ioutil.ReadFile(options.ReplicaKeyFile)
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("replica key file %s is empty", options.ReplicaKeyFile)
+	}
+	return key, nil
+}
+
+// startReplicaServer receives replicas from the primary master
+func (d *daemon) startReplicaServer() {
+	options := config.GetOptions()
+	logger := log.WithField("address", options.ReplicaListen)
+	key, err := getReplicaKey()
+	if err != nil {
+		logger.WithError(err).Error("Unable to receive replicas from the primary master")
+		return
+	}
+	tlsConfig, err := getTLSConfig("rpc")
+	if err != nil {
+		logger.WithError(err).Error("Unable to get TLS config for the replica server")
+		return
+	}
+	listener, err := tls.Listen("tcp", options.ReplicaListen, tlsConfig)
+	if err != nil {
+		logger.WithError(err).Error("Unable to listen for replicas from the primary master")
+		return
+	}
+	go func() {
+		<-d.shutdown
+		listener.Close()
+	}()
+	logger.Info("Receiving replicas from the primary master")
+	if err := http.Serve(listener, replica.NewServer(d.facade, key)); err != nil {
+		select {
+		case <-d.shutdown:
+		default:
+			logger.WithError(err).Error("Stopped receiving replicas from the primary master")
+		}
+	}
+}
+
+// startReplication periodically replicates to the standby master
+func (d *daemon) startReplication() {
+	options := config.GetOptions()
+	logger := log.WithField("standby", options.ReplicaTarget)
+	key, err := getReplicaKey()
+	if err != nil {
+		logger.WithError(err).Error("Unable to replicate to the standby master")
+		return
+	}
+	interval := time.Duration(options.ReplicaInterval) * time.Minute
+	if interval <= 0 {
+		logger.WithField("interval", options.ReplicaInterval).Error("Invalid replica interval; not replicating to the standby master")
+		return
+	}
+	standby := replica.NewClient(options.ReplicaTarget, key, &tls.Config{InsecureSkipVerify: !rpcutils.RPCCertVerify})
+	logger.WithField("interval", interval).Info("Started replicating to the standby master")
+	defer logger.Info("Stopped replicating to the standby master")
+	for {
+		if err := d.facade.Replicate(d.dsContext, standby, options.SnapshotSpacePercent); err == replica.ErrPromoted {
+			logger.Error("The standby master has been promoted; no longer replicating")
+			return
+		} else if err != nil {
+			logger.WithError(err).Error("Unable to replicate to the standby master")
+		}
+		select {
+		case <-d.shutdown:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
 // FIXME: The dao package is deprecated and should be removed.
 func (d *daemon) initDAO() dao.ControlPlane {
 	options := config.GetOptions()
@@ -1399,14 +1798,160 @@ func (d *daemon) initDAO() dao.ControlPlane {
 			"backupspath": options.BackupsPath,
 		}).WithError(err).Fatal("Unable to create backup path")
 	}
-	cp, err := elasticsearch.NewControlSvc("localhost", 9200, d.facade, options.BackupsPath, rpcPortInt)
+	cp, err := elasticsearch.NewControlSvc(d.esHost, int(d.esPort), metricsAddress(), d.facade, options.BackupsPath, rpcPortInt)
 	if err != nil {
 		log.WithError(err).Fatal("Unable to initialize DAO layer")
 	}
 	return cp
 }
 
-func (d *daemon) initWeb() {
+// activateMaster prepares this host to act as the active master: it starts
+// the service state manager, brings the datastore up to date, creates and
+// exports the tenant volumes, upgrades the registry and serves the master
+// RPC services.  Standby masters do none of this until they are elected.
+func (d *daemon) activateMaster(stop <-chan interface{}) {
+	options := config.GetOptions()
+
+	// Initialize service state manager
+	d.initServiceStateManager(time.Duration(options.ServiceRunLevelTimeout)*time.Second, stop)
+	d.facade.SetServiceStateManager(d.ssm)
+
+	// Update current states
+	d.facade.SyncCurrentStates(d.dsContext)
+
+	if err := d.checkVersion(); err != nil {
+		log.WithError(err).Fatal("Unable to initialize version")
+	}
+
+	if err := d.migrateSchema(); err != nil {
+		log.WithError(err).Fatal("Unable to migrate the datastore schema")
+	}
+
+	// Create tenant volumes if they do not already exist
+	tenantIDs, err := d.facade.GetTenantIDs(d.dsContext)
+	if err != nil {
+		log.WithError(err).Fatal("Unable to get deployed services")
+	}
+
+	for _, tenantID := range tenantIDs {
+		tenantLogger := log.WithField("tenantid", tenantID)
+		// This is a tenant and should have a volume
+		_, err := d.disk.Get(tenantID)
+		if err == volume.ErrVolumeNotExists {
+			tenantLogger.Warn("Tenant volume not found")
+			if _, err := d.disk.Create(tenantID); err != nil {
+				tenantLogger.WithError(err).Fatal("Could not re-create tenant volume")
+			}
+			tenantLogger.Warn("Created new tenant volume")
+		} else if err != nil {
+			tenantLogger.WithError(err).Fatal("Could not get volume for tenant")
+		}
+		// Make sure the volume has the storage quota of the tenant, in case
+		// the volume was re-created or moved to another driver
+		if svc, err := d.facade.GetService(d.dsContext, tenantID); err != nil {
+			tenantLogger.WithError(err).Warn("Could not look up tenant to set its storage quota")
+		} else if svc.StorageQuota.Value > 0 {
+			if err := d.disk.Resize(tenantID, svc.StorageQuota.Value); err != nil {
+				tenantLogger.WithError(err).WithField("quota", svc.StorageQuota.Value).Warn("Could not set storage quota on tenant volume")
+			}
+		}
+	}
+
+	// Set tenant volumes on nfs storagedriver
+	log.Debug("Exporting tenant volumes via NFS")
+	tenantVolumes := make(map[string]struct{})
+	for _, vol := range d.disk.List() {
+		tenantlogger := log.WithFields(logrus.Fields{
+			"path":   options.VolumesPath,
+			"driver": options.FSType,
+			"tenant": vol,
+		})
+		tenantlogger.Debug("Exporting tenant volume")
+		if tVol, err := d.disk.GetTenant(vol); err == nil {
+			if _, found := tenantVolumes[tVol.Path()]; !found {
+				tenantVolumes[tVol.Path()] = struct{}{}
+				d.net.AddVolume(tVol.Path())
+				tenantlogger.Info("Exported tenant volume via NFS")
+			}
+		} else {
+			tenantlogger.WithError(err).Error("Unable to export tenant volume via NFS. Application data will not be available on remote hosts")
+		}
+	}
+
+	if err := d.facade.CreateDefaultPool(d.dsContext, d.masterPoolID); err != nil {
+		log.WithError(err).Fatal("Unable to create default pool")
+	}
+
+	if err := d.facade.UpgradeRegistry(d.dsContext, "", false); err != nil {
+		log.WithError(err).Fatal("Unable to upgrade internal Docker image registry")
+	}
+
+	// net/rpc cannot take a service back, so the services are registered
+	// in the first term and refused by the rpc server in between terms
+	d.masterRPC.Do(func() {
+		if err := d.registerMasterRPC(); err != nil {
+			log.WithError(err).Fatal("Unable to register RPC services")
+		}
+	})
+}
+
+// runActiveMaster runs the master-only subsystems until stop is closed
+func (d *daemon) runActiveMaster(stop <-chan interface{}) {
+	d.initWeb(stop)
+	d.addTemplates()
+	d.startPoolListener(stop)
+	d.runScheduler(stop)
+}
+
+// isActiveMaster returns true while this host is the elected master
+func (d *daemon) isActiveMaster() bool {
+	return atomic.LoadInt32(&d.masterActive) == 1
+}
+
+// startElector runs the master-only subsystems while this host is the
+// master elected among the master-capable hosts
+func (d *daemon) startElector(ipAddress string) {
+	options := config.GetOptions()
+	iface := options.MasterVIPInterface
+	if options.MasterVIP != "" && iface == "" {
+		var err error
+		if iface, err = ha.InterfaceFor(ipAddress); err != nil {
+			log.WithError(err).WithField("address", ipAddress).Fatal("Unable to determine the device for the master virtual ip")
+		}
+	}
+	fenceDelay := options.MasterFenceDelay
+	if fenceDelay <= 0 {
+		fenceDelay = options.ZKSessionTimeout
+	}
+	cfg := ha.Config{
+		HostID:       d.hostID,
+		IPAddress:    ipAddress,
+		VirtualIP:    options.MasterVIP,
+		Interface:    iface,
+		FenceCommand: options.MasterFenceCommand,
+		FenceDelay:   time.Duration(fenceDelay) * time.Second,
+	}
+	elector := ha.NewElector(cfg, node.NewVirtualIPManager(ha.VIPLabel), func(stop <-chan interface{}) {
+		d.activateMaster(stop)
+		atomic.StoreInt32(&d.masterActive, 1)
+		d.runActiveMaster(stop)
+		atomic.StoreInt32(&d.masterActive, 0)
+
+		// a master that stepped down must not serve application data
+		d.net.SetClients()
+		if err := d.net.Sync(); err != nil {
+			log.WithError(err).Warn("Unable to stop exporting the distributed filesystem")
+		}
+	})
+	log.WithFields(logrus.Fields{
+		"virtualip":  cfg.VirtualIP,
+		"interface":  cfg.Interface,
+		"fencedelay": cfg.FenceDelay,
+	}).Info("Entering the master election")
+	go elector.Run(d.shutdown)
+}
+
+func (d *daemon) initWeb(shutdown <-chan interface{}) {
 	options := config.GetOptions()
 	// Run the first time after 10 minutes
 	// TODO: Make bind port for web server optional?
@@ -1435,14 +1980,10 @@ func (d *daemon) initWeb() {
 		"cachetimeout": options.SvcStatsCacheTimeout,
 	}).Debug("Set service stats cache timeout to configured value")
 
-	go cpserver.Serve(d.shutdown)
+	go cpserver.Serve(shutdown)
 	log.Info("Started Control Center UI server")
 }
 
-func (d *daemon) startScheduler() {
-	go d.runScheduler()
-}
-
 func (d *daemon) addTemplates() {
 	root := utils.LocalDir("templates")
 	log := log.WithFields(logrus.Fields{
@@ -1504,7 +2045,7 @@ func (d *daemon) addTemplates() {
 	}()
 }
 
-func (d *daemon) startPoolListener() {
+func (d *daemon) startPoolListener(shutdown <-chan interface{}) {
 	go func() {
 		for {
 			var conn coordclient.Connection
@@ -1512,22 +2053,22 @@ func (d *daemon) startPoolListener() {
 			case conn = <-zzk.Connect("/", zzk.GetLocalConnection):
 				if conn != nil {
 					log.Debug("Starting Pool Listener")
-					zzkservice.StartPoolListener(d.shutdown, conn)
+					zzkservice.StartPoolListener(shutdown, conn)
 					return
 				}
-			case <-d.shutdown:
+			case <-shutdown:
 				return
 			}
 		}
 	}()
 }
 
-func (d *daemon) runScheduler() {
+func (d *daemon) runScheduler(shutdown <-chan interface{}) {
 	log.Debug("Starting service scheduler")
 	options := config.GetOptions()
 	// Run the first time after 10 minutes
 	for {
-		sched, err := scheduler.NewScheduler(d.masterPoolID, d.hostID, d.storageHandler, d.cpDao, d.facade, d.reg, options.SnapshotTTL)
+		sched, err := scheduler.NewScheduler(d.masterPoolID, d.hostID, d.storageHandler, d.cpDao, d.facade, d.reg, options.SnapshotTTL, options.RegistryGCInterval)
 		if err != nil {
 			log.WithError(err).Fatal("Unable to start service scheduler")
 			return
@@ -1536,7 +2077,7 @@ func (d *daemon) runScheduler() {
 		sched.Start()
 		log.Info("Started service scheduler")
 		select {
-		case <-d.shutdown:
+		case <-shutdown:
 			log.Debug("Shutting down service scheduler")
 			sched.Stop()
 			log.Info("Stopped service scheduler")
@@ -1545,13 +2086,13 @@ func (d *daemon) runScheduler() {
 	}
 }
 
-func (d *daemon) initServiceStateManager(runLevelTimeout time.Duration) {
+func (d *daemon) initServiceStateManager(runLevelTimeout time.Duration, stop <-chan interface{}) {
 	bssm := servicestatemanager.NewBatchServiceStateManager(d.facade, d.dsContext, runLevelTimeout)
 	d.ssm = bssm
 	go func() {
 		bssm.Start()
 		log.WithField("leveltimeout", runLevelTimeout).Info("Started service state manager")
-		<-d.shutdown
+		<-stop
 		log.Debug("Shutting down service state manager")
 		bssm.Shutdown()
 	}()
@@ -20,6 +20,8 @@ import (
 	_ "github.com/control-center/serviced/volume/rsync"
 // Need to do devicemapper driver initializations
 	_ "github.com/control-center/serviced/volume/devicemapper"
+// Need to do reflink driver initializations
+	_ "github.com/control-center/serviced/volume/reflink"
 // Need to do nfs driver initializations
 	_ "github.com/control-center/serviced/volume/nfs"
 )
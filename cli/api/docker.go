@@ -13,6 +13,8 @@
 
 package api
 
+import "github.com/control-center/serviced/dfs"
+
 // ResetRegistry moves all relevant images into the new docker registry
 func (a *api) ResetRegistry() error {
 	client, err := a.connectMaster()
@@ -49,3 +51,13 @@ func (a *api) DockerOverride(newImage string, oldImage string) error {
 	}
 	return client.DockerOverride(newImage, oldImage)
 }
+
+// CollectRegistryGarbage removes the images that are not used by any service
+// or snapshot from the docker registry.
+func (a *api) CollectRegistryGarbage(dryRun bool) (*dfs.RegistryGCReport, error) {
+	client, err := a.connectMaster()
+	if err != nil {
+		return nil, err
+	}
+	return client.CollectRegistryGarbage(dryRun)
+}
@@ -17,6 +17,8 @@ import (
 	"io"
 
 	"github.com/control-center/serviced/dao"
+	"github.com/control-center/serviced/dfs"
+	"github.com/control-center/serviced/doctor"
 	"github.com/control-center/serviced/domain/applicationendpoint"
 	"github.com/control-center/serviced/domain/host"
 	"github.com/control-center/serviced/domain/pool"
@@ -99,6 +101,14 @@ type API interface {
 	Rollback(string, bool) error
 	TagSnapshot(string, string) error
 	RemoveSnapshotTag(string, string) (string, error)
+	ListSnapshotFiles(string, string) ([]volume.SnapshotFile, error)
+	DiffSnapshots(string, string, string) ([]volume.SnapshotChange, error)
+	RestoreSnapshotPath(string, string, string) (int, error)
+	PromoteReplica() error
+
+	// Applications
+	ExportApp(string, string) (string, error)
+	ImportApp(string, string) (string, error)
 
 	// Templates
 	GetServiceTemplates() ([]template.ServiceTemplate, error)
@@ -112,15 +122,24 @@ type API interface {
 	GetBackupEstimate(string, []string) (*dao.BackupEstimate, error)
 	Backup(string, []string, bool) (string, error)
 	Restore(string) error
+	ResumeRestore(string) error
+	GetRestoreStatus() (*dfs.RestoreStatus, error)
+	CancelRestore() error
+	VerifyBackup(string) (*dfs.BackupReport, error)
 
 	// Docker
 	ResetRegistry() error
 	RegistrySync() error
 	UpgradeRegistry(endpoint string, override bool) error
 	DockerOverride(newImage string, oldImage string) error
+	CollectRegistryGarbage(dryRun bool) (*dfs.RegistryGCReport, error)
+
+	// Consistency
+	Doctor(repair bool) (*doctor.Report, error)
 
 	// Logs
 	ExportLogs(config ExportLogsConfig) error
+	TailLogs(config TailLogsConfig, stopChan chan struct{}) error
 
 	// Metric
 	PostMetric(metricName string, metricValue string) (string, error)
@@ -0,0 +1,106 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/control-center/serviced/config"
+	"github.com/control-center/serviced/logtail"
+)
+
+// TailLogsConfig is the deserialized object from the command-line
+type TailLogsConfig struct {
+	// The services to follow the logs of, including their child services
+	ServiceIDs []string
+
+	// Only follow the logs of this instance, if not empty
+	InstanceID string
+
+	// Only show the lines that match this regular expression, if not empty
+	Grep string
+
+	// Start with the lines logged this long ago
+	Since time.Duration
+
+	// Where the lines are written; defaults to stdout
+	Output io.Writer
+}
+
+// TailLogs follows the application logs of services until stopChan is
+// closed.  Each line is prefixed with the host, the service instance and the
+// log file it came from.
+func (a *api) TailLogs(cfg TailLogsConfig, stopChan chan struct{}) error {
+	if cfg.Output == nil {
+		cfg.Output = os.Stdout
+	}
+	filter := logtail.Filter{
+		InstanceID: cfg.InstanceID,
+		Since:      time.Now().Add(-cfg.Since),
+	}
+	if cfg.Grep != "" {
+		grep, err := regexp.Compile(cfg.Grep)
+		if err != nil {
+			return fmt.Errorf("invalid grep pattern: %s", err)
+		}
+		filter.Grep = grep
+	}
+
+	services, err := a.GetAllServiceDetails()
+	if err != nil {
+		return fmt.Errorf("failed to get list of services: %s", err)
+	}
+	serviceNames := make(map[string]string)
+	for _, svc := range services {
+		serviceNames[svc.ID] = svc.Name
+	}
+	filter.ServiceIDs = logtail.Descendants(cfg.ServiceIDs, services)
+
+	hostMap, err := a.GetHostMap()
+	if err != nil {
+		return fmt.Errorf("failed to get list of hosts: %s", err)
+	}
+
+	client := logtail.NewClient(config.GetOptions().LogstashES)
+	lines := make(chan logtail.Line)
+	errc := make(chan error, 1)
+	cancel := make(chan struct{})
+	defer close(cancel)
+	go func() {
+		errc <- client.Tail(filter, lines, cancel)
+	}()
+
+	for {
+		select {
+		case line := <-lines:
+			hostName := line.HostID
+			if h, ok := hostMap[line.HostID]; ok {
+				hostName = h.Name
+			}
+			serviceName := line.ServiceID
+			if name, ok := serviceNames[line.ServiceID]; ok {
+				serviceName = name
+			}
+			fmt.Fprintf(cfg.Output, "%s %s/%s %s: %s\n", hostName, serviceName, line.InstanceID, line.File, line.Message)
+		case err := <-errc:
+			return err
+		case <-stopChan:
+			return nil
+		}
+	}
+}
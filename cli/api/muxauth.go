@@ -0,0 +1,182 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/control-center/serviced/auth"
+	"github.com/control-center/serviced/rpc/master"
+	"github.com/control-center/serviced/utils"
+	"github.com/control-center/serviced/zzk"
+	"github.com/control-center/serviced/zzk/registry"
+)
+
+// ErrMuxUnauthorized is returned when the host of a mux caller may not reach
+// the address it asks for.
+var ErrMuxUnauthorized = errors.New("host may not reach the address")
+
+// muxAuthorizerCacheTTL is how long an authorized address is remembered
+// before checking again.
+const muxAuthorizerCacheTTL = time.Minute
+
+// controlPlanePorts are the ports of the control center endpoints, besides
+// the UI, that containers reach through the mux of the master: the consumer,
+// logstash and kibana.
+var controlPlanePorts = []string{"8443", "5042", "5043", "5601"}
+
+// muxAuthorizer lets mux callers reach the container addresses of the exports
+// on this host, if the caller's host runs an instance of the export's tenant.
+// The caller's host comes from its token, which is signed by the master, and
+// the tenant from where the export is registered. Any caller may reach the
+// control center endpoints on the addresses of this host.
+type muxAuthorizer struct {
+	mu                sync.Mutex
+	allowed           map[string]time.Time
+	localIPs          map[string]struct{}
+	controlPlanePorts map[string]struct{}
+
+	// issued holds when to check again whether a host has been issued a
+	// certificate, or the zero time once it has been
+	issued map[string]time.Time
+
+	lookupExport      func(tenantID, application, address string) (*registry.ExportDetails, error)
+	canReachTenant    func(hostID, tenantID string) (bool, error)
+	certificateIssued func(hostID string) (bool, error)
+}
+
+func newMuxAuthorizer(masterAddress, uiPort string) *muxAuthorizer {
+	localIPs := map[string]struct{}{"127.0.0.1": struct{}{}}
+	if ips, err := utils.GetIPv4Addresses(); err == nil {
+		for _, ip := range ips {
+			localIPs[ip] = struct{}{}
+		}
+	}
+	ports := make(map[string]struct{})
+	for _, port := range controlPlanePorts {
+		ports[port] = struct{}{}
+	}
+	if _, port, err := net.SplitHostPort(uiPort); err == nil {
+		ports[port] = struct{}{}
+	}
+	return &muxAuthorizer{
+		allowed:           make(map[string]time.Time),
+		issued:            make(map[string]time.Time),
+		localIPs:          localIPs,
+		controlPlanePorts: ports,
+		lookupExport: func(tenantID, application, address string) (*registry.ExportDetails, error) {
+			conn, err := zzk.GetLocalConnection("/")
+			if err != nil {
+				return nil, err
+			}
+			return registry.LookupExport(conn, tenantID, application, address)
+		},
+		canReachTenant: func(hostID, tenantID string) (bool, error) {
+			masterClient, err := master.NewClient(masterAddress)
+			if err != nil {
+				return false, err
+			}
+			defer masterClient.Close()
+			return masterClient.HostCanReachTenant(hostID, tenantID)
+		},
+		certificateIssued: func(hostID string) (bool, error) {
+			masterClient, err := master.NewClient(masterAddress)
+			if err != nil {
+				return false, err
+			}
+			defer masterClient.Close()
+			h, err := masterClient.GetHost(hostID)
+			if err != nil {
+				return false, err
+			}
+			return h.MuxCertificateIssued, nil
+		},
+	}
+}
+
+// Authorize implements proxy.MuxAuthorizer
+func (a *muxAuthorizer) Authorize(identity auth.Identity, tenantID, application, address string) error {
+	ip, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if _, ok := a.localIPs[ip]; ok {
+		if _, ok := a.controlPlanePorts[port]; ok {
+			return nil
+		}
+	}
+
+	hostID := identity.HostID()
+	key := strings.Join([]string{hostID, address}, "/")
+	a.mu.Lock()
+	expires, ok := a.allowed[key]
+	a.mu.Unlock()
+	if ok && time.Now().Before(expires) {
+		return nil
+	}
+
+	// The tenant and application named by the caller only narrow the search;
+	// the tenant that is checked is the one the export is registered in.
+	export, err := a.lookupExport(tenantID, application, address)
+	if err != nil {
+		return err
+	} else if export == nil {
+		return ErrMuxUnauthorized
+	}
+	if _, ok := a.localIPs[export.HostIP]; !ok {
+		return ErrMuxUnauthorized
+	}
+	if ok, err := a.canReachTenant(hostID, export.TenantID); err != nil {
+		return err
+	} else if !ok {
+		return ErrMuxUnauthorized
+	}
+
+	a.mu.Lock()
+	a.allowed[key] = time.Now().Add(muxAuthorizerCacheTTL)
+	a.mu.Unlock()
+	return nil
+}
+
+// AllowWithoutCertificate implements proxy.MuxAuthorizer. Hosts that have been
+// issued a certificate are remembered for good, since they keep one; hosts
+// that have not are checked again after a minute.
+func (a *muxAuthorizer) AllowWithoutCertificate(hostID string) (bool, error) {
+	a.mu.Lock()
+	checked, ok := a.issued[hostID]
+	a.mu.Unlock()
+	if ok && checked.IsZero() {
+		return false, nil
+	} else if ok && time.Now().Before(checked) {
+		return true, nil
+	}
+
+	issued, err := a.certificateIssued(hostID)
+	if err != nil {
+		return false, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if issued {
+		a.issued[hostID] = time.Time{}
+	} else {
+		a.issued[hostID] = time.Now().Add(muxAuthorizerCacheTTL)
+	}
+	return !issued, nil
+}
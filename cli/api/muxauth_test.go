@@ -0,0 +1,111 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package api
+
+import (
+	"time"
+
+	authmocks "github.com/control-center/serviced/auth/mocks"
+	"github.com/control-center/serviced/zzk/registry"
+	. "gopkg.in/check.v1"
+)
+
+func newTestMuxAuthorizer(exports map[string]*registry.ExportDetails, tenants map[string]string, checks *int) *muxAuthorizer {
+	return &muxAuthorizer{
+		allowed:           make(map[string]time.Time),
+		issued:            make(map[string]time.Time),
+		localIPs:          map[string]struct{}{"127.0.0.1": struct{}{}, "192.168.0.1": struct{}{}},
+		controlPlanePorts: map[string]struct{}{"5042": struct{}{}, "443": struct{}{}},
+		lookupExport: func(tenantID, application, address string) (*registry.ExportDetails, error) {
+			return exports[address], nil
+		},
+		canReachTenant: func(hostID, tenantID string) (bool, error) {
+			*checks++
+			return tenants[hostID] == tenantID, nil
+		},
+	}
+}
+
+func (s *TestAPISuite) TestMuxAuthorizer(c *C) {
+	exports := map[string]*registry.ExportDetails{
+		"10.0.0.2:8080": &registry.ExportDetails{TenantID: "tenant", HostIP: "192.168.0.1"},
+		"10.0.0.3:8080": &registry.ExportDetails{TenantID: "tenant", HostIP: "192.168.0.2"},
+	}
+	tenants := map[string]string{"host": "tenant", "otherhost": "othertenant"}
+	checks := 0
+	a := newTestMuxAuthorizer(exports, tenants, &checks)
+
+	host := &authmocks.Identity{}
+	host.On("HostID").Return("host")
+	otherhost := &authmocks.Identity{}
+	otherhost.On("HostID").Return("otherhost")
+
+	// control center endpoints on this host
+	c.Check(a.Authorize(otherhost, "", "", "127.0.0.1:5042"), IsNil)
+	c.Check(a.Authorize(otherhost, "", "", "192.168.0.1:443"), IsNil)
+	c.Check(a.Authorize(otherhost, "", "", "192.168.0.1:8080"), Equals, ErrMuxUnauthorized)
+	c.Check(a.Authorize(otherhost, "", "", "10.0.0.9:5042"), Equals, ErrMuxUnauthorized)
+
+	// the tenant named by the caller is not trusted
+	c.Check(a.Authorize(otherhost, "othertenant", "app", "10.0.0.2:8080"), Equals, ErrMuxUnauthorized)
+	c.Check(a.Authorize(host, "othertenant", "app", "10.0.0.2:8080"), IsNil)
+
+	// authorized addresses are cached
+	checks = 0
+	c.Check(a.Authorize(host, "tenant", "app", "10.0.0.2:8080"), IsNil)
+	c.Check(checks, Equals, 0)
+
+	// exports on other hosts are not served by this mux
+	c.Check(a.Authorize(host, "tenant", "app", "10.0.0.3:8080"), Equals, ErrMuxUnauthorized)
+	c.Check(a.Authorize(host, "tenant", "app", "10.0.0.4:8080"), Equals, ErrMuxUnauthorized)
+}
+
+func (s *TestAPISuite) TestMuxAuthorizerAllowWithoutCertificate(c *C) {
+	issued := map[string]bool{}
+	checks := 0
+	a := newTestMuxAuthorizer(nil, nil, &checks)
+	a.certificateIssued = func(hostID string) (bool, error) {
+		checks++
+		return issued[hostID], nil
+	}
+
+	// a host may call without a certificate until it is issued one
+	ok, err := a.AllowWithoutCertificate("host")
+	c.Assert(err, IsNil)
+	c.Check(ok, Equals, true)
+	c.Check(checks, Equals, 1)
+
+	// the answer is cached for a while
+	issued["host"] = true
+	ok, err = a.AllowWithoutCertificate("host")
+	c.Assert(err, IsNil)
+	c.Check(ok, Equals, true)
+	c.Check(checks, Equals, 1)
+
+	// and checked again once it expires
+	a.issued["host"] = time.Now().Add(-time.Second)
+	ok, err = a.AllowWithoutCertificate("host")
+	c.Assert(err, IsNil)
+	c.Check(ok, Equals, false)
+	c.Check(checks, Equals, 2)
+
+	// a host that has been issued a certificate is remembered for good
+	issued["host"] = false
+	ok, err = a.AllowWithoutCertificate("host")
+	c.Assert(err, IsNil)
+	c.Check(ok, Equals, false)
+	c.Check(checks, Equals, 2)
+}
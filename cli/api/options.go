@@ -15,12 +15,18 @@ package api
 
 import (
 	"fmt"
+	"net"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/control-center/serviced/config"
+	"github.com/control-center/serviced/datastore/elastic"
+	"github.com/control-center/serviced/datastore/embedded"
+	"github.com/control-center/serviced/dfs/nfs"
+	"github.com/control-center/serviced/dfs/ninep"
 	"github.com/control-center/serviced/domain/service"
 	"github.com/control-center/serviced/isvcs"
 	"github.com/control-center/serviced/node"
@@ -68,6 +74,45 @@ func ValidateServerOptions(options *config.Options) error {
 		return err
 	}
 
+	switch options.DFSTransport {
+	case nfs.TransportName, ninep.TransportName:
+	default:
+		return fmt.Errorf("dfs-transport must be %s or %s", nfs.TransportName, ninep.TransportName)
+	}
+
+	switch options.Datastore {
+	case elastic.DriverName, embedded.DriverName:
+	default:
+		return fmt.Errorf("datastore must be %s or %s", elastic.DriverName, embedded.DriverName)
+	}
+
+	for _, rollback := range options.SchemaRollback {
+		if _, _, err := parseSchemaRollback(rollback); err != nil {
+			return err
+		}
+	}
+
+	external, err := isvcs.ParseExternal(options.IsvcsExternal)
+	if err != nil {
+		return err
+	}
+	// serviced connects to the external zookeeper ensemble
+	if ensemble, ok := external["zookeeper"]; ok {
+		if len(options.Zookeepers) == 0 {
+			options.Zookeepers = ensemble
+		} else if strings.Join(options.Zookeepers, ",") != strings.Join(ensemble, ",") {
+			return fmt.Errorf("zk must be unset or list the external zookeeper ensemble %s", strings.Join(ensemble, ","))
+		}
+	}
+
+	if options.MasterVIP != "" {
+		if !options.MasterHA {
+			return fmt.Errorf("master-vip requires SERVICED_MASTER_HA")
+		} else if _, _, err := net.ParseCIDR(options.MasterVIP); err != nil {
+			return fmt.Errorf("master-vip must be an address in CIDR notation: %s", err)
+		}
+	}
+
 	// Make sure we have an endpoint to work with
 	if len(options.Endpoint) == 0 {
 		if options.Master {
@@ -129,14 +174,24 @@ func GetDefaultOptions(cfg utils.ConfigReader) config.Options {
 		OutboundIP:                 cfg.StringVal("OUTBOUND_IP", ""),
 		GCloud:                     cfg.BoolVal("GCLOUD", false),
 		StartZK:                    cfg.BoolVal("START_ZK", true),
+		MasterHA:                   cfg.BoolVal("MASTER_HA", false),
 		BigTableMetrics:            cfg.BoolVal("BIGTABLE_METRICS", false),
+		StorageAutoExtend:          cfg.BoolVal("STORAGE_AUTO_EXTEND", false),
+		DockerRegistryExternal:     cfg.BoolVal("DOCKER_REGISTRY_EXTERNAL", false),
+		DockerRegistryUsername:     cfg.StringVal("DOCKER_REGISTRY_USERNAME", ""),
+		DockerRegistryPassword:     cfg.StringVal("DOCKER_REGISTRY_PASSWORD", ""),
+		DockerRegistryCA:           cfg.StringVal("DOCKER_REGISTRY_CA", ""),
+		DockerRegistryInsecure:     cfg.BoolVal("DOCKER_REGISTRY_INSECURE", false),
 		DockerDNS:                  cfg.StringSlice("DOCKER_DNS", []string{}),
 		Master:                     cfg.BoolVal("MASTER", false),
 		MuxPort:                    cfg.IntVal("MUX_PORT", 22250),
 		MuxDisableTLS:              strconv.FormatBool(cfg.BoolVal("MUX_DISABLE_TLS", false)),
+		MuxMultiplex:               strconv.FormatBool(cfg.BoolVal("MUX_MULTIPLEX", true)),
+		MuxVerify:                  strconv.FormatBool(cfg.BoolVal("MUX_VERIFY", true)),
 		KeyPEMFile:                 cfg.StringVal("KEY_FILE", ""),
 		CertPEMFile:                cfg.StringVal("CERT_FILE", ""),
 		Zookeepers:                 cfg.StringSlice("ZK", []string{}),
+		Etcd:                       cfg.StringSlice("ETCD", []string{}),
 		HostStats:                  cfg.StringVal("STATS_PORT", fmt.Sprintf("%s:8443", masterIP)),
 		StatsPeriod:                cfg.IntVal("STATS_PERIOD", 10),
 		SvcStatsCacheTimeout:       cfg.IntVal("SVCSTATS_CACHE_TIMEOUT", 5),
@@ -157,6 +212,7 @@ func GetDefaultOptions(cfg utils.ConfigReader) config.Options {
 		LogstashMaxDays:            cfg.IntVal("LOGSTASH_MAX_DAYS", 14),
 		LogstashMaxSize:            cfg.IntVal("LOGSTASH_MAX_SIZE", 10),
 		LogstashCycleTime:          cfg.IntVal("LOGSTASH_CYCLE_TIME", 6),
+		LogOutputsFile:             cfg.StringVal("LOG_OUTPUTS_FILE", ""),
 		DebugPort:                  cfg.IntVal("DEBUG_PORT", 6006),
 		AdminGroup:                 cfg.StringVal("ADMIN_GROUP", getDefaultAdminGroup()),
 		MaxRPCClients:              cfg.IntVal("MAX_RPC_CLIENTS", 3),
@@ -168,8 +224,11 @@ func GetDefaultOptions(cfg utils.ConfigReader) config.Options {
 		RPCTLSCiphers:              cfg.StringSlice("RPC_TLS_CIPHERS", utils.GetDefaultCiphers("rpc")),
 		RPCTLSMinVersion:           cfg.StringVal("RPC_TLS_MIN_VERSION", utils.DefaultTLSMinVersion),
 		SnapshotTTL:                cfg.IntVal("SNAPSHOT_TTL", 12),
+		RegistryGCInterval:         cfg.IntVal("REGISTRY_GC_INTERVAL", 0),
 		StartISVCS:                 cfg.StringSlice("ISVCS_START", []string{}),
 		IsvcsENV:                   cfg.StringNumberedList("ISVCS_ENV", []string{}),
+		IsvcsExternal:              cfg.StringNumberedList("ISVCS_EXTERNAL", []string{}),
+		IsvcsExternalCA:            cfg.StringVal("ISVCS_EXTERNAL_CA", ""),
 		IsvcsZKID:                  cfg.IntVal("ISVCS_ZOOKEEPER_ID", 0),
 		IsvcsZKQuorum:              cfg.StringSlice("ISVCS_ZOOKEEPER_QUORUM", []string{}),
 		TLSCiphers:                 cfg.StringSlice("TLS_CIPHERS", utils.GetDefaultCiphers("http")),
@@ -188,10 +247,26 @@ func GetDefaultOptions(cfg utils.ConfigReader) config.Options {
 		ZKReconnectMaxDelay:        cfg.IntVal("ZK_RECONNECT_MAX_DELAY", 1),
 		TokenExpiration:            cfg.IntVal("AUTH_TOKEN_EXPIRATION", 60*60),
 		ServiceRunLevelTimeout:     cfg.IntVal("RUN_LEVEL_TIMEOUT", 60*10),
+		DrainTimeout:               cfg.IntVal("DRAIN_TIMEOUT", 0),
 		StorageReportInterval:      cfg.IntVal("STORAGE_REPORT_INTERVAL", 30),
 		StorageMetricMonitorWindow: cfg.IntVal("STORAGE_METRIC_MONITOR_WINDOW", 300),
 		StorageLookaheadPeriod:     cfg.IntVal("STORAGE_LOOKAHEAD_PERIOD", 360),
 		StorageMinimumFreeSpace:    cfg.StringVal("STORAGE_MIN_FREE", "3G"),
+		StorageExtendDataThreshold: cfg.IntVal("STORAGE_EXTEND_DATA_THRESHOLD", 80),
+		StorageExtendMetaThreshold: cfg.IntVal("STORAGE_EXTEND_METADATA_THRESHOLD", 80),
+		StorageExtendPercent:       cfg.IntVal("STORAGE_EXTEND_PERCENT", 20),
+		ReplicaListen:              cfg.StringVal("REPLICA_LISTEN", ""),
+		ReplicaTarget:              cfg.StringVal("REPLICA_TARGET", ""),
+		ReplicaKeyFile:             cfg.StringVal("REPLICA_KEY_FILE", ""),
+		ReplicaInterval:            cfg.IntVal("REPLICA_INTERVAL", 60),
+		DFSTransport:               cfg.StringVal("DFS_TRANSPORT", nfs.TransportName),
+		DFSPort:                    cfg.IntVal("DFS_PORT", ninep.DefaultPort),
+		DFSMountTimeout:            cfg.IntVal("DFS_MOUNT_TIMEOUT", 30),
+		Datastore:                  cfg.StringVal("DATASTORE", elastic.DriverName),
+		MasterVIP:                  cfg.StringVal("MASTER_VIP", ""),
+		MasterVIPInterface:         cfg.StringVal("MASTER_VIP_INTERFACE", ""),
+		MasterFenceCommand:         cfg.StringVal("MASTER_FENCE_COMMAND", ""),
+		MasterFenceDelay:           cfg.IntVal("MASTER_FENCE_DELAY", 0),
 		BackupEstimatedCompression: cfg.Float64Val("BACKUP_ESTIMATED_COMPRESSION", 1.0),
 		BackupMinOverhead:          cfg.StringVal("BACKUP_MIN_OVERHEAD", "0G"),
 		// Auth0 configuration parameters. Default to empty strings - must edit in serviced.conf to configure for auth0.
@@ -217,6 +292,7 @@ func GetDefaultOptions(cfg utils.ConfigReader) config.Options {
 	varpath := filepath.Join(options.HomePath, "var")
 
 	options.IsvcsPath = cfg.StringVal("ISVCS_PATH", filepath.Join(varpath, "isvcs"))
+	options.DatastorePath = cfg.StringVal("DATASTORE_PATH", filepath.Join(varpath, "datastore"))
 	options.LogPath = cfg.StringVal("LOG_PATH", "/var/log/serviced")
 	options.VolumesPath = cfg.StringVal("VOLUMES_PATH", filepath.Join(varpath, "volumes"))
 	options.BackupsPath = cfg.StringVal("BACKUPS_PATH", filepath.Join(varpath, "backups"))
@@ -226,6 +302,17 @@ func GetDefaultOptions(cfg utils.ConfigReader) config.Options {
 	return options
 }
 
+// parseSchemaRollback splits a schema rollback of the form kind:version
+func parseSchemaRollback(rollback string) (string, int, error) {
+	parts := strings.SplitN(rollback, ":", 2)
+	if len(parts) == 2 && parts[0] != "" {
+		if version, err := strconv.Atoi(parts[1]); err == nil && version >= 0 {
+			return parts[0], version, nil
+		}
+	}
+	return "", 0, fmt.Errorf("schema-rollback must be kind:version, got %q", rollback)
+}
+
 func getDefaultESStartupTimeout(timeout int) int {
 	minTimeout := isvcs.MIN_ES_STARTUP_TIMEOUT_SECONDS
 	if timeout < minTimeout {
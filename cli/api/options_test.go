@@ -123,6 +123,84 @@ func (s *TestAPISuite) TestValidateServerOptionsSetsEndpointIfMasterMissingEndpo
 	c.Assert(len(config.GetOptions().Endpoint), Not(Equals), 0)
 }
 
+func (s *TestAPISuite) TestValidateServerOptionsUsesExternalZookeeper(c *C) {
+	configReader := utils.TestConfigReader(map[string]string{})
+	testOptions := GetDefaultOptions(configReader)
+	testOptions.Master = true
+	testOptions.FSType = volume.DriverTypeBtrFS
+	testOptions.IsvcsExternal = []string{"zookeeper:zk1:2181,zk2:2181"}
+
+	err := ValidateServerOptions(&testOptions)
+	c.Assert(err, IsNil)
+	c.Assert(testOptions.Zookeepers, DeepEquals, []string{"zk1:2181", "zk2:2181"})
+
+	err = ValidateServerOptions(&testOptions)
+	c.Assert(err, IsNil)
+
+	testOptions.Zookeepers = []string{"zk3:2181"}
+	err = ValidateServerOptions(&testOptions)
+	s.assertErrorContent(c, err, "zk must be unset or list the external zookeeper ensemble zk1:2181,zk2:2181")
+
+	testOptions.IsvcsExternal = []string{"logstash:logstash1:5043"}
+	err = ValidateServerOptions(&testOptions)
+	s.assertErrorContent(c, err, "the logging services cannot run outside of serviced")
+}
+
+func (s *TestAPISuite) TestValidateServerOptionsFailsIfMasterVIPInvalid(c *C) {
+	configReader := utils.TestConfigReader(map[string]string{})
+	testOptions := GetDefaultOptions(configReader)
+	testOptions.Master = true
+	testOptions.FSType = volume.DriverTypeBtrFS
+	testOptions.MasterVIP = "10.0.0.100/24"
+	config.LoadOptions(testOptions)
+
+	err := ValidateServerOptions(&testOptions)
+	s.assertErrorContent(c, err, "master-vip requires SERVICED_MASTER_HA")
+
+	testOptions.MasterHA = true
+	testOptions.MasterVIP = "10.0.0.100"
+	err = ValidateServerOptions(&testOptions)
+	s.assertErrorContent(c, err, "master-vip must be an address in CIDR notation")
+
+	testOptions.MasterVIP = "10.0.0.100/24"
+	err = ValidateServerOptions(&testOptions)
+	c.Assert(err, IsNil)
+}
+
+func (s *TestAPISuite) TestValidateServerOptionsFailsIfDatastoreInvalid(c *C) {
+	configReader := utils.TestConfigReader(map[string]string{})
+	testOptions := GetDefaultOptions(configReader)
+	testOptions.Master = true
+	testOptions.FSType = volume.DriverTypeBtrFS
+	testOptions.Datastore = "bolt"
+	config.LoadOptions(testOptions)
+
+	err := ValidateServerOptions(&testOptions)
+	s.assertErrorContent(c, err, "datastore must be elastic or embedded")
+
+	testOptions.Datastore = "embedded"
+	err = ValidateServerOptions(&testOptions)
+	c.Assert(err, IsNil)
+}
+
+func (s *TestAPISuite) TestValidateServerOptionsFailsIfSchemaRollbackInvalid(c *C) {
+	configReader := utils.TestConfigReader(map[string]string{})
+	testOptions := GetDefaultOptions(configReader)
+	testOptions.Master = true
+	testOptions.FSType = volume.DriverTypeBtrFS
+	config.LoadOptions(testOptions)
+
+	for _, rollback := range []string{"host", "host:", ":1", "host:-1", "host:one"} {
+		testOptions.SchemaRollback = []string{rollback}
+		err := ValidateServerOptions(&testOptions)
+		s.assertErrorContent(c, err, "schema-rollback must be kind:version")
+	}
+
+	testOptions.SchemaRollback = []string{"host:0"}
+	err := ValidateServerOptions(&testOptions)
+	c.Assert(err, IsNil)
+}
+
 func (s *TestAPISuite) assertErrorContent(c *C, err error, expectedContent string) {
 	c.Assert(err, Not(IsNil))
 	if !strings.Contains(err.Error(), expectedContent) {
@@ -18,6 +18,7 @@ import (
 
 	"github.com/control-center/serviced/config"
 	"github.com/control-center/serviced/dao"
+	"github.com/control-center/serviced/volume"
 )
 
 type SnapshotConfig struct {
@@ -161,3 +162,41 @@ func (a *api) RemoveSnapshotTag(serviceID string, tagName string) (string, error
 
 	return snapshotID, nil
 }
+
+// ListSnapshotFiles lists the files at a path in a snapshot
+func (a *api) ListSnapshotFiles(snapshotID, path string) ([]volume.SnapshotFile, error) {
+	client, err := a.connectMaster()
+	if err != nil {
+		return nil, err
+	}
+	return client.ListSnapshotFiles(snapshotID, path)
+}
+
+// DiffSnapshots returns the files under a path that changed between two
+// snapshots
+func (a *api) DiffSnapshots(fromSnapshotID, toSnapshotID, path string) ([]volume.SnapshotChange, error) {
+	client, err := a.connectMaster()
+	if err != nil {
+		return nil, err
+	}
+	return client.DiffSnapshots(fromSnapshotID, toSnapshotID, path)
+}
+
+// RestoreSnapshotPath restores a file or directory from a snapshot
+func (a *api) RestoreSnapshotPath(snapshotID, path, dest string) (int, error) {
+	client, err := a.connectMaster()
+	if err != nil {
+		return 0, err
+	}
+	return client.RestoreSnapshotPath(snapshotID, path, dest)
+}
+
+// PromoteReplica brings up a standby master with the applications replicated
+// from the primary master
+func (a *api) PromoteReplica() error {
+	client, err := a.connectMaster()
+	if err != nil {
+		return err
+	}
+	return client.PromoteReplica()
+}
@@ -0,0 +1,58 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/rpc"
+	"strings"
+)
+
+// masterServices are the rpc services that only the active master answers
+var masterServices = []string{"Master.", "LoadBalancer.", "ControlCenter."}
+
+// standbyPrefix is prepended to the requests for the master services while
+// this host is not the active master, so that the rpc server does not find
+// the service and replies with an error
+const standbyPrefix = "Standby."
+
+// standbyServerCodec refuses requests for the master services while the host
+// is not the active master
+type standbyServerCodec struct {
+	rpc.ServerCodec
+	active func() bool
+}
+
+func newStandbyServerCodec(codec rpc.ServerCodec, active func() bool) rpc.ServerCodec {
+	return &standbyServerCodec{ServerCodec: codec, active: active}
+}
+
+// ReadRequestHeader reads the header of the next request
+func (c *standbyServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	if err := c.ServerCodec.ReadRequestHeader(r); err != nil {
+		return err
+	}
+	if !c.active() && isMasterService(r.ServiceMethod) {
+		r.ServiceMethod = standbyPrefix + r.ServiceMethod
+	}
+	return nil
+}
+
+func isMasterService(serviceMethod string) bool {
+	for _, prefix := range masterServices {
+		if strings.HasPrefix(serviceMethod, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package api
+
+import (
+	"net/rpc"
+
+	. "gopkg.in/check.v1"
+)
+
+type testServerCodec struct {
+	rpc.ServerCodec
+	method string
+}
+
+func (c *testServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	r.ServiceMethod = c.method
+	return nil
+}
+
+func (s *TestAPISuite) TestStandbyServerCodec(c *C) {
+	active := false
+	for _, t := range []struct {
+		method   string
+		active   bool
+		expected string
+	}{
+		{"Master.GetHost", false, "Standby.Master.GetHost"},
+		{"ControlCenter.GetServices", false, "Standby.ControlCenter.GetServices"},
+		{"LoadBalancer.GetServiceEndpoints", false, "Standby.LoadBalancer.GetServiceEndpoints"},
+		{"Agent.GetDockerLogs", false, "Agent.GetDockerLogs"},
+		{"Master.GetHost", true, "Master.GetHost"},
+	} {
+		active = t.active
+		codec := newStandbyServerCodec(&testServerCodec{method: t.method}, func() bool { return active })
+		r := &rpc.Request{}
+		c.Assert(codec.ReadRequestHeader(r), IsNil)
+		c.Check(r.ServiceMethod, Equals, t.expected)
+	}
+}
@@ -31,6 +31,7 @@ func getDefaultStorageOptions(driverType volume.DriverType, config utils.ConfigR
 	var options []string
 	switch driverType {
 	case volume.DriverTypeRsync:
+	case volume.DriverTypeReflink:
 	case volume.DriverTypeBtrFS:
 	case volume.DriverTypeDeviceMapper:
 		addStorageOption(config, "DM_THINPOOLDEV", "", func(v string) {
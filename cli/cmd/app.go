@@ -0,0 +1,85 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/codegangsta/cli"
+)
+
+// Initializer for serviced app
+func (c *ServicedCli) initApp() {
+	c.app.Commands = append(c.app.Commands, cli.Command{
+		Name:        "app",
+		Usage:       "Moves single tenant applications between clusters",
+		Description: "",
+		Subcommands: []cli.Command{
+			{
+				Name:        "export",
+				Usage:       "Writes a tenant application, its images and a snapshot of its volume to a tgz file",
+				Description: "serviced app export TENANTID [FILEPATH]",
+				Action:      c.cmdAppExport,
+			},
+			{
+				Name:        "import",
+				Usage:       "Loads an application from a tgz file written by app export",
+				Description: "serviced app import FILEPATH",
+				Action:      c.cmdAppImport,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "pool",
+						Value: "",
+						Usage: "Resource pool to run the imported application",
+					},
+				},
+			},
+		},
+	})
+}
+
+// serviced app export TENANTID [FILEPATH]
+func (c *ServicedCli) cmdAppExport(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Printf("Incorrect Usage.\n\n")
+		cli.ShowCommandHelp(ctx, "export")
+		return
+	}
+	path, err := c.driver.ExportApp(args[0], args.Get(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		c.exit(1)
+		return
+	}
+	fmt.Println(path)
+}
+
+// serviced app import FILEPATH --pool POOLID
+func (c *ServicedCli) cmdAppImport(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) != 1 {
+		fmt.Printf("Incorrect Usage.\n\n")
+		cli.ShowCommandHelp(ctx, "import")
+		return
+	}
+	tenantID, err := c.driver.ImportApp(args[0], ctx.String("pool"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		c.exit(1)
+		return
+	}
+	fmt.Println(tenantID)
+}
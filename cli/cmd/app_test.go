@@ -0,0 +1,85 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/control-center/serviced/cli/api"
+	"github.com/control-center/serviced/utils"
+)
+
+var DefaultAppAPITest = AppAPITest{}
+
+var ErrAppNotFound = errors.New("app not found")
+
+type AppAPITest struct {
+	api.API
+}
+
+func InitAppAPITest(args ...string) {
+	c := New(DefaultAppAPITest, utils.TestConfigReader{}, MockLogControl{})
+	c.exitDisabled = true
+	c.Run(args)
+}
+
+func (t AppAPITest) ExportApp(tenantID, path string) (string, error) {
+	if tenantID == "missing" {
+		return "", ErrAppNotFound
+	}
+	if path == "" {
+		path = fmt.Sprintf("app-%s.tgz", tenantID)
+	}
+	return "/backups/" + path, nil
+}
+
+func (t AppAPITest) ImportApp(path, poolID string) (string, error) {
+	if path == PathNotFound {
+		return "", ErrAppNotFound
+	}
+	return fmt.Sprintf("tenant-in-%s", poolID), nil
+}
+
+func ExampleServicedCLI_CmdAppExport() {
+	InitAppAPITest("serviced", "app", "export", "tenant")
+	InitAppAPITest("serviced", "app", "export", "tenant", "tenant.tgz")
+
+	// Output:
+	// /backups/app-tenant.tgz
+	// /backups/tenant.tgz
+}
+
+func ExampleServicedCLI_CmdAppExport_fail() {
+	pipeStderr(func() { InitAppAPITest("serviced", "app", "export", "missing") })
+
+	// Output:
+	// app not found
+}
+
+func ExampleServicedCLI_CmdAppImport() {
+	InitAppAPITest("serviced", "app", "import", "tenant.tgz", "--pool", "pool2")
+
+	// Output:
+	// tenant-in-pool2
+}
+
+func ExampleServicedCLI_CmdAppImport_fail() {
+	pipeStderr(func() { InitAppAPITest("serviced", "app", "import", PathNotFound) })
+
+	// Output:
+	// app not found
+}
@@ -16,6 +16,8 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/codegangsta/cli"
 )
@@ -26,8 +28,8 @@ func (c *ServicedCli) initBackup() {
 		c.app.Commands,
 		cli.Command{
 			Name:        "backup",
-			Usage:       "Dump all templates and services to a tgz file",
-			Description: "serviced backup DIRPATH",
+			Usage:       "Dump all templates and services to a tgz file, or verify a backup",
+			Description: "serviced backup DIRPATH | serviced backup verify FILEPATH",
 			Action:      c.cmdBackup,
 			Flags: []cli.Flag{
 				cli.StringSliceFlag{
@@ -47,9 +49,15 @@ func (c *ServicedCli) initBackup() {
 		},
 		cli.Command{
 			Name:        "restore",
-			Usage:       "Restore templates and services from a tgz file",
-			Description: "serviced restore FILEPATH",
+			Usage:       "Restore templates and services from a tgz file, or show or cancel the running restore",
+			Description: "serviced restore FILEPATH | serviced restore status | serviced restore cancel",
 			Action:      c.cmdRestore,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "resume",
+					Usage: "skip the phases done by an earlier restore of the file",
+				},
+			},
 		},
 	)
 }
@@ -63,6 +71,10 @@ func (c *ServicedCli) cmdBackup(ctx *cli.Context)  {
 		c.exit(1)
 		return
 	}
+	if args[0] == "verify" {
+		c.cmdBackupVerify(ctx)
+		return
+	}
 	if ctx.Bool("check") {
 		fmt.Printf("Checking for space...\n")
 		if backupSpace, err := c.driver.GetBackupEstimate(args[0], ctx.StringSlice("exclude")); err != nil {
@@ -94,7 +106,7 @@ func (c *ServicedCli) cmdBackup(ctx *cli.Context)  {
 	}
 }
 
-// serviced restore FILEPATH
+// serviced restore [--resume] FILEPATH
 func (c *ServicedCli) cmdRestore(ctx *cli.Context) {
 	args := ctx.Args()
 	if len(args) < 1 {
@@ -102,9 +114,106 @@ func (c *ServicedCli) cmdRestore(ctx *cli.Context) {
 		cli.ShowCommandHelp(ctx, "restore")
 		return
 	}
+	switch args[0] {
+	case "status":
+		c.cmdRestoreStatus(ctx)
+		return
+	case "cancel":
+		c.cmdRestoreCancel(ctx)
+		return
+	}
 
-	err := c.driver.Restore(args[0])
+	var err error
+	if ctx.Bool("resume") {
+		err = c.driver.ResumeRestore(args[0])
+	} else {
+		err = c.driver.Restore(args[0])
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 	}
 }
+
+// serviced restore status
+func (c *ServicedCli) cmdRestoreStatus(ctx *cli.Context) {
+	status, err := c.driver.GetRestoreStatus()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		c.exit(1)
+		return
+	} else if status == nil {
+		fmt.Println("No restore has been run")
+		return
+	}
+	fmt.Printf("Restore of %s: %s\n", status.Filename, status.State)
+	if status.Error != "" {
+		fmt.Printf("ERROR: %s\n", status.Error)
+	}
+	for _, p := range status.Phases {
+		var progress string
+		if p.Total > 0 {
+			progress = fmt.Sprintf("%d/%d %s", p.Done, p.Total, p.Unit)
+		} else if p.Done > 0 {
+			progress = fmt.Sprintf("%d %s", p.Done, p.Unit)
+		}
+		if p.Error != "" {
+			progress = strings.TrimSpace(progress + " " + p.Error)
+		}
+		line := fmt.Sprintf("  %-40s %-10s %s", p.Name, p.State, progress)
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
+
+// serviced restore cancel
+func (c *ServicedCli) cmdRestoreCancel(ctx *cli.Context) {
+	if err := c.driver.CancelRestore(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		c.exit(1)
+		return
+	}
+	fmt.Println("Restore is stopping; run serviced restore --resume FILEPATH to continue it")
+}
+
+// serviced backup verify FILEPATH
+func (c *ServicedCli) cmdBackupVerify(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) != 2 {
+		fmt.Printf("Incorrect Usage.\n\n")
+		cli.ShowCommandHelp(ctx, "backup")
+		c.exit(1)
+		return
+	}
+	report, err := c.driver.VerifyBackup(args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		c.exit(1)
+		return
+	}
+	fmt.Printf("Backup taken at %s (version %d)\n", report.Timestamp.UTC().Format(time.RFC3339), report.BackupVersion)
+	for _, s := range report.Snapshots {
+		if s.Error != "" {
+			fmt.Printf("Snapshot %s: FAILED: %s\n", s.SnapshotID, s.Error)
+		} else {
+			fmt.Printf("Snapshot %s: OK (%d services, %d images)\n", s.SnapshotID, s.Services, len(s.Images))
+		}
+	}
+	for _, i := range report.Images {
+		if i.Error != "" {
+			fmt.Printf("Image %s: FAILED: %s\n", i.Image, i.Error)
+		} else {
+			fmt.Printf("Image %s: OK\n", i.Image)
+		}
+	}
+	for _, e := range report.Errors {
+		fmt.Printf("ERROR: %s\n", e)
+	}
+	for _, w := range report.Warnings {
+		fmt.Printf("WARNING: %s\n", w)
+	}
+	if !report.Valid() {
+		fmt.Println("Backup is NOT valid")
+		c.exit(1)
+		return
+	}
+	fmt.Println("Backup is valid")
+}
@@ -20,8 +20,10 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"time"
 
 	"github.com/control-center/serviced/dao"
+	"github.com/control-center/serviced/dfs"
 	"github.com/control-center/serviced/cli/api"
 	"github.com/control-center/serviced/utils"
 )
@@ -80,6 +82,50 @@ func (t BackupAPITest) Restore(path string) error {
 	}
 }
 
+func (t BackupAPITest) ResumeRestore(path string) error {
+	switch path {
+	case PathNotFound:
+		return ErrRestoreFailed
+	default:
+		return nil
+	}
+}
+
+func (t BackupAPITest) GetRestoreStatus() (*dfs.RestoreStatus, error) {
+	return &dfs.RestoreStatus{
+		Filename: "/backups/backup.tgz",
+		State:    dfs.RestoreCancelled,
+		Error:    dfs.ErrRestoreCancelled.Error(),
+		Phases: []dfs.RestorePhase{
+			{Name: dfs.RestorePhaseImages, State: dfs.RestoreDone, Done: 2048, Unit: "bytes"},
+			{Name: dfs.RestoreVolumePhase("tenant_label"), State: dfs.RestoreDone, Done: 4096, Unit: "bytes"},
+			{Name: dfs.RestoreRegistryPhase("tenant_label"), State: dfs.RestoreCancelled, Done: 1, Total: 3, Unit: "images", Error: dfs.ErrRestoreCancelled.Error()},
+			{Name: dfs.RestorePhaseTemplates, State: dfs.RestorePending},
+		},
+	}, nil
+}
+
+func (t BackupAPITest) CancelRestore() error {
+	return ErrRestoreFailed
+}
+
+func (t BackupAPITest) VerifyBackup(path string) (*dfs.BackupReport, error) {
+	report := &dfs.BackupReport{
+		Timestamp:     time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC),
+		BackupVersion: 1,
+		Snapshots:     []dfs.SnapshotReport{{SnapshotID: "tenant_label", Services: 3, Images: []string{"tenant/repo:label"}}},
+		Images:        []dfs.ImageReport{{Image: "tenant/repo:label"}},
+	}
+	switch path {
+	case PathNotFound:
+		return nil, ErrRestoreFailed
+	case TooSmallPath:
+		report.Images[0].Error = "layer abc/layer.tar is corrupt"
+		report.Warnings = []string{"base image base/image is missing from backup"}
+	}
+	return report, nil
+}
+
 func (t BackupAPITest) GetBackupEstimate(path string, _ []string) (*dao.BackupEstimate, error) {
 	switch path{
 	case TooSmallPath:
@@ -136,13 +182,13 @@ func ExampleServicedCLI_CmdBackup_usage() {
 	// Incorrect Usage.
 	//
 	// NAME:
-	//    backup - Dump all templates and services to a tgz file
+	//    backup - Dump all templates and services to a tgz file, or verify a backup
 	//
 	// USAGE:
 	//    command backup [command options] [arguments...]
 	//
 	// DESCRIPTION:
-	//    serviced backup DIRPATH
+	//    serviced backup DIRPATH | serviced backup verify FILEPATH
 	//
 	// OPTIONS:
 	//    --exclude '--exclude option --exclude option'	Subdirectory of the tenant volume to exclude from backup
@@ -191,14 +237,67 @@ func ExampleServicedCLI_CmdRestore_usage() {
 	// Incorrect Usage.
 	//
 	// NAME:
-	//    restore - Restore templates and services from a tgz file
+	//    restore - Restore templates and services from a tgz file, or show or cancel the running restore
 	//
 	// USAGE:
 	//    command restore [command options] [arguments...]
 	//
 	// DESCRIPTION:
-	//    serviced restore FILEPATH
+	//    serviced restore FILEPATH | serviced restore status | serviced restore cancel
 	//
 	// OPTIONS:
+	//    --resume	skip the phases done by an earlier restore of the file
+}
+
+func ExampleServicedCLI_CmdRestore_resume() {
+	InitBackupAPITest("serviced", "restore", "--resume", "path/to/file")
+
+	// Output:
+}
+
+func ExampleServicedCLI_CmdRestoreStatus() {
+	InitBackupAPITestNoExit("serviced", "restore", "status")
+
+	// Output:
+	// Restore of /backups/backup.tgz: cancelled
+	// ERROR: restore was cancelled
+	//   images                                   done       2048 bytes
+	//   volume:tenant_label                      done       4096 bytes
+	//   registry:tenant_label                    cancelled  1/3 images restore was cancelled
+	//   templates                                pending
 }
 
+func ExampleServicedCLI_CmdRestoreCancel_fail() {
+	pipeStderr(func() { InitBackupAPITestNoExit("serviced", "restore", "cancel") })
+
+	// Output:
+	// restore failed
+}
+
+func ExampleServicedCLI_CmdBackupVerify() {
+	InitBackupAPITestNoExit("serviced", "backup", "verify", "backup.tgz")
+
+	// Output:
+	// Backup taken at 2016-10-01T12:00:00Z (version 1)
+	// Snapshot tenant_label: OK (3 services, 1 images)
+	// Image tenant/repo:label: OK
+	// Backup is valid
+}
+
+func ExampleServicedCLI_CmdBackupVerify_invalid() {
+	InitBackupAPITestNoExit("serviced", "backup", "verify", TooSmallPath)
+
+	// Output:
+	// Backup taken at 2016-10-01T12:00:00Z (version 1)
+	// Snapshot tenant_label: OK (3 services, 1 images)
+	// Image tenant/repo:label: FAILED: layer abc/layer.tar is corrupt
+	// WARNING: base image base/image is missing from backup
+	// Backup is NOT valid
+}
+
+func ExampleServicedCLI_CmdBackupVerify_fail() {
+	pipeStderr(func() { InitBackupAPITestNoExit("serviced", "backup", "verify", PathNotFound) })
+
+	// Output:
+	// restore failed
+}
@@ -77,16 +77,22 @@ func New(driver api.API, config utils.ConfigReader, logControl logging.LogContro
 		cli.BoolFlag{"agent", "deprecated"},
 		cli.IntFlag{"mux", defaultOps.MuxPort, "multiplexing port"},
 		cli.StringFlag{"mux-disable-tls", defaultOps.MuxDisableTLS, "disable TLS for mux connections"},
+		cli.StringFlag{"mux-multiplex", defaultOps.MuxMultiplex, "multiplex mux connections between hosts over persistent sessions"},
+		cli.StringFlag{"mux-verify", defaultOps.MuxVerify, "require mux callers to present a host certificate and only reach endpoints of tenants their host runs"},
 		cli.StringSliceFlag{"mux-tls-ciphers", convertToStringSlice(defaultOps.MUXTLSCiphers), "list of supported TLS ciphers for MUX"},
 		cli.StringFlag{"mux-tls-min-version", string(defaultOps.MUXTLSMinVersion), "mininum TLS version for MUX"},
 		cli.StringFlag{"volumes-path", defaultOps.VolumesPath, "path where application data is stored"},
 		cli.StringFlag{"isvcs-path", defaultOps.IsvcsPath, "path where internal application data is stored"},
+		cli.StringFlag{"datastore-path", defaultOps.DatastorePath, "path where the embedded datastore is stored"},
+		cli.BoolFlag{"schema-dry-run", "report the schema migrations the master would run and exit"},
+		cli.StringSliceFlag{"schema-rollback", &cli.StringSlice{}, "roll back the schema of an entity kind to a version and exit (e.g. -schema-rollback host:0)"},
 		cli.StringFlag{"backups-path", defaultOps.BackupsPath, "default path where backups are stored"},
 		cli.StringFlag{"etc-path", defaultOps.EtcPath, "default path for configuration files"},
 		cli.StringFlag{"log-path", defaultOps.LogPath, "path where serviced logs are located"},
 		cli.StringFlag{"keyfile", defaultOps.KeyPEMFile, "path to private key file (defaults to compiled in private key)"},
 		cli.StringFlag{"certfile", defaultOps.CertPEMFile, "path to public certificate file (defaults to compiled in public cert)"},
 		cli.StringSliceFlag{"zk", convertToStringSlice(defaultOps.Zookeepers), "Specify a zookeeper instance to connect to (e.g. -zk localhost:2181)"},
+		cli.StringSliceFlag{"etcd", convertToStringSlice(defaultOps.Etcd), "Specify an etcd endpoint to coordinate with instead of zookeeper (e.g. -etcd localhost:2379)"},
 		cli.StringSliceFlag{"mount", convertToStringSlice(defaultOps.Mount), "bind mount: DOCKER_IMAGE,HOST_PATH[,CONTAINER_PATH]"},
 		cli.StringFlag{"fstype", string(defaultOps.FSType), "driver for underlying file system"},
 		cli.StringSliceFlag{"alias", convertToStringSlice(defaultOps.HostAliases), "list of aliases for this host, e.g., localhost"},
@@ -101,6 +107,8 @@ func New(driver api.API, config utils.ConfigReader, logControl logging.LogContro
 		cli.IntFlag{"isvcs-zk-id", defaultOps.IsvcsZKID, "zookeeper id when running in a cluster"},
 		cli.StringSliceFlag{"isvcs-zk-quorum", convertToStringSlice(defaultOps.IsvcsZKQuorum), "isvcs zookeeper host quorum (e.g. -isvcs-zk-quorum zk1@localhost:2888:3888)"},
 		cli.StringSliceFlag{"isvcs-env", convertToStringSlice(defaultOps.IsvcsENV), "internal-service environment variable: ISVC:KEY=VAL"},
+		cli.StringSliceFlag{"isvcs-external", convertToStringSlice(defaultOps.IsvcsExternal), "internal service that runs outside of serviced: ISVC:ENDPOINT[,ENDPOINT...]"},
+		cli.StringFlag{"isvcs-external-ca", defaultOps.IsvcsExternalCA, "certificate authority of the internal services that run outside of serviced"},
 		cli.StringSliceFlag{"tls-ciphers", convertToStringSlice(defaultOps.TLSCiphers), "list of supported TLS ciphers for HTTP"},
 		cli.StringFlag{"tls-min-version", string(defaultOps.TLSMinVersion), "mininum TLS version for HTTP"},
 
@@ -118,6 +126,7 @@ func New(driver api.API, config utils.ConfigReader, logControl logging.LogContro
 		cli.StringSliceFlag{"rpc-tls-ciphers", convertToStringSlice(defaultOps.RPCTLSCiphers), "list of supported TLS ciphers for RPC"},
 		cli.StringFlag{"rpc-tls-min-version", string(defaultOps.RPCTLSMinVersion), "mininum TLS version for RPC"},
 		cli.IntFlag{"snapshot-ttl", defaultOps.SnapshotTTL, "snapshot TTL in hours, 0 to disable"},
+		cli.IntFlag{"registry-gc-interval", defaultOps.RegistryGCInterval, "hours between docker registry garbage collections, 0 to disable"},
 		cli.IntFlag{"snapshot-space-percent", defaultOps.SnapshotSpacePercent, "percent of tenant volume size that is assumed to be needed to create a snapshot"},
 		cli.StringFlag{"controller-binary", defaultOps.ControllerBinary, "path to the container controller binary"},
 		cli.StringFlag{"log-driver", defaultOps.DockerLogDriver, "log driver for docker containers"},
@@ -133,6 +142,7 @@ func New(driver api.API, config utils.ConfigReader, logControl logging.LogContro
 		cli.IntFlag{"auth-token-expiry", defaultOps.TokenExpiration, "authentication token expiration in seconds"},
 		cli.StringFlag{"conntrack-flush", defaultOps.ConntrackFlush, "whether to flush the conntrack table when a service with an assigned IP is started"},
 		cli.IntFlag{"service-run-level-timeout", defaultOps.ServiceRunLevelTimeout, "max time in seconds to wait for services to start/stop before moving on to services at the next run level"},
+		cli.IntFlag{"drain-timeout", defaultOps.DrainTimeout, "max time in seconds a stopping service instance waits for its active connections to drain, 0 to disable"},
 
 		cli.BoolTFlag{"logtostderr", "log to standard error instead of files"},
 		cli.BoolFlag{"alsologtostderr", "log to standard error as well as files"},
@@ -145,8 +155,24 @@ func New(driver api.API, config utils.ConfigReader, logControl logging.LogContro
 		cli.IntFlag{"storage-metric-monitor-window", defaultOps.StorageMetricMonitorWindow, "the amount of time in seconds for which serviced will consider storage availability metrics in order to predict future availability"},
 		cli.IntFlag{"storage-lookahead-period", defaultOps.StorageLookaheadPeriod, "the amount of time in the future in seconds serviced should predict storage availability for the purposes of emergency shutdown"},
 		cli.StringFlag{"storage-min-free", string(defaultOps.StorageMinimumFreeSpace), "the amount of space the emergency shutdown algorithm should reserve when deciding to shut down"},
+		cli.IntFlag{"storage-extend-data-threshold", defaultOps.StorageExtendDataThreshold, "the percent of the thin pool data volume used before it is extended, if SERVICED_STORAGE_AUTO_EXTEND is set"},
+		cli.IntFlag{"storage-extend-metadata-threshold", defaultOps.StorageExtendMetaThreshold, "the percent of the thin pool metadata volume used before it is extended, if SERVICED_STORAGE_AUTO_EXTEND is set"},
+		cli.IntFlag{"storage-extend-percent", defaultOps.StorageExtendPercent, "the percent of its current size that is added to the thin pool when it is extended"},
+		cli.StringFlag{"replica-listen", defaultOps.ReplicaListen, "the address on which a standby master receives replicas from the primary master"},
+		cli.StringFlag{"replica-target", defaultOps.ReplicaTarget, "the address of the standby master to replicate to"},
+		cli.StringFlag{"replica-key-file", defaultOps.ReplicaKeyFile, "the file holding the key shared by the primary and standby masters"},
+		cli.IntFlag{"replica-interval", defaultOps.ReplicaInterval, "the time in minutes between replications to the standby master"},
+		cli.StringFlag{"dfs-transport", defaultOps.DFSTransport, "the protocol the master exports the distributed filesystem with (nfs or 9p)"},
+		cli.IntFlag{"dfs-port", defaultOps.DFSPort, "the port the master serves the distributed filesystem on over 9p"},
+		cli.IntFlag{"dfs-mount-timeout", defaultOps.DFSMountTimeout, "the time in seconds to wait for the distributed filesystem to mount over 9p"},
+		cli.StringFlag{"datastore", defaultOps.Datastore, "the backend control-plane entities are stored in (elastic or embedded)"},
+		cli.StringFlag{"master-vip", defaultOps.MasterVIP, "the virtual ip, in CIDR notation, that follows the active master"},
+		cli.StringFlag{"master-vip-interface", defaultOps.MasterVIPInterface, "the device to bind the master virtual ip to"},
+		cli.StringFlag{"master-fence-command", defaultOps.MasterFenceCommand, "the command a new active master runs to fence the previous master"},
+		cli.IntFlag{"master-fence-delay", defaultOps.MasterFenceDelay, "the time in seconds a new active master waits before taking over from another host"},
 
 		cli.IntFlag{"logstash-cycle-time", defaultOps.LogstashCycleTime, "logstash purging cycle time in hours"},
+		cli.StringFlag{"log-outputs-file", defaultOps.LogOutputsFile, "json file of the outputs that logstash forwards the logs of every tenant to"},
 		cli.IntFlag{"v", defaultOps.Verbosity, "log level for V logs"},
 		cli.StringFlag{"stderrthreshold", "", "logs at or above this threshold go to stderr"},
 		cli.StringFlag{"vmodule", "", "comma-separated list of pattern=N settings for file-filtered logging"},
@@ -172,6 +198,9 @@ func New(driver api.API, config utils.ConfigReader, logControl logging.LogContro
 	c.initSnapshot()
 	c.initLog()
 	c.initBackup()
+	c.initReplica()
+	c.initApp()
+	c.initDoctor()
 	c.initMetric()
 	c.initDocker()
 	c.initScript()
@@ -227,7 +256,14 @@ func getRuntimeOptions(cfg utils.ConfigReader, ctx *cli.Context) config.Options
 	options := config.Options{
 		GCloud:                     cfg.BoolVal("GCLOUD", false),
 		StartZK:                    cfg.BoolVal("START_ZK", true),
+		MasterHA:                   cfg.BoolVal("MASTER_HA", false),
 		BigTableMetrics:            cfg.BoolVal("BIGTABLE_METRICS", false),
+		StorageAutoExtend:          cfg.BoolVal("STORAGE_AUTO_EXTEND", false),
+		DockerRegistryExternal:     cfg.BoolVal("DOCKER_REGISTRY_EXTERNAL", false),
+		DockerRegistryUsername:     cfg.StringVal("DOCKER_REGISTRY_USERNAME", ""),
+		DockerRegistryPassword:     cfg.StringVal("DOCKER_REGISTRY_PASSWORD", ""),
+		DockerRegistryCA:           cfg.StringVal("DOCKER_REGISTRY_CA", ""),
+		DockerRegistryInsecure:     cfg.BoolVal("DOCKER_REGISTRY_INSECURE", false),
 		DockerRegistry:             ctx.GlobalString("docker-registry"),
 		NFSClient:                  ctx.GlobalString("nfs-client"),
 		Endpoint:                   ctx.GlobalString("endpoint"),
@@ -239,17 +275,23 @@ func getRuntimeOptions(cfg utils.ConfigReader, ctx *cli.Context) config.Options
 		Master:                     ctx.GlobalBool("master"),
 		MuxPort:                    ctx.GlobalInt("mux"),
 		MuxDisableTLS:              ctx.GlobalString("mux-disable-tls"),
+		MuxMultiplex:               ctx.GlobalString("mux-multiplex"),
+		MuxVerify:                  ctx.GlobalString("mux-verify"),
 		MUXTLSCiphers:              ctx.GlobalStringSlice("mux-tls-ciphers"),
 		MUXTLSMinVersion:           ctx.GlobalString("mux-tls-min-version"),
 		HomePath:                   api.GetDefaultOptions(cfg).HomePath,
 		VolumesPath:                ctx.GlobalString("volumes-path"),
 		IsvcsPath:                  ctx.GlobalString("isvcs-path"),
+		DatastorePath:              ctx.GlobalString("datastore-path"),
+		SchemaDryRun:               ctx.GlobalBool("schema-dry-run"),
+		SchemaRollback:             ctx.GlobalStringSlice("schema-rollback"),
 		BackupsPath:                ctx.GlobalString("backups-path"),
 		EtcPath:                    ctx.GlobalString("etc-path"),
 		LogPath:                    ctx.GlobalString("log-path"),
 		KeyPEMFile:                 ctx.GlobalString("keyfile"),
 		CertPEMFile:                ctx.GlobalString("certfile"),
 		Zookeepers:                 ctx.GlobalStringSlice("zk"),
+		Etcd:                       ctx.GlobalStringSlice("etcd"),
 		Mount:                      ctx.GlobalStringSlice("mount"),
 		HostAliases:                ctx.GlobalStringSlice("alias"),
 		ESStartupTimeout:           ctx.GlobalInt("es-startup-timeout"),
@@ -270,6 +312,7 @@ func getRuntimeOptions(cfg utils.ConfigReader, ctx *cli.Context) config.Options
 		LogstashMaxSize:            ctx.GlobalInt("logstash-max-size"),
 		LogstashCycleTime:          ctx.GlobalInt("logstash-cycle-time"),
 		LogstashURL:                ctx.GlobalString("logstashurl"),
+		LogOutputsFile:             ctx.GlobalString("log-outputs-file"),
 		DebugPort:                  ctx.GlobalInt("debug-port"),
 		AdminGroup:                 ctx.GlobalString("admin-group"),
 		MaxRPCClients:              ctx.GlobalInt("max-rpc-clients"),
@@ -279,10 +322,13 @@ func getRuntimeOptions(cfg utils.ConfigReader, ctx *cli.Context) config.Options
 		RPCTLSCiphers:              ctx.GlobalStringSlice("rpc-tls-ciphers"),
 		RPCTLSMinVersion:           ctx.GlobalString("rpc-tls-min-version"),
 		SnapshotTTL:                ctx.GlobalInt("snapshot-ttl"),
+		RegistryGCInterval:         ctx.GlobalInt("registry-gc-interval"),
 		SnapshotSpacePercent:       ctx.GlobalInt("snapshot-space-percent"),
 		StorageArgs:                ctx.GlobalStringSlice("storage-opts"),
 		ControllerBinary:           ctx.GlobalString("controller-binary"),
 		IsvcsENV:                   ctx.GlobalStringSlice("isvcs-env"),
+		IsvcsExternal:              ctx.GlobalStringSlice("isvcs-external"),
+		IsvcsExternalCA:            ctx.GlobalString("isvcs-external-ca"),
 		StartISVCS:                 ctx.GlobalStringSlice("isvcs-start"),
 		IsvcsZKID:                  ctx.GlobalInt("isvcs-zk-id"),
 		IsvcsZKQuorum:              ctx.GlobalStringSlice("isvcs-zk-quorum"),
@@ -302,9 +348,25 @@ func getRuntimeOptions(cfg utils.ConfigReader, ctx *cli.Context) config.Options
 		TokenExpiration:            ctx.GlobalInt("auth-token-expiry"),
 		ConntrackFlush:             ctx.GlobalString("conntrack-flush"),
 		ServiceRunLevelTimeout:     ctx.GlobalInt("service-run-level-timeout"),
+		DrainTimeout:               ctx.GlobalInt("drain-timeout"),
 		StorageMetricMonitorWindow: ctx.GlobalInt("storage-metric-monitor-window"),
 		StorageLookaheadPeriod:     ctx.GlobalInt("storage-lookahead-period"),
 		StorageMinimumFreeSpace:    ctx.GlobalString("storage-min-free"),
+		StorageExtendDataThreshold: ctx.GlobalInt("storage-extend-data-threshold"),
+		StorageExtendMetaThreshold: ctx.GlobalInt("storage-extend-metadata-threshold"),
+		StorageExtendPercent:       ctx.GlobalInt("storage-extend-percent"),
+		ReplicaListen:              ctx.GlobalString("replica-listen"),
+		ReplicaTarget:              ctx.GlobalString("replica-target"),
+		ReplicaKeyFile:             ctx.GlobalString("replica-key-file"),
+		ReplicaInterval:            ctx.GlobalInt("replica-interval"),
+		DFSTransport:               ctx.GlobalString("dfs-transport"),
+		DFSPort:                    ctx.GlobalInt("dfs-port"),
+		DFSMountTimeout:            ctx.GlobalInt("dfs-mount-timeout"),
+		Datastore:                  ctx.GlobalString("datastore"),
+		MasterVIP:                  ctx.GlobalString("master-vip"),
+		MasterVIPInterface:         ctx.GlobalString("master-vip-interface"),
+		MasterFenceCommand:         ctx.GlobalString("master-fence-command"),
+		MasterFenceDelay:           ctx.GlobalInt("master-fence-delay"),
 		BackupEstimatedCompression: ctx.Float64("backup-estimated-compression"),
 		BackupMinOverhead:          ctx.String("backup-min-overhead"),
 		Auth0Domain:                ctx.String("auth0-domain"),
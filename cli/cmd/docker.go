@@ -59,6 +59,17 @@ func (c *ServicedCli) initDocker() {
 				Usage:       "Replace an image in the registry with a new image",
 				Description: "serviced docker override OLDIMAGE NEWIMAGE",
 				Action:      c.cmdDockerOverride,
+			}, {
+				Name:        "gc",
+				Usage:       "Remove images that are not used by any service or snapshot from the registry",
+				Description: "serviced docker gc [--dry-run]",
+				Action:      c.cmdDockerGC,
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "report what would be removed without removing it",
+					},
+				},
 			},
 		},
 	})
@@ -108,3 +119,37 @@ func (c *ServicedCli) cmdDockerOverride(ctx *cli.Context) {
 		fmt.Fprintln(os.Stderr, err)
 	}
 }
+
+// serviced docker gc [--dry-run]
+func (c *ServicedCli) cmdDockerGC(ctx *cli.Context) {
+	if len(ctx.Args()) > 0 {
+		fmt.Printf("Incorrect Usage.\n\n")
+		cli.ShowCommandHelp(ctx, "gc")
+		return
+	}
+	report, err := c.driver.CollectRegistryGarbage(ctx.Bool("dry-run"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		c.exit(1)
+		return
+	}
+	if len(report.Removed)+len(report.Manifests)+len(report.Blobs) > 0 {
+		t := NewTable("Type,ID")
+		for _, image := range report.Removed {
+			t.AddRow(map[string]interface{}{"Type": "image", "ID": image})
+		}
+		for _, manifest := range report.Manifests {
+			t.AddRow(map[string]interface{}{"Type": "manifest", "ID": manifest})
+		}
+		for _, blob := range report.Blobs {
+			t.AddRow(map[string]interface{}{"Type": "blob", "ID": blob})
+		}
+		t.Padding = 3
+		t.Print()
+	}
+	verb := "Removed"
+	if report.DryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%s %d images, %d manifests and %d blobs; kept %d images\n", verb, len(report.Removed), len(report.Manifests), len(report.Blobs), len(report.Live))
+}
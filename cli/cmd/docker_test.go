@@ -19,6 +19,7 @@ import (
 	"errors"
 
 	"github.com/control-center/serviced/cli/api"
+	"github.com/control-center/serviced/dfs"
 	"github.com/control-center/serviced/utils"
 )
 
@@ -49,6 +50,16 @@ func (t DockerAPITest) DockerOverride(newImage, oldImage string) error {
 	}
 }
 
+func (t DockerAPITest) CollectRegistryGarbage(dryRun bool) (*dfs.RegistryGCReport, error) {
+	return &dfs.RegistryGCReport{
+		DryRun:    dryRun,
+		Live:      []string{"tenant/repo:latest"},
+		Removed:   []string{"tenant/repo:old"},
+		Manifests: []string{"tenant/repo@sha256:aaa"},
+		Blobs:     []string{"sha256:bbb", "sha256:ccc"},
+	}, nil
+}
+
 func ExampleServicedCLI_CmdDockerOverride_usage() {
 	InitDockerAPITest("serviced", "docker", "override")
 
@@ -79,3 +90,27 @@ func ExampleServicedCli_cmdDockerOverride_success() {
 
 	// Output:
 }
+
+func ExampleServicedCLI_CmdDockerGC() {
+	InitDockerAPITest("serviced", "docker", "gc")
+
+	// Output:
+	// Type       ID
+	// image      tenant/repo:old
+	// manifest   tenant/repo@sha256:aaa
+	// blob       sha256:bbb
+	// blob       sha256:ccc
+	// Removed 1 images, 1 manifests and 2 blobs; kept 1 images
+}
+
+func ExampleServicedCLI_CmdDockerGC_dryRun() {
+	InitDockerAPITest("serviced", "docker", "gc", "--dry-run")
+
+	// Output:
+	// Type       ID
+	// image      tenant/repo:old
+	// manifest   tenant/repo@sha256:aaa
+	// blob       sha256:bbb
+	// blob       sha256:ccc
+	// Would remove 1 images, 1 manifests and 2 blobs; kept 1 images
+}
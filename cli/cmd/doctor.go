@@ -0,0 +1,91 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/codegangsta/cli"
+	"github.com/control-center/serviced/doctor"
+)
+
+// Initializer for serviced doctor
+func (c *ServicedCli) initDoctor() {
+	c.app.Commands = append(c.app.Commands, cli.Command{
+		Name:        "doctor",
+		Usage:       "Checks the coordinator against the datastore and optionally repairs it",
+		Description: "serviced doctor [--repair]",
+		Action:      c.cmdDoctor,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "repair",
+				Usage: "fix the inconsistencies that are found",
+			},
+		},
+	})
+}
+
+// serviced doctor [--repair]
+func (c *ServicedCli) cmdDoctor(ctx *cli.Context) {
+	if len(ctx.Args()) > 0 {
+		fmt.Printf("Incorrect Usage.\n\n")
+		cli.ShowCommandHelp(ctx, "doctor")
+		return
+	}
+	report, err := c.driver.Doctor(ctx.Bool("repair"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		c.exit(1)
+		return
+	}
+	if len(report.Issues) == 0 {
+		fmt.Println("No issues found")
+		return
+	}
+
+	fields := "Severity,Kind,ID,Issue"
+	if report.Repaired {
+		fields += ",Repair"
+	}
+	t := NewTable(fields)
+	unresolved := 0
+	for _, issue := range report.Issues {
+		row := map[string]interface{}{
+			"Severity": issue.Severity,
+			"Kind":     issue.Kind,
+			"ID":       issue.ID,
+			"Issue":    issue.Message,
+		}
+		switch {
+		case issue.Repaired:
+			row["Repair"] = "repaired"
+		case issue.Resolved:
+			row["Repair"] = "no longer present"
+		case issue.Error != "":
+			row["Repair"] = "failed: " + issue.Error
+		case issue.Fix == doctor.FixNone:
+			row["Repair"] = "needs manual repair"
+		}
+		if !issue.Repaired && !issue.Resolved && issue.Severity > doctor.Info {
+			unresolved++
+		}
+		t.AddRow(row)
+	}
+	t.Padding = 3
+	t.Print()
+	if unresolved > 0 {
+		c.exit(1)
+	}
+}
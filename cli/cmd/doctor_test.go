@@ -0,0 +1,86 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package cmd
+
+import (
+	"errors"
+
+	"github.com/control-center/serviced/cli/api"
+	"github.com/control-center/serviced/doctor"
+	"github.com/control-center/serviced/utils"
+)
+
+type DoctorAPITest struct {
+	api.API
+	fail   bool
+	issues []doctor.Issue
+}
+
+func InitDoctorAPITest(t DoctorAPITest, args ...string) {
+	c := New(t, utils.TestConfigReader{}, MockLogControl{})
+	c.exitDisabled = true
+	c.Run(args)
+}
+
+func (t DoctorAPITest) Doctor(repair bool) (*doctor.Report, error) {
+	if t.fail {
+		return nil, errors.New("could not connect")
+	}
+	issues := make([]doctor.Issue, len(t.issues))
+	copy(issues, t.issues)
+	if repair {
+		for i := range issues {
+			if issues[i].Fix == doctor.FixDeleteNode {
+				issues[i].Repaired = true
+			} else {
+				issues[i].Error = "zookeeper is down"
+			}
+		}
+	}
+	return &doctor.Report{Issues: issues, Repaired: repair}, nil
+}
+
+var doctorIssues = []doctor.Issue{
+	{Severity: doctor.Error, Kind: "vhost", ID: "app", Message: "virtual host points at a deleted service", Fix: doctor.FixDeleteNode},
+	{Severity: doctor.Warning, Kind: "service", ID: "svc", Message: "desired state is 1 in the coordinator but 0 in the datastore", Fix: doctor.FixSyncService},
+}
+
+func ExampleServicedCLI_CmdDoctor() {
+	InitDoctorAPITest(DoctorAPITest{}, "serviced", "doctor")
+	InitDoctorAPITest(DoctorAPITest{issues: doctorIssues}, "serviced", "doctor")
+
+	// Output:
+	// No issues found
+	// Severity   Kind      ID    Issue
+	// error      vhost     app   virtual host points at a deleted service
+	// warning    service   svc   desired state is 1 in the coordinator but 0 in the datastore
+}
+
+func ExampleServicedCLI_CmdDoctor_repair() {
+	InitDoctorAPITest(DoctorAPITest{issues: doctorIssues}, "serviced", "doctor", "--repair")
+
+	// Output:
+	// Severity   Kind      ID    Issue                                                          Repair
+	// error      vhost     app   virtual host points at a deleted service                       repaired
+	// warning    service   svc   desired state is 1 in the coordinator but 0 in the datastore   failed: zookeeper is down
+}
+
+func ExampleServicedCLI_CmdDoctor_err() {
+	pipeStderr(func() { InitDoctorAPITest(DoctorAPITest{fail: true}, "serviced", "doctor") })
+
+	// Output:
+	// could not connect
+}
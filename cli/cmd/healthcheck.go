@@ -16,6 +16,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/codegangsta/cli"
 )
@@ -52,6 +53,10 @@ func (c *ServicedCli) cmdHealthCheck(ctx *cli.Context) error {
 				if serviceHealth.ContainerID == "" {
 					serviceHealth.ContainerID = "<none>"
 				}
+				// external services have endpoints instead of a container
+				if len(serviceHealth.Endpoints) > 0 {
+					serviceHealth.ContainerName = strings.Join(serviceHealth.Endpoints, ",")
+				}
 
 				t.AddRow(map[string]interface{}{
 					"Service Name":   serviceHealth.ServiceName,
@@ -16,6 +16,10 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/control-center/serviced/cli/api"
@@ -74,6 +78,28 @@ func (c *ServicedCli) initLog() {
 						Usage: "Do not export child services",
 					},
 				},
+			}, {
+				Name:        "tail",
+				Usage:       "Follows application logs",
+				Description: "serviced log tail SERVICEID",
+				Action:      c.cmdTailLogs,
+				Flags: []cli.Flag{
+					cli.IntFlag{
+						Name:  "instance",
+						Value: -1,
+						Usage: "only follow the logs of this instance",
+					},
+					cli.StringFlag{
+						Name:  "grep",
+						Value: "",
+						Usage: "only show lines matching this regular expression",
+					},
+					cli.StringFlag{
+						Name:  "since",
+						Value: "0s",
+						Usage: "start with the lines logged this long ago (e.g. 5m)",
+					},
+				},
 			},
 		},
 	})
@@ -125,6 +151,53 @@ func (c *ServicedCli) cmdExportLogs(ctx *cli.Context) {
 	}
 }
 
+// serviced log tail SERVICEID
+func (c *ServicedCli) cmdTailLogs(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) != 1 {
+		fmt.Printf("Incorrect Usage.\n\n")
+		cli.ShowCommandHelp(ctx, "tail")
+		return
+	}
+
+	svc, instanceID, err := c.searchForService(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	if ctx.Int("instance") >= 0 {
+		instanceID = ctx.Int("instance")
+	}
+
+	since, err := time.ParseDuration(ctx.String("since"))
+	if err != nil || since < 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: --since value '%s' is not a valid duration\n", ctx.String("since"))
+		return
+	}
+
+	cfg := api.TailLogsConfig{
+		ServiceIDs: []string{svc.ID},
+		Grep:       ctx.String("grep"),
+		Since:      since,
+	}
+	if instanceID >= 0 {
+		cfg.InstanceID = strconv.Itoa(instanceID)
+	}
+
+	// follow the logs until interrupted
+	stopChan := make(chan struct{})
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		close(stopChan)
+	}()
+
+	if err := c.driver.TailLogs(cfg, stopChan); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
 // TODO: finish this, once flag completion is supported by cli.
 // // Bash-completion command
 // func (c *ServicedCli) printLogExportCompletion(ctx *cli.Context) {
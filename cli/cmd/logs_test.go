@@ -17,6 +17,7 @@ package cmd
 
 import (
 	"testing"
+	"time"
 
 	"github.com/control-center/serviced/cli/api"
 	mocks "github.com/control-center/serviced/cli/api/apimocks"
@@ -176,6 +177,69 @@ func ExampleServicedCLI_CmdLogExport_InvalidGroupBy() {
 	// ERROR: --group-by value 'badbad' is invalid; only 'container', 'day' or 'service' allowed
 }
 
+func ExampleServicedCLI_CmdLogTail_usage() {
+	runLogsAPITest(&mocks.API{}, "serviced", "log", "tail")
+
+	// Output:
+	// Incorrect Usage.
+	//
+	// NAME:
+	//    tail - Follows application logs
+	//
+	// USAGE:
+	//    command tail [command options] [arguments...]
+	//
+	// DESCRIPTION:
+	//    serviced log tail SERVICEID
+	//
+	// OPTIONS:
+	//    --instance '-1'	only follow the logs of this instance
+	//    --grep 		only show lines matching this regular expression
+	//    --since '0s'		start with the lines logged this long ago (e.g. 5m)
+}
+
+func ExampleServicedCLI_CmdLogTail_invalidSince() {
+	mockAPI := mocks.API{}
+	mockAPI.On("ResolveServicePath", "zencommand").Return(serviceDetailsByName("zencommand"), nil)
+	pipeStderr(func() { runLogsAPITest(&mockAPI, "serviced", "log", "tail", "--since", "yesterday", "zencommand") })
+
+	// Output:
+	// ERROR: --since value 'yesterday' is not a valid duration
+}
+
+func TestLogsCLI_CmdLogTail(t *testing.T) {
+	for _, tc := range []struct {
+		args        []string
+		servicePath string
+		expected    api.TailLogsConfig
+	}{
+		{
+			args:        []string{"serviced", "log", "tail", "zencommand"},
+			servicePath: "zencommand",
+			expected:    api.TailLogsConfig{ServiceIDs: []string{"test-service-3"}},
+		}, {
+			args:        []string{"serviced", "log", "tail", "zencommand/2"},
+			servicePath: "zencommand/",
+			expected:    api.TailLogsConfig{ServiceIDs: []string{"test-service-3"}, InstanceID: "2"},
+		}, {
+			servicePath: "zencommand",
+			args:        []string{"serviced", "log", "tail", "--instance", "1", "--grep", "ERROR", "--since", "5m", "zencommand"},
+			expected: api.TailLogsConfig{
+				ServiceIDs: []string{"test-service-3"},
+				InstanceID: "1",
+				Grep:       "ERROR",
+				Since:      5 * time.Minute,
+			},
+		},
+	} {
+		mockAPI := mocks.API{}
+		mockAPI.On("ResolveServicePath", tc.servicePath).Return(serviceDetailsByName("zencommand"), nil)
+		mockAPI.On("TailLogs", tc.expected, mock.AnythingOfType("chan struct {}")).Once().Return(nil)
+		runLogsAPITest(&mockAPI, tc.args...)
+		mockAPI.AssertExpectations(t)
+	}
+}
+
 // compareStringSlices compares the contents of two string slices, without order.
 // It was 'borrowed' from http://stackoverflow.com/a/36000696
 func compareStringSlices(x, y []string) bool {
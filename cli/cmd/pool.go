@@ -108,6 +108,12 @@ func (c *ServicedCli) initPool() {
 				Description:  "serviced pool set-conn-timeout POOLID TIMEOUT",
 				BashComplete: c.printPoolsFirst,
 				Action:       c.cmdSetConnTimeout,
+			}, {
+				Name:         "set-registry",
+				Usage:        "Set the docker registry (HOST:PORT[/NAMESPACE]) that hosts in a resource pool pull images from; an empty REGISTRY uses the master's",
+				Description:  "serviced pool set-registry POOLID REGISTRY",
+				BashComplete: c.printPoolsFirst,
+				Action:       c.cmdSetRegistry,
 			}, {
 				Name:         "set-permission",
 				Usage:        "Set permission flags for hosts in a pool",
@@ -403,6 +409,31 @@ func (c *ServicedCli) cmdSetConnTimeout(ctx *cli.Context) {
 	}
 }
 
+// serviced pool set-registry POOLID REGISTRY
+func (c *ServicedCli) cmdSetRegistry(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) != 2 {
+		fmt.Printf("Incorrect Usage.\n\n")
+		cli.ShowCommandHelp(ctx, "set-registry")
+		return
+	}
+
+	pool, err := c.driver.GetResourcePool(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	} else if pool == nil {
+		fmt.Fprintln(os.Stderr, "pool not found")
+		return
+	}
+
+	pool.Registry = args[1]
+	if err := c.driver.UpdateResourcePool(*pool); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+}
+
 func (c *ServicedCli) cmdSetPermission(ctx *cli.Context) {
 	args := ctx.Args()
 	if len(args) != 1 {
@@ -0,0 +1,53 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/codegangsta/cli"
+)
+
+// Initializer for serviced replica
+func (c *ServicedCli) initReplica() {
+	c.app.Commands = append(c.app.Commands, cli.Command{
+		Name:        "replica",
+		Usage:       "Administers the replica of a standby master",
+		Description: "",
+		Subcommands: []cli.Command{
+			{
+				Name:        "promote",
+				Usage:       "Brings up this standby master with the applications replicated from the primary master",
+				Description: "serviced replica promote",
+				Action:      c.cmdReplicaPromote,
+			},
+		},
+	})
+}
+
+// serviced replica promote
+func (c *ServicedCli) cmdReplicaPromote(ctx *cli.Context) {
+	if len(ctx.Args()) > 0 {
+		fmt.Printf("Incorrect Usage.\n\n")
+		cli.ShowCommandHelp(ctx, "promote")
+		return
+	}
+	if err := c.driver.PromoteReplica(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		c.exit(1)
+		return
+	}
+	fmt.Println("Promoted standby master; add hosts to its resource pools to start the applications")
+}
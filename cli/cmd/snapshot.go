@@ -21,6 +21,7 @@ import (
 	"github.com/codegangsta/cli"
 	"github.com/control-center/serviced/cli/api"
 	"github.com/control-center/serviced/dao"
+	"github.com/control-center/serviced/volume"
 )
 
 // initSnapshot is the initializer for serviced snapshot
@@ -102,6 +103,31 @@ func (c *ServicedCli) initSnapshot() {
 				Description:  "serviced snapshot untag SERVICEID TAG-NAME",
 				BashComplete: c.printServicesFirst,
 				Action:       c.cmdSnapshotRemoveTag,
+			}, {
+				Name:         "ls",
+				Usage:        "Lists the files at a path in a snapshot",
+				Description:  "serviced snapshot ls SNAPSHOTID [PATH]",
+				BashComplete: c.printSnapshotsFirst,
+				Action:       c.cmdSnapshotListFiles,
+			}, {
+				Name:         "diff",
+				Usage:        "Shows the files that changed between two snapshots",
+				Description:  "serviced snapshot diff SNAPSHOTID SNAPSHOTID [PATH]",
+				BashComplete: c.printSnapshotsAll,
+				Action:       c.cmdSnapshotDiff,
+			}, {
+				Name:         "restore-path",
+				Usage:        "Restores a file or directory from a snapshot",
+				Description:  "serviced snapshot restore-path SNAPSHOTID PATH",
+				BashComplete: c.printSnapshotsFirst,
+				Action:       c.cmdSnapshotRestorePath,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "to",
+						Value: "",
+						Usage: "directory on the master to restore into, instead of the application's volume",
+					},
+				},
 			},
 		},
 	})
@@ -391,3 +417,95 @@ func (c *ServicedCli) cmdSnapshotRemoveTag(ctx *cli.Context) {
 	}
 	fmt.Printf("%s\n", snapshotID)
 }
+
+// serviced snapshot ls SNAPSHOTID [PATH]
+func (c *ServicedCli) cmdSnapshotListFiles(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Printf("Incorrect Usage.\n\n")
+		cli.ShowCommandHelp(ctx, "ls")
+		return
+	}
+
+	files, err := c.driver.ListSnapshotFiles(args[0], args.Get(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		c.exit(1)
+		return
+	}
+
+	t := NewTable("Mode,Size,Modified,Path")
+	for _, f := range files {
+		name := f.Path
+		if f.Link != "" {
+			name += " -> " + f.Link
+		}
+		t.AddRow(map[string]interface{}{
+			"Mode":     f.Mode,
+			"Size":     f.Size,
+			"Modified": f.ModTime.Format("2006-01-02 15:04:05"),
+			"Path":     name,
+		})
+	}
+	t.Padding = 6
+	t.Print()
+}
+
+// serviced snapshot diff SNAPSHOTID SNAPSHOTID [PATH]
+func (c *ServicedCli) cmdSnapshotDiff(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) < 2 || len(args) > 3 {
+		fmt.Printf("Incorrect Usage.\n\n")
+		cli.ShowCommandHelp(ctx, "diff")
+		return
+	}
+
+	changes, err := c.driver.DiffSnapshots(args[0], args[1], args.Get(2))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		c.exit(1)
+		return
+	}
+
+	if len(changes) == 0 {
+		fmt.Fprintln(os.Stderr, "no changes found")
+		return
+	}
+
+	t := NewTable("Change,Old Size,New Size,Path")
+	for _, ch := range changes {
+		row := map[string]interface{}{
+			"Change":   ch.Change,
+			"Old Size": "",
+			"New Size": "",
+			"Path":     ch.Path,
+		}
+		if ch.Change != volume.FileAdded {
+			row["Old Size"] = ch.OldSize
+		}
+		if ch.Change != volume.FileRemoved {
+			row["New Size"] = ch.NewSize
+		}
+		t.AddRow(row)
+	}
+	t.Padding = 6
+	t.Print()
+}
+
+// serviced snapshot restore-path SNAPSHOTID PATH [--to DIR]
+func (c *ServicedCli) cmdSnapshotRestorePath(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) != 2 {
+		fmt.Printf("Incorrect Usage.\n\n")
+		cli.ShowCommandHelp(ctx, "restore-path")
+		return
+	}
+
+	count, err := c.driver.RestoreSnapshotPath(args[0], args[1], ctx.String("to"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		c.exit(1)
+		return
+	}
+	fmt.Printf("Restored %d file(s) from %s\n", count, args[0])
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/control-center/serviced/cli/api"
 	"github.com/control-center/serviced/dao"
 	"github.com/control-center/serviced/utils"
+	"github.com/control-center/serviced/volume"
 	"github.com/control-center/serviced/volume/btrfs"
 )
 
@@ -180,6 +181,43 @@ func (t SnapshotAPITest) RemoveSnapshotTag(serviceID string, tagName string) (st
 	return "", ErrNoSnapshotFound
 }
 
+func (t SnapshotAPITest) DiffSnapshots(fromSnapshotID, toSnapshotID, path string) ([]volume.SnapshotChange, error) {
+	if t.fail {
+		return nil, ErrInvalidSnapshot
+	}
+	for _, id := range []string{fromSnapshotID, toSnapshotID} {
+		if ok, err := t.hasSnapshot(id); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, ErrNoSnapshotFound
+		}
+	}
+	return []volume.SnapshotChange{
+		{Path: "etc/added.conf", Change: volume.FileAdded, NewSize: 10},
+		{Path: "etc/app.conf", Change: volume.FileModified, OldSize: 20, NewSize: 25},
+		{Path: "etc/removed.conf", Change: volume.FileRemoved, OldSize: 30},
+	}, nil
+}
+
+func (t SnapshotAPITest) RestoreSnapshotPath(snapshotID, path, dest string) (int, error) {
+	if t.fail {
+		return 0, ErrInvalidSnapshot
+	}
+	if ok, err := t.hasSnapshot(snapshotID); err != nil {
+		return 0, err
+	} else if !ok {
+		return 0, ErrNoSnapshotFound
+	}
+	return 3, nil
+}
+
+func (t SnapshotAPITest) PromoteReplica() error {
+	if t.fail {
+		return ErrStub
+	}
+	return nil
+}
+
 func ExampleServicedCLI_CmdSnapshotList() {
 	InitSnapshotAPITest("serviced", "snapshot", "list")
 
@@ -619,3 +657,35 @@ func ExampleServicedCLI_CmdSnapshotUntag_btrfsFail() {
 	// Output:
 	// operation not supported on btrfs driver
 }
+
+func TestServicedCLI_CmdSnapshotDiff(t *testing.T) {
+	output := captureStdout(func() {
+		InitSnapshotAPITest("serviced", "snapshot", "diff", "test-service-1-snapshot-1", "test-service-1-snapshot-2")
+	})
+	expected :=
+		"Change        Old Size      New Size      Path" +
+			"\nadded                       10            etc/added.conf" +
+			"\nmodified      20            25            etc/app.conf" +
+			"\nremoved       30                          etc/removed.conf"
+
+	outStr := TrimLines(fmt.Sprintf("%s", output))
+	expected = TrimLines(expected)
+
+	if expected != outStr {
+		t.Fatalf("\ngot:\n%s\nwant:\n%s", outStr, expected)
+	}
+}
+
+func ExampleServicedCLI_CmdSnapshotRestorePath() {
+	InitSnapshotAPITest("serviced", "snapshot", "restore-path", "test-service-1-snapshot-1", "etc", "--to", "/tmp/restore")
+
+	// Output:
+	// Restored 3 file(s) from test-service-1-snapshot-1
+}
+
+func ExampleServicedCLI_CmdReplicaPromote() {
+	InitSnapshotAPITest("serviced", "replica", "promote")
+
+	// Output:
+	// Promoted standby master; add hosts to its resource pools to start the applications
+}
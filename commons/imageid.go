@@ -100,7 +100,7 @@ func RenameImageID(dockerRegistry, tenantId string, imgID string, tag string) (*
 // host     = {alpha|digit|'.'|'-'}+
 // port     = {digit}+
 // reponame = [user'/']repo
-// user     = {alpha|digit|'-'|'_'}+
+// user     = {alpha|digit|'-'|'_'|'/'}+
 // repo     = {alpha|digit|'-'|'_'|'.'}+
 // tag      = {alpha|digit|'-'|'_'|'.'}+
 // The grammar is ambiguous so the parser is a little messy in places.
@@ -215,6 +215,15 @@ func ParseImageID(iid string) (*ImageID, error) {
 			switch {
 			case unicode.IsLetter(rune), unicode.IsDigit(rune), rune == dash, rune == underscore, rune == period:
 				tokbuf = append(tokbuf, byte(rune))
+			case rune == slash:
+				// registries may nest repos under a namespace (e.g.
+				// host/namespace/user/repo), so the user keeps every path
+				// component before the repo
+				if result.User != "" {
+					result.User += "/"
+				}
+				result.User += string(tokbuf)
+				tokbuf = []byte{}
 			case rune == colon:
 				result.Repo = string(tokbuf)
 				tokbuf = []byte{}
@@ -337,6 +346,12 @@ func (iid ImageID) Registry() string {
 	return strings.Join(s, "")
 }
 
+// Library returns the last component of the user, which is the library of
+// the image in a docker registry that nests repositories under a namespace.
+func (iid ImageID) Library() string {
+	return iid.User[strings.LastIndex(iid.User, "/")+1:]
+}
+
 // IsLatest returns a boolean that indicates that the image ID is the latest
 func (iid ImageID) IsLatest() bool {
 	switch iid.Tag {
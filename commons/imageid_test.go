@@ -290,6 +290,30 @@ var imgidtests = []ImageIDTest{
 		},
 		"",
 	},
+
+	// host, port, namespace, user, repo, tag
+	{
+		"warner.bros:1948/studio/dobbs/sierramadre:1925",
+		&ImageID{
+			Host: "warner.bros",
+			Port: 1948,
+			User: "studio/dobbs",
+			Repo: "sierramadre",
+			Tag:  "1925",
+		},
+		"",
+	},
+
+	// host, nested namespace, user, repo
+	{
+		"warner.bros/studio/classics/dobbs/sierramadre",
+		&ImageID{
+			Host: "warner.bros",
+			User: "studio/classics/dobbs",
+			Repo: "sierramadre",
+		},
+		"",
+	},
 }
 
 func doTest(c *C, parse func(string) (*ImageID, error), name string, tests []ImageIDTest) {
@@ -432,6 +456,12 @@ func (s *TestCommonsSuite) TestRenameImageID(c *C) {
 	doRenameImageIdTest(c, renameTests)
 }
 
+func (s *TestCommonsSuite) TestLibrary(c *C) {
+	c.Assert(ImageID{User: "tenant", Repo: "repo"}.Library(), Equals, "tenant")
+	c.Assert(ImageID{User: "serviced/tenant", Repo: "repo"}.Library(), Equals, "tenant")
+	c.Assert(ImageID{Repo: "repo"}.Library(), Equals, "")
+}
+
 func (s *TestCommonsSuite) TestMerge(c *C) {
 	img1_orig := &ImageID{
 		"host",
@@ -52,16 +52,22 @@ type Options struct {
 	Agent                      bool
 	MuxPort                    int
 	MuxDisableTLS              string //  Disable TLS for MUX connections, string val of bool
+	MuxMultiplex               string //  Multiplex MUX connections between hosts over persistent sessions, string val of bool
+	MuxVerify                  string //  Verify the certificates and tenants of MUX callers, string val of bool
 	KeyPEMFile                 string
 	CertPEMFile                string
 	HomePath                   string // serviced's root directory; e.g. /opt/serviced
 	VolumesPath                string
 	EtcPath                    string
 	IsvcsPath                  string
+	DatastorePath              string   // Where the embedded datastore keeps control-plane entities
+	SchemaDryRun               bool     // Report the schema migrations the master would run and exit
+	SchemaRollback             []string // Roll back the schema of an entity kind to a version (kind:version) and exit
 	BackupsPath                string
 	ResourcePath               string
 	LogPath                    string // Serviced logs directory
 	Zookeepers                 []string
+	Etcd                       []string // etcd v3 endpoints used for coordination instead of zookeeper
 	ReportStats                bool
 	HostStats                  string
 	StatsPeriod                int
@@ -76,6 +82,11 @@ type Options struct {
 	Verbosity                  int
 	StaticIPs                  []string
 	DockerRegistry             string
+	DockerRegistryExternal     bool   // Is the docker registry managed outside of serviced
+	DockerRegistryUsername     string // Username to authenticate with the docker registry
+	DockerRegistryPassword     string // Password to authenticate with the docker registry
+	DockerRegistryCA           string // Path to the certificate authority of the docker registry
+	DockerRegistryInsecure     bool   // Should the docker registry be reached over plain http
 	CPUProfile                 string // write cpu profile to file
 	MaxContainerAge            int    // max container age in seconds
 	MaxDFSTimeout              int    // max timeout for snapshot
@@ -86,6 +97,7 @@ type Options struct {
 	LogstashMaxSize            int    // Max size of logstash data
 	LogstashCycleTime          int    // Logstash purging cycle time in hours
 	LogstashURL                string
+	LogOutputsFile             string // Path to the json list of cluster-wide log forwarding outputs
 	DebugPort                  int      // Port to listen for profile clients
 	AdminGroup                 string   // user group that can log in to control center
 	MaxRPCClients              int      // the max number of rpc clients to an endpoint
@@ -97,11 +109,14 @@ type Options struct {
 	RPCTLSCiphers              []string          // List of tls ciphers supported for rpc
 	RPCTLSMinVersion           string            // Minimum TLS version supported for rpc
 	SnapshotTTL                int               // hours to keep snapshots around, zero for infinity
+	RegistryGCInterval         int               // hours between docker registry garbage collections, zero to disable
 	StorageArgs                []string          // command-line arguments for storage options
 	StorageOptions             map[string]string // environment arguments for storage options
 	ControllerBinary           string            // Path to the container controller binary
 	StartISVCS                 []string          // ISVCS to start when running as an agent
 	IsvcsENV                   []string          // Isvcs env variables
+	IsvcsExternal              []string          // Isvcs that run outside of serviced, as ISVC:ENDPOINT[,ENDPOINT...]
+	IsvcsExternalCA            string            // Path to the certificate authority of the isvcs that run outside of serviced
 	IsvcsZKID                  int               // Zookeeper server id when running as a quorum
 	IsvcsZKQuorum              []string          // Members of the zookeeper quorum
 	TLSCiphers                 []string          // List of tls ciphers supported for http
@@ -122,12 +137,30 @@ type Options struct {
 	LogConfigFilename          string            // Path to the logri configuration
 	StorageReportInterval      int               // frequency in seconds to report storage stats to opentsdb
 	ServiceRunLevelTimeout     int               // The time in seconds serviced will wait for a batch of services to stop/start before moving to services with the next run level
+	DrainTimeout               int               // The time in seconds a stopping service instance waits for its active connections to drain
 	StorageMetricMonitorWindow int               // The amount of time in seconds for which serviced will consider storage availability metrics in order to predict future availability
 	StorageLookaheadPeriod     int               // The amount of time in the future in seconds serviced should predict storage availability for the purposes of emergency shutdown
 	StorageMinimumFreeSpace    string            // The amount of space the emergency shutdown algorithm should reserve when deciding to shut down
+	StorageAutoExtend          bool              // Should the devicemapper thin pool be extended from free space in its volume group as it fills up
+	StorageExtendDataThreshold int               // The percent of the thin pool data volume used before it is extended
+	StorageExtendMetaThreshold int               // The percent of the thin pool metadata volume used before it is extended
+	StorageExtendPercent       int               // The percent of its current size that is added to the thin pool when it is extended
+	ReplicaListen              string            // The address on which a standby master receives replicas from the primary master
+	ReplicaTarget              string            // The address of the standby master that the primary master replicates to
+	ReplicaKeyFile             string            // The file holding the key shared by the primary and standby masters
+	ReplicaInterval            int               // The time in minutes between replications to the standby master
+	DFSTransport               string            // The protocol the master exports the distributed filesystem with (nfs or 9p)
+	DFSPort                    int               // The port the master serves the distributed filesystem on over 9p
+	DFSMountTimeout            int               // The time in seconds a delegate waits to mount the distributed filesystem over 9p
+	Datastore                  string            // The backend control-plane entities are stored in (elastic or embedded)
 	BackupEstimatedCompression float64           // Best guess for tgz compression ratio (uncompressed size / compressed size) used to determine whether sufficient disk space is available for taking a backup
 	BackupMinOverhead          string            // Warn user if estimated backup size would leave less than this amount of space free
 	StartZK                    bool              // Should ZooKeeper ISVC be started
+	MasterHA                   bool              // Should the master-only subsystems run on the master elected among master-capable hosts
+	MasterVIP                  string            // The virtual ip, in CIDR notation, that follows the active master
+	MasterVIPInterface         string            // The device the master virtual ip is bound to
+	MasterFenceCommand         string            // The command a new active master runs to fence the previous master
+	MasterFenceDelay           int               // The time in seconds a new active master waits before taking over from another host
 	BigTableMetrics            bool              // Should serviced metrics be stored in gcp bigtable
 	Auth0Domain                string            // Domain configured for tenant in Auth0. Ref: https://auth0.com/docs/getting-started/the-basics#domain
 	Auth0Audience              string            // Audience configured for application (?) in Auth0
@@ -70,6 +70,7 @@ const (
 	// ContainerKeysDir holds the delegate's private key and auth token
 	containerDelegateKeyFile = "/etc/serviced/delegate.keys"
 	containerTokenFile       = "/etc/serviced/auth.token"
+	containerMuxCertFile     = "/etc/serviced/mux.pem"
 )
 
 // Logforwarder configuration for filebeat
@@ -96,6 +97,7 @@ type ControllerOptions struct {
 		DisableTLS  bool   // True if TLS is disabled
 		KeyPEMFile  string // Path to the key file when TLS is used
 		CertPEMFile string // Path to the cert file when TLS is used
+		Multiplex   bool   // True if connections share persistent sessions to remote muxes
 	}
 	Logforwarder LogforwarderOptions
 	Metric struct {
@@ -106,6 +108,7 @@ type ControllerOptions struct {
 	MetricForwarding     bool   // Whether or not the Controller should forward metrics
 	HostIPs		     string // The ip addresses of the host
 	ServiceNamePath	     string // Path of the service
+	DrainTimeout         time.Duration // How long to wait for connections to drain before stopping the service
 }
 
 // Controller is a object to manage the operations withing a container. For example,
@@ -259,10 +262,10 @@ func setupConfigFiles(svc *service.Service) error {
 }
 
 // setupLogstashFiles sets up logstash files
-func setupLogstashFiles(hostID string, hostIPs string, svcPath string, service *service.Service, instanceID string, logforwarderOptions LogforwarderOptions) error {
+func setupLogstashFiles(hostID string, hostIPs string, svcPath string, tenantID string, service *service.Service, instanceID string, logforwarderOptions LogforwarderOptions) error {
 	// write out logstash files
 	if len(service.LogConfigs) != 0 {
-		err := writeLogstashAgentConfig(hostID, hostIPs, svcPath, service, instanceID, logforwarderOptions)
+		err := writeLogstashAgentConfig(hostID, hostIPs, svcPath, tenantID, service, instanceID, logforwarderOptions)
 		if err != nil {
 			return err
 		}
@@ -294,6 +297,7 @@ func NewController(options ControllerOptions) (*Controller, error) {
 
 	go auth.WatchDelegateKeyFile(containerDelegateKeyFile, keyshutdown)
 	go auth.WatchTokenFile(containerTokenFile, keyshutdown)
+	go auth.WatchMuxCertificateFile(containerMuxCertFile, keyshutdown)
 
 	// Load the delegate keys and auth tokens first so there's no race btwn starting the watcher routines
 	//    and making the first RPC call in getService()
@@ -344,7 +348,7 @@ func NewController(options ControllerOptions) (*Controller, error) {
 	}
 
 	if options.Logforwarder.Enabled && len(service.LogConfigs) > 0 {
-		if err := setupLogstashFiles(c.hostID, options.HostIPs, options.ServiceNamePath, service,
+		if err := setupLogstashFiles(c.hostID, options.HostIPs, options.ServiceNamePath, c.tenantID, service,
 				options.Service.InstanceID, options.Logforwarder); err != nil {
 			glog.Errorf("Could not setup logstash files error:%s", err)
 			return c, fmt.Errorf("container: invalid LogStashFiles error:%s", err)
@@ -410,7 +414,7 @@ func NewController(options ControllerOptions) (*Controller, error) {
 
 	// endpoints are created at the root level (not pool aware)
 	rootBasePath := ""
-	zClient, err := coordclient.New("zookeeper", c.zkInfo.ZkDSN, rootBasePath, nil)
+	zClient, err := coordclient.New(coordclient.DriverName(c.zkInfo.ZkDSN), c.zkInfo.ZkDSN, rootBasePath, nil)
 	if err != nil {
 		glog.Errorf("failed create a new coordclient: %v", err)
 		return c, err
@@ -426,6 +430,7 @@ func NewController(options ControllerOptions) (*Controller, error) {
 		IsShell:              os.Getenv("SERVICED_IS_SERVICE_SHELL") == "true",
 		TCPMuxPort:           uint16(options.Mux.Port),
 		UseTLS:               !options.Mux.DisableTLS,
+		Multiplex:            options.Mux.Multiplex,
 		VirtualAddressSubnet: options.VirtualAddressSubnet,
 	}
 	c.endpoints, err = NewContainerEndpoints(service, opts)
@@ -697,13 +702,31 @@ func (c *Controller) Run() (err error) {
 		}
 	}
 
+	// drained closes when the exported connections have drained after the
+	// instance was asked to stop.
+	var drained <-chan struct{}
+	var drainSig os.Signal
+
 	for !exited {
 		select {
 		case sig := <-sigc:
+			if c.options.DrainTimeout > 0 && drainSig == nil && service != nil {
+				glog.Infof("Draining connections for service %s before notifying subprocess of signal %v", c.options.Service.ID, sig)
+				drainSig = sig
+				drained = c.endpoints.Drain(c.options.DrainTimeout)
+				break
+			}
 			glog.Infof("Notifying subprocess of signal %v for service %s", sig, c.options.Service.ID)
+			drained = nil
 			shutdownService(service, sig)
 			glog.Infof("Notification complete for signal %v for service %s", sig, c.options.Service.ID)
 
+		case <-drained:
+			glog.Infof("Connections drained; notifying subprocess of signal %v for service %s", drainSig, c.options.Service.ID)
+			drained = nil
+			shutdownService(service, drainSig)
+			glog.Infof("Notification complete for signal %v for service %s", drainSig, c.options.Service.ID)
+
 		case <-exitAfter:
 			glog.Infof("Killing unresponsive subprocess for service %s", c.options.Service.ID)
 			sendSignal(service, syscall.SIGKILL)
@@ -19,11 +19,13 @@ import (
 	"net"
 	"os"
 	"regexp"
+	"strings"
 	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/control-center/serviced/domain/service"
+	proxypkg "github.com/control-center/serviced/proxy"
 	"github.com/control-center/serviced/zzk"
 	"github.com/control-center/serviced/zzk/registry"
 	zkservice "github.com/control-center/serviced/zzk/service"
@@ -37,6 +39,7 @@ type ContainerEndpointsOptions struct {
 	IsShell              bool
 	TCPMuxPort           uint16
 	UseTLS               bool
+	Multiplex            bool // multiplex connections to remote muxes over persistent sessions
 	VirtualAddressSubnet string
 }
 
@@ -47,6 +50,7 @@ type ContainerEndpoints struct {
 	cache *proxyCache
 	ports map[uint16]struct{}
 	vifs  *VIFRegistry
+	drain chan struct{}
 }
 
 // NewContainerEndpoints loads the service state and manages port bindings
@@ -57,6 +61,7 @@ func NewContainerEndpoints(svc *service.Service, opts ContainerEndpointsOptions)
 		opts:  opts,
 		ports: make(map[uint16]struct{}),
 		vifs:  NewVIFRegistry(),
+		drain: make(chan struct{}),
 	}
 
 	// load the state object
@@ -66,7 +71,7 @@ func NewContainerEndpoints(svc *service.Service, opts ContainerEndpointsOptions)
 	}
 
 	// set up the proxy cache
-	ce.cache = newProxyCache(opts.TenantID, opts.TCPMuxPort, opts.UseTLS, allowDirect)
+	ce.cache = newProxyCache(opts.TenantID, opts.TCPMuxPort, opts.UseTLS, opts.Multiplex, allowDirect)
 
 	// set up virtual interface registry
 	if err := ce.vifs.SetSubnet(opts.VirtualAddressSubnet); err != nil {
@@ -116,6 +121,7 @@ func (ce *ContainerEndpoints) loadState(svc *service.Service) (bool, error) {
 				binds = append(binds, zkservice.ImportBinding{
 					Application:    ep.Application,
 					Purpose:        ep.Purpose,
+					Protocol:       ep.Protocol,
 					PortNumber:     ep.PortNumber,
 					VirtualAddress: ep.VirtualAddress,
 				})
@@ -197,6 +203,56 @@ func (ce *ContainerEndpoints) Run(cancel <-chan struct{}) {
 	go ce.RunImportListener(cancel, ce.opts.TenantID, ce.state.Imports...)
 }
 
+// Drain marks all of the exports as draining, so that importers stop opening
+// new connections to this instance, and returns a channel that closes once
+// the active connections to the exported ports have finished or the timeout
+// has elapsed, whichever comes first.
+func (ce *ContainerEndpoints) Drain(timeout time.Duration) <-chan struct{} {
+	drained := make(chan struct{})
+	if len(ce.ports) == 0 {
+		close(drained)
+		return drained
+	}
+
+	select {
+	case <-ce.drain:
+	default:
+		close(ce.drain)
+	}
+
+	go func() {
+		defer close(drained)
+		logger := plog.WithField("timeout", timeout)
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			count := 0
+			for _, procFile := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+				conns, err := getEstablishedConnections(procFile, ce.ports)
+				if err != nil {
+					logger.WithError(err).WithField("procfile", procFile).Debug("Could not count active connections")
+					continue
+				}
+				count += conns
+			}
+			if count == 0 {
+				logger.Debug("All connections drained")
+				return
+			}
+			logger.WithField("connections", count).Debug("Waiting for connections to drain")
+			select {
+			case <-ticker.C:
+			case <-timer.C:
+				logger.WithField("connections", count).Warn("Timed out waiting for connections to drain")
+				return
+			}
+		}
+	}()
+	return drained
+}
+
 // AddExport ensures that an export is registered for other services to bind
 func (ce *ContainerEndpoints) AddExport(cancel <-chan struct{}, bind zkservice.ExportBinding) {
 	logger := plog.WithFields(log.Fields{
@@ -222,7 +278,7 @@ func (ce *ContainerEndpoints) AddExport(cancel <-chan struct{}, bind zkservice.E
 			if conn != nil {
 
 				logger.Debug("Received coordinator connection")
-				registry.RegisterExport(cancel, conn, ce.opts.TenantID, exp)
+				registry.RegisterExport(cancel, ce.drain, conn, ce.opts.TenantID, exp)
 				select {
 				case <-cancel:
 					return
@@ -376,8 +432,11 @@ func (ce *ContainerEndpoints) UpdateRemoteExports(bind zkservice.ImportBinding,
 				continue
 			}
 
+			protocol := importProtocol(bind, export)
+			exLogger = exLogger.WithField("protocol", protocol)
+
 			// update the proxy; returns a boolean if a new proxy was created.
-			isNew, err := ce.cache.Set(bind.Application, port, export)
+			isNew, err := ce.cache.Set(bind.Application, protocol, port, export)
 			if err != nil {
 				exLogger.WithError(err).Error("Could not update proxy")
 				return
@@ -396,7 +455,7 @@ func (ce *ContainerEndpoints) UpdateRemoteExports(bind zkservice.ImportBinding,
 				if virtualAddress != "" {
 
 					exLogger = exLogger.WithField("virtualaddress", virtualAddress)
-					if err := ce.vifs.RegisterVirtualAddress(virtualAddress, fmt.Sprintf("%d", port), export.Protocol); err != nil {
+					if err := ce.vifs.RegisterVirtualAddress(virtualAddress, fmt.Sprintf("%d", port), protocol); err != nil {
 						exLogger.WithError(err).Warn("Could not register virtual address")
 						continue
 					}
@@ -424,7 +483,11 @@ func (ce *ContainerEndpoints) UpdateRemoteExports(bind zkservice.ImportBinding,
 			}
 		}
 
-		exLogger = exLogger.WithField("portnumber", port)
+		protocol := importProtocol(bind, exports...)
+		exLogger = exLogger.WithFields(log.Fields{
+			"portnumber": port,
+			"protocol":   protocol,
+		})
 
 		// check if the port is used by an export
 		if _, ok := ce.ports[port]; ok {
@@ -433,7 +496,7 @@ func (ce *ContainerEndpoints) UpdateRemoteExports(bind zkservice.ImportBinding,
 		}
 
 		// update the proxy
-		isNew, err := ce.cache.Set(bind.Application, port, exports...)
+		isNew, err := ce.cache.Set(bind.Application, protocol, port, exports...)
 		if err != nil {
 			exLogger.WithError(err).Error("Could not update proxy")
 			return
@@ -452,7 +515,7 @@ func (ce *ContainerEndpoints) UpdateRemoteExports(bind zkservice.ImportBinding,
 			if virtualAddress != "" {
 
 				exLogger = exLogger.WithField("virtualaddress", virtualAddress)
-				if err := ce.vifs.RegisterVirtualAddress(virtualAddress, fmt.Sprintf(":%d", port), "tcp"); err != nil {
+				if err := ce.vifs.RegisterVirtualAddress(virtualAddress, fmt.Sprintf("%d", port), protocol); err != nil {
 					exLogger.WithError(err).Warn("Could not register virtual address")
 					return
 				}
@@ -463,8 +526,23 @@ func (ce *ContainerEndpoints) UpdateRemoteExports(bind zkservice.ImportBinding,
 	}
 }
 
+// importProtocol returns the protocol of an import, which is the protocol
+// set on the binding or else the protocol of its exports; tcp by default.
+func importProtocol(bind zkservice.ImportBinding, exports ...registry.ExportDetails) string {
+	if protocol := strings.ToLower(bind.Protocol); protocol != "" {
+		return protocol
+	}
+	for _, export := range exports {
+		if protocol := strings.ToLower(export.Protocol); protocol != "" {
+			return protocol
+		}
+	}
+	return "tcp"
+}
+
 type proxyKey struct {
 	Application string
+	Protocol    string
 	PortNumber  uint16
 }
 
@@ -476,10 +554,11 @@ type proxyCache struct {
 	tcpMuxPort  uint16
 	useTLS      bool
 	allowDirect bool
+	sessions    *proxypkg.SessionPool
 }
 
-func newProxyCache(tenantID string, tcpMuxPort uint16, useTLS, allowDirect bool) *proxyCache {
-	return &proxyCache{
+func newProxyCache(tenantID string, tcpMuxPort uint16, useTLS, multiplex, allowDirect bool) *proxyCache {
+	c := &proxyCache{
 		mu:          &sync.Mutex{},
 		cache:       make(map[proxyKey]*proxy),
 		tenantID:    tenantID,
@@ -487,12 +566,18 @@ func newProxyCache(tenantID string, tcpMuxPort uint16, useTLS, allowDirect bool)
 		useTLS:      useTLS,
 		allowDirect: allowDirect,
 	}
+	if multiplex {
+		c.sessions = proxypkg.NewSessionPool(newMuxSessionDialer(useTLS), proxypkg.DefaultSessionConfig)
+		c.sessions.Authenticate = signMuxSessionHeader
+	}
+	return c
 }
 
 // Set returns true if the key was created and an error
-func (c *proxyCache) Set(application string, portNumber uint16, exports ...registry.ExportDetails) (bool, error) {
+func (c *proxyCache) Set(application, protocol string, portNumber uint16, exports ...registry.ExportDetails) (bool, error) {
 	logger := plog.WithFields(log.Fields{
 		"application": application,
+		"protocol":    protocol,
 		"portnumber":  portNumber,
 	})
 
@@ -501,6 +586,7 @@ func (c *proxyCache) Set(application string, portNumber uint16, exports ...regis
 
 	key := proxyKey{
 		Application: application,
+		Protocol:    protocol,
 		PortNumber:  portNumber,
 	}
 
@@ -510,24 +596,39 @@ func (c *proxyCache) Set(application string, portNumber uint16, exports ...regis
 
 		logger.Debug("Setting up new proxy")
 
+		name := fmt.Sprintf("%s-%d", application, portNumber)
+		tenantEndpointID := fmt.Sprintf("%s-%s-%d", c.tenantID, application, portNumber)
+
 		// start the listener on the provided port
-		listener, err := net.Listen("tcp4", fmt.Sprintf(":%d", portNumber))
-		if err != nil {
-			logger.WithError(err).Debug("Could not open port")
-			return false, err
-		}
+		var err error
+		switch protocol {
+		case "udp":
+			var packetConn net.PacketConn
+			packetConn, err = net.ListenPacket("udp4", fmt.Sprintf(":%d", portNumber))
+			if err != nil {
+				logger.WithError(err).Debug("Could not open port")
+				return false, err
+			}
+
+			logger.Debug("Started port listener")
 
-		logger.Debug("Started port listener")
-
-		// create the proxy
-		prxy, err = newProxy(
-			fmt.Sprintf("%s-%d", application, portNumber),
-			fmt.Sprintf("%s-%s-%d", c.tenantID, application, portNumber),
-			c.tcpMuxPort,
-			c.useTLS,
-			listener,
-			c.allowDirect,
-		)
+			// create the proxy
+			prxy, err = newUDPProxy(name, c.tenantID, tenantEndpointID, c.tcpMuxPort, c.useTLS, packetConn, c.allowDirect, c.sessions)
+		case "tcp":
+			var listener net.Listener
+			listener, err = net.Listen("tcp4", fmt.Sprintf(":%d", portNumber))
+			if err != nil {
+				logger.WithError(err).Debug("Could not open port")
+				return false, err
+			}
+
+			logger.Debug("Started port listener")
+
+			// create the proxy
+			prxy, err = newProxy(name, c.tenantID, tenantEndpointID, c.tcpMuxPort, c.useTLS, listener, c.allowDirect, c.sessions)
+		default:
+			err = fmt.Errorf("invalid protocol: %s", protocol)
+		}
 		if err != nil {
 			logger.WithError(err).Debug("Could not start proxy")
 			return false, err
@@ -538,13 +639,18 @@ func (c *proxyCache) Set(application string, portNumber uint16, exports ...regis
 
 	}
 
-	// update the proxy addresses
-	addresses := make([]addressTuple, len(exports))
-	for i, export := range exports {
-		addresses[i] = addressTuple{
+	// update the proxy addresses, leaving out any instances that are
+	// draining their connections.
+	addresses := []addressTuple{}
+	for _, export := range exports {
+		if export.Draining {
+			continue
+		}
+		addresses = append(addresses, addressTuple{
 			host:          export.HostIP,
 			containerAddr: fmt.Sprintf("%s:%d", export.PrivateIP, export.PortNumber),
-		}
+			application:   export.Application,
+		})
 	}
 	prxy.SetNewAddresses(addresses)
 
@@ -26,7 +26,7 @@ import (
 )
 
 //createFields makes the map of tags for the logstash config including the type
-func createFields(hostID string, hostIPs string, svcPath string, service *service.Service, instanceID string, logConfig *servicedefinition.LogConfig) map[string]string {
+func createFields(hostID string, hostIPs string, svcPath string, tenantID string, service *service.Service, instanceID string, logConfig *servicedefinition.LogConfig) map[string]string {
 	fields := make(map[string]string)
 	fields["type"] = logConfig.Type
 	fields["service"] = service.ID
@@ -34,6 +34,7 @@ func createFields(hostID string, hostIPs string, svcPath string, service *servic
 	fields["hostips"] = hostIPs
 	fields["poolid"] = service.PoolID
 	fields["servicepath"] = svcPath
+	fields["tenantid"] = tenantID
 
 	// CC-2234: Note that logstash is hardcoded to inject a field named 'host' into to every message, but when run from within
 	// a docker container, the value is actually the container id, not the name of the docker host. So this tag is
@@ -61,7 +62,7 @@ func formatTagsForConfFile(tags map[string]string) string {
 }
 
 // writeLogstashAgentConfig creates the logstash forwarder config file
-func writeLogstashAgentConfig(hostID string, hostIPs string, svcPath string, service *service.Service,
+func writeLogstashAgentConfig(hostID string, hostIPs string, svcPath string, tenantID string, service *service.Service,
 	instanceID string, logforwarderOptions LogforwarderOptions) error {
 
 	// generate a prospector configuration for each service log file
@@ -75,7 +76,7 @@ func writeLogstashAgentConfig(hostID string, hostIPs string, svcPath string, ser
         - %s
       fields: %s`
 		prospectorsConf = fmt.Sprintf(prospectorsConf, logConfig.Path,
-			formatTagsForConfFile(createFields(hostID, hostIPs, svcPath, service, instanceID, &logConfig)))
+			formatTagsForConfFile(createFields(hostID, hostIPs, svcPath, tenantID, service, instanceID, &logConfig)))
 	}
 
 	resourcePath := filepath.Dir(logforwarderOptions.Path)
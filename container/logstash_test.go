@@ -92,7 +92,7 @@ func TestMakeSureTagsMakeItIntoTheJson(t *testing.T) {
 
 	fileBeatBinary := filepath.Join(utils.ResourcesDir(), "logstash/filebeat")
 	logforwarderOptions := LogforwarderOptions{Enabled: true, Path: fileBeatBinary, ConfigFile: confFileLocation}
-	if err := writeLogstashAgentConfig("host1", "192.168.1.1", "service/service/", &service, "0", logforwarderOptions); err != nil {
+	if err := writeLogstashAgentConfig("host1", "192.168.1.1", "service/service/", "tenant1", &service, "0", logforwarderOptions); err != nil {
 		t.Errorf("Error writing config file %s", err)
 		return
 	}
@@ -107,6 +107,11 @@ func TestMakeSureTagsMakeItIntoTheJson(t *testing.T) {
 		t.Errorf("Tags did not make it into the config file %s", string(contents))
 		return
 	}
+
+	if !strings.Contains(string(contents), "tenantid: tenant1") {
+		t.Errorf("Tenant ID did not make it into the config file %s", string(contents))
+		return
+	}
 }
 
 func TestDontWriteToNilMap(t *testing.T) {
@@ -147,7 +152,7 @@ func TestDontWriteToNilMap(t *testing.T) {
 
 	fileBeatBinary := filepath.Join(utils.ResourcesDir(), "logstash/filebeat")
 	logforwarderOptions := LogforwarderOptions{Enabled: true, Path: fileBeatBinary, ConfigFile: confFileLocation}
-	if err := writeLogstashAgentConfig("host1", "192.168.1.1", "service/service/", &service, "0", logforwarderOptions); err != nil {
+	if err := writeLogstashAgentConfig("host1", "192.168.1.1", "service/service/", "tenant1", &service, "0", logforwarderOptions); err != nil {
 		t.Errorf("Writing with empty tags produced an error %s", err)
 		return
 	}
@@ -14,16 +14,18 @@
 package container
 
 import (
-	"crypto/tls"
+	"bytes"
 	"fmt"
 	"io"
 	"math/rand"
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/control-center/serviced/auth"
+	proxypkg "github.com/control-center/serviced/proxy"
 	"github.com/control-center/serviced/utils"
 	"github.com/zenoss/glog"
 )
@@ -74,39 +76,73 @@ The netcat (nc) command is particularly useful for this:
 type addressTuple struct {
 	host          string // IP of the host on which the container is running
 	containerAddr string // Container IP:port of the remote service
+	application   string // Application exported at the container address
 }
 
 type proxy struct {
-	name             string              // Name of the remote service
-	tenantEndpointID string              // Tenant endpoint ID
-	addresses        []addressTuple      // Public/container IP:Port of the remote service
-	tcpMuxPort       uint16              // the port to use for TCP Muxing, 0 is disabled
-	useTLS           bool                // use encryption over mux port
-	closing          chan chan error     // internal shutdown signal
-	newAddresses     chan []addressTuple // a stream of updates to the addresses
-	listener         net.Listener        // handle on the listening socket
-	allowDirectConn  bool                // allow container to container connections
+	name             string                // Name of the remote service
+	tenantID         string                // Tenant of the importing service
+	tenantEndpointID string                // Tenant endpoint ID
+	protocol         string                // tcp or udp
+	mu               sync.Mutex            // guards addresses
+	addresses        []addressTuple        // Public/container IP:Port of the remote service
+	tcpMuxPort       uint16                // the port to use for TCP Muxing, 0 is disabled
+	useTLS           bool                  // use encryption over mux port
+	closing          chan chan error       // internal shutdown signal
+	newAddresses     chan []addressTuple   // a stream of updates to the addresses
+	listener         net.Listener          // handle on the listening socket
+	packetConn       net.PacketConn        // handle on the listening udp socket
+	allowDirectConn  bool                  // allow container to container connections
+	sessions         *proxypkg.SessionPool // multiplexed sessions to remote muxes, nil if disabled
 }
 
 // Newproxy create a new proxy object. It starts listening on the prxy port asynchronously.
-func newProxy(name, tenantEndpointID string, tcpMuxPort uint16, useTLS bool, listener net.Listener, allowDirectConn bool) (p *proxy, err error) {
+func newProxy(name, tenantID, tenantEndpointID string, tcpMuxPort uint16, useTLS bool, listener net.Listener, allowDirectConn bool, sessions *proxypkg.SessionPool) (p *proxy, err error) {
 	if len(name) == 0 {
 		return nil, fmt.Errorf("prxy: name can not be empty")
 	}
 	p = &proxy{
 		name:             name,
+		tenantID:         tenantID,
 		tenantEndpointID: tenantEndpointID,
+		protocol:         "tcp",
 		addresses:        make([]addressTuple, 0),
 		tcpMuxPort:       tcpMuxPort,
 		useTLS:           useTLS,
+		closing:          make(chan chan error),
 		listener:         listener,
 		allowDirectConn:  allowDirectConn,
+		sessions:         sessions,
 	}
 	p.newAddresses = make(chan []addressTuple, 2)
 	go p.listenAndproxy()
 	return p, nil
 }
 
+// newUDPProxy creates a new proxy object that relays datagrams received on
+// the packet connection.
+func newUDPProxy(name, tenantID, tenantEndpointID string, tcpMuxPort uint16, useTLS bool, packetConn net.PacketConn, allowDirectConn bool, sessions *proxypkg.SessionPool) (p *proxy, err error) {
+	if len(name) == 0 {
+		return nil, fmt.Errorf("prxy: name can not be empty")
+	}
+	p = &proxy{
+		name:             name,
+		tenantID:         tenantID,
+		tenantEndpointID: tenantEndpointID,
+		protocol:         "udp",
+		addresses:        make([]addressTuple, 0),
+		tcpMuxPort:       tcpMuxPort,
+		useTLS:           useTLS,
+		closing:          make(chan chan error),
+		packetConn:       packetConn,
+		allowDirectConn:  allowDirectConn,
+		sessions:         sessions,
+	}
+	p.newAddresses = make(chan []addressTuple, 2)
+	go p.listenAndproxyDatagrams()
+	return p, nil
+}
+
 // Name() returns the application name associated with the prxy
 func (p *proxy) Name() string {
 	return p.name
@@ -114,9 +150,17 @@ func (p *proxy) Name() string {
 
 // String() pretty prints the proxy struct.
 func (p *proxy) String() string {
+	if p.protocol == "udp" {
+		return fmt.Sprintf("proxy[%s; udp %s]=>%v", p.name, p.packetConn.LocalAddr(), p.addresses)
+	}
 	return fmt.Sprintf("proxy[%s; %s]=>%v", p.name, p.listener, p.addresses)
 }
 
+// Protocol() returns the protocol proxied, tcp or udp.
+func (p *proxy) Protocol() string {
+	return p.protocol
+}
+
 // TCPMuxPort() returns the tcp port use for muxing, 0 if not used.
 func (p *proxy) TCPMuxPort() uint16 {
 	return p.tcpMuxPort
@@ -140,7 +184,11 @@ func (p *proxy) SetNewAddresses(addresses []addressTuple) {
 
 // Close() terminates the prxy; it can not be restarted.
 func (p *proxy) Close() error {
-	p.listener.Close()
+	if p.protocol == "udp" {
+		p.packetConn.Close()
+	} else {
+		p.listener.Close()
+	}
 	errc := make(chan error)
 	p.closing <- errc
 	return <-errc
@@ -174,7 +222,10 @@ func (p *proxy) listenAndproxy() {
 			// round robin connections to list of addresses
 			glog.V(1).Infof("choosing address from %v", p.addresses)
 			go p.prxy(conn, p.addresses[i%len(p.addresses)])
-		case p.addresses = <-p.newAddresses:
+		case addresses := <-p.newAddresses:
+			p.mu.Lock()
+			p.addresses = addresses
+			p.mu.Unlock()
 		case errc := <-p.closing:
 			p.listener.Close()
 			errc <- nil
@@ -183,6 +234,38 @@ func (p *proxy) listenAndproxy() {
 	}
 }
 
+// listenAndproxyDatagrams relays the datagrams received on the prxy's udp
+// port. Each client address gets its own upstream connection, chosen round
+// robin from the list of addresses.
+func (p *proxy) listenAndproxyDatagrams() {
+	i := 0
+	dial := func() (net.Conn, error) {
+		p.mu.Lock()
+		if len(p.addresses) == 0 {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("no remote services available for prxying %s", p.name)
+		}
+		i++
+		address := p.addresses[i%len(p.addresses)]
+		p.mu.Unlock()
+		return p.dial(address)
+	}
+	go proxypkg.ServeDatagrams(p.packetConn, dial, proxypkg.DefaultDatagramTimeout)
+
+	for {
+		select {
+		case addresses := <-p.newAddresses:
+			p.mu.Lock()
+			p.addresses = addresses
+			p.mu.Unlock()
+		case errc := <-p.closing:
+			p.packetConn.Close()
+			errc <- nil
+			return
+		}
+	}
+}
+
 func getPort(addr string) (int, error) {
 	parts := strings.Split(addr, ":")
 	if len(parts) == 0 {
@@ -196,6 +279,34 @@ func getPort(addr string) (int, error) {
 // by the proxy structure and then copies data to and from the resulting pair
 // of endpoints.
 func (p *proxy) prxy(local net.Conn, address addressTuple) {
+	remote, err := p.dial(address)
+	if err != nil {
+		local.Close()
+		return
+	}
+
+	glog.V(2).Infof("Using hostAgent:%v to prxy %v<->%v<->%v<->%v",
+		remote.RemoteAddr(), local.LocalAddr(), local.RemoteAddr(), remote.LocalAddr(), address)
+	go func(address string) {
+		defer local.Close()
+		defer remote.Close()
+		io.Copy(local, remote)
+		glog.V(2).Infof("Closing hostAgent:%v to prxy %v<->%v<->%v<->%v",
+			remote.RemoteAddr(), local.LocalAddr(), local.RemoteAddr(), remote.LocalAddr(), address)
+	}(address.containerAddr)
+	go func(address string) {
+		defer local.Close()
+		defer remote.Close()
+		io.Copy(remote, local)
+		glog.V(2).Infof("closing hostAgent:%v to prxy %v<->%v<->%v<->%v",
+			remote.RemoteAddr(), local.LocalAddr(), local.RemoteAddr(), remote.LocalAddr(), address)
+	}(address.containerAddr)
+}
+
+// dial connects to the remote address, either directly to a container on
+// this host or through the mux on the remote host. Connections for udp
+// proxies preserve datagram boundaries.
+func (p *proxy) dial(address addressTuple) (net.Conn, error) {
 
 	var (
 		remote net.Conn
@@ -248,13 +359,24 @@ func (p *proxy) prxy(local net.Conn, address addressTuple) {
 		muxAddrPacked, err = utils.PackTCPAddressString(address.containerAddr)
 		if err != nil {
 			glog.Errorf("Container address is invalid. Can't create proxy: %s", address.containerAddr)
-			return
+			return nil, err
 		}
+
+		// Prefer a stream on the multiplexed session to the remote mux and
+		// fall back to a connection of our own if that isn't available.
+		if p.sessions != nil {
+			if remote, err = p.openStream(muxAddr, muxAddrPacked, address.application); err == nil {
+				return remote, nil
+			} else if err != proxypkg.ErrMultiplexUnsupported {
+				glog.Warningf("Could not open multiplexed stream to %s, using a new connection: %s", muxAddr, err)
+			}
+		}
+
 		select {
 		case token = <-auth.AuthToken(nil):
 		case <-time.After(tokenTimeout):
 			glog.Error("Unable to retrieve authentication token with 30 seconds")
-			return
+			return nil, fmt.Errorf("timeout retrieving authentication token")
 		}
 	}
 
@@ -263,18 +385,18 @@ func (p *proxy) prxy(local net.Conn, address addressTuple) {
 	switch {
 	case isLocalContainer:
 		glog.V(2).Infof("dialing local addr=> %s", localAddr)
-		remote, err = net.Dial("tcp4", localAddr)
+		remote, err = net.Dial(p.protocol+"4", localAddr)
 		if err != nil {
 			glog.Errorf("Error Local (net.Dial): %s", err)
-			return
+			return nil, err
 		}
+		return remote, nil
 	case p.useTLS:
 		glog.V(2).Infof("dialing remote tls => %s", muxAddr)
-		config := tls.Config{InsecureSkipVerify: true}
-		tlsConn, err := tls.Dial("tcp4", muxAddr, &config)
+		tlsConn, err := proxypkg.DialMuxTLS("tcp4", muxAddr)
 		if err != nil {
 			glog.Errorf("Error TLS (net.Dial): %s", err)
-			return
+			return nil, err
 		}
 		remote = tlsConn // cast it to the net.Conn interface
 		cipher := tlsConn.ConnectionState().CipherSuite
@@ -284,29 +406,86 @@ func (p *proxy) prxy(local net.Conn, address addressTuple) {
 		remote, err = net.Dial("tcp4", muxAddr)
 		if err != nil {
 			glog.Errorf("Error Remote (net.Dial): %s", err)
-			return
+			return nil, err
 		}
 	}
 
 	// If this is not a local container, write the mux header
 	if token != "" && len(muxAddrPacked) > 0 {
-		auth.AddSignedMuxHeader(remote, muxAddrPacked, token)
+		if err := auth.AddSignedMuxHeaderScope(remote, muxAddrPacked, p.protocol, p.tenantID, address.application, token); err != nil {
+			glog.Errorf("Unable to send authenticated mux header: %s", err)
+			remote.Close()
+			return nil, err
+		}
 	}
 
-	glog.V(2).Infof("Using hostAgent:%v to prxy %v<->%v<->%v<->%v",
-		remote.RemoteAddr(), local.LocalAddr(), local.RemoteAddr(), remote.LocalAddr(), address)
-	go func(address string) {
-		defer local.Close()
-		defer remote.Close()
-		io.Copy(local, remote)
-		glog.V(2).Infof("Closing hostAgent:%v to prxy %v<->%v<->%v<->%v",
-			remote.RemoteAddr(), local.LocalAddr(), local.RemoteAddr(), remote.LocalAddr(), address)
-	}(address.containerAddr)
-	go func(address string) {
-		defer local.Close()
-		defer remote.Close()
-		io.Copy(remote, local)
-		glog.V(2).Infof("closing hostAgent:%v to prxy %v<->%v<->%v<->%v",
-			remote.RemoteAddr(), local.LocalAddr(), local.RemoteAddr(), remote.LocalAddr(), address)
-	}(address.containerAddr)
+	if p.protocol == "udp" {
+		remote = proxypkg.NewDatagramConn(remote)
+	}
+	return remote, nil
+}
+
+// openStream opens a stream to the container address on the multiplexed
+// session to the remote mux.
+func (p *proxy) openStream(muxAddr string, muxAddrPacked []byte, application string) (net.Conn, error) {
+	header, err := auth.PackMuxAddressScope(muxAddrPacked, p.protocol, p.tenantID, application)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := p.sessions.Open(muxAddr, header)
+	if err != nil {
+		return nil, err
+	}
+	glog.V(2).Infof("Opened multiplexed stream to %s", muxAddr)
+	if p.protocol == "udp" {
+		return proxypkg.NewDatagramConn(stream), nil
+	}
+	return stream, nil
+}
+
+// signMuxSessionHeader signs a session header with the current token, which
+// the remote mux needs to keep the session open past the expiration of the
+// token it was started with.
+func signMuxSessionHeader() ([]byte, error) {
+	token, err := auth.AuthTokenNonBlocking()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := auth.AddSignedMuxSessionHeader(&buf, token); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// newMuxSessionDialer returns a dialer that connects to a remote mux and
+// asks it to start a multiplexed session.
+func newMuxSessionDialer(useTLS bool) proxypkg.SessionDialer {
+	return func(muxAddr string) (net.Conn, error) {
+		var token string
+		select {
+		case token = <-auth.AuthToken(nil):
+		case <-time.After(30 * time.Second):
+			return nil, fmt.Errorf("timeout retrieving authentication token")
+		}
+
+		var (
+			conn net.Conn
+			err  error
+		)
+		if useTLS {
+			conn, err = proxypkg.DialMuxTLS("tcp4", muxAddr)
+		} else {
+			conn, err = net.Dial("tcp4", muxAddr)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := auth.AddSignedMuxSessionHeader(conn, token); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
 }
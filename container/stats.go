@@ -145,3 +145,32 @@ func getOpenConnections(fileLoc string) (openConns int, err error) {
 	}
 	return openConns, scanner.Err()
 }
+
+// getEstablishedConnections returns the number of established connections
+// whose local port is one of the given ports.
+func getEstablishedConnections(fileLoc string, ports map[uint16]struct{}) (int, error) {
+	file, err := os.Open(fileLoc)
+	if err != nil {
+		return -1, err
+	}
+	defer file.Close()
+
+	conns := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // Skip the first line of headers
+	for scanner.Scan() {
+		splitString := strings.Fields(scanner.Text())
+		if len(splitString) < 4 || splitString[3] != "01" {
+			continue
+		}
+		addr := strings.Split(splitString[1], ":")
+		port, err := strconv.ParseUint(addr[len(addr)-1], 16, 16)
+		if err != nil {
+			continue
+		}
+		if _, ok := ports[uint16(port)]; ok {
+			conns++
+		}
+	}
+	return conns, scanner.Err()
+}
@@ -54,3 +54,22 @@ func TestGetOpenConnections(t *testing.T) {
 		t.Fatalf("expected 0 open connections, but got %d", conns)
 	}
 }
+
+func TestGetEstablishedConnections(t *testing.T) {
+	ports := map[uint16]struct{}{5672: {}, 4369: {}}
+	conns, err := getEstablishedConnections("testfiles/proc.net.tcp", ports)
+	if err != nil {
+		t.Fatalf("unexpected error reading procfile")
+	}
+	if conns != 3 {
+		t.Fatalf("expected 3 established connections, but got %d", conns)
+	}
+
+	conns, err = getEstablishedConnections("testfiles/proc.net.tcp", map[uint16]struct{}{80: {}})
+	if err != nil {
+		t.Fatalf("unexpected error reading procfile")
+	}
+	if conns != 0 {
+		t.Fatalf("expected 0 established connections, but got %d", conns)
+	}
+}
@@ -123,7 +123,8 @@ func (reg *VIFRegistry) RegisterVirtualAddress(address, toport, protocol string)
 		}
 		reg.vifs[host] = viface
 	}
-	switch strings.ToLower(protocol) {
+	protocol = strings.ToLower(protocol)
+	switch protocol {
 	case "tcp":
 		portmap = &viface.tcpPorts
 	case "udp":
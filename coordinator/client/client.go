@@ -14,6 +14,7 @@
 package client
 
 import (
+	"encoding/json"
 	"errors"
 	"strings"
 	"sync"
@@ -83,8 +84,17 @@ var (
 	ErrNothing                 = errors.New("coord-client: no server responsees to process")
 	ErrSessionMoved            = errors.New("coord-client: session moved to another server, so operation is ignored")
 	ErrNoServer                = errors.New("coord-client: could not connect to a server")
+	// ErrDeadlock is returned when a lock or lead is acquired twice on the same object
+	ErrDeadlock = errors.New("coord-client: trying to acquire a lock twice")
+	// ErrNotLocked is returned when a lock or lead that is not held is released
+	ErrNotLocked = errors.New("coord-client: not locked")
+	// ErrNoLeaderFound is returned when a leader has not been elected
+	ErrNoLeaderFound = errors.New("coord-client: no leader found")
 )
 
+// DefaultDriver is the driver of DSNs that do not name one
+const DefaultDriver = "zookeeper"
+
 var (
 	plog = logging.PackageLogger()
 )
@@ -125,6 +135,19 @@ func RegisterDriver(name string, driver Driver) {
 	registeredDrivers[name] = driver
 }
 
+// DriverName returns the name of the driver a DSN is for.  DSNs are JSON
+// objects that name their driver in the Driver field; DSNs without one are
+// for the default driver.
+func DriverName(dsn string) string {
+	var val struct {
+		Driver string
+	}
+	if err := json.Unmarshal([]byte(dsn), &val); err != nil || val.Driver == "" {
+		return DefaultDriver
+	}
+	return val.Driver
+}
+
 // newOpClientRequest create a client request object.
 func newOpClientRequest(reqType opClientRequestType, args interface{}) opClientRequest {
 	return opClientRequest{
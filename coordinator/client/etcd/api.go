@@ -0,0 +1,382 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The driver speaks the etcd v3 API through the JSON gateway that every etcd
+// server serves on its client urls.  Messages follow the protobuf JSON
+// mapping: 64-bit integers are strings and bytes are base64.
+
+var (
+	// errCompacted is returned when a watch starts at a revision that has
+	// been compacted
+	errCompacted = errors.New("etcd: revision has been compacted")
+	// errWatchCanceled is returned when the server cancels a watch
+	errWatchCanceled = errors.New("etcd: watch canceled by server")
+	// errNoEndpoint is returned when none of the endpoints answer
+	errNoEndpoint = errors.New("etcd: no endpoint could be reached")
+)
+
+// apiError is an error returned by the etcd server
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Err     string `json:"error"`
+}
+
+func (e *apiError) Error() string {
+	if e.Message != "" {
+		return "etcd: " + e.Message
+	}
+	return "etcd: " + e.Err
+}
+
+// jsonInt is a 64-bit integer that is encoded as a string
+type jsonInt int64
+
+func (i jsonInt) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(strconv.FormatInt(int64(i), 10))), nil
+}
+
+func (i *jsonInt) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
+	*i = jsonInt(v)
+	return err
+}
+
+// intp returns a pointer to an integer, so that zero values are encoded
+func intp(v int64) *jsonInt {
+	i := jsonInt(v)
+	return &i
+}
+
+type responseHeader struct {
+	Revision jsonInt `json:"revision"`
+}
+
+type keyValue struct {
+	Key            []byte  `json:"key"`
+	CreateRevision jsonInt `json:"create_revision"`
+	ModRevision    jsonInt `json:"mod_revision"`
+	Version        jsonInt `json:"version"`
+	Value          []byte  `json:"value"`
+	Lease          jsonInt `json:"lease"`
+}
+
+type rangeRequest struct {
+	Key       []byte `json:"key"`
+	RangeEnd  []byte `json:"range_end,omitempty"`
+	KeysOnly  bool   `json:"keys_only,omitempty"`
+	CountOnly bool   `json:"count_only,omitempty"`
+}
+
+type rangeResponse struct {
+	Header responseHeader `json:"header"`
+	Kvs    []keyValue     `json:"kvs"`
+	Count  jsonInt        `json:"count"`
+}
+
+type putRequest struct {
+	Key         []byte   `json:"key"`
+	Value       []byte   `json:"value"`
+	Lease       *jsonInt `json:"lease,omitempty"`
+	IgnoreLease bool     `json:"ignore_lease,omitempty"`
+}
+
+type deleteRangeRequest struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+}
+
+type deleteRangeResponse struct {
+	Header  responseHeader `json:"header"`
+	Deleted jsonInt        `json:"deleted"`
+}
+
+// Results and targets of a compare
+const (
+	compareEqual   = "EQUAL"
+	compareGreater = "GREATER"
+
+	targetVersion = "VERSION"
+	targetCreate  = "CREATE"
+	targetMod     = "MOD"
+)
+
+type compare struct {
+	Result         string   `json:"result"`
+	Target         string   `json:"target"`
+	Key            []byte   `json:"key"`
+	Version        *jsonInt `json:"version,omitempty"`
+	CreateRevision *jsonInt `json:"create_revision,omitempty"`
+	ModRevision    *jsonInt `json:"mod_revision,omitempty"`
+}
+
+type requestOp struct {
+	RequestRange       *rangeRequest       `json:"request_range,omitempty"`
+	RequestPut         *putRequest         `json:"request_put,omitempty"`
+	RequestDeleteRange *deleteRangeRequest `json:"request_delete_range,omitempty"`
+}
+
+type responseOp struct {
+	ResponseRange       *rangeResponse       `json:"response_range,omitempty"`
+	ResponseDeleteRange *deleteRangeResponse `json:"response_delete_range,omitempty"`
+}
+
+type txnRequest struct {
+	Compare []compare   `json:"compare,omitempty"`
+	Success []requestOp `json:"success,omitempty"`
+	Failure []requestOp `json:"failure,omitempty"`
+}
+
+type txnResponse struct {
+	Header    responseHeader `json:"header"`
+	Succeeded bool           `json:"succeeded"`
+	Responses []responseOp   `json:"responses"`
+}
+
+type leaseRequest struct {
+	TTL jsonInt `json:"TTL,omitempty"`
+	ID  jsonInt `json:"ID,omitempty"`
+}
+
+type leaseResponse struct {
+	ID  jsonInt `json:"ID"`
+	TTL jsonInt `json:"TTL"`
+}
+
+// Types of a watch event
+const (
+	eventPut    = "PUT"
+	eventDelete = "DELETE"
+)
+
+type watchCreateRequest struct {
+	Key           []byte  `json:"key"`
+	RangeEnd      []byte  `json:"range_end,omitempty"`
+	StartRevision jsonInt `json:"start_revision,omitempty"`
+}
+
+type watchRequest struct {
+	CreateRequest *watchCreateRequest `json:"create_request,omitempty"`
+}
+
+type event struct {
+	Type string   `json:"type"`
+	Kv   keyValue `json:"kv"`
+}
+
+type watchResponse struct {
+	Header          responseHeader `json:"header"`
+	Created         bool           `json:"created"`
+	Canceled        bool           `json:"canceled"`
+	CompactRevision jsonInt        `json:"compact_revision"`
+	Events          []event        `json:"events"`
+}
+
+// streamMessage is a message of a streaming call
+type streamMessage struct {
+	Result json.RawMessage `json:"result"`
+	Error  *apiError       `json:"error"`
+}
+
+// api is a client of the etcd JSON gateway
+type api struct {
+	sync.Mutex
+	endpoints []string
+	current   int
+	timeout   time.Duration
+	client    *http.Client
+}
+
+func newAPI(endpoints []string, dialTimeout, requestTimeout time.Duration) *api {
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		Dial:                (&net.Dialer{Timeout: dialTimeout}).Dial,
+		TLSHandshakeTimeout: dialTimeout,
+		MaxIdleConnsPerHost: 8,
+	}
+	return &api{
+		endpoints: endpoints,
+		timeout:   requestTimeout,
+		client:    &http.Client{Transport: transport},
+	}
+}
+
+// post sends a request to the first endpoint that answers
+func (a *api) post(ctx context.Context, method string, req interface{}) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	a.Lock()
+	start := a.current
+	a.Unlock()
+	for i := range a.endpoints {
+		n := (start + i) % len(a.endpoints)
+		hreq, err := http.NewRequest("POST", a.endpoints[n]+"/v3/"+method, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		hreq.Header.Set("Content-Type", "application/json")
+		resp, err := a.client.Do(hreq.WithContext(ctx))
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			plog.WithError(err).WithField("endpoint", a.endpoints[n]).Debug("Could not reach etcd endpoint")
+			continue
+		}
+		a.Lock()
+		a.current = n
+		a.Unlock()
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			e := &apiError{}
+			if err := json.NewDecoder(resp.Body).Decode(e); err != nil || (e.Message == "" && e.Err == "") {
+				e.Message = fmt.Sprintf("%s returned %s", method, resp.Status)
+			}
+			return nil, e
+		}
+		return resp, nil
+	}
+	return nil, errNoEndpoint
+}
+
+// call sends a request and decodes its response
+func (a *api) call(method string, req, resp interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	hresp, err := a.post(ctx, method, req)
+	if err != nil {
+		return err
+	}
+	defer hresp.Body.Close()
+	return json.NewDecoder(hresp.Body).Decode(resp)
+}
+
+func (a *api) kvRange(req *rangeRequest) (*rangeResponse, error) {
+	resp := &rangeResponse{}
+	err := a.call("kv/range", req, resp)
+	return resp, err
+}
+
+func (a *api) deleteRange(req *deleteRangeRequest) (*deleteRangeResponse, error) {
+	resp := &deleteRangeResponse{}
+	err := a.call("kv/deleterange", req, resp)
+	return resp, err
+}
+
+func (a *api) txn(req *txnRequest) (*txnResponse, error) {
+	resp := &txnResponse{}
+	err := a.call("kv/txn", req, resp)
+	return resp, err
+}
+
+func (a *api) grant(ttl time.Duration) (int64, error) {
+	resp := &leaseResponse{}
+	if err := a.call("lease/grant", &leaseRequest{TTL: jsonInt(ttl / time.Second)}, resp); err != nil {
+		return 0, err
+	}
+	return int64(resp.ID), nil
+}
+
+// keepAlive renews a lease and returns its remaining ttl; an expired lease
+// has no ttl
+func (a *api) keepAlive(id int64) (time.Duration, error) {
+	msg := &streamMessage{}
+	if err := a.call("lease/keepalive", &leaseRequest{ID: jsonInt(id)}, msg); err != nil {
+		return 0, err
+	} else if msg.Error != nil {
+		return 0, msg.Error
+	}
+	resp := &leaseResponse{}
+	if err := json.Unmarshal(msg.Result, resp); err != nil {
+		return 0, err
+	}
+	return time.Duration(resp.TTL) * time.Second, nil
+}
+
+func (a *api) revoke(id int64) error {
+	return a.call("lease/revoke", &leaseRequest{ID: jsonInt(id)}, &struct{}{})
+}
+
+// watch streams the events of a key range from a revision until match
+// accepts one.  Broken streams are resumed until the context is done.
+func (a *api) watch(ctx context.Context, key, end []byte, rev int64, match func(*event) bool) (*event, error) {
+	for {
+		ev, next, err := a.watchOnce(ctx, key, end, rev, match)
+		if ev != nil || err == errCompacted || ctx.Err() != nil {
+			return ev, err
+		}
+		plog.WithError(err).Debug("Watch interrupted, resuming")
+		rev = next
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (a *api) watchOnce(ctx context.Context, key, end []byte, rev int64, match func(*event) bool) (*event, int64, error) {
+	req := &watchRequest{CreateRequest: &watchCreateRequest{Key: key, RangeEnd: end, StartRevision: jsonInt(rev)}}
+	resp, err := a.post(ctx, "watch", req)
+	if err != nil {
+		return nil, rev, err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	for {
+		msg := &streamMessage{}
+		if err := dec.Decode(msg); err != nil {
+			return nil, rev, err
+		} else if msg.Error != nil {
+			return nil, rev, msg.Error
+		}
+		wresp := &watchResponse{}
+		if err := json.Unmarshal(msg.Result, wresp); err != nil {
+			return nil, rev, err
+		}
+		if wresp.Canceled {
+			if wresp.CompactRevision > 0 {
+				return nil, rev, errCompacted
+			}
+			return nil, rev, errWatchCanceled
+		}
+		for i := range wresp.Events {
+			ev := &wresp.Events[i]
+			if ev.Type == "" {
+				ev.Type = eventPut
+			}
+			if match(ev) {
+				return ev, rev, nil
+			}
+			rev = int64(ev.Kv.ModRevision) + 1
+		}
+	}
+}
@@ -0,0 +1,734 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/control-center/serviced/coordinator/client"
+)
+
+// minSessionTimeout is the shortest lease a connection holds
+const minSessionTimeout = 5 * time.Second
+
+// Nodes are stored under the prefix of the DSN.  The key of a node starts
+// with its depth, so that the children of a node are the keys of a single
+// range:
+//
+//	/serviced/n/002/a/b holds the node /a/b
+//	/serviced/s/a       holds the next sequence number of the children of /a
+
+// Stat is the version of a node.  Like a zookeeper stat, the version starts
+// at zero when the node is created and increments every time it is set.
+type Stat struct {
+	Version int64
+}
+
+// Connection is an etcd based implementation of client.Connection.
+type Connection struct {
+	sync.RWMutex
+	api      *api
+	prefix   string
+	basePath string
+	ttl      time.Duration
+	lease    int64
+	ctx      context.Context
+	cancel   context.CancelFunc
+	onClose  func(int)
+	id       int
+}
+
+// Assert that Connection implements client.Connection.
+var _ client.Connection = &Connection{}
+
+func newConnection(a *api, prefix, basePath string, ttl time.Duration) (*Connection, error) {
+	lease, err := a.grant(ttl)
+	if err != nil {
+		return nil, xlateError(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Connection{
+		api:      a,
+		prefix:   strings.TrimRight(prefix, "/"),
+		basePath: basePath,
+		ttl:      ttl,
+		lease:    lease,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	go c.keepAlive(a)
+	return c, nil
+}
+
+// keepAlive renews the lease of the connection.  If the lease expires, its
+// ephemeral nodes, locks and leads are gone, so the connection is closed
+// and its watches fire; callers must get a new connection and acquire them
+// again, as they do when a zookeeper session expires.
+func (c *Connection) keepAlive(a *api) {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(c.ttl / 3):
+		}
+		c.RLock()
+		lease := c.lease
+		c.RUnlock()
+		ttl, err := a.keepAlive(lease)
+		if err != nil {
+			plog.WithError(err).Warn("Could not renew etcd lease")
+			continue
+		} else if ttl > 0 {
+			continue
+		}
+		plog.WithError(client.ErrSessionExpired).Warn("etcd lease expired, closing the connection")
+		c.Close()
+		return
+	}
+}
+
+// IsClosed returns connection closed error if true, otherwise returns nil.
+func (c *Connection) isClosed() error {
+	if c.api == nil {
+		return client.ErrConnectionClosed
+	}
+	return nil
+}
+
+// withConn runs f while the connection is open
+func (c *Connection) withConn(f func() error) error {
+	c.RLock()
+	defer c.RUnlock()
+	if err := c.isClosed(); err != nil {
+		return err
+	}
+	return f()
+}
+
+// Close closes the client connection to etcd and revokes its lease. Calling
+// close twice will result in a no-op.
+func (c *Connection) Close() {
+	c.Lock()
+	defer c.Unlock()
+	if c.api != nil {
+		c.cancel()
+		if err := c.api.revoke(c.lease); err != nil {
+			plog.WithError(err).Debug("Could not revoke etcd lease")
+		}
+		c.api = nil
+		if c.onClose != nil {
+			c.onClose(c.id)
+			c.onClose = nil
+		}
+	}
+}
+
+// SetID sets the connection ID
+func (c *Connection) SetID(i int) {
+	c.Lock()
+	defer c.Unlock()
+	c.id = i
+}
+
+// ID gets the connection ID
+func (c *Connection) ID() int {
+	c.RLock()
+	defer c.RUnlock()
+	return c.id
+}
+
+// SetOnClose performs cleanup when a connection is closed
+func (c *Connection) SetOnClose(onClose func(int)) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.isClosed(); err == nil {
+		c.onClose = onClose
+	}
+}
+
+// NewTransaction creates a new transaction object
+func (c *Connection) NewTransaction() client.Transaction {
+	return &Transaction{
+		conn: c,
+		ops:  []multiReq{},
+	}
+}
+
+// NewLock creates a new lock object
+func (c *Connection) NewLock(p string) (client.Lock, error) {
+	c.RLock()
+	defer c.RUnlock()
+	if err := c.isClosed(); err != nil {
+		return nil, err
+	}
+	return &Lock{c: c, path: c.path(p)}, nil
+}
+
+// NewLeader returns a managed leader object at the given path bound to the
+// current connection.
+func (c *Connection) NewLeader(p string) (client.Leader, error) {
+	c.RLock()
+	defer c.RUnlock()
+	if err := c.isClosed(); err != nil {
+		return nil, err
+	}
+	return &Leader{c: c, path: c.path(p)}, nil
+}
+
+// path returns the absolute path of a node
+func (c *Connection) path(p string) string {
+	return path.Join("/", c.basePath, p)
+}
+
+// key returns the key of the node at an absolute path
+func (c *Connection) key(p string) []byte {
+	return []byte(fmt.Sprintf("%s/n/%03d%s", c.prefix, depth(p), p))
+}
+
+// childPrefix returns the prefix of the keys of the children of a node
+func (c *Connection) childPrefix(p string) []byte {
+	if p == "/" {
+		return []byte(fmt.Sprintf("%s/n/%03d/", c.prefix, 1))
+	}
+	return []byte(fmt.Sprintf("%s/n/%03d%s/", c.prefix, depth(p)+1, p))
+}
+
+// seqKey returns the key of the sequence number of the children of a node
+func (c *Connection) seqKey(p string) []byte {
+	return []byte(c.prefix + "/s" + p)
+}
+
+func depth(p string) int {
+	if p == "/" {
+		return 0
+	}
+	return strings.Count(p, "/")
+}
+
+// prefixEnd returns the end of the range of keys with a prefix
+func prefixEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return []byte{0}
+}
+
+func exists(key []byte) compare {
+	return compare{Result: compareGreater, Target: targetCreate, Key: key, CreateRevision: intp(0)}
+}
+
+func missing(key []byte) compare {
+	return compare{Result: compareEqual, Target: targetCreate, Key: key, CreateRevision: intp(0)}
+}
+
+// Create adds a node at the specified path
+func (c *Connection) Create(path string, node client.Node) error {
+	c.RLock()
+	defer c.RUnlock()
+	if err := c.isClosed(); err != nil {
+		return err
+	}
+	if err := c.ensurePath(c.path(path)); err != nil {
+		return err
+	}
+	return c.createNode(c.path(path), node)
+}
+
+// CreateIfExists adds a node at the specified path if the dirpath already
+// exists.
+func (c *Connection) CreateIfExists(path string, node client.Node) error {
+	c.RLock()
+	defer c.RUnlock()
+	if err := c.isClosed(); err != nil {
+		return err
+	}
+	return c.createNode(c.path(path), node)
+}
+
+func (c *Connection) createNode(p string, node client.Node) error {
+	bytes, err := json.Marshal(node)
+	if err != nil {
+		return client.ErrSerialization
+	}
+	if err := c.create(p, bytes, 0); err != nil {
+		return err
+	}
+	node.SetVersion(&Stat{})
+	return nil
+}
+
+// create adds a node if its parent exists
+func (c *Connection) create(p string, data []byte, lease int64) error {
+	if p == "/" {
+		return client.ErrNodeExists
+	}
+	key := c.key(p)
+	put := &putRequest{Key: key, Value: data}
+	if lease != 0 {
+		put.Lease = intp(lease)
+	}
+	req := &txnRequest{
+		Compare: []compare{missing(key)},
+		Success: []requestOp{{RequestPut: put}},
+		Failure: []requestOp{{RequestRange: &rangeRequest{Key: key, CountOnly: true}}},
+	}
+	if parent := path.Dir(p); parent != "/" {
+		req.Compare = append(req.Compare, exists(c.key(parent)))
+	}
+	resp, err := c.api.txn(req)
+	if err != nil {
+		return xlateError(err)
+	} else if !resp.Succeeded {
+		if len(resp.Responses) > 0 && resp.Responses[0].ResponseRange != nil && resp.Responses[0].ResponseRange.Count > 0 {
+			return client.ErrNodeExists
+		}
+		return client.ErrNoNode
+	}
+	return nil
+}
+
+// CreateDir adds a dir at the specified path
+func (c *Connection) CreateDir(path string) error {
+	c.RLock()
+	defer c.RUnlock()
+	if err := c.isClosed(); err != nil {
+		return err
+	}
+	if err := c.ensurePath(c.path(path)); err != nil {
+		return err
+	}
+	return c.create(c.path(path), []byte{}, 0)
+}
+
+// ensurePath creates the parents of a node that do not exist
+func (c *Connection) ensurePath(p string) error {
+	if p == "/" {
+		return nil
+	}
+	dp := path.Dir(p)
+	if ok, _, err := c.exists(dp); err != nil {
+		return err
+	} else if ok {
+		return nil
+	}
+	if err := c.ensurePath(dp); err != nil {
+		return err
+	} else if err := c.create(dp, []byte{}, 0); err != client.ErrNodeExists {
+		return err
+	}
+	return nil
+}
+
+// CreateEphemeral creates a node whose existance depends on the persistence of
+// the connection.
+func (c *Connection) CreateEphemeral(path string, node client.Node) (string, error) {
+	c.RLock()
+	defer c.RUnlock()
+	if err := c.isClosed(); err != nil {
+		return "", err
+	}
+	if err := c.ensurePath(c.path(path)); err != nil {
+		return "", err
+	}
+	return c.createEphemeralNode(c.path(path), node)
+}
+
+// CreateEphemeralIfExists creates an ephemeral node at the given path if it
+// exists.
+func (c *Connection) CreateEphemeralIfExists(path string, node client.Node) (string, error) {
+	c.RLock()
+	defer c.RUnlock()
+	if err := c.isClosed(); err != nil {
+		return "", err
+	}
+	return c.createEphemeralNode(c.path(path), node)
+}
+
+func (c *Connection) createEphemeralNode(p string, node client.Node) (string, error) {
+	bytes, err := json.Marshal(node)
+	if err != nil {
+		return "", client.ErrSerialization
+	}
+	return c.createEphemeral(p, bytes)
+}
+
+// createEphemeral creates a node attached to the lease of the connection.
+// Like the protected ephemeral sequential nodes of zookeeper, the name is
+// prefixed with a guid and suffixed with the next sequence number of the
+// parent.
+func (c *Connection) createEphemeral(p string, data []byte) (string, error) {
+	dir, base := path.Split(p)
+	parent := path.Clean(dir)
+	seqKey := c.seqKey(parent)
+	guid, err := newGUID()
+	if err != nil {
+		return "", err
+	}
+	for {
+		resp, err := c.api.kvRange(&rangeRequest{Key: seqKey})
+		if err != nil {
+			return "", xlateError(err)
+		}
+		var seq int64
+		cmp := missing(seqKey)
+		if len(resp.Kvs) > 0 {
+			if seq, err = strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64); err != nil {
+				return "", client.ErrSerialization
+			}
+			cmp = compare{Result: compareEqual, Target: targetMod, Key: seqKey, ModRevision: intp(int64(resp.Kvs[0].ModRevision))}
+		}
+		name := fmt.Sprintf("%s_c_%s-%s%010d", dir, guid, base, seq)
+		req := &txnRequest{
+			Compare: []compare{cmp},
+			Success: []requestOp{
+				{RequestPut: &putRequest{Key: seqKey, Value: []byte(strconv.FormatInt(seq+1, 10))}},
+				{RequestPut: &putRequest{Key: c.key(name), Value: data, Lease: intp(c.lease)}},
+			},
+		}
+		if parent != "/" {
+			req.Compare = append(req.Compare, exists(c.key(parent)))
+			req.Failure = []requestOp{{RequestRange: &rangeRequest{Key: c.key(parent), CountOnly: true}}}
+		}
+		tresp, err := c.api.txn(req)
+		if err != nil {
+			return "", xlateError(err)
+		} else if tresp.Succeeded {
+			return name, nil
+		} else if parent != "/" && (len(tresp.Responses) == 0 || tresp.Responses[0].ResponseRange == nil || tresp.Responses[0].ResponseRange.Count == 0) {
+			return "", client.ErrNoNode
+		}
+		// another node took the sequence number, so try the next one
+	}
+}
+
+func newGUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Set assigns a value to an existing node at a given path
+func (c *Connection) Set(path string, node client.Node) error {
+	c.RLock()
+	defer c.RUnlock()
+	if err := c.isClosed(); err != nil {
+		return err
+	}
+	return c.set(c.path(path), node)
+}
+
+func (c *Connection) set(p string, node client.Node) error {
+	bytes, err := json.Marshal(node)
+	if err != nil {
+		return client.ErrSerialization
+	}
+	stat := &Stat{}
+	if version := node.Version(); version != nil {
+		var ok bool
+		if stat, ok = version.(*Stat); !ok {
+			return client.ErrInvalidVersionObj
+		}
+	}
+	key := c.key(p)
+	resp, err := c.api.txn(&txnRequest{
+		Compare: []compare{{Result: compareEqual, Target: targetVersion, Key: key, Version: intp(stat.Version + 1)}},
+		Success: []requestOp{{RequestPut: &putRequest{Key: key, Value: bytes, IgnoreLease: true}}},
+		Failure: []requestOp{{RequestRange: &rangeRequest{Key: key, CountOnly: true}}},
+	})
+	if err != nil {
+		return xlateError(err)
+	} else if !resp.Succeeded {
+		if len(resp.Responses) > 0 && resp.Responses[0].ResponseRange != nil && resp.Responses[0].ResponseRange.Count > 0 {
+			return client.ErrBadVersion
+		}
+		return client.ErrNoNode
+	}
+	return nil
+}
+
+// Delete recursively removes a path and its children
+func (c *Connection) Delete(path string) error {
+	c.RLock()
+	defer c.RUnlock()
+	if err := c.isClosed(); err != nil {
+		return err
+	}
+	return c.delete(c.path(path))
+}
+
+func (c *Connection) delete(p string) error {
+	children, _, err := c.children(p)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := c.delete(path.Join(p, child)); err != nil {
+			return err
+		}
+	}
+	if p == "/" {
+		return nil
+	}
+	key := c.key(p)
+	resp, err := c.api.txn(&txnRequest{
+		Compare: []compare{exists(key)},
+		Success: []requestOp{
+			{RequestDeleteRange: &deleteRangeRequest{Key: key}},
+			{RequestDeleteRange: &deleteRangeRequest{Key: c.seqKey(p)}},
+		},
+	})
+	if err != nil {
+		return xlateError(err)
+	} else if !resp.Succeeded {
+		return client.ErrNoNode
+	}
+	return nil
+}
+
+// Exists returns true if the path exists
+func (c *Connection) Exists(path string) (bool, error) {
+	c.RLock()
+	defer c.RUnlock()
+	if err := c.isClosed(); err != nil {
+		return false, err
+	}
+	ok, _, err := c.exists(c.path(path))
+	return ok, err
+}
+
+// exists returns true if the node exists, and the revision it was checked at
+func (c *Connection) exists(p string) (bool, int64, error) {
+	resp, err := c.api.kvRange(&rangeRequest{Key: c.key(p), CountOnly: true})
+	if err != nil {
+		return false, 0, xlateError(err)
+	}
+	return p == "/" || resp.Count > 0, int64(resp.Header.Revision), nil
+}
+
+// ExistsW sets a watch on a node and alerts whenever it is added or removed.
+func (c *Connection) ExistsW(path string, cancel <-chan struct{}) (bool, <-chan client.Event, error) {
+	c.RLock()
+	defer c.RUnlock()
+	if err := c.isClosed(); err != nil {
+		return false, nil, err
+	}
+	return c.existsW(c.path(path), cancel)
+}
+
+func (c *Connection) existsW(p string, cancel <-chan struct{}) (bool, <-chan client.Event, error) {
+	ok, rev, err := c.exists(p)
+	if err != nil {
+		return false, nil, err
+	}
+	return ok, c.watch(rev, cancel, watchRange{key: c.key(p), match: nodeEvent}), nil
+}
+
+// Get returns the node at the given path.
+func (c *Connection) Get(path string, node client.Node) error {
+	c.RLock()
+	defer c.RUnlock()
+	if err := c.isClosed(); err != nil {
+		return err
+	}
+	_, err := c.get(c.path(path), node)
+	return err
+}
+
+func (c *Connection) get(p string, node client.Node) (int64, error) {
+	resp, err := c.api.kvRange(&rangeRequest{Key: c.key(p)})
+	if err != nil {
+		return 0, xlateError(err)
+	} else if len(resp.Kvs) == 0 {
+		return 0, client.ErrNoNode
+	}
+	kv := resp.Kvs[0]
+	if len(kv.Value) > 0 {
+		if err := json.Unmarshal(kv.Value, node); err != nil {
+			return 0, client.ErrSerialization
+		}
+	} else {
+		err = client.ErrEmptyNode
+	}
+	node.SetVersion(&Stat{Version: int64(kv.Version) - 1})
+	return int64(resp.Header.Revision), err
+}
+
+// GetW returns the node at the given path as well as a channel to watch for
+// events on that node.
+func (c *Connection) GetW(path string, node client.Node, cancel <-chan struct{}) (<-chan client.Event, error) {
+	c.RLock()
+	defer c.RUnlock()
+	if err := c.isClosed(); err != nil {
+		return nil, err
+	}
+	return c.getW(c.path(path), node, cancel)
+}
+
+func (c *Connection) getW(p string, node client.Node, cancel <-chan struct{}) (<-chan client.Event, error) {
+	rev, err := c.get(p, node)
+	if err != nil {
+		return nil, err
+	}
+	return c.watch(rev, cancel, watchRange{key: c.key(p), match: nodeEvent}), nil
+}
+
+// Children returns the children of the node at the given path.
+func (c *Connection) Children(path string) ([]string, error) {
+	c.RLock()
+	defer c.RUnlock()
+	if err := c.isClosed(); err != nil {
+		return []string{}, err
+	}
+	children, _, err := c.children(c.path(path))
+	return children, err
+}
+
+// children returns the names of the children of a node, and the revision
+// they were listed at
+func (c *Connection) children(p string) ([]string, int64, error) {
+	prefix := c.childPrefix(p)
+	resp, err := c.api.txn(&txnRequest{
+		Success: []requestOp{
+			{RequestRange: &rangeRequest{Key: c.key(p), CountOnly: true}},
+			{RequestRange: &rangeRequest{Key: prefix, RangeEnd: prefixEnd(prefix), KeysOnly: true}},
+		},
+	})
+	if err != nil {
+		return []string{}, 0, xlateError(err)
+	} else if len(resp.Responses) != 2 || resp.Responses[0].ResponseRange == nil || resp.Responses[1].ResponseRange == nil {
+		return []string{}, 0, client.ErrAPIError
+	} else if p != "/" && resp.Responses[0].ResponseRange.Count == 0 {
+		return []string{}, 0, client.ErrNoNode
+	}
+	children := []string{}
+	for _, kv := range resp.Responses[1].ResponseRange.Kvs {
+		children = append(children, strings.TrimPrefix(string(kv.Key), string(prefix)))
+	}
+	return children, int64(resp.Header.Revision), nil
+}
+
+// ChildrenW returns the children of the node at the given path as well as a
+// channel to watch for events on that node.
+func (c *Connection) ChildrenW(path string, cancel <-chan struct{}) ([]string, <-chan client.Event, error) {
+	c.RLock()
+	defer c.RUnlock()
+	if err := c.isClosed(); err != nil {
+		return []string{}, nil, err
+	}
+	return c.childrenW(c.path(path), cancel)
+}
+
+func (c *Connection) childrenW(p string, cancel <-chan struct{}) ([]string, <-chan client.Event, error) {
+	children, rev, err := c.children(p)
+	if err != nil {
+		return []string{}, nil, err
+	}
+	prefix := c.childPrefix(p)
+	ev := c.watch(rev, cancel,
+		watchRange{key: prefix, end: prefixEnd(prefix), match: childEvent},
+		watchRange{key: c.key(p), match: deleteEvent},
+	)
+	return children, ev, nil
+}
+
+// watchRange is a range of keys to watch and the events that fire the watch
+type watchRange struct {
+	key   []byte
+	end   []byte
+	match func(*event) (client.EventType, bool)
+}
+
+// nodeEvent fires on any change to a node
+func nodeEvent(ev *event) (client.EventType, bool) {
+	if ev.Type == eventDelete {
+		return client.EventNodeDeleted, true
+	} else if ev.Kv.Version == 1 {
+		return client.EventNodeCreated, true
+	}
+	return client.EventNodeDataChanged, true
+}
+
+// childEvent fires when a child is added or removed
+func childEvent(ev *event) (client.EventType, bool) {
+	return client.EventNodeChildrenChanged, ev.Type == eventDelete || ev.Kv.Version == 1
+}
+
+// deleteEvent fires when a node is removed
+func deleteEvent(ev *event) (client.EventType, bool) {
+	return client.EventNodeDeleted, ev.Type == eventDelete
+}
+
+// watch returns a channel that receives the first event after a revision
+// that matches one of the ranges.  Like a zookeeper watch, it fires once.
+func (c *Connection) watch(rev int64, cancel <-chan struct{}, ranges ...watchRange) <-chan client.Event {
+	evCh := make(chan client.Event, 1)
+	ctx, stop := context.WithCancel(c.ctx)
+	found := make(chan client.Event, len(ranges))
+	a := c.api
+	for _, r := range ranges {
+		go func(r watchRange) {
+			var typ client.EventType
+			_, err := a.watch(ctx, r.key, r.end, rev+1, func(ev *event) bool {
+				var ok bool
+				typ, ok = r.match(ev)
+				return ok
+			})
+			if err == nil {
+				found <- client.Event{Type: typ}
+			} else if ctx.Err() == nil {
+				found <- client.Event{Type: client.EventNotWatching, Err: xlateError(err)}
+			}
+		}(r)
+	}
+	go func() {
+		defer stop()
+		var ev client.Event
+		select {
+		case ev = <-found:
+		case <-c.ctx.Done():
+			ev = client.Event{Type: client.EventNotWatching, Err: client.ErrConnectionClosed}
+		case <-cancel:
+			return
+		}
+		select {
+		case evCh <- ev:
+		case <-cancel:
+		}
+	}()
+	return evCh
+}
+
+func xlateError(err error) error {
+	switch err {
+	case errNoEndpoint, context.DeadlineExceeded:
+		return client.ErrNoServer
+	}
+	return err
+}
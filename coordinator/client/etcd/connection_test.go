@@ -0,0 +1,439 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package etcd
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/control-center/serviced/coordinator/client"
+)
+
+type testNode struct {
+	Name    string
+	version interface{}
+}
+
+func (n *testNode) Version() interface{}           { return n.version }
+func (n *testNode) SetVersion(version interface{}) { n.version = version }
+
+func newTestConnection(t *testing.T, basePath string) (*fakeGateway, *Connection, func()) {
+	g, srv := newFakeGateway()
+	dsn := NewDSN([]string{srv.URL}, time.Minute, time.Second).String()
+	conn, err := (&Driver{}).GetConnection(dsn, basePath)
+	if err != nil {
+		srv.Close()
+		t.Fatalf("Could not connect: %s", err)
+	}
+	return g, conn.(*Connection), func() {
+		conn.Close()
+		srv.Close()
+	}
+}
+
+func TestDSN(t *testing.T) {
+	dsn := NewDSN([]string{"10.0.0.1:2379", "https://10.0.0.2:2379/"}, time.Second, time.Second)
+	if dsn.Endpoints[0] != "http://10.0.0.1:2379" || dsn.Endpoints[1] != "https://10.0.0.2:2379" {
+		t.Errorf("Unexpected endpoints: %v", dsn.Endpoints)
+	}
+	if name := client.DriverName(dsn.String()); name != DriverName {
+		t.Errorf("Expected driver %s, got %s", DriverName, name)
+	}
+	parsed, err := ParseDSN(dsn.String())
+	if err != nil {
+		t.Fatalf("Could not parse dsn: %s", err)
+	}
+	if parsed.SessionTimeout != minSessionTimeout {
+		t.Errorf("Expected session timeout %s, got %s", minSessionTimeout, parsed.SessionTimeout)
+	}
+	if _, err := ParseDSN(`{"Driver":"zookeeper"}`); err != client.ErrInvalidDSN {
+		t.Errorf("Expected %s, got %v", client.ErrInvalidDSN, err)
+	}
+	if name := client.DriverName(`{"Servers":["127.0.0.1:2181"]}`); name != client.DefaultDriver {
+		t.Errorf("Expected driver %s, got %s", client.DefaultDriver, name)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	c := &Connection{prefix: "/serviced"}
+	if key := string(c.key("/")); key != "/serviced/n/000/" {
+		t.Errorf("Unexpected key: %s", key)
+	}
+	if key := string(c.key("/a/b")); key != "/serviced/n/002/a/b" {
+		t.Errorf("Unexpected key: %s", key)
+	}
+	if prefix := string(c.childPrefix("/")); prefix != "/serviced/n/001/" {
+		t.Errorf("Unexpected prefix: %s", prefix)
+	}
+	if prefix := string(c.childPrefix("/a/b")); prefix != "/serviced/n/003/a/b/" {
+		t.Errorf("Unexpected prefix: %s", prefix)
+	}
+	if end := string(prefixEnd([]byte("/a/"))); end != "/a0" {
+		t.Errorf("Unexpected range end: %s", end)
+	}
+}
+
+func TestConnection(t *testing.T) {
+	_, conn, done := newTestConnection(t, "/base")
+	defer done()
+
+	node := &testNode{Name: "node"}
+	if err := conn.Create("/a/b", node); err != nil {
+		t.Fatalf("Could not create node: %s", err)
+	}
+	if err := conn.Create("/a/b", &testNode{}); err != client.ErrNodeExists {
+		t.Errorf("Expected %s, got %v", client.ErrNodeExists, err)
+	}
+	if err := conn.CreateIfExists("/x/y", &testNode{}); err != client.ErrNoNode {
+		t.Errorf("Expected %s, got %v", client.ErrNoNode, err)
+	}
+	if ok, err := conn.Exists("/a"); err != nil || !ok {
+		t.Errorf("Expected parent to exist: %v", err)
+	}
+
+	// a parent without data is empty
+	if err := conn.Get("/a", &testNode{}); err != client.ErrEmptyNode {
+		t.Errorf("Expected %s, got %v", client.ErrEmptyNode, err)
+	}
+
+	got := &testNode{}
+	if err := conn.Get("/a/b", got); err != nil {
+		t.Fatalf("Could not get node: %s", err)
+	} else if got.Name != "node" {
+		t.Errorf("Unexpected node: %+v", got)
+	}
+	got.Name = "changed"
+	if err := conn.Set("/a/b", got); err != nil {
+		t.Fatalf("Could not set node: %s", err)
+	}
+	// the version of the node is stale now
+	if err := conn.Set("/a/b", got); err != client.ErrBadVersion {
+		t.Errorf("Expected %s, got %v", client.ErrBadVersion, err)
+	}
+	if err := conn.Get("/a/b", got); err != nil {
+		t.Fatalf("Could not get node: %s", err)
+	} else if got.Name != "changed" || got.Version().(*Stat).Version != 1 {
+		t.Errorf("Unexpected node: %+v %+v", got, got.Version())
+	}
+	if err := conn.Set("/a/c", &testNode{}); err != client.ErrNoNode {
+		t.Errorf("Expected %s, got %v", client.ErrNoNode, err)
+	}
+
+	if err := conn.CreateDir("/a/c/d"); err != nil {
+		t.Fatalf("Could not create dir: %s", err)
+	}
+	children, err := conn.Children("/a")
+	if err != nil {
+		t.Fatalf("Could not get children: %s", err)
+	}
+	sort.Strings(children)
+	if strings.Join(children, ",") != "b,c" {
+		t.Errorf("Unexpected children: %v", children)
+	}
+	if _, err := conn.Children("/x"); err != client.ErrNoNode {
+		t.Errorf("Expected %s, got %v", client.ErrNoNode, err)
+	}
+
+	if err := conn.Delete("/a"); err != nil {
+		t.Fatalf("Could not delete node: %s", err)
+	}
+	for _, p := range []string{"/a", "/a/b", "/a/c/d"} {
+		if ok, err := conn.Exists(p); err != nil || ok {
+			t.Errorf("Expected %s to be deleted: %v", p, err)
+		}
+	}
+	if err := conn.Delete("/a"); err != client.ErrNoNode {
+		t.Errorf("Expected %s, got %v", client.ErrNoNode, err)
+	}
+
+	conn.Close()
+	if err := conn.Create("/a", &testNode{}); err != client.ErrConnectionClosed {
+		t.Errorf("Expected %s, got %v", client.ErrConnectionClosed, err)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	_, conn, done := newTestConnection(t, "")
+	defer done()
+
+	a, b := &testNode{Name: "a"}, &testNode{Name: "b"}
+	if err := conn.NewTransaction().Create("/a", a).Create("/a/b", b).Commit(); err != nil {
+		t.Fatalf("Could not commit transaction: %s", err)
+	}
+	if a.Version() == nil || b.Version() == nil {
+		t.Errorf("Expected versions to be set")
+	}
+	a.Name, b.Name = "a2", "b2"
+	if err := conn.NewTransaction().Set("/a", a).Set("/a/b", b).Commit(); err != nil {
+		t.Fatalf("Could not commit transaction: %s", err)
+	}
+
+	// nothing is committed if any operation fails
+	err := conn.NewTransaction().Create("/c", &testNode{Name: "c"}).Set("/a", a).Commit()
+	if err != client.ErrBadVersion {
+		t.Errorf("Expected %s, got %v", client.ErrBadVersion, err)
+	}
+	if ok, _ := conn.Exists("/c"); ok {
+		t.Errorf("Expected /c not to be created")
+	}
+	if err := conn.NewTransaction().Create("/x/y", &testNode{}).Commit(); err != client.ErrNoNode {
+		t.Errorf("Expected %s, got %v", client.ErrNoNode, err)
+	}
+	if err := conn.NewTransaction().Create("/a", &testNode{}).Commit(); err != client.ErrNodeExists {
+		t.Errorf("Expected %s, got %v", client.ErrNodeExists, err)
+	}
+
+	if err := conn.NewTransaction().Delete("/a/b").Delete("/a").Commit(); err != nil {
+		t.Fatalf("Could not commit transaction: %s", err)
+	}
+	if ok, _ := conn.Exists("/a"); ok {
+		t.Errorf("Expected /a to be deleted")
+	}
+}
+
+func TestEphemeral(t *testing.T) {
+	g, conn, done := newTestConnection(t, "/base")
+	defer done()
+
+	p1, err := conn.CreateEphemeral("/eph/node-", &testNode{Name: "1"})
+	if err != nil {
+		t.Fatalf("Could not create ephemeral node: %s", err)
+	}
+	p2, err := conn.CreateEphemeral("/eph/node-", &testNode{Name: "2"})
+	if err != nil {
+		t.Fatalf("Could not create ephemeral node: %s", err)
+	}
+	if !strings.HasPrefix(p1, "/base/eph/_c_") || !strings.HasSuffix(p1, "-node-0000000000") {
+		t.Errorf("Unexpected path: %s", p1)
+	}
+	if !strings.HasSuffix(p2, "-node-0000000001") {
+		t.Errorf("Unexpected path: %s", p2)
+	}
+	if _, err := conn.CreateEphemeralIfExists("/x/node-", &testNode{}); err != client.ErrNoNode {
+		t.Errorf("Expected %s, got %v", client.ErrNoNode, err)
+	}
+
+	// ephemeral nodes are removed when the lease expires
+	conn.RLock()
+	lease := conn.lease
+	conn.RUnlock()
+	g.Lock()
+	g.expire(lease)
+	g.Unlock()
+	children, err := conn.Children("/eph")
+	if err != nil {
+		t.Fatalf("Could not get children: %s", err)
+	} else if len(children) != 0 {
+		t.Errorf("Expected no children, got %v", children)
+	}
+}
+
+func TestLeaseExpired(t *testing.T) {
+	g, srv := newFakeGateway()
+	defer srv.Close()
+	conn, err := newConnection(newAPI([]string{srv.URL}, time.Second, time.Second), "/serviced", "", 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Could not connect: %s", err)
+	}
+	defer conn.Close()
+
+	cancel := make(chan struct{})
+	defer close(cancel)
+	_, ev, err := conn.ExistsW("/x", cancel)
+	if err != nil {
+		t.Fatalf("Could not watch node: %s", err)
+	}
+
+	// the connection is closed when its lease is lost, instead of silently
+	// granting a new lease, so that callers acquire their locks again
+	g.Lock()
+	g.expire(conn.lease)
+	g.Unlock()
+	waitEvent(t, ev, client.EventNotWatching)
+	if _, err := conn.Exists("/x"); err != client.ErrConnectionClosed {
+		t.Errorf("Expected %s, got %v", client.ErrConnectionClosed, err)
+	}
+}
+
+func waitEvent(t *testing.T, ev <-chan client.Event, expected client.EventType) {
+	select {
+	case e := <-ev:
+		if e.Type != expected {
+			t.Errorf("Expected event %v, got %+v", expected, e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Timed out waiting for event %v", expected)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	_, conn, done := newTestConnection(t, "")
+	defer done()
+
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	ok, ev, err := conn.ExistsW("/w", cancel)
+	if err != nil || ok {
+		t.Fatalf("Unexpected exists: %v %v", ok, err)
+	}
+	if err := conn.Create("/w", &testNode{}); err != nil {
+		t.Fatalf("Could not create node: %s", err)
+	}
+	waitEvent(t, ev, client.EventNodeCreated)
+
+	node := &testNode{}
+	ev, err = conn.GetW("/w", node, cancel)
+	if err != nil {
+		t.Fatalf("Could not watch node: %s", err)
+	}
+	if err := conn.Set("/w", node); err != nil {
+		t.Fatalf("Could not set node: %s", err)
+	}
+	waitEvent(t, ev, client.EventNodeDataChanged)
+
+	_, ev, err = conn.ChildrenW("/w", cancel)
+	if err != nil {
+		t.Fatalf("Could not watch children: %s", err)
+	}
+	if err := conn.Set("/w", node); err == nil {
+		t.Fatalf("Expected a stale version")
+	}
+	if err := conn.CreateDir("/w/c"); err != nil {
+		t.Fatalf("Could not create child: %s", err)
+	}
+	waitEvent(t, ev, client.EventNodeChildrenChanged)
+
+	_, ev, err = conn.ChildrenW("/w", cancel)
+	if err != nil {
+		t.Fatalf("Could not watch children: %s", err)
+	}
+	if err := conn.Delete("/w/c"); err != nil {
+		t.Fatalf("Could not delete child: %s", err)
+	}
+	waitEvent(t, ev, client.EventNodeChildrenChanged)
+
+	ok, ev, err = conn.ExistsW("/w", cancel)
+	if err != nil || !ok {
+		t.Fatalf("Unexpected exists: %v %v", ok, err)
+	}
+	if err := conn.Delete("/w"); err != nil {
+		t.Fatalf("Could not delete node: %s", err)
+	}
+	waitEvent(t, ev, client.EventNodeDeleted)
+
+	// closing the connection stops the watch
+	_, ev, err = conn.ExistsW("/w", cancel)
+	if err != nil {
+		t.Fatalf("Could not watch node: %s", err)
+	}
+	conn.Close()
+	waitEvent(t, ev, client.EventNotWatching)
+}
+
+func TestLeader(t *testing.T) {
+	_, conn, done := newTestConnection(t, "/base")
+	defer done()
+
+	l1, _ := conn.NewLeader("/election")
+	l2, _ := conn.NewLeader("/election")
+	if err := l1.Current(&testNode{}); err != client.ErrNoNode {
+		t.Errorf("Expected %s, got %v", client.ErrNoNode, err)
+	}
+
+	cancel := make(chan struct{})
+	defer close(cancel)
+	if _, err := l1.TakeLead(&testNode{Name: "l1"}, cancel); err != nil {
+		t.Fatalf("Could not take lead: %s", err)
+	}
+	if _, err := l1.TakeLead(&testNode{Name: "l1"}, cancel); err != client.ErrDeadlock {
+		t.Errorf("Expected %s, got %v", client.ErrDeadlock, err)
+	}
+	current := &testNode{}
+	if err := l2.Current(current); err != nil || current.Name != "l1" {
+		t.Errorf("Unexpected leader %+v: %v", current, err)
+	}
+
+	led := make(chan struct{})
+	go func() {
+		defer close(led)
+		if _, err := l2.TakeLead(&testNode{Name: "l2"}, cancel); err != nil {
+			t.Errorf("Could not take lead: %s", err)
+		}
+	}()
+	select {
+	case <-led:
+		t.Fatalf("Took the lead while another leader was elected")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := l1.ReleaseLead(); err != nil {
+		t.Fatalf("Could not release lead: %s", err)
+	}
+	select {
+	case <-led:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for the lead")
+	}
+	if err := l1.Current(current); err != nil || current.Name != "l2" {
+		t.Errorf("Unexpected leader %+v: %v", current, err)
+	}
+	if err := l1.ReleaseLead(); err != client.ErrNotLocked {
+		t.Errorf("Expected %s, got %v", client.ErrNotLocked, err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	_, conn, done := newTestConnection(t, "")
+	defer done()
+
+	l1, _ := conn.NewLock("/locks/a")
+	l2, _ := conn.NewLock("/locks/a")
+	if err := l1.Lock(); err != nil {
+		t.Fatalf("Could not lock: %s", err)
+	}
+	locked := make(chan struct{})
+	go func() {
+		defer close(locked)
+		if err := l2.Lock(); err != nil {
+			t.Errorf("Could not lock: %s", err)
+		}
+	}()
+	select {
+	case <-locked:
+		t.Fatalf("Acquired a held lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := l1.Unlock(); err != nil {
+		t.Fatalf("Could not unlock: %s", err)
+	}
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for the lock")
+	}
+	if err := l2.Unlock(); err != nil {
+		t.Fatalf("Could not unlock: %s", err)
+	}
+	children, err := conn.Children("/locks/a")
+	if err != nil || len(children) != 0 {
+		t.Errorf("Unexpected lock nodes %v: %v", children, err)
+	}
+	if err := l1.Unlock(); err != client.ErrNotLocked {
+		t.Errorf("Expected %s, got %v", client.ErrNotLocked, err)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/control-center/serviced/coordinator/client"
+	"github.com/control-center/serviced/logging"
+)
+
+var (
+	plog = logging.PackageLogger() // the standard package logger
+)
+
+// DriverName is the name the etcd driver is registered with
+const DriverName = "etcd"
+
+// Driver implements an etcd v3 based client.Driver interface
+type Driver struct{}
+
+// Assert that the etcd driver meets the Driver interface
+var _ client.Driver = &Driver{}
+
+func init() {
+	client.RegisterDriver(DriverName, &Driver{})
+}
+
+// DSN is an etcd specific struct used for connections. It can be serialized.
+type DSN struct {
+	Driver         string
+	Endpoints      []string
+	Prefix         string
+	SessionTimeout time.Duration
+	DialTimeout    time.Duration
+	RequestTimeout time.Duration
+}
+
+// NewDSN returns a new DSN object from endpoints and timeouts.  Endpoints
+// without a scheme are reached over http.
+func NewDSN(endpoints []string, sessionTimeout, dialTimeout time.Duration) DSN {
+	dsn := DSN{
+		Driver:         DriverName,
+		Prefix:         "/serviced",
+		SessionTimeout: sessionTimeout,
+		DialTimeout:    dialTimeout,
+		RequestTimeout: 10 * time.Second,
+	}
+	for _, endpoint := range endpoints {
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+		dsn.Endpoints = append(dsn.Endpoints, strings.TrimRight(endpoint, "/"))
+	}
+	if len(dsn.Endpoints) == 0 {
+		dsn.Endpoints = []string{"http://127.0.0.1:2379"}
+	}
+	return dsn
+}
+
+// String creates a parsable (JSON) string represenation of this DSN.
+func (dsn DSN) String() string {
+	bytes, err := json.Marshal(dsn)
+	if err != nil {
+		panic(err)
+	}
+	return string(bytes)
+}
+
+// ParseDSN decodes a string (JSON) represnation of a DSN object.
+func ParseDSN(dsn string) (val DSN, err error) {
+	if err = json.Unmarshal([]byte(dsn), &val); err != nil {
+		return val, err
+	}
+	if val.Driver != DriverName || len(val.Endpoints) == 0 {
+		return val, client.ErrInvalidDSN
+	}
+	if val.SessionTimeout < minSessionTimeout {
+		val.SessionTimeout = minSessionTimeout
+	}
+	if val.RequestTimeout <= 0 {
+		val.RequestTimeout = 10 * time.Second
+	}
+	return val, nil
+}
+
+// GetConnection returns an etcd connection given the dsn. The caller is
+// responsible for closing the returned connection.  The connection holds a
+// lease for the session timeout that its ephemeral nodes are attached to.
+func (driver *Driver) GetConnection(dsn, basePath string) (client.Connection, error) {
+	dsnVal, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return newConnection(newAPI(dsnVal.Endpoints, dsnVal.DialTimeout, dsnVal.RequestTimeout), dsnVal.Prefix, basePath, dsnVal.SessionTimeout)
+}
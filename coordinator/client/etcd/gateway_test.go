@@ -0,0 +1,297 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package etcd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+)
+
+// fakeKV is a key stored by the fake gateway
+type fakeKV struct {
+	value   []byte
+	create  int64
+	mod     int64
+	version int64
+	lease   int64
+}
+
+// fakeGateway is an in-memory implementation of the parts of the etcd v3
+// JSON gateway that the driver uses.
+type fakeGateway struct {
+	sync.Mutex
+	rev     int64
+	kvs     map[string]*fakeKV
+	leases  map[int64]bool
+	lastID  int64
+	events  []event
+	changed chan struct{}
+}
+
+func newFakeGateway() (*fakeGateway, *httptest.Server) {
+	g := &fakeGateway{
+		rev:     1,
+		kvs:     make(map[string]*fakeKV),
+		leases:  make(map[int64]bool),
+		changed: make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/kv/range", g.handle(func() interface{} { return &rangeRequest{} }, func(req interface{}) interface{} {
+		return g.kvRange(req.(*rangeRequest))
+	}))
+	mux.HandleFunc("/v3/kv/deleterange", g.handle(func() interface{} { return &deleteRangeRequest{} }, func(req interface{}) interface{} {
+		g.rev++
+		resp := g.deleteRange(req.(*deleteRangeRequest))
+		g.notify()
+		return resp
+	}))
+	mux.HandleFunc("/v3/kv/txn", g.handle(func() interface{} { return &txnRequest{} }, func(req interface{}) interface{} {
+		return g.txn(req.(*txnRequest))
+	}))
+	mux.HandleFunc("/v3/lease/grant", g.handle(func() interface{} { return &leaseRequest{} }, func(req interface{}) interface{} {
+		g.lastID++
+		g.leases[g.lastID] = true
+		return &leaseResponse{ID: jsonInt(g.lastID), TTL: req.(*leaseRequest).TTL}
+	}))
+	mux.HandleFunc("/v3/lease/keepalive", g.handle(func() interface{} { return &leaseRequest{} }, func(req interface{}) interface{} {
+		resp := &leaseResponse{ID: req.(*leaseRequest).ID}
+		if g.leases[int64(resp.ID)] {
+			resp.TTL = 10
+		}
+		result, _ := json.Marshal(resp)
+		return &streamMessage{Result: result}
+	}))
+	mux.HandleFunc("/v3/lease/revoke", g.handle(func() interface{} { return &leaseRequest{} }, func(req interface{}) interface{} {
+		g.expire(int64(req.(*leaseRequest).ID))
+		return &struct{}{}
+	}))
+	mux.HandleFunc("/v3/watch", g.watch)
+	return g, httptest.NewServer(mux)
+}
+
+func (g *fakeGateway) handle(newReq func() interface{}, f func(interface{}) interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := newReq()
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		g.Lock()
+		resp := f(req)
+		g.Unlock()
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// expire deletes a lease and the keys attached to it
+func (g *fakeGateway) expire(id int64) {
+	delete(g.leases, id)
+	g.rev++
+	for k, kv := range g.kvs {
+		if kv.lease == id {
+			g.remove(k)
+		}
+	}
+	g.notify()
+}
+
+func (g *fakeGateway) notify() {
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+func inRange(k string, key, end []byte) bool {
+	if len(end) == 0 {
+		return k == string(key)
+	} else if string(end) == "\x00" {
+		return k >= string(key)
+	}
+	return k >= string(key) && k < string(end)
+}
+
+func (g *fakeGateway) keys(key, end []byte) []string {
+	var keys []string
+	for k := range g.kvs {
+		if inRange(k, key, end) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (g *fakeGateway) keyValue(k string) keyValue {
+	kv := g.kvs[k]
+	return keyValue{
+		Key:            []byte(k),
+		CreateRevision: jsonInt(kv.create),
+		ModRevision:    jsonInt(kv.mod),
+		Version:        jsonInt(kv.version),
+		Value:          kv.value,
+		Lease:          jsonInt(kv.lease),
+	}
+}
+
+func (g *fakeGateway) kvRange(req *rangeRequest) *rangeResponse {
+	resp := &rangeResponse{Header: responseHeader{Revision: jsonInt(g.rev)}}
+	for _, k := range g.keys(req.Key, req.RangeEnd) {
+		resp.Count++
+		if req.CountOnly {
+			continue
+		}
+		kv := g.keyValue(k)
+		if req.KeysOnly {
+			kv.Value = nil
+		}
+		resp.Kvs = append(resp.Kvs, kv)
+	}
+	return resp
+}
+
+func (g *fakeGateway) put(req *putRequest) {
+	kv, ok := g.kvs[string(req.Key)]
+	if !ok {
+		kv = &fakeKV{create: g.rev}
+		g.kvs[string(req.Key)] = kv
+	}
+	kv.value = req.Value
+	kv.mod = g.rev
+	kv.version++
+	if !req.IgnoreLease {
+		kv.lease = 0
+		if req.Lease != nil {
+			kv.lease = int64(*req.Lease)
+		}
+	}
+	g.events = append(g.events, event{Type: eventPut, Kv: g.keyValue(string(req.Key))})
+}
+
+func (g *fakeGateway) remove(k string) {
+	delete(g.kvs, k)
+	g.events = append(g.events, event{Type: eventDelete, Kv: keyValue{Key: []byte(k), ModRevision: jsonInt(g.rev)}})
+}
+
+func (g *fakeGateway) deleteRange(req *deleteRangeRequest) *deleteRangeResponse {
+	resp := &deleteRangeResponse{Header: responseHeader{Revision: jsonInt(g.rev)}}
+	for _, k := range g.keys(req.Key, req.RangeEnd) {
+		g.remove(k)
+		resp.Deleted++
+	}
+	return resp
+}
+
+func (g *fakeGateway) compare(c compare) bool {
+	var actual int64
+	var expected *jsonInt
+	kv := g.kvs[string(c.Key)]
+	if kv == nil {
+		kv = &fakeKV{}
+	}
+	switch c.Target {
+	case targetVersion:
+		actual, expected = kv.version, c.Version
+	case targetCreate:
+		actual, expected = kv.create, c.CreateRevision
+	case targetMod:
+		actual, expected = kv.mod, c.ModRevision
+	}
+	var value int64
+	if expected != nil {
+		value = int64(*expected)
+	}
+	switch c.Result {
+	case compareGreater:
+		return actual > value
+	case "", compareEqual:
+		return actual == value
+	}
+	return false
+}
+
+func (g *fakeGateway) txn(req *txnRequest) *txnResponse {
+	resp := &txnResponse{Succeeded: true}
+	for _, c := range req.Compare {
+		if !g.compare(c) {
+			resp.Succeeded = false
+			break
+		}
+	}
+	ops := req.Success
+	if !resp.Succeeded {
+		ops = req.Failure
+	}
+	for _, op := range ops {
+		if op.RequestPut != nil || op.RequestDeleteRange != nil {
+			g.rev++
+			defer g.notify()
+			break
+		}
+	}
+	for _, op := range ops {
+		switch {
+		case op.RequestRange != nil:
+			resp.Responses = append(resp.Responses, responseOp{ResponseRange: g.kvRange(op.RequestRange)})
+		case op.RequestPut != nil:
+			g.put(op.RequestPut)
+			resp.Responses = append(resp.Responses, responseOp{})
+		case op.RequestDeleteRange != nil:
+			resp.Responses = append(resp.Responses, responseOp{ResponseDeleteRange: g.deleteRange(op.RequestDeleteRange)})
+		}
+	}
+	resp.Header.Revision = jsonInt(g.rev)
+	return resp
+}
+
+// watch streams the events of a range from the start revision
+func (g *fakeGateway) watch(w http.ResponseWriter, r *http.Request) {
+	req := &watchRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.CreateRequest == nil {
+		http.Error(w, "bad watch request", http.StatusBadRequest)
+		return
+	}
+	cr := req.CreateRequest
+	enc := json.NewEncoder(w)
+	send := func(resp *watchResponse) {
+		result, _ := json.Marshal(resp)
+		enc.Encode(&streamMessage{Result: result})
+		w.(http.Flusher).Flush()
+	}
+	send(&watchResponse{Created: true})
+	rev := int64(cr.StartRevision)
+	for {
+		g.Lock()
+		resp := &watchResponse{Header: responseHeader{Revision: jsonInt(g.rev)}}
+		for _, ev := range g.events {
+			if int64(ev.Kv.ModRevision) >= rev && inRange(string(ev.Kv.Key), cr.Key, cr.RangeEnd) {
+				resp.Events = append(resp.Events, ev)
+			}
+		}
+		rev = g.rev + 1
+		changed := g.changed
+		g.Unlock()
+		if len(resp.Events) > 0 {
+			send(resp)
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
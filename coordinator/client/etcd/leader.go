@@ -0,0 +1,159 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"encoding/json"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/control-center/serviced/coordinator/client"
+)
+
+// Leader is an object to facilitate creating an election in etcd.  It
+// follows the same recipe as the zookeeper leader, so that both drivers
+// elect the node with the lowest sequence number.
+type Leader struct {
+	c        *Connection
+	path     string
+	lockPath string
+}
+
+// Current returns the currect elected leader and deserializes it in to node.
+// It will return ErrNoLeaderFound if no leader has been elected.
+func (l *Leader) Current(node client.Node) error {
+	return l.c.withConn(func() error {
+		leader, _, err := l.getLowestSequence()
+		if err != nil {
+			return err
+		}
+		_, err = l.c.get(leader, node)
+		return err
+	})
+}
+
+// TakeLead attempts to aquire the leader role. When aquired it returns a
+// channel on the leader node so the caller can react to changes in etcd
+func (l *Leader) TakeLead(node client.Node, cancel <-chan struct{}) (<-chan client.Event, error) {
+	if l.lockPath != "" {
+		return nil, client.ErrDeadlock
+	}
+	bytes, err := json.Marshal(node)
+	if err != nil {
+		return nil, client.ErrSerialization
+	}
+	prefix := path.Join(l.path, "leader-")
+	if err := l.c.withConn(func() (err error) {
+		if err = l.c.ensurePath(prefix); err != nil {
+			return
+		}
+		l.lockPath, err = l.c.createEphemeral(prefix, bytes)
+		return
+	}); err != nil {
+		return nil, err
+	}
+	lockSeq, err := parseSeq(l.lockPath)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var (
+			leader string
+			seq    uint64
+			ok     bool
+			ev     <-chan client.Event
+		)
+		done := make(chan struct{})
+		if err := l.c.withConn(func() (err error) {
+			if leader, seq, err = l.getLowestSequence(); err != nil {
+				return
+			}
+			ok, ev, err = l.c.existsW(leader, done)
+			return
+		}); err != nil {
+			close(done)
+			return nil, err
+		} else if !ok {
+			close(done)
+			continue
+		}
+		if leader == l.lockPath {
+			// watch the leader node until the caller cancels
+			close(done)
+			if err := l.c.withConn(func() (err error) {
+				ok, ev, err = l.c.existsW(leader, cancel)
+				return
+			}); err != nil {
+				return nil, err
+			} else if !ok {
+				continue
+			}
+			return ev, nil
+		} else if seq > lockSeq {
+			close(done)
+			return nil, client.ErrNoNode
+		}
+		e := <-ev
+		close(done)
+		if e.Err != nil {
+			return nil, e.Err
+		}
+	}
+}
+
+// ReleaseLead release the current leader role. It will return ErrNotLocked if
+// the current object is not locked.
+func (l *Leader) ReleaseLead() error {
+	if l.lockPath == "" {
+		return client.ErrNotLocked
+	}
+	if err := l.c.withConn(func() error {
+		return l.c.delete(l.lockPath)
+	}); err != nil {
+		return err
+	}
+	l.lockPath = ""
+	return nil
+}
+
+// getLowestSequence returns the node in the path of the lowest sequence
+func (l *Leader) getLowestSequence() (string, uint64, error) {
+	children, _, err := l.c.children(l.path)
+	if err != nil {
+		return "", 0, err
+	}
+	var lowestSeq uint64 = math.MaxUint64
+	firstChild := ""
+	for _, p := range children {
+		s, err := parseSeq(p)
+		if err != nil {
+			return "", 0, err
+		}
+		if s < lowestSeq {
+			lowestSeq = s
+			firstChild = p
+		}
+	}
+	if lowestSeq == math.MaxUint64 {
+		return "", 0, client.ErrNoLeaderFound
+	}
+	return path.Join(l.path, firstChild), lowestSeq, nil
+}
+
+func parseSeq(path string) (uint64, error) {
+	parts := strings.Split(path, "-")
+	return strconv.ParseUint(parts[len(parts)-1], 10, 64)
+}
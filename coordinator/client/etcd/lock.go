@@ -0,0 +1,122 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"path"
+
+	"github.com/control-center/serviced/coordinator/client"
+)
+
+// Lock creates a object to facilitate create a locking pattern in etcd.
+type Lock struct {
+	c        *Connection
+	path     string
+	lockPath string
+}
+
+// Lock attempts to acquire the lock.
+func (l *Lock) Lock() error {
+	if l.lockPath != "" {
+		return client.ErrDeadlock
+	}
+	prefix := path.Join(l.path, "lock-")
+	if err := l.c.withConn(func() (err error) {
+		if err = l.c.ensurePath(prefix); err != nil {
+			return
+		}
+		l.lockPath, err = l.c.createEphemeral(prefix, []byte{})
+		return
+	}); err != nil {
+		return err
+	}
+	if err := l.wait(); err != nil {
+		l.c.withConn(func() error { return l.c.delete(l.lockPath) })
+		l.lockPath = ""
+		return err
+	}
+	return nil
+}
+
+// wait blocks until the lock node has the lowest sequence
+func (l *Lock) wait() error {
+	seq, err := parseSeq(l.lockPath)
+	if err != nil {
+		return err
+	}
+	name := path.Base(l.lockPath)
+	for {
+		var children []string
+		if err := l.c.withConn(func() (err error) {
+			children, _, err = l.c.children(l.path)
+			return
+		}); err != nil {
+			return err
+		}
+
+		// find the node just before this one
+		found := false
+		prev, prevSeq := "", uint64(0)
+		for _, child := range children {
+			if child == name {
+				found = true
+				continue
+			}
+			s, err := parseSeq(child)
+			if err != nil {
+				return err
+			}
+			if s < seq && (prev == "" || s > prevSeq) {
+				prev, prevSeq = child, s
+			}
+		}
+		if !found {
+			return client.ErrNoNode
+		} else if prev == "" {
+			return nil
+		}
+
+		done := make(chan struct{})
+		var ok bool
+		var ev <-chan client.Event
+		if err := l.c.withConn(func() (err error) {
+			ok, ev, err = l.c.existsW(path.Join(l.path, prev), done)
+			return
+		}); err != nil {
+			close(done)
+			return err
+		}
+		if ok {
+			if e := <-ev; e.Err != nil {
+				close(done)
+				return e.Err
+			}
+		}
+		close(done)
+	}
+}
+
+// Unlock attempts to release the lock.
+func (l *Lock) Unlock() error {
+	if l.lockPath == "" {
+		return client.ErrNotLocked
+	}
+	if err := l.c.withConn(func() error {
+		return l.c.delete(l.lockPath)
+	}); err != nil {
+		return err
+	}
+	l.lockPath = ""
+	return nil
+}
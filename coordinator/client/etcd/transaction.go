@@ -0,0 +1,162 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"encoding/json"
+	"path"
+
+	"github.com/control-center/serviced/coordinator/client"
+)
+
+const (
+	multiCreate int = iota
+	multiSet
+	multiDelete
+)
+
+type multiReq struct {
+	Type int
+	Path string
+	Node client.Node
+}
+
+// Transaction is a set of operations that are committed in a single etcd
+// transaction.
+type Transaction struct {
+	conn *Connection
+	ops  []multiReq
+}
+
+func (t *Transaction) Create(path string, node client.Node) client.Transaction {
+	t.ops = append(t.ops, multiReq{multiCreate, path, node})
+	return t
+}
+
+func (t *Transaction) Set(path string, node client.Node) client.Transaction {
+	t.ops = append(t.ops, multiReq{multiSet, path, node})
+	return t
+}
+
+func (t *Transaction) Delete(path string) client.Transaction {
+	t.ops = append(t.ops, multiReq{multiDelete, path, nil})
+	return t
+}
+
+func (t *Transaction) Commit() error {
+	t.conn.RLock()
+	defer t.conn.RUnlock()
+	if err := t.conn.isClosed(); err != nil {
+		return err
+	}
+	req := &txnRequest{}
+	created := make(map[string]bool)
+	for _, op := range t.ops {
+		pth := t.conn.path(op.Path)
+		key := t.conn.key(pth)
+		logger := plog.WithField("path", pth)
+		switch op.Type {
+		case multiCreate:
+			data, err := json.Marshal(op.Node)
+			if err != nil {
+				logger.WithError(err).WithField("node", op.Node).Error("Could not serialize node at path")
+				return client.ErrSerialization
+			}
+			req.Compare = append(req.Compare, missing(key))
+			// the parent may be created earlier in the same transaction
+			if parent := path.Dir(pth); parent != "/" && !created[parent] {
+				req.Compare = append(req.Compare, exists(t.conn.key(parent)))
+			}
+			req.Success = append(req.Success, requestOp{RequestPut: &putRequest{Key: key, Value: data}})
+			created[pth] = true
+		case multiSet:
+			data, err := json.Marshal(op.Node)
+			if err != nil {
+				logger.WithError(err).WithField("node", op.Node).Error("Could not serialize node at path")
+				return client.ErrSerialization
+			}
+			stat := &Stat{}
+			if vers := op.Node.Version(); vers != nil {
+				var ok bool
+				if stat, ok = vers.(*Stat); !ok {
+					logger.WithField("node", op.Node).Error("Could not parse version of node at path")
+					return client.ErrInvalidVersionObj
+				}
+			}
+			req.Compare = append(req.Compare, compare{Result: compareEqual, Target: targetVersion, Key: key, Version: intp(stat.Version + 1)})
+			req.Success = append(req.Success, requestOp{RequestPut: &putRequest{Key: key, Value: data, IgnoreLease: true}})
+		case multiDelete:
+			req.Compare = append(req.Compare, exists(key))
+			req.Success = append(req.Success,
+				requestOp{RequestDeleteRange: &deleteRangeRequest{Key: key}},
+				requestOp{RequestDeleteRange: &deleteRangeRequest{Key: t.conn.seqKey(pth)}},
+			)
+		}
+	}
+	resp, err := t.conn.api.txn(req)
+	if err != nil {
+		return xlateError(err)
+	} else if !resp.Succeeded {
+		return t.failure()
+	}
+	for _, op := range t.ops {
+		if op.Type == multiCreate {
+			op.Node.SetVersion(&Stat{})
+		}
+	}
+	return nil
+}
+
+// failure returns the error of the first operation that could not be
+// committed
+func (t *Transaction) failure() error {
+	created := make(map[string]bool)
+	for _, op := range t.ops {
+		pth := t.conn.path(op.Path)
+		resp, err := t.conn.api.kvRange(&rangeRequest{Key: t.conn.key(pth)})
+		if err != nil {
+			return xlateError(err)
+		}
+		switch op.Type {
+		case multiCreate:
+			if len(resp.Kvs) > 0 {
+				return client.ErrNodeExists
+			}
+			if parent := path.Dir(pth); parent != "/" && !created[parent] {
+				if ok, _, err := t.conn.exists(parent); err != nil {
+					return err
+				} else if !ok {
+					return client.ErrNoNode
+				}
+			}
+			created[pth] = true
+		case multiSet:
+			if len(resp.Kvs) == 0 {
+				return client.ErrNoNode
+			}
+			stat := &Stat{}
+			if vers, ok := op.Node.Version().(*Stat); ok {
+				stat = vers
+			}
+			if int64(resp.Kvs[0].Version)-1 != stat.Version {
+				return client.ErrBadVersion
+			}
+		case multiDelete:
+			if len(resp.Kvs) == 0 {
+				return client.ErrNoNode
+			}
+		}
+	}
+	return client.ErrBadVersion
+}
@@ -45,6 +45,8 @@ type Client struct {
 	host         *host.Host
 	exportedPath string
 	localPath    string
+	timeout      time.Duration
+	transport    Transport
 	closing      chan struct{}
 	mounted      chan chan<- string
 	conn         client.Connection
@@ -58,14 +60,16 @@ func GetClient() (*Client, error) {
 	return storageClient, nil
 }
 
-// NewClient returns a Client that manages remote mounts
-func NewClient(host *host.Host, localPath string) (*Client, error) {
+// NewClient returns a Client that manages remote mounts.  Transports that
+// support it give up on mounts that take longer than the timeout.
+func NewClient(host *host.Host, localPath string, timeout time.Duration) (*Client, error) {
 	if err := mkdirAll(localPath, 0755); err != nil {
 		return nil, err
 	}
 	c := &Client{
 		host:      host,
 		localPath: localPath,
+		timeout:   timeout,
 		mounted:   make(chan chan<- string),
 		closing:   make(chan struct{}),
 		// conn:      nil,   // commented out on purpose - no need to initialize
@@ -119,11 +123,20 @@ func (c *Client) Close() {
 
 // Mount source  to local destination path. The source is relative to the exported path
 func (c *Client) Mount(source, destination string) error {
-	return nfsMount(&nfs.NFSDriver{}, path.Join(c.exportedPath, source), destination)
+	return c.getTransport().Mount(path.Join(c.exportedPath, source), destination)
 }
 
 func (c *Client) Unmount(destination string) error {
-	return nfsUnmount(&nfs.NFSDriver{}, destination)
+	return c.getTransport().Unmount(destination)
+}
+
+func (c *Client) getTransport() Transport {
+	c.setLock.Lock()
+	defer c.setLock.Unlock()
+	if c.transport == nil {
+		return nfsTransport{}
+	}
+	return c.transport
 }
 
 func (c *Client) loop() {
@@ -207,24 +220,27 @@ func (c *Client) loop() {
 			continue
 		}
 
+		transport := newTransport(leaderNode, c.timeout)
 		if leaderNode.IPAddr != c.host.IPAddr {
-			logger.Info("Checking if NFS is supported")
-			nfsd := &nfs.NFSDriver{}
-			err = nfsd.Installed()
+			logger.WithField("transport", leaderNode.Transport).Info("Checking if the storage transport is supported")
+			err = transport.Installed()
 			if err != nil {
 				if err == nfs.ErrNfsMountingUnsupported {
 					logger.WithError(err).Error("Install the nfs-common package")
 				}
-				logger.WithError(err).Error("Unable to determine if NFS is available")
+				logger.WithError(err).Error("Unable to determine if the storage transport is available")
 				continue
 			}
 		} else {
-			logger.Info("skipping nfs mounting, server is localhost")
+			logger.Info("skipping remote mounting, server is localhost")
 		}
 		logger.WithField("leader", leaderNode.Host.IPAddr).Info("At this point, the leader is known")
 		select {
 		case doneC <- leaderNode.ExportPath:
 			c.exportedPath = leaderNode.ExportPath
+			c.setLock.Lock()
+			c.transport = transport
+			c.setLock.Unlock()
 			storageClient = c
 			// notifying someone who cares
 			doneC = nil
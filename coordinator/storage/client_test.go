@@ -68,7 +68,7 @@ func TestClient(t *testing.T) {
 		t.Fatalf("could not create tempdir: %s", err)
 	}
 	defer os.RemoveAll(dir)
-	c, err := NewClient(h, dir)
+	c, err := NewClient(h, dir, time.Minute)
 	if err != nil {
 		t.Fatalf("unexpected error creating client: %s", err)
 	}
@@ -114,3 +114,22 @@ func (_m *StorageDriver) GetDevice(path string) (uint64, error) {
 
 	return r0, r1
 }
+func (_m *StorageDriver) Transport() (string, int) {
+	ret := _m.Called()
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 int
+	if rf, ok := ret.Get(1).(func() int); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Get(1).(int)
+	}
+
+	return r0, r1
+}
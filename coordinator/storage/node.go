@@ -23,7 +23,10 @@ type Node struct {
 	Network    string
 	ExportPath string
 	ExportTime string
-	version    interface{}
+	// Transport is the protocol that volumes are exported with; empty is nfs
+	Transport     string
+	TransportPort int
+	version       interface{}
 }
 
 // Version returns the node version to implement the client.Node interface
@@ -19,7 +19,6 @@ import (
 	"time"
 
 	"github.com/control-center/serviced/coordinator/client"
-	"github.com/control-center/serviced/coordinator/client/zookeeper"
 	"github.com/control-center/serviced/domain/host"
 	"github.com/control-center/serviced/logging"
 )
@@ -31,8 +30,9 @@ var (
 
 // Server manages the exporting of a file system to clients.
 type Server struct {
-	host   *host.Host
-	driver StorageDriver
+	host     *host.Host
+	driver   StorageDriver
+	exportIP string
 }
 
 // StorageDriver is an interface that storage subsystem must implement to be used
@@ -53,6 +53,8 @@ type StorageDriver interface {
 	RemoveVolume(path string) error
 	// Get the backing device for a path
 	GetDevice(path string) (uint64, error)
+	// Transport returns the protocol that clients mount with and its port
+	Transport() (name string, port int)
 }
 
 // NewServer returns a Server object to manage the exported file system
@@ -69,12 +71,24 @@ func NewServer(driver StorageDriver, host *host.Host, volumesPath string) (*Serv
 	return s, nil
 }
 
+// SetExportIP sets the address that clients mount the file system from,
+// such as a virtual ip that follows the active master.  By default, clients
+// mount from the address of the host.
+func (s *Server) SetExportIP(ip string) {
+	s.exportIP = ip
+}
+
 func (s *Server) Run(shutdown <-chan interface{}, conn client.Connection) error {
+	exportIP := s.host.IPAddr
+	if s.exportIP != "" {
+		exportIP = s.exportIP
+	}
 	node := &Node{
 		Host:       *s.host,
-		ExportPath: fmt.Sprintf("%s:%s", s.host.IPAddr, s.driver.ExportPath()),
+		ExportPath: fmt.Sprintf("%s:%s", exportIP, s.driver.ExportPath()),
 		ExportTime: strconv.FormatInt(time.Now().UnixNano(), 16),
 	}
+	node.Transport, node.TransportPort = s.driver.Transport()
 
 	// Create the storage leader and client nodes
 	if exists, _ := conn.Exists("/storage/leader"); !exists {
@@ -92,7 +106,7 @@ func (s *Server) Run(shutdown <-chan interface{}, conn client.Connection) error
 	leaderDone := make(chan struct{})
 	defer close(leaderDone)
 	leaderW, err := leader.TakeLead(node, leaderDone)
-	if err != zookeeper.ErrDeadlock && err != nil {
+	if err != client.ErrDeadlock && err != nil {
 		plog.WithError(err).Error("Could not take storage lead")
 		return err
 	}
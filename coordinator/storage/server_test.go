@@ -76,6 +76,10 @@ func (m *mockNfsDriverT) GetDevice(path string) (uint64, error) {
 	return 12345, nil
 }
 
+func (m *mockNfsDriverT) Transport() (string, int) {
+	return "nfs", 0
+}
+
 func TestServer(t *testing.T) {
 	t.Skip() // the zookeeper part doesnt work in this test, but does work in real life
 	zzkServer := &zzktest.ZZKServer{}
@@ -164,7 +168,7 @@ func TestServer(t *testing.T) {
 		t.Fatalf("could not create tempdir: %s", err)
 	}
 	defer os.RemoveAll(tmpVar)
-	c1, err := NewClient(hostClient1, tmpVar)
+	c1, err := NewClient(hostClient1, tmpVar, time.Minute)
 	if err != nil {
 		t.Fatalf("could not create client: %s", err)
 	}
@@ -0,0 +1,57 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	"github.com/control-center/serviced/dfs/nfs"
+	"github.com/control-center/serviced/dfs/ninep"
+)
+
+// Transport mounts the volumes exported by the storage leader
+type Transport interface {
+	// Installed returns an error if the transport cannot be used on this host
+	Installed() error
+	// Mount mounts the remote path, ip:/export/volume, to the local path
+	Mount(remotePath, localPath string) error
+	// Unmount unmounts the local path
+	Unmount(localPath string) error
+}
+
+// nfsTransport mounts volumes with the kernel nfs client
+type nfsTransport struct{}
+
+func (t nfsTransport) Installed() error {
+	return (&nfs.NFSDriver{}).Installed()
+}
+
+func (t nfsTransport) Mount(remotePath, localPath string) error {
+	return nfsMount(&nfs.NFSDriver{}, remotePath, localPath)
+}
+
+func (t nfsTransport) Unmount(localPath string) error {
+	return nfsUnmount(&nfs.NFSDriver{}, localPath)
+}
+
+// newTransport returns the transport that mounts volumes from the leader.
+// Leaders that do not advertise a transport export over nfs.
+func newTransport(leader *Node, timeout time.Duration) Transport {
+	switch leader.Transport {
+	case ninep.TransportName:
+		return ninep.NewClient(leader.TransportPort, timeout)
+	default:
+		return nfsTransport{}
+	}
+}
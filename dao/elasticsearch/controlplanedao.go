@@ -134,7 +134,7 @@ func NewControlPlaneDao(hostName string, port int, rpcPort int) (*ControlPlaneDa
 	return dao, nil
 }
 
-func NewControlSvc(hostName string, port int, facade *facade.Facade, backupsPath string, rpcPort int) (*ControlPlaneDao, error) {
+func NewControlSvc(hostName string, port int, metricsURL string, facade *facade.Facade, backupsPath string, rpcPort int) (*ControlPlaneDao, error) {
 	glog.V(2).Info("calling NewControlSvc()")
 	defer glog.V(2).Info("leaving NewControlSvc()")
 
@@ -148,7 +148,7 @@ func NewControlSvc(hostName string, port int, facade *facade.Facade, backupsPath
 	s.facade = facade
 
 	// initialize the metrics client
-	metricClient, err := metrics.NewClient(fmt.Sprintf("http://%s:8888", hostName))
+	metricClient, err := metrics.NewClient(metricsURL)
 	if err != nil {
 		return nil, err
 	}
@@ -109,7 +109,12 @@ func (dt *DaoTest) SetUpSuite(c *C) {
 	})
 
 	dt.Port = 9202
-	isvcs.Init(isvcs.DEFAULT_ES_STARTUP_TIMEOUT_SECONDS, "json-file", map[string]string{"max-file": "5", "max-size": "10m"}, nil, true, false)
+	isvcs.Init(isvcs.Options{
+		ESStartupTimeout: isvcs.DEFAULT_ES_STARTUP_TIMEOUT_SECONDS * time.Second,
+		DockerLogDriver:  "json-file",
+		DockerLogConfig:  map[string]string{"max-file": "5", "max-size": "10m"},
+		StartZK:          true,
+	})
 	isvcs.Mgr.SetVolumesDir(c.MkDir())
 	esServicedClusterName, _ := utils.NewUUID36()
 	if err := isvcs.Mgr.SetConfigurationOption("elasticsearch-serviced", "cluster", esServicedClusterName); err != nil {
@@ -149,7 +154,7 @@ func (dt *DaoTest) SetUpSuite(c *C) {
 	err = volume.InitDriver(volume.DriverTypeRsync, tmpdir, []string{})
 	c.Assert(err, IsNil)
 
-	dt.Dao, err = NewControlSvc("localhost", int(dt.Port), dt.Facade, "", 4979)
+	dt.Dao, err = NewControlSvc("localhost", int(dt.Port), "http://localhost:8888", dt.Facade, "", 4979)
 	if err != nil {
 		glog.Fatalf("Could not start es container: %s", err)
 	} else {
@@ -219,7 +219,11 @@ func (dao *ControlPlaneDao) Restore(restoreRequest model.RestoreRequest, _ *int)
 		return err
 	}
 	defer gz.Close()
-	err = dao.facade.Restore(ctx, gz, info, restoreRequest.Filename)
+	if restoreRequest.Resume {
+		err = dao.facade.ResumeRestore(ctx, gz, info, restoreRequest.Filename)
+	} else {
+		err = dao.facade.Restore(ctx, gz, info, restoreRequest.Filename)
+	}
 	return err
 }
 
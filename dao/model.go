@@ -132,6 +132,7 @@ type BackupRequest struct {
 type RestoreRequest struct {
 	Filename string
 	Username string
+	Resume   bool // skip the phases done by an earlier restore of the file
 }
 
 type BackupEstimate struct {
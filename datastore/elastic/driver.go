@@ -27,6 +27,9 @@ import (
 	"github.com/zenoss/elastigo/api"
 )
 
+// DriverName is the name of the Elasticsearch datastore backend
+const DriverName = "elastic"
+
 //ElasticDriver describes an the Elastic Search driver
 type ElasticDriver interface {
 	SetProperty(name string, prop interface{}) error
@@ -45,6 +48,7 @@ func New(host string, port uint16, index string) ElasticDriver {
 func newDriver(host string, port uint16, index string) *elasticDriver {
 	api.Domain = host
 	api.Port = fmt.Sprintf("%v", port)
+	api.Client = httpClient
 	//TODO: singleton since elastigo doesn't support multiple endpoints
 
 	driver := &elasticDriver{}
@@ -156,7 +160,7 @@ func (ed *elasticDriver) AddMappingsFile(path string) error {
 }
 
 func (ed *elasticDriver) elasticURL() string {
-	return fmt.Sprintf("http://%s:%d", ed.host, ed.port)
+	return fmt.Sprintf("%s://%s:%d", api.Protocol, ed.host, ed.port)
 }
 
 func (ed *elasticDriver) indexURL() string {
@@ -175,7 +179,7 @@ func (ed *elasticDriver) isUp() bool {
 func (ed *elasticDriver) getHealth() (map[string]interface{}, error) {
 	health := make(map[string]interface{})
 	healthURL := fmt.Sprintf("%v/_cluster/health", ed.elasticURL())
-	resp, err := http.Get(healthURL)
+	resp, err := httpClient.Get(healthURL)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
@@ -224,7 +228,7 @@ func (ed *elasticDriver) postMappings() error {
 		mapURL := fmt.Sprintf("%s/%s/_mapping", ed.indexURL(), typeName)
 		logger := plog.WithField("mapurl", mapURL)
 		logger.WithField("mapping", string(mappingBytes)).Debug("Posting mapping")
-		resp, err := http.Post(mapURL, "application/json", bytes.NewReader(mappingBytes))
+		resp, err := httpClient.Post(mapURL, "application/json", bytes.NewReader(mappingBytes))
 		if resp != nil {
 			defer resp.Body.Close()
 		}
@@ -266,7 +270,7 @@ func (ed *elasticDriver) deleteIndex() error {
 	if err != nil {
 		return err
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -293,7 +297,7 @@ func (ed *elasticDriver) postIndex() error {
 		return err
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewReader(configBytes))
+	resp, err := httpClient.Post(url, "application/json", bytes.NewReader(configBytes))
 	if resp != nil {
 		defer resp.Body.Close()
 	}
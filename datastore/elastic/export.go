@@ -0,0 +1,56 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elastic
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/zenoss/elastigo/core"
+)
+
+// Export calls visit with every document in the index, in no particular
+// order.  It reads the whole index in one search, so it is meant for moving
+// the controlplane index to another datastore while nothing writes to it.
+func Export(index string, visit func(kind, id string, version int, source json.RawMessage) error) error {
+	count, err := core.SearchRequest(false, index, "", map[string]interface{}{
+		"query": map[string]interface{}{"match_all": map[string]interface{}{}},
+		"size":  0,
+	}, "", 0)
+	if err != nil {
+		return fmt.Errorf("could not count documents in index %s: %s", index, err)
+	}
+	total := count.Hits.Total
+	plog.WithField("total", total).Debug("Exporting index")
+	if total == 0 {
+		return nil
+	}
+	result, err := core.SearchRequest(false, index, "", map[string]interface{}{
+		"query":   map[string]interface{}{"match_all": map[string]interface{}{}},
+		"size":    total,
+		"version": true,
+	}, "", 0)
+	if err != nil {
+		return fmt.Errorf("could not read documents in index %s: %s", index, err)
+	}
+	if len(result.Hits.Hits) != total {
+		return fmt.Errorf("index %s changed while it was exported: expected %d documents, found %d", index, total, len(result.Hits.Hits))
+	}
+	for _, hit := range result.Hits.Hits {
+		if err := visit(hit.Type, hit.Id, hit.Version, hit.Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
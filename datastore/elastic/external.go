@@ -0,0 +1,134 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elastic
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// httpClient sends the requests of the driver and of elastigo, so that the
+// configuration of an external cluster applies to those requests only.
+var httpClient = &http.Client{}
+
+// UseExternal points the driver at the Elasticsearch cluster at endpoints
+// (http[s]://[user:password@]host:port) and returns the host and port to
+// create the driver with.  The driver and elastigo address their requests to
+// the first endpoint; the driver's client sends each request to the endpoint
+// that last answered, with its credentials, and fails over to the others when
+// it cannot be reached.
+func UseExternal(endpoints []string, tlsConfig *tls.Config) (string, uint16, error) {
+	if len(endpoints) == 0 {
+		return "", 0, fmt.Errorf("no elasticsearch endpoints")
+	}
+	transport := &failoverTransport{
+		transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+	for _, endpoint := range endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return "", 0, err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return "", 0, fmt.Errorf("unsupported elasticsearch scheme %q", u.Scheme)
+		}
+		if _, _, err := net.SplitHostPort(u.Host); err != nil {
+			return "", 0, err
+		}
+		transport.endpoints = append(transport.endpoints, u)
+	}
+	host, portStr, _ := net.SplitHostPort(transport.endpoints[0].Host)
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return "", 0, err
+	}
+	httpClient = &http.Client{Transport: transport}
+	return host, uint16(port), nil
+}
+
+// failoverTransport sends the requests for the first of its endpoints to the
+// endpoint that last answered, logging in with basic auth, and tries the
+// others in turn when that endpoint cannot be reached.
+type failoverTransport struct {
+	endpoints []*url.URL
+	transport http.RoundTripper
+
+	mu      sync.Mutex
+	current int
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.endpoints[0].Host {
+		return t.transport.RoundTrip(req)
+	}
+
+	// read the body so that it can be sent again to another endpoint
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t.mu.Lock()
+	current := t.current
+	t.mu.Unlock()
+
+	var err error
+	for i := range t.endpoints {
+		n := (current + i) % len(t.endpoints)
+		endpoint := t.endpoints[n]
+
+		r := *req
+		u := *req.URL
+		u.Scheme, u.Host, u.User = endpoint.Scheme, endpoint.Host, nil
+		r.URL, r.Host = &u, ""
+		r.Header = make(http.Header, len(req.Header))
+		for k, v := range req.Header {
+			r.Header[k] = v
+		}
+		if endpoint.User != nil && req.Header.Get("Authorization") == "" {
+			password, _ := endpoint.User.Password()
+			r.SetBasicAuth(endpoint.User.Username(), password)
+		}
+		if body != nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+		}
+
+		var resp *http.Response
+		if resp, err = t.transport.RoundTrip(&r); err == nil {
+			t.mu.Lock()
+			t.current = n
+			t.mu.Unlock()
+			return resp, nil
+		}
+		plog.WithError(err).WithField("endpoint", endpoint.Host).Warn("Unable to reach Elasticsearch endpoint")
+	}
+	return nil, err
+}
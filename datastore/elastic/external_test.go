@@ -0,0 +1,91 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package elastic
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUseExternal(t *testing.T) {
+	defer func(client *http.Client) { httpClient = client }(httpClient)
+
+	type request struct {
+		path, body, username, password string
+		auth                           bool
+	}
+	requests := make(chan request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		username, password, ok := r.BasicAuth()
+		requests <- request{r.URL.Path, string(body), username, password, ok}
+	}))
+	defer server.Close()
+
+	// an endpoint that refuses connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	down := listener.Addr().String()
+	listener.Close()
+
+	up := strings.TrimPrefix(server.URL, "http://")
+	host, port, err := UseExternal([]string{
+		fmt.Sprintf("http://user1:secret1@%s", down),
+		fmt.Sprintf("http://user2:secret2@%s", up),
+	}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if address := fmt.Sprintf("%s:%d", host, port); address != down {
+		t.Errorf("Expected address %s, got %s", down, address)
+	}
+
+	// requests for the first endpoint fail over to the second
+	for i := 0; i < 2; i++ {
+		resp, err := httpClient.Post(fmt.Sprintf("http://%s/controlplane/", down), "application/json", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		resp.Body.Close()
+		expected := request{"/controlplane/", "{}", "user2", "secret2", true}
+		if actual := <-requests; actual != expected {
+			t.Errorf("Expected %+v, got %+v", expected, actual)
+		}
+	}
+
+	// other clients do not send the credentials
+	resp, err := http.Get(server.URL + "/other")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	resp.Body.Close()
+	if actual := <-requests; actual.auth {
+		t.Errorf("Unexpected credentials in %+v", actual)
+	}
+
+	for _, endpoints := range [][]string{nil, {"ftp://es:9200"}, {"http://es"}, {"http://es:9200", "es2:9200"}} {
+		if _, _, err := UseExternal(endpoints, nil); err == nil {
+			t.Errorf("Expected an error using %v", endpoints)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+import (
+	"errors"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/datastore"
+)
+
+// DriverName is the name of the embedded datastore backend
+const DriverName = "embedded"
+
+// ErrConflict is returned when an entity is saved at a version other than the
+// stored one.  It reads the same as the error from the Elasticsearch backend.
+var ErrConflict = errors.New("Your changes conflict with those made by another user. Please reload and try your changes again.")
+
+// Driver is a datastore.Driver backed by a Store
+type Driver struct {
+	store *Store
+}
+
+//Make sure Driver implements datastore.Driver
+var _ datastore.Driver = &Driver{}
+
+// New returns a driver for the store
+func New(store *Store) *Driver {
+	return &Driver{store: store}
+}
+
+// GetConnection implements datastore.Driver
+func (d *Driver) GetConnection() (datastore.Connection, error) {
+	return &connection{d.store}, nil
+}
+
+type connection struct {
+	store *Store
+}
+
+// Put implements datastore.Connection.  Entities carry the version they were
+// read at; saving one that was changed since fails with ErrConflict.
+func (c *connection) Put(key datastore.Key, msg datastore.JSONMessage) error {
+	logger := plog.WithFields(log.Fields{
+		"kind": key.Kind(),
+		"id":   key.ID(),
+	})
+	logger.Debug("Put")
+	return c.store.Update(func(tx *Tx) error {
+		version := 1
+		if cur := tx.Get(key.Kind(), key.ID()); cur != nil {
+			if msg.Version() != 0 && msg.Version() != cur.Version {
+				logger.WithFields(log.Fields{
+					"version":       msg.Version(),
+					"storedversion": cur.Version,
+				}).Debug("Version conflict")
+				return ErrConflict
+			}
+			version = cur.Version + 1
+		} else if msg.Version() != 0 {
+			logger.WithField("version", msg.Version()).Debug("Version conflict; entity does not exist")
+			return ErrConflict
+		}
+		return tx.Put(key.Kind(), key.ID(), version, msg.Bytes())
+	})
+}
+
+// Get implements datastore.Connection
+func (c *connection) Get(key datastore.Key) (datastore.JSONMessage, error) {
+	var msg datastore.JSONMessage
+	err := c.store.View(func(tx *Tx) error {
+		rec := tx.Get(key.Kind(), key.ID())
+		if rec == nil {
+			return datastore.ErrNoSuchEntity{Key: key}
+		}
+		msg = datastore.NewJSONMessage(rec.Data, rec.Version)
+		return nil
+	})
+	return msg, err
+}
+
+// Delete implements datastore.Connection.  Deleting an entity that does not
+// exist is not an error.
+func (c *connection) Delete(key datastore.Key) error {
+	plog.WithFields(log.Fields{
+		"kind": key.Kind(),
+		"id":   key.ID(),
+	}).Debug("Delete")
+	return c.store.Update(func(tx *Tx) error {
+		if tx.Get(key.Kind(), key.ID()) == nil {
+			return nil
+		}
+		return tx.Delete(key.Kind(), key.ID())
+	})
+}
+
+// Query implements datastore.Connection for the searches the domain stores
+// build for Elasticsearch
+func (c *connection) Query(query interface{}) ([]datastore.JSONMessage, error) {
+	req, err := parseRequest(query)
+	if err != nil {
+		plog.WithError(err).Error("Could not translate query")
+		return nil, err
+	}
+	var hits []hit
+	if err := c.store.View(func(tx *Tx) (err error) {
+		hits, err = req.run(tx)
+		return
+	}); err != nil {
+		return nil, err
+	}
+	msgs := make([]datastore.JSONMessage, len(hits))
+	for i, h := range hits {
+		msgs[i] = datastore.NewJSONMessage(h.data, h.version)
+	}
+	plog.WithField("total", len(msgs)).Debug("Query finished")
+	return msgs, nil
+}
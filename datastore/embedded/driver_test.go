@@ -0,0 +1,282 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package embedded
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/control-center/serviced/datastore"
+	"github.com/control-center/serviced/datastore/elastic"
+	"github.com/zenoss/elastigo/search"
+)
+
+var testServices = map[string]string{
+	"tenant": `{"ID":"tenant","Name":"Zenoss.core","PoolID":"default","ParentServiceID":"","DeploymentID":"dep","Tags":["daemon"],"UpdatedAt":"2016-06-01T10:00:00.123456789Z","Endpoints":[{"Purpose":"export","Application":"zproxy","AddressConfig":{"Port":0,"Protocol":""},"VHostList":[{"Name":"zenoss5"}]}]}`,
+	"mysql":  `{"ID":"mysql","Name":"MariaDB","PoolID":"default","ParentServiceID":"tenant","DeploymentID":"dep","Tags":["daemon","db"],"ImageID":"img","UpdatedAt":"2016-06-03T10:00:00Z","Endpoints":[{"Purpose":"export","Application":"mysql","AddressConfig":{"Port":3306,"Protocol":"tcp"}}]}`,
+	"redis":  `{"ID":"redis","Name":"redis","PoolID":"other","ParentServiceID":"tenant","DeploymentID":"dep","Tags":["cache"],"UpdatedAt":"2016-06-02T10:00:00Z","Endpoints":[{"Purpose":"import","Application":"mysql"}]}`,
+}
+
+var testHosts = map[string]string{
+	"h1": `{"ID":"h1","PoolID":"default","IPs":[{"IPAddress":"10.0.0.1"},{"IPAddress":"10.0.0.2"}],"Memory":1024}`,
+	"h2": `{"ID":"h2","PoolID":"other","IPs":[{"IPAddress":"10.0.0.3"}],"Memory":2048}`,
+}
+
+func openTestConnection(t *testing.T) (datastore.Connection, func()) {
+	s, dir := openTestStore(t)
+	conn, err := New(s).GetConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for kind, docs := range map[string]map[string]string{"service": testServices, "host": testHosts} {
+		for id, doc := range docs {
+			if err := conn.Put(datastore.NewKey(kind, id), datastore.NewJSONMessage([]byte(doc), 0)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return conn, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// ids runs the query and returns the ids of the hits
+func ids(t *testing.T, conn datastore.Connection, query interface{}) []string {
+	msgs, err := conn.Query(query)
+	if err != nil {
+		t.Fatalf("Query failed: %s", err)
+	}
+	result := []string{}
+	for _, msg := range msgs {
+		var doc struct{ ID string }
+		if err := json.Unmarshal(msg.Bytes(), &doc); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, doc.ID)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func expectIDs(t *testing.T, name string, actual []string, expected ...string) {
+	if len(actual) != len(expected) {
+		t.Errorf("%s: expected %v, got %v", name, expected, actual)
+		return
+	}
+	for i := range actual {
+		if actual[i] != expected[i] {
+			t.Errorf("%s: expected %v, got %v", name, expected, actual)
+			return
+		}
+	}
+}
+
+func TestPutGetDelete(t *testing.T) {
+	conn, cleanup := openTestConnection(t)
+	defer cleanup()
+	key := datastore.NewKey("host", "h1")
+	msg, err := conn.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Version() != 1 {
+		t.Errorf("Expected version 1, got %d", msg.Version())
+	}
+
+	// saving at the version that was read succeeds once
+	if err := conn.Put(key, datastore.NewJSONMessage(msg.Bytes(), msg.Version())); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Put(key, datastore.NewJSONMessage(msg.Bytes(), msg.Version())); err != ErrConflict {
+		t.Errorf("Expected %s, got %v", ErrConflict, err)
+	}
+	if err := conn.Put(datastore.NewKey("host", "new"), datastore.NewJSONMessage([]byte(`{}`), 4)); err != ErrConflict {
+		t.Errorf("Expected %s, got %v", ErrConflict, err)
+	}
+	if msg, err = conn.Get(key); err != nil || msg.Version() != 2 {
+		t.Errorf("Expected version 2, got %v, %v", msg, err)
+	}
+
+	if err := conn.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Get(key); err == nil {
+		t.Errorf("Expected an error getting a deleted entity")
+	} else if _, ok := err.(datastore.ErrNoSuchEntity); !ok {
+		t.Errorf("Expected ErrNoSuchEntity, got %v", err)
+	}
+	if err := conn.Delete(key); err != nil {
+		t.Errorf("Deleting a missing entity failed: %s", err)
+	}
+}
+
+func TestSearchDsl(t *testing.T) {
+	conn, cleanup := openTestConnection(t)
+	defer cleanup()
+
+	q := search.Search("controlplane").Type("service").Size("50000").Query(search.Query().Search("_exists_:ID"))
+	expectIDs(t, "exists", ids(t, conn, q), "mysql", "redis", "tenant")
+
+	q = search.Search("controlplane").Type("service").Size("50000").Query(search.Query().Term("PoolID", "default"))
+	expectIDs(t, "term", ids(t, conn, q), "mysql", "tenant")
+
+	q = search.Search("controlplane").Type("host").Query(search.Query().Term("IPs.IPAddress", "10.0.0.2"))
+	expectIDs(t, "nested term", ids(t, conn, q), "h1")
+
+	q = search.Search("controlplane").Type("service").Filter(
+		"and",
+		search.Filter().Terms("DeploymentID", "dep"),
+		search.Filter().Terms("ParentServiceID", ""),
+		search.Filter().Terms("Name", "Zenoss.core"),
+	)
+	expectIDs(t, "and filter", ids(t, conn, q), "tenant")
+
+	q = search.Search("controlplane").Type("host").Size("50000").Filter(
+		"and",
+		search.Filter().Terms("PoolID", "other"),
+		search.Filter().Terms("Memory", "2048"),
+	)
+	expectIDs(t, "numeric terms", ids(t, conn, q), "h2")
+
+	q = search.Search("controlplane").Type("service").Size("50000").Query(search.Query().Search("daemon AND db"))
+	expectIDs(t, "tags", ids(t, conn, q), "mysql")
+
+	rq := search.Query().Range(search.Range().Field("UpdatedAt").From("2016-06-01T12:00:00Z")).Search("_exists_:ID")
+	q = search.Search("controlplane").Type("service").Size("50000").Query(rq)
+	expectIDs(t, "range", ids(t, conn, q), "mysql", "redis")
+
+	q = search.Search("controlplane").Type("service").Query(search.Query().Search("_exists_:ID")).From("1").Size("1")
+	expectIDs(t, "from and size", ids(t, conn, q), "redis")
+
+	// without a size, Elasticsearch returns at most 10 hits
+	if msgs, err := conn.Query(search.Search("controlplane").Query(search.Query().Search("*"))); err != nil || len(msgs) != 5 {
+		t.Errorf("Expected 5 hits, got %d, %v", len(msgs), err)
+	}
+
+	// versions are returned with elastigo searches
+	msgs, err := conn.Query(search.Search("controlplane").Type("host").Query(search.Query().Term("ID", "h2")))
+	if err != nil || len(msgs) != 1 || msgs[0].Version() != 1 {
+		t.Errorf("Expected one hit at version 1, got %v, %v", msgs, err)
+	}
+}
+
+func TestElasticSearchRequest(t *testing.T) {
+	conn, cleanup := openTestConnection(t)
+	defer cleanup()
+	request := func(query map[string]interface{}) elastic.ElasticSearchRequest {
+		return elastic.ElasticSearchRequest{Index: "controlplane", Type: "service", Query: query}
+	}
+
+	q := request(map[string]interface{}{
+		"query":  map[string]interface{}{"ids": map[string]interface{}{"values": []string{"redis"}}},
+		"fields": []string{"ID", "Name", "Endpoints"},
+		"size":   1,
+	})
+	msgs, err := conn.Query(q)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("Expected one hit, got %v, %v", msgs, err)
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(msgs[0].Bytes(), &fields)
+	if len(fields) != 3 || fields["Name"] != "redis" || fields["Endpoints"] == nil {
+		t.Errorf("Unexpected fields %v", fields)
+	}
+	if msgs[0].Version() != 0 {
+		t.Errorf("Version was returned without being requested")
+	}
+
+	q = request(map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should": []map[string]interface{}{
+					{"ids": map[string]interface{}{"values": []string{"maria"}}},
+					{"regexp": map[string]interface{}{"Name": ".*[mM][aA][rR][iI][aA].*"}},
+				},
+			},
+		},
+		"size": 50000,
+	})
+	expectIDs(t, "id or name", ids(t, conn, q), "mysql")
+
+	q = request(map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": []map[string]interface{}{
+					{"term": map[string]string{"ParentServiceID": "tenant"}},
+					{"range": map[string]interface{}{"UpdatedAt": map[string]string{"gte": "2016-06-02T10:00:00Z"}}},
+				},
+			},
+		},
+		"size": 50000,
+	})
+	expectIDs(t, "children since", ids(t, conn, q), "mysql", "redis")
+
+	q = request(map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": []map[string]interface{}{
+					{"range": map[string]interface{}{"Endpoints.AddressConfig.Port": map[string]interface{}{"gt": 0, "lte": 65535}}},
+					{"regexp": map[string]interface{}{"Endpoints.Protocol": ".+"}},
+				},
+			},
+		},
+		"size": 50000,
+	})
+	expectIDs(t, "ip assignments", ids(t, conn, q))
+
+	q = request(map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should": []map[string]interface{}{
+					{"regexp": map[string]interface{}{"Endpoints.VHostList.Name": ".+"}},
+					{"regexp": map[string]interface{}{"Endpoints.PortList.PortAddr": ".+"}},
+				},
+			},
+		},
+		"size": 50000,
+	})
+	expectIDs(t, "public endpoints", ids(t, conn, q), "tenant")
+
+	q = request(map[string]interface{}{
+		"query": map[string]interface{}{"term": map[string]interface{}{"Endpoints.Purpose": "export"}},
+		"size":  50000,
+	})
+	expectIDs(t, "exported endpoints", ids(t, conn, q), "mysql", "tenant")
+
+	q = request(map[string]interface{}{
+		"query": map[string]interface{}{"query_string": map[string]string{"query": "NOT Tags:daemon OR (PoolID:def* AND -Name:MariaDB)"}},
+		"size":  50000,
+	})
+	expectIDs(t, "query string", ids(t, conn, q), "redis", "tenant")
+}
+
+func TestUnsupportedQuery(t *testing.T) {
+	conn, cleanup := openTestConnection(t)
+	defer cleanup()
+	for _, query := range []interface{}{
+		elastic.ElasticSearchRequest{Query: map[string]interface{}{"query": map[string]interface{}{"fuzzy": map[string]string{"Name": "x"}}}},
+		elastic.ElasticSearchRequest{Query: map[string]interface{}{"aggs": map[string]interface{}{}}},
+		elastic.ElasticSearchRequest{Query: map[string]interface{}{"query": map[string]interface{}{"query_string": map[string]string{"query": "(Name:x"}}}},
+		"not a query",
+	} {
+		if _, err := conn.Query(query); err == nil {
+			t.Errorf("Expected an error for %v", query)
+		}
+	}
+}
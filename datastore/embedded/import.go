@@ -0,0 +1,45 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ErrNotEmpty is returned when importing into a store that has entities
+var ErrNotEmpty = errors.New("datastore is not empty")
+
+// Import copies the entities that export produces into an empty store, keeping
+// their versions, and returns how many there were.  Either every entity is
+// imported or none are.
+func (s *Store) Import(export func(put func(kind, id string, version int, data json.RawMessage) error) error) (int, error) {
+	if !s.Empty() {
+		return 0, ErrNotEmpty
+	}
+	count := 0
+	err := s.Update(func(tx *Tx) error {
+		return export(func(kind, id string, version int, data json.RawMessage) error {
+			if version < 1 {
+				version = 1
+			}
+			count++
+			return tx.Put(kind, id, version, data)
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,853 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/control-center/serviced/datastore/elastic"
+	"github.com/zenoss/elastigo/search"
+)
+
+// The domain stores build their queries for Elasticsearch.  Rather than give
+// every store a second implementation, requests are evaluated here with the
+// semantics they have against the controlplane index, where no field is
+// analyzed.  Only the parts of the query DSL that are in use are supported;
+// anything else is rejected rather than silently misinterpreted.
+
+// defaultSize is the number of hits Elasticsearch returns when a request does
+// not set a size.
+const defaultSize = 10
+
+// request is a search translated from an Elasticsearch request
+type request struct {
+	kinds   []string // empty for all kinds
+	match   matcher
+	fields  []string // nil to return whole entities
+	from    int
+	size    int
+	version bool
+}
+
+// document is an entity being matched
+type document struct {
+	kind   string
+	id     string
+	source map[string]interface{}
+}
+
+type matcher func(doc *document) bool
+
+func matchAll(*document) bool { return true }
+
+// parseRequest translates a query passed to Connection.Query
+func parseRequest(query interface{}) (*request, error) {
+	switch q := query.(type) {
+	case *search.SearchDsl:
+		return parseSearchDsl(q)
+	case elastic.ElasticSearchRequest:
+		req, err := parseBody(q.Query)
+		if err != nil {
+			return nil, err
+		}
+		if q.Type != "" && q.Type != "*" {
+			req.kinds = strings.Split(q.Type, ",")
+		}
+		return req, nil
+	default:
+		return nil, fmt.Errorf("invalid search type %v", reflect.ValueOf(query))
+	}
+}
+
+// parseSearchDsl reads a request built with elastigo.  The types and url
+// parameters of a SearchDsl are not exported, so they are read with reflection.
+func parseSearchDsl(q *search.SearchDsl) (*request, error) {
+	req, err := parseBody(q)
+	if err != nil {
+		return nil, err
+	}
+	v := reflect.ValueOf(q).Elem()
+	if types := v.FieldByName("types"); types.IsValid() {
+		for i := 0; i < types.Len(); i++ {
+			req.kinds = append(req.kinds, types.Index(i).String())
+		}
+	}
+	if args := v.FieldByName("args"); args.IsValid() {
+		param := func(name string) (string, bool) {
+			if vals := args.MapIndex(reflect.ValueOf(name)); vals.IsValid() && vals.Len() > 0 {
+				return vals.Index(0).String(), true
+			}
+			return "", false
+		}
+		if size, ok := param("size"); ok {
+			if req.size, err = strconv.Atoi(size); err != nil {
+				return nil, fmt.Errorf("invalid size %q", size)
+			}
+		}
+		if from, ok := param("from"); ok {
+			if req.from, err = strconv.Atoi(from); err != nil {
+				return nil, fmt.Errorf("invalid from %q", from)
+			}
+		}
+		if version, ok := param("version"); ok {
+			req.version = version == "true"
+		}
+	}
+	return req, nil
+}
+
+// parseBody translates the body of a search request
+func parseBody(body interface{}) (*request, error) {
+	var m map[string]interface{}
+	if err := decodeJSON(body, &m); err != nil {
+		return nil, fmt.Errorf("invalid search request: %s", err)
+	}
+	req := &request{match: matchAll, size: defaultSize}
+	var matchers []matcher
+	for key, val := range m {
+		var err error
+		switch key {
+		case "query", "filter", "post_filter":
+			var f matcher
+			if f, err = compile(val); err == nil {
+				matchers = append(matchers, f)
+			}
+		case "fields":
+			req.fields = []string{}
+			switch v := val.(type) {
+			case string:
+				req.fields = append(req.fields, v)
+			case []interface{}:
+				for _, f := range v {
+					req.fields = append(req.fields, fmt.Sprint(f))
+				}
+			default:
+				err = fmt.Errorf("invalid fields %v", val)
+			}
+		case "size":
+			req.size, err = toInt(val)
+		case "from":
+			req.from, err = toInt(val)
+		case "version":
+			req.version, _ = val.(bool)
+		default:
+			err = fmt.Errorf("unsupported search option %q", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(matchers) > 0 {
+		req.match = and(matchers)
+	}
+	return req, nil
+}
+
+// compile translates a query or filter clause.  Elasticsearch keeps queries
+// and filters apart, but on unanalyzed fields the ones in use behave alike.
+func compile(clause interface{}) (matcher, error) {
+	m, ok := clause.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid clause %v", clause)
+	}
+	if len(m) == 0 {
+		return matchAll, nil
+	}
+	var matchers []matcher
+	for name, arg := range m {
+		f, err := compileOp(name, arg)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, f)
+	}
+	return and(matchers), nil
+}
+
+// compileList translates a clause or a list of clauses
+func compileList(arg interface{}) ([]matcher, error) {
+	clauses, ok := arg.([]interface{})
+	if !ok {
+		clauses = []interface{}{arg}
+	}
+	matchers := make([]matcher, len(clauses))
+	for i, c := range clauses {
+		f, err := compile(c)
+		if err != nil {
+			return nil, err
+		}
+		matchers[i] = f
+	}
+	return matchers, nil
+}
+
+func compileOp(name string, arg interface{}) (matcher, error) {
+	switch name {
+	case "match_all":
+		return matchAll, nil
+	case "query", "fquery":
+		if m, ok := arg.(map[string]interface{}); ok {
+			if q, ok := m["query"]; ok && name == "fquery" {
+				return compile(q)
+			}
+		}
+		return compile(arg)
+	case "filtered":
+		m, ok := arg.(map[string]interface{})
+		if !ok {
+			break
+		}
+		var matchers []matcher
+		for _, key := range []string{"query", "filter"} {
+			if c, ok := m[key]; ok {
+				f, err := compile(c)
+				if err != nil {
+					return nil, err
+				}
+				matchers = append(matchers, f)
+			}
+		}
+		return and(matchers), nil
+	case "constant_score":
+		m, ok := arg.(map[string]interface{})
+		if !ok {
+			break
+		}
+		if c, ok := m["filter"]; ok {
+			return compile(c)
+		} else if c, ok := m["query"]; ok {
+			return compile(c)
+		}
+	case "and", "or":
+		if m, ok := arg.(map[string]interface{}); ok {
+			arg = m["filters"]
+		}
+		matchers, err := compileList(arg)
+		if err != nil {
+			return nil, err
+		}
+		if name == "or" {
+			return or(matchers, 1), nil
+		}
+		return and(matchers), nil
+	case "not":
+		if m, ok := arg.(map[string]interface{}); ok {
+			if c, ok := m["filter"]; ok {
+				arg = c
+			} else if c, ok := m["query"]; ok {
+				arg = c
+			}
+		}
+		f, err := compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		return not(f), nil
+	case "bool":
+		return compileBool(arg)
+	case "ids":
+		return compileIDs(arg)
+	case "type":
+		if m, ok := arg.(map[string]interface{}); ok {
+			kind := fmt.Sprint(m["value"])
+			return func(doc *document) bool { return doc.kind == kind }, nil
+		}
+	case "exists", "missing":
+		m, ok := arg.(map[string]interface{})
+		if !ok {
+			break
+		}
+		f := exists(fmt.Sprint(m["field"]))
+		if name == "missing" {
+			return not(f), nil
+		}
+		return f, nil
+	case "term", "terms", "prefix", "regexp", "wildcard", "range":
+		return compileFields(name, arg)
+	case "query_string":
+		return compileQueryString(arg)
+	}
+	return nil, fmt.Errorf("unsupported clause %q", name)
+}
+
+func compileBool(arg interface{}) (matcher, error) {
+	m, ok := arg.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid bool clause %v", arg)
+	}
+	var must, should, mustNot []matcher
+	minShould := -1
+	for key, val := range m {
+		var err error
+		switch key {
+		case "must", "filter":
+			var fs []matcher
+			fs, err = compileList(val)
+			must = append(must, fs...)
+		case "should":
+			should, err = compileList(val)
+		case "must_not":
+			mustNot, err = compileList(val)
+		case "minimum_should_match", "minimum_number_should_match":
+			minShould, err = toInt(val)
+		case "boost", "disable_coord", "_cache", "_name":
+		default:
+			err = fmt.Errorf("unsupported bool option %q", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	// should clauses are optional when there are required clauses
+	if minShould < 0 {
+		minShould = 0
+		if len(should) > 0 && len(must) == 0 && len(mustNot) == 0 {
+			minShould = 1
+		}
+	}
+	matchers := append([]matcher{}, must...)
+	for _, f := range mustNot {
+		matchers = append(matchers, not(f))
+	}
+	if minShould > 0 {
+		matchers = append(matchers, or(should, minShould))
+	}
+	return and(matchers), nil
+}
+
+func compileIDs(arg interface{}) (matcher, error) {
+	m, ok := arg.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid ids clause %v", arg)
+	}
+	ids := make(map[string]struct{})
+	values, _ := m["values"].([]interface{})
+	for _, v := range values {
+		ids[fmt.Sprint(v)] = struct{}{}
+	}
+	kinds := make(map[string]struct{})
+	switch t := m["type"].(type) {
+	case string:
+		kinds[t] = struct{}{}
+	case []interface{}:
+		for _, v := range t {
+			kinds[fmt.Sprint(v)] = struct{}{}
+		}
+	}
+	return func(doc *document) bool {
+		if len(kinds) > 0 {
+			if _, ok := kinds[doc.kind]; !ok {
+				return false
+			}
+		}
+		_, ok := ids[doc.id]
+		return ok
+	}, nil
+}
+
+// compileFields translates a clause of the form {op: {field: arg}}
+func compileFields(name string, arg interface{}) (matcher, error) {
+	m, ok := arg.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid %s clause %v", name, arg)
+	}
+	var matchers []matcher
+	for field, val := range m {
+		if strings.HasPrefix(field, "_") && field != "_id" && field != "_type" {
+			// options such as _cache and _name
+			continue
+		} else if name == "terms" && (field == "execution" || field == "minimum_should_match") {
+			continue
+		}
+		var f matcher
+		var err error
+		switch name {
+		case "term":
+			f = term(field, unwrap(val, "value", "term"))
+		case "terms":
+			values, ok := val.([]interface{})
+			if !ok {
+				values = []interface{}{val}
+			}
+			f = terms(field, values)
+		case "prefix":
+			prefix := fmt.Sprint(unwrap(val, "value", "prefix"))
+			f = leafMatch(field, func(s string) bool { return strings.HasPrefix(s, prefix) })
+		case "regexp":
+			f, err = regexpMatch(field, fmt.Sprint(unwrap(val, "value")))
+		case "wildcard":
+			f, err = wildcardMatch(field, fmt.Sprint(unwrap(val, "value", "wildcard")))
+		case "range":
+			f, err = rangeMatch(field, val)
+		}
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, f)
+	}
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("%s clause without a field", name)
+	}
+	return and(matchers), nil
+}
+
+// unwrap returns the value of the first key present when val is the long form
+// of a field clause, e.g. {"value": "x"}, and val otherwise
+func unwrap(val interface{}, keys ...string) interface{} {
+	if m, ok := val.(map[string]interface{}); ok {
+		for _, key := range keys {
+			if v, ok := m[key]; ok {
+				return v
+			}
+		}
+	}
+	return val
+}
+
+func term(field string, want interface{}) matcher {
+	return func(doc *document) bool {
+		for _, have := range doc.values(field) {
+			if equal(have, want) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func terms(field string, values []interface{}) matcher {
+	return func(doc *document) bool {
+		for _, have := range doc.values(field) {
+			for _, want := range values {
+				if equal(have, want) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+func exists(field string) matcher {
+	return func(doc *document) bool {
+		return len(doc.values(field)) > 0
+	}
+}
+
+// leafMatch matches when any scalar value of the field satisfies f
+func leafMatch(field string, f func(string) bool) matcher {
+	return func(doc *document) bool {
+		for _, have := range doc.values(field) {
+			if s, ok := scalar(have); ok && f(s) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// regexpMatch matches a whole value against a Lucene regular expression.  The
+// expressions in use are also valid RE2 syntax.
+func regexpMatch(field, pattern string) (matcher, error) {
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid regexp %q: %s", pattern, err)
+	}
+	return leafMatch(field, re.MatchString), nil
+}
+
+// wildcardMatch matches a whole value against a pattern where * matches any
+// sequence of characters and ? any single character
+func wildcardMatch(field, pattern string) (matcher, error) {
+	var buf bytes.Buffer
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			buf.WriteString(".*")
+		case r == '?':
+			buf.WriteString(".")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	re, err := regexp.Compile("^(?s:" + buf.String() + ")$")
+	if err != nil {
+		return nil, err
+	}
+	return leafMatch(field, re.MatchString), nil
+}
+
+func rangeMatch(field string, arg interface{}) (matcher, error) {
+	m, ok := arg.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid range for %s: %v", field, arg)
+	}
+	type bound struct {
+		value     interface{}
+		inclusive bool
+		lower     bool
+	}
+	var bounds []bound
+	includeLower, includeUpper := true, true
+	if v, ok := m["include_lower"].(bool); ok {
+		includeLower = v
+	}
+	if v, ok := m["include_upper"].(bool); ok {
+		includeUpper = v
+	}
+	for key, val := range m {
+		if val == nil {
+			continue
+		}
+		switch key {
+		case "gt":
+			bounds = append(bounds, bound{val, false, true})
+		case "gte":
+			bounds = append(bounds, bound{val, true, true})
+		case "lt":
+			bounds = append(bounds, bound{val, false, false})
+		case "lte":
+			bounds = append(bounds, bound{val, true, false})
+		case "from":
+			bounds = append(bounds, bound{val, includeLower, true})
+		case "to":
+			bounds = append(bounds, bound{val, includeUpper, false})
+		case "include_lower", "include_upper", "boost", "format", "_cache", "_name":
+		default:
+			return nil, fmt.Errorf("unsupported range option %q", key)
+		}
+	}
+	return func(doc *document) bool {
+	values:
+		for _, have := range doc.values(field) {
+			for _, b := range bounds {
+				c, ok := compare(have, b.value)
+				if !ok {
+					continue values
+				}
+				if b.lower && (c < 0 || c == 0 && !b.inclusive) {
+					continue values
+				} else if !b.lower && (c > 0 || c == 0 && !b.inclusive) {
+					continue values
+				}
+			}
+			return true
+		}
+		return false
+	}, nil
+}
+
+func and(matchers []matcher) matcher {
+	if len(matchers) == 1 {
+		return matchers[0]
+	}
+	return func(doc *document) bool {
+		for _, f := range matchers {
+			if !f(doc) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// or matches when at least min of the matchers do
+func or(matchers []matcher, min int) matcher {
+	return func(doc *document) bool {
+		count := 0
+		for _, f := range matchers {
+			if f(doc) {
+				if count++; count >= min {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+func not(f matcher) matcher {
+	return func(doc *document) bool { return !f(doc) }
+}
+
+// values returns the values of a field, which may be a path through nested
+// objects.  Arrays are flattened the way Elasticsearch indexes them.
+func (doc *document) values(field string) []interface{} {
+	switch field {
+	case "_id":
+		return []interface{}{doc.id}
+	case "_type":
+		return []interface{}{doc.kind}
+	}
+	var out []interface{}
+	collect(doc.source, strings.Split(field, "."), &out)
+	return out
+}
+
+func collect(v interface{}, path []string, out *[]interface{}) {
+	switch t := v.(type) {
+	case nil:
+	case []interface{}:
+		for _, e := range t {
+			collect(e, path, out)
+		}
+	case map[string]interface{}:
+		if len(path) == 0 {
+			*out = append(*out, t)
+		} else if next, ok := t[path[0]]; ok {
+			collect(next, path[1:], out)
+		}
+	default:
+		if len(path) == 0 {
+			*out = append(*out, t)
+		}
+	}
+}
+
+// leaves calls f with every scalar value in the document
+func (doc *document) leaves(f func(string) bool) bool {
+	var walk func(v interface{}) bool
+	walk = func(v interface{}) bool {
+		switch t := v.(type) {
+		case []interface{}:
+			for _, e := range t {
+				if walk(e) {
+					return true
+				}
+			}
+		case map[string]interface{}:
+			for _, e := range t {
+				if walk(e) {
+					return true
+				}
+			}
+		default:
+			if s, ok := scalar(t); ok {
+				return f(s)
+			}
+		}
+		return false
+	}
+	return walk(doc.source)
+}
+
+// project returns the requested fields of the document, the way
+// Elasticsearch returns them when a search names its fields
+func (doc *document) project(fields []string) map[string]interface{} {
+	out := make(map[string]interface{})
+	for _, field := range fields {
+		if !strings.Contains(field, ".") {
+			if v, ok := doc.source[field]; ok && v != nil {
+				out[field] = v
+			}
+			continue
+		}
+		switch values := doc.values(field); len(values) {
+		case 0:
+		case 1:
+			out[field] = values[0]
+		default:
+			out[field] = values
+		}
+	}
+	return out
+}
+
+// scalar returns the indexed form of a value
+func scalar(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case json.Number:
+		return t.String(), true
+	case bool:
+		return strconv.FormatBool(t), true
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(t), true
+	}
+	return "", false
+}
+
+// equal compares a stored value with a value from a query.  Numeric fields
+// match query values of any type that parse to the same number.
+func equal(have, want interface{}) bool {
+	h, ok := scalar(have)
+	if !ok {
+		return false
+	}
+	w, ok := scalar(want)
+	if !ok {
+		return false
+	}
+	if h == w {
+		return true
+	}
+	if _, isNum := have.(json.Number); isNum {
+		hf, err1 := strconv.ParseFloat(h, 64)
+		wf, err2 := strconv.ParseFloat(w, 64)
+		return err1 == nil && err2 == nil && hf == wf
+	}
+	return false
+}
+
+// compare orders a stored value against a bound as a number, a date or a
+// string, whichever both parse as
+func compare(have, bound interface{}) (int, bool) {
+	h, ok := scalar(have)
+	if !ok {
+		return 0, false
+	}
+	b, ok := scalar(bound)
+	if !ok {
+		return 0, false
+	}
+	if hf, err := strconv.ParseFloat(h, 64); err == nil {
+		if bf, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case hf < bf:
+				return -1, true
+			case hf > bf:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	if ht, err := time.Parse(time.RFC3339Nano, h); err == nil {
+		if bt, err := time.Parse(time.RFC3339Nano, b); err == nil {
+			switch {
+			case ht.Before(bt):
+				return -1, true
+			case ht.After(bt):
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	return strings.Compare(h, b), true
+}
+
+// tokens splits text the way the standard analyzer does for the _all field
+func tokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// containsTokens returns true if want appears as a run in have
+func containsTokens(have, want []string) bool {
+	for i := 0; i+len(want) <= len(have); i++ {
+		match := true
+		for j := range want {
+			if have[i+j] != want[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func toInt(v interface{}) (int, error) {
+	s, ok := scalar(v)
+	if !ok {
+		return 0, fmt.Errorf("invalid number %v", v)
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %v", v)
+	}
+	return i, nil
+}
+
+// decodeJSON converts v to its generic JSON form
+func decodeJSON(v interface{}, out interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(out)
+}
+
+// run evaluates the request against the entities in the transaction and
+// returns the hits in the order of their kinds and ids
+func (req *request) run(tx *Tx) ([]hit, error) {
+	kinds := req.kinds
+	if len(kinds) == 0 {
+		kinds = tx.Kinds()
+	} else {
+		kinds = append([]string{}, kinds...)
+		sort.Strings(kinds)
+	}
+	var hits []hit
+	skip := req.from
+	for _, kind := range kinds {
+		for _, id := range tx.IDs(kind) {
+			rec := tx.Get(kind, id)
+			if rec == nil || rec.source == nil {
+				continue
+			}
+			doc := &document{kind: kind, id: id, source: rec.source}
+			if !req.match(doc) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if len(hits) >= req.size {
+				return hits, nil
+			}
+			h := hit{data: rec.Data}
+			if req.version {
+				h.version = rec.Version
+			}
+			if req.fields != nil {
+				data, err := json.Marshal(doc.project(req.fields))
+				if err != nil {
+					return nil, err
+				}
+				h.data = data
+			}
+			hits = append(hits, h)
+		}
+	}
+	return hits, nil
+}
+
+type hit struct {
+	data    []byte
+	version int
+}
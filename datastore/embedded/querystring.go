@@ -0,0 +1,308 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// compileQueryString translates a query_string clause.  It understands field
+// terms (Field:value, Field:"quoted value", Field:wild*card), _exists_ and
+// _missing_, bare terms searched across every field, AND/OR/NOT (and && || !
+// + -) and parentheses.
+func compileQueryString(arg interface{}) (matcher, error) {
+	m, ok := arg.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid query_string clause %v", arg)
+	}
+	query, _ := m["query"].(string)
+	p := &qsParser{defaultAnd: false}
+	if field, ok := m["default_field"].(string); ok && field != "_all" {
+		p.defaultField = field
+	}
+	if op, ok := m["default_operator"].(string); ok {
+		p.defaultAnd = strings.EqualFold(op, "and")
+	}
+	var err error
+	if p.tokens, err = lexQueryString(query); err != nil {
+		return nil, err
+	}
+	if len(p.tokens) == 0 {
+		return matchAll, nil
+	}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in query %q", p.tokens[p.pos].text, query)
+	}
+	return f, nil
+}
+
+type qsTokenType int
+
+const (
+	qsTerm qsTokenType = iota
+	qsAnd
+	qsOr
+	qsNot
+	qsRequired
+	qsOpen
+	qsClose
+)
+
+type qsToken struct {
+	typ    qsTokenType
+	text   string
+	field  string
+	quoted bool
+}
+
+// lexQueryString splits a query into operators and terms
+func lexQueryString(query string) ([]qsToken, error) {
+	var toks []qsToken
+	rs := []rune(query)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			toks = append(toks, qsToken{typ: qsOpen, text: "("})
+			i++
+		case r == ')':
+			toks = append(toks, qsToken{typ: qsClose, text: ")"})
+			i++
+		case r == '!' || r == '-':
+			toks = append(toks, qsToken{typ: qsNot, text: string(r)})
+			i++
+		case r == '+':
+			toks = append(toks, qsToken{typ: qsRequired, text: "+"})
+			i++
+		case r == '&' && i+1 < len(rs) && rs[i+1] == '&':
+			toks = append(toks, qsToken{typ: qsAnd, text: "&&"})
+			i += 2
+		case r == '|' && i+1 < len(rs) && rs[i+1] == '|':
+			toks = append(toks, qsToken{typ: qsOr, text: "||"})
+			i += 2
+		default:
+			tok, n, err := lexTerm(rs[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%s in query %q", err, query)
+			}
+			if !tok.quoted && tok.field == "" {
+				switch tok.text {
+				case "AND":
+					tok.typ = qsAnd
+				case "OR":
+					tok.typ = qsOr
+				case "NOT":
+					tok.typ = qsNot
+				}
+			}
+			toks = append(toks, tok)
+			i += n
+		}
+	}
+	return toks, nil
+}
+
+// lexTerm reads a term, and the field it is qualified by, from the start of rs
+func lexTerm(rs []rune) (qsToken, int, error) {
+	tok := qsToken{typ: qsTerm}
+	i := 0
+	var buf []rune
+	for i < len(rs) {
+		r := rs[i]
+		if r == '\\' && i+1 < len(rs) {
+			buf = append(buf, rs[i+1])
+			i += 2
+			continue
+		}
+		if r == '"' {
+			end := i + 1
+			var quoted []rune
+			for ; end < len(rs) && rs[end] != '"'; end++ {
+				if rs[end] == '\\' && end+1 < len(rs) {
+					end++
+				}
+				quoted = append(quoted, rs[end])
+			}
+			if end >= len(rs) {
+				return tok, 0, fmt.Errorf("unterminated quote")
+			}
+			buf = append(buf, quoted...)
+			tok.quoted = true
+			i = end + 1
+			continue
+		}
+		if unicode.IsSpace(r) || r == '(' || r == ')' {
+			break
+		}
+		if r == ':' && tok.field == "" && !tok.quoted {
+			tok.field = string(buf)
+			buf = nil
+			i++
+			continue
+		}
+		buf = append(buf, r)
+		i++
+	}
+	tok.text = string(buf)
+	return tok, i, nil
+}
+
+type qsParser struct {
+	tokens       []qsToken
+	pos          int
+	defaultField string
+	defaultAnd   bool
+}
+
+func (p *qsParser) peek() *qsToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+// parseOr parses clauses joined by OR, or by nothing when the default
+// operator is OR
+func (p *qsParser) parseOr() (matcher, error) {
+	f, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	matchers := []matcher{f}
+	for {
+		tok := p.peek()
+		if tok == nil || tok.typ == qsClose {
+			break
+		}
+		if tok.typ == qsOr {
+			p.pos++
+		} else if p.defaultAnd {
+			return nil, fmt.Errorf("unexpected %q", tok.text)
+		}
+		f, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, f)
+	}
+	if len(matchers) == 1 {
+		return matchers[0], nil
+	}
+	return or(matchers, 1), nil
+}
+
+// parseAnd parses clauses joined by AND, or by nothing when the default
+// operator is AND
+func (p *qsParser) parseAnd() (matcher, error) {
+	f, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	matchers := []matcher{f}
+	for {
+		tok := p.peek()
+		if tok == nil || tok.typ == qsClose || tok.typ == qsOr {
+			break
+		}
+		if tok.typ == qsAnd {
+			p.pos++
+		} else if !p.defaultAnd {
+			break
+		}
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, f)
+	}
+	return and(matchers), nil
+}
+
+func (p *qsParser) parseUnary() (matcher, error) {
+	tok := p.peek()
+	if tok == nil {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	switch tok.typ {
+	case qsNot:
+		p.pos++
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return not(f), nil
+	case qsRequired:
+		p.pos++
+		return p.parseUnary()
+	case qsOpen:
+		p.pos++
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.peek(); tok == nil || tok.typ != qsClose {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return f, nil
+	case qsTerm:
+		p.pos++
+		return p.term(tok)
+	}
+	return nil, fmt.Errorf("unexpected %q", tok.text)
+}
+
+func (p *qsParser) term(tok *qsToken) (matcher, error) {
+	field := tok.field
+	if field == "" {
+		field = p.defaultField
+	}
+	switch field {
+	case "_exists_":
+		return exists(tok.text), nil
+	case "_missing_":
+		return not(exists(tok.text)), nil
+	case "":
+		return allFields(tok.text, tok.quoted), nil
+	}
+	if !tok.quoted && strings.ContainsAny(tok.text, "*?") {
+		return wildcardMatch(field, tok.text)
+	}
+	return term(field, tok.text), nil
+}
+
+// allFields searches every field of the document for the text, the way
+// Elasticsearch searches the analyzed _all field
+func allFields(text string, quoted bool) matcher {
+	if !quoted && text == "*" {
+		return matchAll
+	}
+	want := tokens(text)
+	if len(want) == 0 {
+		return func(*document) bool { return false }
+	}
+	return func(doc *document) bool {
+		return doc.leaves(func(s string) bool {
+			return containsTokens(tokens(s), want)
+		})
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package embedded is a datastore backend that keeps control-plane entities in
+// a local bbolt database instead of an Elasticsearch index.  Each kind of
+// entity is a bucket, keyed by id, and every committed transaction is synced
+// to disk before it becomes visible.
+package embedded
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/logging"
+	bolt "go.etcd.io/bbolt"
+)
+
+var plog = logging.PackageLogger()
+
+const (
+	dbFile = "datastore.db"
+
+	// lockTimeout is how long to wait for another process to release the
+	// database
+	lockTimeout = time.Second
+)
+
+var (
+	// ErrClosed is returned when the store has been closed
+	ErrClosed = errors.New("datastore is closed")
+	// ErrLocked is returned when another process has the store open
+	ErrLocked = errors.New("datastore is in use by another process")
+	// ErrReadOnly is returned when a read-only transaction tries to write
+	ErrReadOnly = errors.New("read-only transaction")
+)
+
+// Record is a stored entity and its version
+type Record struct {
+	Version int             `json:"version"`
+	Data    json.RawMessage `json:"data"`
+
+	source map[string]interface{} // decoded Data, used to evaluate queries
+}
+
+// Store is a bbolt database of entities grouped by kind
+type Store struct {
+	mu sync.RWMutex
+	db *bolt.DB
+}
+
+// Open loads the store at path, creating it if it does not exist.  Only one
+// process may have the store open at a time.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(path, 0750); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(filepath.Join(path, dbFile), 0640, &bolt.Options{Timeout: lockTimeout})
+	if err == bolt.ErrTimeout {
+		return nil, ErrLocked
+	} else if err != nil {
+		return nil, err
+	}
+	plog.WithField("path", path).Debug("Opened datastore")
+	return &Store{db: db}, nil
+}
+
+// Close releases the store
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db == nil {
+		return nil
+	}
+	err := s.db.Close()
+	s.db = nil
+	return err
+}
+
+// Empty returns true if nothing has ever been stored
+func (s *Store) Empty() bool {
+	empty := true
+	s.View(func(tx *Tx) error {
+		empty = len(tx.Kinds()) == 0
+		return nil
+	})
+	return empty
+}
+
+// View runs f in a read-only transaction
+func (s *Store) View(f func(tx *Tx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.db == nil {
+		return ErrClosed
+	}
+	return s.db.View(func(btx *bolt.Tx) error {
+		return f(&Tx{tx: btx})
+	})
+}
+
+// Update runs f in a read-write transaction.  The writes f makes are
+// committed atomically if f returns nil and discarded otherwise.
+func (s *Store) Update(f func(tx *Tx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.db == nil {
+		return ErrClosed
+	}
+	return s.db.Update(func(btx *bolt.Tx) error {
+		return f(&Tx{tx: btx})
+	})
+}
+
+// decode parses the record's data so it can be searched
+func (r *Record) decode(kind, id string) {
+	dec := json.NewDecoder(bytes.NewReader(r.Data))
+	dec.UseNumber()
+	if err := dec.Decode(&r.source); err != nil {
+		plog.WithFields(log.Fields{
+			"kind": kind,
+			"id":   id,
+		}).WithError(err).Warn("Could not parse entity; it will not match any query")
+		r.source = nil
+	}
+}
+
+// Tx is a transaction on the store.  Writes made in a transaction are visible
+// to reads in the same transaction.
+type Tx struct {
+	tx *bolt.Tx
+}
+
+// Get returns the record for the entity or nil if it does not exist
+func (tx *Tx) Get(kind, id string) *Record {
+	b := tx.tx.Bucket([]byte(kind))
+	if b == nil {
+		return nil
+	}
+	data := b.Get([]byte(id))
+	if data == nil {
+		return nil
+	}
+	// the data is only valid during the transaction, but unmarshaling copies
+	// it
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		plog.WithFields(log.Fields{
+			"kind": kind,
+			"id":   id,
+		}).WithError(err).Warn("Could not read entity")
+		return nil
+	}
+	rec.decode(kind, id)
+	return &rec
+}
+
+// Put stores the entity at the given version
+func (tx *Tx) Put(kind, id string, version int, data []byte) error {
+	if !tx.tx.Writable() {
+		return ErrReadOnly
+	}
+	value, err := json.Marshal(&Record{Version: version, Data: json.RawMessage(data)})
+	if err != nil {
+		return err
+	}
+	b, err := tx.tx.CreateBucketIfNotExists([]byte(kind))
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(id), value)
+}
+
+// Delete removes the entity
+func (tx *Tx) Delete(kind, id string) error {
+	if !tx.tx.Writable() {
+		return ErrReadOnly
+	}
+	b := tx.tx.Bucket([]byte(kind))
+	if b == nil {
+		return nil
+	}
+	return b.Delete([]byte(id))
+}
+
+// Kinds returns the kinds that have entities, in order
+func (tx *Tx) Kinds() []string {
+	kinds := []string{}
+	tx.tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		if k, _ := b.Cursor().First(); k != nil {
+			kinds = append(kinds, string(name))
+		}
+		return nil
+	})
+	return kinds
+}
+
+// IDs returns the ids of the entities of a kind, in order
+func (tx *Tx) IDs(kind string) []string {
+	ids := []string{}
+	if b := tx.tx.Bucket([]byte(kind)); b != nil {
+		b.ForEach(func(id, _ []byte) error {
+			ids = append(ids, string(id))
+			return nil
+		})
+	}
+	return ids
+}
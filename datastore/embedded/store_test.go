@@ -0,0 +1,174 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package embedded
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTestStore(t *testing.T) (*Store, string) {
+	dir, err := ioutil.TempDir("", "embedded-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, dir
+}
+
+func put(t *testing.T, s *Store, kind, id string, version int, data string) {
+	if err := s.Update(func(tx *Tx) error {
+		return tx.Put(kind, id, version, []byte(data))
+	}); err != nil {
+		t.Fatalf("Could not put %s/%s: %s", kind, id, err)
+	}
+}
+
+func get(t *testing.T, s *Store, kind, id string) *Record {
+	var rec *Record
+	if err := s.View(func(tx *Tx) error {
+		rec = tx.Get(kind, id)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestReopen(t *testing.T) {
+	s, dir := openTestStore(t)
+	defer os.RemoveAll(dir)
+	if !s.Empty() {
+		t.Errorf("New store is not empty")
+	}
+	put(t, s, "host", "a", 1, `{"ID":"a"}`)
+	put(t, s, "host", "b", 1, `{"ID":"b"}`)
+	put(t, s, "host", "a", 2, `{"ID":"a","Name":"x"}`)
+	if err := s.Update(func(tx *Tx) error { return tx.Delete("host", "b") }); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if rec := get(t, s, "host", "a"); rec == nil || rec.Version != 2 || string(rec.Data) != `{"ID":"a","Name":"x"}` {
+		t.Errorf("Unexpected record after reopening: %+v", rec)
+	} else if rec.source["Name"] != "x" {
+		t.Errorf("Record was not decoded after reopening: %+v", rec.source)
+	}
+	if rec := get(t, s, "host", "b"); rec != nil {
+		t.Errorf("Deleted record came back: %+v", rec)
+	}
+}
+
+func TestUpdateIsAtomic(t *testing.T) {
+	s, dir := openTestStore(t)
+	defer os.RemoveAll(dir)
+	defer s.Close()
+	put(t, s, "pool", "default", 1, `{}`)
+	failed := errors.New("failed")
+	err := s.Update(func(tx *Tx) error {
+		tx.Put("pool", "other", 1, []byte(`{}`))
+		tx.Delete("pool", "default")
+		if tx.Get("pool", "default") != nil || tx.Get("pool", "other") == nil {
+			t.Errorf("Transaction does not see its own writes")
+		}
+		return failed
+	})
+	if err != failed {
+		t.Errorf("Expected %s, got %v", failed, err)
+	}
+	if get(t, s, "pool", "default") == nil || get(t, s, "pool", "other") != nil {
+		t.Errorf("Failed transaction changed the store")
+	}
+	if err := s.View(func(tx *Tx) error { return tx.Put("pool", "x", 1, []byte(`{}`)) }); err != ErrReadOnly {
+		t.Errorf("Expected %s, got %v", ErrReadOnly, err)
+	}
+}
+
+func TestCorruptDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "embedded-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, dbFile), []byte("garbage"), 0640)
+	if s, err := Open(dir); err == nil {
+		s.Close()
+		t.Errorf("Expected an error opening a corrupt database")
+	}
+}
+
+func TestLocked(t *testing.T) {
+	s, dir := openTestStore(t)
+	defer os.RemoveAll(dir)
+	if other, err := Open(dir); err != ErrLocked {
+		if err == nil {
+			other.Close()
+		}
+		t.Errorf("Expected %s, got %v", ErrLocked, err)
+	}
+	s.Close()
+	if err := s.Update(func(*Tx) error { return nil }); err != ErrClosed {
+		t.Errorf("Expected %s, got %v", ErrClosed, err)
+	}
+	other, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Could not open store after it was closed: %s", err)
+	}
+	other.Close()
+}
+
+func TestImport(t *testing.T) {
+	s, dir := openTestStore(t)
+	defer os.RemoveAll(dir)
+	defer s.Close()
+	docs := []struct {
+		kind, id string
+		version  int
+	}{{"host", "a", 3}, {"pool", "default", 0}}
+	count, err := s.Import(func(put func(string, string, int, json.RawMessage) error) error {
+		for _, d := range docs {
+			if err := put(d.kind, d.id, d.version, json.RawMessage(`{}`)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || count != 2 {
+		t.Fatalf("Import returned %d, %v", count, err)
+	}
+	if rec := get(t, s, "host", "a"); rec == nil || rec.Version != 3 {
+		t.Errorf("Version was not kept: %+v", rec)
+	}
+	if rec := get(t, s, "pool", "default"); rec == nil || rec.Version != 1 {
+		t.Errorf("Unversioned entity was not given a version: %+v", rec)
+	}
+	if _, err := s.Import(func(func(string, string, int, json.RawMessage) error) error { return nil }); err != ErrNotEmpty {
+		t.Errorf("Expected %s, got %v", ErrNotEmpty, err)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package migration reshapes stored entities when their schema changes.
+// Migrations are registered by entity kind and schema version, and the
+// version each kind has been migrated to is kept in the stored properties
+// next to the CC version.
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/control-center/serviced/coordinator/client"
+	"github.com/control-center/serviced/logging"
+)
+
+var plog = logging.PackageLogger()
+
+// lockPath is the coordinator lock masters hold while migrating
+const lockPath = "/locks/migration"
+
+var (
+	// ErrNoKind is returned when a migration has no entity kind
+	ErrNoKind = errors.New("migration has no entity kind")
+	// ErrNoUp is returned when a migration has no Up function
+	ErrNoUp = errors.New("migration has no Up function")
+	// ErrNoDown is returned when rolling back a migration that has no Down
+	// function
+	ErrNoDown = errors.New("migration cannot be rolled back")
+)
+
+// Entity is a stored entity in its generic JSON form.  Numbers are
+// json.Numbers so they keep their precision.
+type Entity map[string]interface{}
+
+// Migration moves the entities of a kind from the schema version before
+// Version to Version.  Up and Down change the entity in place and return
+// whether they changed it.  They must leave an entity that is already in the
+// shape they produce alone, because a migration that failed part way is run
+// again from the start.
+type Migration struct {
+	Kind        string
+	Version     int
+	Description string
+	Up          func(e Entity) (bool, error)
+	Down        func(e Entity) (bool, error)
+
+	// ID returns the id the entity is stored under; by default its ID field
+	ID func(e Entity) string
+}
+
+func (m Migration) id(e Entity) string {
+	if m.ID != nil {
+		return m.ID(e)
+	}
+	return fmt.Sprint(e["ID"])
+}
+
+// Registry holds the migrations for each entity kind, in version order
+type Registry struct {
+	mu         sync.RWMutex
+	migrations map[string][]Migration
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{migrations: make(map[string][]Migration)}
+}
+
+// Register adds a migration.  Migrations of a kind are registered in order,
+// starting with version 1.
+func (r *Registry) Register(m Migration) error {
+	if m.Kind == "" {
+		return ErrNoKind
+	} else if m.Up == nil {
+		return ErrNoUp
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if next := len(r.migrations[m.Kind]) + 1; m.Version != next {
+		return fmt.Errorf("migration %d of %s registered out of order; expected version %d", m.Version, m.Kind, next)
+	}
+	r.migrations[m.Kind] = append(r.migrations[m.Kind], m)
+	return nil
+}
+
+// Kinds returns the kinds that have migrations, in order
+func (r *Registry) Kinds() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	kinds := make([]string, 0, len(r.migrations))
+	for kind := range r.migrations {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Latest returns the schema version of a kind once all its migrations ran
+func (r *Registry) Latest(kind string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.migrations[kind])
+}
+
+// get returns the migration of a kind to a version
+func (r *Registry) get(kind string, version int) Migration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.migrations[kind][version-1]
+}
+
+var defaultRegistry = NewRegistry()
+
+// Default returns the registry the domain packages register migrations with
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Register adds a migration to the default registry.  It is meant to be
+// called from init functions and panics if the migration is invalid.
+func Register(m Migration) {
+	if err := defaultRegistry.Register(m); err != nil {
+		panic(err)
+	}
+}
+
+// Lock returns the lock masters hold while migrating, so only one of them
+// migrates at a time
+func Lock(conn client.Connection) (client.Lock, error) {
+	return conn.NewLock(lockPath)
+}
@@ -0,0 +1,289 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package migration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/control-center/serviced/datastore"
+	"github.com/control-center/serviced/datastore/embedded"
+	"github.com/control-center/serviced/domain/properties"
+)
+
+// renameName moves the Name field of a widget to Title
+var renameName = Migration{
+	Kind:        "widget",
+	Version:     1,
+	Description: "Rename Name to Title",
+	Up: func(e Entity) (bool, error) {
+		name, ok := e["Name"]
+		if !ok {
+			return false, nil
+		}
+		e["Title"] = name
+		delete(e, "Name")
+		return true, nil
+	},
+	Down: func(e Entity) (bool, error) {
+		title, ok := e["Title"]
+		if !ok {
+			return false, nil
+		}
+		e["Name"] = title
+		delete(e, "Title")
+		return true, nil
+	},
+}
+
+// doubleSize doubles the Size field of a widget and fails on widget "bad"
+var doubleSize = Migration{
+	Kind:    "widget",
+	Version: 2,
+	Up: func(e Entity) (bool, error) {
+		if e["ID"] == "bad" {
+			return false, errors.New("bad widget")
+		}
+		size, _ := e["Size"].(json.Number).Int64()
+		e["Size"] = size * 2
+		return true, nil
+	},
+}
+
+type testEnv struct {
+	ctx   datastore.Context
+	store *embedded.Store
+	dir   string
+}
+
+func setUp(t *testing.T, widgets ...string) *testEnv {
+	dir, err := ioutil.TempDir("", "migration-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := embedded.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	datastore.Register(embedded.New(store))
+	env := &testEnv{ctx: datastore.Get(), store: store, dir: dir}
+	// the master records the CC version before it migrates
+	props := properties.New()
+	props.SetCCVersion("1.0.0")
+	if err := properties.NewStore().Put(env.ctx, props); err != nil {
+		t.Fatal(err)
+	}
+	conn, _ := env.ctx.Connection()
+	for i, id := range widgets {
+		data := fmt.Sprintf(`{"ID":%q,"Name":"widget %d","Size":%d}`, id, i, i+1)
+		if err := conn.Put(datastore.NewKey("widget", id), datastore.NewJSONMessage([]byte(data), 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return env
+}
+
+func (env *testEnv) tearDown() {
+	env.store.Close()
+	os.RemoveAll(env.dir)
+}
+
+func (env *testEnv) widget(t *testing.T, id string) map[string]interface{} {
+	conn, _ := env.ctx.Connection()
+	msg, err := conn.Get(datastore.NewKey("widget", id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w map[string]interface{}
+	json.Unmarshal(msg.Bytes(), &w)
+	return w
+}
+
+func (env *testEnv) version(t *testing.T) int {
+	props, err := properties.NewStore().Get(env.ctx)
+	if datastore.IsErrNoSuchEntity(err) {
+		return 0
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return props.SchemaVersion("widget")
+}
+
+func TestRegister(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register(Migration{Version: 1, Up: renameName.Up}); err != ErrNoKind {
+		t.Errorf("Expected %s, got %v", ErrNoKind, err)
+	}
+	if err := r.Register(Migration{Kind: "widget", Version: 1}); err != ErrNoUp {
+		t.Errorf("Expected %s, got %v", ErrNoUp, err)
+	}
+	if err := r.Register(doubleSize); err == nil {
+		t.Errorf("Expected an error registering version 2 before version 1")
+	}
+	if err := r.Register(renameName); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(renameName); err == nil {
+		t.Errorf("Expected an error registering version 1 twice")
+	}
+	if r.Latest("widget") != 1 || r.Latest("gadget") != 0 {
+		t.Errorf("Unexpected latest versions %d, %d", r.Latest("widget"), r.Latest("gadget"))
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	env := setUp(t, "a", "b")
+	defer env.tearDown()
+	r := NewRegistry()
+	r.Register(renameName)
+	runner := NewRunner(r, properties.NewStore())
+
+	// a dry run reports the changes without making them
+	results, err := runner.Migrate(env.ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].To != 1 || len(results[0].Changed) != 2 {
+		t.Errorf("Unexpected dry run results %+v", results)
+	}
+	if w := env.widget(t, "a"); w["Name"] != "widget 0" || env.version(t) != 0 {
+		t.Errorf("Dry run changed the datastore: %v", w)
+	}
+
+	results, err = runner.Migrate(env.ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || len(results[0].Changed) != 2 {
+		t.Errorf("Unexpected results %+v", results)
+	}
+	if w := env.widget(t, "a"); w["Title"] != "widget 0" || w["Name"] != nil {
+		t.Errorf("Widget was not migrated: %v", w)
+	}
+	if v := env.version(t); v != 1 {
+		t.Errorf("Expected schema version 1, got %d", v)
+	}
+
+	// migrations only run once
+	if results, err = runner.Migrate(env.ctx, false); err != nil || len(results) != 0 {
+		t.Errorf("Expected nothing to migrate, got %+v, %v", results, err)
+	}
+
+	// the CC version is kept
+	props, _ := properties.NewStore().Get(env.ctx)
+	props.SetCCVersion("1.2.3")
+	properties.NewStore().Put(env.ctx, props)
+	r.Register(Migration{Kind: "widget", Version: 2, Up: func(Entity) (bool, error) { return false, nil }})
+	if _, err := runner.Migrate(env.ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	props, _ = properties.NewStore().Get(env.ctx)
+	if v, _ := props.CCVersion(); v != "1.2.3" || props.SchemaVersion("widget") != 2 {
+		t.Errorf("Unexpected properties %v", props.Props)
+	}
+}
+
+func TestMigrateFailureRestores(t *testing.T) {
+	env := setUp(t, "a", "bad", "c")
+	defer env.tearDown()
+	r := NewRegistry()
+	r.Register(renameName)
+	r.Register(doubleSize)
+	runner := NewRunner(r, properties.NewStore())
+
+	results, err := runner.Migrate(env.ctx, false)
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+	if len(results) != 1 || results[0].To != 1 {
+		t.Errorf("Expected only the first step to finish, got %+v", results)
+	}
+	if v := env.version(t); v != 1 {
+		t.Errorf("Expected schema version 1, got %d", v)
+	}
+	// the widget migrated before the failure was restored
+	if w := env.widget(t, "a"); w["Size"] != 1.0 || w["Title"] != "widget 0" {
+		t.Errorf("Widget was not restored: %v", w)
+	}
+}
+
+func TestMigrateTooManyEntities(t *testing.T) {
+	env := setUp(t, "a", "b", "c")
+	defer env.tearDown()
+	defer func(limit int) { queryLimit = limit }(queryLimit)
+	queryLimit = 2
+	r := NewRegistry()
+	r.Register(renameName)
+	runner := NewRunner(r, properties.NewStore())
+
+	if _, err := runner.Migrate(env.ctx, false); err == nil {
+		t.Fatalf("Expected an error")
+	}
+	if v := env.version(t); v != 0 {
+		t.Errorf("Expected schema version 0, got %d", v)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if w := env.widget(t, id); w["Title"] != nil {
+			t.Errorf("Widget %s was migrated: %v", id, w)
+		}
+	}
+}
+
+func TestRollback(t *testing.T) {
+	env := setUp(t, "a")
+	defer env.tearDown()
+	r := NewRegistry()
+	r.Register(renameName)
+	r.Register(Migration{Kind: "widget", Version: 2, Up: func(Entity) (bool, error) { return false, nil }})
+	runner := NewRunner(r, properties.NewStore())
+	if _, err := runner.Migrate(env.ctx, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// version 2 has no Down
+	if _, err := runner.Rollback(env.ctx, "widget", 0, false); err == nil {
+		t.Errorf("Expected an error rolling back a migration without Down")
+	}
+	if _, err := runner.Rollback(env.ctx, "widget", 3, false); err == nil {
+		t.Errorf("Expected an error rolling forward")
+	}
+
+	r = NewRegistry()
+	r.Register(renameName)
+	r.Register(Migration{Kind: "widget", Version: 2, Up: func(Entity) (bool, error) { return false, nil }, Down: func(Entity) (bool, error) { return false, nil }})
+	runner = NewRunner(r, properties.NewStore())
+	results, err := runner.Rollback(env.ctx, "widget", 0, true)
+	if err != nil || len(results) != 2 || env.version(t) != 2 {
+		t.Errorf("Unexpected dry run rollback: %+v, %v", results, err)
+	}
+	results, err = runner.Rollback(env.ctx, "widget", 0, false)
+	if err != nil || len(results) != 2 {
+		t.Fatalf("Unexpected rollback: %+v, %v", results, err)
+	}
+	if results[1].From != 1 || results[1].To != 0 || len(results[1].Changed) != 1 {
+		t.Errorf("Unexpected rollback step %+v", results[1])
+	}
+	if w := env.widget(t, "a"); w["Name"] != "widget 0" || w["Title"] != nil {
+		t.Errorf("Widget was not rolled back: %v", w)
+	}
+	if v := env.version(t); v != 0 {
+		t.Errorf("Expected schema version 0, got %d", v)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/datastore"
+	"github.com/control-center/serviced/datastore/elastic"
+	"github.com/control-center/serviced/domain/properties"
+)
+
+// queryLimit is the most entities of a kind that can be migrated.  A step
+// over a kind with more fails rather than leave the rest behind.
+var queryLimit = 50000
+
+// Result describes a migration step that ran, or would run on a dry run
+type Result struct {
+	Kind        string
+	From        int
+	To          int
+	Description string
+	Changed     []string // ids of the entities that were changed
+}
+
+// Runner applies the migrations in a registry to the datastore
+type Runner struct {
+	registry *Registry
+	store    properties.Store
+}
+
+// NewRunner returns a runner that keeps schema versions in the store
+func NewRunner(registry *Registry, store properties.Store) *Runner {
+	return &Runner{registry: registry, store: store}
+}
+
+// Pending returns the steps Migrate would run, without running them
+func (r *Runner) Pending(ctx datastore.Context) ([]Result, error) {
+	props, err := r.properties(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var results []Result
+	for _, kind := range r.registry.Kinds() {
+		for v := props.SchemaVersion(kind) + 1; v <= r.registry.Latest(kind); v++ {
+			m := r.registry.get(kind, v)
+			results = append(results, Result{Kind: kind, From: v - 1, To: v, Description: m.Description})
+		}
+	}
+	return results, nil
+}
+
+// Migrate brings every kind up to its latest schema version.  Each step is
+// recorded as soon as it finishes; if a step fails, the entities it changed
+// are restored and the error is returned.  On a dry run, the steps are
+// evaluated but nothing is written.
+func (r *Runner) Migrate(ctx datastore.Context, dryRun bool) ([]Result, error) {
+	pending, err := r.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results := []Result{}
+	for _, step := range pending {
+		m := r.registry.get(step.Kind, step.To)
+		if step.Changed, err = r.apply(ctx, m, m.Up, step.To, dryRun); err != nil {
+			return results, fmt.Errorf("could not migrate %s to schema version %d: %s", step.Kind, step.To, err)
+		}
+		results = append(results, step)
+	}
+	return results, nil
+}
+
+// Rollback takes the entities of a kind back to an earlier schema version by
+// running the Down functions of the migrations after it, newest first
+func (r *Runner) Rollback(ctx datastore.Context, kind string, version int, dryRun bool) ([]Result, error) {
+	props, err := r.properties(ctx)
+	if err != nil {
+		return nil, err
+	}
+	current := props.SchemaVersion(kind)
+	if version < 0 || version > current {
+		return nil, fmt.Errorf("cannot roll %s back from schema version %d to %d", kind, current, version)
+	}
+	for v := current; v > version; v-- {
+		if r.registry.get(kind, v).Down == nil {
+			return nil, fmt.Errorf("could not roll back %s to schema version %d: %s", kind, v-1, ErrNoDown)
+		}
+	}
+	results := []Result{}
+	for v := current; v > version; v-- {
+		m := r.registry.get(kind, v)
+		step := Result{Kind: kind, From: v, To: v - 1, Description: m.Description}
+		if step.Changed, err = r.apply(ctx, m, m.Down, v-1, dryRun); err != nil {
+			return results, fmt.Errorf("could not roll back %s to schema version %d: %s", kind, v-1, err)
+		}
+		results = append(results, step)
+	}
+	return results, nil
+}
+
+// apply runs f over the entities of the migration's kind and records the new
+// schema version
+func (r *Runner) apply(ctx datastore.Context, m Migration, f func(Entity) (bool, error), version int, dryRun bool) ([]string, error) {
+	logger := plog.WithFields(log.Fields{
+		"kind":    m.Kind,
+		"version": version,
+		"dryrun":  dryRun,
+	})
+	conn, err := ctx.Connection()
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := conn.Query(elastic.ElasticSearchRequest{
+		Index: "controlplane",
+		Type:  m.Kind,
+		Query: map[string]interface{}{
+			"query":   map[string]interface{}{"match_all": map[string]interface{}{}},
+			"size":    queryLimit + 1,
+			"version": true,
+		},
+	})
+	if err != nil {
+		return nil, err
+	} else if len(msgs) > queryLimit {
+		logger.WithField("limit", queryLimit).Debug("Too many entities to migrate")
+		return nil, fmt.Errorf("more than %d entities", queryLimit)
+	}
+
+	var written []original
+	changed := []string{}
+	for _, msg := range msgs {
+		var e Entity
+		dec := json.NewDecoder(bytes.NewReader(msg.Bytes()))
+		dec.UseNumber()
+		if err := dec.Decode(&e); err != nil {
+			err = fmt.Errorf("could not read entity: %s", err)
+			r.restore(conn, written)
+			return nil, err
+		}
+		id := m.id(e)
+		ok, err := f(e)
+		if err != nil {
+			err = fmt.Errorf("%s %s: %s", m.Kind, id, err)
+			r.restore(conn, written)
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		changed = append(changed, id)
+		logger.WithField("id", id).Debug("Migrating entity")
+		if dryRun {
+			continue
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			r.restore(conn, written)
+			return nil, err
+		}
+		key := datastore.NewKey(m.Kind, id)
+		if err := conn.Put(key, datastore.NewJSONMessage(data, msg.Version())); err != nil {
+			err = fmt.Errorf("%s %s: %s", m.Kind, id, err)
+			r.restore(conn, written)
+			return nil, err
+		}
+		written = append(written, original{key, msg.Bytes()})
+	}
+
+	if !dryRun {
+		if err := r.setVersion(ctx, m.Kind, version); err != nil {
+			r.restore(conn, written)
+			return nil, err
+		}
+	}
+	logger.WithField("changed", len(changed)).Info("Migrated schema")
+	return changed, nil
+}
+
+// original is an entity as it was before a migration step changed it
+type original struct {
+	key  datastore.Key
+	data []byte
+}
+
+// restore puts back the entities a failed step changed
+func (r *Runner) restore(conn datastore.Connection, written []original) {
+	for i := len(written) - 1; i >= 0; i-- {
+		o := written[i]
+		logger := plog.WithFields(log.Fields{
+			"kind": o.key.Kind(),
+			"id":   o.key.ID(),
+		})
+		current, err := conn.Get(o.key)
+		if err != nil {
+			logger.WithError(err).Error("Could not restore entity after a failed migration")
+			continue
+		}
+		if err := conn.Put(o.key, datastore.NewJSONMessage(o.data, current.Version())); err != nil {
+			logger.WithError(err).Error("Could not restore entity after a failed migration")
+			continue
+		}
+		logger.Debug("Restored entity after a failed migration")
+	}
+}
+
+// properties returns the stored properties, which do not exist before the
+// first start
+func (r *Runner) properties(ctx datastore.Context) (*properties.StoredProperties, error) {
+	props, err := r.store.Get(ctx)
+	if datastore.IsErrNoSuchEntity(err) {
+		return properties.New(), nil
+	} else if err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+func (r *Runner) setVersion(ctx datastore.Context, kind string, version int) error {
+	props, err := r.properties(ctx)
+	if err != nil {
+		return err
+	}
+	props.SetSchemaVersion(kind, version)
+	return r.store.Put(ctx, props)
+}
@@ -0,0 +1,285 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dfs
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/commons"
+	"github.com/control-center/serviced/domain/logfilter"
+	"github.com/control-center/serviced/domain/registry"
+	"github.com/control-center/serviced/domain/service"
+)
+
+// AppMetadataFile is the first entry of an application archive
+const AppMetadataFile = ".APPINFO"
+
+var (
+	ErrInvalidApp        = errors.New("archive is not an application export")
+	ErrInvalidAppVersion = errors.New("application archive has an invalid version")
+)
+
+// AppInfo describes a single tenant application in an archive.  Service
+// configuration files are stored on the services.
+type AppInfo struct {
+	TenantID   string
+	Snapshot   string
+	Services   []service.Service
+	LogFilters []logfilter.LogFilter
+	Timestamp  time.Time
+	AppVersion int
+}
+
+// ExportApp writes a tenant application, the snapshot of its volume and the
+// images of the snapshot into an archive.  The archive has the same layout as
+// a backup, with the application metadata in place of the backup metadata.
+func (dfs *DistributedFilesystem) ExportApp(info AppInfo, w io.Writer) error {
+	logger := plog.WithFields(log.Fields{
+		"tenant":   info.TenantID,
+		"snapshot": info.Snapshot,
+	})
+	vol, snapshot, err := dfs.getSnapshotVolumeAndInfo(info.Snapshot)
+	if err != nil {
+		return err
+	}
+	images, err := dfs.ReplicaImages(info.Snapshot)
+	if err != nil {
+		return err
+	}
+
+	tarOut := tar.NewWriter(w)
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err := tarOut.WriteHeader(&tar.Header{Name: AppMetadataFile, Mode: 0644, Size: int64(len(data))}); err != nil {
+		return err
+	}
+	if _, err := tarOut.Write(data); err != nil {
+		return err
+	}
+
+	prefix := path.Join(SnapshotsMetadataDir, info.TenantID, snapshot.Label)
+	snapReader, errc := dfs.snapshotSavePipe(vol, snapshot.Label, nil)
+	if err := rewriteTar(prefix, tarOut, snapReader); err != nil {
+		<-errc
+		logger.WithError(err).Error("Could not write snapshot to application archive")
+		return err
+	} else if err := <-errc; err != nil {
+		logger.WithError(err).Error("Could not export snapshot for application archive")
+		return err
+	}
+
+	names := make([]string, len(images))
+	for i, image := range images {
+		names[i] = image.Name
+	}
+	imageReader, errc := dfs.dockerSavePipe(names...)
+	if err := rewriteTar(DockerImagesFile, tarOut, imageReader); err != nil {
+		<-errc
+		logger.WithError(err).Error("Could not write images to application archive")
+		return err
+	} else if err := <-errc; err != nil {
+		logger.WithError(err).Error("Could not export images for application archive")
+		return err
+	}
+	if err := tarOut.Close(); err != nil {
+		return err
+	}
+	logger.WithField("images", names).Info("Exported application")
+	return nil
+}
+
+// ImportApp loads an archive written by ExportApp.  The metadata of the
+// archive is passed to remap before any data is loaded, so the application
+// can be given a different tenant id.  The snapshot of the application is
+// imported under the (remapped) tenant, with the services of the remapped
+// metadata, and its images are added to the registry of that tenant.
+func (dfs *DistributedFilesystem) ImportApp(r io.Reader, remap func(*AppInfo) error) (*AppInfo, error) {
+	tarfile := tar.NewReader(r)
+	header, err := tarfile.Next()
+	if err != nil || header.Name != AppMetadataFile {
+		return nil, ErrInvalidApp
+	}
+	var info AppInfo
+	if err := json.NewDecoder(tarfile).Decode(&info); err != nil {
+		plog.WithError(err).Error("Could not decode application metadata")
+		return nil, ErrInvalidApp
+	}
+	if info.AppVersion != 1 {
+		return nil, ErrInvalidAppVersion
+	}
+	oldTenantID, oldSnapshotID := info.TenantID, info.Snapshot
+	label := strings.TrimPrefix(oldSnapshotID, oldTenantID+"_")
+	if err := remap(&info); err != nil {
+		return nil, err
+	}
+	info.Snapshot = info.TenantID + "_" + label
+	logger := plog.WithFields(log.Fields{
+		"tenant":   info.TenantID,
+		"snapshot": info.Snapshot,
+	})
+
+	// rename the entries of the snapshot export, which are prefixed with the
+	// snapshot id.
+	rename := func(name string) string {
+		if strings.HasPrefix(name, oldSnapshotID) {
+			return info.Snapshot + strings.TrimPrefix(name, oldSnapshotID)
+		}
+		return name
+	}
+
+	type stream struct {
+		tarwriter *tar.Writer
+		writer    *io.PipeWriter
+		errc      <-chan error
+	}
+	var snapshotStream, imageStream *stream
+	closeStream := func(s *stream, err error) error {
+		if err != nil {
+			s.writer.CloseWithError(err)
+		} else {
+			s.tarwriter.Close()
+			s.writer.Close()
+		}
+		return <-s.errc
+	}
+	err = func() error {
+		for {
+			hdr, err := tarfile.Next()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			var s *stream
+			switch {
+			case strings.HasPrefix(hdr.Name, SnapshotsMetadataDir):
+				parts := strings.SplitN(hdr.Name, "/", 4)
+				if len(parts) <= 3 {
+					continue
+				}
+				if snapshotStream == nil {
+					writer, errc := dfs.snapshotLoadPipe(info.TenantID, label)
+					snapshotStream = &stream{tar.NewWriter(writer), writer, errc}
+				}
+				s = snapshotStream
+				hdr.Name = rename(parts[3])
+				if hdr.Typeflag == tar.TypeLink {
+					hdr.Linkname = rename(hdr.Linkname)
+				}
+			case strings.HasPrefix(hdr.Name, DockerImagesFile):
+				parts := strings.SplitN(hdr.Name, "/", 2)
+				if len(parts) <= 1 {
+					continue
+				}
+				if imageStream == nil {
+					writer, errc := dfs.imageLoadPipe()
+					imageStream = &stream{tar.NewWriter(writer), writer, errc}
+				}
+				s = imageStream
+				hdr.Name = parts[1]
+			default:
+				logger.WithField("name", hdr.Name).Warn("Unrecognized file")
+				continue
+			}
+			if err := s.tarwriter.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := io.Copy(s.tarwriter, tarfile); err != nil {
+				return err
+			}
+		}
+	}()
+	for _, s := range []*stream{imageStream, snapshotStream} {
+		if s != nil {
+			if e := closeStream(s, err); err == nil {
+				err = e
+			}
+		}
+	}
+	if err != nil {
+		logger.WithError(err).Error("Could not import application")
+		return nil, err
+	} else if snapshotStream == nil {
+		return nil, ErrInvalidApp
+	}
+	if err := dfs.loadAppImages(&info, label); err != nil {
+		return nil, err
+	}
+	logger.Info("Imported application")
+	return &info, nil
+}
+
+// loadAppImages adds the images of an imported snapshot to the registry of
+// its tenant, and updates the metadata of the snapshot to match.
+func (dfs *DistributedFilesystem) loadAppImages(info *AppInfo, label string) error {
+	vol, err := dfs.disk.Get(info.TenantID)
+	if err != nil {
+		return err
+	}
+	r, err := vol.ReadMetadata(label, ImagesMetadataFile)
+	if err != nil {
+		return err
+	}
+	var images []string
+	if err := importJSON(r, &images); err != nil {
+		return err
+	}
+	paths := make([]string, len(images))
+	for i, image := range images {
+		imageLogger := plog.WithField("image", image)
+		img, err := dfs.docker.FindImage(image)
+		if err != nil {
+			imageLogger.WithError(err).Error("Could not find image from application archive")
+			return err
+		}
+		hash, err := dfs.docker.GetImageHash(img.ID)
+		if err != nil {
+			imageLogger.WithError(err).Error("Could not get hash for image")
+			return err
+		}
+		imageID, err := commons.ParseImageID(image)
+		if err != nil {
+			return err
+		}
+		rImage := (&registry.Image{Library: info.TenantID, Repo: imageID.Repo, Tag: label}).String()
+		if err := dfs.index.PushImage(rImage, img.ID, hash); err != nil {
+			imageLogger.WithError(err).Error("Could not push image into the registry")
+			return err
+		}
+		if paths[i], err = dfs.reg.ImagePath(rImage); err != nil {
+			return err
+		}
+	}
+	w, err := vol.WriteMetadata(label, ImagesMetadataFile)
+	if err != nil {
+		return err
+	}
+	if err := exportJSON(w, paths); err != nil {
+		return err
+	}
+	w, err = vol.WriteMetadata(label, ServicesMetadataFile)
+	if err != nil {
+		return err
+	}
+	return exportJSON(w, info.Services)
+}
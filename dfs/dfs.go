@@ -39,6 +39,10 @@ type DFS interface {
 	Timeout() time.Duration
 	// Create sets up a new application
 	Create(tenantID string) error
+	// SetQuota limits the space an application may use on the dfs
+	SetQuota(tenantID string, size uint64) error
+	// CanLowerQuota returns false if a quota cannot be set lower than it was
+	CanLowerQuota() bool
 	// Destroy removes an existing application
 	Destroy(tenantID string) error
 	// Download adds an image for an application into the registry
@@ -59,14 +63,45 @@ type DFS interface {
 	Backup(info BackupInfo, w io.Writer) error
 	// Restore restores the system to the state of the backup
 	Restore(r io.Reader, version int) error
+	// RestoreWithProgress restores the system to the state of the backup,
+	// reporting its progress to the job
+	RestoreWithProgress(r io.Reader, version int, job *RestoreJob) error
 	// BackupInfo provides detailed info for a particular backup
 	BackupInfo(r io.Reader) (*BackupInfo, error)
+	// VerifyBackup test-restores a backup and reports its problems
+	VerifyBackup(r io.Reader) (*BackupReport, error)
 	// Tag adds a tag to an existing snapshot
 	Tag(snapshotID string, tagName string) error
 	// Untag removes a tag from an existing snapshot
 	Untag(tenantID, tagName string) (string, error)
 	// TagInfo provides detailed info for a particular snapshot by given tag
 	TagInfo(tenantID, tagName string) (*SnapshotInfo, error)
+	// ListFiles lists the files at a path in a snapshot
+	ListFiles(snapshotID, path string) ([]volume.SnapshotFile, error)
+	// Diff returns the files that changed between two snapshots
+	Diff(fromSnapshotID, toSnapshotID, path string) ([]volume.SnapshotChange, error)
+	// RestorePath restores a file or directory from a snapshot
+	RestorePath(snapshotID, path, dest string) (int, error)
+	// ReplicaStatus returns the snapshots of every tenant on this host
+	ReplicaStatus() (*ReplicaStatus, error)
+	// ReplicaFormat returns the best format to send a snapshot to a standby
+	ReplicaFormat(snapshotID, parentID string, standby volume.DriverType) (string, error)
+	// SendReplica writes a snapshot for a standby master
+	SendReplica(snapshotID, parentID, format string, w io.Writer) error
+	// ReceiveReplica loads a snapshot sent by the primary master
+	ReceiveReplica(tenantID, snapshotID, format string, r io.Reader) error
+	// ReplicaImages returns the images that a snapshot needs
+	ReplicaImages(snapshotID string) ([]ReplicaImage, error)
+	// MissingImages returns the ids of the images that are not on this host
+	MissingImages(ids []string) ([]string, error)
+	// SaveImages writes docker images to a stream
+	SaveImages(images []string, w io.Writer) error
+	// LoadImages loads docker images from a stream
+	LoadImages(r io.Reader) error
+	// ExportApp writes a tenant application into an archive
+	ExportApp(info AppInfo, w io.Writer) error
+	// ImportApp loads an application archive under a (remapped) tenant
+	ImportApp(r io.Reader, remap func(*AppInfo) error) (*AppInfo, error)
 	// UpgradeRegistry loads images for each service
 	// into the docker registry index
 	UpgradeRegistry(svcs []service.ServiceDetails, tenantID, registryHost string, override bool) error
@@ -80,6 +115,9 @@ type DFS interface {
 	DfPath(path string, excludes []string) (uint64, error)
 	// Verifies that the mount points are correct. Returns nil if there are no problems.
 	VerifyTenantMounts(tenantID string) (err error)
+	// CollectRegistryGarbage removes images that are not referenced by a
+	// service or snapshot from the docker registry
+	CollectRegistryGarbage(images []string, dryRun bool) (*RegistryGCReport, error)
 }
 
 var _ = DFS(&DistributedFilesystem{})
@@ -111,10 +149,11 @@ type DistributedFilesystem struct {
 	disk   volume.Driver
 	// FIXME: replace this with a NFS server, instead of restarting the
 	// daemon
-	net     storage.StorageDriver
-	timeout time.Duration
-	locker  *csync.TimedMutex
-	tmp     string // tmp directory where backups are temporarily spooled
+	net       storage.StorageDriver
+	timeout   time.Duration
+	locker    *csync.TimedMutex
+	tmp       string             // tmp directory where backups are temporarily spooled
+	collector registry.Collector // deletes data from the docker registry
 }
 
 // ImageInfo provides meta info about a Docker image
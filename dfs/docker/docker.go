@@ -52,6 +52,8 @@ func IsImageNotFound(err error) bool {
 			regexp.MustCompile("(?i)could not find image"),
 			regexp.MustCompile("(?i)no such id"),
 			regexp.MustCompile("(?i)no such image"),
+			regexp.MustCompile("(?i)manifest for .* not found"),
+			regexp.MustCompile("(?i)manifest unknown"),
 		}
 		for _, check := range checks {
 			if ok := check.MatchString(err.Error()); ok {
@@ -80,7 +82,8 @@ type Docker interface {
 }
 
 type DockerClient struct {
-	dc *dockerclient.Client
+	dc    *dockerclient.Client
+	auths map[string]dockerclient.AuthConfiguration
 }
 
 func NewDockerClient() (*DockerClient, error) {
@@ -88,7 +91,20 @@ func NewDockerClient() (*DockerClient, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &DockerClient{dc}, nil
+	return &DockerClient{dc: dc}, nil
+}
+
+// SetRegistryAuth sets the credentials for pushing to and pulling from a
+// registry (host:port), in place of those in the docker config file.
+func (d *DockerClient) SetRegistryAuth(registry, username, password string) {
+	if d.auths == nil {
+		d.auths = make(map[string]dockerclient.AuthConfiguration)
+	}
+	d.auths[registry] = dockerclient.AuthConfiguration{
+		Username:      username,
+		Password:      password,
+		ServerAddress: registry,
+	}
 }
 
 func (d *DockerClient) FindImage(image string) (*dockerclient.Image, error) {
@@ -237,6 +253,11 @@ func (d *DockerClient) fetchCreds(registry string) (auth dockerclient.AuthConfig
 		registry = DefaultRegistry
 	}
 
+	if auth, ok := d.auths[registry]; ok {
+		plog.WithField("registry", registry).Debug("Authorized in registry with configured credentials")
+		return auth
+	}
+
 	auths, err := dockerclient.NewAuthConfigurationsFromDockerCfg()
 	if err != nil {
 		return
@@ -153,6 +153,23 @@ func (s *DockerSuite) TestPushImage(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (s *DockerSuite) TestPushImageNamespace(c *C) {
+	image := "localhost:5000/serviced/tenant/busybox:push"
+	defer s.dc.RemoveImage(image)
+	s.docker.SetRegistryAuth("localhost:5000", "", "")
+	defer func() { s.docker.auths = nil }()
+	err := s.docker.TagImage("busybox", image)
+	c.Assert(err, IsNil)
+	err = s.docker.PushImage(image)
+	c.Assert(err, IsNil)
+	err = s.dc.RemoveImage(image)
+	c.Assert(err, IsNil)
+	err = s.docker.PullImage(image)
+	c.Assert(err, IsNil)
+	_, err = s.dc.InspectImage(image)
+	c.Assert(err, IsNil)
+}
+
 func (s *DockerSuite) TestPullImage(c *C) {
 	defer s.dc.RemoveImage("localhost:5000/busybox:pull")
 	err := s.docker.PullImage("localhost:5000/busybox:pull")
@@ -0,0 +1,452 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build integration,!quick
+
+package dfs_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	coordclient "github.com/control-center/serviced/coordinator/client"
+	"github.com/control-center/serviced/coordinator/client/zookeeper"
+	"github.com/control-center/serviced/datastore"
+	. "github.com/control-center/serviced/dfs"
+	"github.com/control-center/serviced/dfs/docker"
+	index "github.com/control-center/serviced/dfs/registry"
+	"github.com/control-center/serviced/domain/pool"
+	"github.com/control-center/serviced/domain/registry"
+	"github.com/control-center/serviced/domain/service"
+	"github.com/control-center/serviced/volume"
+	_ "github.com/control-center/serviced/volume/rsync"
+	"github.com/control-center/serviced/zzk"
+	zkservice "github.com/control-center/serviced/zzk/service"
+	zzktest "github.com/control-center/serviced/zzk/test"
+	dockerclient "github.com/fsouza/go-dockerclient"
+
+	. "gopkg.in/check.v1"
+)
+
+/*
+* Runs the dfs against a docker registry:2 that requires authentication and
+* TLS, with the images under a namespace, and with resource pools that pull
+* from registries of their own.
+ */
+
+const (
+	extRegistryName     = "extregtestserver"
+	extRegistryImage    = "registry:2"
+	extRegistryUser     = "serviced"
+	extRegistryPassword = "secret"
+	extRegistryTenant   = "tenantid"
+)
+
+var _ = Suite(&ExternalRegistrySuite{})
+
+type ExternalRegistrySuite struct {
+	dc        *dockerclient.Client
+	zzkServer *zzktest.ZZKServer
+	conn      coordclient.Connection
+	regid     string
+	host      string // host:port of the registry
+	caFile    string
+	docker    *docker.DockerClient
+	listener  *index.RegistryListener
+	shutdown  chan interface{}
+	done      chan struct{}
+	dfs       *DistributedFilesystem
+}
+
+func (s *ExternalRegistrySuite) SetUpSuite(c *C) {
+	var err error
+	s.dc, err = dockerclient.NewClient(docker.DefaultSocket)
+	if err != nil {
+		c.Fatalf("Could not connect to docker client: %s", err)
+	}
+
+	// Start zookeeper
+	s.zzkServer = &zzktest.ZZKServer{}
+	if err := s.zzkServer.Start(); err != nil {
+		c.Fatalf("Could not start zookeeper: %s", err)
+	}
+	dsn := zookeeper.NewDSN([]string{fmt.Sprintf("localhost:%d", s.zzkServer.Port)},
+		15*time.Second,
+		1*time.Second,
+		0,
+		1*time.Second,
+		1*time.Second,
+	).String()
+	zkclient, err := coordclient.New("zookeeper", dsn, "/", nil)
+	if err != nil {
+		c.Fatalf("Could not establish the zookeeper client: %s", err)
+	}
+	s.conn, err = zkclient.GetCustomConnection("/")
+	if err != nil {
+		c.Fatalf("Could not create a connection to the zookeeper client: %s", err)
+	}
+
+	// Start the docker registry with a self-signed certificate and a user
+	certDir := c.MkDir()
+	if err := writeRegistryCertificate(certDir); err != nil {
+		c.Fatalf("Could not create a certificate for the docker registry: %s", err)
+	}
+	s.caFile = filepath.Join(certDir, "cert.pem")
+	htpasswd, err := exec.Command("docker", "run", "--rm", "--entrypoint", "htpasswd", "httpd:2", "-Bbn", extRegistryUser, extRegistryPassword).Output()
+	if err != nil {
+		c.Fatalf("Could not create the htpasswd file of the docker registry: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(certDir, "htpasswd"), bytes.TrimSpace(htpasswd), 0644); err != nil {
+		c.Fatalf("Could not write the htpasswd file of the docker registry: %s", err)
+	}
+	if ctr, err := s.dc.InspectContainer(extRegistryName); err == nil {
+		s.dc.RemoveContainer(dockerclient.RemoveContainerOptions{ID: ctr.ID, RemoveVolumes: true, Force: true})
+	}
+	if err := s.dc.PullImage(dockerclient.PullImageOptions{Repository: "registry", Tag: "2"}, dockerclient.AuthConfiguration{}); err != nil {
+		c.Fatalf("Could not pull %s: %s", extRegistryImage, err)
+	}
+	opts := dockerclient.CreateContainerOptions{Name: extRegistryName}
+	opts.Config = &dockerclient.Config{
+		Image: extRegistryImage,
+		Env: []string{
+			"REGISTRY_HTTP_TLS_CERTIFICATE=/certs/cert.pem",
+			"REGISTRY_HTTP_TLS_KEY=/certs/key.pem",
+			"REGISTRY_AUTH=htpasswd",
+			"REGISTRY_AUTH_HTPASSWD_REALM=serviced",
+			"REGISTRY_AUTH_HTPASSWD_PATH=/certs/htpasswd",
+		},
+	}
+	opts.HostConfig = &dockerclient.HostConfig{
+		Binds: []string{certDir + ":/certs"},
+		PortBindings: map[dockerclient.Port][]dockerclient.PortBinding{
+			"5000/tcp": []dockerclient.PortBinding{
+				{HostIP: "127.0.0.1"},
+			},
+		},
+	}
+	ctr, err := s.dc.CreateContainer(opts)
+	if err != nil {
+		c.Fatalf("Could not initialize docker registry: %s", err)
+	}
+	s.regid = ctr.ID
+	if err := s.dc.StartContainer(ctr.ID, nil); err != nil {
+		c.Fatalf("Could not start docker registry: %s", err)
+	}
+	if ctr, err = s.dc.InspectContainer(ctr.ID); err != nil {
+		c.Fatalf("Could not inspect docker registry: %s", err)
+	}
+	bindings := ctr.NetworkSettings.Ports["5000/tcp"]
+	if len(bindings) == 0 {
+		c.Fatalf("Docker registry did not publish its port")
+	}
+	// docker trusts registries on 127.0.0.0/8 without verifying their
+	// certificate, so only the collector needs the certificate authority
+	s.host = fmt.Sprintf("127.0.0.1:%s", bindings[0].HostPort)
+	timeout := time.After(30 * time.Second)
+	for {
+		if _, err := s.collector(c, s.address()).ManifestDigest("ping", "latest"); err == index.ErrManifestNotFound {
+			break
+		}
+		select {
+		case <-timeout:
+			c.Fatalf("Docker registry at %s did not start", s.host)
+		case <-time.After(time.Second):
+		}
+	}
+
+	s.docker, err = docker.NewDockerClient()
+	if err != nil {
+		c.Fatalf("Could not connect to docker: %s", err)
+	}
+	s.docker.SetRegistryAuth(s.host, extRegistryUser, extRegistryPassword)
+}
+
+func (s *ExternalRegistrySuite) TearDownSuite(c *C) {
+	if s.regid != "" {
+		s.dc.StopContainer(s.regid, 10)
+		s.dc.RemoveContainer(dockerclient.RemoveContainerOptions{ID: s.regid, RemoveVolumes: true, Force: true})
+	}
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.zzkServer.Stop()
+}
+
+func (s *ExternalRegistrySuite) SetUpTest(c *C) {
+	s.conn.CreateDir("/docker/registry/tags")
+
+	// Start the push listener of the master
+	s.listener = index.NewRegistryListener(s.docker, s.address(), "master")
+	s.shutdown = make(chan interface{})
+	s.done = make(chan struct{})
+	ready := make(chan error, 1)
+	go func() {
+		defer close(s.done)
+		zzk.Listen(s.shutdown, ready, s.conn, s.listener)
+	}()
+	if err := <-ready; err != nil {
+		c.Fatalf("Could not start the registry listener: %s", err)
+	}
+
+	root := c.MkDir()
+	if err := volume.InitDriver(volume.DriverTypeRsync, root, []string{}); err != nil {
+		c.Fatalf("Could not initialize the volume driver: %s", err)
+	}
+	disk, err := volume.GetDriver(root)
+	if err != nil {
+		c.Fatalf("Could not get the volume driver: %s", err)
+	}
+	if _, err := disk.Create(extRegistryTenant); err != nil {
+		c.Fatalf("Could not create the tenant volume: %s", err)
+	}
+	s.dfs = NewDistributedFilesystem(s.docker, index.NewRegistryIndexClient(newRegistryFacade(s.conn)), s.listener, disk, nil, 2*time.Minute)
+}
+
+func (s *ExternalRegistrySuite) TearDownTest(c *C) {
+	close(s.shutdown)
+	<-s.done
+	s.conn.Delete("/docker/registry")
+	s.conn.Delete("/pools")
+}
+
+// address returns the address of the master's registry
+func (s *ExternalRegistrySuite) address() string {
+	return path.Join(s.host, "serviced")
+}
+
+func (s *ExternalRegistrySuite) collector(c *C, address string) *index.RegistryCollector {
+	collector := index.NewRegistryCollector(address, nil)
+	collector.SetCredentials(extRegistryUser, extRegistryPassword)
+	if err := collector.SetTLS(s.caFile); err != nil {
+		c.Fatalf("Could not trust the certificate of the docker registry: %s", err)
+	}
+	return collector
+}
+
+// waitForManifest waits for the registry at address to serve repo:tag
+func (s *ExternalRegistrySuite) waitForManifest(c *C, address, repo, tag string) {
+	collector := s.collector(c, address)
+	timeout := time.After(2 * time.Minute)
+	for {
+		_, err := collector.ManifestDigest(repo, tag)
+		if err == nil {
+			return
+		} else if err != index.ErrManifestNotFound {
+			c.Fatalf("Could not look up %s:%s in %s: %s", repo, tag, address, err)
+		}
+		select {
+		case <-timeout:
+			c.Fatalf("Image %s:%s was not pushed into %s", repo, tag, address)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (s *ExternalRegistrySuite) createPool(c *C, poolID string) string {
+	address := path.Join(s.host, poolID)
+	err := zkservice.UpdateResourcePool(s.conn, pool.ResourcePool{ID: poolID, Registry: address})
+	c.Assert(err, IsNil)
+	return address
+}
+
+// removeImage removes every local tag of an image, so that it has to be
+// pulled from a registry.
+func (s *ExternalRegistrySuite) removeImage(c *C, imageID string) {
+	err := exec.Command("docker", "rmi", "-f", imageID).Run()
+	c.Assert(err, IsNil)
+}
+
+func (s *ExternalRegistrySuite) TestExternalRegistry(c *C) {
+	pool1 := s.createPool(c, "pool1")
+	repo := extRegistryTenant + "/busybox"
+
+	// push an image of the tenant
+	rImage, err := s.dfs.Download("busybox:latest", extRegistryTenant, false)
+	c.Assert(err, IsNil)
+	c.Assert(rImage, Equals, repo+":latest")
+	img, err := s.docker.FindImage("busybox:latest")
+	c.Assert(err, IsNil)
+	s.waitForManifest(c, s.address(), repo, "latest")
+	s.waitForManifest(c, pool1, repo, "latest")
+
+	// tag it for a snapshot
+	image := path.Join(s.address(), rImage)
+	snapshotID, err := s.dfs.Snapshot(SnapshotInfo{
+		SnapshotInfo: &volume.SnapshotInfo{TenantID: extRegistryTenant, Message: "external registry"},
+		Images:       []string{image},
+	}, 0)
+	c.Assert(err, IsNil)
+	info, err := s.dfs.Info(snapshotID)
+	c.Assert(err, IsNil)
+	s.waitForManifest(c, s.address(), repo, info.Label)
+	s.waitForManifest(c, pool1, repo, info.Label)
+
+	// fill the registry of a pool that was set up afterwards
+	pool2 := s.createPool(c, "pool2")
+	svcs := []service.ServiceDetails{{ID: "serviceid", Name: "service", ImageID: image}}
+	err = s.dfs.UpgradeRegistry(svcs, extRegistryTenant, "", true)
+	c.Assert(err, IsNil)
+	s.waitForManifest(c, pool2, repo, "latest")
+	s.waitForManifest(c, pool2, repo, info.Label)
+
+	// hosts of a pool pull from its registry
+	s.removeImage(c, img.ID)
+	pullreg := index.NewRegistryListener(s.docker, s.address(), "host")
+	pullreg.SetPoolID("pool1")
+	pullreg.SetConnection(s.conn)
+	err = pullreg.PullImage(time.After(time.Minute), image)
+	c.Assert(err, IsNil)
+	poolImage, err := pullreg.ImagePath(image)
+	c.Assert(err, IsNil)
+	c.Assert(poolImage, Equals, path.Join(pool1, rImage))
+	_, err = s.docker.FindImage(poolImage)
+	c.Assert(err, IsNil)
+
+	// export a backup, pulling the image of the snapshot from the registry
+	s.removeImage(c, img.ID)
+	buf := &bytes.Buffer{}
+	err = s.dfs.Backup(BackupInfo{Snapshots: []string{snapshotID}, Timestamp: time.Now().UTC()}, buf)
+	c.Assert(err, IsNil)
+	snapshotImage := path.Join(s.address(), repo) + ":" + info.Label
+	tarIn := tar.NewReader(buf)
+	found := false
+	for {
+		header, err := tarIn.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+		if header.Name != DockerImagesFile {
+			continue
+		}
+		// docker save lists the tags of the images in its manifest
+		imagesIn := tar.NewReader(tarIn)
+		for {
+			header, err := imagesIn.Next()
+			if err == io.EOF {
+				break
+			}
+			c.Assert(err, IsNil)
+			if header.Name == "manifest.json" {
+				data, err := ioutil.ReadAll(imagesIn)
+				c.Assert(err, IsNil)
+				found = strings.Contains(string(data), snapshotImage)
+			}
+		}
+	}
+	c.Assert(found, Equals, true)
+}
+
+// registryFacade keeps the registry index in memory and writes it into the
+// coordinator, as the facade does.
+type registryFacade struct {
+	mu     sync.Mutex
+	conn   coordclient.Connection
+	images map[string]registry.Image
+}
+
+func newRegistryFacade(conn coordclient.Connection) *registryFacade {
+	return &registryFacade{conn: conn, images: make(map[string]registry.Image)}
+}
+
+func (f *registryFacade) GetRegistryImage(ctx datastore.Context, image string) (*registry.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rImage, ok := f.images[image]
+	if !ok {
+		return nil, datastore.ErrNoSuchEntity{Key: registry.Key(image)}
+	}
+	return &rImage, nil
+}
+
+func (f *registryFacade) SetRegistryImage(ctx datastore.Context, rImage *registry.Image) error {
+	f.mu.Lock()
+	f.images[rImage.String()] = *rImage
+	f.mu.Unlock()
+	return index.SetRegistryImage(f.conn, *rImage)
+}
+
+func (f *registryFacade) DeleteRegistryImage(ctx datastore.Context, image string) error {
+	f.mu.Lock()
+	delete(f.images, image)
+	f.mu.Unlock()
+	return index.DeleteRegistryImage(f.conn, registry.Key(image).ID())
+}
+
+func (f *registryFacade) GetRegistryImages(ctx datastore.Context) ([]registry.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rImages := []registry.Image{}
+	for _, rImage := range f.images {
+		rImages = append(rImages, rImage)
+	}
+	return rImages, nil
+}
+
+func (f *registryFacade) SearchRegistryLibraryByTag(ctx datastore.Context, library, tag string) ([]registry.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rImages := []registry.Image{}
+	for _, rImage := range f.images {
+		if rImage.Library == library && rImage.Tag == tag {
+			rImages = append(rImages, rImage)
+		}
+	}
+	return rImages, nil
+}
+
+// writeRegistryCertificate writes a self-signed certificate for 127.0.0.1
+// and its key into dir.
+func writeRegistryCertificate(dir string) error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := ioutil.WriteFile(filepath.Join(dir, "cert.pem"), certPEM, 0644); err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return ioutil.WriteFile(filepath.Join(dir, "key.pem"), keyPEM, 0600)
+}
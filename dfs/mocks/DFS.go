@@ -8,6 +8,7 @@ import "time"
 
 import (
 	"github.com/control-center/serviced/domain/service"
+	"github.com/control-center/serviced/volume"
 )
 
 type DFS struct {
@@ -57,6 +58,34 @@ func (_m *DFS) Create(tenantID string) error {
 	return r0
 }
 
+// SetQuota provides a mock function with given fields: tenantID, size
+func (_m *DFS) SetQuota(tenantID string, size uint64) error {
+	ret := _m.Called(tenantID, size)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, uint64) error); ok {
+		r0 = rf(tenantID, size)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CanLowerQuota provides a mock function with given fields:
+func (_m *DFS) CanLowerQuota() bool {
+	ret := _m.Called()
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func() bool); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
 // Destroy provides a mock function with given fields: tenantID
 func (_m *DFS) Destroy(tenantID string) error {
 	ret := _m.Called(tenantID)
@@ -185,6 +214,43 @@ func (_m *DFS) List(tenantID string) ([]string, error) {
 	return r0, r1
 }
 
+// ExportApp provides a mock function with given fields: info, w
+func (_m *DFS) ExportApp(info dfs.AppInfo, w io.Writer) error {
+	ret := _m.Called(info, w)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(dfs.AppInfo, io.Writer) error); ok {
+		r0 = rf(info, w)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ImportApp provides a mock function with given fields: r, remap
+func (_m *DFS) ImportApp(r io.Reader, remap func(*dfs.AppInfo) error) (*dfs.AppInfo, error) {
+	ret := _m.Called(r, remap)
+
+	var r0 *dfs.AppInfo
+	if rf, ok := ret.Get(0).(func(io.Reader, func(*dfs.AppInfo) error) *dfs.AppInfo); ok {
+		r0 = rf(r, remap)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*dfs.AppInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(io.Reader, func(*dfs.AppInfo) error) error); ok {
+		r1 = rf(r, remap)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Info provides a mock function with given fields: snapshotID
 func (_m *DFS) Info(snapshotID string) (*dfs.SnapshotInfo, error) {
 	ret := _m.Called(snapshotID)
@@ -236,6 +302,20 @@ func (_m *DFS) Restore(r io.Reader, version int) error {
 	return r0
 }
 
+// RestoreWithProgress provides a mock function with given fields: r, version, job
+func (_m *DFS) RestoreWithProgress(r io.Reader, version int, job *dfs.RestoreJob) error {
+	ret := _m.Called(r, version, job)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(io.Reader, int, *dfs.RestoreJob) error); ok {
+		r0 = rf(r, version, job)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // BackupInfo provides a mock function with given fields: r
 func (_m *DFS) BackupInfo(r io.Reader) (*dfs.BackupInfo, error) {
 	ret := _m.Called(r)
@@ -259,6 +339,29 @@ func (_m *DFS) BackupInfo(r io.Reader) (*dfs.BackupInfo, error) {
 	return r0, r1
 }
 
+// VerifyBackup provides a mock function with given fields: r
+func (_m *DFS) VerifyBackup(r io.Reader) (*dfs.BackupReport, error) {
+	ret := _m.Called(r)
+
+	var r0 *dfs.BackupReport
+	if rf, ok := ret.Get(0).(func(io.Reader) *dfs.BackupReport); ok {
+		r0 = rf(r)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*dfs.BackupReport)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(io.Reader) error); ok {
+		r1 = rf(r)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Tag provides a mock function with given fields: snapshotID, tagName
 func (_m *DFS) Tag(snapshotID string, tagName string) error {
 	ret := _m.Called(snapshotID, tagName)
@@ -317,6 +420,219 @@ func (_m *DFS) TagInfo(tenantID string, tagName string) (*dfs.SnapshotInfo, erro
 	return r0, r1
 }
 
+// ListFiles provides a mock function with given fields: snapshotID, path
+func (_m *DFS) ListFiles(snapshotID string, path string) ([]volume.SnapshotFile, error) {
+	ret := _m.Called(snapshotID, path)
+
+	var r0 []volume.SnapshotFile
+	if rf, ok := ret.Get(0).(func(string, string) []volume.SnapshotFile); ok {
+		r0 = rf(snapshotID, path)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]volume.SnapshotFile)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(snapshotID, path)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Diff provides a mock function with given fields: fromSnapshotID, toSnapshotID, path
+func (_m *DFS) Diff(fromSnapshotID string, toSnapshotID string, path string) ([]volume.SnapshotChange, error) {
+	ret := _m.Called(fromSnapshotID, toSnapshotID, path)
+
+	var r0 []volume.SnapshotChange
+	if rf, ok := ret.Get(0).(func(string, string, string) []volume.SnapshotChange); ok {
+		r0 = rf(fromSnapshotID, toSnapshotID, path)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]volume.SnapshotChange)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, string) error); ok {
+		r1 = rf(fromSnapshotID, toSnapshotID, path)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestorePath provides a mock function with given fields: snapshotID, path, dest
+func (_m *DFS) RestorePath(snapshotID string, path string, dest string) (int, error) {
+	ret := _m.Called(snapshotID, path, dest)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(string, string, string) int); ok {
+		r0 = rf(snapshotID, path, dest)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, string) error); ok {
+		r1 = rf(snapshotID, path, dest)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReplicaStatus provides a mock function with given fields:
+func (_m *DFS) ReplicaStatus() (*dfs.ReplicaStatus, error) {
+	ret := _m.Called()
+
+	var r0 *dfs.ReplicaStatus
+	if rf, ok := ret.Get(0).(func() *dfs.ReplicaStatus); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*dfs.ReplicaStatus)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReplicaFormat provides a mock function with given fields: snapshotID, parentID, standby
+func (_m *DFS) ReplicaFormat(snapshotID string, parentID string, standby volume.DriverType) (string, error) {
+	ret := _m.Called(snapshotID, parentID, standby)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string, string, volume.DriverType) string); ok {
+		r0 = rf(snapshotID, parentID, standby)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, volume.DriverType) error); ok {
+		r1 = rf(snapshotID, parentID, standby)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SendReplica provides a mock function with given fields: snapshotID, parentID, format, w
+func (_m *DFS) SendReplica(snapshotID string, parentID string, format string, w io.Writer) error {
+	ret := _m.Called(snapshotID, parentID, format, w)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string, io.Writer) error); ok {
+		r0 = rf(snapshotID, parentID, format, w)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReceiveReplica provides a mock function with given fields: tenantID, snapshotID, format, r
+func (_m *DFS) ReceiveReplica(tenantID string, snapshotID string, format string, r io.Reader) error {
+	ret := _m.Called(tenantID, snapshotID, format, r)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string, io.Reader) error); ok {
+		r0 = rf(tenantID, snapshotID, format, r)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReplicaImages provides a mock function with given fields: snapshotID
+func (_m *DFS) ReplicaImages(snapshotID string) ([]dfs.ReplicaImage, error) {
+	ret := _m.Called(snapshotID)
+
+	var r0 []dfs.ReplicaImage
+	if rf, ok := ret.Get(0).(func(string) []dfs.ReplicaImage); ok {
+		r0 = rf(snapshotID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]dfs.ReplicaImage)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(snapshotID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MissingImages provides a mock function with given fields: ids
+func (_m *DFS) MissingImages(ids []string) ([]string, error) {
+	ret := _m.Called(ids)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func([]string) []string); ok {
+		r0 = rf(ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]string) error); ok {
+		r1 = rf(ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SaveImages provides a mock function with given fields: images, w
+func (_m *DFS) SaveImages(images []string, w io.Writer) error {
+	ret := _m.Called(images, w)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func([]string, io.Writer) error); ok {
+		r0 = rf(images, w)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// LoadImages provides a mock function with given fields: r
+func (_m *DFS) LoadImages(r io.Reader) error {
+	ret := _m.Called(r)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(io.Reader) error); ok {
+		r0 = rf(r)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // UpgradeRegistry provides a mock function with given fields: svcs, tenantID, registryHost, override
 func (_m *DFS) UpgradeRegistry(svcs []service.ServiceDetails, tenantID string, registryHost string, override bool) error {
 	ret := _m.Called(svcs, tenantID, registryHost, override)
@@ -424,3 +740,26 @@ func (_m *DFS) VerifyTenantMounts(tenantid string) error {
 
 	return r0
 }
+
+// CollectRegistryGarbage provides a mock function with given fields: images, dryRun
+func (_m *DFS) CollectRegistryGarbage(images []string, dryRun bool) (*dfs.RegistryGCReport, error) {
+	ret := _m.Called(images, dryRun)
+
+	var r0 *dfs.RegistryGCReport
+	if rf, ok := ret.Get(0).(func([]string, bool) *dfs.RegistryGCReport); ok {
+		r0 = rf(images, dryRun)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*dfs.RegistryGCReport)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]string, bool) error); ok {
+		r1 = rf(images, dryRun)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
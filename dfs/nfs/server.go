@@ -78,6 +78,9 @@ var (
 
 const defaultDirectoryPerm = 0755
 
+// TransportName is the name of the nfs transport
+const TransportName = "nfs"
+
 const hostDenyMarker = "# serviced, do not remove past this line"
 const hostDenyDefaults = "\n# serviced, do not remove past this line\nrpcbind mountd nfsd statd lockd rquotad : ALL\n\n"
 
@@ -156,6 +159,12 @@ func (c *Server) ExportNamePath() string {
 	return c.exportedNamePath
 }
 
+// Transport returns the name of the transport; clients mount with the
+// kernel's nfs client on the standard port
+func (c *Server) Transport() (string, int) {
+	return TransportName, 0
+}
+
 // Returns the backing device for a given path.  Set on the Driver object to
 // make the mount device check testable.
 func (c *Server) GetDevice(path string) (uint64, error) {
@@ -0,0 +1,184 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ninep
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/commons/proc"
+	"github.com/control-center/serviced/utils"
+)
+
+var (
+	// ErrMountingUnsupported is returned when the kernel cannot mount 9p
+	ErrMountingUnsupported = errors.New("9p mounting not supported; load the 9p and 9pnet_tcp kernel modules")
+	// ErrMalformedMountpoint is returned when the remote path is not ip:/path
+	ErrMalformedMountpoint = errors.New("malformed 9p mountpoint")
+	// ErrVersionRejected is returned when the server does not speak 9P2000.L
+	ErrVersionRejected = errors.New("9p server rejected version " + Version)
+)
+
+var (
+	procFilesystems = "/proc/filesystems"
+	getMountInfo    = proc.GetMountInfo
+	staleMountCheck = utils.IsNFSMountStale
+)
+
+// Client mounts volumes from a 9P server with the kernel's v9fs.  The server
+// is probed before every mount and all commands are bounded by the timeout,
+// so an unreachable server fails the mount instead of hanging the host.
+type Client struct {
+	port    int
+	timeout time.Duration
+}
+
+// NewClient returns a client of the 9P servers on the given port
+func NewClient(port int, timeout time.Duration) *Client {
+	return &Client{port: port, timeout: timeout}
+}
+
+// Installed returns an error if the kernel cannot mount 9p
+func (c *Client) Installed() error {
+	// the filesystem is usually built as modules that are not yet loaded
+	exec.Command("modprobe", "-q", "9pnet_tcp").Run()
+	exec.Command("modprobe", "-q", "9p").Run()
+	data, err := ioutil.ReadFile(procFilesystems)
+	if err != nil {
+		return ErrMountingUnsupported
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && fields[len(fields)-1] == "9p" {
+			return nil
+		}
+	}
+	return ErrMountingUnsupported
+}
+
+// Probe negotiates a version with the server at host
+func (c *Client) Probe(host string) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(c.port)), c.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := conn.Write(newMessage(msgTversion, noTag).putU32(maxMsize).putStr(Version).bytes()); err != nil {
+		return err
+	}
+	m, err := readMessage(conn, maxMsize)
+	if err != nil {
+		return err
+	}
+	m.u32() // msize
+	if version := m.str(); m.Type != msgRversion || version != Version {
+		return ErrVersionRejected
+	}
+	return nil
+}
+
+// Mount mounts remotePath, which is ip:/export/volume, to localPath.  An
+// existing mount of the same server is kept unless it is stale.
+func (c *Client) Mount(remotePath, localPath string) error {
+	host, aname, err := splitRemotePath(remotePath)
+	if err != nil {
+		return err
+	}
+	logger := plog.WithFields(logrus.Fields{
+		"remotepath": remotePath,
+		"localpath":  localPath,
+	})
+	if info, err := getMountInfo(localPath); err == nil {
+		if info.FSType == TransportName && info.RemotePath == host && !staleMountCheck(localPath) {
+			return nil
+		}
+		logger.WithField("fstype", info.FSType).Warn("Replacing stale or unexpected mount")
+		if err := c.Unmount(localPath); err != nil {
+			return err
+		}
+	} else if err != proc.ErrMountPointNotFound {
+		return err
+	}
+
+	if err := c.Probe(host); err != nil {
+		logger.WithError(err).Error("Could not reach 9p server")
+		return err
+	}
+	if err := os.MkdirAll(localPath, 0775); err != nil {
+		return err
+	}
+	options := fmt.Sprintf("trans=tcp,port=%d,version=9p2000.L,access=client,aname=%s", c.port, aname)
+	logger.Info("Mounting volume over 9p")
+	if err := c.run("mount", "-t", TransportName, "-o", options, host, localPath); err != nil {
+		logger.WithError(err).Error("Could not mount volume over 9p")
+		return err
+	}
+	info, err := getMountInfo(localPath)
+	if err != nil {
+		return err
+	} else if info.FSType != TransportName {
+		return fmt.Errorf("%s not mounted 9p, %s instead", localPath, info.FSType)
+	}
+	return nil
+}
+
+// Unmount force unmounts localPath
+func (c *Client) Unmount(localPath string) error {
+	plog.WithField("localpath", localPath).Info("Unmounting volume")
+	return c.run("umount", "-f", localPath)
+}
+
+// run runs a command, killing it if it does not finish in time
+func (c *Client) run(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	errC := make(chan error, 1)
+	go func() {
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			err = fmt.Errorf("%s (%s)", strings.TrimSpace(string(output)), err)
+		}
+		errC <- err
+	}()
+	select {
+	case <-time.After(c.timeout):
+		if cmd.Process != nil {
+			cmd.Process.Kill()
+		}
+		return fmt.Errorf("timeout waiting for %s", name)
+	case err := <-errC:
+		return err
+	}
+}
+
+// splitRemotePath returns the host and attach name of ip:/export/volume
+func splitRemotePath(remotePath string) (string, string, error) {
+	parts := strings.SplitN(remotePath, ":", 2)
+	if len(parts) != 2 || net.ParseIP(parts[0]) == nil {
+		return "", "", ErrMalformedMountpoint
+	}
+	aname := filepath.Clean(parts[1])
+	if aname == "/" || !filepath.IsAbs(aname) {
+		return "", "", ErrMalformedMountpoint
+	}
+	return parts[0], aname, nil
+}
@@ -0,0 +1,1283 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ninep
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// lockSuccess is the status of a granted lock
+	lockSuccess = 0
+	// lockUnlocked is the type of a lock that is not held
+	lockUnlocked = 2
+	// utimeNow and utimeOmit are the special nanoseconds of utimensat
+	utimeNow  = (1 << 30) - 1
+	utimeOmit = (1 << 30) - 2
+	// atEmptyPath makes the *at calls work on the descriptor itself
+	atEmptyPath = 0x1000
+)
+
+// fid is a file of a client.  A fid holds descriptors of its file and of the
+// directory that the file was found in, and requests work on those instead of
+// resolving a path again.  A directory that is swapped for a symlink after a
+// walk therefore cannot lead a request out of the volume.
+type fid struct {
+	sync.Mutex
+	root  string
+	top   fileID
+	fd    int
+	dir   int
+	name  string
+	uid   uint32
+	file  *os.File
+	names []string
+}
+
+// fileID identifies a file on the host
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+func statID(st *syscall.Stat_t) fileID {
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+}
+
+// release closes the descriptors of a fid.  The caller must hold the fid's
+// lock.
+func (f *fid) release() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	closeFd(f.fd)
+	closeFd(f.dir)
+	f.fd, f.dir = -1, -1
+}
+
+// conn serves the requests of a client.  Each request is handled in its own
+// goroutine so that a slow operation does not stall the others.
+type conn struct {
+	server *Server
+	rwc    net.Conn
+	host   string
+	wmu    sync.Mutex
+
+	mu      sync.Mutex
+	msize   uint32
+	fids    map[uint32]*fid
+	pending map[uint16]chan struct{}
+}
+
+func newConn(s *Server, rwc net.Conn, host string) *conn {
+	return &conn{
+		server:  s,
+		rwc:     rwc,
+		host:    host,
+		msize:   maxMsize,
+		fids:    make(map[uint32]*fid),
+		pending: make(map[uint16]chan struct{}),
+	}
+}
+
+func (c *conn) serve() {
+	logger := plog.WithField("client", c.host)
+	defer func() {
+		c.close()
+		c.mu.Lock()
+		c.clunkAll()
+		c.mu.Unlock()
+	}()
+	for {
+		c.mu.Lock()
+		msize := c.msize
+		c.mu.Unlock()
+		m, err := readMessage(c.rwc, msize)
+		if err != nil {
+			if err != io.EOF {
+				logger.WithError(err).Debug("Closing 9p connection")
+			}
+			return
+		}
+		switch m.Type {
+		case msgTversion:
+			c.reply(c.version(m))
+		case msgTflush:
+			oldtag := m.u16()
+			c.mu.Lock()
+			done := c.pending[oldtag]
+			c.mu.Unlock()
+			go func() {
+				if done != nil {
+					<-done
+				}
+				c.reply(newMessage(msgRflush, m.Tag))
+			}()
+		default:
+			done := make(chan struct{})
+			c.mu.Lock()
+			c.pending[m.Tag] = done
+			c.mu.Unlock()
+			go func() {
+				c.reply(c.handle(m))
+				c.mu.Lock()
+				if c.pending[m.Tag] == done {
+					delete(c.pending, m.Tag)
+				}
+				c.mu.Unlock()
+				close(done)
+			}()
+		}
+	}
+}
+
+// reply writes a message to the client, closing the connection if the client
+// does not take it in time
+func (c *conn) reply(m *message) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.server.timeout > 0 {
+		c.rwc.SetWriteDeadline(time.Now().Add(c.server.timeout))
+	}
+	if _, err := c.rwc.Write(m.bytes()); err != nil {
+		plog.WithFields(logrus.Fields{
+			"client": c.host,
+			"type":   m.Type,
+		}).WithError(err).Debug("Could not reply to 9p client")
+		c.rwc.Close()
+	}
+}
+
+func (c *conn) close() {
+	c.rwc.Close()
+}
+
+// attached returns true if the client has a fid in the volume at root
+func (c *conn) attached(root string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range c.fids {
+		if f.root == root {
+			return true
+		}
+	}
+	return false
+}
+
+// clunkAll forgets all fids.  The caller must hold c.mu.
+func (c *conn) clunkAll() {
+	for n, f := range c.fids {
+		f.Lock()
+		f.release()
+		f.Unlock()
+		delete(c.fids, n)
+	}
+}
+
+func (c *conn) getFid(n uint32) (*fid, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f, ok := c.fids[n]; ok {
+		return f, nil
+	}
+	return nil, syscall.EBADF
+}
+
+func (c *conn) putFid(n uint32, f *fid) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.fids[n]; ok || n == noFid {
+		return syscall.EBADF
+	}
+	c.fids[n] = f
+	return nil
+}
+
+func (c *conn) version(m *message) *message {
+	msize, version := m.u32(), m.str()
+	if msize > maxMsize {
+		msize = maxMsize
+	}
+	c.mu.Lock()
+	c.clunkAll()
+	c.msize = msize
+	c.mu.Unlock()
+	r := newMessage(msgRversion, m.Tag).putU32(msize)
+	if m.err != nil || msize < minMsize || !strings.HasPrefix(version, Version) {
+		return r.putStr("unknown")
+	}
+	return r.putStr(Version)
+}
+
+func (c *conn) handle(m *message) *message {
+	var r *message
+	var err error
+	switch m.Type {
+	case msgTattach:
+		r, err = c.attach(m)
+	case msgTwalk:
+		r, err = c.walk(m)
+	case msgTgetattr:
+		r, err = c.getattr(m)
+	case msgTsetattr:
+		r, err = c.setattr(m)
+	case msgTlopen:
+		r, err = c.lopen(m)
+	case msgTlcreate:
+		r, err = c.lcreate(m)
+	case msgTread:
+		r, err = c.read(m)
+	case msgTwrite:
+		r, err = c.write(m)
+	case msgTreaddir:
+		r, err = c.readdir(m)
+	case msgTstatfs:
+		r, err = c.statfs(m)
+	case msgTmkdir:
+		r, err = c.mkdir(m)
+	case msgTsymlink:
+		r, err = c.symlink(m)
+	case msgTmknod:
+		r, err = c.mknod(m)
+	case msgTreadlink:
+		r, err = c.readlink(m)
+	case msgTlink:
+		r, err = c.link(m)
+	case msgTrename:
+		r, err = c.rename(m)
+	case msgTrenameat:
+		r, err = c.renameat(m)
+	case msgTunlinkat:
+		r, err = c.unlinkat(m)
+	case msgTremove:
+		r, err = c.remove(m)
+	case msgTclunk:
+		r, err = c.clunk(m)
+	case msgTfsync:
+		r, err = c.fsync(m)
+	case msgTlock:
+		r, err = c.lock(m)
+	case msgTgetlock:
+		r, err = c.getlock(m)
+	default:
+		err = syscall.EOPNOTSUPP
+	}
+	if err != nil {
+		return errorMessage(m.Tag, err)
+	}
+	return r
+}
+
+func (c *conn) attach(m *message) (*message, error) {
+	n := m.u32()
+	m.u32() // afid
+	m.str() // uname
+	aname, uid := m.str(), m.u32()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	if !c.server.allowed(c.host) {
+		plog.WithField("client", c.host).Warn("Refused 9p attach from unknown client")
+		return nil, syscall.EACCES
+	}
+	root, ok := c.server.volume(aname)
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	fd, err := openPath(unix.AT_FDCWD, root)
+	if err != nil {
+		return nil, err
+	}
+	var st syscall.Stat_t
+	if err := syscall.Fstat(fd, &st); err != nil {
+		closeFd(fd)
+		return nil, err
+	} else if st.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+		closeFd(fd)
+		return nil, syscall.ENOTDIR
+	}
+	f := &fid{root: root, top: statID(&st), fd: fd, dir: -1, uid: uid}
+	if err := c.putFid(n, f); err != nil {
+		closeFd(fd)
+		return nil, err
+	}
+	return newMessage(msgRattach, m.Tag).putQid(qidStat(&st)), nil
+}
+
+func (c *conn) walk(m *message) (*message, error) {
+	n, newn, count := m.u32(), m.u32(), m.u16()
+	if count > maxWalk {
+		return nil, syscall.EINVAL
+	}
+	names := make([]string, count)
+	for i := range names {
+		names[i] = m.str()
+	}
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	f, err := c.getFid(n)
+	if err != nil {
+		return nil, err
+	}
+
+	// the walk works on copies of the descriptors, so that a clunk of the
+	// fid does not close them underneath it
+	f.Lock()
+	root, top, name, uid := f.root, f.top, f.name, f.uid
+	cur, err := dupFd(f.fd)
+	dir := -1
+	if err == nil && f.dir >= 0 {
+		dir, err = dupFd(f.dir)
+	}
+	f.Unlock()
+	defer func() {
+		closeFd(cur)
+		closeFd(dir)
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	// each name is opened relative to the directory before it and symlinks
+	// are never followed; a walk only steps through directories and does not
+	// leave the volume
+	qids := []qid{}
+loop:
+	for i, next := range names {
+		var st syscall.Stat_t
+		if err := syscall.Fstat(cur, &st); err != nil {
+			return nil, err
+		} else if st.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+			if i == 0 {
+				return nil, syscall.ENOTDIR
+			}
+			break loop
+		}
+		switch next {
+		case "", ".":
+		case "..":
+			if statID(&st) == top {
+				break
+			}
+			parent, pdir, pname, err := walkUp(cur, top)
+			if err != nil {
+				if i == 0 {
+					return nil, err
+				}
+				break loop
+			}
+			closeFd(cur)
+			closeFd(dir)
+			cur, dir, name = parent, pdir, pname
+		default:
+			if strings.Contains(next, "/") {
+				return nil, syscall.EINVAL
+			}
+			fd, err := openPath(cur, next)
+			if err != nil {
+				if i == 0 {
+					return nil, err
+				}
+				break loop
+			}
+			closeFd(dir)
+			cur, dir, name = fd, cur, next
+		}
+		if err := syscall.Fstat(cur, &st); err != nil {
+			return nil, err
+		}
+		qids = append(qids, qidStat(&st))
+	}
+	if len(qids) == len(names) {
+		nf := &fid{root: root, top: top, fd: cur, dir: dir, name: name, uid: uid}
+		if newn == n {
+			c.mu.Lock()
+			old := c.fids[n]
+			c.fids[n] = nf
+			c.mu.Unlock()
+			old.Lock()
+			old.release()
+			old.Unlock()
+		} else if err := c.putFid(newn, nf); err != nil {
+			return nil, err
+		}
+		cur, dir = -1, -1
+	}
+	r := newMessage(msgRwalk, m.Tag).putU16(uint16(len(qids)))
+	for _, q := range qids {
+		r.putQid(q)
+	}
+	return r, nil
+}
+
+// walkUp opens the parent of a directory below the root of a volume, and the
+// directory and name that the parent is found by
+func walkUp(fd int, top fileID) (parent, dir int, name string, err error) {
+	parent, err = unix.Openat(fd, "..", unix.O_PATH|syscall.O_NOFOLLOW|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, -1, "", err
+	}
+	var st syscall.Stat_t
+	if err := syscall.Fstat(parent, &st); err != nil {
+		closeFd(parent)
+		return -1, -1, "", err
+	} else if statID(&st) == top {
+		return parent, -1, "", nil
+	}
+	dir, err = unix.Openat(parent, "..", unix.O_PATH|syscall.O_NOFOLLOW|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		closeFd(parent)
+		return -1, -1, "", err
+	}
+	if name, err = nameOf(dir, statID(&st)); err != nil {
+		closeFd(parent)
+		closeFd(dir)
+		return -1, -1, "", err
+	}
+	return parent, dir, name, nil
+}
+
+// nameOf returns the name of a file in a directory
+func nameOf(dir int, id fileID) (string, error) {
+	fd, err := unix.Openat(dir, ".", syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return "", err
+	}
+	d := os.NewFile(uintptr(fd), ".")
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil {
+		return "", err
+	}
+	for _, name := range names {
+		var st syscall.Stat_t
+		if lstatAt(dir, name, &st) == nil && statID(&st) == id {
+			return name, nil
+		}
+	}
+	return "", syscall.ENOENT
+}
+
+// stat returns the attributes of the file of a fid
+func (f *fid) stat(st *syscall.Stat_t) error {
+	f.Lock()
+	defer f.Unlock()
+	return syscall.Fstat(f.fd, st)
+}
+
+func (c *conn) getattr(m *message) (*message, error) {
+	n := m.u32()
+	m.u64() // request mask
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	f, err := c.getFid(n)
+	if err != nil {
+		return nil, err
+	}
+	var st syscall.Stat_t
+	if err := f.stat(&st); err != nil {
+		return nil, err
+	}
+	r := newMessage(msgRgetattr, m.Tag).putU64(getattrBasic).putQid(qidStat(&st))
+	r.putU32(uint32(st.Mode)).putU32(uint32(st.Uid)).putU32(uint32(st.Gid))
+	r.putU64(uint64(st.Nlink)).putU64(uint64(st.Rdev)).putU64(uint64(st.Size))
+	r.putU64(uint64(st.Blksize)).putU64(uint64(st.Blocks))
+	r.putU64(uint64(st.Atim.Sec)).putU64(uint64(st.Atim.Nsec))
+	r.putU64(uint64(st.Mtim.Sec)).putU64(uint64(st.Mtim.Nsec))
+	r.putU64(uint64(st.Ctim.Sec)).putU64(uint64(st.Ctim.Nsec))
+	// btime, gen and data version are not available
+	r.putU64(0).putU64(0).putU64(0).putU64(0)
+	return r, nil
+}
+
+func (c *conn) setattr(m *message) (*message, error) {
+	n, valid, mode, uid, gid, size := m.u32(), m.u32(), m.u32(), m.u32(), m.u32(), m.u64()
+	asec, ansec, msec, mnsec := m.u64(), m.u64(), m.u64(), m.u64()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	f, err := c.getFid(n)
+	if err != nil {
+		return nil, err
+	}
+	f.Lock()
+	defer f.Unlock()
+	var st syscall.Stat_t
+	if err := syscall.Fstat(f.fd, &st); err != nil {
+		return nil, err
+	}
+	isLink := st.Mode&syscall.S_IFMT == syscall.S_IFLNK
+
+	// The server runs as root, so every change goes through the descriptor
+	// of the fid and applies to the file itself.  Symlinks only take a new
+	// owner and new timestamps.
+	if valid&setattrMode != 0 {
+		if isLink {
+			return nil, syscall.EOPNOTSUPP
+		}
+		if err := syscall.Chmod(fdPath(f.fd), mode&07777); err != nil {
+			return nil, err
+		}
+	}
+	if valid&(setattrUID|setattrGID) != 0 {
+		if valid&setattrUID == 0 {
+			uid = noUID
+		}
+		if valid&setattrGID == 0 {
+			gid = noUID
+		}
+		if err := unix.Fchownat(f.fd, "", id(uid), id(gid), atEmptyPath); err != nil {
+			return nil, err
+		}
+	}
+	if valid&setattrSize != 0 {
+		if f.file != nil {
+			err = f.file.Truncate(int64(size))
+		} else if isLink {
+			err = syscall.ELOOP
+		} else {
+			err = syscall.Truncate(fdPath(f.fd), int64(size))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if valid&(setattrAtime|setattrMtime) != 0 {
+		ts := []syscall.Timespec{{Nsec: utimeOmit}, {Nsec: utimeOmit}}
+		if valid&setattrAtimeSet != 0 {
+			ts[0] = syscall.NsecToTimespec(int64(asec)*1e9 + int64(ansec))
+		} else if valid&setattrAtime != 0 {
+			ts[0] = syscall.Timespec{Nsec: utimeNow}
+		}
+		if valid&setattrMtimeSet != 0 {
+			ts[1] = syscall.NsecToTimespec(int64(msec)*1e9 + int64(mnsec))
+		} else if valid&setattrMtime != 0 {
+			ts[1] = syscall.Timespec{Nsec: utimeNow}
+		}
+		uts := []unix.Timespec{unix.Timespec(ts[0]), unix.Timespec(ts[1])}
+		if err := unix.UtimesNanoAt(unix.AT_FDCWD, fdPath(f.fd), uts, 0); err != nil {
+			return nil, err
+		}
+	}
+	return newMessage(msgRsetattr, m.Tag), nil
+}
+
+// openFlags returns the flags of an open; writes are always positioned, so
+// O_APPEND is dropped
+func openFlags(flags uint32) int {
+	return int(flags)&(syscall.O_ACCMODE|syscall.O_TRUNC|syscall.O_EXCL) | syscall.O_CLOEXEC
+}
+
+func (c *conn) lopen(m *message) (*message, error) {
+	n, flags := m.u32(), m.u32()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	f, err := c.getFid(n)
+	if err != nil {
+		return nil, err
+	}
+	f.Lock()
+	defer f.Unlock()
+	if f.file != nil {
+		return nil, syscall.EBADF
+	}
+	var st syscall.Stat_t
+	if err := syscall.Fstat(f.fd, &st); err != nil {
+		return nil, err
+	}
+
+	// the file is opened through the descriptor of the fid; symlinks are not
+	// followed, as with O_NOFOLLOW
+	var fd int
+	switch st.Mode & syscall.S_IFMT {
+	case syscall.S_IFDIR:
+		fd, err = unix.Openat(f.fd, ".", syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, 0)
+	case syscall.S_IFLNK:
+		err = syscall.ELOOP
+	default:
+		fd, err = syscall.Open(fdPath(f.fd), openFlags(flags), 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.file = os.NewFile(uintptr(fd), f.name)
+	return newMessage(msgRlopen, m.Tag).putQid(qidStat(&st)).putU32(0), nil
+}
+
+func (c *conn) lcreate(m *message) (*message, error) {
+	n, name, flags, mode, gid := m.u32(), m.str(), m.u32(), m.u32(), m.u32()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	f, err := c.getFid(n)
+	if err != nil {
+		return nil, err
+	}
+	f.Lock()
+	defer f.Unlock()
+	if f.file != nil {
+		return nil, syscall.EBADF
+	}
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	fd, err := unix.Openat(f.fd, name, openFlags(flags)|syscall.O_CREAT|syscall.O_NOFOLLOW, mode&07777)
+	if err != nil {
+		return nil, err
+	}
+	file := os.NewFile(uintptr(fd), name)
+	var st syscall.Stat_t
+	if err := c.own(fd, mode&07777, f.uid, gid, &st); err != nil {
+		file.Close()
+		return nil, err
+	}
+	pfd, err := dupFd(fd)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// the fid is now the new file, found in the directory it was
+	closeFd(f.dir)
+	f.dir, f.fd, f.name, f.file = f.fd, pfd, name, file
+	return newMessage(msgRlcreate, m.Tag).putQid(qidStat(&st)).putU32(0), nil
+}
+
+// own sets the mode, owner and group of a new file.  The mode is set again
+// because the umask of the server does not apply to clients.
+func (c *conn) own(fd int, mode, uid, gid uint32, st *syscall.Stat_t) error {
+	if mode&syscall.S_IFMT == 0 || mode&syscall.S_IFMT == syscall.S_IFDIR {
+		if err := syscall.Chmod(fdPath(fd), mode&07777); err != nil {
+			return err
+		}
+	}
+	if err := unix.Fchownat(fd, "", id(uid), id(gid), atEmptyPath); err != nil {
+		return err
+	}
+	return syscall.Fstat(fd, st)
+}
+
+// ownAt sets the mode, owner and group of a new entry of a directory
+func (c *conn) ownAt(dir int, name string, mode, uid, gid uint32, st *syscall.Stat_t) error {
+	fd, err := openPath(dir, name)
+	if err != nil {
+		return err
+	}
+	defer closeFd(fd)
+	return c.own(fd, mode, uid, gid, st)
+}
+
+func (c *conn) read(m *message) (*message, error) {
+	n, offset, count := m.u32(), m.u64(), m.u32()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	f, err := c.getFid(n)
+	if err != nil {
+		return nil, err
+	}
+	f.Lock()
+	file := f.file
+	f.Unlock()
+	if file == nil {
+		return nil, syscall.EBADF
+	}
+	c.mu.Lock()
+	if max := c.msize - ioHeaderSize; count > max {
+		count = max
+	}
+	c.mu.Unlock()
+	buf := make([]byte, count)
+	sz, err := file.ReadAt(buf, int64(offset))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return newMessage(msgRread, m.Tag).putData(buf[:sz]), nil
+}
+
+func (c *conn) write(m *message) (*message, error) {
+	n, offset, data := m.u32(), m.u64(), m.data()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	f, err := c.getFid(n)
+	if err != nil {
+		return nil, err
+	}
+	f.Lock()
+	file := f.file
+	f.Unlock()
+	if file == nil {
+		return nil, syscall.EBADF
+	}
+	sz, err := file.WriteAt(data, int64(offset))
+	if err != nil {
+		return nil, err
+	}
+	return newMessage(msgRwrite, m.Tag).putU32(uint32(sz)), nil
+}
+
+func (c *conn) readdir(m *message) (*message, error) {
+	n, offset, count := m.u32(), m.u64(), m.u32()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	f, err := c.getFid(n)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if max := c.msize - ioHeaderSize; count > max {
+		count = max
+	}
+	c.mu.Unlock()
+	f.Lock()
+	defer f.Unlock()
+	if f.file == nil {
+		return nil, syscall.EBADF
+	}
+
+	// entries are read when the client starts at the beginning; the offset
+	// of an entry is its index plus one
+	if offset == 0 || f.names == nil {
+		fd, err := unix.Openat(f.fd, ".", syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			return nil, err
+		}
+		d := os.NewFile(uintptr(fd), f.name)
+		names, err := d.Readdirnames(-1)
+		d.Close()
+		if err != nil {
+			return nil, err
+		}
+		f.names = append([]string{".", ".."}, names...)
+	}
+	entries := &message{}
+	for i := offset; i < uint64(len(f.names)); i++ {
+		name := f.names[i]
+		var st syscall.Stat_t
+		if name == "." || (name == ".." && f.dir < 0) {
+			err = syscall.Fstat(f.fd, &st)
+		} else {
+			err = lstatAt(f.fd, name, &st)
+		}
+		if err != nil {
+			// removed since it was listed
+			continue
+		}
+		if len(entries.body)+24+len(name) > int(count) {
+			break
+		}
+		entries.putQid(qidStat(&st)).putU64(i + 1).putU8(direntType(st.Mode)).putStr(name)
+	}
+	return newMessage(msgRreaddir, m.Tag).putData(entries.body), nil
+}
+
+func (c *conn) statfs(m *message) (*message, error) {
+	n := m.u32()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	f, err := c.getFid(n)
+	if err != nil {
+		return nil, err
+	}
+	f.Lock()
+	var st syscall.Statfs_t
+	err = syscall.Fstatfs(f.fd, &st)
+	f.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	r := newMessage(msgRstatfs, m.Tag).putU32(uint32(st.Type)).putU32(uint32(st.Bsize))
+	r.putU64(uint64(st.Blocks)).putU64(uint64(st.Bfree)).putU64(uint64(st.Bavail))
+	r.putU64(uint64(st.Files)).putU64(uint64(st.Ffree))
+	r.putU64(uint64(uint32(st.Fsid.X__val[0])) | uint64(uint32(st.Fsid.X__val[1]))<<32)
+	r.putU32(uint32(st.Namelen))
+	return r, nil
+}
+
+// fidFd returns a copy of the descriptor of a fid, which the caller closes,
+// and the uid of the fid
+func (c *conn) fidFd(n uint32) (int, uint32, error) {
+	f, err := c.getFid(n)
+	if err != nil {
+		return -1, 0, err
+	}
+	f.Lock()
+	defer f.Unlock()
+	fd, err := dupFd(f.fd)
+	if err != nil {
+		return -1, 0, err
+	}
+	return fd, f.uid, nil
+}
+
+func (c *conn) mkdir(m *message) (*message, error) {
+	n, name, mode, gid := m.u32(), m.str(), m.u32(), m.u32()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	dir, uid, err := c.fidFd(n)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFd(dir)
+	if err := unix.Mkdirat(dir, name, mode&07777); err != nil {
+		return nil, err
+	}
+	var st syscall.Stat_t
+	if err := c.ownAt(dir, name, mode|syscall.S_IFDIR, uid, gid, &st); err != nil {
+		return nil, err
+	}
+	return newMessage(msgRmkdir, m.Tag).putQid(qidStat(&st)), nil
+}
+
+func (c *conn) symlink(m *message) (*message, error) {
+	n, name, target, gid := m.u32(), m.str(), m.str(), m.u32()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	dir, uid, err := c.fidFd(n)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFd(dir)
+	if err := symlinkat(target, dir, name); err != nil {
+		return nil, err
+	}
+	var st syscall.Stat_t
+	if err := c.ownAt(dir, name, syscall.S_IFLNK, uid, gid, &st); err != nil {
+		return nil, err
+	}
+	return newMessage(msgRsymlink, m.Tag).putQid(qidStat(&st)), nil
+}
+
+func (c *conn) mknod(m *message) (*message, error) {
+	n, name, mode, major, minor, gid := m.u32(), m.str(), m.u32(), m.u32(), m.u32(), m.u32()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	dir, uid, err := c.fidFd(n)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFd(dir)
+	if err := unix.Mknodat(dir, name, mode, mkdev(major, minor)); err != nil {
+		return nil, err
+	}
+	var st syscall.Stat_t
+	if err := c.ownAt(dir, name, mode, uid, gid, &st); err != nil {
+		return nil, err
+	}
+	return newMessage(msgRmknod, m.Tag).putQid(qidStat(&st)), nil
+}
+
+func (c *conn) readlink(m *message) (*message, error) {
+	n := m.u32()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	fd, _, err := c.fidFd(n)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFd(fd)
+	target, err := readlinkFd(fd)
+	if err != nil {
+		return nil, err
+	}
+	return newMessage(msgRreadlink, m.Tag).putStr(target), nil
+}
+
+func (c *conn) link(m *message) (*message, error) {
+	dn, n, name := m.u32(), m.u32(), m.str()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	dir, _, err := c.fidFd(dn)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFd(dir)
+	fd, _, err := c.fidFd(n)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFd(fd)
+	if err := unix.Linkat(fd, "", dir, name, atEmptyPath); err != nil {
+		return nil, err
+	}
+	return newMessage(msgRlink, m.Tag), nil
+}
+
+// entry returns the directory and name of the file of a fid.  The caller
+// must hold the fid's lock.
+func (f *fid) entry() (int, string, error) {
+	if f.dir < 0 {
+		// the root of the volume
+		return -1, "", syscall.EBUSY
+	}
+	var st, est syscall.Stat_t
+	if err := syscall.Fstat(f.fd, &st); err != nil {
+		return -1, "", err
+	}
+	if err := lstatAt(f.dir, f.name, &est); err != nil {
+		return -1, "", err
+	} else if statID(&st) != statID(&est) {
+		// renamed or replaced since the fid was walked to
+		return -1, "", syscall.ENOENT
+	}
+	return f.dir, f.name, nil
+}
+
+func (c *conn) rename(m *message) (*message, error) {
+	n, dn, name := m.u32(), m.u32(), m.str()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	f, err := c.getFid(n)
+	if err != nil {
+		return nil, err
+	}
+	ndir, _, err := c.fidFd(dn)
+	if err != nil {
+		return nil, err
+	}
+	f.Lock()
+	defer f.Unlock()
+	odir, oname, err := f.entry()
+	if err != nil {
+		closeFd(ndir)
+		return nil, err
+	}
+	if err := unix.Renameat(odir, oname, ndir, name); err != nil {
+		closeFd(ndir)
+		return nil, err
+	}
+	closeFd(f.dir)
+	f.dir, f.name = ndir, name
+	return newMessage(msgRrename, m.Tag), nil
+}
+
+func (c *conn) renameat(m *message) (*message, error) {
+	on, oname, nn, nname := m.u32(), m.str(), m.u32(), m.str()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	if err := checkName(oname); err != nil {
+		return nil, err
+	}
+	if err := checkName(nname); err != nil {
+		return nil, err
+	}
+	odir, _, err := c.fidFd(on)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFd(odir)
+	ndir, _, err := c.fidFd(nn)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFd(ndir)
+	if err := unix.Renameat(odir, oname, ndir, nname); err != nil {
+		return nil, err
+	}
+	return newMessage(msgRrenameat, m.Tag), nil
+}
+
+func (c *conn) unlinkat(m *message) (*message, error) {
+	n, name, flags := m.u32(), m.str(), m.u32()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	dir, _, err := c.fidFd(n)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFd(dir)
+	uflags := 0
+	if flags&atRemoveDir != 0 {
+		uflags = unix.AT_REMOVEDIR
+	}
+	if err := unix.Unlinkat(dir, name, uflags); err != nil {
+		return nil, err
+	}
+	return newMessage(msgRunlinkat, m.Tag), nil
+}
+
+func (c *conn) remove(m *message) (*message, error) {
+	n := m.u32()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	f, err := c.getFid(n)
+	if err != nil {
+		return nil, err
+	}
+	f.Lock()
+	err = f.unlink()
+	f.Unlock()
+
+	// the fid is clunked even if the remove fails
+	c.clunkFid(n)
+	if err != nil {
+		return nil, err
+	}
+	return newMessage(msgRremove, m.Tag), nil
+}
+
+// unlink removes the file of a fid.  The caller must hold the fid's lock.
+func (f *fid) unlink() error {
+	dir, name, err := f.entry()
+	if err != nil {
+		return err
+	}
+	var st syscall.Stat_t
+	if err := syscall.Fstat(f.fd, &st); err != nil {
+		return err
+	}
+	flags := 0
+	if st.Mode&syscall.S_IFMT == syscall.S_IFDIR {
+		flags = unix.AT_REMOVEDIR
+	}
+	return unix.Unlinkat(dir, name, flags)
+}
+
+func (c *conn) clunk(m *message) (*message, error) {
+	n := m.u32()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	if err := c.clunkFid(n); err != nil {
+		return nil, err
+	}
+	return newMessage(msgRclunk, m.Tag), nil
+}
+
+// clunkFid forgets a fid and closes its file
+func (c *conn) clunkFid(n uint32) error {
+	c.mu.Lock()
+	f, ok := c.fids[n]
+	delete(c.fids, n)
+	c.mu.Unlock()
+	if !ok {
+		return syscall.EBADF
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.release()
+	return nil
+}
+
+func (c *conn) fsync(m *message) (*message, error) {
+	n := m.u32()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	f, err := c.getFid(n)
+	if err != nil {
+		return nil, err
+	}
+	f.Lock()
+	file := f.file
+	f.Unlock()
+	if file == nil {
+		return nil, syscall.EBADF
+	}
+	if err := file.Sync(); err != nil {
+		return nil, err
+	}
+	return newMessage(msgRfsync, m.Tag), nil
+}
+
+// lock grants every lock.  Like nfs exports without a lock manager, locks are
+// only advisory within a client.
+func (c *conn) lock(m *message) (*message, error) {
+	n := m.u32()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	if _, err := c.getFid(n); err != nil {
+		return nil, err
+	}
+	return newMessage(msgRlock, m.Tag).putU8(lockSuccess), nil
+}
+
+func (c *conn) getlock(m *message) (*message, error) {
+	n := m.u32()
+	m.u8() // type
+	start, length, proc, client := m.u64(), m.u64(), m.u32(), m.str()
+	if m.err != nil {
+		return nil, syscall.EINVAL
+	}
+	if _, err := c.getFid(n); err != nil {
+		return nil, err
+	}
+	r := newMessage(msgRgetlock, m.Tag).putU8(lockUnlocked)
+	return r.putU64(start).putU64(length).putU32(proc).putStr(client), nil
+}
+
+// checkName returns an error unless name is the name of a new entry of a
+// directory
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return syscall.EINVAL
+	}
+	return nil
+}
+
+// openPath opens a file relative to a directory for its descriptor only.  If
+// the file is a symlink, the descriptor refers to the symlink.
+func openPath(dir int, name string) (int, error) {
+	return unix.Openat(dir, name, unix.O_PATH|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, 0)
+}
+
+// lstatAt returns the attributes of an entry of a directory
+func lstatAt(dir int, name string, st *syscall.Stat_t) error {
+	fd, err := openPath(dir, name)
+	if err != nil {
+		return err
+	}
+	defer closeFd(fd)
+	return syscall.Fstat(fd, st)
+}
+
+// fdPath returns a path that the kernel resolves to the file of a
+// descriptor, symlink or not, without looking up any name of the file
+func fdPath(fd int) string {
+	return fmt.Sprintf("/proc/self/fd/%d", fd)
+}
+
+func dupFd(fd int) (int, error) {
+	nfd, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_DUPFD_CLOEXEC, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(nfd), nil
+}
+
+func closeFd(fd int) {
+	if fd >= 0 {
+		syscall.Close(fd)
+	}
+}
+
+func symlinkat(target string, dir int, name string) error {
+	p0, err := syscall.BytePtrFromString(target)
+	if err != nil {
+		return err
+	}
+	p1, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_SYMLINKAT, uintptr(unsafe.Pointer(p0)), uintptr(dir), uintptr(unsafe.Pointer(p1)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// readlinkFd returns the target of the symlink of a descriptor
+func readlinkFd(fd int) (string, error) {
+	empty, err := syscall.BytePtrFromString("")
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, syscall.PathMax)
+	sz, _, errno := syscall.Syscall6(syscall.SYS_READLINKAT, uintptr(fd), uintptr(unsafe.Pointer(empty)), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0, 0)
+	if errno != 0 {
+		return "", errno
+	}
+	return string(buf[:sz]), nil
+}
+
+// id returns the uid or gid to pass to chown; -1 leaves it unchanged
+func id(v uint32) int {
+	if v == noUID {
+		return -1
+	}
+	return int(v)
+}
+
+func mkdev(major, minor uint32) int {
+	dev := uint64(minor&0xff) | uint64(major&0xfff)<<8 | uint64(minor&^0xff)<<12 | uint64(major&^0xfff)<<32
+	return int(dev)
+}
+
+func qidStat(st *syscall.Stat_t) qid {
+	q := qid{Type: qidFile, Path: uint64(st.Ino)}
+	switch st.Mode & syscall.S_IFMT {
+	case syscall.S_IFDIR:
+		q.Type = qidDir
+	case syscall.S_IFLNK:
+		q.Type = qidSymlink
+	}
+	return q
+}
+
+func direntType(mode uint32) uint8 {
+	switch mode & syscall.S_IFMT {
+	case syscall.S_IFDIR:
+		return syscall.DT_DIR
+	case syscall.S_IFLNK:
+		return syscall.DT_LNK
+	case syscall.S_IFREG:
+		return syscall.DT_REG
+	case syscall.S_IFIFO:
+		return syscall.DT_FIFO
+	case syscall.S_IFSOCK:
+		return syscall.DT_SOCK
+	case syscall.S_IFCHR:
+		return syscall.DT_CHR
+	case syscall.S_IFBLK:
+		return syscall.DT_BLK
+	}
+	return syscall.DT_UNKNOWN
+}
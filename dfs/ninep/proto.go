@@ -0,0 +1,294 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ninep
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// Version is the dialect of 9P that is served
+const Version = "9P2000.L"
+
+// Message types of 9P2000.L
+const (
+	msgTlerror      = 6
+	msgRlerror      = 7
+	msgTstatfs      = 8
+	msgRstatfs      = 9
+	msgTlopen       = 12
+	msgRlopen       = 13
+	msgTlcreate     = 14
+	msgRlcreate     = 15
+	msgTsymlink     = 16
+	msgRsymlink     = 17
+	msgTmknod       = 18
+	msgRmknod       = 19
+	msgTrename      = 20
+	msgRrename      = 21
+	msgTreadlink    = 22
+	msgRreadlink    = 23
+	msgTgetattr     = 24
+	msgRgetattr     = 25
+	msgTsetattr     = 26
+	msgRsetattr     = 27
+	msgTxattrwalk   = 30
+	msgTxattrcreate = 32
+	msgTreaddir     = 40
+	msgRreaddir     = 41
+	msgTfsync       = 50
+	msgRfsync       = 51
+	msgTlock        = 52
+	msgRlock        = 53
+	msgTgetlock     = 54
+	msgRgetlock     = 55
+	msgTlink        = 70
+	msgRlink        = 71
+	msgTmkdir       = 72
+	msgRmkdir       = 73
+	msgTrenameat    = 74
+	msgRrenameat    = 75
+	msgTunlinkat    = 76
+	msgRunlinkat    = 77
+	msgTversion     = 100
+	msgRversion     = 101
+	msgTauth        = 102
+	msgTattach      = 104
+	msgRattach      = 105
+	msgTflush       = 108
+	msgRflush       = 109
+	msgTwalk        = 110
+	msgRwalk        = 111
+	msgTread        = 116
+	msgRread        = 117
+	msgTwrite       = 118
+	msgRwrite       = 119
+	msgTclunk       = 120
+	msgRclunk       = 121
+	msgTremove      = 122
+	msgRremove      = 123
+)
+
+const (
+	// noTag is the tag of version messages
+	noTag = 0xffff
+	// noFid is the fid that is not in use
+	noFid = 0xffffffff
+	// noUID is the uid or gid that is not set
+	noUID = 0xffffffff
+	// headerSize is the size of the size, type and tag of a message
+	headerSize = 7
+	// ioHeaderSize is the room left in a message for the header of a read or
+	// write
+	ioHeaderSize = 24
+	// maxWalk is the most names that can be walked in one message
+	maxWalk = 16
+	// minMsize is the smallest message size the server accepts
+	minMsize = 4096
+)
+
+// Types of a qid
+const (
+	qidDir     = 0x80
+	qidSymlink = 0x02
+	qidFile    = 0x00
+)
+
+// Valid bits of getattr and setattr
+const (
+	getattrBasic = 0x000007ff
+
+	setattrMode     = 0x00000001
+	setattrUID      = 0x00000002
+	setattrGID      = 0x00000004
+	setattrSize     = 0x00000008
+	setattrAtime    = 0x00000010
+	setattrMtime    = 0x00000020
+	setattrAtimeSet = 0x00000080
+	setattrMtimeSet = 0x00000100
+)
+
+// atRemoveDir is the flag of unlinkat that removes a directory
+const atRemoveDir = 0x200
+
+var (
+	// ErrMessageTooLarge is returned when a message is larger than the
+	// negotiated message size
+	ErrMessageTooLarge = errors.New("9p: message too large")
+	// ErrShortMessage is returned when a message ends before its fields
+	ErrShortMessage = errors.New("9p: short message")
+)
+
+// qid is the server's identity of a file
+type qid struct {
+	Type    uint8
+	Version uint32
+	Path    uint64
+}
+
+// message is a 9P message.  Fields are read from and appended to the body in
+// the order of the protocol.
+type message struct {
+	Type uint8
+	Tag  uint16
+	body []byte
+	off  int
+	err  error
+}
+
+func newMessage(typ uint8, tag uint16) *message {
+	return &message{Type: typ, Tag: tag}
+}
+
+// readMessage reads the next message from r
+func readMessage(r io.Reader, msize uint32) (*message, error) {
+	var hdr [headerSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	size := binary.LittleEndian.Uint32(hdr[0:4])
+	if size < headerSize {
+		return nil, ErrShortMessage
+	} else if size > msize {
+		return nil, ErrMessageTooLarge
+	}
+	m := &message{Type: hdr[4], Tag: binary.LittleEndian.Uint16(hdr[5:7])}
+	m.body = make([]byte, size-headerSize)
+	if _, err := io.ReadFull(r, m.body); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// bytes returns the encoded message
+func (m *message) bytes() []byte {
+	buf := make([]byte, headerSize, headerSize+len(m.body))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(headerSize+len(m.body)))
+	buf[4] = m.Type
+	binary.LittleEndian.PutUint16(buf[5:7], m.Tag)
+	return append(buf, m.body...)
+}
+
+func (m *message) next(n int) []byte {
+	if m.err != nil {
+		return nil
+	}
+	if m.off+n > len(m.body) {
+		m.err = ErrShortMessage
+		return nil
+	}
+	b := m.body[m.off : m.off+n]
+	m.off += n
+	return b
+}
+
+func (m *message) u8() uint8 {
+	if b := m.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (m *message) u16() uint16 {
+	if b := m.next(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (m *message) u32() uint32 {
+	if b := m.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (m *message) u64() uint64 {
+	if b := m.next(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (m *message) str() string {
+	n := m.u16()
+	return string(m.next(int(n)))
+}
+
+func (m *message) data() []byte {
+	n := m.u32()
+	return m.next(int(n))
+}
+
+func (m *message) qid() qid {
+	return qid{Type: m.u8(), Version: m.u32(), Path: m.u64()}
+}
+
+func (m *message) putU8(v uint8) *message {
+	m.body = append(m.body, v)
+	return m
+}
+
+func (m *message) putU16(v uint16) *message {
+	m.body = append(m.body, byte(v), byte(v>>8))
+	return m
+}
+
+func (m *message) putU32(v uint32) *message {
+	m.body = append(m.body, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+	return m
+}
+
+func (m *message) putU64(v uint64) *message {
+	return m.putU32(uint32(v)).putU32(uint32(v >> 32))
+}
+
+func (m *message) putStr(s string) *message {
+	m.putU16(uint16(len(s)))
+	m.body = append(m.body, s...)
+	return m
+}
+
+func (m *message) putData(b []byte) *message {
+	m.putU32(uint32(len(b)))
+	m.body = append(m.body, b...)
+	return m
+}
+
+func (m *message) putQid(q qid) *message {
+	return m.putU8(q.Type).putU32(q.Version).putU64(q.Path)
+}
+
+// errorMessage returns the Rlerror reply for err
+func errorMessage(tag uint16, err error) *message {
+	return newMessage(msgRlerror, tag).putU32(uint32(errno(err)))
+}
+
+// errno returns the error number of an error returned by the os package
+func errno(err error) syscall.Errno {
+	switch e := err.(type) {
+	case syscall.Errno:
+		return e
+	case *os.PathError:
+		return errno(e.Err)
+	case *os.LinkError:
+		return errno(e.Err)
+	case *os.SyscallError:
+		return errno(e.Err)
+	}
+	return syscall.EIO
+}
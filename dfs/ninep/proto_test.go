@@ -0,0 +1,92 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package ninep
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	q := qid{Type: qidDir, Version: 7, Path: 1 << 40}
+	m := newMessage(msgRgetattr, 42).putU8(1).putU16(2).putU32(3).putU64(4).putStr("name").putData([]byte("data")).putQid(q)
+
+	r, err := readMessage(bytes.NewReader(m.bytes()), maxMsize)
+	if err != nil {
+		t.Fatalf("unexpected error reading message: %s", err)
+	}
+	if r.Type != msgRgetattr || r.Tag != 42 {
+		t.Errorf("expected type %d tag 42, got type %d tag %d", msgRgetattr, r.Type, r.Tag)
+	}
+	if v := r.u8(); v != 1 {
+		t.Errorf("expected u8 1, got %d", v)
+	}
+	if v := r.u16(); v != 2 {
+		t.Errorf("expected u16 2, got %d", v)
+	}
+	if v := r.u32(); v != 3 {
+		t.Errorf("expected u32 3, got %d", v)
+	}
+	if v := r.u64(); v != 4 {
+		t.Errorf("expected u64 4, got %d", v)
+	}
+	if v := r.str(); v != "name" {
+		t.Errorf("expected string name, got %s", v)
+	}
+	if v := r.data(); string(v) != "data" {
+		t.Errorf("expected data, got %s", v)
+	}
+	if v := r.qid(); v != q {
+		t.Errorf("expected qid %+v, got %+v", q, v)
+	}
+	if r.err != nil {
+		t.Errorf("unexpected decode error: %s", r.err)
+	}
+}
+
+func TestMessageShort(t *testing.T) {
+	m := newMessage(msgTwalk, 1).putU32(1)
+	r, err := readMessage(bytes.NewReader(m.bytes()), maxMsize)
+	if err != nil {
+		t.Fatalf("unexpected error reading message: %s", err)
+	}
+	r.u32()
+	if r.str(); r.err != ErrShortMessage {
+		t.Errorf("expected %s, got %v", ErrShortMessage, r.err)
+	}
+}
+
+func TestReadMessageTooLarge(t *testing.T) {
+	m := newMessage(msgTwrite, 1).putData(make([]byte, 100))
+	if _, err := readMessage(bytes.NewReader(m.bytes()), 64); err != ErrMessageTooLarge {
+		t.Errorf("expected %s, got %v", ErrMessageTooLarge, err)
+	}
+}
+
+func TestErrno(t *testing.T) {
+	_, err := os.Open("/nonexistent/ninep")
+	if e := errno(err); e != syscall.ENOENT {
+		t.Errorf("expected ENOENT, got %s", e)
+	}
+	if e := errno(syscall.EACCES); e != syscall.EACCES {
+		t.Errorf("expected EACCES, got %s", e)
+	}
+	if e := errno(ErrShortMessage); e != syscall.EIO {
+		t.Errorf("expected EIO, got %s", e)
+	}
+}
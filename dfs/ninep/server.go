@@ -0,0 +1,283 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ninep
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/control-center/serviced/logging"
+)
+
+var (
+	// ErrInvalidExportedName is returned when an exported name is not a valid single directory name
+	ErrInvalidExportedName = errors.New("9p server: invalid exported name")
+	// ErrInvalidBasePath is returned when the local path to export is invalid
+	ErrInvalidBasePath = errors.New("9p server: invalid base path")
+	// ErrInvalidPort is returned when the port to listen on is out of range
+	ErrInvalidPort = errors.New("9p server: invalid port")
+
+	plog = logging.PackageLogger()
+)
+
+// TransportName is the name of the 9P transport
+const TransportName = "9p"
+
+// DefaultPort is the port the 9P server listens on unless otherwise
+// configured
+const DefaultPort = 4569
+
+// maxMsize is the largest message size the server negotiates
+const maxMsize = 1 << 20
+
+// ClientValidator determines whether a client has permission to mount the dfs
+type ClientValidator interface {
+	ValidateClient(string) bool
+}
+
+// Server exports volumes to clients over 9P2000.L.  Unlike the kernel nfs
+// server, requests are served in user space; clients that stop responding are
+// dropped after the configured timeout instead of holding up the server.
+type Server struct {
+	sync.Mutex
+	basePath        string
+	exportedName    string
+	port            int
+	timeout         time.Duration
+	clients         map[string]struct{}
+	volumes         map[string]string
+	clientValidator ClientValidator
+	listener        net.Listener
+	conns           map[*conn]struct{}
+}
+
+// NewServer returns a 9P server that shares volumes under basePath with the
+// configured clients on the given port.  Writes to a client that take longer
+// than timeout close the client's connection.
+func NewServer(basePath, exportedName string, port int, timeout time.Duration) (*Server, error) {
+	if len(exportedName) < 2 || strings.Contains(exportedName, "/") {
+		return nil, ErrInvalidExportedName
+	}
+	if len(basePath) < 2 {
+		return nil, ErrInvalidBasePath
+	}
+	if port < 0 || port > 65535 {
+		return nil, ErrInvalidPort
+	}
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		return nil, err
+	}
+	s := &Server{
+		basePath:     basePath,
+		exportedName: exportedName,
+		port:         port,
+		timeout:      timeout,
+		clients:      make(map[string]struct{}),
+		volumes:      make(map[string]string),
+		conns:        make(map[*conn]struct{}),
+	}
+	if err := s.Restart(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Addr returns the address the server is listening on, or nil if the server
+// is stopped
+func (s *Server) Addr() net.Addr {
+	s.Lock()
+	defer s.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// ExportPath returns the path that clients attach to; /foo for volumes
+// exported as /foo/<volume>
+func (s *Server) ExportPath() string {
+	return filepath.Join("/", s.exportedName)
+}
+
+// ExportNamePath returns the local path of the exported volumes.  Volumes are
+// served from where they are, so this is the base path.
+func (s *Server) ExportNamePath() string {
+	return s.basePath
+}
+
+// Transport returns the name of the transport and the port it listens on
+func (s *Server) Transport() (string, int) {
+	return TransportName, s.port
+}
+
+// GetDevice returns the backing device for a given path
+func (s *Server) GetDevice(path string) (uint64, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to get volume stats for %s: %s", path, err)
+	}
+	sysStat, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("Unable to convert volume stats to Stat_t for %s", path)
+	}
+	return sysStat.Dev, nil
+}
+
+// SetClientValidator sets the validator that filters the clients allowed to
+// attach
+func (s *Server) SetClientValidator(validator ClientValidator) {
+	s.Lock()
+	defer s.Unlock()
+	s.clientValidator = validator
+}
+
+// SetClients replaces the existing clients with the new clients
+func (s *Server) SetClients(clients ...string) {
+	s.Lock()
+	defer s.Unlock()
+	s.clients = make(map[string]struct{})
+	for _, client := range clients {
+		if s.clientValidator != nil && !s.clientValidator.ValidateClient(client) {
+			plog.WithField("client", client).Debug("Filtered 9p client")
+			continue
+		}
+		s.clients[client] = struct{}{}
+	}
+}
+
+// AddVolume makes the volume at volumePath available to clients
+func (s *Server) AddVolume(volumePath string) error {
+	s.Lock()
+	defer s.Unlock()
+	s.volumes[filepath.Base(volumePath)] = filepath.Clean(volumePath)
+	return nil
+}
+
+// RemoveVolume stops sharing the volume at volumePath and drops the clients
+// that have it attached
+func (s *Server) RemoveVolume(volumePath string) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.volumes, filepath.Base(volumePath))
+	for c := range s.conns {
+		if c.attached(filepath.Clean(volumePath)) {
+			c.close()
+		}
+	}
+	return nil
+}
+
+// Sync drops the connections of hosts that are no longer clients
+func (s *Server) Sync() error {
+	s.Lock()
+	defer s.Unlock()
+	for c := range s.conns {
+		if _, ok := s.clients[c.host]; !ok {
+			plog.WithField("client", c.host).Info("Dropping 9p client")
+			c.close()
+		}
+	}
+	return nil
+}
+
+// Restart starts listening for clients if the server is stopped
+func (s *Server) Restart() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.listener != nil {
+		return nil
+	}
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		return err
+	}
+	s.listener = l
+	go s.serve(l)
+	return nil
+}
+
+// Stop closes the listener and the connections of all clients
+func (s *Server) Stop() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	err := s.listener.Close()
+	s.listener = nil
+	for c := range s.conns {
+		c.close()
+	}
+	return err
+}
+
+func (s *Server) serve(l net.Listener) {
+	for {
+		rwc, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return
+		}
+		if tc, ok := rwc.(*net.TCPConn); ok {
+			tc.SetKeepAlive(true)
+			if s.timeout > 0 {
+				tc.SetKeepAlivePeriod(s.timeout)
+			}
+		}
+		host, _, _ := net.SplitHostPort(rwc.RemoteAddr().String())
+		c := newConn(s, rwc, host)
+		s.Lock()
+		s.conns[c] = struct{}{}
+		s.Unlock()
+		go func() {
+			c.serve()
+			s.Lock()
+			delete(s.conns, c)
+			s.Unlock()
+		}()
+	}
+}
+
+// allowed returns true if the host may attach
+func (s *Server) allowed(host string) bool {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.clients[host]; ok {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// volume returns the local path of the volume named by an attach name
+func (s *Server) volume(aname string) (string, bool) {
+	name := strings.TrimPrefix(filepath.Clean(aname), s.ExportPath()+"/")
+	if name == "" || strings.Contains(name, "/") {
+		return "", false
+	}
+	s.Lock()
+	defer s.Unlock()
+	p, ok := s.volumes[name]
+	return p, ok
+}
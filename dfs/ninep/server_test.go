@@ -0,0 +1,444 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package ninep
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testClient speaks 9P to a test server one request at a time
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func newTestServer(t *testing.T) (*Server, string, func()) {
+	base, err := ioutil.TempDir("", "ninep-")
+	if err != nil {
+		t.Fatalf("could not create tempdir: %s", err)
+	}
+	vol := filepath.Join(base, "tenant")
+	if err := os.Mkdir(vol, 0755); err != nil {
+		t.Fatalf("could not create volume: %s", err)
+	}
+	s, err := NewServer(base, "serviced_volumes_v2", 0, time.Second)
+	if err != nil {
+		t.Fatalf("could not start server: %s", err)
+	}
+	s.AddVolume(vol)
+	return s, vol, func() {
+		s.Stop()
+		os.RemoveAll(base)
+	}
+}
+
+func dial(t *testing.T, s *Server) *testClient {
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("could not connect to server: %s", err)
+	}
+	c := &testClient{t: t, conn: conn}
+	r := c.rpc(newMessage(msgTversion, noTag).putU32(8192).putStr(Version))
+	if msize, version := r.u32(), r.str(); msize != 8192 || version != Version {
+		t.Fatalf("unexpected version reply %d %s", msize, version)
+	}
+	return c
+}
+
+func (c *testClient) rpc(m *message) *message {
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.conn.Write(m.bytes()); err != nil {
+		c.t.Fatalf("could not send message: %s", err)
+	}
+	r, err := readMessage(c.conn, maxMsize)
+	if err != nil {
+		c.t.Fatalf("could not read reply: %s", err)
+	}
+	if r.Tag != m.Tag {
+		c.t.Fatalf("expected tag %d, got %d", m.Tag, r.Tag)
+	}
+	return r
+}
+
+// call sends a request and fails unless the reply has the expected type
+func (c *testClient) call(m *message) *message {
+	r := c.rpc(m)
+	if r.Type == msgRlerror {
+		c.t.Fatalf("request %d failed: %s", m.Type, syscall.Errno(r.u32()))
+	} else if r.Type != m.Type+1 {
+		c.t.Fatalf("expected reply %d, got %d", m.Type+1, r.Type)
+	}
+	return r
+}
+
+// fail sends a request and returns the error of the reply
+func (c *testClient) fail(m *message) syscall.Errno {
+	r := c.rpc(m)
+	if r.Type != msgRlerror {
+		c.t.Fatalf("expected request %d to fail, got reply %d", m.Type, r.Type)
+	}
+	return syscall.Errno(r.u32())
+}
+
+func (c *testClient) attach(fid uint32, aname string) {
+	c.call(newMessage(msgTattach, 1).putU32(fid).putU32(noFid).putStr("root").putStr(aname).putU32(noUID))
+}
+
+func (c *testClient) walk(fid, newfid uint32, names ...string) *message {
+	m := newMessage(msgTwalk, 1).putU32(fid).putU32(newfid).putU16(uint16(len(names)))
+	for _, name := range names {
+		m.putStr(name)
+	}
+	return m
+}
+
+func TestServer_Version(t *testing.T) {
+	s, _, cleanup := newTestServer(t)
+	defer cleanup()
+	c := dial(t, s)
+	defer c.conn.Close()
+
+	r := c.rpc(newMessage(msgTversion, noTag).putU32(maxMsize * 2).putStr("9P2000"))
+	if msize, version := r.u32(), r.str(); msize != maxMsize || version != "unknown" {
+		t.Errorf("expected %d unknown, got %d %s", maxMsize, msize, version)
+	}
+}
+
+func TestServer_Attach(t *testing.T) {
+	s, _, cleanup := newTestServer(t)
+	defer cleanup()
+	c := dial(t, s)
+	defer c.conn.Close()
+
+	m := newMessage(msgTattach, 1).putU32(1).putU32(noFid).putStr("root").putStr("/serviced_volumes_v2/other").putU32(noUID)
+	if e := c.fail(m); e != syscall.ENOENT {
+		t.Errorf("expected ENOENT, got %s", e)
+	}
+	c.attach(1, "/serviced_volumes_v2/tenant")
+	m = newMessage(msgTattach, 1).putU32(1).putU32(noFid).putStr("root").putStr("/serviced_volumes_v2/tenant").putU32(noUID)
+	if e := c.fail(m); e != syscall.EBADF {
+		t.Errorf("expected EBADF for a fid in use, got %s", e)
+	}
+}
+
+func TestServer_Allowed(t *testing.T) {
+	s, _, cleanup := newTestServer(t)
+	defer cleanup()
+
+	if !s.allowed("127.0.0.1") {
+		t.Errorf("expected loopback to be allowed")
+	}
+	if s.allowed("10.0.0.1") {
+		t.Errorf("expected unknown client to be refused")
+	}
+	s.SetClientValidator(testValidator{"10.0.0.2": false})
+	s.SetClients("10.0.0.1", "10.0.0.2")
+	if !s.allowed("10.0.0.1") {
+		t.Errorf("expected client to be allowed")
+	}
+	if s.allowed("10.0.0.2") {
+		t.Errorf("expected client without dfs permissions to be refused")
+	}
+}
+
+type testValidator map[string]bool
+
+func (v testValidator) ValidateClient(client string) bool {
+	allowed, ok := v[client]
+	return !ok || allowed
+}
+
+func TestServer_Files(t *testing.T) {
+	s, vol, cleanup := newTestServer(t)
+	defer cleanup()
+	c := dial(t, s)
+	defer c.conn.Close()
+	c.attach(1, "/serviced_volumes_v2/tenant")
+
+	// create a directory and a file in it
+	c.call(newMessage(msgTmkdir, 1).putU32(1).putStr("dir").putU32(0750).putU32(noUID))
+	if fi, err := os.Stat(filepath.Join(vol, "dir")); err != nil || fi.Mode().Perm() != 0750 {
+		t.Fatalf("expected directory with mode 0750, got %v (%v)", fi, err)
+	}
+	if r := c.call(c.walk(1, 2, "dir")); r.u16() != 1 {
+		t.Fatalf("expected one qid")
+	}
+	c.call(newMessage(msgTlcreate, 1).putU32(2).putStr("file").putU32(syscall.O_RDWR).putU32(0640).putU32(noUID))
+	if r := c.call(newMessage(msgTwrite, 1).putU32(2).putU64(0).putData([]byte("hello world"))); r.u32() != 11 {
+		t.Errorf("expected 11 bytes written")
+	}
+	if r := c.call(newMessage(msgTread, 1).putU32(2).putU64(6).putU32(100)); string(r.data()) != "world" {
+		t.Errorf("expected to read world")
+	}
+	c.call(newMessage(msgTclunk, 1).putU32(2))
+	if data, err := ioutil.ReadFile(filepath.Join(vol, "dir", "file")); err != nil || string(data) != "hello world" {
+		t.Errorf("unexpected file contents %q (%v)", data, err)
+	}
+
+	// attributes
+	c.call(c.walk(1, 3, "dir", "file"))
+	r := c.call(newMessage(msgTgetattr, 1).putU32(3).putU64(getattrBasic))
+	r.u64()
+	r.qid()
+	if mode := r.u32(); mode != syscall.S_IFREG|0640 {
+		t.Errorf("expected mode %o, got %o", syscall.S_IFREG|0640, mode)
+	}
+	r.u32()
+	r.u32()
+	r.u64()
+	r.u64()
+	if size := r.u64(); size != 11 {
+		t.Errorf("expected size 11, got %d", size)
+	}
+	c.call(newMessage(msgTsetattr, 1).putU32(3).putU32(setattrSize).putU32(0).putU32(0).putU32(0).putU64(5).putU64(0).putU64(0).putU64(0).putU64(0))
+	if fi, err := os.Stat(filepath.Join(vol, "dir", "file")); err != nil || fi.Size() != 5 {
+		t.Errorf("expected file to be truncated to 5 bytes, got %v (%v)", fi, err)
+	}
+
+	// list the directory
+	c.call(c.walk(1, 2, "dir"))
+	c.call(newMessage(msgTlopen, 1).putU32(2).putU32(syscall.O_RDONLY))
+	r = c.call(newMessage(msgTreaddir, 1).putU32(2).putU64(0).putU32(4096))
+	entries := &message{body: r.data()}
+	names := []string{}
+	for entries.off < len(entries.body) {
+		entries.qid()
+		entries.u64()
+		entries.u8()
+		names = append(names, entries.str())
+	}
+	if len(names) != 3 || names[2] != "file" {
+		t.Errorf("expected entries ., .. and file, got %v", names)
+	}
+
+	// rename and remove
+	c.call(newMessage(msgTrenameat, 1).putU32(1).putStr("dir").putU32(1).putStr("moved"))
+	if _, err := os.Stat(filepath.Join(vol, "moved", "file")); err != nil {
+		t.Errorf("expected renamed directory: %s", err)
+	}
+	if e := c.fail(newMessage(msgTunlinkat, 1).putU32(1).putStr("moved").putU32(0)); e != syscall.EISDIR {
+		t.Errorf("expected EISDIR, got %s", e)
+	}
+	if e := c.fail(newMessage(msgTunlinkat, 1).putU32(1).putStr("moved").putU32(atRemoveDir)); e != syscall.ENOTEMPTY {
+		t.Errorf("expected ENOTEMPTY, got %s", e)
+	}
+}
+
+func TestServer_WalkConfined(t *testing.T) {
+	s, vol, cleanup := newTestServer(t)
+	defer cleanup()
+	c := dial(t, s)
+	defer c.conn.Close()
+	c.attach(1, "/serviced_volumes_v2/tenant")
+
+	// walking above the root stays at the root
+	c.call(c.walk(1, 2, "..", ".."))
+	c.call(newMessage(msgTlcreate, 1).putU32(2).putStr("file").putU32(syscall.O_RDWR).putU32(0644).putU32(noUID))
+	if _, err := os.Stat(filepath.Join(vol, "file")); err != nil {
+		t.Errorf("expected file in the volume: %s", err)
+	}
+
+	// symlinks are not followed
+	if err := os.Symlink("/", filepath.Join(vol, "link")); err != nil {
+		t.Fatalf("could not create symlink: %s", err)
+	}
+	if r := c.call(c.walk(1, 3, "link", "etc")); r.u16() != 1 {
+		t.Errorf("expected walk through symlink to stop at the symlink")
+	}
+	if e := c.fail(newMessage(msgTreadlink, 1).putU32(3)); e != syscall.EBADF {
+		t.Errorf("expected partial walk not to create a fid, got %s", e)
+	}
+	if r := c.call(c.walk(1, 3, "link")); r.u16() != 1 {
+		t.Errorf("expected to walk to the symlink itself")
+	}
+	if r := c.call(newMessage(msgTreadlink, 1).putU32(3)); r.str() != "/" {
+		t.Errorf("expected symlink target /")
+	}
+	if e := c.fail(c.walk(1, 4, "a/b")); e != syscall.EINVAL {
+		t.Errorf("expected EINVAL for a name with a slash, got %s", e)
+	}
+}
+
+func TestServer_SetattrNoFollow(t *testing.T) {
+	s, vol, cleanup := newTestServer(t)
+	defer cleanup()
+	c := dial(t, s)
+	defer c.conn.Close()
+	c.attach(1, "/serviced_volumes_v2/tenant")
+
+	// a file outside of the volume, with a symlink to it in the volume
+	target := filepath.Join(filepath.Dir(vol), "target")
+	if err := ioutil.WriteFile(target, []byte("hello world"), 0600); err != nil {
+		t.Fatalf("could not create file: %s", err)
+	}
+	mtime := time.Unix(1000000000, 0)
+	if err := os.Chtimes(target, mtime, mtime); err != nil {
+		t.Fatalf("could not set file times: %s", err)
+	}
+	if err := os.Symlink(target, filepath.Join(vol, "link")); err != nil {
+		t.Fatalf("could not create symlink: %s", err)
+	}
+	c.call(c.walk(1, 2, "link"))
+
+	setattr := func(valid uint32, mode uint32, size uint64) *message {
+		return newMessage(msgTsetattr, 1).putU32(2).putU32(valid).putU32(mode).putU32(0).putU32(0).putU64(size).putU64(2000000000).putU64(0).putU64(2000000000).putU64(0)
+	}
+	if e := c.fail(setattr(setattrMode, 0777, 0)); e != syscall.EOPNOTSUPP {
+		t.Errorf("expected EOPNOTSUPP changing the mode of a symlink, got %s", e)
+	}
+	if e := c.fail(setattr(setattrSize, 0, 5)); e != syscall.ELOOP {
+		t.Errorf("expected ELOOP truncating a symlink, got %s", e)
+	}
+	c.call(setattr(setattrMtime|setattrMtimeSet, 0, 0))
+
+	fi, err := os.Stat(target)
+	if err != nil {
+		t.Fatalf("could not stat file: %s", err)
+	}
+	if fi.Mode().Perm() != 0600 || fi.Size() != 11 || !fi.ModTime().Equal(mtime) {
+		t.Errorf("expected the file outside of the volume to be unchanged, got mode %o size %d mtime %s", fi.Mode().Perm(), fi.Size(), fi.ModTime())
+	}
+	if li, err := os.Lstat(filepath.Join(vol, "link")); err != nil || li.ModTime().Unix() != 2000000000 {
+		t.Errorf("expected the mtime of the symlink to be set, got %v (%v)", li, err)
+	}
+
+	// regular files are changed as usual
+	c.call(c.walk(1, 3))
+	c.call(newMessage(msgTlcreate, 1).putU32(3).putStr("file").putU32(syscall.O_RDWR).putU32(0644).putU32(noUID))
+	c.call(newMessage(msgTclunk, 1).putU32(3))
+	c.call(newMessage(msgTclunk, 1).putU32(2))
+	c.call(c.walk(1, 2, "file"))
+	c.call(setattr(setattrMode, 0600, 0))
+	if fi, err := os.Stat(filepath.Join(vol, "file")); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("expected file mode 0600, got %v (%v)", fi, err)
+	}
+}
+
+func TestServer_SwappedDirectory(t *testing.T) {
+	s, vol, cleanup := newTestServer(t)
+	defer cleanup()
+	c := dial(t, s)
+	defer c.conn.Close()
+	c.attach(1, "/serviced_volumes_v2/tenant")
+
+	// a directory outside of the volume, and one in it with the same file
+	outside := filepath.Join(filepath.Dir(vol), "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatalf("could not create directory: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(outside, "shadow"), []byte("secret"), 0600); err != nil {
+		t.Fatalf("could not create file: %s", err)
+	}
+	if err := os.Mkdir(filepath.Join(vol, "a"), 0755); err != nil {
+		t.Fatalf("could not create directory: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(vol, "a", "shadow"), []byte("tenant"), 0600); err != nil {
+		t.Fatalf("could not create file: %s", err)
+	}
+	c.call(c.walk(1, 2, "a", "shadow"))
+	c.call(c.walk(1, 3, "a"))
+	c.call(c.walk(1, 4, "a"))
+
+	// swap the directory for a symlink out of the volume after the walks
+	if err := os.Rename(filepath.Join(vol, "a"), filepath.Join(vol, "moved")); err != nil {
+		t.Fatalf("could not rename directory: %s", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(vol, "a")); err != nil {
+		t.Fatalf("could not create symlink: %s", err)
+	}
+
+	c.call(newMessage(msgTlopen, 1).putU32(2).putU32(syscall.O_RDWR))
+	c.call(newMessage(msgTwrite, 1).putU32(2).putU64(0).putData([]byte("client")))
+	c.call(newMessage(msgTclunk, 1).putU32(2))
+	c.call(newMessage(msgTlcreate, 1).putU32(3).putStr("created").putU32(syscall.O_RDWR).putU32(0644).putU32(noUID))
+	c.call(newMessage(msgTmkdir, 1).putU32(4).putStr("dir").putU32(0755).putU32(noUID))
+	c.call(newMessage(msgTsymlink, 1).putU32(4).putStr("link").putStr("/").putU32(noUID))
+	c.call(newMessage(msgTrenameat, 1).putU32(4).putStr("dir").putU32(4).putStr("renamed"))
+
+	if data, err := ioutil.ReadFile(filepath.Join(outside, "shadow")); err != nil || string(data) != "secret" {
+		t.Errorf("expected the file outside of the volume to be unchanged, got %q (%v)", data, err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(vol, "moved", "shadow")); err != nil || string(data) != "client" {
+		t.Errorf("expected the write in the moved directory, got %q (%v)", data, err)
+	}
+	for _, name := range []string{"created", "renamed", "link"} {
+		if _, err := os.Lstat(filepath.Join(outside, name)); !os.IsNotExist(err) {
+			t.Errorf("expected no %s outside of the volume (%v)", name, err)
+		}
+		if _, err := os.Lstat(filepath.Join(vol, "moved", name)); err != nil {
+			t.Errorf("expected %s in the moved directory: %s", name, err)
+		}
+	}
+
+	// .. from the moved directory is the root, which cannot be removed
+	c.call(c.walk(4, 5, ".."))
+	if e := c.fail(newMessage(msgTremove, 1).putU32(5)); e != syscall.EBUSY {
+		t.Errorf("expected EBUSY removing the root, got %s", e)
+	}
+	c.call(c.walk(4, 5, "renamed"))
+	c.call(newMessage(msgTremove, 1).putU32(5))
+	if _, err := os.Lstat(filepath.Join(vol, "moved", "renamed")); !os.IsNotExist(err) {
+		t.Errorf("expected the directory to be removed (%v)", err)
+	}
+}
+
+func TestServer_RemoveVolume(t *testing.T) {
+	s, vol, cleanup := newTestServer(t)
+	defer cleanup()
+	c := dial(t, s)
+	defer c.conn.Close()
+	c.attach(1, "/serviced_volumes_v2/tenant")
+
+	s.RemoveVolume(vol)
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	c.conn.Write(newMessage(msgTclunk, 1).putU32(1).bytes())
+	if _, err := readMessage(c.conn, maxMsize); err == nil {
+		t.Errorf("expected connection to be closed")
+	}
+}
+
+func TestClient_Probe(t *testing.T) {
+	s, _, cleanup := newTestServer(t)
+	defer cleanup()
+	_, port, _ := net.SplitHostPort(s.Addr().String())
+	p, _ := net.LookupPort("tcp", port)
+
+	if err := NewClient(p, time.Second).Probe("127.0.0.1"); err != nil {
+		t.Errorf("unexpected error probing server: %s", err)
+	}
+	s.Stop()
+	if err := NewClient(p, time.Second).Probe("127.0.0.1"); err == nil {
+		t.Errorf("expected error probing a stopped server")
+	}
+}
+
+func TestSplitRemotePath(t *testing.T) {
+	host, aname, err := splitRemotePath("10.0.0.1:/serviced_volumes_v2/tenant")
+	if err != nil || host != "10.0.0.1" || aname != "/serviced_volumes_v2/tenant" {
+		t.Errorf("unexpected split %s %s (%v)", host, aname, err)
+	}
+	for _, p := range []string{"10.0.0.1", "host:/a", "10.0.0.1:/", "10.0.0.1:a"} {
+		if _, _, err := splitRemotePath(p); err != ErrMalformedMountpoint {
+			t.Errorf("expected %s for %s, got %v", ErrMalformedMountpoint, p, err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dfs
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/volume"
+)
+
+// SetQuota limits the space that an application may use on its volume.  A
+// size of 0 removes the limit.
+func (dfs *DistributedFilesystem) SetQuota(tenantID string, size uint64) error {
+	logger := plog.WithFields(log.Fields{
+		"tenantid": tenantID,
+		"quota":    size,
+	})
+	if err := dfs.disk.Resize(tenantID, size); err != nil {
+		logger.WithError(err).Error("Could not set quota on application volume")
+		return err
+	}
+	logger.Info("Set quota on application volume")
+	return nil
+}
+
+// CanLowerQuota returns false if a quota cannot be set lower than it was.
+// Devicemapper enforces the quota with the size of the application's device,
+// which can grow but not shrink.
+func (dfs *DistributedFilesystem) CanLowerQuota() bool {
+	return dfs.disk.DriverType() != volume.DriverTypeDeviceMapper
+}
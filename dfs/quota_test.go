@@ -0,0 +1,33 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package dfs_test
+
+import (
+	"errors"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *DFSTestSuite) TestSetQuota_Fail(c *C) {
+	expected := errors.New("could not resize")
+	s.disk.On("Resize", "tenantid", uint64(1<<30)).Return(expected)
+	c.Assert(s.dfs.SetQuota("tenantid", 1<<30), Equals, expected)
+}
+
+func (s *DFSTestSuite) TestSetQuota_Success(c *C) {
+	s.disk.On("Resize", "tenantid", uint64(1<<30)).Return(nil)
+	c.Assert(s.dfs.SetQuota("tenantid", 1<<30), IsNil)
+}
@@ -0,0 +1,286 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrManifestNotFound is returned when the registry has no manifest for
+	// an image.
+	ErrManifestNotFound = errors.New("registry: manifest not found")
+)
+
+// manifestTypes are the manifest formats that the docker registry may store
+// an image under; the schema2 type comes first so that the registry reports
+// the digest that docker pushed.
+var manifestTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.v1+prettyjws",
+}
+
+// blobPrefix is how the registry reports a blob that garbage-collect deletes
+// (or would delete, on a dry run).
+const blobPrefix = "blob eligible for deletion: "
+
+// Collector deletes image data from the docker registry
+type Collector interface {
+	// ManifestDigest returns the digest of the manifest that a tag points to
+	ManifestDigest(repo, tag string) (string, error)
+	// DeleteManifest removes a manifest, and every tag that points to it, from
+	// a repo
+	DeleteManifest(repo, digest string) error
+	// CollectBlobs removes the blobs that are no longer referenced by a
+	// manifest and returns their digests
+	CollectBlobs(dryRun bool) ([]string, error)
+}
+
+var _ = Collector(&RegistryCollector{})
+
+// RegistryCollector talks to the docker registry's v2 api to delete
+// manifests, and runs the registry's garbage-collect command to delete blobs.
+type RegistryCollector struct {
+	scheme    string
+	host      string
+	namespace string
+	username  string
+	password  string
+	client    *http.Client
+	exec      func(dryRun bool) ([]byte, error)
+}
+
+// NewRegistryCollector creates a collector for the registry at address
+// (host:port[/namespace]).  exec runs the registry's garbage-collect command;
+// if it is nil, deleting blobs is left to the registry.
+func NewRegistryCollector(address string, exec func(dryRun bool) ([]byte, error)) *RegistryCollector {
+	host, namespace := address, ""
+	if i := strings.Index(address, "/"); i >= 0 {
+		host, namespace = address[:i], strings.Trim(address[i+1:], "/")
+	}
+	return &RegistryCollector{
+		scheme:    "http",
+		host:      host,
+		namespace: namespace,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		exec:      exec,
+	}
+}
+
+// SetCredentials sets the user that the collector logs into the registry as.
+func (c *RegistryCollector) SetCredentials(username, password string) {
+	c.username, c.password = username, password
+}
+
+// SetTLS talks to the registry over https, trusting the certificate
+// authority in caFile as well as the system's, if caFile is set.
+func (c *RegistryCollector) SetTLS(caFile string) error {
+	tlsConfig := &tls.Config{}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	c.scheme = "https"
+	c.client.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+	return nil
+}
+
+func (c *RegistryCollector) manifestURL(repo, reference string) string {
+	return fmt.Sprintf("%s://%s/v2/%s/manifests/%s", c.scheme, c.host, path.Join(c.namespace, repo), reference)
+}
+
+// do sends a request to the registry, logging in when the registry asks for
+// it, either with basic auth or with a token from the registry's token
+// service.
+func (c *RegistryCollector) do(method, url string, header http.Header) (*http.Response, error) {
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		if c.username != "" {
+			req.SetBasicAuth(c.username, c.password)
+		}
+		return req, nil
+	}
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return nil, fmt.Errorf("registry refused credentials for %s", url)
+	}
+	token, err := c.token(challenge)
+	if err != nil {
+		return nil, err
+	}
+	if req, err = newRequest(); err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return c.client.Do(req)
+}
+
+// challengeParam matches the key="value" pairs of a WWW-Authenticate header
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// token requests a bearer token from the token service named in a registry's
+// auth challenge.
+func (c *RegistryCollector) token(challenge string) (string, error) {
+	params := make(map[string]string)
+	for _, match := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(match[1])] = match[2]
+	}
+	realm, err := neturl.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("registry sent an invalid auth challenge: %s", challenge)
+	}
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if value, ok := params[key]; ok {
+			query.Set(key, value)
+		}
+	}
+	realm.RawQuery = query.Encode()
+	req, err := http.NewRequest("GET", realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token service returned %s", resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	} else if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", errors.New("registry token service did not return a token")
+}
+
+// ManifestDigest implements Collector
+func (c *RegistryCollector) ManifestDigest(repo, tag string) (string, error) {
+	header := http.Header{}
+	header.Set("Accept", strings.Join(manifestTypes, ", "))
+	resp, err := c.do("HEAD", c.manifestURL(repo, tag), header)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", ErrManifestNotFound
+	default:
+		return "", fmt.Errorf("registry returned %s for %s:%s", resp.Status, repo, tag)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry did not return a digest for %s:%s", repo, tag)
+	}
+	return digest, nil
+}
+
+// DeleteManifest implements Collector
+func (c *RegistryCollector) DeleteManifest(repo, digest string) error {
+	resp, err := c.do("DELETE", c.manifestURL(repo, digest), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrManifestNotFound
+	default:
+		return fmt.Errorf("registry returned %s deleting %s@%s", resp.Status, repo, digest)
+	}
+}
+
+// CollectBlobs implements Collector
+func (c *RegistryCollector) CollectBlobs(dryRun bool) ([]string, error) {
+	if c.exec == nil {
+		// external registries run their own garbage collection
+		return []string{}, nil
+	}
+	output, err := c.exec(dryRun)
+	if err != nil {
+		return nil, err
+	}
+	return parseBlobs(output), nil
+}
+
+// parseBlobs returns the blob digests in the output of the registry's
+// garbage-collect command.
+func parseBlobs(output []byte) []string {
+	blobs := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, blobPrefix); i >= 0 {
+			blobs = append(blobs, strings.TrimSpace(line[i+len(blobPrefix):]))
+		}
+	}
+	return blobs
+}
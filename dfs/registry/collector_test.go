@@ -0,0 +1,165 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type CollectorSuite struct {
+	server   *httptest.Server
+	digests  map[string]string
+	requests []string
+	dryRun   bool
+}
+
+var _ = Suite(&CollectorSuite{})
+
+func (s *CollectorSuite) SetUpTest(c *C) {
+	s.digests = map[string]string{
+		"/v2/tenant/repo/manifests/latest": "sha256:aaa",
+	}
+	s.requests = []string{}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		switch r.Method {
+		case "HEAD":
+			c.Check(r.Header.Get("Accept"), Matches, "application/vnd.docker.distribution.manifest.v2\\+json.*")
+			if digest, ok := s.digests[r.URL.Path]; ok {
+				w.Header().Set("Docker-Content-Digest", digest)
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		case "DELETE":
+			if r.URL.Path == "/v2/tenant/repo/manifests/sha256:aaa" {
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func (s *CollectorSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *CollectorSuite) collector(output string, err error) *RegistryCollector {
+	return NewRegistryCollector(strings.TrimPrefix(s.server.URL, "http://"), func(dryRun bool) ([]byte, error) {
+		s.dryRun = dryRun
+		return []byte(output), err
+	})
+}
+
+func (s *CollectorSuite) TestManifestDigest(c *C) {
+	collector := s.collector("", nil)
+	digest, err := collector.ManifestDigest("tenant/repo", "latest")
+	c.Assert(err, IsNil)
+	c.Assert(digest, Equals, "sha256:aaa")
+
+	_, err = collector.ManifestDigest("tenant/repo", "missing")
+	c.Assert(err, Equals, ErrManifestNotFound)
+}
+
+func (s *CollectorSuite) TestDeleteManifest(c *C) {
+	collector := s.collector("", nil)
+	c.Assert(collector.DeleteManifest("tenant/repo", "sha256:aaa"), IsNil)
+	c.Assert(collector.DeleteManifest("tenant/repo", "sha256:bbb"), Equals, ErrManifestNotFound)
+	c.Assert(s.requests, DeepEquals, []string{
+		"DELETE /v2/tenant/repo/manifests/sha256:aaa",
+		"DELETE /v2/tenant/repo/manifests/sha256:bbb",
+	})
+}
+
+func (s *CollectorSuite) TestCollectBlobs(c *C) {
+	output := `tenant/repo
+tenant/repo: marking manifest sha256:aaa
+tenant/repo: marking blob sha256:bbb
+
+2 blobs marked, 2 blobs eligible for deletion
+blob eligible for deletion: sha256:ccc
+blob eligible for deletion: sha256:ddd
+`
+	blobs, err := s.collector(output, nil).CollectBlobs(true)
+	c.Assert(err, IsNil)
+	c.Assert(s.dryRun, Equals, true)
+	c.Assert(blobs, DeepEquals, []string{"sha256:ccc", "sha256:ddd"})
+
+	expected := errors.New("exec failed")
+	_, err = s.collector("", expected).CollectBlobs(false)
+	c.Assert(err, Equals, expected)
+	c.Assert(s.dryRun, Equals, false)
+}
+
+func (s *CollectorSuite) TestNamespaceAndToken(c *C) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			user, password, ok := r.BasicAuth()
+			c.Check(ok, Equals, true)
+			c.Check(user+":"+password, Equals, "admin:secret")
+			c.Check(r.URL.Query().Get("service"), Equals, "registry")
+			c.Check(r.URL.Query().Get("scope"), Equals, "repository:serviced/tenant/repo:pull")
+			fmt.Fprint(w, `{"token": "abc"}`)
+		case "/v2/serviced/tenant/repo/manifests/latest":
+			if r.Header.Get("Authorization") != "Bearer abc" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:serviced/tenant/repo:pull"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", "sha256:aaa")
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	collector := NewRegistryCollector(strings.TrimPrefix(server.URL, "http://")+"/serviced", nil)
+	collector.SetCredentials("admin", "secret")
+	digest, err := collector.ManifestDigest("tenant/repo", "latest")
+	c.Assert(err, IsNil)
+	c.Assert(digest, Equals, "sha256:aaa")
+
+	// external registries collect their own blobs
+	blobs, err := collector.CollectBlobs(false)
+	c.Assert(err, IsNil)
+	c.Assert(blobs, DeepEquals, []string{})
+}
+
+func (s *CollectorSuite) TestBasicAuthRefused(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	collector := NewRegistryCollector(strings.TrimPrefix(server.URL, "http://"), nil)
+	collector.SetCredentials("admin", "wrong")
+	_, err := collector.ManifestDigest("tenant/repo", "latest")
+	c.Assert(err, ErrorMatches, "registry refused credentials for .*")
+}
+
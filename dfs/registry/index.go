@@ -30,6 +30,7 @@ type RegistryIndex interface {
 	PushImage(image, uuid string, hash string) error
 	RemoveImage(image string) error
 	SearchLibraryByTag(library string, tag string) ([]registry.Image, error)
+	ListImages() ([]registry.Image, error)
 }
 
 var _ = RegistryIndex(&RegistryIndexClient{})
@@ -57,7 +58,7 @@ func NewRegistryIndexClient(f facade) *RegistryIndexClient {
 	}
 }
 
-// parseImage trims the registry host:port
+// parseImage trims the registry host:port and namespace
 func (client *RegistryIndexClient) parseImage(image string) (string, error) {
 	imageID, err := commons.ParseImageID(image)
 	if err != nil {
@@ -67,7 +68,7 @@ func (client *RegistryIndexClient) parseImage(image string) (string, error) {
 		imageID.Tag = docker.Latest
 	}
 	image = commons.ImageID{
-		User: imageID.User,
+		User: imageID.Library(),
 		Repo: imageID.Repo,
 		Tag:  imageID.Tag,
 	}.String()
@@ -98,7 +99,7 @@ func (client *RegistryIndexClient) PushImage(image, uuid string, hash string) er
 	}
 
 	rImage := &registry.Image{
-		Library: imageID.User,
+		Library: imageID.Library(),
 		Repo:    imageID.Repo,
 		Tag:     imageID.Tag,
 		UUID:    uuid,
@@ -120,3 +121,8 @@ func (client *RegistryIndexClient) RemoveImage(image string) error {
 func (client *RegistryIndexClient) SearchLibraryByTag(library, tag string) ([]registry.Image, error) {
 	return client.facade.SearchRegistryLibraryByTag(client.ctx, library, tag)
 }
+
+// ListImages implements RegistryIndex
+func (client *RegistryIndexClient) ListImages() ([]registry.Image, error) {
+	return client.facade.GetRegistryImages(client.ctx)
+}
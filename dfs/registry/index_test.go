@@ -70,6 +70,10 @@ func (s *RegistryIndexSuite) TestFindImage(c *C) {
 	actual, err = s.index.FindImage("test-host:5000/library/repo:")
 	c.Assert(actual, DeepEquals, expected)
 	c.Assert(err, IsNil)
+	// namespaced in an external registry
+	actual, err = s.index.FindImage("registry.example.com/serviced/library/repo")
+	c.Assert(actual, DeepEquals, expected)
+	c.Assert(err, IsNil)
 }
 
 func (s *RegistryIndexSuite) TestPushImage(c *C) {
@@ -111,3 +115,19 @@ func (s *RegistryIndexSuite) TestSearchLibraryByTag(c *C) {
 	c.Assert(actual, DeepEquals, expected)
 	s.facade.AssertExpectations(c)
 }
+
+func (s *RegistryIndexSuite) TestListImages(c *C) {
+	expected := []registry.Image{
+		{
+			Library: "libraryname",
+			Repo:    "reponame",
+			Tag:     "latest",
+			UUID:    "uuidvalue",
+		},
+	}
+	s.facade.On("GetRegistryImages", s.ctx).Return(expected, nil).Once()
+	actual, err := s.index.ListImages()
+	c.Assert(err, IsNil)
+	c.Assert(actual, DeepEquals, expected)
+	s.facade.AssertExpectations(c)
+}
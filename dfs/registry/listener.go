@@ -19,7 +19,9 @@ import (
 
 	"github.com/control-center/serviced/coordinator/client"
 	"github.com/control-center/serviced/dfs/docker"
+	"github.com/control-center/serviced/domain/pool"
 	"github.com/control-center/serviced/domain/registry"
+	zkservice "github.com/control-center/serviced/zzk/service"
 	dockerclient "github.com/fsouza/go-dockerclient"
 	"github.com/zenoss/glog"
 )
@@ -27,6 +29,7 @@ import (
 const (
 	zkregistryrepos = "/docker/registry/repos"
 	zkregistrytags  = "/docker/registry/tags"
+	zkpools         = "/pools"
 )
 
 // RegistryImageNode is the registry image as it is written into the
@@ -74,6 +77,8 @@ type RegistryListener struct {
 	address string
 	// id of the host as recognized by cc
 	hostid string
+	// id of the resource pool of the host, whose registry it pulls from
+	poolid string
 }
 
 // NewRegistryListener instantiates a new registry listener
@@ -81,6 +86,57 @@ func NewRegistryListener(docker docker.Docker, address, hostid string) *Registry
 	return &RegistryListener{docker: docker, address: address, hostid: hostid}
 }
 
+// SetPoolID sets the resource pool of the host, so that images are pulled
+// from the pool's docker registry when it has one.
+func (l *RegistryListener) SetPoolID(poolid string) {
+	l.poolid = poolid
+}
+
+// registryAddress returns the address of the docker registry that this host
+// pulls images from.
+func (l *RegistryListener) registryAddress() string {
+	if l.poolid == "" || l.conn == nil {
+		return l.address
+	}
+	node := &zkservice.PoolNode{ResourcePool: &pool.ResourcePool{}}
+	if err := l.conn.Get(path.Join(zkpools, l.poolid), node); err != nil {
+		glog.Warningf("Could not look up the docker registry of pool %s, using %s: %s", l.poolid, l.address, err)
+		return l.address
+	}
+	if node.Registry == "" {
+		return l.address
+	}
+	return node.Registry
+}
+
+// pushAddresses returns the addresses of the docker registries that images
+// are pushed into; the master's registry followed by those of the resource
+// pools.
+func (l *RegistryListener) pushAddresses() []string {
+	addresses := []string{l.address}
+	poolids, err := l.conn.Children(zkpools)
+	if err != nil {
+		if err != client.ErrNoNode {
+			glog.Warningf("Could not look up the docker registries of the resource pools: %s", err)
+		}
+		return addresses
+	}
+	seen := map[string]struct{}{l.address: struct{}{}}
+	for _, poolid := range poolids {
+		node := &zkservice.PoolNode{ResourcePool: &pool.ResourcePool{}}
+		if err := l.conn.Get(path.Join(zkpools, poolid), node); err != nil {
+			glog.Warningf("Could not look up the docker registry of pool %s: %s", poolid, err)
+			continue
+		}
+		if _, ok := seen[node.Registry]; ok || node.Registry == "" {
+			continue
+		}
+		seen[node.Registry] = struct{}{}
+		addresses = append(addresses, node.Registry)
+	}
+	return addresses
+}
+
 // SetConnection implements zzk.Listener
 func (l *RegistryListener) SetConnection(conn client.Connection) {
 	l.conn = conn
@@ -166,17 +222,20 @@ func (l *RegistryListener) Spawn(shutdown <-chan interface{}, id string) {
 					// Push the image and update the registry
 					// If the push is unsuccessful, still update the timestamp,
 					// so that the push will get retriggered the next time it
-					// is needed.
-					registrypath := path.Join(l.address, node.Image.String())
-					glog.V(1).Infof("Updating registry image %s from path=%s", img.ID, registrypath)
-					if err := l.docker.TagImage(img.ID, registrypath); err != nil {
-						glog.Warningf("Could not tag %s as %s: %s", img.ID, registrypath, err)
-						node.PushedAt = time.Unix(0, 0)
-					} else if err := l.docker.PushImage(registrypath); err != nil {
-						glog.Warningf("Could not push %s: %s", registrypath, err)
-						node.PushedAt = time.Unix(0, 0)
-					} else {
-						node.PushedAt = time.Now().UTC()
+					// is needed.  A pool registry that misses the image gets
+					// it when a host of the pool fails to pull it, which
+					// resets the timestamp.
+					node.PushedAt = time.Unix(0, 0)
+					for i, address := range l.pushAddresses() {
+						registrypath := path.Join(address, node.Image.String())
+						glog.V(1).Infof("Updating registry image %s from path=%s", img.ID, registrypath)
+						if err := l.docker.TagImage(img.ID, registrypath); err != nil {
+							glog.Warningf("Could not tag %s as %s: %s", img.ID, registrypath, err)
+						} else if err := l.docker.PushImage(registrypath); err != nil {
+							glog.Warningf("Could not push %s: %s", registrypath, err)
+						} else if i == 0 {
+							node.PushedAt = time.Now().UTC()
+						}
 					}
 					// The point here is to make sure the node triggers an
 					// event regardless of whether the push was successful.
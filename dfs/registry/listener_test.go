@@ -25,7 +25,9 @@ import (
 	coordclient "github.com/control-center/serviced/coordinator/client"
 	"github.com/control-center/serviced/coordinator/client/zookeeper"
 	"github.com/control-center/serviced/dfs/docker/mocks"
+	"github.com/control-center/serviced/domain/pool"
 	"github.com/control-center/serviced/domain/registry"
+	zkservice "github.com/control-center/serviced/zzk/service"
 	zzktest "github.com/control-center/serviced/zzk/test"
 	dockerclient "github.com/fsouza/go-dockerclient"
 
@@ -80,6 +82,11 @@ func (i *testImage) GetW(c *C, conn coordclient.Connection, done <-chan struct{}
 	return evt, node
 }
 
+func createPool(c *C, conn coordclient.Connection, poolID, registry string) {
+	err := zkservice.UpdateResourcePool(conn, pool.ResourcePool{ID: poolID, Registry: registry})
+	c.Assert(err, IsNil)
+}
+
 func TestRegistryListener(t *testing.T) { TestingT(t) }
 
 type RegistryListenerSuite struct {
@@ -137,6 +144,7 @@ func (s *RegistryListenerSuite) SetUpTest(c *C) {
 
 func (s *RegistryListenerSuite) TearDownTest(c *C) {
 	s.conn.Delete("/docker/registry")
+	s.conn.Delete("/pools")
 }
 
 func (s *RegistryListenerSuite) TestRegistryListener_NoNode(c *C) {
@@ -531,6 +539,58 @@ func (s *RegistryListenerSuite) TestRegistryListener_Success(c *C) {
 	s.docker.AssertExpectations(c)
 }
 
+func (s *RegistryListenerSuite) TestRegistryListener_PoolRegistries(c *C) {
+	createPool(c, s.conn, "pool1", "pool-server:5000/pool")
+	createPool(c, s.conn, "pool2", "")
+	createPool(c, s.conn, "pool3", s.listener.address)
+	createPool(c, s.conn, "pool4", "pool-server:5000/pool")
+	rImage := &testImage{
+		Image: &registry.Image{
+			Library: "libraryname",
+			Repo:    "reponame",
+			Tag:     "tagname",
+			UUID:    "uuidvalue",
+		},
+	}
+	_ = rImage.Create(c, s.conn)
+	imageDone := make(chan struct{})
+	defer close(imageDone)
+	evt, _ := rImage.GetW(c, s.conn, imageDone)
+	s.docker.On("FindImage", rImage.Image.UUID).Return(&dockerclient.Image{ID: rImage.Image.UUID}, nil).Once()
+	s.docker.On("TagImage", rImage.Image.UUID, rImage.Address(s.listener.address)).Return(nil).Once()
+	s.docker.On("PushImage", rImage.Address(s.listener.address)).Return(nil).Once()
+	s.docker.On("TagImage", rImage.Image.UUID, rImage.Address("pool-server:5000/pool")).Return(nil).Once()
+	s.docker.On("PushImage", rImage.Address("pool-server:5000/pool")).Return(ErrTestImageNotFound).Once()
+
+	shutdown := make(chan interface{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.listener.Spawn(shutdown, rImage.ID())
+	}()
+
+	// the image is pushed once the master's registry has it
+	select {
+	case <-time.After(5 * time.Second):
+		c.Errorf("listener did not update the node")
+	case <-done:
+		c.Fatalf("listener exited prematurely")
+	case <-evt:
+		node := &RegistryImageNode{}
+		err := s.conn.Get(rImage.Path(), node)
+		c.Assert(err, IsNil)
+		c.Assert(node.PushedAt.Unix() > 0, Equals, true)
+	}
+
+	close(shutdown)
+	select {
+	case <-time.After(5 * time.Second):
+		c.Fatalf("listener did not shutdown within the timeout!")
+	case <-done:
+	}
+	s.docker.AssertExpectations(c)
+}
+
 func (s *RegistryListenerSuite) TestRegistryListener_TestFindImage_SuccessByID(c *C) {
 	rImage := &testImage{
 		Image: &registry.Image{
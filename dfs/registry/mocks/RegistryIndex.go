@@ -87,3 +87,24 @@ func (_m *RegistryIndex) SearchLibraryByTag(library string, tag string) ([]regis
 
 	return r0, r1
 }
+func (_m *RegistryIndex) ListImages() ([]registry.Image, error) {
+	ret := _m.Called()
+
+	var r0 []registry.Image
+	if rf, ok := ret.Get(0).(func() []registry.Image); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]registry.Image)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -45,14 +45,14 @@ func (l *RegistryListener) ImagePath(image string) (string, error) {
 		return "", err
 	}
 	rImage := &registry.Image{
-		Library: imageID.User,
+		Library: imageID.Library(),
 		Repo:    imageID.Repo,
 		Tag:     imageID.Tag,
 	}
 	if imageID.IsLatest() {
 		rImage.Tag = docker.Latest
 	}
-	return path.Join(l.address, rImage.String()), nil
+	return path.Join(l.registryAddress(), rImage.String()), nil
 }
 
 // PullImage waits for an image to be available on the docker registry so it
@@ -63,7 +63,7 @@ func (l *RegistryListener) PullImage(cancel <-chan time.Time, image string) erro
 		return err
 	}
 	rImage := &registry.Image{
-		Library: imageID.User,
+		Library: imageID.Library(),
 		Repo:    imageID.Repo,
 		Tag:     imageID.Tag,
 	}
@@ -71,7 +71,7 @@ func (l *RegistryListener) PullImage(cancel <-chan time.Time, image string) erro
 		rImage.Tag = docker.Latest
 	}
 	idpath := path.Join(zkregistrytags, rImage.ID())
-	regaddr := path.Join(l.address, rImage.String())
+	regaddr := path.Join(l.registryAddress(), rImage.String())
 
 	done := make(chan struct{})
 	defer func(channel *chan struct{}) { close(*channel) }(&done)
@@ -66,6 +66,39 @@ func (s *RegistryListenerSuite) TestPull_LocalImageFound(c *C) {
 	s.docker.AssertExpectations(c)
 }
 
+func (s *RegistryListenerSuite) TestPull_PoolRegistry(c *C) {
+	createPool(c, s.conn, "pool1", "pool-server:5000/pool")
+	s.listener.SetPoolID("pool1")
+	rImage := &testImage{
+		Image: &registry.Image{
+			Library: "libraryname",
+			Repo:    "reponame",
+			Tag:     "tagname",
+			UUID:    "uuidvalue",
+		},
+	}
+	_ = rImage.Create(c, s.conn)
+	rAddress := rImage.Address("pool-server:5000/pool")
+	s.docker.On("TagImage", rImage.Image.UUID, rAddress).Return(dockerclient.ErrNoSuchImage).Once()
+	s.docker.On("PullImage", rAddress).Return(nil).Once()
+	s.docker.On("TagImage", rImage.Image.UUID, rAddress).Return(nil).Once()
+	errC := make(chan error, 1)
+	go func() {
+		errC <- s.listener.PullImage(time.After(15*time.Second), rImage.Address(s.listener.address))
+	}()
+	select {
+	case <-time.After(5 * time.Second):
+		c.Fatalf("listener did not shutdown within timeout!")
+	case err := <-errC:
+		c.Assert(err, IsNil)
+	}
+	s.docker.AssertExpectations(c)
+
+	imagePath, err := s.listener.ImagePath(rImage.Address(s.listener.address))
+	c.Assert(err, IsNil)
+	c.Assert(imagePath, Equals, rAddress)
+}
+
 func (s *RegistryListenerSuite) TestPull_RemoteImageFound(c *C) {
 	rImage := &testImage{
 		Image: &registry.Image{
@@ -79,7 +79,7 @@ func GetImageUUID(conn client.Connection, tag string) (string, error) {
 		return "", err
 	}
 	rImage := &registry.Image{
-		Library: imageID.User,
+		Library: imageID.Library(),
 		Repo:    imageID.Repo,
 		Tag:     imageID.Tag,
 	}
@@ -0,0 +1,217 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dfs
+
+import (
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/commons"
+	"github.com/control-center/serviced/dfs/docker"
+	"github.com/control-center/serviced/dfs/registry"
+	registrytypes "github.com/control-center/serviced/domain/registry"
+)
+
+// RegistryGCReport describes the registry data that a garbage collection
+// removed, or would remove on a dry run.
+type RegistryGCReport struct {
+	DryRun    bool
+	Live      []string // index images referenced by a service or snapshot
+	Removed   []string // index images that nothing references
+	Manifests []string // registry manifests (repo@digest) of removed images
+	Blobs     []string // registry blobs that no manifest references
+}
+
+// SetCollector sets the client that deletes data from the docker registry.
+func (dfs *DistributedFilesystem) SetCollector(collector registry.Collector) {
+	dfs.collector = collector
+}
+
+// CollectRegistryGarbage removes every image from the registry index that is
+// not in images and was not tagged by a snapshot, deletes their manifests
+// from the docker registry and then deletes the blobs that are left
+// unreferenced.  A manifest that is shared with a live image is kept.  On a
+// dry run nothing is deleted, so the reported blobs only include those that
+// are already unreferenced.
+func (dfs *DistributedFilesystem) CollectRegistryGarbage(images []string, dryRun bool) (*RegistryGCReport, error) {
+	logger := plog.WithField("dryrun", dryRun)
+	live := make(map[string]struct{})
+	for _, image := range images {
+		imageID, err := commons.ParseImageID(image)
+		if err != nil {
+			logger.WithError(err).WithField("image", image).Debug("Could not parse image")
+			return nil, err
+		}
+		rImage := registrytypes.Image{Library: imageID.Library(), Repo: imageID.Repo, Tag: imageID.Tag}
+		if imageID.IsLatest() {
+			rImage.Tag = docker.Latest
+		}
+		live[rImage.String()] = struct{}{}
+	}
+	labels, err := dfs.snapshotLabels()
+	if err != nil {
+		return nil, err
+	}
+	rImages, err := dfs.index.ListImages()
+	if err != nil {
+		logger.WithError(err).Debug("Could not get images from the registry index")
+		return nil, err
+	}
+
+	report := &RegistryGCReport{
+		DryRun:    dryRun,
+		Live:      []string{},
+		Removed:   []string{},
+		Manifests: []string{},
+		Blobs:     []string{},
+	}
+	keep := make(map[string][]registrytypes.Image)
+	var dead []registrytypes.Image
+	for _, rImage := range rImages {
+		_, isLive := live[rImage.String()]
+		if _, ok := labels[rImage.Library][rImage.Tag]; ok {
+			isLive = true
+		}
+		repo := rImage.Library + "/" + rImage.Repo
+		if isLive {
+			keep[repo] = append(keep[repo], rImage)
+			report.Live = append(report.Live, rImage.String())
+		} else {
+			dead = append(dead, rImage)
+			report.Removed = append(report.Removed, rImage.String())
+		}
+	}
+	sort.Strings(report.Live)
+	sort.Strings(report.Removed)
+
+	// look up the manifests before the index is changed, so that a manifest
+	// that is tagged by a live image is never deleted.
+	manifests := make(map[string]string)
+	if dfs.collector != nil {
+		shared := make(map[string]struct{})
+		checked := make(map[string]struct{})
+		for _, rImage := range dead {
+			repo := rImage.Library + "/" + rImage.Repo
+			if _, ok := checked[repo]; !ok {
+				for _, keepImage := range keep[repo] {
+					digest, err := dfs.manifestDigest(repo, keepImage.Tag)
+					if err != nil {
+						return nil, err
+					} else if digest != "" {
+						shared[repo+"@"+digest] = struct{}{}
+					}
+				}
+				checked[repo] = struct{}{}
+			}
+
+			digest, err := dfs.manifestDigest(repo, rImage.Tag)
+			if err != nil {
+				return nil, err
+			} else if digest == "" {
+				continue
+			}
+			if _, ok := shared[repo+"@"+digest]; !ok {
+				manifests[repo+"@"+digest] = repo
+			}
+		}
+		for manifest := range manifests {
+			report.Manifests = append(report.Manifests, manifest)
+		}
+		sort.Strings(report.Manifests)
+	}
+	if dryRun {
+		if dfs.collector != nil {
+			if report.Blobs, err = dfs.collector.CollectBlobs(true); err != nil {
+				logger.WithError(err).Debug("Could not check the docker registry for unreferenced blobs")
+				return nil, err
+			}
+		}
+		return report, nil
+	}
+
+	for _, rImage := range dead {
+		if err := dfs.index.RemoveImage(rImage.String()); err != nil {
+			logger.WithError(err).WithField("image", rImage.String()).Debug("Could not remove image from the registry index")
+			return nil, err
+		}
+	}
+	if dfs.collector == nil {
+		logger.WithField("removed", len(dead)).Warn("No docker registry collector set; removed images from the index only")
+		return report, nil
+	}
+	for _, manifest := range report.Manifests {
+		repo := manifests[manifest]
+		digest := strings.TrimPrefix(manifest, repo+"@")
+		if err := dfs.collector.DeleteManifest(repo, digest); err != nil && err != registry.ErrManifestNotFound {
+			logger.WithError(err).WithField("manifest", manifest).Debug("Could not delete manifest from the docker registry")
+			return nil, err
+		}
+	}
+	if report.Blobs, err = dfs.collector.CollectBlobs(false); err != nil {
+		logger.WithError(err).Debug("Could not collect unreferenced blobs from the docker registry")
+		return nil, err
+	}
+	logger.WithFields(log.Fields{
+		"images":    len(report.Removed),
+		"manifests": len(report.Manifests),
+		"blobs":     len(report.Blobs),
+	}).Info("Collected docker registry garbage")
+	return report, nil
+}
+
+// manifestDigest returns the digest of an image's manifest, or an empty
+// string if the registry does not have the image.
+func (dfs *DistributedFilesystem) manifestDigest(repo, tag string) (string, error) {
+	digest, err := dfs.collector.ManifestDigest(repo, tag)
+	if err == registry.ErrManifestNotFound {
+		return "", nil
+	} else if err != nil {
+		plog.WithError(err).WithFields(log.Fields{
+			"repo": repo,
+			"tag":  tag,
+		}).Debug("Could not look up manifest in the docker registry")
+		return "", err
+	}
+	return digest, nil
+}
+
+// snapshotLabels returns the labels of every snapshot, keyed by tenant.
+// Snapshots tag their images in the registry index with the tenant as the
+// library and the label as the tag.
+func (dfs *DistributedFilesystem) snapshotLabels() (map[string]map[string]struct{}, error) {
+	labels := make(map[string]map[string]struct{})
+	for _, tenantID := range dfs.disk.List() {
+		vol, err := dfs.disk.Get(tenantID)
+		if err != nil {
+			plog.WithError(err).WithField("tenantid", tenantID).Debug("Could not get volume for tenant")
+			return nil, err
+		}
+		snapshots, err := vol.Snapshots()
+		if err != nil {
+			plog.WithError(err).WithField("tenantid", tenantID).Debug("Could not get snapshots for tenant")
+			return nil, err
+		}
+		labels[tenantID] = make(map[string]struct{})
+		for _, snapshotID := range snapshots {
+			info, err := vol.SnapshotInfo(snapshotID)
+			if err != nil {
+				plog.WithError(err).WithField("snapshotid", snapshotID).Debug("Could not get info for snapshot")
+				return nil, err
+			}
+			labels[tenantID][info.Label] = struct{}{}
+		}
+	}
+	return labels, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package dfs_test
+
+import (
+	"time"
+
+	"github.com/control-center/serviced/dfs/registry"
+	registrymocks "github.com/control-center/serviced/dfs/registry/mocks"
+	registrytypes "github.com/control-center/serviced/domain/registry"
+	"github.com/control-center/serviced/volume"
+	volumemocks "github.com/control-center/serviced/volume/mocks"
+	. "gopkg.in/check.v1"
+)
+
+func (s *DFSTestSuite) setUpRegistryGC(c *C) *registrymocks.Collector {
+	vol := &volumemocks.Volume{}
+	s.disk.On("List").Return([]string{"tenant"})
+	s.disk.On("Get", "tenant").Return(vol, nil)
+	vol.On("Snapshots").Return([]string{"tenant_snap"}, nil)
+	vol.On("SnapshotInfo", "tenant_snap").Return(&volume.SnapshotInfo{
+		Name:     "tenant_snap",
+		TenantID: "tenant",
+		Label:    "snap",
+		Created:  time.Now().UTC(),
+	}, nil)
+	s.index.On("ListImages").Return([]registrytypes.Image{
+		{Library: "tenant", Repo: "repo", Tag: "latest"},
+		{Library: "tenant", Repo: "repo", Tag: "snap"},
+		{Library: "tenant", Repo: "repo", Tag: "old"},
+		{Library: "tenant", Repo: "repo", Tag: "retagged"},
+		{Library: "tenant", Repo: "other", Tag: "old"},
+		{Library: "gone", Repo: "repo", Tag: "latest"},
+	}, nil)
+	collector := &registrymocks.Collector{}
+	collector.On("ManifestDigest", "tenant/repo", "latest").Return("sha256:live", nil)
+	collector.On("ManifestDigest", "tenant/repo", "snap").Return("sha256:snap", nil)
+	collector.On("ManifestDigest", "tenant/repo", "old").Return("sha256:old", nil)
+	collector.On("ManifestDigest", "tenant/repo", "retagged").Return("sha256:live", nil)
+	collector.On("ManifestDigest", "tenant/other", "old").Return("", registry.ErrManifestNotFound)
+	collector.On("ManifestDigest", "gone/repo", "latest").Return("sha256:gone", nil)
+	s.dfs.SetCollector(collector)
+	return collector
+}
+
+func (s *DFSTestSuite) TestCollectRegistryGarbage_DryRun(c *C) {
+	collector := s.setUpRegistryGC(c)
+	collector.On("CollectBlobs", true).Return([]string{"sha256:blob"}, nil)
+	report, err := s.dfs.CollectRegistryGarbage([]string{"localhost:5000/tenant/repo"}, true)
+	c.Assert(err, IsNil)
+	c.Assert(report.DryRun, Equals, true)
+	c.Assert(report.Live, DeepEquals, []string{"tenant/repo:latest", "tenant/repo:snap"})
+	c.Assert(report.Removed, DeepEquals, []string{"gone/repo:latest", "tenant/other:old", "tenant/repo:old", "tenant/repo:retagged"})
+	c.Assert(report.Manifests, DeepEquals, []string{"gone/repo@sha256:gone", "tenant/repo@sha256:old"})
+	c.Assert(report.Blobs, DeepEquals, []string{"sha256:blob"})
+	s.index.AssertNotCalled(c, "RemoveImage", "tenant/repo:old")
+	collector.AssertNotCalled(c, "DeleteManifest", "tenant/repo", "sha256:old")
+}
+
+func (s *DFSTestSuite) TestCollectRegistryGarbage(c *C) {
+	collector := s.setUpRegistryGC(c)
+	for _, image := range []string{"gone/repo:latest", "tenant/other:old", "tenant/repo:old", "tenant/repo:retagged"} {
+		s.index.On("RemoveImage", image).Return(nil).Once()
+	}
+	collector.On("DeleteManifest", "gone/repo", "sha256:gone").Return(nil).Once()
+	collector.On("DeleteManifest", "tenant/repo", "sha256:old").Return(registry.ErrManifestNotFound).Once()
+	collector.On("CollectBlobs", false).Return([]string{"sha256:blob"}, nil).Once()
+	report, err := s.dfs.CollectRegistryGarbage([]string{"localhost:5000/tenant/repo:latest"}, false)
+	c.Assert(err, IsNil)
+	c.Assert(report.DryRun, Equals, false)
+	c.Assert(report.Manifests, DeepEquals, []string{"gone/repo@sha256:gone", "tenant/repo@sha256:old"})
+	c.Assert(report.Blobs, DeepEquals, []string{"sha256:blob"})
+	s.index.AssertExpectations(c)
+	collector.AssertExpectations(c)
+}
+
+func (s *DFSTestSuite) TestCollectRegistryGarbage_RemoveFailed(c *C) {
+	collector := s.setUpRegistryGC(c)
+	s.index.On("RemoveImage", "tenant/repo:old").Return(ErrTestImageNotRemoved)
+	_, err := s.dfs.CollectRegistryGarbage([]string{"localhost:5000/tenant/repo"}, false)
+	c.Assert(err, Equals, ErrTestImageNotRemoved)
+	collector.AssertNotCalled(c, "CollectBlobs", false)
+}
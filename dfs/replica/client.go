@@ -0,0 +1,152 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replica
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/control-center/serviced/dfs"
+)
+
+// Standby is the standby master as seen by the primary master
+type Standby interface {
+	// Address returns the address of the standby
+	Address() string
+	// Status returns the snapshots that the standby has received
+	Status() (*dfs.ReplicaStatus, error)
+	// MissingImages returns the image ids that the standby does not have
+	MissingImages(ids []string) ([]string, error)
+	// SendImages sends the output of docker save, written by save
+	SendImages(save func(io.Writer) error) error
+	// SendSnapshot sends a snapshot of a tenant, written by send
+	SendSnapshot(tenantID, snapshotID, format string, send func(io.Writer) error) error
+	// SendInfo sends the templates, pools and snapshots of a replication
+	SendInfo(info dfs.BackupInfo) error
+}
+
+// Client sends replicas to the server of a standby master
+type Client struct {
+	address string
+	key     string
+	client  *http.Client
+}
+
+// NewClient returns a client for the standby master at address
+func NewClient(address, key string, tlsConfig *tls.Config) *Client {
+	return &Client{
+		address: address,
+		key:     key,
+		client:  &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+	}
+}
+
+// Address implements Standby
+func (c *Client) Address() string {
+	return c.address
+}
+
+// Status implements Standby
+func (c *Client) Status() (*dfs.ReplicaStatus, error) {
+	var status dfs.ReplicaStatus
+	if err := c.do("GET", "/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// MissingImages implements Standby
+func (c *Client) MissingImages(ids []string) ([]string, error) {
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	if err := c.do("POST", "/images/missing", bytes.NewReader(data), &missing); err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+// SendImages implements Standby
+func (c *Client) SendImages(save func(io.Writer) error) error {
+	return c.stream("/images", save)
+}
+
+// SendSnapshot implements Standby
+func (c *Client) SendSnapshot(tenantID, snapshotID, format string, send func(io.Writer) error) error {
+	query := url.Values{}
+	query.Set("tenant", tenantID)
+	query.Set("format", format)
+	return c.stream("/snapshots/"+snapshotID+"?"+query.Encode(), send)
+}
+
+// SendInfo implements Standby
+func (c *Client) SendInfo(info dfs.BackupInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return c.do("PUT", "/info", bytes.NewReader(data), nil)
+}
+
+// stream sends the output of write as the body of the request, without
+// holding it in memory.
+func (c *Client) stream(path string, write func(io.Writer) error) error {
+	r, w := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		err := write(w)
+		w.CloseWithError(err)
+		written <- err
+	}()
+	err := c.do("PUT", path, r, nil)
+	// stop the writer if the request ended before reading the whole body
+	r.CloseWithError(io.ErrClosedPipe)
+	if writeErr := <-written; writeErr != nil && writeErr != io.ErrClosedPipe {
+		return writeErr
+	}
+	return err
+}
+
+func (c *Client) do(method, path string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, "https://"+c.address+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(KeyHeader, c.key)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusConflict {
+			return ErrPromoted
+		}
+		return fmt.Errorf("standby %s returned %s: %s", c.address, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package replica
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/control-center/serviced/datastore"
+	"github.com/control-center/serviced/dfs"
+	"github.com/control-center/serviced/volume"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type received struct {
+	tenantID   string
+	snapshotID string
+	format     string
+	data       string
+}
+
+// testReceiver records the replicas sent to the server
+type testReceiver struct {
+	promoted  bool
+	images    []string
+	snapshots []received
+	info      *dfs.BackupInfo
+}
+
+func (r *testReceiver) ReplicaStatus(ctx datastore.Context) (*dfs.ReplicaStatus, error) {
+	status := &dfs.ReplicaStatus{
+		DriverType: volume.DriverTypeBtrFS,
+		Snapshots:  make(map[string][]string),
+	}
+	for _, s := range r.snapshots {
+		status.Snapshots[s.tenantID] = append(status.Snapshots[s.tenantID], s.snapshotID)
+	}
+	return status, nil
+}
+
+func (r *testReceiver) MissingReplicaImages(ctx datastore.Context, ids []string) ([]string, error) {
+	var missing []string
+	for _, id := range ids {
+		if id != "present" {
+			missing = append(missing, id)
+		}
+	}
+	return missing, nil
+}
+
+func (r *testReceiver) ReceiveReplicaImages(ctx datastore.Context, reader io.Reader) error {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	r.images = append(r.images, string(data))
+	return nil
+}
+
+func (r *testReceiver) ReceiveReplica(ctx datastore.Context, tenantID, snapshotID, format string, reader io.Reader) error {
+	if r.promoted {
+		return ErrPromoted
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	r.snapshots = append(r.snapshots, received{tenantID, snapshotID, format, string(data)})
+	return nil
+}
+
+func (r *testReceiver) UpdateReplicaInfo(ctx datastore.Context, info dfs.BackupInfo) error {
+	r.info = &info
+	return nil
+}
+
+type ReplicaSuite struct {
+	receiver *testReceiver
+	server   *httptest.Server
+	client   *Client
+}
+
+var _ = Suite(&ReplicaSuite{})
+
+func (s *ReplicaSuite) SetUpTest(c *C) {
+	s.receiver = &testReceiver{}
+	s.server = httptest.NewTLSServer(NewServer(s.receiver, "secret"))
+	s.client = s.newClient("secret")
+}
+
+func (s *ReplicaSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *ReplicaSuite) newClient(key string) *Client {
+	address := strings.TrimPrefix(s.server.URL, "https://")
+	return NewClient(address, key, &tls.Config{InsecureSkipVerify: true})
+}
+
+func (s *ReplicaSuite) TestInvalidKey(c *C) {
+	_, err := s.newClient("wrong").Status()
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Matches, ".*401 Unauthorized.*")
+}
+
+func (s *ReplicaSuite) TestStatus(c *C) {
+	s.receiver.snapshots = []received{{tenantID: "tenant", snapshotID: "tenant_1"}}
+	status, err := s.client.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.DriverType, Equals, volume.DriverTypeBtrFS)
+	c.Assert(status.Snapshots, DeepEquals, map[string][]string{"tenant": {"tenant_1"}})
+}
+
+func (s *ReplicaSuite) TestImages(c *C) {
+	missing, err := s.client.MissingImages([]string{"present", "missing"})
+	c.Assert(err, IsNil)
+	c.Assert(missing, DeepEquals, []string{"missing"})
+
+	err = s.client.SendImages(func(w io.Writer) error {
+		_, err := io.WriteString(w, "images")
+		return err
+	})
+	c.Assert(err, IsNil)
+	c.Assert(s.receiver.images, DeepEquals, []string{"images"})
+}
+
+func (s *ReplicaSuite) TestSendSnapshot(c *C) {
+	err := s.client.SendSnapshot("tenant", "tenant_2", dfs.ReplicaDelta, func(w io.Writer) error {
+		_, err := io.WriteString(w, "delta")
+		return err
+	})
+	c.Assert(err, IsNil)
+	c.Assert(s.receiver.snapshots, DeepEquals, []received{{"tenant", "tenant_2", dfs.ReplicaDelta, "delta"}})
+}
+
+func (s *ReplicaSuite) TestSendSnapshot_WriteFailed(c *C) {
+	expected := errors.New("write failed")
+	err := s.client.SendSnapshot("tenant", "tenant_2", dfs.ReplicaFull, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return expected
+	})
+	c.Assert(err, Equals, expected)
+}
+
+func (s *ReplicaSuite) TestSendSnapshot_Promoted(c *C) {
+	s.receiver.promoted = true
+	err := s.client.SendSnapshot("tenant", "tenant_2", dfs.ReplicaFull, func(w io.Writer) error {
+		_, err := io.WriteString(w, "full")
+		return err
+	})
+	c.Assert(err, Equals, ErrPromoted)
+}
+
+func (s *ReplicaSuite) TestSendInfo(c *C) {
+	err := s.client.SendInfo(dfs.BackupInfo{Snapshots: []string{"tenant_2"}, BackupVersion: 1})
+	c.Assert(err, IsNil)
+	c.Assert(s.receiver.info, NotNil)
+	c.Assert(s.receiver.info.Snapshots, DeepEquals, []string{"tenant_2"})
+}
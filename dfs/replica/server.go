@@ -0,0 +1,136 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replica
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/datastore"
+	"github.com/control-center/serviced/dfs"
+	"github.com/control-center/serviced/logging"
+)
+
+// instantiate the package logger
+var plog = logging.PackageLogger()
+
+// KeyHeader is the http header that holds the key shared by both masters
+const KeyHeader = "X-Serviced-Replica-Key"
+
+var (
+	// ErrPromoted is returned when a standby that has already been promoted
+	// is sent a replica.
+	ErrPromoted = errors.New("standby master has been promoted")
+	// ErrNoReplica is returned when a standby has not received a replica
+	ErrNoReplica = errors.New("no replica has been received")
+)
+
+// Receiver stores the snapshots and metadata sent by the primary master.  It
+// is implemented by the facade of the standby master.
+type Receiver interface {
+	// ReplicaStatus returns the snapshots that have been received
+	ReplicaStatus(ctx datastore.Context) (*dfs.ReplicaStatus, error)
+	// MissingReplicaImages returns the image ids that are not on the standby
+	MissingReplicaImages(ctx datastore.Context, ids []string) ([]string, error)
+	// ReceiveReplicaImages loads the output of docker save
+	ReceiveReplicaImages(ctx datastore.Context, r io.Reader) error
+	// ReceiveReplica loads a snapshot written by dfs.SendReplica
+	ReceiveReplica(ctx datastore.Context, tenantID, snapshotID, format string, r io.Reader) error
+	// UpdateReplicaInfo saves the templates, pools and snapshots of the last
+	// replication.
+	UpdateReplicaInfo(ctx datastore.Context, info dfs.BackupInfo) error
+}
+
+// Server is the http handler of the standby master that receives replicas
+type Server struct {
+	receiver Receiver
+	key      string
+}
+
+// NewServer returns a handler that only accepts requests with the given key
+func NewServer(receiver Receiver, key string) *Server {
+	return &Server{receiver: receiver, key: key}
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(KeyHeader)), []byte(s.key)) != 1 {
+		plog.WithField("remoteaddr", r.RemoteAddr).Warn("Rejected replica request with an invalid key")
+		http.Error(w, "invalid replica key", http.StatusUnauthorized)
+		return
+	}
+	ctx := datastore.Get()
+	var err error
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/status":
+		err = s.status(ctx, w, r)
+	case r.Method == "POST" && r.URL.Path == "/images/missing":
+		err = s.missingImages(ctx, w, r)
+	case r.Method == "PUT" && r.URL.Path == "/images":
+		err = s.receiver.ReceiveReplicaImages(ctx, r.Body)
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/snapshots/"):
+		query := r.URL.Query()
+		snapshotID := strings.TrimPrefix(r.URL.Path, "/snapshots/")
+		err = s.receiver.ReceiveReplica(ctx, query.Get("tenant"), snapshotID, query.Get("format"), r.Body)
+	case r.Method == "PUT" && r.URL.Path == "/info":
+		err = s.info(ctx, w, r)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		plog.WithError(err).WithFields(log.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Could not handle replica request")
+		code := http.StatusInternalServerError
+		if err == ErrPromoted {
+			code = http.StatusConflict
+		}
+		http.Error(w, err.Error(), code)
+	}
+}
+
+func (s *Server) status(ctx datastore.Context, w http.ResponseWriter, r *http.Request) error {
+	status, err := s.receiver.ReplicaStatus(ctx)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(status)
+}
+
+func (s *Server) missingImages(ctx datastore.Context, w http.ResponseWriter, r *http.Request) error {
+	var ids []string
+	if err := json.NewDecoder(r.Body).Decode(&ids); err != nil {
+		return err
+	}
+	missing, err := s.receiver.MissingReplicaImages(ctx, ids)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(missing)
+}
+
+func (s *Server) info(ctx datastore.Context, w http.ResponseWriter, r *http.Request) error {
+	var info dfs.BackupInfo
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		return err
+	}
+	return s.receiver.UpdateReplicaInfo(ctx, info)
+}
@@ -0,0 +1,234 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dfs
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/commons/docker"
+	"github.com/control-center/serviced/volume"
+)
+
+// ErrInvalidReplicaFormat is returned when a snapshot cannot be sent or
+// received in the requested format.
+var ErrInvalidReplicaFormat = errors.New("invalid replica format")
+
+// Formats of the snapshots sent to a standby master
+const (
+	// ReplicaFull is the export of the snapshot
+	ReplicaFull = "full"
+	// ReplicaDelta has the files that changed since the parent snapshot
+	ReplicaDelta = "delta"
+	// ReplicaNative is the driver's own delta from the parent snapshot
+	ReplicaNative = "native"
+)
+
+// ReplicaStatus describes the snapshots that have been replicated to a host
+type ReplicaStatus struct {
+	DriverType volume.DriverType
+	Snapshots  map[string][]string // snapshot ids by tenant
+}
+
+// ReplicaImage is a docker image that a replicated snapshot needs
+type ReplicaImage struct {
+	Name string
+	ID   string
+}
+
+// ReplicaStatus returns the snapshots of every tenant on this host
+func (dfs *DistributedFilesystem) ReplicaStatus() (*ReplicaStatus, error) {
+	status := &ReplicaStatus{
+		DriverType: dfs.disk.DriverType(),
+		Snapshots:  make(map[string][]string),
+	}
+	for _, tenantID := range dfs.disk.List() {
+		snapshots, err := dfs.List(tenantID)
+		if err != nil {
+			return nil, err
+		}
+		status.Snapshots[tenantID] = snapshots
+	}
+	return status, nil
+}
+
+// ReplicaFormat returns the best format to send a snapshot to a standby with
+// the given driver, which has already received the parent snapshot.  The
+// native format is used between masters with the same driver when the driver
+// implements volume.DeltaVolume, as btrfs and devicemapper do.
+func (dfs *DistributedFilesystem) ReplicaFormat(snapshotID, parentID string, standby volume.DriverType) (string, error) {
+	vol, err := dfs.disk.GetTenant(snapshotID)
+	if err != nil {
+		plog.WithError(err).WithField("snapshotid", snapshotID).Debug("Could not get volume for snapshot")
+		return "", err
+	}
+	if _, ok := vol.(volume.DeltaVolume); ok && standby == dfs.disk.DriverType() {
+		return ReplicaNative, nil
+	} else if parentID != "" {
+		return ReplicaDelta, nil
+	}
+	return ReplicaFull, nil
+}
+
+// SendReplica writes a snapshot for a standby master in the given format.
+// parentID is the last snapshot that the standby received, if any.
+func (dfs *DistributedFilesystem) SendReplica(snapshotID, parentID, format string, w io.Writer) error {
+	logger := plog.WithFields(log.Fields{
+		"snapshotid": snapshotID,
+		"parentid":   parentID,
+		"format":     format,
+	})
+	vol, info, err := dfs.getSnapshotVolumeAndInfo(snapshotID)
+	if err != nil {
+		return err
+	}
+	var parent string
+	if parentID != "" {
+		parentInfo, err := vol.SnapshotInfo(parentID)
+		if err != nil {
+			logger.WithError(err).Debug("Could not get info for parent snapshot")
+			return err
+		}
+		parent = parentInfo.Label
+	}
+	switch format {
+	case ReplicaNative:
+		dvol, ok := vol.(volume.DeltaVolume)
+		if !ok {
+			return ErrInvalidReplicaFormat
+		}
+		err = dvol.ExportDelta(info.Label, parent, w)
+	case ReplicaDelta:
+		if parent == "" {
+			return ErrInvalidReplicaFormat
+		}
+		err = volume.ExportSnapshotDelta(vol, info.Label, parent, w)
+	case ReplicaFull:
+		err = vol.Export(info.Label, "", w, []string{})
+	default:
+		return ErrInvalidReplicaFormat
+	}
+	if err != nil {
+		logger.WithError(err).Debug("Could not send snapshot to standby")
+		return err
+	}
+	logger.Info("Sent snapshot to standby")
+	return nil
+}
+
+// ReceiveReplica loads a snapshot of a tenant that was sent by SendReplica,
+// and adds its images, which must already be loaded, to the registry.
+func (dfs *DistributedFilesystem) ReceiveReplica(tenantID, snapshotID, format string, r io.Reader) error {
+	logger := plog.WithFields(log.Fields{
+		"tenantid":   tenantID,
+		"snapshotid": snapshotID,
+		"format":     format,
+	})
+	vol, err := dfs.disk.Create(tenantID)
+	if err == volume.ErrVolumeExists {
+		if vol, err = dfs.disk.Get(tenantID); err != nil {
+			logger.WithError(err).Debug("Could not get volume for tenant")
+			return err
+		}
+	} else if err != nil {
+		logger.WithError(err).Debug("Could not create volume for tenant")
+		return err
+	}
+	switch format {
+	case ReplicaNative:
+		dvol, ok := vol.(volume.DeltaVolume)
+		if !ok {
+			return ErrInvalidReplicaFormat
+		}
+		err = dvol.ImportDelta(snapshotID, r)
+	case ReplicaDelta:
+		err = volume.ImportSnapshotDelta(vol, snapshotID, r)
+	case ReplicaFull:
+		err = vol.Import(snapshotID, r)
+	default:
+		return ErrInvalidReplicaFormat
+	}
+	if err != nil {
+		logger.WithError(err).Debug("Could not receive snapshot")
+		return err
+	}
+	info, err := vol.SnapshotInfo(snapshotID)
+	if err != nil {
+		logger.WithError(err).Debug("Could not get info for received snapshot")
+		return err
+	}
+	if err := dfs.loadSnapshotImages(tenantID, info.Label, nil); err != nil {
+		return err
+	}
+	logger.Info("Received snapshot from primary")
+	return nil
+}
+
+// ReplicaImages pulls the images of a snapshot from the registry and returns
+// their names and ids.
+func (dfs *DistributedFilesystem) ReplicaImages(snapshotID string) ([]ReplicaImage, error) {
+	info, err := dfs.Info(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	images := make([]ReplicaImage, 0, len(info.Images))
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for _, img := range info.Images {
+		imageLogger := plog.WithField("image", img)
+		timer.Reset(dfs.timeout)
+		if err := dfs.reg.PullImage(timer.C, img); err != nil {
+			imageLogger.WithError(err).Debug("Could not pull image from registry")
+			return nil, err
+		}
+		name, err := dfs.reg.ImagePath(img)
+		if err != nil {
+			imageLogger.WithError(err).Debug("Could not get the image path from registry")
+			return nil, err
+		}
+		image, err := dfs.docker.FindImage(name)
+		if err != nil {
+			imageLogger.WithError(err).Debug("Could not find image")
+			return nil, err
+		}
+		images = append(images, ReplicaImage{Name: name, ID: image.ID})
+	}
+	return images, nil
+}
+
+// MissingImages returns the ids of the images that are not on this host
+func (dfs *DistributedFilesystem) MissingImages(ids []string) ([]string, error) {
+	missing := []string{}
+	for _, id := range ids {
+		if _, err := dfs.docker.FindImage(id); docker.IsImageNotFound(err) {
+			missing = append(missing, id)
+		} else if err != nil {
+			plog.WithError(err).WithField("imageid", id).Debug("Could not look up image")
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// SaveImages writes docker images to a stream
+func (dfs *DistributedFilesystem) SaveImages(images []string, w io.Writer) error {
+	return dfs.docker.SaveImages(images, w)
+}
+
+// LoadImages loads docker images from a stream written by SaveImages
+func (dfs *DistributedFilesystem) LoadImages(r io.Reader) error {
+	return dfs.docker.LoadImage(r)
+}
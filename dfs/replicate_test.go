@@ -0,0 +1,102 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package dfs_test
+
+import (
+	"bytes"
+	"errors"
+
+	. "github.com/control-center/serviced/dfs"
+	"github.com/control-center/serviced/volume"
+	volumemocks "github.com/control-center/serviced/volume/mocks"
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/mock"
+	. "gopkg.in/check.v1"
+)
+
+func (s *DFSTestSuite) TestReplicaStatus(c *C) {
+	s.disk.On("List").Return([]string{"BASE"})
+	vol := &volumemocks.Volume{}
+	s.disk.On("Get", "BASE").Return(vol, nil)
+	vol.On("Snapshots").Return([]string{"BASE_LABEL1", "BASE_LABEL2"}, nil)
+	status, err := s.dfs.ReplicaStatus()
+	c.Assert(err, IsNil)
+	c.Check(status, DeepEquals, &ReplicaStatus{
+		DriverType: s.disk.DriverType(),
+		Snapshots:  map[string][]string{"BASE": {"BASE_LABEL1", "BASE_LABEL2"}},
+	})
+}
+
+func (s *DFSTestSuite) TestReplicaFormat(c *C) {
+	s.getVolumeFromSnapshot("BASE_LABEL2", "BASE")
+	format, err := s.dfs.ReplicaFormat("BASE_LABEL2", "BASE_LABEL1", s.disk.DriverType())
+	c.Assert(err, IsNil)
+	c.Check(format, Equals, ReplicaDelta)
+	format, err = s.dfs.ReplicaFormat("BASE_LABEL2", "", s.disk.DriverType())
+	c.Assert(err, IsNil)
+	c.Check(format, Equals, ReplicaFull)
+}
+
+func (s *DFSTestSuite) TestSendReplica_Delta(c *C) {
+	vol := s.getVolumeFromSnapshot("BASE_LABEL2", "BASE")
+	vol.On("SnapshotInfo", "BASE_LABEL1").Return(&volume.SnapshotInfo{Name: "BASE_LABEL1", TenantID: "BASE", Label: "LABEL1"}, nil)
+	vol.On("SnapshotInfo", "BASE_LABEL2").Return(&volume.SnapshotInfo{Name: "BASE_LABEL2", TenantID: "BASE", Label: "LABEL2"}, nil)
+	vol.On("Export", "LABEL1", "", mock.Anything).Return(exportFile("BASE_LABEL1", "a.conf", "data"))
+	vol.On("Export", "LABEL2", "", mock.Anything).Return(exportFile("BASE_LABEL2", "a.conf", "changed"))
+	buf := &bytes.Buffer{}
+	err := s.dfs.SendReplica("BASE_LABEL2", "BASE_LABEL1", ReplicaDelta, buf)
+	c.Assert(err, IsNil)
+	c.Check(bytes.Contains(buf.Bytes(), []byte("changed")), Equals, true)
+
+	err = s.dfs.SendReplica("BASE_LABEL2", "", ReplicaDelta, buf)
+	c.Assert(err, Equals, ErrInvalidReplicaFormat)
+	err = s.dfs.SendReplica("BASE_LABEL2", "", ReplicaNative, buf)
+	c.Assert(err, Equals, ErrInvalidReplicaFormat)
+}
+
+func (s *DFSTestSuite) TestReceiveReplica_Full(c *C) {
+	vol := &volumemocks.Volume{}
+	s.disk.On("Create", "BASE").Return(&volumemocks.Volume{}, volume.ErrVolumeExists)
+	s.disk.On("Get", "BASE").Return(vol, nil)
+	r := &bytes.Buffer{}
+	vol.On("Import", "BASE_LABEL", r).Return(nil)
+	vol.On("SnapshotInfo", "BASE_LABEL").Return(&volume.SnapshotInfo{Name: "BASE_LABEL", TenantID: "BASE", Label: "LABEL"}, nil)
+	vol.On("ReadMetadata", "LABEL", ImagesMetadataFile).Return(&NopCloser{bytes.NewBufferString("[]")}, nil)
+	err := s.dfs.ReceiveReplica("BASE", "BASE_LABEL", ReplicaFull, r)
+	c.Assert(err, IsNil)
+	vol.AssertExpectations(c)
+}
+
+func (s *DFSTestSuite) TestReceiveReplica_ImportFailed(c *C) {
+	vol := &volumemocks.Volume{}
+	s.disk.On("Create", "BASE").Return(vol, nil)
+	r := &bytes.Buffer{}
+	vol.On("Import", "BASE_LABEL", r).Return(volume.ErrSnapshotExists)
+	err := s.dfs.ReceiveReplica("BASE", "BASE_LABEL", ReplicaFull, r)
+	c.Assert(err, Equals, volume.ErrSnapshotExists)
+}
+
+func (s *DFSTestSuite) TestMissingImages(c *C) {
+	s.docker.On("FindImage", "id1").Return(&dockerclient.Image{ID: "id1"}, nil)
+	s.docker.On("FindImage", "id2").Return(nil, dockerclient.ErrNoSuchImage)
+	missing, err := s.dfs.MissingImages([]string{"id1", "id2"})
+	c.Assert(err, IsNil)
+	c.Check(missing, DeepEquals, []string{"id2"})
+
+	s.docker.On("FindImage", "id3").Return(nil, errors.New("docker is down"))
+	_, err = s.dfs.MissingImages([]string{"id3"})
+	c.Assert(err, NotNil)
+}
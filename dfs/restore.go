@@ -31,19 +31,29 @@ var (
 
 // Restore restores application data from a backup.
 func (dfs *DistributedFilesystem) Restore(r io.Reader, version int) error {
+	return dfs.RestoreWithProgress(r, version, nil)
+}
+
+// RestoreWithProgress restores application data from a backup, and reports
+// the progress of the images, volume and registry phases to the job.  Phases
+// that the job has already completed are skipped.
+func (dfs *DistributedFilesystem) RestoreWithProgress(r io.Reader, version int, job *RestoreJob) error {
+	if job == nil {
+		job = NewRestoreJob(RestoreStatus{})
+	}
 	plog.WithField("version", version).Info("Detected backup version")
 	switch version {
 	case 0:
-		return dfs.restoreV0(r)
+		return dfs.restoreV0(r, job)
 	case 1:
-		return dfs.restoreV1(r)
+		return dfs.restoreV1(r, job)
 	default:
 		return ErrInvalidBackupVersion
 	}
 }
 
 // restoreV0 restores a pre-1.1.3 backup
-func (dfs *DistributedFilesystem) restoreV0(r io.Reader) error {
+func (dfs *DistributedFilesystem) restoreV0(r io.Reader, job *RestoreJob) error {
 	backuptar := tar.NewReader(r)
 
 	// keep track of the snapshots that have been imported
@@ -97,7 +107,7 @@ func (dfs *DistributedFilesystem) restoreV0(r io.Reader) error {
 	// for each snapshot restored, add all the images to the registry
 	for tenant, labels := range snapshots {
 		for _, label := range labels {
-			if err := dfs.loadSnapshotImages(tenant, label); err != nil {
+			if err := dfs.loadSnapshotImages(tenant, label, job); err != nil {
 				return err
 			}
 		}
@@ -111,7 +121,7 @@ func (dfs *DistributedFilesystem) restoreV0(r io.Reader) error {
 // stream into multiple other streams: One for Docker images, which used to be
 // and independent tar file within the tar stream (but is now included inline),
 // and one for each DFS snapshot being restored.
-func (dfs *DistributedFilesystem) restoreV1(r io.Reader) error {
+func (dfs *DistributedFilesystem) restoreV1(r io.Reader, job *RestoreJob) error {
 	backuptar := tar.NewReader(r)
 
 	// Keep track of all the data pipes
@@ -120,8 +130,14 @@ func (dfs *DistributedFilesystem) restoreV1(r io.Reader) error {
 		tarwriter *tar.Writer
 		writer    *io.PipeWriter
 		errc      <-chan error
+		phase     string
 	}
 	streamMap := make(map[string]*stream)
+
+	// Keep track of the snapshots in the order they are found, so that their
+	// images can be added to the registry after the volumes are loaded.
+	var snapshots [][2]string
+	seen := make(map[string]struct{})
 	defer func() {
 		// close all the data pipes and make sure that all subroutines exit.
 		if dataError == nil || dataError == io.EOF {
@@ -133,11 +149,17 @@ func (dfs *DistributedFilesystem) restoreV1(r io.Reader) error {
 			// pipeWriter.
 			s.writer.CloseWithError(dataError)
 			<-s.errc
+			job.Finish(s.phase, dataError)
 		}
 	}()
 
 	// Distribute the tar contents into the correct reader pipes
 	for {
+		if err := job.Err(); err != nil {
+			plog.Info("Restore was cancelled")
+			dataError = err
+			return err
+		}
 		hdr, err := backuptar.Next()
 		if err == io.EOF {
 			break
@@ -162,13 +184,22 @@ func (dfs *DistributedFilesystem) restoreV1(r io.Reader) error {
 				continue
 			}
 			tenant, label := parts[1], parts[2]
+			id := path.Join(SnapshotsMetadataDir, tenant, label)
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				snapshots = append(snapshots, [2]string{tenant, label})
+			}
+			phase := RestoreVolumePhase(tenant + "_" + label)
+			if job.IsDone(phase) {
+				// loaded by an earlier run of the restore
+				continue
+			}
 
 			tenantLogger := plog.WithFields(log.Fields{
 				"label":  label,
 				"tenant": tenant,
 			})
 
-			id := path.Join(SnapshotsMetadataDir, tenant, label)
 			// Find or create the pipe that's got a restoreSnapshot for this
 			// volume reading from the other end
 			s, ok := streamMap[id]
@@ -177,8 +208,9 @@ func (dfs *DistributedFilesystem) restoreV1(r io.Reader) error {
 
 				writer, errc := dfs.snapshotLoadPipe(tenant, label)
 				tarwriter := tar.NewWriter(writer)
-				s = &stream{tarwriter: tarwriter, writer: writer, errc: errc}
+				s = &stream{tarwriter: tarwriter, writer: writer, errc: errc, phase: phase}
 				streamMap[id] = s
+				job.Start(phase, 0, "bytes")
 			}
 
 			hdr.Name = parts[3]
@@ -192,7 +224,9 @@ func (dfs *DistributedFilesystem) restoreV1(r io.Reader) error {
 				return err
 			}
 
-			if _, err := io.Copy(s.tarwriter, backuptar); err != nil {
+			n, err := io.Copy(s.tarwriter, backuptar)
+			job.Add(phase, n)
+			if err != nil {
 				tenantLogger.WithError(err).WithField("header", hdr.Name).
 					Error("Could not write snapshot for tenant with header")
 				dataError = err
@@ -206,14 +240,20 @@ func (dfs *DistributedFilesystem) restoreV1(r io.Reader) error {
 				continue
 			}
 
+			if job.IsDone(RestorePhaseImages) {
+				// loaded by an earlier run of the restore
+				continue
+			}
+
 			id := parts[0]
 			s, ok := streamMap[id]
 			if !ok {
 				plog.Info("Loading docker images from backup")
 				writer, errc := dfs.imageLoadPipe()
 				tarwriter := tar.NewWriter(writer)
-				s = &stream{tarwriter: tarwriter, writer: writer, errc: errc}
+				s = &stream{tarwriter: tarwriter, writer: writer, errc: errc, phase: RestorePhaseImages}
 				streamMap[DockerImagesFile] = s
+				job.Start(RestorePhaseImages, 0, "bytes")
 			}
 			hdr.Name = parts[1]
 			if err := s.tarwriter.WriteHeader(hdr); err != nil {
@@ -221,11 +261,13 @@ func (dfs *DistributedFilesystem) restoreV1(r io.Reader) error {
 					Error("Could not write image header")
 				dataError = err
 				return err
-			} else if _, err := io.Copy(s.tarwriter, backuptar); err != nil {
+			} else if n, err := io.Copy(s.tarwriter, backuptar); err != nil {
 				plog.WithError(err).WithField("header", hdr.Name).
 					Error("Could not write image data with header")
 				dataError = err
 				return err
+			} else {
+				job.Add(RestorePhaseImages, n)
 			}
 		default:
 			plog.WithField("name", hdr.Name).Warn("Unrecognized file")
@@ -238,35 +280,47 @@ func (dfs *DistributedFilesystem) restoreV1(r io.Reader) error {
 		delete(streamMap, DockerImagesFile)
 		s.tarwriter.Close()
 		s.writer.Close()
-		if err := <-s.errc; err != nil {
+		err := <-s.errc
+		job.Finish(RestorePhaseImages, err)
+		if err != nil {
 			plog.WithError(err).Error("Could not load docker images from backup")
 			dataError = err
 			return err
 		}
-	} else {
+	} else if !job.IsDone(RestorePhaseImages) {
 		plog.Warn("Backup missing docker image data")
+		job.Start(RestorePhaseImages, 0, "bytes")
+		job.Finish(RestorePhaseImages, nil)
 	}
 
-	// load the snapshots and update the images in the registry
+	// load the snapshots
 	for id, s := range streamMap {
 		delete(streamMap, id)
 		s.tarwriter.Close()
 		s.writer.Close()
-		if err := <-s.errc; err != nil {
+		err := <-s.errc
+		job.Finish(s.phase, err)
+		if err != nil {
 			// this snapshot is no good, but maybe the other snapshots are
 			// better.
 			plog.WithError(err).WithField("id", id).Error("Error trying to import")
 			dataError = err
-			continue
 		}
+	}
 
-		parts := strings.Split(id, "/")
-		if len(parts) != 3 {
-			dataError = errors.New("this should never happen")
-			return dataError
+	// update the images in the registry for the snapshots that loaded,
+	// including the ones that were loaded by an earlier run of the restore.
+	for _, snapshot := range snapshots {
+		tenant, label := snapshot[0], snapshot[1]
+		snapshotID := tenant + "_" + label
+		if !job.IsDone(RestoreVolumePhase(snapshotID)) || job.IsDone(RestoreRegistryPhase(snapshotID)) {
+			continue
 		}
-
-		if err := dfs.loadSnapshotImages(parts[1], parts[2]); err != nil {
+		if err := job.Err(); err != nil {
+			dataError = err
+			return err
+		}
+		if err := dfs.loadSnapshotImages(tenant, label, job); err != nil {
 			// could not load images for this snapshot, but maybe other
 			// snapshots are better.
 			dataError = err
@@ -313,10 +367,19 @@ func (dfs *DistributedFilesystem) restoreSnapshot(tenant, label string, r io.Rea
 		}()
 	}
 
-	err = vol.Import(label, r)
-	if err == volume.ErrSnapshotExists {
-		err = nil // volume.ErrSnapshotExists is an error we can ignore
+	// A snapshot with this label may be left over from a restore that was
+	// cancelled or failed part way through the volume, and an import does
+	// not clean up after itself.  Replace it, so that a truncated snapshot is
+	// never kept.
+	if err = vol.RemoveSnapshot(label); err == volume.ErrSnapshotDoesNotExist {
+		err = nil
 	} else if err != nil {
+		tenantLogger.WithError(err).WithField("label", label).
+			Error("Could not remove existing snapshot for tenant")
+		return err
+	}
+
+	if err = vol.Import(label, r); err != nil {
 		tenantLogger.WithError(err).WithField("label", label).
 			Error("Could not import snapshot for tenant")
 		return err
@@ -327,7 +390,14 @@ func (dfs *DistributedFilesystem) restoreSnapshot(tenant, label string, r io.Rea
 
 // loadSnapshotImages adds images to the registry based on the information
 // provided by the loaded snapshot.
-func (dfs *DistributedFilesystem) loadSnapshotImages(tenant, label string) error {
+// Images that the job already pushed in an earlier run are skipped.
+func (dfs *DistributedFilesystem) loadSnapshotImages(tenant, label string, job *RestoreJob) (err error) {
+	if job == nil {
+		job = NewRestoreJob(RestoreStatus{})
+	}
+	phase := RestoreRegistryPhase(tenant + "_" + label)
+	skip := job.Progress(phase)
+
 	vol, err := dfs.disk.Get(tenant)
 	if err != nil {
 		plog.WithError(err).WithField("tenant", tenant).Error("Could not get volume for tenant")
@@ -362,13 +432,24 @@ func (dfs *DistributedFilesystem) loadSnapshotImages(tenant, label string) error
 		return err
 	}
 
+	job.Start(phase, int64(len(images)), "images")
+	defer func() { job.Finish(phase, err) }()
+	if skip > int64(len(images)) {
+		skip = int64(len(images))
+	}
+	job.Add(phase, skip)
+
 	// try to load the image into the registry
-	for _, image := range images {
+	for _, image := range images[skip:] {
+		if err := job.Err(); err != nil {
+			return err
+		}
 		imageLogger := plog.WithField("image", image)
 
 		img, err := dfs.docker.FindImage(image)
 		if err != nil {
 			imageLogger.WithError(err).Warn("Missing image for import to registry")
+			job.Add(phase, 1)
 			continue
 		}
 
@@ -385,6 +466,7 @@ func (dfs *DistributedFilesystem) loadSnapshotImages(tenant, label string) error
 		}
 
 		imageLogger.Info("Loaded image into the registry")
+		job.Add(phase, 1)
 	}
 
 	tenantLogger.Info("Loaded images from snapshot for tenant")
@@ -81,6 +81,7 @@ func (s *DFSTestSuite) TestRestore_ImportSnapshot(c *C) {
 	s.disk.On("Create", "BASE").Return(&volumemocks.Volume{}, volume.ErrVolumeExists)
 	vol := &volumemocks.Volume{}
 	s.disk.On("Get", "BASE").Return(vol, nil)
+	vol.On("RemoveSnapshot", "LABEL").Return(volume.ErrSnapshotDoesNotExist)
 	vol.On("Import", "LABEL", mock.Anything).Return(nil)
 	imgbuffer := bytes.NewBufferString("")
 	err = json.NewEncoder(imgbuffer).Encode([]string{})
@@ -173,6 +174,7 @@ func (s *DFSTestSuite) TestRestore_ImportSnapshotImageNotFound(c *C) {
 	vol := &volumemocks.Volume{}
 	s.disk.On("Create", "BASE").Return(vol, nil)
 	s.disk.On("Get", "BASE").Return(vol, nil)
+	vol.On("RemoveSnapshot", "LABEL").Return(volume.ErrSnapshotDoesNotExist)
 	vol.On("Import", "LABEL", mock.Anything).Return(nil)
 	imgbuffer := bytes.NewBufferString("")
 	err = json.NewEncoder(imgbuffer).Encode([]string{"test:5000/image:now"})
@@ -206,6 +208,7 @@ func (s *DFSTestSuite) TestRestore_ImportSnapshotImageNoPush(c *C) {
 	vol := &volumemocks.Volume{}
 	s.disk.On("Create", "BASE").Return(vol, nil)
 	s.disk.On("Get", "BASE").Return(vol, nil)
+	vol.On("RemoveSnapshot", "LABEL").Return(volume.ErrSnapshotDoesNotExist)
 	vol.On("Import", "LABEL", mock.Anything).Return(nil)
 	imgbuffer := bytes.NewBufferString("")
 	err = json.NewEncoder(imgbuffer).Encode([]string{"test:5000/image:now"})
@@ -241,6 +244,7 @@ func (s *DFSTestSuite) TestRestore_ImportSnapshotImageNoHash(c *C) {
 	vol := &volumemocks.Volume{}
 	s.disk.On("Create", "BASE").Return(vol, nil)
 	s.disk.On("Get", "BASE").Return(vol, nil)
+	vol.On("RemoveSnapshot", "LABEL").Return(volume.ErrSnapshotDoesNotExist)
 	vol.On("Import", "LABEL", mock.Anything).Return(nil)
 	imgbuffer := bytes.NewBufferString("")
 	err = json.NewEncoder(imgbuffer).Encode([]string{"test:5000/image:now"})
@@ -254,7 +258,7 @@ func (s *DFSTestSuite) TestRestore_ImportSnapshotImageNoHash(c *C) {
 	vol.AssertExpectations(c)
 }
 
-func (s *DFSTestSuite) TestRestore_ImportSnapshotSnapshotExists(c *C) {
+func (s *DFSTestSuite) TestRestore_ImportSnapshotReplacesExisting(c *C) {
 	buf := bytes.NewBufferString("")
 	tarfile := tar.NewWriter(buf)
 	backupInfo := BackupInfo{
@@ -278,7 +282,8 @@ func (s *DFSTestSuite) TestRestore_ImportSnapshotSnapshotExists(c *C) {
 	vol := &volumemocks.Volume{}
 	s.disk.On("Create", "BASE").Return(&volumemocks.Volume{}, volume.ErrVolumeExists)
 	s.disk.On("Get", "BASE").Return(vol, nil)
-	vol.On("Import", "LABEL", mock.Anything).Return(volume.ErrSnapshotExists)
+	vol.On("RemoveSnapshot", "LABEL").Return(nil)
+	vol.On("Import", "LABEL", mock.Anything).Return(nil)
 	// s.disk.On("Exists", "BASE_LABEL").Return(true)
 	s.docker.On("LoadImage", mock.Anything).Return(nil).Run(func(a mock.Arguments) {
 		reader := a.Get(0).(io.Reader)
@@ -299,6 +304,8 @@ func (s *DFSTestSuite) TestRestore_ImportSnapshotBadSnapshot(c *C) {
 	vol := &volumemocks.Volume{}
 	s.disk.On("Create", "BASE").Return(vol, nil)
 	s.disk.On("Remove", "BASE").Return(nil)
+	vol.On("RemoveSnapshot", "LABEL").Return(volume.ErrSnapshotDoesNotExist)
+	vol.On("RemoveSnapshot", "LABEL2").Return(volume.ErrSnapshotDoesNotExist)
 
 	// bad backup
 	vol.On("Import", "LABEL", mock.Anything).Run(func(a mock.Arguments) {
@@ -542,3 +549,121 @@ func (s *DFSTestSuite) writeBackupInfo(c *C, tarfile *tar.Writer, backupInfo Bac
 	_, err = tarfile.Write(bytedata)
 	c.Assert(err, IsNil)
 }
+
+func (s *DFSTestSuite) TestRestoreWithProgress_SkipsDonePhases(c *C) {
+	buf := bytes.NewBufferString("")
+	tarfile := tar.NewWriter(buf)
+	backupInfo := BackupInfo{
+		Snapshots:     []string{"BASE_LABEL"},
+		Timestamp:     time.Now().UTC(),
+		BackupVersion: 1,
+	}
+	s.writeBackupInfo(c, tarfile, backupInfo)
+	err := tarfile.WriteHeader(&tar.Header{Name: path.Join(DockerImagesFile, "dummy"), Size: 0})
+	c.Assert(err, IsNil)
+	err = tarfile.WriteHeader(&tar.Header{Name: path.Join(SnapshotsMetadataDir, "BASE", "LABEL", "dummy"), Size: 0})
+	c.Assert(err, IsNil)
+	tarfile.Close()
+
+	// the images and the volume were loaded by an earlier run, so only the
+	// registry is updated.
+	job := NewRestoreJob(RestoreStatus{
+		Phases: []RestorePhase{
+			{Name: RestorePhaseImages, State: RestoreDone},
+			{Name: RestoreVolumePhase("BASE_LABEL"), State: RestoreDone},
+		},
+	})
+	vol := &volumemocks.Volume{}
+	s.disk.On("Get", "BASE").Return(vol, nil)
+	vol.On("ReadMetadata", "LABEL", ImagesMetadataFile).Return(&NopCloser{bytes.NewBufferString("[]")}, nil)
+	err = s.dfs.RestoreWithProgress(buf, backupInfo.BackupVersion, job)
+	c.Assert(err, IsNil)
+	s.docker.AssertNotCalled(c, "LoadImage", mock.Anything)
+	vol.AssertNotCalled(c, "Import", "LABEL", mock.Anything)
+	c.Assert(job.IsDone(RestoreRegistryPhase("BASE_LABEL")), Equals, true)
+}
+
+func (s *DFSTestSuite) TestRestoreWithProgress_Cancelled(c *C) {
+	buf := bytes.NewBufferString("")
+	tarfile := tar.NewWriter(buf)
+	backupInfo := BackupInfo{
+		Snapshots:     []string{"BASE_LABEL"},
+		Timestamp:     time.Now().UTC(),
+		BackupVersion: 1,
+	}
+	s.writeBackupInfo(c, tarfile, backupInfo)
+	err := tarfile.WriteHeader(&tar.Header{Name: path.Join(DockerImagesFile, "dummy"), Size: 0})
+	c.Assert(err, IsNil)
+	tarfile.Close()
+
+	job := NewRestoreJob(RestoreStatus{})
+	job.Cancel()
+	err = s.dfs.RestoreWithProgress(buf, backupInfo.BackupVersion, job)
+	c.Assert(err, Equals, ErrRestoreCancelled)
+	s.docker.AssertNotCalled(c, "LoadImage", mock.Anything)
+	c.Assert(job.IsDone(RestorePhaseImages), Equals, false)
+}
+
+func (s *DFSTestSuite) TestRestoreWithProgress_ResumeAfterCancelledVolume(c *C) {
+	backup := func() *bytes.Buffer {
+		buf := bytes.NewBufferString("")
+		tarfile := tar.NewWriter(buf)
+		s.writeBackupInfo(c, tarfile, BackupInfo{
+			Snapshots:     []string{"BASE_LABEL"},
+			Timestamp:     time.Now().UTC(),
+			BackupVersion: 1,
+		})
+		for _, name := range []string{"a", "b", "c"} {
+			err := tarfile.WriteHeader(&tar.Header{Name: path.Join(SnapshotsMetadataDir, "BASE", "LABEL", name), Size: 4})
+			c.Assert(err, IsNil)
+			_, err = tarfile.Write([]byte("data"))
+			c.Assert(err, IsNil)
+		}
+		c.Assert(tarfile.Close(), IsNil)
+		return buf
+	}
+
+	// the files of the snapshot, which the import leaves behind when it
+	// fails part way through
+	var snapshot []string
+	job := NewRestoreJob(RestoreStatus{})
+	cancelled := false
+	vol := &volumemocks.Volume{}
+	s.disk.On("Create", "BASE").Return(vol, volume.ErrVolumeExists)
+	s.disk.On("Get", "BASE").Return(vol, nil)
+	vol.On("RemoveSnapshot", "LABEL").Run(func(a mock.Arguments) {
+		snapshot = nil
+	}).Return(nil)
+	importSnapshot := func(a mock.Arguments) {
+		tr := tar.NewReader(a.Get(1).(io.Reader))
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				return
+			}
+			snapshot = append(snapshot, hdr.Name)
+			if len(snapshot) == 2 && !cancelled {
+				cancelled = true
+				job.Cancel()
+			}
+			io.Copy(ioutil.Discard, tr)
+		}
+	}
+	vol.On("Import", "LABEL", mock.Anything).Run(importSnapshot).Return(ErrRestoreCancelled).Once()
+	vol.On("Import", "LABEL", mock.Anything).Run(importSnapshot).Return(nil).Once()
+	vol.On("ReadMetadata", "LABEL", ImagesMetadataFile).Return(&NopCloser{bytes.NewBufferString("[]")}, nil)
+
+	// cancel the restore in the middle of the volume
+	err := s.dfs.RestoreWithProgress(backup(), 1, job)
+	c.Assert(err, Equals, ErrRestoreCancelled)
+	c.Assert(job.IsDone(RestoreVolumePhase("BASE_LABEL")), Equals, false)
+	c.Assert(len(snapshot) < 3, Equals, true)
+
+	// the resumed restore replaces the truncated snapshot
+	job = NewRestoreJob(job.Status())
+	err = s.dfs.RestoreWithProgress(backup(), 1, job)
+	c.Assert(err, IsNil)
+	c.Assert(job.IsDone(RestoreVolumePhase("BASE_LABEL")), Equals, true)
+	c.Assert(snapshot, DeepEquals, []string{"a", "b", "c"})
+	vol.AssertExpectations(c)
+}
@@ -0,0 +1,239 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dfs
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// States of a restore and of its phases
+const (
+	RestorePending   = "pending"
+	RestoreRunning   = "running"
+	RestoreDone      = "done"
+	RestoreFailed    = "failed"
+	RestoreCancelled = "cancelled"
+)
+
+// Phases of a restore.  Volume, registry and services phases are per
+// snapshot of a tenant.
+const (
+	RestorePhaseImages    = "images"
+	RestorePhaseTemplates = "templates"
+	RestorePhasePools     = "pools"
+)
+
+// ErrRestoreCancelled is returned when a restore stops because it was
+// cancelled
+var ErrRestoreCancelled = errors.New("restore was cancelled")
+
+// RestoreVolumePhase is the phase that imports the volume of a snapshot
+func RestoreVolumePhase(snapshotID string) string { return "volume:" + snapshotID }
+
+// RestoreRegistryPhase is the phase that loads the images of a snapshot into
+// the registry
+func RestoreRegistryPhase(snapshotID string) string { return "registry:" + snapshotID }
+
+// RestoreServicesPhase is the phase that restores the services of a snapshot
+func RestoreServicesPhase(snapshotID string) string { return "services:" + snapshotID }
+
+// RestorePhase is a unit of work of a restore.  Phases that are done are
+// skipped when the restore is resumed.
+type RestorePhase struct {
+	Name      string
+	State     string
+	Done      int64
+	Total     int64
+	Unit      string
+	Error     string
+	Started   time.Time
+	Completed time.Time
+}
+
+// RestoreStatus is the progress of a restore
+type RestoreStatus struct {
+	Filename string
+	State    string
+	Error    string
+	Started  time.Time
+	Updated  time.Time
+	Phases   []RestorePhase
+}
+
+// Phase returns the phase with the given name, or nil
+func (s *RestoreStatus) Phase(name string) *RestorePhase {
+	for i := range s.Phases {
+		if s.Phases[i].Name == name {
+			return &s.Phases[i]
+		}
+	}
+	return nil
+}
+
+// RestoreJob tracks the phases of a running restore, so that the restore
+// can report its progress, be cancelled between units of work, and be
+// resumed after the phases that completed.
+type RestoreJob struct {
+	mu     sync.Mutex
+	status RestoreStatus
+	cancel chan struct{}
+	once   sync.Once
+
+	// OnUpdate is called with the status of the job whenever a phase starts
+	// or ends, so that the job can be saved.
+	OnUpdate func(RestoreStatus)
+}
+
+// NewRestoreJob starts a restore job.  Pass the status of an earlier job to
+// resume it; the phases that are not done are run again.
+func NewRestoreJob(status RestoreStatus) *RestoreJob {
+	now := time.Now()
+	if status.Started.IsZero() {
+		status.Started = now
+	}
+	status.State = RestoreRunning
+	status.Error = ""
+	status.Updated = now
+	return &RestoreJob{status: status, cancel: make(chan struct{})}
+}
+
+// Plan adds phases that have not run yet, so the status shows the work that
+// is left.
+func (j *RestoreJob) Plan(names ...string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, name := range names {
+		if j.status.Phase(name) == nil {
+			j.status.Phases = append(j.status.Phases, RestorePhase{Name: name, State: RestorePending})
+		}
+	}
+}
+
+// Status returns a copy of the progress of the job
+func (j *RestoreJob) Status() RestoreStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.copyStatus()
+}
+
+func (j *RestoreJob) copyStatus() RestoreStatus {
+	status := j.status
+	status.Phases = make([]RestorePhase, len(j.status.Phases))
+	copy(status.Phases, j.status.Phases)
+	return status
+}
+
+// Cancel asks the restore to stop at the end of its current unit of work
+func (j *RestoreJob) Cancel() {
+	j.once.Do(func() { close(j.cancel) })
+}
+
+// Err returns ErrRestoreCancelled if the job was cancelled
+func (j *RestoreJob) Err() error {
+	select {
+	case <-j.cancel:
+		return ErrRestoreCancelled
+	default:
+		return nil
+	}
+}
+
+// IsDone returns true if the phase completed, in this or an earlier run of
+// the job
+func (j *RestoreJob) IsDone(name string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	p := j.status.Phase(name)
+	return p != nil && p.State == RestoreDone
+}
+
+// Progress returns the units of work done in a phase
+func (j *RestoreJob) Progress(name string) int64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if p := j.status.Phase(name); p != nil {
+		return p.Done
+	}
+	return 0
+}
+
+// Start marks a phase as running and resets the work done in the phase.
+func (j *RestoreJob) Start(name string, total int64, unit string) {
+	j.mu.Lock()
+	p := j.status.Phase(name)
+	if p == nil {
+		j.status.Phases = append(j.status.Phases, RestorePhase{Name: name})
+		p = &j.status.Phases[len(j.status.Phases)-1]
+	}
+	p.State = RestoreRunning
+	p.Done = 0
+	p.Total = total
+	p.Unit = unit
+	p.Error = ""
+	p.Started = time.Now()
+	j.update()
+}
+
+// Add adds to the work done in a running phase
+func (j *RestoreJob) Add(name string, n int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if p := j.status.Phase(name); p != nil {
+		p.Done += n
+		j.status.Updated = time.Now()
+	}
+}
+
+// Finish ends a phase
+func (j *RestoreJob) Finish(name string, err error) {
+	j.mu.Lock()
+	p := j.status.Phase(name)
+	if p == nil {
+		j.mu.Unlock()
+		return
+	}
+	p.State, p.Error = stateOf(err)
+	p.Completed = time.Now()
+	j.update()
+}
+
+// Complete ends the job
+func (j *RestoreJob) Complete(err error) {
+	j.mu.Lock()
+	j.status.State, j.status.Error = stateOf(err)
+	j.update()
+}
+
+// update notifies the status of the job and releases the lock
+func (j *RestoreJob) update() {
+	j.status.Updated = time.Now()
+	status := j.copyStatus()
+	j.mu.Unlock()
+	if j.OnUpdate != nil {
+		j.OnUpdate(status)
+	}
+}
+
+func stateOf(err error) (string, string) {
+	switch err {
+	case nil:
+		return RestoreDone, ""
+	case ErrRestoreCancelled:
+		return RestoreCancelled, err.Error()
+	default:
+		return RestoreFailed, err.Error()
+	}
+}
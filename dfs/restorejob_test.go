@@ -0,0 +1,86 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package dfs_test
+
+import (
+	"errors"
+
+	. "github.com/control-center/serviced/dfs"
+	. "gopkg.in/check.v1"
+)
+
+func (s *DFSTestSuite) TestRestoreJob_Phases(c *C) {
+	var updates []RestoreStatus
+	job := NewRestoreJob(RestoreStatus{Filename: "backup.tgz"})
+	job.OnUpdate = func(status RestoreStatus) { updates = append(updates, status) }
+	job.Plan(RestorePhaseImages, RestorePhaseTemplates)
+
+	status := job.Status()
+	c.Assert(status.State, Equals, RestoreRunning)
+	c.Assert(status.Phases, HasLen, 2)
+	c.Assert(status.Phases[0].State, Equals, RestorePending)
+
+	job.Start(RestorePhaseImages, 10, "bytes")
+	job.Add(RestorePhaseImages, 4)
+	c.Assert(job.Progress(RestorePhaseImages), Equals, int64(4))
+	c.Assert(job.IsDone(RestorePhaseImages), Equals, false)
+	job.Finish(RestorePhaseImages, nil)
+	c.Assert(job.IsDone(RestorePhaseImages), Equals, true)
+
+	job.Start(RestorePhaseTemplates, 1, "templates")
+	job.Finish(RestorePhaseTemplates, errors.New("bad template"))
+	job.Complete(errors.New("bad template"))
+
+	status = job.Status()
+	c.Assert(status.State, Equals, RestoreFailed)
+	c.Assert(status.Error, Equals, "bad template")
+	c.Assert(status.Phase(RestorePhaseTemplates).State, Equals, RestoreFailed)
+	c.Assert(status.Phase(RestorePhaseTemplates).Error, Equals, "bad template")
+	c.Assert(updates, HasLen, 5)
+	c.Assert(updates[4].State, Equals, RestoreFailed)
+}
+
+func (s *DFSTestSuite) TestRestoreJob_Cancel(c *C) {
+	job := NewRestoreJob(RestoreStatus{})
+	c.Assert(job.Err(), IsNil)
+	job.Cancel()
+	job.Cancel()
+	c.Assert(job.Err(), Equals, ErrRestoreCancelled)
+	job.Start(RestorePhasePools, 1, "pools")
+	job.Finish(RestorePhasePools, job.Err())
+	job.Complete(job.Err())
+	status := job.Status()
+	c.Assert(status.State, Equals, RestoreCancelled)
+	c.Assert(status.Phase(RestorePhasePools).State, Equals, RestoreCancelled)
+}
+
+func (s *DFSTestSuite) TestRestoreJob_Resume(c *C) {
+	job := NewRestoreJob(RestoreStatus{})
+	job.Start(RestorePhaseImages, 0, "bytes")
+	job.Finish(RestorePhaseImages, nil)
+	job.Start(RestoreRegistryPhase("BASE_LABEL"), 3, "images")
+	job.Add(RestoreRegistryPhase("BASE_LABEL"), 2)
+	job.Cancel()
+	job.Complete(job.Err())
+
+	resumed := NewRestoreJob(job.Status())
+	c.Assert(resumed.Err(), IsNil)
+	c.Assert(resumed.Status().State, Equals, RestoreRunning)
+	c.Assert(resumed.Status().Started, Equals, job.Status().Started)
+	c.Assert(resumed.IsDone(RestorePhaseImages), Equals, true)
+	c.Assert(resumed.IsDone(RestoreRegistryPhase("BASE_LABEL")), Equals, false)
+	c.Assert(resumed.Progress(RestoreRegistryPhase("BASE_LABEL")), Equals, int64(2))
+}
@@ -0,0 +1,82 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dfs
+
+import (
+	"errors"
+
+	"github.com/control-center/serviced/volume"
+	"github.com/zenoss/glog"
+)
+
+// ErrSnapshotTenantMismatch is returned when snapshots of different
+// applications are compared.
+var ErrSnapshotTenantMismatch = errors.New("snapshots belong to different applications")
+
+// ListFiles lists the files at a path in a snapshot
+func (dfs *DistributedFilesystem) ListFiles(snapshotID, path string) ([]volume.SnapshotFile, error) {
+	vol, info, err := dfs.getSnapshotVolumeAndInfo(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	files, err := volume.ListSnapshotFiles(vol, info.Label, path)
+	if err != nil {
+		glog.Errorf("Could not list %s in snapshot %s: %s", path, snapshotID, err)
+		return nil, err
+	}
+	return files, nil
+}
+
+// Diff returns the files under a path that changed between two snapshots of
+// the same application.
+func (dfs *DistributedFilesystem) Diff(fromSnapshotID, toSnapshotID, path string) ([]volume.SnapshotChange, error) {
+	vol, fromInfo, err := dfs.getSnapshotVolumeAndInfo(fromSnapshotID)
+	if err != nil {
+		return nil, err
+	}
+	toInfo, err := vol.SnapshotInfo(toSnapshotID)
+	if err != nil {
+		glog.Errorf("Could not get info for snapshot %s: %s", toSnapshotID, err)
+		return nil, err
+	}
+	if fromInfo.TenantID != toInfo.TenantID {
+		return nil, ErrSnapshotTenantMismatch
+	}
+	changes, err := volume.DiffSnapshotFiles(vol, fromInfo.Label, toInfo.Label, path)
+	if err != nil {
+		glog.Errorf("Could not compare snapshots %s and %s: %s", fromSnapshotID, toSnapshotID, err)
+		return nil, err
+	}
+	return changes, nil
+}
+
+// RestorePath copies a file or directory from a snapshot into a directory, or
+// into the application's volume if dest is empty.  Returns the number of
+// files restored.
+func (dfs *DistributedFilesystem) RestorePath(snapshotID, path, dest string) (int, error) {
+	vol, info, err := dfs.getSnapshotVolumeAndInfo(snapshotID)
+	if err != nil {
+		return 0, err
+	}
+	if dest == "" {
+		dest = vol.Path()
+	}
+	count, err := volume.RestoreSnapshotPath(vol, info.Label, path, dest)
+	if err != nil {
+		glog.Errorf("Could not restore %s from snapshot %s to %s: %s", path, snapshotID, dest, err)
+		return count, err
+	}
+	glog.Infof("Restored %d files at %s from snapshot %s to %s", count, path, snapshotID, dest)
+	return count, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package dfs_test
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	. "github.com/control-center/serviced/dfs"
+	"github.com/control-center/serviced/volume"
+	volumemocks "github.com/control-center/serviced/volume/mocks"
+	"github.com/stretchr/testify/mock"
+	. "gopkg.in/check.v1"
+)
+
+// exportFile writes a snapshot export that contains a single file
+func exportFile(label, name, content string) func(string, string, io.Writer) error {
+	return func(_, _ string, w io.Writer) error {
+		tarfile := tar.NewWriter(w)
+		defer tarfile.Close()
+		tarfile.WriteHeader(&tar.Header{Name: label + "-volume", Mode: 0755, Typeflag: tar.TypeDir})
+		tarfile.WriteHeader(&tar.Header{Name: label + "-volume/" + name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(content))})
+		tarfile.Write([]byte(content))
+		return nil
+	}
+}
+
+func (s *DFSTestSuite) TestListFiles_NoSnapshot(c *C) {
+	s.disk.On("GetTenant", "BASE_LABEL").Return(&volumemocks.Volume{}, volume.ErrVolumeNotExists)
+	files, err := s.dfs.ListFiles("BASE_LABEL", "")
+	c.Assert(files, IsNil)
+	c.Assert(err, Equals, volume.ErrVolumeNotExists)
+}
+
+func (s *DFSTestSuite) TestListFiles_Success(c *C) {
+	vol := s.getVolumeFromSnapshot("BASE_LABEL", "BASE")
+	vol.On("SnapshotInfo", "BASE_LABEL").Return(&volume.SnapshotInfo{Name: "BASE_LABEL", TenantID: "BASE", Label: "LABEL"}, nil)
+	vol.On("Export", "LABEL", "", mock.Anything).Return(exportFile("BASE_LABEL", "a.conf", "data"))
+	files, err := s.dfs.ListFiles("BASE_LABEL", "/")
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 1)
+	c.Check(files[0].Path, Equals, "a.conf")
+	c.Check(files[0].Size, Equals, int64(4))
+}
+
+func (s *DFSTestSuite) TestDiff_TenantMismatch(c *C) {
+	vol := s.getVolumeFromSnapshot("BASE_LABEL", "BASE")
+	vol.On("SnapshotInfo", "BASE_LABEL").Return(&volume.SnapshotInfo{Name: "BASE_LABEL", TenantID: "BASE", Label: "LABEL"}, nil)
+	vol.On("SnapshotInfo", "OTHER_LABEL").Return(&volume.SnapshotInfo{Name: "OTHER_LABEL", TenantID: "OTHER", Label: "LABEL"}, nil)
+	changes, err := s.dfs.Diff("BASE_LABEL", "OTHER_LABEL", "")
+	c.Assert(changes, IsNil)
+	c.Assert(err, Equals, ErrSnapshotTenantMismatch)
+}
+
+func (s *DFSTestSuite) TestDiff_Success(c *C) {
+	vol := s.getVolumeFromSnapshot("BASE_LABEL1", "BASE")
+	vol.On("SnapshotInfo", "BASE_LABEL1").Return(&volume.SnapshotInfo{Name: "BASE_LABEL1", TenantID: "BASE", Label: "LABEL1"}, nil)
+	vol.On("SnapshotInfo", "BASE_LABEL2").Return(&volume.SnapshotInfo{Name: "BASE_LABEL2", TenantID: "BASE", Label: "LABEL2"}, nil)
+	vol.On("Export", "LABEL1", "", mock.Anything).Return(exportFile("BASE_LABEL1", "a.conf", "data"))
+	vol.On("Export", "LABEL2", "", mock.Anything).Return(exportFile("BASE_LABEL2", "a.conf", "changed"))
+	changes, err := s.dfs.Diff("BASE_LABEL1", "BASE_LABEL2", "")
+	c.Assert(err, IsNil)
+	c.Check(changes, DeepEquals, []volume.SnapshotChange{
+		{Path: "a.conf", Change: volume.FileModified, OldSize: 4, NewSize: 7},
+	})
+}
+
+func (s *DFSTestSuite) TestRestorePath_Success(c *C) {
+	dir := c.MkDir()
+	vol := s.getVolumeFromSnapshot("BASE_LABEL", "BASE")
+	vol.On("SnapshotInfo", "BASE_LABEL").Return(&volume.SnapshotInfo{Name: "BASE_LABEL", TenantID: "BASE", Label: "LABEL"}, nil)
+	vol.On("Export", "LABEL", "", mock.Anything).Return(exportFile("BASE_LABEL", "a.conf", "data"))
+	vol.On("Path").Return(dir)
+	count, err := s.dfs.RestorePath("BASE_LABEL", "a.conf", "")
+	c.Assert(err, IsNil)
+	c.Check(count, Equals, 1)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "a.conf"))
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "data")
+}
@@ -23,7 +23,9 @@ import (
 
 // UpgradeRegistry loads images for each service into the docker registry
 // index.  Also migrates images from a previous (or V1) registry at
-// registryHost (host:port).
+// registryHost (host:port), including the images of the tenant's snapshots.
+// With override, every image is pushed again into the docker registry and
+// into the registries of the resource pools.
 func (dfs *DistributedFilesystem) UpgradeRegistry(svcs []service.ServiceDetails, tenantID, registryHost string, override bool) error {
 	imageIDs := make(map[string]struct{})
 	for _, svc := range svcs {
@@ -89,5 +91,41 @@ func (dfs *DistributedFilesystem) UpgradeRegistry(svcs []service.ServiceDetails,
 		}
 		glog.Infof("Added image %s for service %s (%s) to the docker registry", rImage, svc.Name, svc.ID)
 	}
+	if registryHost != "" || override {
+		return dfs.upgradeSnapshotImages(tenantID, registryHost)
+	}
+	return nil
+}
+
+// upgradeSnapshotImages pulls the images that were tagged by the tenant's
+// snapshots from the registry at registryHost, if set, and pushes them again,
+// so that the snapshots can still be rolled back after the registry moves.
+func (dfs *DistributedFilesystem) upgradeSnapshotImages(tenantID, registryHost string) error {
+	rImages, err := dfs.index.ListImages()
+	if err != nil {
+		glog.Errorf("Could not get images from the registry index: %s", err)
+		return err
+	}
+	for _, rImage := range rImages {
+		if rImage.Library != tenantID || rImage.Tag == docker.Latest {
+			continue
+		}
+		if registryHost != "" {
+			oldImage := fmt.Sprintf("%s/%s", registryHost, rImage.String())
+			if err := dfs.docker.PullImage(oldImage); err != nil {
+				glog.Warningf("Could not pull snapshot image %s from registry %s: %s", rImage.String(), registryHost, err)
+				continue
+			}
+		} else if _, err := dfs.reg.FindImage(&rImage); err != nil {
+			glog.Warningf("Could not find snapshot image %s: %s", rImage.String(), err)
+			continue
+		}
+		// resetting the index entry triggers a push into the registries
+		if err := dfs.index.PushImage(rImage.String(), rImage.UUID, rImage.Hash); err != nil {
+			glog.Errorf("Could not write %s (%s) to registry index: %s", rImage.String(), rImage.UUID, err)
+			return err
+		}
+		glog.Infof("Added snapshot image %s to the docker registry", rImage.String())
+	}
 	return nil
 }
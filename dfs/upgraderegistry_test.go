@@ -80,6 +80,7 @@ func (s *DFSTestSuite) TestUpgradeRegistry_OverrideImageFound(c *C) {
 	s.docker.On("GetImageHash", image.ID).Return("hashvalue", nil)
 	s.docker.On("FindImage", imageName).Return(image, nil)
 	s.index.On("PushImage", "tenantid/reponame:latest", "xyzabc123", "hashvalue").Return(nil)
+	s.index.On("ListImages").Return([]registry.Image{}, nil)
 	err := s.dfs.UpgradeRegistry(svcs, "tenantid", "", true)
 	c.Assert(err, IsNil)
 }
@@ -99,6 +100,7 @@ func (s *DFSTestSuite) TestUpgradeRegistry_OverrideImageNotFound(c *C) {
 	s.docker.On("GetImageHash", image.ID).Return("hashvalue", nil)
 	s.docker.On("FindImage", imageName).Return(image, nil)
 	s.index.On("PushImage", "tenantid/reponame:latest", "xyzabc123", "hashvalue").Return(nil)
+	s.index.On("ListImages").Return([]registry.Image{}, nil)
 	err := s.dfs.UpgradeRegistry(svcs, "tenantid", "", true)
 	c.Assert(err, IsNil)
 }
@@ -230,6 +232,7 @@ func (s *DFSTestSuite) TestUpgradeRegistry_MigrateNoImage(c *C) {
 	s.docker.On("FindImage", imageName).Return(image, nil)
 	s.docker.On("GetImageHash", image.ID).Return("hashvalue", nil)
 	s.index.On("PushImage", "tenantid/reponame:latest", "uuidvalue", "hashvalue").Return(nil)
+	s.index.On("ListImages").Return([]registry.Image{}, nil)
 	err := s.dfs.UpgradeRegistry(svcs, "tenantid", "old-server:5001", false)
 	c.Assert(err, IsNil)
 }
@@ -268,6 +271,34 @@ func (s *DFSTestSuite) TestUpgradeRegistry_MigrateSuccess(c *C) {
 	s.docker.On("FindImage", imageName).Return(image, nil)
 	s.docker.On("GetImageHash", image.ID).Return("hashvalue", nil)
 	s.index.On("PushImage", "tenantid/reponame:latest", "uuidvalue", "hashvalue").Return(nil)
+	s.index.On("ListImages").Return([]registry.Image{
+		{Library: "tenantid", Repo: "reponame", Tag: "latest", UUID: "uuidvalue", Hash: "hashvalue"},
+		{Library: "tenantid", Repo: "reponame", Tag: "snap1", UUID: "uuidsnap1", Hash: "hashsnap1"},
+		{Library: "tenantid", Repo: "reponame", Tag: "snap2", UUID: "uuidsnap2", Hash: "hashsnap2"},
+		{Library: "othertenant", Repo: "reponame", Tag: "snap1", UUID: "uuidother", Hash: "hashother"},
+	}, nil)
+	s.docker.On("PullImage", "old-server:5001/tenantid/reponame:snap1").Return(nil)
+	s.docker.On("PullImage", "old-server:5001/tenantid/reponame:snap2").Return(dockerclient.ErrNoSuchImage)
+	s.index.On("PushImage", "tenantid/reponame:snap1", "uuidsnap1", "hashsnap1").Return(nil).Once()
 	err := s.dfs.UpgradeRegistry(svcs, "tenantid", "old-server:5001", false)
 	c.Assert(err, IsNil)
+	s.index.AssertExpectations(c)
+	s.docker.AssertNotCalled(c, "PullImage", "old-server:5001/othertenant/reponame:snap1")
+}
+
+// override pushes the snapshot images again
+func (s *DFSTestSuite) TestUpgradeRegistry_OverrideSnapshotImages(c *C) {
+	s.index.On("ListImages").Return([]registry.Image{
+		{Library: "tenantid", Repo: "reponame", Tag: "latest", UUID: "uuidvalue", Hash: "hashvalue"},
+		{Library: "tenantid", Repo: "reponame", Tag: "snap1", UUID: "uuidsnap1", Hash: "hashsnap1"},
+		{Library: "tenantid", Repo: "reponame", Tag: "snap2", UUID: "uuidsnap2", Hash: "hashsnap2"},
+		{Library: "othertenant", Repo: "reponame", Tag: "snap1", UUID: "uuidother", Hash: "hashother"},
+	}, nil)
+	s.registry.On("FindImage", &registry.Image{Library: "tenantid", Repo: "reponame", Tag: "snap1", UUID: "uuidsnap1", Hash: "hashsnap1"}).Return(&dockerclient.Image{ID: "uuidsnap1"}, nil)
+	s.registry.On("FindImage", &registry.Image{Library: "tenantid", Repo: "reponame", Tag: "snap2", UUID: "uuidsnap2", Hash: "hashsnap2"}).Return(nil, dockerclient.ErrNoSuchImage)
+	s.index.On("PushImage", "tenantid/reponame:snap1", "uuidsnap1", "hashsnap1").Return(nil).Once()
+	err := s.dfs.UpgradeRegistry(nil, "tenantid", "", true)
+	c.Assert(err, IsNil)
+	s.index.AssertExpectations(c)
+	s.index.AssertNotCalled(c, "PushImage", "tenantid/reponame:snap2", "uuidsnap2", "hashsnap2")
 }
@@ -0,0 +1,513 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dfs
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/domain/service"
+)
+
+// BackupReport describes the result of verifying a backup against its
+// metadata.
+type BackupReport struct {
+	Timestamp     time.Time
+	BackupVersion int
+	Snapshots     []SnapshotReport
+	Images        []ImageReport
+	Errors        []string
+	Warnings      []string
+}
+
+// SnapshotReport is the result of test-importing a snapshot from a backup
+type SnapshotReport struct {
+	SnapshotID string
+	Services   int
+	Images     []string
+	Error      string
+}
+
+// ImageReport is the result of checking an image in a backup
+type ImageReport struct {
+	Image string
+	Error string
+}
+
+// Valid returns true if the backup can be restored.
+func (r *BackupReport) Valid() bool {
+	if len(r.Errors) > 0 {
+		return false
+	}
+	for _, s := range r.Snapshots {
+		if s.Error != "" {
+			return false
+		}
+	}
+	for _, i := range r.Images {
+		if i.Error != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyBackup reads a whole backup and checks every member against the
+// backup metadata.  Each snapshot is imported into a scratch volume, which is
+// removed afterwards, and the image archive is checked without loading it
+// into docker, so verification does not change any tenant.  Problems with the
+// backup are described in the report; an error is returned only if the
+// backup metadata cannot be read.
+func (dfs *DistributedFilesystem) VerifyBackup(r io.Reader) (*BackupReport, error) {
+	backuptar := tar.NewReader(r)
+	hdr, err := backuptar.Next()
+	if err != nil || hdr.Name != BackupMetadataFile {
+		return nil, ErrRestoreNoInfo
+	}
+	var info BackupInfo
+	if err := json.NewDecoder(backuptar).Decode(&info); err != nil {
+		plog.WithError(err).Error("Could not decode backup metadata")
+		return nil, ErrRestoreNoInfo
+	}
+	if info.BackupVersion != 0 && info.BackupVersion != 1 {
+		return nil, ErrInvalidBackupVersion
+	}
+	report := &BackupReport{
+		Timestamp:     info.Timestamp,
+		BackupVersion: info.BackupVersion,
+	}
+	logger := plog.WithFields(log.Fields{
+		"backupversion": info.BackupVersion,
+		"timestamp":     info.Timestamp,
+	})
+
+	type stream struct {
+		tarwriter *tar.Writer
+		writer    *io.PipeWriter
+		errc      <-chan error
+		report    *SnapshotReport
+		failed    bool
+	}
+	var order []string
+	snapshots := make(map[string]*stream)
+	var imageStream *stream
+	var images map[string]string
+	newSnapshotStream := func(tenant, label string) *stream {
+		s := &stream{report: &SnapshotReport{SnapshotID: tenant + "_" + label}}
+		s.writer, s.errc = loadPipe(func(r io.Reader) error {
+			return dfs.verifySnapshot(tenant, label, r, s.report)
+		})
+		s.tarwriter = tar.NewWriter(s.writer)
+		return s
+	}
+	newImageStream := func() *stream {
+		s := &stream{}
+		s.writer, s.errc = loadPipe(func(r io.Reader) (err error) {
+			images, err = verifyImageArchive(r)
+			return
+		})
+		s.tarwriter = tar.NewWriter(s.writer)
+		return s
+	}
+
+	// write copies a member of the backup to a stream.  If the stream already
+	// failed, the member is skipped; the error is reported when the stream is
+	// closed.
+	write := func(s *stream, hdr *tar.Header) error {
+		if s.failed {
+			return nil
+		}
+		var err error
+		if hdr == nil {
+			_, err = io.Copy(s.writer, backuptar)
+		} else if err = s.tarwriter.WriteHeader(hdr); err == nil {
+			_, err = io.Copy(s.tarwriter, backuptar)
+		}
+		if err == io.ErrClosedPipe {
+			s.failed = true
+			return nil
+		}
+		return err
+	}
+
+	// distribute the members of the backup to the streams that check them
+	readErr := func() error {
+		for {
+			hdr, err := backuptar.Next()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			switch {
+			case strings.HasPrefix(hdr.Name, SnapshotsMetadataDir):
+				parts := strings.SplitN(hdr.Name, "/", 4)
+				if len(parts) < 3 || (len(parts) == 3 && info.BackupVersion != 0) {
+					continue
+				}
+				tenant, label := parts[1], parts[2]
+				id := path.Join(tenant, label)
+				s, ok := snapshots[id]
+				if !ok {
+					logger.WithField("snapshot", id).Info("Verifying snapshot from backup")
+					s = newSnapshotStream(tenant, label)
+					snapshots[id] = s
+					order = append(order, id)
+				}
+				if len(parts) == 3 {
+					// version 0 backups store the snapshot as a single tar
+					if err := write(s, nil); err != nil {
+						return err
+					}
+					continue
+				}
+				hdr.Name = parts[3]
+				if err := write(s, hdr); err != nil {
+					return err
+				}
+			case strings.HasPrefix(hdr.Name, DockerImagesFile):
+				parts := strings.SplitN(hdr.Name, "/", 2)
+				if imageStream == nil {
+					logger.Info("Verifying docker images from backup")
+					imageStream = newImageStream()
+				}
+				if len(parts) == 1 {
+					if info.BackupVersion == 0 {
+						if err := write(imageStream, nil); err != nil {
+							return err
+						}
+					}
+					continue
+				}
+				hdr.Name = parts[1]
+				if err := write(imageStream, hdr); err != nil {
+					return err
+				}
+			default:
+				report.Warnings = append(report.Warnings, fmt.Sprintf("unrecognized file %s", hdr.Name))
+			}
+		}
+	}()
+	if readErr != nil {
+		logger.WithError(readErr).Warn("Could not read backup")
+		report.Errors = append(report.Errors, fmt.Sprintf("could not read backup: %s", readErr))
+	}
+
+	// wait for the checks to finish
+	closeStream := func(s *stream) error {
+		if readErr != nil {
+			s.writer.CloseWithError(readErr)
+		} else {
+			if info.BackupVersion != 0 {
+				s.tarwriter.Close()
+			}
+			s.writer.Close()
+		}
+		return <-s.errc
+	}
+	for _, id := range order {
+		s := snapshots[id]
+		if err := closeStream(s); err != nil {
+			s.report.Error = err.Error()
+		}
+		report.Snapshots = append(report.Snapshots, *s.report)
+	}
+	if imageStream != nil {
+		if err := closeStream(imageStream); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("could not read docker images: %s", err))
+		}
+	} else {
+		report.Errors = append(report.Errors, "backup is missing docker images")
+	}
+
+	// compare the members with the backup metadata
+	found := make(map[string]bool)
+	for _, s := range report.Snapshots {
+		found[s.SnapshotID] = true
+	}
+	for _, snapshot := range info.Snapshots {
+		if !found[snapshot] {
+			report.Errors = append(report.Errors, fmt.Sprintf("backup is missing snapshot %s", snapshot))
+		}
+		delete(found, snapshot)
+	}
+	for snapshot := range found {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("snapshot %s is not in the backup metadata", snapshot))
+	}
+	if images != nil {
+		checked := make(map[string]bool)
+		for _, s := range report.Snapshots {
+			for _, image := range s.Images {
+				if checked[image] {
+					continue
+				}
+				checked[image] = true
+				ir := ImageReport{Image: image}
+				if e, ok := images[imageTag(image)]; !ok {
+					ir.Error = "missing from backup"
+				} else {
+					ir.Error = e
+				}
+				report.Images = append(report.Images, ir)
+			}
+		}
+		for _, image := range info.BaseImages {
+			if checked[image] {
+				continue
+			}
+			checked[image] = true
+			if e, ok := images[imageTag(image)]; !ok {
+				// backups skip base images that cannot be pulled
+				report.Warnings = append(report.Warnings, fmt.Sprintf("base image %s is missing from backup", image))
+			} else {
+				report.Images = append(report.Images, ImageReport{Image: image, Error: e})
+			}
+		}
+	}
+	logger.WithField("valid", report.Valid()).Info("Verified backup")
+	return report, nil
+}
+
+// verifySnapshot imports a snapshot from a backup into a scratch volume and
+// reads its metadata.  The scratch volume is always removed.
+func (dfs *DistributedFilesystem) verifySnapshot(tenant, label string, r io.Reader, report *SnapshotReport) error {
+	scratch := fmt.Sprintf("verify-%s-%d", tenant, time.Now().UnixNano())
+	logger := plog.WithFields(log.Fields{
+		"tenant": tenant,
+		"label":  label,
+		"volume": scratch,
+	})
+	vol, err := dfs.disk.Create(scratch)
+	if err != nil {
+		logger.WithError(err).Error("Could not create scratch volume")
+		return err
+	}
+	defer func() {
+		if err := dfs.disk.Remove(scratch); err != nil {
+			logger.WithError(err).Warn("Could not remove scratch volume")
+		}
+	}()
+
+	// the members of the export are prefixed with the snapshot id, which
+	// changes with the volume.
+	oldID, newID := tenant+"_"+label, scratch+"_"+label
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		pw.CloseWithError(renameTar(r, pw, oldID, newID))
+		close(done)
+	}()
+	err = vol.Import(label, pr)
+	pr.CloseWithError(err)
+	<-done
+	if err != nil {
+		logger.WithError(err).Error("Could not import snapshot into scratch volume")
+		return err
+	}
+
+	rc, err := vol.ReadMetadata(label, ImagesMetadataFile)
+	if err != nil {
+		return fmt.Errorf("could not read images metadata: %s", err)
+	}
+	err = importJSON(rc, &report.Images)
+	rc.Close()
+	if err != nil {
+		return fmt.Errorf("could not interpret images metadata: %s", err)
+	}
+	rc, err = vol.ReadMetadata(label, ServicesMetadataFile)
+	if err != nil {
+		return fmt.Errorf("could not read services metadata: %s", err)
+	}
+	var svcs []service.Service
+	err = importJSON(rc, &svcs)
+	rc.Close()
+	if err != nil {
+		return fmt.Errorf("could not interpret services metadata: %s", err)
+	}
+	report.Services = len(svcs)
+	logger.WithField("services", len(svcs)).Info("Verified snapshot")
+	return nil
+}
+
+// renameTar copies a tar stream, replacing the prefix of the names of its
+// members.
+func renameTar(r io.Reader, w io.Writer, oldPrefix, newPrefix string) error {
+	rename := func(name string) string {
+		if strings.HasPrefix(name, oldPrefix) {
+			return newPrefix + strings.TrimPrefix(name, oldPrefix)
+		}
+		return name
+	}
+	tarIn := tar.NewReader(r)
+	tarOut := tar.NewWriter(w)
+	for {
+		hdr, err := tarIn.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		hdr.Name = rename(hdr.Name)
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = rename(hdr.Linkname)
+		}
+		if err := tarOut.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tarOut, tarIn); err != nil {
+			return err
+		}
+	}
+	return tarOut.Close()
+}
+
+// verifyImageArchive reads an archive written by docker save and returns the
+// images in the archive, mapped to the problem found with each image.  Every
+// layer must be a complete tar and, where the archive has image configs,
+// match the checksums in the config.
+func verifyImageArchive(r io.Reader) (map[string]string, error) {
+	var manifest []struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}
+	var repositories map[string]map[string]string
+	hashes := make(map[string]string)
+	diffIDs := make(map[string][]string)
+	layerErrors := make(map[string]string)
+	files := make(map[string]bool)
+
+	tarIn := tar.NewReader(r)
+	for {
+		hdr, err := tarIn.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		name := path.Clean(hdr.Name)
+		files[name] = true
+		switch {
+		case name == "manifest.json":
+			if err := json.NewDecoder(tarIn).Decode(&manifest); err != nil {
+				return nil, fmt.Errorf("could not interpret image manifest: %s", err)
+			}
+		case name == "repositories":
+			if err := json.NewDecoder(tarIn).Decode(&repositories); err != nil {
+				return nil, fmt.Errorf("could not interpret image repositories: %s", err)
+			}
+		case path.Base(name) == "layer.tar":
+			h := sha256.New()
+			layer := tar.NewReader(io.TeeReader(tarIn, h))
+			for {
+				if _, err := layer.Next(); err == io.EOF {
+					break
+				} else if err != nil {
+					layerErrors[name] = fmt.Sprintf("layer %s is corrupt: %s", name, err)
+					break
+				}
+				if _, err := io.Copy(ioutil.Discard, layer); err != nil {
+					layerErrors[name] = fmt.Sprintf("layer %s is corrupt: %s", name, err)
+					break
+				}
+			}
+			if _, err := io.Copy(h, tarIn); err != nil {
+				return nil, err
+			}
+			hashes[name] = "sha256:" + hex.EncodeToString(h.Sum(nil))
+		case strings.HasSuffix(name, ".json") && !strings.Contains(name, "/"):
+			// image config
+			data, err := ioutil.ReadAll(tarIn)
+			if err != nil {
+				return nil, err
+			}
+			sum := sha256.Sum256(data)
+			hashes[name] = "sha256:" + hex.EncodeToString(sum[:])
+			var config struct {
+				RootFS struct {
+					DiffIDs []string `json:"diff_ids"`
+				} `json:"rootfs"`
+			}
+			if err := json.Unmarshal(data, &config); err == nil {
+				diffIDs[name] = config.RootFS.DiffIDs
+			}
+		}
+	}
+
+	images := make(map[string]string)
+	if manifest != nil {
+		for _, m := range manifest {
+			problem := checkManifestImage(m.Config, m.Layers, hashes, diffIDs[m.Config], layerErrors)
+			for _, tag := range m.RepoTags {
+				images[imageTag(tag)] = problem
+			}
+		}
+		return images, nil
+	}
+	for repo, tags := range repositories {
+		for tag, id := range tags {
+			layer := path.Join(id, "layer.tar")
+			problem := ""
+			if !files[layer] {
+				problem = fmt.Sprintf("layer %s is missing", layer)
+			} else if e := layerErrors[layer]; e != "" {
+				problem = e
+			}
+			images[imageTag(repo+":"+tag)] = problem
+		}
+	}
+	return images, nil
+}
+
+// checkManifestImage checks the config and the layers of an image in a
+// docker save archive.  The config is named after its checksum, and lists
+// the checksums of the layers.
+func checkManifestImage(config string, layers []string, hashes map[string]string, diffIDs []string, layerErrors map[string]string) string {
+	configHash, ok := hashes[config]
+	if !ok {
+		return fmt.Sprintf("config %s is missing", config)
+	}
+	if want := "sha256:" + strings.TrimSuffix(config, ".json"); len(config) == 69 && want != configHash {
+		return fmt.Sprintf("config %s does not match its checksum", config)
+	}
+	for i, layer := range layers {
+		hash, ok := hashes[path.Clean(layer)]
+		if !ok {
+			return fmt.Sprintf("layer %s is missing", layer)
+		} else if e := layerErrors[path.Clean(layer)]; e != "" {
+			return e
+		} else if len(diffIDs) == len(layers) && diffIDs[i] != hash {
+			return fmt.Sprintf("layer %s does not match its checksum", layer)
+		}
+	}
+	return ""
+}
+
+// imageTag normalizes an image name so that names without a tag match the
+// latest tag.
+func imageTag(image string) string {
+	if i := strings.LastIndex(image, ":"); i < 0 || strings.Contains(image[i:], "/") {
+		return image + ":latest"
+	}
+	return image
+}
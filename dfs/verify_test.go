@@ -0,0 +1,199 @@
+// Copyright 2015 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package dfs_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	. "github.com/control-center/serviced/dfs"
+	"github.com/control-center/serviced/domain/service"
+	volumemocks "github.com/control-center/serviced/volume/mocks"
+	"github.com/stretchr/testify/mock"
+	. "gopkg.in/check.v1"
+)
+
+// writeTarFile adds a file to a tar stream
+func writeTarFile(c *C, tarfile *tar.Writer, name string, data []byte) {
+	err := tarfile.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))})
+	c.Assert(err, IsNil)
+	_, err = tarfile.Write(data)
+	c.Assert(err, IsNil)
+}
+
+// imageArchive returns the files of a docker save archive with one image
+func imageArchive(c *C, layer []byte, tags ...string) map[string][]byte {
+	layerSum := sha256.Sum256(layer)
+	config, err := json.Marshal(map[string]interface{}{
+		"rootfs": map[string]interface{}{
+			"type":     "layers",
+			"diff_ids": []string{"sha256:" + hex.EncodeToString(layerSum[:])},
+		},
+	})
+	c.Assert(err, IsNil)
+	configSum := sha256.Sum256(config)
+	configName := hex.EncodeToString(configSum[:]) + ".json"
+	manifest, err := json.Marshal([]map[string]interface{}{
+		{"Config": configName, "RepoTags": tags, "Layers": []string{"abc/layer.tar"}},
+	})
+	c.Assert(err, IsNil)
+	return map[string][]byte{
+		"abc/layer.tar": layer,
+		configName:      config,
+		"manifest.json": manifest,
+	}
+}
+
+// layerTar returns a valid layer
+func layerTar(c *C) []byte {
+	buf := bytes.NewBufferString("")
+	tarfile := tar.NewWriter(buf)
+	writeTarFile(c, tarfile, "etc/hostname", []byte("layer"))
+	c.Assert(tarfile.Close(), IsNil)
+	return buf.Bytes()
+}
+
+func (s *DFSTestSuite) writeVerifyBackup(c *C, info BackupInfo, images map[string][]byte) *bytes.Buffer {
+	buf := bytes.NewBufferString("")
+	tarfile := tar.NewWriter(buf)
+	s.writeBackupInfo(c, tarfile, info)
+	writeTarFile(c, tarfile, path.Join(SnapshotsMetadataDir, "BASE", "LABEL", "BASE_LABEL-volume", "data"), []byte("data"))
+	writeTarFile(c, tarfile, path.Join(SnapshotsMetadataDir, "BASE", "LABEL", "BASE_LABEL-driver"), []byte("rsync"))
+	for _, name := range []string{"abc/layer.tar", "manifest.json"} {
+		if data, ok := images[name]; ok {
+			writeTarFile(c, tarfile, path.Join(DockerImagesFile, name), data)
+			delete(images, name)
+		}
+	}
+	for name, data := range images {
+		writeTarFile(c, tarfile, path.Join(DockerImagesFile, name), data)
+	}
+	c.Assert(tarfile.Close(), IsNil)
+	return buf
+}
+
+// mockScratchVolume sets up a scratch volume for verifying the snapshot of
+// tenant BASE and returns the names of the imported files.
+func (s *DFSTestSuite) mockScratchVolume(c *C, images []string, importErr error) (*volumemocks.Volume, *[]string) {
+	vol := &volumemocks.Volume{}
+	var names []string
+	s.disk.On("Create", mock.AnythingOfType("string")).Return(vol, nil)
+	s.disk.On("Remove", mock.AnythingOfType("string")).Return(nil)
+	vol.On("Import", "LABEL", mock.Anything).Run(func(args mock.Arguments) {
+		if importErr != nil {
+			return
+		}
+		tarfile := tar.NewReader(args.Get(1).(io.Reader))
+		for {
+			hdr, err := tarfile.Next()
+			if err != nil {
+				return
+			}
+			names = append(names, hdr.Name)
+		}
+	}).Return(importErr)
+	imgbuffer := bytes.NewBufferString("")
+	c.Assert(json.NewEncoder(imgbuffer).Encode(images), IsNil)
+	vol.On("ReadMetadata", "LABEL", ImagesMetadataFile).Return(&NopCloser{imgbuffer}, nil)
+	svcbuffer := bytes.NewBufferString("")
+	c.Assert(json.NewEncoder(svcbuffer).Encode([]service.Service{{ID: "s1"}, {ID: "s2"}}), IsNil)
+	vol.On("ReadMetadata", "LABEL", ServicesMetadataFile).Return(&NopCloser{svcbuffer}, nil)
+	return vol, &names
+}
+
+func (s *DFSTestSuite) TestVerifyBackup_NoInfo(c *C) {
+	buf := bytes.NewBufferString("")
+	tarfile := tar.NewWriter(buf)
+	writeTarFile(c, tarfile, DockerImagesFile, []byte{})
+	tarfile.Close()
+	report, err := s.dfs.VerifyBackup(buf)
+	c.Assert(err, Equals, ErrRestoreNoInfo)
+	c.Assert(report, IsNil)
+}
+
+func (s *DFSTestSuite) TestVerifyBackup_Valid(c *C) {
+	info := BackupInfo{
+		BaseImages:    []string{"base/image:1", "skipped/image"},
+		Snapshots:     []string{"BASE_LABEL"},
+		Timestamp:     time.Now().UTC(),
+		BackupVersion: 1,
+	}
+	images := imageArchive(c, layerTar(c), "localhost:5000/BASE/repo:LABEL", "base/image:1")
+	_, names := s.mockScratchVolume(c, []string{"localhost:5000/BASE/repo:LABEL"}, nil)
+
+	report, err := s.dfs.VerifyBackup(s.writeVerifyBackup(c, info, images))
+	c.Assert(err, IsNil)
+	c.Assert(report.Errors, IsNil)
+	c.Assert(report.Valid(), Equals, true)
+	c.Assert(report.Snapshots, HasLen, 1)
+	c.Assert(report.Snapshots[0].SnapshotID, Equals, "BASE_LABEL")
+	c.Assert(report.Snapshots[0].Services, Equals, 2)
+	c.Assert(report.Images, DeepEquals, []ImageReport{
+		{Image: "localhost:5000/BASE/repo:LABEL"},
+		{Image: "base/image:1"},
+	})
+	c.Assert(report.Warnings, DeepEquals, []string{"base image skipped/image is missing from backup"})
+
+	// the snapshot is imported into a scratch volume, which is removed
+	c.Assert(*names, HasLen, 2)
+	for _, name := range *names {
+		c.Assert(strings.HasPrefix(name, "verify-BASE-"), Equals, true)
+		c.Assert(strings.Contains(name, "_LABEL-"), Equals, true)
+	}
+	s.disk.AssertCalled(c, "Remove", s.disk.Calls[0].Arguments.String(0))
+}
+
+func (s *DFSTestSuite) TestVerifyBackup_Corrupt(c *C) {
+	info := BackupInfo{
+		Snapshots:     []string{"BASE_LABEL", "OTHER_LABEL"},
+		Timestamp:     time.Now().UTC(),
+		BackupVersion: 1,
+	}
+	images := imageArchive(c, []byte("not a layer"), "localhost:5000/BASE/repo:LABEL")
+	s.mockScratchVolume(c, []string{"localhost:5000/BASE/repo:LABEL", "localhost:5000/BASE/missing:LABEL"}, nil)
+
+	report, err := s.dfs.VerifyBackup(s.writeVerifyBackup(c, info, images))
+	c.Assert(err, IsNil)
+	c.Assert(report.Valid(), Equals, false)
+	c.Assert(report.Errors, DeepEquals, []string{"backup is missing snapshot OTHER_LABEL"})
+	c.Assert(report.Images, HasLen, 2)
+	c.Assert(report.Images[0].Error, Matches, "layer abc/layer.tar is corrupt.*")
+	c.Assert(report.Images[1].Error, Equals, "missing from backup")
+}
+
+func (s *DFSTestSuite) TestVerifyBackup_ImportFailed(c *C) {
+	info := BackupInfo{
+		Snapshots:     []string{"BASE_LABEL"},
+		Timestamp:     time.Now().UTC(),
+		BackupVersion: 1,
+	}
+	images := imageArchive(c, layerTar(c), "localhost:5000/BASE/repo:LABEL")
+	s.mockScratchVolume(c, nil, ErrTestBadSnapshot)
+
+	report, err := s.dfs.VerifyBackup(s.writeVerifyBackup(c, info, images))
+	c.Assert(err, IsNil)
+	c.Assert(report.Valid(), Equals, false)
+	c.Assert(report.Snapshots, HasLen, 1)
+	c.Assert(report.Snapshots[0].Error, Equals, ErrTestBadSnapshot.Error())
+	s.disk.AssertCalled(c, "Remove", s.disk.Calls[0].Arguments.String(0))
+}
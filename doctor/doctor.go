@@ -0,0 +1,582 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package doctor finds the places where the coordinator has drifted from the
+// datastore, such as nodes left behind by deleted services and hosts,
+// incongruent instance states and public endpoints that point at services
+// that no longer exist.
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/coordinator/client"
+	"github.com/control-center/serviced/logging"
+	zkr "github.com/control-center/serviced/zzk/registry"
+	zks "github.com/control-center/serviced/zzk/service"
+)
+
+// initialize the package logger
+var plog = logging.PackageLogger()
+
+// ErrResolved is returned when an issue went away before it was repaired
+var ErrResolved = errors.New("issue is no longer present")
+
+// Severity describes how much an issue matters
+type Severity int
+
+const (
+	// Info issues are harmless leftovers
+	Info Severity = iota
+	// Warning issues can confuse users or tools, but do not affect running
+	// services
+	Warning
+	// Error issues affect scheduling or routing
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return "unknown"
+}
+
+// Fix is the action that repairs an issue
+type Fix int
+
+const (
+	// FixNone means the issue cannot be repaired automatically
+	FixNone Fix = iota
+	// FixDeleteNode deletes the coordinator node at the path of the issue
+	FixDeleteNode
+	// FixDeleteState deletes the host and service nodes of an instance
+	FixDeleteState
+	// FixSyncPool writes the pool from the datastore to the coordinator
+	FixSyncPool
+	// FixSyncHost writes the host from the datastore to the coordinator
+	FixSyncHost
+	// FixSyncService writes the service from the datastore to the
+	// coordinator
+	FixSyncService
+)
+
+// Issue is an inconsistency between the datastore and the coordinator
+type Issue struct {
+	Severity Severity
+	Kind     string // pool, host, service, state, port, vhost or export
+	ID       string // id of the entity the issue is about
+	PoolID   string
+	TenantID string // set if repairing the issue requires the tenant lock
+	Path     string // path of the coordinator node, if there is one
+	Message  string
+	Fix      Fix
+	Repaired bool
+	Resolved bool   // the issue was gone by the time it was to be repaired
+	Error    string // why the repair failed
+}
+
+func (issue Issue) String() string {
+	return fmt.Sprintf("%s %s %s: %s", issue.Severity, issue.Kind, issue.ID, issue.Message)
+}
+
+// Report is the outcome of a check
+type Report struct {
+	Issues   []Issue
+	Repaired bool // whether repairs were attempted
+}
+
+// Count returns the number of issues with at least the given severity
+func (r Report) Count(severity Severity) (count int) {
+	for _, issue := range r.Issues {
+		if issue.Severity >= severity {
+			count++
+		}
+	}
+	return
+}
+
+// Service is what the checks need to know about a service in the datastore
+type Service struct {
+	ID           string
+	PoolID       string
+	TenantID     string
+	DesiredState int
+	PublicPorts  []string // enabled public port addresses
+	VHosts       []string // enabled virtual host subdomains
+}
+
+// State is the part of the datastore that is mirrored into the coordinator
+type State struct {
+	Pools    map[string]struct{} // pool ids
+	Hosts    map[string]string   // host id to pool id
+	Services map[string]Service  // service id to service
+}
+
+// NewState returns an empty state
+func NewState() State {
+	return State{
+		Pools:    make(map[string]struct{}),
+		Hosts:    make(map[string]string),
+		Services: make(map[string]Service),
+	}
+}
+
+// tenants returns the set of tenant ids in the state
+func (s State) tenants() map[string]struct{} {
+	tenants := make(map[string]struct{})
+	for _, svc := range s.Services {
+		tenants[svc.TenantID] = struct{}{}
+	}
+	return tenants
+}
+
+// Check walks the coordinator and reports every place it disagrees with the
+// datastore state.  The connection must be rooted at "/".
+func Check(conn client.Connection, state State) ([]Issue, error) {
+	c := &checker{conn: conn, state: state}
+	for _, check := range []func() error{c.pools, c.registry, c.exports} {
+		if err := check(); err != nil {
+			return nil, err
+		}
+	}
+	sort.Stable(bySeverity(c.issues))
+	return c.issues, nil
+}
+
+// bySeverity sorts issues with the most severe first
+type bySeverity []Issue
+
+func (s bySeverity) Len() int           { return len(s) }
+func (s bySeverity) Less(i, j int) bool { return s[i].Severity > s[j].Severity }
+func (s bySeverity) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type checker struct {
+	conn   client.Connection
+	state  State
+	issues []Issue
+}
+
+func (c *checker) add(issue Issue) {
+	plog.WithFields(log.Fields{
+		"severity": issue.Severity,
+		"kind":     issue.Kind,
+		"id":       issue.ID,
+		"zkpath":   issue.Path,
+	}).Debug(issue.Message)
+	c.issues = append(c.issues, issue)
+}
+
+// children returns the children of a node, or nothing if the node does not
+// exist
+func (c *checker) children(pth string) ([]string, error) {
+	ch, err := c.conn.Children(pth)
+	if err == client.ErrNoNode {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not look up %s: %s", pth, err)
+	}
+	return ch, nil
+}
+
+// pools compares the pools and everything under them
+func (c *checker) pools() error {
+	poolIDs, err := c.children("/pools")
+	if err != nil {
+		return err
+	}
+	found := make(map[string]bool)
+	for _, poolID := range poolIDs {
+		found[poolID] = true
+		if _, ok := c.state.Pools[poolID]; !ok {
+			c.add(Issue{
+				Severity: Warning,
+				Kind:     "pool",
+				ID:       poolID,
+				PoolID:   poolID,
+				Path:     path.Join("/pools", poolID),
+				Message:  "pool was deleted but is still in the coordinator",
+				Fix:      FixDeleteNode,
+			})
+			continue
+		}
+		if err := c.hosts(poolID); err != nil {
+			return err
+		}
+		if err := c.services(poolID); err != nil {
+			return err
+		}
+	}
+	for poolID := range c.state.Pools {
+		if !found[poolID] {
+			c.add(Issue{
+				Severity: Error,
+				Kind:     "pool",
+				ID:       poolID,
+				PoolID:   poolID,
+				Message:  "pool is missing from the coordinator",
+				Fix:      FixSyncPool,
+			})
+		}
+	}
+	return nil
+}
+
+// hosts compares the hosts of a pool and their instances
+func (c *checker) hosts(poolID string) error {
+	hpth := path.Join("/pools", poolID, "hosts")
+	hostIDs, err := c.children(hpth)
+	if err != nil {
+		return err
+	}
+	found := make(map[string]bool)
+	for _, hostID := range hostIDs {
+		if p, ok := c.state.Hosts[hostID]; !ok || p != poolID {
+			msg := "host was deleted but is still in the coordinator"
+			if ok {
+				msg = fmt.Sprintf("host moved to pool %s but is still in this pool in the coordinator", p)
+			}
+			c.add(Issue{
+				Severity: Error,
+				Kind:     "host",
+				ID:       hostID,
+				PoolID:   poolID,
+				Path:     path.Join(hpth, hostID),
+				Message:  msg,
+				Fix:      FixDeleteNode,
+			})
+			continue
+		}
+		found[hostID] = true
+		stateIDs, err := c.children(path.Join(hpth, hostID, "instances"))
+		if err != nil {
+			return err
+		}
+		for _, stateID := range stateIDs {
+			if err := c.instance(poolID, path.Join(hpth, hostID, "instances", stateID), stateID); err != nil {
+				return err
+			}
+		}
+	}
+	for hostID, p := range c.state.Hosts {
+		if p == poolID && !found[hostID] {
+			c.add(Issue{
+				Severity: Error,
+				Kind:     "host",
+				ID:       hostID,
+				PoolID:   poolID,
+				Message:  "host is missing from the coordinator",
+				Fix:      FixSyncHost,
+			})
+		}
+	}
+	return nil
+}
+
+// services compares the services of a pool and their instances
+func (c *checker) services(poolID string) error {
+	spth := path.Join("/pools", poolID, "services")
+	serviceIDs, err := c.children(spth)
+	if err != nil {
+		return err
+	}
+	found := make(map[string]bool)
+	for _, serviceID := range serviceIDs {
+		svc, ok := c.state.Services[serviceID]
+		if !ok || svc.PoolID != poolID {
+			msg := "service was deleted but is still in the coordinator"
+			if ok {
+				msg = fmt.Sprintf("service moved to pool %s but is still in this pool in the coordinator", svc.PoolID)
+			}
+			c.add(Issue{
+				Severity: Error,
+				Kind:     "service",
+				ID:       serviceID,
+				PoolID:   poolID,
+				TenantID: c.tenantOf(serviceID),
+				Path:     path.Join(spth, serviceID),
+				Message:  msg,
+				Fix:      FixDeleteNode,
+			})
+			continue
+		}
+		found[serviceID] = true
+
+		node := &zks.ServiceNode{}
+		if err := c.conn.Get(path.Join(spth, serviceID), node); err != nil && err != client.ErrNoNode {
+			return fmt.Errorf("could not look up service %s: %s", serviceID, err)
+		} else if err == nil && node.DesiredState != svc.DesiredState {
+			c.add(Issue{
+				Severity: Warning,
+				Kind:     "service",
+				ID:       serviceID,
+				PoolID:   poolID,
+				TenantID: svc.TenantID,
+				Path:     path.Join(spth, serviceID),
+				Message:  fmt.Sprintf("desired state is %d in the coordinator but %d in the datastore", node.DesiredState, svc.DesiredState),
+				Fix:      FixSyncService,
+			})
+		}
+
+		stateIDs, err := c.children(path.Join(spth, serviceID))
+		if err != nil {
+			return err
+		}
+		for _, stateID := range stateIDs {
+			if err := c.instance(poolID, path.Join(spth, serviceID, stateID), stateID); err != nil {
+				return err
+			}
+		}
+	}
+	for serviceID, svc := range c.state.Services {
+		if svc.PoolID == poolID && !found[serviceID] {
+			c.add(Issue{
+				Severity: Error,
+				Kind:     "service",
+				ID:       serviceID,
+				PoolID:   poolID,
+				TenantID: svc.TenantID,
+				Message:  "service is missing from the coordinator",
+				Fix:      FixSyncService,
+			})
+		}
+	}
+	return nil
+}
+
+// instance checks that an instance has both a host state and a service state
+func (c *checker) instance(poolID, pth, stateID string) error {
+	hostID, serviceID, instanceID, err := zks.ParseStateID(stateID)
+	if err != nil {
+		c.add(Issue{
+			Severity: Warning,
+			Kind:     "state",
+			ID:       stateID,
+			PoolID:   poolID,
+			Path:     pth,
+			Message:  "instance state has an invalid id",
+			Fix:      FixDeleteNode,
+		})
+		return nil
+	}
+	req := zks.StateRequest{
+		PoolID:     poolID,
+		HostID:     hostID,
+		ServiceID:  serviceID,
+		InstanceID: instanceID,
+	}
+	if ok, err := zks.IsValidState(c.conn, req); err != nil {
+		return err
+	} else if !ok {
+		c.add(Issue{
+			Severity: Error,
+			Kind:     "state",
+			ID:       stateID,
+			PoolID:   poolID,
+			TenantID: c.tenantOf(serviceID),
+			Path:     pth,
+			Message:  "instance state is missing its host state, service state or status",
+			Fix:      FixDeleteState,
+		})
+	}
+	return nil
+}
+
+// tenantOf returns the tenant of a service.  A service that is no longer in
+// the datastore is traced through the parents recorded on the service nodes
+// in the coordinator until it reaches a service the datastore still has or a
+// node without a parent.  Nodes written before parents were recorded look
+// like tenants.  It returns "" if the chain is broken.
+func (c *checker) tenantOf(serviceID string) string {
+	seen := make(map[string]bool)
+	for id := serviceID; !seen[id]; {
+		seen[id] = true
+		if svc, ok := c.state.Services[id]; ok {
+			return svc.TenantID
+		}
+		node, err := c.serviceNode(id)
+		if err != nil || node == nil {
+			return ""
+		} else if node.ParentID == "" {
+			return id
+		}
+		id = node.ParentID
+	}
+	return ""
+}
+
+// serviceNode looks up a service node in any pool, or returns nil if there
+// is none.  Child services are not always in the pool of their parent.
+func (c *checker) serviceNode(serviceID string) (*zks.ServiceNode, error) {
+	poolIDs, err := c.children("/pools")
+	if err != nil {
+		return nil, err
+	}
+	for _, poolID := range poolIDs {
+		node := &zks.ServiceNode{}
+		if err := c.conn.Get(path.Join("/pools", poolID, "services", serviceID), node); err == nil {
+			return node, nil
+		} else if err != client.ErrNoNode {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// registry compares the public ports and virtual hosts
+func (c *checker) registry() error {
+	enabled := func(list []string, value string) bool {
+		for _, v := range list {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+
+	ports, err := zkr.GetPublicPorts(c.conn)
+	if err != nil {
+		return err
+	}
+	for key, port := range ports {
+		svc, ok := c.state.Services[port.ServiceID]
+		if ok && enabled(svc.PublicPorts, key.PortAddress) {
+			continue
+		}
+		msg := "public port points at a deleted service"
+		if ok {
+			msg = fmt.Sprintf("public port is not enabled on service %s", port.ServiceID)
+		}
+		c.add(Issue{
+			Severity: Error,
+			Kind:     "port",
+			ID:       key.PortAddress,
+			TenantID: port.TenantID,
+			Path:     path.Join("/net/pub", key.HostID, key.PortAddress),
+			Message:  msg,
+			Fix:      FixDeleteNode,
+		})
+	}
+
+	vhosts, err := zkr.GetVHosts(c.conn)
+	if err != nil {
+		return err
+	}
+	for key, vhost := range vhosts {
+		svc, ok := c.state.Services[vhost.ServiceID]
+		if ok && enabled(svc.VHosts, key.Subdomain) {
+			continue
+		}
+		msg := "virtual host points at a deleted service"
+		if ok {
+			msg = fmt.Sprintf("virtual host is not enabled on service %s", vhost.ServiceID)
+		}
+		c.add(Issue{
+			Severity: Error,
+			Kind:     "vhost",
+			ID:       key.Subdomain,
+			TenantID: vhost.TenantID,
+			Path:     path.Join("/net/vhost", key.HostID, key.Subdomain),
+			Message:  msg,
+			Fix:      FixDeleteNode,
+		})
+	}
+	return nil
+}
+
+// exports looks for exported endpoints of deleted tenants and applications
+// that nothing exports anymore
+func (c *checker) exports() error {
+	tenants := c.state.tenants()
+	tenantIDs, err := c.children("/net/export")
+	if err != nil {
+		return err
+	}
+	for _, tenantID := range tenantIDs {
+		tpth := path.Join("/net/export", tenantID)
+		if _, ok := tenants[tenantID]; !ok {
+			c.add(Issue{
+				Severity: Warning,
+				Kind:     "export",
+				ID:       tenantID,
+				TenantID: tenantID,
+				Path:     tpth,
+				Message:  "exports belong to a deleted tenant",
+				Fix:      FixDeleteNode,
+			})
+			continue
+		}
+		applications, err := c.children(tpth)
+		if err != nil {
+			return err
+		}
+		for _, application := range applications {
+			exports, err := c.children(path.Join(tpth, application))
+			if err != nil {
+				return err
+			} else if len(exports) == 0 {
+				c.add(Issue{
+					Severity: Info,
+					Kind:     "export",
+					ID:       application,
+					TenantID: tenantID,
+					Path:     path.Join(tpth, application),
+					Message:  "no instance exports the application",
+					Fix:      FixDeleteNode,
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// Repair fixes an issue that only involves the coordinator.  Issues that
+// need the datastore (the sync fixes) are left to the caller.  It returns
+// ErrResolved if the instance state of a FixDeleteState issue is now valid.
+func Repair(conn client.Connection, issue Issue) error {
+	switch issue.Fix {
+	case FixDeleteNode:
+		if err := conn.Delete(issue.Path); err != nil && err != client.ErrNoNode {
+			return err
+		}
+		return nil
+	case FixDeleteState:
+		hostID, serviceID, instanceID, err := zks.ParseStateID(issue.ID)
+		if err != nil {
+			return err
+		}
+		req := zks.StateRequest{
+			PoolID:     issue.PoolID,
+			HostID:     hostID,
+			ServiceID:  serviceID,
+			InstanceID: instanceID,
+		}
+		// the instance may have finished starting since the check
+		if ok, err := zks.IsValidState(conn, req); err != nil {
+			return err
+		} else if ok {
+			return ErrResolved
+		}
+		return zks.DeleteState(conn, req)
+	}
+	return fmt.Errorf("%s %s cannot be repaired in the coordinator alone", issue.Kind, issue.ID)
+}
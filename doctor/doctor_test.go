@@ -0,0 +1,253 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package doctor
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/control-center/serviced/coordinator/client"
+	zkr "github.com/control-center/serviced/zzk/registry"
+	zks "github.com/control-center/serviced/zzk/service"
+)
+
+// fakeConn is an in-memory coordinator with just enough of client.Connection
+// for the checks
+type fakeConn struct {
+	client.Connection
+	nodes map[string][]byte
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{nodes: map[string][]byte{"/": nil}}
+}
+
+func (c *fakeConn) add(pth string, node interface{}) {
+	for p := pth; p != "/"; p = path.Dir(p) {
+		if _, ok := c.nodes[p]; !ok {
+			c.nodes[p] = nil
+		}
+	}
+	if node != nil {
+		c.nodes[pth], _ = json.Marshal(node)
+	}
+}
+
+func (c *fakeConn) Exists(pth string) (bool, error) {
+	_, ok := c.nodes[pth]
+	return ok, nil
+}
+
+func (c *fakeConn) Children(pth string) ([]string, error) {
+	if _, ok := c.nodes[pth]; !ok {
+		return nil, client.ErrNoNode
+	}
+	children := []string{}
+	for p := range c.nodes {
+		if p != "/" && path.Dir(p) == pth {
+			children = append(children, path.Base(p))
+		}
+	}
+	sort.Strings(children)
+	return children, nil
+}
+
+func (c *fakeConn) Get(pth string, node client.Node) error {
+	data, ok := c.nodes[pth]
+	if !ok {
+		return client.ErrNoNode
+	} else if data != nil {
+		return json.Unmarshal(data, node)
+	}
+	return nil
+}
+
+func (c *fakeConn) Delete(pth string) error {
+	if _, ok := c.nodes[pth]; !ok {
+		return client.ErrNoNode
+	}
+	for p := range c.nodes {
+		if p == pth || strings.HasPrefix(p, pth+"/") {
+			delete(c.nodes, p)
+		}
+	}
+	return nil
+}
+
+func (c *fakeConn) NewTransaction() client.Transaction {
+	return &fakeTx{conn: c}
+}
+
+type fakeTx struct {
+	client.Transaction
+	conn    *fakeConn
+	deletes []string
+}
+
+func (t *fakeTx) Delete(pth string) client.Transaction {
+	t.deletes = append(t.deletes, pth)
+	return t
+}
+
+func (t *fakeTx) Commit() error {
+	for _, pth := range t.deletes {
+		t.conn.Delete(pth)
+	}
+	return nil
+}
+
+func setUp() (*fakeConn, State) {
+	state := NewState()
+	state.Pools["default"] = struct{}{}
+	state.Hosts["h1"] = "default"
+	state.Hosts["h2"] = "default"
+	state.Services["t1"] = Service{ID: "t1", PoolID: "default", TenantID: "t1", DesiredState: 1, PublicPorts: []string{":8080"}, VHosts: []string{"app"}}
+	state.Services["s2"] = Service{ID: "s2", PoolID: "default", TenantID: "t1"}
+
+	conn := newFakeConn()
+	conn.add("/pools/gone", nil)
+	conn.add("/pools/default/hosts/h1/instances/h1-t1-0", nil)
+	conn.add("/pools/default/services/t1/h1-t1-0/current", nil)
+	conn.add("/pools/default/hosts/h1/instances/h1-s2-0", nil)
+	conn.add("/pools/default/hosts/h9", nil)
+	conn.add("/pools/default/services/t1", &zks.ServiceNode{ID: "t1", DesiredState: 1})
+	conn.add("/pools/default/services/s2", &zks.ServiceNode{ID: "s2", DesiredState: 1})
+	conn.add("/pools/default/services/s9", &zks.ServiceNode{ID: "s9"})
+	conn.add("/net/pub/master/:8080", &zkr.PublicPort{TenantID: "t1", ServiceID: "t1"})
+	conn.add("/net/pub/master/:9090", &zkr.PublicPort{TenantID: "t9", ServiceID: "s9"})
+	conn.add("/net/vhost/master/app", &zkr.VHost{TenantID: "t1", ServiceID: "t1"})
+	conn.add("/net/vhost/master/old", &zkr.VHost{TenantID: "t1", ServiceID: "t1"})
+	conn.add("/net/export/t1/mysql/t1-mysql-0", nil)
+	conn.add("/net/export/t1/zope", nil)
+	conn.add("/net/export/t9/mysql", nil)
+	return conn, state
+}
+
+func summarize(issues []Issue) []string {
+	result := []string{}
+	for _, issue := range issues {
+		result = append(result, issue.Severity.String()+" "+issue.Kind+" "+issue.ID)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestCheck(t *testing.T) {
+	conn, state := setUp()
+	issues, err := Check(conn, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"error host h2",
+		"error host h9",
+		"error port :9090",
+		"error service s9",
+		"error state h1-s2-0",
+		"error vhost old",
+		"info export zope",
+		"warning export t9",
+		"warning pool gone",
+		"warning service s2",
+	}
+	if actual := summarize(issues); strings.Join(actual, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected issues %v, got %v", expected, actual)
+	}
+	for i := 1; i < len(issues); i++ {
+		if issues[i].Severity > issues[i-1].Severity {
+			t.Errorf("Issues are not sorted by severity: %v", issues)
+			break
+		}
+	}
+}
+
+func TestRepair(t *testing.T) {
+	conn, state := setUp()
+	issues, err := Check(conn, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range issues {
+		err := Repair(conn, issue)
+		switch issue.Fix {
+		case FixDeleteNode, FixDeleteState:
+			if err != nil {
+				t.Errorf("Could not repair %s: %s", issue, err)
+			}
+		default:
+			if err == nil {
+				t.Errorf("Expected an error repairing %s", issue)
+			}
+		}
+	}
+
+	// only the issues that need the datastore are left
+	issues, err = Check(conn, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"error host h2", "warning service s2"}
+	if actual := summarize(issues); strings.Join(actual, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected issues %v, got %v", expected, actual)
+	}
+	if ok, _ := conn.Exists("/pools/default/hosts/h1/instances/h1-t1-0"); !ok {
+		t.Errorf("Valid instance state was deleted")
+	}
+}
+
+func TestTenantOfDeletedService(t *testing.T) {
+	conn, state := setUp()
+	conn.add("/pools/default/services/s9", &zks.ServiceNode{ID: "s9", ParentID: "s8"})
+	conn.add("/pools/other/services/s8", &zks.ServiceNode{ID: "s8", ParentID: "s2"})
+	conn.add("/pools/default/services/s7", &zks.ServiceNode{ID: "s7", ParentID: "s6"})
+	conn.add("/pools/default/services/s6", &zks.ServiceNode{ID: "s6"})
+	conn.add("/pools/default/services/s5", &zks.ServiceNode{ID: "s5", ParentID: "missing"})
+	c := &checker{conn: conn, state: state}
+	for serviceID, expected := range map[string]string{
+		"s2": "t1", // in the datastore
+		"s9": "t1", // parent chain reaches s2 through another pool
+		"s7": "s6", // whole tenant was deleted
+		"s5": "",   // parent is gone from both
+	} {
+		if actual := c.tenantOf(serviceID); actual != expected {
+			t.Errorf("Expected tenant %q for %s, got %q", expected, serviceID, actual)
+		}
+	}
+}
+
+func TestRepairResolvedState(t *testing.T) {
+	conn, _ := setUp()
+	issue := Issue{Kind: "state", ID: "h1-t1-0", PoolID: "default", Fix: FixDeleteState}
+	if err := Repair(conn, issue); err != ErrResolved {
+		t.Errorf("Expected %s, got %v", ErrResolved, err)
+	}
+	if ok, _ := conn.Exists("/pools/default/hosts/h1/instances/h1-t1-0"); !ok {
+		t.Errorf("Valid instance state was deleted")
+	}
+}
+
+func TestReportCount(t *testing.T) {
+	report := Report{Issues: []Issue{{Severity: Info}, {Severity: Warning}, {Severity: Error}, {Severity: Error}}}
+	if n := report.Count(Info); n != 4 {
+		t.Errorf("Expected 4 issues, got %d", n)
+	}
+	if n := report.Count(Error); n != 2 {
+		t.Errorf("Expected 2 errors, got %d", n)
+	}
+}
@@ -15,7 +15,6 @@ package host
 
 import (
 	"errors"
-	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
@@ -57,7 +56,7 @@ type Host struct {
 	Cores           int    // Number of cores available to serviced
 	Memory          uint64 // Amount of RAM (bytes) available to serviced
 	CoresCommitment int    // Number of CPU shares (cores) allocated by the user
-	RAMCommitment   uint64 // DEPRECATED: Amount of RAM (bytes) allocated by the user
+	RAMCommitment   uint64 // DEPRECATED: Amount of RAM (bytes) allocated by the user, migrated to RAMLimit
 	RAMLimit        string // Amount of RAM (size, %) allocated by the user
 	PrivateNetwork  string // The private network where containers run, eg 172.16.42.0/24
 	CreatedAt       time.Time
@@ -76,6 +75,9 @@ type Host struct {
 	MonitoringProfile domain.MonitorProfile
 	datastore.VersionedEntity
 	NatIP string
+	// MuxCertificateIssued is set once the master has issued the host a mux
+	// certificate. Until then, muxes accept the host's calls without one.
+	MuxCertificateIssued bool
 }
 
 //ReadHost is a minimal representation of hosts.
@@ -111,11 +113,7 @@ type HostStatus struct {
 func (a *Host) TotalRAM() (mem uint64) {
 	if a.RAMLimit != "" {
 		mem, _ = GetRAMLimit(a.RAMLimit, a.Memory)
-	} else {
-		a.RAMLimit = fmt.Sprintf("%d", a.RAMCommitment)
-		mem = a.RAMCommitment
 	}
-	a.RAMCommitment = 0
 	if mem > 0 && mem < a.Memory {
 		return
 	}
@@ -0,0 +1,69 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package host
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/control-center/serviced/datastore/migration"
+)
+
+func init() {
+	migration.Register(migration.Migration{
+		Kind:        kind,
+		Version:     1,
+		Description: "Replace RAMCommitment with RAMLimit",
+		Up:          ramCommitmentToLimit,
+		Down:        ramLimitToCommitment,
+	})
+}
+
+// ramCommitmentToLimit moves the deprecated RAMCommitment of a host to its
+// RAMLimit, unless a RAMLimit has already been set.
+func ramCommitmentToLimit(e migration.Entity) (bool, error) {
+	commitment, err := ramCommitment(e)
+	if err != nil || commitment == 0 {
+		return false, err
+	}
+	if limit, _ := e["RAMLimit"].(string); limit == "" {
+		e["RAMLimit"] = strconv.FormatUint(commitment, 10)
+	}
+	e["RAMCommitment"] = 0
+	return true, nil
+}
+
+// ramLimitToCommitment moves the RAMLimit of a host back to RAMCommitment if
+// it is a number of bytes; percentages and sizes have no RAMCommitment
+// equivalent and are left alone.
+func ramLimitToCommitment(e migration.Entity) (bool, error) {
+	limit, _ := e["RAMLimit"].(string)
+	commitment, err := strconv.ParseUint(limit, 10, 64)
+	if err != nil {
+		return false, nil
+	}
+	e["RAMCommitment"] = commitment
+	e["RAMLimit"] = ""
+	return true, nil
+}
+
+func ramCommitment(e migration.Entity) (uint64, error) {
+	switch v := e["RAMCommitment"].(type) {
+	case json.Number:
+		return strconv.ParseUint(v.String(), 10, 64)
+	case float64:
+		return uint64(v), nil
+	}
+	return 0, nil
+}
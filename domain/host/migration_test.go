@@ -0,0 +1,50 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package host
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/control-center/serviced/datastore/migration"
+)
+
+func TestRAMCommitmentMigration(t *testing.T) {
+	e := migration.Entity{"RAMCommitment": json.Number("1024"), "RAMLimit": ""}
+	if changed, err := ramCommitmentToLimit(e); err != nil || !changed {
+		t.Fatalf("Expected a change, got %v, %v", changed, err)
+	}
+	if e["RAMLimit"] != "1024" || e["RAMCommitment"] != 0 {
+		t.Errorf("Unexpected entity %v", e)
+	}
+	if changed, _ := ramCommitmentToLimit(e); changed {
+		t.Errorf("Expected migrating twice to change nothing")
+	}
+
+	// an existing limit wins
+	e = migration.Entity{"RAMCommitment": json.Number("1024"), "RAMLimit": "50%"}
+	if changed, _ := ramCommitmentToLimit(e); !changed || e["RAMLimit"] != "50%" {
+		t.Errorf("Unexpected entity %v", e)
+	}
+
+	if changed, _ := ramLimitToCommitment(e); changed {
+		t.Errorf("Expected a percentage to be left alone")
+	}
+	e = migration.Entity{"RAMCommitment": 0, "RAMLimit": "2048"}
+	if changed, _ := ramLimitToCommitment(e); !changed || e["RAMCommitment"] != uint64(2048) || e["RAMLimit"] != "" {
+		t.Errorf("Unexpected entity %v", e)
+	}
+}
@@ -53,6 +53,7 @@ type ResourcePool struct {
 	MemoryCapacity    uint64      // Amount (bytes) of RAM available as a sum of all memory on all hosts in the pool
 	MemoryCommitment  uint64      // Amount (bytes) of RAM committed to services
 	ConnectionTimeout int         // Wait delay on service rescheduling when an outage is reported (milliseconds)
+	Registry          string      // Docker registry (host:port[/namespace]) the pool's hosts pull tenant images from; empty uses the master's
 	CreatedAt         time.Time
 	UpdatedAt         time.Time
 	MonitoringProfile domain.MonitorProfile
@@ -125,6 +126,9 @@ func (a *ResourcePool) Equals(b *ResourcePool) bool {
 	if a.MemoryCommitment != b.MemoryCommitment {
 		return false
 	}
+	if a.Registry != b.Registry {
+		return false
+	}
 	if a.CreatedAt.Unix() != b.CreatedAt.Unix() {
 		return false
 	}
@@ -107,6 +107,21 @@ func (s *S) Test_ValidateConnectionTimeout(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (s *S) Test_ValidateRegistry(c *C) {
+	defer s.ps.Delete(s.ctx, Key("Test_GetPools1"))
+	pool := New("Test_GetPools1")
+	pool.Realm = "test_realm1"
+	for _, registry := range []string{"https://registry:5000", "registry:5000/", " registry:5000"} {
+		pool.Registry = registry
+		err := s.ps.Put(s.ctx, Key(pool.ID), pool)
+		c.Assert(err, NotNil)
+	}
+
+	pool.Registry = "registry:5000/serviced"
+	err := s.ps.Put(s.ctx, Key(pool.ID), pool)
+	c.Assert(err, IsNil)
+}
+
 func (s *S) Test_GetPools(t *C) {
 	defer s.ps.Delete(s.ctx, Key("Test_GetPools1"))
 	defer s.ps.Delete(s.ctx, Key("Test_GetPools2"))
@@ -37,6 +37,13 @@ func (p *ResourcePool) ValidEntity() error {
 		violations.Add(validation.NewViolation(fmt.Sprintf("connection timeout cannot be less than 0")))
 	}
 
+	if p.Registry != "" {
+		violations.Add(validation.StringsEqual(p.Registry, strings.TrimSpace(p.Registry), "leading and trailing spaces not allowed for pool registry"))
+		if strings.Contains(p.Registry, "://") || strings.HasSuffix(p.Registry, "/") {
+			violations.Add(validation.NewViolation(fmt.Sprintf("pool registry %s must be HOST:PORT[/NAMESPACE]", p.Registry)))
+		}
+	}
+
 	if len(violations.Errors) > 0 {
 		return violations
 	}
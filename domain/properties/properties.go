@@ -19,12 +19,18 @@
 package properties
 
 import (
+	"strconv"
+
 	"github.com/control-center/serviced/datastore"
 )
 
 // CCVERSION is the key used to access the version property
 const CCVERSION = "cc.version"
 
+// SCHEMAVERSION is the prefix of the keys holding the schema version of each
+// entity kind
+const SCHEMAVERSION = "schema.version."
+
 // New create a new StoredProperties
 func New() *StoredProperties {
 	return &StoredProperties{Props: make(map[string]string)}
@@ -46,3 +52,15 @@ func (s *StoredProperties) CCVersion() (string, bool) {
 func (s *StoredProperties) SetCCVersion(version string) {
 	s.Props[CCVERSION] = version
 }
+
+// SchemaVersion returns the schema version the entities of a kind have been
+// migrated to, which is 0 if they have never been migrated
+func (s *StoredProperties) SchemaVersion(kind string) int {
+	version, _ := strconv.Atoi(s.Props[SCHEMAVERSION+kind])
+	return version
+}
+
+// SetSchemaVersion sets the schema version of the entities of a kind
+func (s *StoredProperties) SetSchemaVersion(kind string, version int) {
+	s.Props[SCHEMAVERSION+kind] = strconv.Itoa(version)
+}
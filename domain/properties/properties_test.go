@@ -0,0 +1,38 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package properties
+
+import (
+	"testing"
+)
+
+func TestSchemaVersion(t *testing.T) {
+	props := New()
+	if v := props.SchemaVersion("host"); v != 0 {
+		t.Errorf("Expected version 0 for an unmigrated kind, got %d", v)
+	}
+	props.SetSchemaVersion("host", 3)
+	props.SetCCVersion("1.2.0")
+	if v := props.SchemaVersion("host"); v != 3 {
+		t.Errorf("Expected version 3, got %d", v)
+	}
+	if v := props.SchemaVersion("service"); v != 0 {
+		t.Errorf("Expected version 0 for another kind, got %d", v)
+	}
+	if v, _ := props.CCVersion(); v != "1.2.0" {
+		t.Errorf("Schema version changed the CC version: %s", v)
+	}
+}
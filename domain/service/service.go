@@ -268,6 +268,14 @@ type Service struct {
 	// EmergencyShutdown is a flag that indicates whether this service has been shutdown due
 	// to an emergency (low-storage) situation.  Services with this flag set can not be started
 	EmergencyShutdown bool
+	// StorageQuota is the most space that the application may use on the
+	// distributed filesystem.  It is only set on the tenant service, and is
+	// enforced by the volume driver.  0 means there is no quota.
+	StorageQuota utils.EngNotation
+	// LogOutputs are where logstash forwards the application logs of the
+	// tenant, besides its own elasticsearch.  They are only set on the tenant
+	// service.
+	LogOutputs []servicedefinition.LogOutput
 	datastore.VersionedEntity
 }
 
@@ -393,6 +401,8 @@ func BuildService(sd servicedefinition.ServiceDefinition, parentServiceID string
 	svc.PIDFile = sd.PIDFile
 	svc.StartLevel = sd.StartLevel
 	svc.EmergencyShutdownLevel = sd.EmergencyShutdownLevel
+	svc.StorageQuota = sd.StorageQuota
+	svc.LogOutputs = sd.LogOutputs
 
 	svc.Endpoints = make([]ServiceEndpoint, 0)
 	for _, ep := range sd.Endpoints {
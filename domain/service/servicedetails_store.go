@@ -463,7 +463,7 @@ func createPublicEndpoints(result EndpointQueryResult) []PublicEndpoint {
 				Enabled:     port.Enabled,
 			}
 
-			if strings.HasPrefix(port.Protocol, "http") {
+			if strings.HasPrefix(port.Protocol, "http") || port.Protocol == "udp" {
 				pub.Protocol = port.Protocol
 			} else if port.UseTLS {
 				pub.Protocol = "Other, secure (TLS)"
@@ -17,6 +17,7 @@ import (
 	"fmt"
 
 	"github.com/control-center/serviced/commons"
+	"github.com/control-center/serviced/domain/servicedefinition"
 	"github.com/control-center/serviced/validation"
 )
 
@@ -50,6 +51,8 @@ func (s *Service) ValidEntity() error {
 		vErr.Add(ep.ValidEntity())
 	}
 
+	vErr.Add(servicedefinition.ValidLogOutputs(s.LogOutputs))
+
 	if vErr.HasError() {
 		return vErr
 	}
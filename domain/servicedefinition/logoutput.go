@@ -0,0 +1,142 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package servicedefinition
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/control-center/serviced/validation"
+)
+
+// Types of log outputs
+const (
+	LogOutputSyslog = "syslog" // RFC5424 syslog over TCP, or TLS with TLS set
+	LogOutputKafka  = "kafka"  // json messages to a kafka topic
+	LogOutputHTTP   = "http"   // json messages posted to a url
+)
+
+// Audit routing of a log output
+const (
+	AuditInclude = ""        // forward the audit logs along with the rest
+	AuditOnly    = "only"    // forward just the logs whose LogConfig has IsAudit set
+	AuditExclude = "exclude" // forward all but the logs whose LogConfig has IsAudit set
+)
+
+// logOutputName matches the names of log outputs
+var logOutputName = regexp.MustCompile("\\A[\\w\\-]+\\z")
+
+// LogOutput is a destination, besides the logstash elasticsearch, that
+// application logs are forwarded to by logstash.  The outputs of a tenant
+// service get the logs of its application; the outputs of the cluster get the
+// logs of every application.
+type LogOutput struct {
+	Name     string            // Name of the output, unique to the tenant or the cluster
+	Type     string            // One of syslog, kafka or http
+	Address  string            // syslog: host:port; kafka: host:port[,host:port...] of the brokers; http: the url
+	TLS      bool              // Connect to a syslog server or the kafka brokers with TLS
+	CACert   string            // PEM certificate authority that signed the syslog or http server's certificate
+	Topic    string            // Kafka topic the messages are sent to
+	Headers  map[string]string // Headers of the http requests, such as Authorization
+	LogTypes []string          // Only forward the logs of these LogConfig types; all types if empty
+	Audit    string            // Routing of the audit logs; AuditInclude, AuditOnly or AuditExclude
+}
+
+// ValidEntity makes sure the log output can be rendered into the logstash
+// configuration
+func (o LogOutput) ValidEntity() error {
+	vErr := validation.NewValidationError()
+	if !logOutputName.MatchString(o.Name) {
+		vErr.Add(fmt.Errorf("invalid log output name %q", o.Name))
+	}
+	vErr.Add(validation.StringIn(o.Type, LogOutputSyslog, LogOutputKafka, LogOutputHTTP))
+	vErr.Add(validation.StringIn(o.Audit, AuditInclude, AuditOnly, AuditExclude))
+	vErr.Add(validation.NotEmpty("Address", o.Address))
+
+	// the values are quoted in the logstash configuration
+	const quoteChars = "\"\\"
+	vErr.Add(validation.ExcludeChars("Address", o.Address, quoteChars))
+	vErr.Add(validation.ExcludeChars("Topic", o.Topic, quoteChars))
+	for name, value := range o.Headers {
+		vErr.Add(validation.ExcludeChars("Headers", name, quoteChars))
+		vErr.Add(validation.ExcludeChars("Headers", value, quoteChars))
+	}
+	for _, logType := range o.LogTypes {
+		vErr.Add(validation.ExcludeChars("LogTypes", logType, quoteChars))
+	}
+
+	switch o.Type {
+	case LogOutputSyslog:
+		if _, port, err := net.SplitHostPort(o.Address); err != nil {
+			vErr.Add(fmt.Errorf("invalid syslog address %q: %s", o.Address, err))
+		} else if p, err := strconv.Atoi(port); err != nil {
+			vErr.Add(fmt.Errorf("invalid syslog port %q", port))
+		} else {
+			vErr.Add(validation.ValidPort(p))
+		}
+		if o.CACert != "" && !o.TLS {
+			vErr.Add(fmt.Errorf("log output %s has a CACert but does not use TLS", o.Name))
+		}
+	case LogOutputKafka:
+		for _, broker := range strings.Split(o.Address, ",") {
+			if _, _, err := net.SplitHostPort(broker); err != nil {
+				vErr.Add(fmt.Errorf("invalid kafka broker %q: %s", broker, err))
+			}
+		}
+		vErr.Add(validation.NotEmpty("Topic", o.Topic))
+		if o.CACert != "" {
+			vErr.Add(fmt.Errorf("log output %s: kafka uses the certificate authorities trusted by logstash", o.Name))
+		}
+	case LogOutputHTTP:
+		if u, err := url.Parse(o.Address); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			vErr.Add(fmt.Errorf("invalid http url %q", o.Address))
+		}
+	}
+	if o.Type != LogOutputKafka && o.Topic != "" {
+		vErr.Add(fmt.Errorf("log output %s: only kafka outputs have a topic", o.Name))
+	}
+	if o.Type != LogOutputHTTP && len(o.Headers) > 0 {
+		vErr.Add(fmt.Errorf("log output %s: only http outputs have headers", o.Name))
+	}
+	if o.CACert != "" {
+		if block, _ := pem.Decode([]byte(o.CACert)); block == nil {
+			vErr.Add(fmt.Errorf("log output %s: CACert is not a PEM certificate", o.Name))
+		}
+	}
+
+	if vErr.HasError() {
+		return vErr
+	}
+	return nil
+}
+
+// ValidLogOutputs validates a set of log outputs, whose names must be unique
+func ValidLogOutputs(outputs []LogOutput) error {
+	names := make(map[string]struct{})
+	for _, output := range outputs {
+		if err := output.ValidEntity(); err != nil {
+			return err
+		}
+		if _, ok := names[output.Name]; ok {
+			return fmt.Errorf("log output name %s is not unique", output.Name)
+		}
+		names[output.Name] = struct{}{}
+	}
+	return nil
+}
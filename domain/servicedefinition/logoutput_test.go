@@ -0,0 +1,96 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package servicedefinition_test
+
+import (
+	"testing"
+
+	. "github.com/control-center/serviced/domain/servicedefinition"
+	. "github.com/control-center/serviced/domain/servicedefinition/testutils"
+)
+
+const testCACert = `-----BEGIN CERTIFICATE-----
+MIIBszCCAVmgAwIBAgIJAOdlb2RTY2VydDAKBggqhkjOPQQDAjAAMB4XDTE2MDEw
+-----END CERTIFICATE-----
+`
+
+func TestLogOutputValidEntity(t *testing.T) {
+	valid := []LogOutput{
+		{Name: "siem", Type: LogOutputSyslog, Address: "siem.example.com:514"},
+		{Name: "siem-tls", Type: LogOutputSyslog, Address: "siem.example.com:6514", TLS: true, CACert: testCACert, Audit: AuditOnly},
+		{Name: "kafka_1", Type: LogOutputKafka, Address: "k1:9092,k2:9092", Topic: "logs", TLS: true, LogTypes: []string{"zenhub"}},
+		{Name: "hec", Type: LogOutputHTTP, Address: "https://hec.example.com/services/collector", CACert: testCACert,
+			Headers: map[string]string{"Authorization": "Splunk abc"}, Audit: AuditExclude},
+	}
+	for _, output := range valid {
+		if err := output.ValidEntity(); err != nil {
+			t.Errorf("Unexpected error for log output %s: %s", output.Name, err)
+		}
+	}
+
+	invalid := map[string]LogOutput{
+		"bad name":          {Name: "a b", Type: LogOutputSyslog, Address: "siem:514"},
+		"bad type":          {Name: "a", Type: "gelf", Address: "siem:514"},
+		"bad audit":         {Name: "a", Type: LogOutputSyslog, Address: "siem:514", Audit: "some"},
+		"no address":        {Name: "a", Type: LogOutputSyslog},
+		"no syslog port":    {Name: "a", Type: LogOutputSyslog, Address: "siem"},
+		"bad syslog port":   {Name: "a", Type: LogOutputSyslog, Address: "siem:syslog"},
+		"ca without tls":    {Name: "a", Type: LogOutputSyslog, Address: "siem:514", CACert: testCACert},
+		"bad ca":            {Name: "a", Type: LogOutputSyslog, Address: "siem:514", TLS: true, CACert: "cert"},
+		"no kafka topic":    {Name: "a", Type: LogOutputKafka, Address: "k1:9092"},
+		"bad kafka broker":  {Name: "a", Type: LogOutputKafka, Address: "k1:9092,k2", Topic: "logs"},
+		"kafka ca":          {Name: "a", Type: LogOutputKafka, Address: "k1:9092", Topic: "logs", TLS: true, CACert: testCACert},
+		"bad url":           {Name: "a", Type: LogOutputHTTP, Address: "ftp://hec.example.com"},
+		"topic not kafka":   {Name: "a", Type: LogOutputHTTP, Address: "http://hec", Topic: "logs"},
+		"headers not http":  {Name: "a", Type: LogOutputSyslog, Address: "siem:514", Headers: map[string]string{"a": "b"}},
+		"quoted header":     {Name: "a", Type: LogOutputHTTP, Address: "http://hec", Headers: map[string]string{"a": "\"b"}},
+		"quoted log type":   {Name: "a", Type: LogOutputSyslog, Address: "siem:514", LogTypes: []string{"a\\"}},
+		"quoted topic name": {Name: "a", Type: LogOutputKafka, Address: "k1:9092", Topic: "\"logs"},
+	}
+	for desc, output := range invalid {
+		if err := output.ValidEntity(); err == nil {
+			t.Errorf("Expected an error for log output with %s", desc)
+		}
+	}
+}
+
+func TestValidLogOutputs(t *testing.T) {
+	outputs := []LogOutput{
+		{Name: "a", Type: LogOutputSyslog, Address: "siem:514"},
+		{Name: "b", Type: LogOutputHTTP, Address: "http://hec"},
+	}
+	if err := ValidLogOutputs(outputs); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	outputs = append(outputs, LogOutput{Name: "a", Type: LogOutputKafka, Address: "k1:9092", Topic: "logs"})
+	if err := ValidLogOutputs(outputs); err == nil {
+		t.Errorf("Expected an error for log outputs with the same name")
+	}
+}
+
+func TestServiceDefinitionLogOutputs(t *testing.T) {
+	sd := *ValidSvcDef
+	sd.LogOutputs = []LogOutput{{Name: "a", Type: LogOutputSyslog, Address: "siem:514"}}
+	if err := sd.ValidEntity(); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	sd.LogOutputs = []LogOutput{{Name: "a", Type: "gelf", Address: "siem:514"}}
+	if err := sd.ValidEntity(); err == nil {
+		t.Errorf("Expected an error for a service definition with an invalid log output")
+	}
+}
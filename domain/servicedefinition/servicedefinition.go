@@ -64,9 +64,11 @@ type ServiceDefinition struct {
 	MonitoringProfile      domain.MonitorProfile         // An optional list of queryable metrics, graphs, and thresholds
 	MemoryLimit            float64
 	CPUShares              int64
-	PIDFile                string // An optional path or command to generate a path for a PID file to which signals are relayed.
-	StartLevel             uint   // Services start in the order implied by this field (low to high) and stopped in reverse order
-	EmergencyShutdownLevel uint   // In case of low storage, Services stopped in the order implied by this field (low to high)
+	PIDFile                string            // An optional path or command to generate a path for a PID file to which signals are relayed.
+	StartLevel             uint              // Services start in the order implied by this field (low to high) and stopped in reverse order
+	EmergencyShutdownLevel uint              // In case of low storage, Services stopped in the order implied by this field (low to high)
+	StorageQuota           utils.EngNotation // Most space the application may use on the distributed filesystem; only applies to the tenant service
+	LogOutputs             []LogOutput       // Where else the application logs are forwarded to; only applies to the tenant service
 }
 
 // SnapshotCommands commands to be called during and after a snapshot
@@ -94,8 +96,19 @@ type EndpointDefinition struct {
 
 // VHost is the configuration for an application endpoint that wants an http VHost endpoint provided by Control Center
 type VHost struct {
-	Name    string // name of the vhost subdomain subdomain, i.e "myapplication"  not "myapplication.host.com
-	Enabled bool   // whether the vhost should be enabled or disabled.
+	Name    string       // name of the vhost subdomain subdomain, i.e "myapplication"  not "myapplication.host.com
+	Enabled bool         // whether the vhost should be enabled or disabled.
+	Routes  []VHostRoute // optional path-based routes; requests that match no route go to the endpoint's application
+}
+
+// VHostRoute sends requests for a vhost whose URL path starts with a prefix to
+// the exports of an application.
+type VHostRoute struct {
+	PathPrefix    string            // URL path prefix to match, i.e. "/api"
+	Application   string            // exported application to proxy to; defaults to the endpoint's application
+	StripPrefix   bool              // whether to remove the prefix from the URL path before proxying
+	SetHeaders    map[string]string // request headers to add or overwrite before proxying
+	RemoveHeaders []string          // request headers to remove before proxying
 }
 
 // Port is the configuration for an application endpoint port.
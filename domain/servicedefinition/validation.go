@@ -61,6 +61,10 @@ func (sd *ServiceDefinition) validate(context *validationContext) error {
 	}
 	//TODO: validate LogConfigs
 
+	if err := ValidLogOutputs(sd.LogOutputs); err != nil {
+		return fmt.Errorf("service definition %v: %v", sd.Name, err)
+	}
+
 	// validate Monitoring Profile
 	if err := sd.MonitoringProfile.ValidEntity(); err != nil {
 		return fmt.Errorf("service definition %v: invalid monitoring profile %s", sd.Name, err)
@@ -121,9 +125,39 @@ func (se EndpointDefinition) ValidEntity() error {
 			return fmt.Errorf("endpoint '%s': %s", se.Name, err)
 		}
 	}
+	for _, vhost := range se.VHostList {
+		if err := vhost.ValidEntity(); err != nil {
+			return fmt.Errorf("endpoint '%s': %s", se.Name, err)
+		}
+	}
 	return se.AddressConfig.ValidEntity()
 }
 
+//ValidEntity makes sure the routes of a VHost have unique, absolute path prefixes
+func (v VHost) ValidEntity() error {
+	prefixes := make(map[string]struct{})
+	for _, route := range v.Routes {
+		if !strings.HasPrefix(route.PathPrefix, "/") {
+			return fmt.Errorf("vhost %s: route path prefix %q must start with /", v.Name, route.PathPrefix)
+		}
+		prefix := route.CleanPathPrefix()
+		if _, found := prefixes[prefix]; found {
+			return fmt.Errorf("vhost %s: duplicate route path prefix %q", v.Name, route.PathPrefix)
+		}
+		prefixes[prefix] = struct{}{}
+	}
+	return nil
+}
+
+//CleanPathPrefix returns the route's path prefix without a trailing slash,
+//unless the prefix is the root path.
+func (r VHostRoute) CleanPathPrefix() string {
+	if prefix := strings.TrimRight(r.PathPrefix, "/"); prefix != "" {
+		return prefix
+	}
+	return "/"
+}
+
 func applicationValidation(application string) error {
 	_, err := regexp.Compile(application)
 	if err != nil {
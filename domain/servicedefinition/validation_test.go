@@ -137,3 +137,34 @@ func TestServiceDefinitionEmptyEndpointName(t *testing.T) {
 		t.Errorf("Unexpected Error %v", err)
 	}
 }
+
+func TestServiceDefinitionVHostRoutes(t *testing.T) {
+	sd := CreateValidServiceDefinition()
+	sd.Services[0].Endpoints[0].VHostList = []VHost{
+		{
+			Name:    "routedhost",
+			Enabled: true,
+			Routes: []VHostRoute{
+				{PathPrefix: "/api", Application: "api", StripPrefix: true},
+				{PathPrefix: "/"},
+			},
+		},
+	}
+	if err := sd.ValidEntity(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	sd.Services[0].Endpoints[0].VHostList[0].Routes[1].PathPrefix = "/api/"
+	if err := sd.ValidEntity(); err == nil {
+		t.Error("Expected error")
+	} else if !strings.Contains(err.Error(), "duplicate route path prefix") {
+		t.Errorf("Unexpected Error %v", err)
+	}
+
+	sd.Services[0].Endpoints[0].VHostList[0].Routes[1].PathPrefix = "ui"
+	if err := sd.ValidEntity(); err == nil {
+		t.Error("Expected error")
+	} else if !strings.Contains(err.Error(), "must start with /") {
+		t.Errorf("Unexpected Error %v", err)
+	}
+}
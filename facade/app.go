@@ -0,0 +1,321 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package facade
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/audit"
+	"github.com/control-center/serviced/commons"
+	"github.com/control-center/serviced/datastore"
+	"github.com/control-center/serviced/dfs"
+	"github.com/control-center/serviced/domain/logfilter"
+	"github.com/control-center/serviced/utils"
+)
+
+// ErrNotTenant is returned when an application is exported by the id of a
+// service that is not a tenant.
+var ErrNotTenant = errors.New("facade: service is not a tenant application")
+
+// ExportApp writes a single tenant application into an archive, with its
+// services, configuration files, log filters, images and a snapshot of its
+// volume.
+func (f *Facade) ExportApp(ctx datastore.Context, tenantID string, w io.Writer, snapshotSpacePercent int) error {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.ExportApp"))
+	logger := plog.WithField("tenantid", tenantID)
+	alog := f.auditLogger.Message(ctx, "Exported Application").Action(audit.Export).
+		Type("Service").ID(tenantID)
+	if id, err := f.GetTenantID(ctx, tenantID); err != nil {
+		logger.WithError(err).Debug("Could not look up tenant")
+		return alog.Error(err)
+	} else if id != tenantID {
+		return alog.Error(ErrNotTenant)
+	}
+	if err := f.DFSLock(ctx).LockWithTimeout("export application", userLockTimeout); err != nil {
+		logger.WithError(err).Debug("Could not lock the dfs")
+		return alog.Error(err)
+	}
+	defer f.DFSLock(ctx).Unlock()
+
+	stime := time.Now()
+	tag := "export-" + stime.UTC().Format("20060102-150405")
+	snapshotID, err := f.Snapshot(ctx, tenantID, "export of application", []string{tag}, snapshotSpacePercent)
+	if err != nil {
+		logger.WithError(err).Debug("Could not snapshot tenant")
+		return alog.Error(err)
+	}
+	defer func() {
+		if err := f.dfs.Delete(snapshotID); err != nil {
+			logger.WithError(err).WithField("snapshot", snapshotID).Warn("Could not delete export snapshot")
+		}
+	}()
+	info, err := f.dfs.Info(snapshotID)
+	if err != nil {
+		logger.WithError(err).Debug("Could not get info for snapshot")
+		return alog.Error(err)
+	}
+
+	// the configuration files are loaded onto the services, so they are
+	// added back by the import.
+	svcs := info.Services
+	filterNames := make(map[string]struct{})
+	for i := range svcs {
+		if err := f.fillServiceConfigs(ctx, &svcs[i]); err != nil {
+			return alog.Error(err)
+		}
+		for _, logConfig := range svcs[i].LogConfigs {
+			for _, name := range logConfig.Filters {
+				filterNames[name] = struct{}{}
+			}
+		}
+	}
+	filters, err := f.GetLogFilters(ctx)
+	if err != nil {
+		logger.WithError(err).Debug("Could not get log filters")
+		return alog.Error(err)
+	}
+	var logFilters []logfilter.LogFilter
+	for _, filter := range filters {
+		if _, ok := filterNames[filter.Name]; ok {
+			logFilters = append(logFilters, *filter)
+		}
+	}
+
+	app := dfs.AppInfo{
+		TenantID:   tenantID,
+		Snapshot:   snapshotID,
+		Services:   svcs,
+		LogFilters: logFilters,
+		Timestamp:  stime,
+		AppVersion: 1,
+	}
+	if err := f.dfs.ExportApp(app, w); err != nil {
+		logger.WithError(err).Debug("Could not export application")
+		return alog.Error(err)
+	}
+	logger.WithField("elapsed", time.Since(stime)).Info("Exported application")
+	alog.WithField("services", strconv.Itoa(len(svcs))).Succeeded()
+	return nil
+}
+
+// ImportApp loads an application archive written by ExportApp into the given
+// resource pool, and returns the tenant id of the imported application.  If
+// the application already exists, the imported copy gets new service ids and
+// a new deployment id.  Public ports and virtual hosts that are in use are
+// moved to the next free port or name.
+func (f *Facade) ImportApp(ctx datastore.Context, r io.Reader, poolID string) (string, error) {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.ImportApp"))
+	logger := plog.WithField("poolid", poolID)
+	alog := f.auditLogger.Message(ctx, "Imported Application").Action(audit.Import).
+		WithField("poolid", poolID)
+	if poolID != "" {
+		if p, err := f.GetResourcePool(ctx, poolID); err != nil {
+			logger.WithError(err).Debug("Could not look up resource pool")
+			return "", alog.Error(err)
+		} else if p == nil {
+			return "", alog.Error(ErrPoolNotExists)
+		}
+	}
+	if err := f.DFSLock(ctx).LockWithTimeout("import application", userLockTimeout); err != nil {
+		logger.WithError(err).Debug("Could not lock the dfs")
+		return "", alog.Error(err)
+	}
+	defer f.DFSLock(ctx).Unlock()
+
+	info, err := f.dfs.ImportApp(r, func(info *dfs.AppInfo) error {
+		return f.remapApp(ctx, info, poolID)
+	})
+	if err != nil {
+		logger.WithError(err).Debug("Could not import application")
+		return "", alog.Error(err)
+	}
+	logger = logger.WithField("tenantid", info.TenantID)
+	alog = alog.Type("Service").ID(info.TenantID)
+	if err := f.RestoreServices(ctx, info.TenantID, info.Services); err != nil {
+		logger.WithError(err).Debug("Could not add services")
+		return "", alog.Error(err)
+	}
+	for i := range info.LogFilters {
+		filter := &info.LogFilters[i]
+		if _, err := f.logFilterStore.Get(ctx, filter.Name, filter.Version); datastore.IsErrNoSuchEntity(err) {
+			filter.DatabaseVersion = 0
+			if err := f.logFilterStore.Put(ctx, filter); err != nil {
+				logger.WithError(err).WithField("logfilter", filter.Name).Debug("Could not add log filter")
+				return "", alog.Error(err)
+			}
+		} else if err != nil {
+			return "", alog.Error(err)
+		}
+	}
+	if err := f.dfs.Rollback(info.Snapshot); err != nil {
+		logger.WithError(err).Debug("Could not load application data from snapshot")
+		return "", alog.Error(err)
+	}
+	logger.Info("Imported application")
+	alog.WithField("services", strconv.Itoa(len(info.Services))).Succeeded()
+	return info.TenantID, nil
+}
+
+// remapApp changes the ids, deployment, pool, ports and virtual hosts of an
+// imported application so that it does not conflict with this cluster.
+func (f *Facade) remapApp(ctx datastore.Context, info *dfs.AppInfo, poolID string) error {
+	logger := plog.WithField("tenantid", info.TenantID)
+
+	// get new ids if any of the services are already on this cluster
+	ids := make(map[string]string)
+	for _, svc := range info.Services {
+		if _, err := f.serviceStore.Get(ctx, svc.ID); err == nil {
+			for _, svc := range info.Services {
+				newID, err := utils.NewUUID36()
+				if err != nil {
+					return err
+				}
+				ids[svc.ID] = newID
+			}
+			break
+		} else if !datastore.IsErrNoSuchEntity(err) {
+			return err
+		}
+	}
+
+	// find a deployment id that does not collide with the existing tenants
+	var deploymentID, tenantName string
+	for _, svc := range info.Services {
+		if svc.ID == info.TenantID {
+			deploymentID, tenantName = svc.DeploymentID, svc.Name
+		}
+	}
+	baseDeploymentID := deploymentID
+	for i := 2; ; i++ {
+		if svc, err := f.serviceStore.FindChildService(ctx, deploymentID, "", tenantName); err != nil {
+			return err
+		} else if svc == nil {
+			break
+		}
+		deploymentID = fmt.Sprintf("%s-%d", baseDeploymentID, i)
+	}
+
+	vhosts := make(map[string]struct{})
+	ports := make(map[string]struct{})
+	oldTenantID, newTenantID := info.TenantID, info.TenantID
+	if id, ok := ids[oldTenantID]; ok {
+		newTenantID = id
+	}
+	for i := range info.Services {
+		svc := &info.Services[i]
+		if id, ok := ids[svc.ID]; ok {
+			svc.ID = id
+		}
+		if id, ok := ids[svc.ParentServiceID]; ok {
+			svc.ParentServiceID = id
+		}
+		svc.DeploymentID = deploymentID
+		if poolID != "" {
+			svc.PoolID = poolID
+		}
+		if imageID, err := commons.ParseImageID(svc.ImageID); err == nil && imageID.Library() == oldTenantID {
+			imageID.User = strings.TrimSuffix(imageID.User, oldTenantID) + newTenantID
+			svc.ImageID = imageID.String()
+		}
+		for j := range svc.Endpoints {
+			ep := &svc.Endpoints[j]
+			for k := range ep.VHostList {
+				vhost := &ep.VHostList[k]
+				if !vhost.Enabled {
+					continue
+				}
+				name, err := f.freeVHost(vhost.Name, vhosts)
+				if err != nil {
+					return err
+				}
+				if name != vhost.Name {
+					logger.WithFields(logrus.Fields{"vhost": vhost.Name, "newvhost": name}).Info("Remapped virtual host of imported application")
+					vhost.Name = name
+				}
+			}
+			for k := range ep.PortList {
+				port := &ep.PortList[k]
+				if !port.Enabled {
+					continue
+				}
+				portAddr, err := f.freePublicPort(port.PortAddr, ports)
+				if err != nil {
+					return err
+				}
+				if portAddr != port.PortAddr {
+					logger.WithFields(logrus.Fields{"portaddr": port.PortAddr, "newportaddr": portAddr}).Info("Remapped public port of imported application")
+					port.PortAddr = portAddr
+				}
+			}
+		}
+	}
+	info.TenantID = newTenantID
+	return nil
+}
+
+// freeVHost returns the first of name, name-2, name-3... that is not used by
+// a public endpoint or already taken by the import.
+func (f *Facade) freeVHost(name string, taken map[string]struct{}) (string, error) {
+	vhost := name
+	for i := 2; ; i++ {
+		if _, ok := taken[vhost]; !ok {
+			serviceID, application, err := f.zzk.GetVHost(vhost)
+			if err != nil {
+				return "", err
+			}
+			if serviceID == "" && application == "" {
+				taken[vhost] = struct{}{}
+				return vhost, nil
+			}
+		}
+		vhost = fmt.Sprintf("%s-%d", name, i)
+	}
+}
+
+// freePublicPort returns the first port from portAddr up that is not used by
+// a public endpoint or already taken by the import.
+func (f *Facade) freePublicPort(portAddr string, taken map[string]struct{}) (string, error) {
+	host, portStr, err := net.SplitHostPort(portAddr)
+	if err != nil {
+		// leave it to the service validation
+		return portAddr, nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return portAddr, nil
+	}
+	for ; port <= 65535; port++ {
+		addr := net.JoinHostPort(host, strconv.Itoa(port))
+		if _, ok := taken[addr]; ok {
+			continue
+		}
+		serviceID, application, err := f.zzk.GetPublicPort(addr)
+		if err != nil {
+			return "", err
+		}
+		if serviceID == "" && application == "" {
+			taken[addr] = struct{}{}
+			return addr, nil
+		}
+	}
+	// no free port; the service validation will disable it
+	return portAddr, nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package facade_test
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/control-center/serviced/datastore"
+	"github.com/control-center/serviced/dfs"
+	"github.com/control-center/serviced/domain/pool"
+	"github.com/control-center/serviced/domain/service"
+	"github.com/control-center/serviced/domain/servicedefinition"
+	"github.com/control-center/serviced/facade"
+	"github.com/stretchr/testify/mock"
+	. "gopkg.in/check.v1"
+)
+
+func (ft *FacadeUnitTest) Test_ImportAppRemapsConflicts(c *C) {
+	ft.setupMockDFSLocking()
+	info := &dfs.AppInfo{
+		TenantID: "tenant",
+		Snapshot: "tenant_export",
+		Services: []service.Service{
+			{ID: "tenant", Name: "app", DeploymentID: "dep", ImageID: "tenant/core:latest"},
+			{
+				ID:              "child",
+				Name:            "web",
+				ParentServiceID: "tenant",
+				DeploymentID:    "dep",
+				Endpoints: []service.ServiceEndpoint{
+					{
+						VHostList: []servicedefinition.VHost{{Name: "app", Enabled: true}, {Name: "app", Enabled: true}},
+						PortList:  []servicedefinition.Port{{PortAddr: ":443", Enabled: true}, {PortAddr: ":8080"}},
+					},
+				},
+			},
+		},
+	}
+
+	// the application is already on this cluster
+	ft.serviceStore.On("Get", ft.ctx, "tenant").Return(&service.Service{ID: "tenant"}, nil)
+	ft.serviceStore.On("FindChildService", ft.ctx, "dep", "", "app").Return(&service.Service{ID: "tenant"}, nil)
+	ft.serviceStore.On("FindChildService", ft.ctx, "dep-2", "", "app").Return(nil, nil)
+	ft.zzk.On("GetVHost", "app").Return("tenant", "web", nil)
+	ft.zzk.On("GetVHost", "app-2").Return("", "", nil)
+	ft.zzk.On("GetVHost", "app-3").Return("", "", nil)
+	ft.zzk.On("GetPublicPort", ":443").Return("tenant", "web", nil)
+	ft.zzk.On("GetPublicPort", ":444").Return("", "", nil)
+
+	var remapErr error
+	stop := errors.New("stop")
+	r := bytes.NewBufferString("app")
+	ft.dfs.On("ImportApp", r, mock.Anything).Run(func(args mock.Arguments) {
+		remap := args.Get(1).(func(*dfs.AppInfo) error)
+		remapErr = remap(info)
+	}).Return(nil, stop)
+
+	_, err := ft.Facade.ImportApp(ft.ctx, r, "")
+	c.Assert(err, Equals, stop)
+	c.Assert(remapErr, IsNil)
+
+	tenant, child := info.Services[0], info.Services[1]
+	c.Assert(info.TenantID, Equals, tenant.ID)
+	c.Assert(tenant.ID, Not(Equals), "tenant")
+	c.Assert(tenant.ImageID, Equals, tenant.ID+"/core:latest")
+	c.Assert(child.ID, Not(Equals), "child")
+	c.Assert(child.ParentServiceID, Equals, tenant.ID)
+	c.Assert(tenant.DeploymentID, Equals, "dep-2")
+	c.Assert(child.DeploymentID, Equals, "dep-2")
+	c.Assert(child.Endpoints[0].VHostList[0].Name, Equals, "app-2")
+	c.Assert(child.Endpoints[0].VHostList[1].Name, Equals, "app-3")
+	c.Assert(child.Endpoints[0].PortList[0].PortAddr, Equals, ":444")
+	c.Assert(child.Endpoints[0].PortList[1].PortAddr, Equals, ":8080")
+}
+
+func (ft *FacadeUnitTest) Test_ImportAppNewApplication(c *C) {
+	ft.setupMockDFSLocking()
+	info := &dfs.AppInfo{
+		TenantID: "tenant",
+		Services: []service.Service{{ID: "tenant", Name: "app", DeploymentID: "dep", PoolID: "default"}},
+	}
+	ft.poolStore.On("Get", ft.ctx, pool.Key("pool2"), mock.AnythingOfType("*pool.ResourcePool")).Return(datastore.ErrNoSuchEntity{})
+	_, err := ft.Facade.ImportApp(ft.ctx, bytes.NewBufferString("app"), "pool2")
+	c.Assert(err, Equals, facade.ErrPoolNotExists)
+
+	ft.serviceStore.On("Get", ft.ctx, "tenant").Return(nil, datastore.ErrNoSuchEntity{})
+	ft.serviceStore.On("FindChildService", ft.ctx, "dep", "", "app").Return(nil, nil)
+	var remapErr error
+	stop := errors.New("stop")
+	ft.dfs.On("ImportApp", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		remap := args.Get(1).(func(*dfs.AppInfo) error)
+		remapErr = remap(info)
+	}).Return(nil, stop)
+
+	_, err = ft.Facade.ImportApp(ft.ctx, bytes.NewBufferString("app"), "")
+	c.Assert(err, Equals, stop)
+	c.Assert(remapErr, IsNil)
+	c.Assert(info.TenantID, Equals, "tenant")
+	c.Assert(info.Services[0].DeploymentID, Equals, "dep")
+	c.Assert(info.Services[0].PoolID, Equals, "default")
+}
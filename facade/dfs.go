@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -51,6 +52,7 @@ type registryVersionInfo struct {
 	version int
 	rootDir string
 	imageId string
+	env     []string
 }
 
 var registryVersionInfos = map[int]registryVersionInfo{
@@ -58,11 +60,13 @@ var registryVersionInfos = map[int]registryVersionInfo{
 		1,
 		"registry",
 		"registry:0.9.1",
+		[]string{"SETTINGS_FLAVOR=local"},
 	},
 	2: registryVersionInfo{
 		2,
 		"v2",
 		"registry:2.2.0", // This is the registry we currently use--may change in the future (WILL USE ISVCS DOCKER REG)
+		[]string{"REGISTRY_STORAGE_FILESYSTEM_ROOTDIRECTORY=/tmp/registry"},
 	},
 }
 
@@ -380,6 +384,63 @@ func (f *Facade) GetSnapshotByServiceIDAndTag(ctx datastore.Context, serviceID,
 	return info, nil
 }
 
+// ListSnapshotFiles lists the files at a path in a snapshot.
+func (f *Facade) ListSnapshotFiles(ctx datastore.Context, snapshotID, path string) ([]volume.SnapshotFile, error) {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.ListSnapshotFiles"))
+	files, err := f.dfs.ListFiles(snapshotID, path)
+	if err != nil {
+		plog.WithFields(logrus.Fields{
+			"snapshotid": snapshotID,
+			"path":       path,
+		}).WithError(err).Debug("Could not list files in snapshot")
+		return nil, err
+	}
+	return files, nil
+}
+
+// DiffSnapshots returns the files under a path that were added, modified or
+// removed between two snapshots.
+func (f *Facade) DiffSnapshots(ctx datastore.Context, fromSnapshotID, toSnapshotID, path string) ([]volume.SnapshotChange, error) {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.DiffSnapshots"))
+	changes, err := f.dfs.Diff(fromSnapshotID, toSnapshotID, path)
+	if err != nil {
+		plog.WithFields(logrus.Fields{
+			"fromsnapshotid": fromSnapshotID,
+			"tosnapshotid":   toSnapshotID,
+			"path":           path,
+		}).WithError(err).Debug("Could not compare snapshots")
+		return nil, err
+	}
+	return changes, nil
+}
+
+// RestoreSnapshotPath copies a file or directory from a snapshot into a
+// directory on the master, or back into the application's volume if dest is
+// empty.  Returns the number of files restored.
+func (f *Facade) RestoreSnapshotPath(ctx datastore.Context, snapshotID, path, dest string) (int, error) {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.RestoreSnapshotPath"))
+	logger := plog.WithFields(logrus.Fields{
+		"snapshotid":  snapshotID,
+		"path":        path,
+		"destination": dest,
+	})
+	alog := f.auditLogger.Message(ctx, "Restoring Path from Snapshot").Action(audit.Restore).
+		Type("snapshot").ID(snapshotID).WithFields(logrus.Fields{"path": path, "destination": dest})
+	if err := f.DFSLock(ctx).LockWithTimeout("restore snapshot path", userLockTimeout); err != nil {
+		logger.WithError(err).Debug("Could not lock DFS")
+		return 0, alog.Error(err)
+	}
+	defer f.DFSLock(ctx).Unlock()
+	count, err := f.dfs.RestorePath(snapshotID, path, dest)
+	if err != nil {
+		logger.WithError(err).Debug("Could not restore path from snapshot")
+		return count, alog.Error(err)
+	}
+	alog.WithField("files", strconv.Itoa(count)).Succeeded()
+	logger.WithField("files", count).Info("Restored path from snapshot")
+	return count, nil
+}
+
 // ResetLock resets locks for a specific tenant
 func (f *Facade) ResetLock(ctx datastore.Context, serviceID string) error {
 	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.ResetLock"))
@@ -459,6 +520,8 @@ func (f *Facade) RepairRegistry(ctx datastore.Context) error {
 // If fromRegistryHost is not set, search for an old registry on the local host to upgrade.
 // If force is true for a local registry, upgrade again even if previous upgrade was successful.
 // (For a remote registry, the upgrade is always performed regardless of the value of the force parameter.)
+// If force is true and there is nothing to migrate, every image is pushed again into the registry and
+// into the registries of the resource pools (e.g. to fill a pool registry that was just set up).
 func (f *Facade) UpgradeRegistry(ctx datastore.Context, fromRegistryHost string, force bool) error {
 	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.UpgradeRegistry"))
 	logger := plog.WithFields(logrus.Fields{
@@ -479,32 +542,39 @@ func (f *Facade) UpgradeRegistry(ctx datastore.Context, fromRegistryHost string,
 			logger.WithError(err).Debug("Could not determine the previous docker registry to migrate")
 			return err
 		}
-		if previousVersion == currentRegistryVersion {
-			logger.Info("No previous version of the docker registry exists; nothing to migrate")
-			return nil
-		}
-		logger := logger.WithField("previousversion", previousVersion)
-		if !isMigrated || force {
-			logger.Info("Starting local docker registry")
-			oldRegistryCtr, err := f.startDockerRegistry(previousVersion, oldLocalRegistryPort)
-			if err != nil {
-				logger.WithField("port", oldLocalRegistryPort).WithError(err).Debug("Could not start old docker registry")
-				return err
+		if previousVersion == f.registryVersionInUse() {
+			if !force {
+				logger.Info("No previous version of the docker registry exists; nothing to migrate")
+				return nil
 			}
-			logger = logger.WithField("oldregistrycontainer", oldRegistryCtr.Name)
-			defer func() {
-				if success {
-					f.markLocalDockerRegistryUpgraded(previousVersion)
-				}
-				logger.Infof("Stopping docker registry container")
-				if err := oldRegistryCtr.Stop(5 * time.Minute); err != nil {
-					logger.WithError(err).Error("Could not stop old docker registry container")
-				}
-			}()
-			fromRegistryHost = fmt.Sprintf("localhost:%s", oldLocalRegistryPort)
+			logger.Info("No previous version of the docker registry exists; pushing every image again")
 		} else {
-			logger.Info("Registry already migrated; no action required")
-			return nil
+			logger := logger.WithField("previousversion", previousVersion)
+			// images of the internal registry are already in the index, so
+			// they must all be pushed again into the external registry.
+			force = force || previousVersion == currentRegistryVersion
+			if !isMigrated || force {
+				logger.Info("Starting local docker registry")
+				oldRegistryCtr, err := f.startDockerRegistry(previousVersion, oldLocalRegistryPort)
+				if err != nil {
+					logger.WithField("port", oldLocalRegistryPort).WithError(err).Debug("Could not start old docker registry")
+					return err
+				}
+				logger = logger.WithField("oldregistrycontainer", oldRegistryCtr.Name)
+				defer func() {
+					if success {
+						f.markLocalDockerRegistryUpgraded(previousVersion)
+					}
+					logger.Infof("Stopping docker registry container")
+					if err := oldRegistryCtr.Stop(5 * time.Minute); err != nil {
+						logger.WithError(err).Error("Could not stop old docker registry container")
+					}
+				}()
+				fromRegistryHost = fmt.Sprintf("localhost:%s", oldLocalRegistryPort)
+			} else {
+				logger.Info("Registry already migrated; no action required")
+				return nil
+			}
 		}
 	}
 	tenantIDs, err := f.GetTenantIDs(ctx)
@@ -530,10 +600,19 @@ func (f *Facade) startDockerRegistry(version int, port string) (*docker.Containe
 	return versionInfo.start(f.isvcsPath, port)
 }
 
+// registryVersionInUse returns the version of the docker registry that serves
+// images.  An external registry supersedes every version of the internal one.
+func (f *Facade) registryVersionInUse() int {
+	if f.externalRegistry {
+		return currentRegistryVersion + 1
+	}
+	return currentRegistryVersion
+}
+
 // getPreviousRegistryVersion returns the next previous version of the docker
 // registry that needs migration and whether it has been previously migrated.
 func (f *Facade) getPreviousRegistryVersion() (isMigrated bool, version int, err error) {
-	for i := currentRegistryVersion - 1; i > 0; i-- {
+	for i := f.registryVersionInUse() - 1; i > 0; i-- {
 		logger := plog.WithField("version", i)
 		plog.Info("Checking docker registry")
 		versionInfo := registryVersionInfos[i]
@@ -555,7 +634,7 @@ func (f *Facade) getPreviousRegistryVersion() (isMigrated bool, version int, err
 		}
 		return true, i, nil
 	}
-	return false, currentRegistryVersion, nil
+	return false, f.registryVersionInUse(), nil
 }
 
 // markLocalDockerRegistryUpgraded sets a marker file that will indicate
@@ -574,66 +653,31 @@ func (f *Facade) markLocalDockerRegistryUpgraded(version int) error {
 	return nil
 }
 
-// Restore restores application data from a backup.
-func (f *Facade) Restore(ctx datastore.Context, r io.Reader, backupInfo *dfs.BackupInfo, backupFilename string) error {
-	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.Restore"))
-	// Do not DFSLock here, ControlPlaneDao does that
-	stime := time.Now()
-	plog.Info("Started restore from backup")
-	alog := f.auditLogger.Message(ctx, "Started Restoring from Backup").Action(audit.Restore).
-			WithFields(logrus.Fields{
-				"backupfile": backupFilename,
-				"starttime": stime.UTC().Format("2006-01-02-150405"),
-			})
-	alog.Succeeded()
-	if err := f.dfs.Restore(r, backupInfo.BackupVersion); err != nil {
-		plog.WithError(err).Debug("Could not restore from backup")
-		return alog.Error(err)
-	}
-	if err := f.RestoreServiceTemplates(ctx, backupInfo.Templates); err != nil {
-		plog.WithError(err).Debug("Could not restore service templates from backup")
-		return alog.Error(err)
-	}
-	plog.Infof("Restored service templates")
-	if err := f.RestoreResourcePools(ctx, backupInfo.Pools); err != nil {
-		plog.WithError(err).Debug("Could not restore resource pools from backup")
-		return alog.Error(err)
-	}
-	plog.Info("Restored resource pools")
-	for _, snapshot := range backupInfo.Snapshots {
-		logger := plog.WithField("snapshot", snapshot)
-		if err := f.Rollback(ctx, snapshot, false); err != nil {
-			logger.WithError(err).Debug("Could not rollback snapshot")
-			return alog.Error(err)
-		} else {
-			logger.Info("Rolled back snapshot")
-			if err := f.dfs.Delete(snapshot); err != nil {
-				// if we couldn't delete, untag it so the TTL reaper will get it eventually
-				info, err := f.dfs.Info(snapshot)
-				if err != nil {
-					logger.WithError(err).Warning("Could not get info for snapshot.")
-				} else if len(info.Tags) > 0 {
-					if _, err := f.dfs.Untag(info.TenantID, info.Tags[0]); err != nil {
-						logger.WithError(err).Warning("Could not untag snapshot.  Snapshot must be deleted manually!")
-					} else {
-						logger.Info("Snapshot from backup untagged.")
-					}
-				}
-			} else {
-				logger.Info("Removed snapshot after rollback")
-			}
-		}
-
+// VerifyBackup test-restores a backup into scratch volumes and reports the
+// problems found, without changing any application.
+func (f *Facade) VerifyBackup(ctx datastore.Context, r io.Reader, backupFilename string) (*dfs.BackupReport, error) {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.VerifyBackup"))
+	logger := plog.WithField("backupfile", backupFilename)
+	alog := f.auditLogger.Message(ctx, "Verified Backup").Action(audit.Verify).
+		WithField("backupfile", backupFilename)
+	if err := f.DFSLock(ctx).LockWithTimeout("verify backup", userLockTimeout); err != nil {
+		logger.WithError(err).Debug("Could not lock the dfs")
+		return nil, alog.Error(err)
 	}
-	restoreDuration := time.Since(stime)
-	plog.Info("Completed restore from backup")
-	alog = f.auditLogger.Message(ctx, "Completed Restoring from Backup").Action(audit.Restore).
-		WithFields(logrus.Fields{
-			"backupfile": backupFilename,
-			"elapsed": fmt.Sprintf("%fsec", restoreDuration.Seconds()),
-		})
-	alog.Succeeded()
-	return nil
+	defer f.DFSLock(ctx).Unlock()
+	stime := time.Now()
+	report, err := f.dfs.VerifyBackup(r)
+	if err != nil {
+		logger.WithError(err).Debug("Could not verify backup")
+		return nil, alog.Error(err)
+	}
+	valid := strconv.FormatBool(report.Valid())
+	logger.WithFields(logrus.Fields{
+		"elapsed": time.Since(stime),
+		"valid":   valid,
+	}).Info("Verified backup")
+	alog.WithField("valid", valid).Succeeded()
+	return report, nil
 }
 
 // Rollback rolls back an application to state described in the provided
@@ -841,7 +885,7 @@ func (info *registryVersionInfo) start(isvcsRoot string, hostPort string) (*dock
 				User:       "root",
 				WorkingDir: "/tmp/registry",
 				Image:      info.imageId,
-				Env:        []string{"SETTINGS_FLAVOR=local"},
+				Env:        info.env,
 			},
 			HostConfig: &dockerclient.HostConfig{
 				Binds:        []string{bindMount},
@@ -907,6 +951,48 @@ func (f *Facade) DockerOverride(ctx datastore.Context, newImageName, oldImageNam
 	return f.dfs.Override(newImageName, oldImageName)
 }
 
+// CollectRegistryGarbage removes the images that are not used by any service
+// or snapshot from the docker registry.  On a dry run, it only reports what
+// would be removed.
+func (f *Facade) CollectRegistryGarbage(ctx datastore.Context, dryRun bool) (*dfs.RegistryGCReport, error) {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.CollectRegistryGarbage"))
+	logger := plog.WithField("dryrun", dryRun)
+	alog := f.auditLogger.Message(ctx, "Collecting Registry Garbage").Action(audit.Remove).
+		Type("registry").WithField("dryrun", strconv.FormatBool(dryRun))
+	if err := f.DFSLock(ctx).LockWithTimeout("collect registry garbage", userLockTimeout); err != nil {
+		logger.WithError(err).Debug("Could not lock DFS")
+		return nil, alog.Error(err)
+	}
+	defer f.DFSLock(ctx).Unlock()
+
+	svcs, err := f.getServices(ctx)
+	if err != nil {
+		return nil, alog.Error(err)
+	}
+	images := []string{}
+	for _, svc := range svcs {
+		if svc.ImageID != "" {
+			images = append(images, svc.ImageID)
+		}
+	}
+	report, err := f.dfs.CollectRegistryGarbage(images, dryRun)
+	if err != nil {
+		logger.WithError(err).Debug("Could not collect registry garbage")
+		return nil, alog.Error(err)
+	}
+	alog.WithFields(logrus.Fields{
+		"images":    strconv.Itoa(len(report.Removed)),
+		"manifests": strconv.Itoa(len(report.Manifests)),
+		"blobs":     strconv.Itoa(len(report.Blobs)),
+	}).Succeeded()
+	logger.WithFields(logrus.Fields{
+		"images":    len(report.Removed),
+		"manifests": len(report.Manifests),
+		"blobs":     len(report.Blobs),
+	}).Info("Collected registry garbage")
+	return report, nil
+}
+
 // PredictStorageAvailability returns the predicted available storage after
 // a given period for the thin pool data device, the thin pool metadata device,
 // and each tenant filesystem.
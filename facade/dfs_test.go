@@ -301,10 +301,12 @@ func (fdrt *FacadeDfsRegistryTest) TestUpgradeRegistry_ForceLocal(c *gocheck.C)
 func (fdrt *FacadeDfsRegistryTest) TestUpgradeRegistry_ForceLocalButNoRegistry(c *gocheck.C) {
 	fdrt.cleanUpOldRegistry(c)
 
+	// every image is pushed again, e.g. into the registries of the pools
+	fdrt.verifyAllImagesUpgraded(c, "", true)
+
 	err := fdrt.Facade.UpgradeRegistry(fdrt.CTX, "", true)
 
-	c.Assert(err, gocheck.IsNil) // Should report there was no registry to upgrade
-	fdrt.verifyNoImagesUpgraded(c)
+	c.Assert(err, gocheck.IsNil)
 	fdrt.verifyOldRegistryContainerExists(c, false)
 }
 
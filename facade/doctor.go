@@ -0,0 +1,251 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package facade
+
+import (
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/audit"
+	"github.com/control-center/serviced/datastore"
+	"github.com/control-center/serviced/doctor"
+)
+
+// Doctor compares the datastore with the coordinator and reports every
+// inconsistency between them.  If repair is set, it also fixes the issues it
+// can, holding the tenant lock while it repairs anything that belongs to a
+// tenant.  Nodes are only deleted if a check made under that lock still finds
+// them to be stale.
+func (f *Facade) Doctor(ctx datastore.Context, repair bool) (*doctor.Report, error) {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.Doctor"))
+	state, err := f.doctorState(ctx)
+	if err != nil {
+		plog.WithError(err).Debug("Could not load the datastore state")
+		return nil, err
+	}
+	issues, err := f.zzk.CheckCoordinator(state)
+	if err != nil {
+		plog.WithError(err).Debug("Could not check the coordinator")
+		return nil, err
+	}
+	report := &doctor.Report{Issues: issues, Repaired: repair}
+	if !repair {
+		return report, nil
+	}
+
+	alog := f.auditLogger.Message(ctx, "Repaired Coordinator").Action(audit.Repair)
+
+	// repair the issues a tenant at a time, in the order they were found
+	tenantIDs := []string{}
+	byTenant := make(map[string][]int)
+	for i, issue := range issues {
+		if issue.Fix == doctor.FixNone {
+			continue
+		}
+		if _, ok := byTenant[issue.TenantID]; !ok {
+			tenantIDs = append(tenantIDs, issue.TenantID)
+		}
+		byTenant[issue.TenantID] = append(byTenant[issue.TenantID], i)
+	}
+	repaired, failed, resolved := 0, 0, 0
+	for _, tenantID := range tenantIDs {
+		f.repairTenant(ctx, tenantID, func() {
+			// the check ran without the lock, so anything it wants deleted
+			// is checked again now that nothing else can change the tenant
+			current, err := f.currentDeletes(ctx, issues, byTenant[tenantID])
+			for _, i := range byTenant[tenantID] {
+				issue := &issues[i]
+				logger := plog.WithFields(logrus.Fields{
+					"kind":  issue.Kind,
+					"id":    issue.ID,
+					"issue": issue.Message,
+				})
+				if isDelete(issue.Fix) {
+					if err != nil {
+						logger.WithError(err).Warn("Could not check the issue again before repairing it")
+						issue.Error = err.Error()
+						failed++
+						continue
+					} else if !current[keyOf(*issue)] {
+						logger.Info("Issue is no longer present")
+						issue.Resolved = true
+						resolved++
+						continue
+					}
+				}
+				if err := f.repairIssue(ctx, *issue); err == doctor.ErrResolved {
+					logger.Info("Issue is no longer present")
+					issue.Resolved = true
+					resolved++
+					continue
+				} else if err != nil {
+					logger.WithError(err).Warn("Could not repair issue")
+					issue.Error = err.Error()
+					failed++
+					continue
+				}
+				logger.Info("Repaired issue")
+				issue.Repaired = true
+				repaired++
+			}
+		})
+	}
+	alog.WithFields(logrus.Fields{
+		"repaired": repaired,
+		"resolved": resolved,
+		"failed":   failed,
+	}).Succeeded()
+	return report, nil
+}
+
+// repairTenant runs a repair while no one else can change the services of
+// the tenant.  The locks on the coordinator are left alone because the
+// service nodes they are kept on may be what needs repairing.
+func (f *Facade) repairTenant(ctx datastore.Context, tenantID string, repair func()) {
+	if tenantID == "" {
+		repair()
+		return
+	}
+	mutex := getTenantLock(tenantID)
+	mutex.Lock()
+	defer mutex.Unlock()
+	f.ssm.Wait(tenantID)
+	repair()
+}
+
+// repairIssue fixes an issue, going back to the datastore for the issues
+// where the coordinator needs to be rewritten.
+func (f *Facade) repairIssue(ctx datastore.Context, issue doctor.Issue) error {
+	switch issue.Fix {
+	case doctor.FixSyncPool:
+		p, err := f.GetResourcePool(ctx, issue.ID)
+		if err != nil {
+			return err
+		} else if p == nil {
+			return fmt.Errorf("pool %s not found", issue.ID)
+		}
+		return f.zzk.UpdateResourcePool(p)
+	case doctor.FixSyncHost:
+		h, err := f.GetHost(ctx, issue.ID)
+		if err != nil {
+			return err
+		} else if h == nil {
+			return fmt.Errorf("host %s not found", issue.ID)
+		}
+		return f.zzk.AddHost(h)
+	case doctor.FixSyncService:
+		return f.syncService(ctx, issue.TenantID, issue.ID, false, false)
+	}
+	return f.zzk.RepairCoordinator(issue)
+}
+
+// issueKey identifies an issue across checks
+type issueKey struct {
+	Kind   string
+	ID     string
+	PoolID string
+	Path   string
+	Fix    doctor.Fix
+}
+
+func keyOf(issue doctor.Issue) issueKey {
+	return issueKey{Kind: issue.Kind, ID: issue.ID, PoolID: issue.PoolID, Path: issue.Path, Fix: issue.Fix}
+}
+
+// isDelete returns true if the fix deletes from the coordinator
+func isDelete(fix doctor.Fix) bool {
+	return fix == doctor.FixDeleteNode || fix == doctor.FixDeleteState
+}
+
+// currentDeletes reloads the datastore and checks the coordinator again,
+// returning the deletes that are still needed.  It does nothing if none of
+// the given issues is a delete.
+func (f *Facade) currentDeletes(ctx datastore.Context, issues []doctor.Issue, indexes []int) (map[issueKey]bool, error) {
+	current := make(map[issueKey]bool)
+	deletes := false
+	for _, i := range indexes {
+		deletes = deletes || isDelete(issues[i].Fix)
+	}
+	if !deletes {
+		return current, nil
+	}
+	state, err := f.doctorState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	found, err := f.zzk.CheckCoordinator(state)
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range found {
+		if isDelete(issue.Fix) {
+			current[keyOf(issue)] = true
+		}
+	}
+	return current, nil
+}
+
+// doctorState loads the parts of the datastore that are mirrored into the
+// coordinator
+func (f *Facade) doctorState(ctx datastore.Context) (doctor.State, error) {
+	state := doctor.NewState()
+	pools, err := f.poolStore.GetResourcePools(ctx)
+	if err != nil {
+		return state, err
+	}
+	for _, p := range pools {
+		state.Pools[p.ID] = struct{}{}
+	}
+	hosts, err := f.GetHosts(ctx)
+	if err != nil {
+		return state, err
+	}
+	for _, h := range hosts {
+		state.Hosts[h.ID] = h.PoolID
+	}
+	svcs, err := f.getServices(ctx)
+	if err != nil {
+		return state, err
+	}
+	parents := make(map[string]string)
+	for _, svc := range svcs {
+		parents[svc.ID] = svc.ParentServiceID
+	}
+	for _, svc := range svcs {
+		tenantID := svc.ID
+		for parents[tenantID] != "" {
+			tenantID = parents[tenantID]
+		}
+		s := doctor.Service{
+			ID:           svc.ID,
+			PoolID:       svc.PoolID,
+			TenantID:     tenantID,
+			DesiredState: svc.DesiredState,
+		}
+		for _, ep := range svc.Endpoints {
+			for _, p := range ep.PortList {
+				if p.Enabled {
+					s.PublicPorts = append(s.PublicPorts, p.PortAddr)
+				}
+			}
+			for _, v := range ep.VHostList {
+				if v.Enabled {
+					s.VHosts = append(s.VHosts, v.Name)
+				}
+			}
+		}
+		state.Services[svc.ID] = s
+	}
+	return state, nil
+}
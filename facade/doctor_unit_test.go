@@ -0,0 +1,132 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package facade_test
+
+import (
+	"errors"
+
+	"github.com/control-center/serviced/doctor"
+	"github.com/control-center/serviced/domain/host"
+	"github.com/control-center/serviced/domain/pool"
+	"github.com/control-center/serviced/domain/service"
+	"github.com/control-center/serviced/domain/servicedefinition"
+	ssmmocks "github.com/control-center/serviced/scheduler/servicestatemanager/mocks"
+	"github.com/stretchr/testify/mock"
+	. "gopkg.in/check.v1"
+)
+
+func (ft *FacadeUnitTest) setupDoctorState() {
+	ft.poolStore.On("GetResourcePools", ft.ctx).Return([]pool.ResourcePool{{ID: "default"}}, nil)
+	ft.hostStore.On("GetN", ft.ctx, uint64(10000)).Return([]host.Host{{ID: "h1", PoolID: "default"}}, nil)
+	ft.serviceStore.On("GetServices", ft.ctx).Return([]service.Service{
+		{ID: "tenant", PoolID: "default", DesiredState: 1},
+		{
+			ID:              "child",
+			ParentServiceID: "tenant",
+			PoolID:          "default",
+			Endpoints: []service.ServiceEndpoint{
+				{
+					VHostList: []servicedefinition.VHost{{Name: "app", Enabled: true}, {Name: "old"}},
+					PortList:  []servicedefinition.Port{{PortAddr: ":443", Enabled: true}},
+				},
+			},
+		},
+		{ID: "grandchild", ParentServiceID: "child", PoolID: "other"},
+	}, nil)
+}
+
+func (ft *FacadeUnitTest) Test_DoctorReportsIssues(c *C) {
+	ft.setupDoctorState()
+	expected := doctor.State{
+		Pools: map[string]struct{}{"default": {}},
+		Hosts: map[string]string{"h1": "default"},
+		Services: map[string]doctor.Service{
+			"tenant":     {ID: "tenant", PoolID: "default", TenantID: "tenant", DesiredState: 1},
+			"child":      {ID: "child", PoolID: "default", TenantID: "tenant", PublicPorts: []string{":443"}, VHosts: []string{"app"}},
+			"grandchild": {ID: "grandchild", PoolID: "other", TenantID: "tenant"},
+		},
+	}
+	issues := []doctor.Issue{{Severity: doctor.Error, Kind: "pool", ID: "gone", Fix: doctor.FixDeleteNode}}
+	ft.zzk.On("CheckCoordinator", expected).Return(issues, nil)
+
+	report, err := ft.Facade.Doctor(ft.ctx, false)
+	c.Assert(err, IsNil)
+	c.Assert(report.Repaired, Equals, false)
+	c.Assert(report.Issues, DeepEquals, issues)
+	ft.zzk.AssertNotCalled(c, "RepairCoordinator", mock.Anything)
+}
+
+func (ft *FacadeUnitTest) Test_DoctorRepairsIssues(c *C) {
+	ft.setupDoctorState()
+	issues := []doctor.Issue{
+		{Severity: doctor.Error, Kind: "host", ID: "h1", PoolID: "default", Fix: doctor.FixSyncHost},
+		{Severity: doctor.Warning, Kind: "pool", ID: "gone", PoolID: "gone", Path: "/pools/gone", Fix: doctor.FixDeleteNode},
+		{Severity: doctor.Info, Kind: "export", ID: "zope", Path: "/net/export/t/zope", Fix: doctor.FixDeleteNode},
+		{Severity: doctor.Info, Kind: "other", ID: "x"},
+	}
+	ft.zzk.On("CheckCoordinator", mock.AnythingOfType("doctor.State")).Return(issues, nil)
+	h := host.Host{ID: "h1", PoolID: "default"}
+	ft.hostStore.On("Get", ft.ctx, host.HostKey("h1"), mock.AnythingOfType("*host.Host")).
+		Return(nil).
+		Run(func(args mock.Arguments) {
+			*args.Get(2).(*host.Host) = h
+		})
+	ft.zzk.On("AddHost", &h).Return(nil)
+	ft.zzk.On("RepairCoordinator", issues[1]).Return(nil)
+	ft.zzk.On("RepairCoordinator", issues[2]).Return(errors.New("zookeeper is down"))
+
+	report, err := ft.Facade.Doctor(ft.ctx, true)
+	c.Assert(err, IsNil)
+	c.Assert(report.Repaired, Equals, true)
+	c.Assert(report.Issues, HasLen, 4)
+	c.Check(report.Issues[0].Repaired, Equals, true)
+	c.Check(report.Issues[1].Repaired, Equals, true)
+	c.Check(report.Issues[2].Repaired, Equals, false)
+	c.Check(report.Issues[2].Error, Equals, "zookeeper is down")
+	c.Check(report.Issues[3].Repaired, Equals, false)
+	c.Check(report.Issues[3].Error, Equals, "")
+	ft.zzk.AssertExpectations(c)
+}
+
+func (ft *FacadeUnitTest) Test_DoctorFailsIfCheckFails(c *C) {
+	ft.setupDoctorState()
+	ft.zzk.On("CheckCoordinator", mock.AnythingOfType("doctor.State")).Return(nil, errors.New("no zookeeper"))
+	_, err := ft.Facade.Doctor(ft.ctx, true)
+	c.Assert(err, ErrorMatches, "no zookeeper")
+}
+
+func (ft *FacadeUnitTest) Test_DoctorSkipsIssuesResolvedBeforeRepair(c *C) {
+	ft.setupDoctorState()
+	stale := doctor.Issue{Severity: doctor.Error, Kind: "service", ID: "new", PoolID: "default", TenantID: "tenant", Path: "/pools/default/services/new", Fix: doctor.FixDeleteNode}
+	gone := doctor.Issue{Severity: doctor.Error, Kind: "service", ID: "old", PoolID: "default", TenantID: "tenant", Path: "/pools/default/services/old", Fix: doctor.FixDeleteNode}
+
+	// the service was added to the datastore between the check and the repair
+	ft.zzk.On("CheckCoordinator", mock.AnythingOfType("doctor.State")).Return([]doctor.Issue{stale, gone}, nil).Once()
+	ft.zzk.On("CheckCoordinator", mock.AnythingOfType("doctor.State")).Return([]doctor.Issue{gone}, nil).Once()
+	ft.zzk.On("RepairCoordinator", gone).Return(nil)
+	ssm := &ssmmocks.ServiceStateManager{}
+	ssm.On("Wait", "tenant")
+	ft.Facade.SetServiceStateManager(ssm)
+
+	report, err := ft.Facade.Doctor(ft.ctx, true)
+	c.Assert(err, IsNil)
+	c.Assert(report.Issues, HasLen, 2)
+	c.Check(report.Issues[0].Repaired, Equals, false)
+	c.Check(report.Issues[0].Resolved, Equals, true)
+	c.Check(report.Issues[1].Repaired, Equals, true)
+	ft.zzk.AssertNotCalled(c, "RepairCoordinator", stale)
+	ft.zzk.AssertExpectations(c)
+}
@@ -14,6 +14,7 @@
 package facade
 
 import (
+	"sync"
 	"time"
 
 	"github.com/control-center/serviced/audit"
@@ -25,6 +26,7 @@ import (
 	"github.com/control-center/serviced/domain/registry"
 	"github.com/control-center/serviced/domain/service"
 	"github.com/control-center/serviced/domain/serviceconfigfile"
+	"github.com/control-center/serviced/domain/servicedefinition"
 	"github.com/control-center/serviced/domain/servicetemplate"
 	"github.com/control-center/serviced/domain/user"
 	"github.com/control-center/serviced/health"
@@ -90,6 +92,18 @@ type Facade struct {
 	ssm           servicestatemanager.ServiceStateManager
 	isvcsPath     string
 
+	// externalRegistry is set when the docker registry is managed outside
+	// of serviced, so the internal registry is migrated like an old version.
+	externalRegistry bool
+
+	// logOutputs are the cluster-wide log forwarding outputs that are
+	// rendered into the logstash configuration for every tenant.
+	logOutputs []servicedefinition.LogOutput
+
+	restoreMu     sync.Mutex
+	restoreJob    *dfs.RestoreJob
+	restoreFileMu sync.Mutex
+
 	rollingRestartTimeout time.Duration
 }
 
@@ -134,6 +148,10 @@ func (f *Facade) SetMetricsClient(client MetricsClient) { f.metricsClient = clie
 
 func (f *Facade) SetIsvcsPath(path string) { f.isvcsPath = path }
 
+func (f *Facade) SetExternalRegistry(external bool) { f.externalRegistry = external }
+
+func (f *Facade) SetLogOutputs(outputs []servicedefinition.LogOutput) { f.logOutputs = outputs }
+
 func (f *Facade) SetHostExpirationRegistry(hostRegistry auth.HostExpirationRegistryInterface) {
 	f.hostRegistry = hostRegistry
 }
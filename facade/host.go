@@ -266,6 +266,9 @@ func (f *Facade) UpdateHost(ctx datastore.Context, entity *host.Host) error {
 		return alog.Error(err)
 	} else if host == nil {
 		return alog.Error(fmt.Errorf("host does not exist: %s", entity.ID))
+	} else if host.MuxCertificateIssued {
+		// callers do not know about the certificate, so keep it issued
+		entity.MuxCertificateIssued = true
 	}
 
 	// validate the pool exists
@@ -415,6 +418,23 @@ func (f *Facade) ResetHostKey(ctx datastore.Context, hostID string) ([]byte, err
 	return key, alog.Error(err)
 }
 
+// SetHostMuxCertificateIssued records that the master has issued the host a
+// mux certificate, after which muxes no longer accept its calls without one.
+func (f *Facade) SetHostMuxCertificateIssued(ctx datastore.Context, hostID string) error {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.SetHostMuxCertificateIssued"))
+	glog.V(2).Infof("Facade.SetHostMuxCertificateIssued: id=%s", hostID)
+
+	var value host.Host
+	if err := f.hostStore.Get(ctx, host.HostKey(hostID), &value); err != nil {
+		return err
+	}
+	if value.MuxCertificateIssued {
+		return nil
+	}
+	value.MuxCertificateIssued = true
+	return f.hostStore.Put(ctx, host.HostKey(hostID), &value)
+}
+
 // RegisterHost attempts to register a host's keys over ssh, or locally if it's
 // the current host.
 func (f *Facade) RegisterHostKeys(ctx datastore.Context, entity *host.Host, nat utils.URL, keys []byte, prompt bool) error {
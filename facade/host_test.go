@@ -237,3 +237,39 @@ func (s *FacadeIntegrationTest) Test_HostGetKey(t *C) {
 		t.Fatalf("Incorrect IPAddress and HostID after remove host")
 	}
 }
+
+func (s *FacadeIntegrationTest) Test_HostMuxCertificateIssued(t *C) {
+	testid := "deadb10f"
+	poolid := "pool-id"
+
+	rp := pool.New(poolid)
+	err := s.Facade.AddResourcePool(s.CTX, rp)
+	t.Assert(err, IsNil)
+	defer s.Facade.RemoveResourcePool(s.CTX, poolid)
+
+	h, err := host.Build("", "65535", poolid, "", []string{}...)
+	t.Assert(err, IsNil)
+	h.ID = testid
+	_, err = s.Facade.AddHost(s.CTX, h)
+	t.Assert(err, IsNil)
+	defer s.Facade.RemoveHost(s.CTX, testid)
+
+	h2, err := s.Facade.GetHost(s.CTX, testid)
+	t.Assert(err, IsNil)
+	t.Assert(h2.MuxCertificateIssued, Equals, false)
+
+	err = s.Facade.SetHostMuxCertificateIssued(s.CTX, testid)
+	t.Assert(err, IsNil)
+	h2, err = s.Facade.GetHost(s.CTX, testid)
+	t.Assert(err, IsNil)
+	t.Assert(h2.MuxCertificateIssued, Equals, true)
+
+	// updates from callers that do not know about the certificate keep it
+	h2.MuxCertificateIssued = false
+	h2.Memory = 1024
+	err = s.Facade.UpdateHost(s.CTX, h2)
+	t.Assert(err, IsNil)
+	h2, err = s.Facade.GetHost(s.CTX, testid)
+	t.Assert(err, IsNil)
+	t.Assert(h2.MuxCertificateIssued, Equals, true)
+}
@@ -215,6 +215,49 @@ func (f *Facade) GetHostInstances(ctx datastore.Context, since time.Time, hostID
 	return insts, nil
 }
 
+// HostRunsTenant returns true if the host runs an instance of a service in the
+// tenant.  Hosts that are not in the database run nothing.
+func (f *Facade) HostRunsTenant(ctx datastore.Context, hostID, tenantID string) (bool, error) {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.HostRunsTenant"))
+	logger := plog.WithFields(log.Fields{
+		"hostid":   hostID,
+		"tenantid": tenantID,
+	})
+
+	var hst host.Host
+	if err := f.hostStore.Get(ctx, host.HostKey(hostID), &hst); datastore.IsErrNoSuchEntity(err) {
+		logger.Debug("Host not found")
+		return false, nil
+	} else if err != nil {
+		logger.WithError(err).Debug("Could not look up host")
+		return false, err
+	}
+
+	states, err := f.zzk.GetHostStates(ctx, hst.PoolID, hst.ID)
+	if err != nil {
+		logger.WithError(err).Debug("Could not look up running instances")
+		return false, err
+	}
+
+	checked := make(map[string]struct{})
+	for _, state := range states {
+		if _, ok := checked[state.ServiceID]; ok {
+			continue
+		}
+		checked[state.ServiceID] = struct{}{}
+
+		tID, err := f.GetTenantID(ctx, state.ServiceID)
+		if err != nil {
+			logger.WithError(err).WithField("serviceid", state.ServiceID).Debug("Could not look up tenant of service")
+			return false, err
+		}
+		if tID == tenantID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // getInstance calculates the fields of the service instance object.
 func (f *Facade) getInstance(ctx datastore.Context, hst host.Host, svc service.Service, imageUUID string, state zkservice.State) (*service.Instance, error) {
 	logger := plog.WithFields(log.Fields{
@@ -19,6 +19,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/control-center/serviced/datastore"
 	"github.com/control-center/serviced/domain/host"
 	"github.com/control-center/serviced/domain/registry"
 	"github.com/control-center/serviced/domain/service"
@@ -453,3 +454,44 @@ func (ft *FacadeUnitTest) TestGetHostStrategyInstances(c *C) {
 		c.Assert(*result, Equals, expected)
 	}
 }
+
+func (ft *FacadeUnitTest) TestHostRunsTenant(c *C) {
+	hst := host.Host{ID: "testhost", PoolID: "default"}
+	ft.hostStore.On("Get", ft.ctx, host.HostKey("testhost"), mock.AnythingOfType("*host.Host")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*host.Host) = hst
+	})
+	ft.zzk.On("GetHostStates", ft.ctx, "default", "testhost").Return([]zkservice.State{
+		{HostID: "testhost", ServiceID: "childservice", InstanceID: 0},
+		{HostID: "testhost", ServiceID: "childservice", InstanceID: 1},
+	}, nil)
+	ft.serviceStore.On("GetServiceDetails", ft.ctx, "childservice").Return(&service.ServiceDetails{ID: "childservice", ParentServiceID: "tenant"}, nil)
+	ft.serviceStore.On("GetServiceDetails", ft.ctx, "tenant").Return(&service.ServiceDetails{ID: "tenant"}, nil)
+
+	ok, err := ft.Facade.HostRunsTenant(ft.ctx, "testhost", "tenant")
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+
+	ok, err = ft.Facade.HostRunsTenant(ft.ctx, "testhost", "othertenant")
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+}
+
+func (ft *FacadeUnitTest) TestHostRunsTenant_HostNotFound(c *C) {
+	ft.hostStore.On("Get", ft.ctx, host.HostKey("badhost"), mock.AnythingOfType("*host.Host")).Return(datastore.ErrNoSuchEntity{})
+
+	ok, err := ft.Facade.HostRunsTenant(ft.ctx, "badhost", "tenant")
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+}
+
+func (ft *FacadeUnitTest) TestHostRunsTenant_StatesError(c *C) {
+	hst := host.Host{ID: "testhost", PoolID: "default"}
+	ft.hostStore.On("Get", ft.ctx, host.HostKey("testhost"), mock.AnythingOfType("*host.Host")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*host.Host) = hst
+	})
+	ft.zzk.On("GetHostStates", ft.ctx, "default", "testhost").Return(nil, ErrTestZK)
+
+	ok, err := ft.Facade.HostRunsTenant(ft.ctx, "testhost", "tenant")
+	c.Assert(err, Equals, ErrTestZK)
+	c.Assert(ok, Equals, false)
+}
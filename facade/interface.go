@@ -18,6 +18,7 @@ import (
 
 	"github.com/control-center/serviced/dao"
 	"github.com/control-center/serviced/datastore"
+	"github.com/control-center/serviced/dfs"
 	"github.com/control-center/serviced/domain"
 	"github.com/control-center/serviced/health"
 
@@ -90,6 +91,8 @@ type FacadeInterface interface {
 
 	ResetHostKey(ctx datastore.Context, hostID string) ([]byte, error)
 
+	SetHostMuxCertificateIssued(ctx datastore.Context, hostID string) error
+
 	RegisterHostKeys(ctx datastore.Context, entity *host.Host, nat utils.URL, keys []byte, prompt bool) error
 
 	SetHostExpiration(ctx datastore.Context, hostID string, expiration int64)
@@ -136,6 +139,8 @@ type FacadeInterface interface {
 
 	GetHostInstances(ctx datastore.Context, since time.Time, hostid string) ([]service.Instance, error)
 
+	HostRunsTenant(ctx datastore.Context, hostID, tenantID string) (bool, error)
+
 	ListTenants(datastore.Context) ([]string, error)
 
 	GetServiceInstances(ctx datastore.Context, since time.Time, serviceid string) ([]service.Instance, error)
@@ -219,4 +224,8 @@ type FacadeInterface interface {
 	StopService(ctx datastore.Context, request dao.ScheduleServiceRequest) (int, error)
 
 	PauseService(ctx datastore.Context, request dao.ScheduleServiceRequest) (int, error)
+
+	GetRestoreStatus(ctx datastore.Context) (*dfs.RestoreStatus, error)
+
+	CancelRestore(ctx datastore.Context) error
 }
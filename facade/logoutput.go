@@ -0,0 +1,211 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package facade
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/control-center/serviced/domain/servicedefinition"
+	"github.com/control-center/serviced/utils"
+)
+
+// clusterLogOutputs is the owner of the log outputs that get the logs of
+// every tenant
+const clusterLogOutputs = "cluster"
+
+// logOutputCertPrefix is the prefix of the CA certificate files of the log
+// outputs in the logstash config directory
+const logOutputCertPrefix = "output-"
+
+// getOutputsSection renders the log outputs of the cluster and of each tenant
+// into the output section of the logstash configuration.  It also returns the
+// contents of the CA certificate files the outputs refer to, by file name.
+func getOutputsSection(clusterOutputs []servicedefinition.LogOutput, tenantOutputs map[string][]servicedefinition.LogOutput, auditableTypes []string) (string, map[string][]byte) {
+	outputsSection := ""
+	certs := make(map[string][]byte)
+	for _, output := range clusterOutputs {
+		outputsSection += getOutputSection(clusterLogOutputs, "", output, auditableTypes, certs)
+	}
+
+	// keep the tenants in order so the configuration only changes when the
+	// outputs do
+	tenantIDs := make([]string, 0, len(tenantOutputs))
+	for tenantID := range tenantOutputs {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Strings(tenantIDs)
+	for _, tenantID := range tenantIDs {
+		for _, output := range tenantOutputs[tenantID] {
+			outputsSection += getOutputSection(tenantID, tenantID, output, auditableTypes, certs)
+		}
+	}
+	return outputsSection, certs
+}
+
+// getOutputSection renders a single log output, wrapped in the conditional
+// that routes the logs of the tenant (or all tenants if tenantID is empty),
+// the log types and the audit logs of the output.
+func getOutputSection(owner, tenantID string, output servicedefinition.LogOutput, auditableTypes []string, certs map[string][]byte) string {
+	// only application logs have a type, the logs of serviced itself do not
+	conditions := []string{"[fields][type]"}
+	if tenantID != "" {
+		conditions = append(conditions, fmt.Sprintf("[fields][tenantid] == \"%s\"", tenantID))
+	}
+	if len(output.LogTypes) > 0 {
+		conditions = append(conditions, getTypeCondition(output.LogTypes))
+	}
+	switch output.Audit {
+	case servicedefinition.AuditOnly:
+		if len(auditableTypes) == 0 {
+			plog.WithField("output", output.Name).WithField("owner", owner).
+				Debug("No audit logs to forward to log output")
+			return fmt.Sprintf("\n        # %s log output %s skipped, no log types are audited\n", owner, output.Name)
+		}
+		conditions = append(conditions, getTypeCondition(auditableTypes))
+	case servicedefinition.AuditExclude:
+		if len(auditableTypes) > 0 {
+			conditions = append(conditions, "!"+getTypeCondition(auditableTypes))
+		}
+	}
+
+	var plugin string
+	switch output.Type {
+	case servicedefinition.LogOutputSyslog:
+		plugin = getSyslogOutput(owner, output, certs)
+	case servicedefinition.LogOutputKafka:
+		plugin = getKafkaOutput(output)
+	case servicedefinition.LogOutputHTTP:
+		plugin = getHTTPOutput(owner, output, certs)
+	}
+	return fmt.Sprintf("\n        # %s log output %s\n        if %s {\n%s        }\n",
+		owner, output.Name, strings.Join(conditions, " and "), indent(plugin, "            "))
+}
+
+// getTypeCondition matches any of the log types.  It is a list of equality
+// tests because logstash's "in" matches substrings on a list of one.
+func getTypeCondition(logTypes []string) string {
+	tests := make([]string, len(logTypes))
+	for i, logType := range logTypes {
+		tests[i] = fmt.Sprintf("[fields][type] == \"%s\"", logType)
+	}
+	return "(" + strings.Join(tests, " or ") + ")"
+}
+
+// getSyslogOutput sends the message to an RFC5424 syslog server, with the log
+// type as the app name, the instance as the process and the service as the
+// message id.
+func getSyslogOutput(owner string, output servicedefinition.LogOutput, certs map[string][]byte) string {
+	host, port, _ := net.SplitHostPort(output.Address)
+	protocol := "tcp"
+	if output.TLS {
+		protocol = "ssl-tcp"
+	}
+	plugin := fmt.Sprintf(`syslog {
+  host => "%s"
+  port => %s
+  protocol => "%s"
+  rfc => "rfc5424"
+  appname => "%%{[fields][type]}"
+  procid => "%%{[fields][instance]}"
+  msgid => "%%{[fields][service]}"
+  sourcehost => "%%{[fields][ccWorkerID]}"
+`, host, port, protocol)
+	if output.CACert != "" {
+		plugin += fmt.Sprintf("  ssl_cacert => \"%s\"\n  ssl_verify => true\n", addLogOutputCert(owner, output, certs))
+	}
+	return plugin + "}"
+}
+
+// getKafkaOutput sends the event as json to a kafka topic
+func getKafkaOutput(output servicedefinition.LogOutput) string {
+	plugin := fmt.Sprintf(`kafka {
+  bootstrap_servers => "%s"
+  topic_id => "%s"
+  codec => json
+`, output.Address, output.Topic)
+	if output.TLS {
+		plugin += "  security_protocol => \"SSL\"\n"
+	}
+	return plugin + "}"
+}
+
+// getHTTPOutput posts the event as json to a url
+func getHTTPOutput(owner string, output servicedefinition.LogOutput, certs map[string][]byte) string {
+	plugin := fmt.Sprintf(`http {
+  url => "%s"
+  http_method => "post"
+  format => "json"
+`, output.Address)
+	if output.CACert != "" {
+		plugin += fmt.Sprintf("  cacert => \"%s\"\n", addLogOutputCert(owner, output, certs))
+	}
+	if len(output.Headers) > 0 {
+		names := make([]string, 0, len(output.Headers))
+		for name := range output.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		plugin += "  headers => {\n"
+		for _, name := range names {
+			plugin += fmt.Sprintf("    \"%s\" => \"%s\"\n", name, output.Headers[name])
+		}
+		plugin += "  }\n"
+	}
+	return plugin + "}"
+}
+
+// addLogOutputCert adds the CA certificate of the output to the certificate
+// files and returns its path from the perspective of the logstash container.
+// The file name has a digest of the certificate, so that the configuration
+// changes, and logstash reloads, when the certificate does.
+func addLogOutputCert(owner string, output servicedefinition.LogOutput, certs map[string][]byte) string {
+	digest := sha256.Sum256([]byte(output.CACert))
+	name := fmt.Sprintf("%s%s-%s-%x.crt", logOutputCertPrefix, owner, output.Name, digest[:4])
+	certs[name] = []byte(output.CACert)
+	return filepath.Join(utils.LOGSTASH_CONTAINER_DIRECTORY, name)
+}
+
+// writeLogOutputCerts writes the CA certificate files of the log outputs into
+// the logstash config directory and removes those no longer used.
+func writeLogOutputCerts(logstashDir string, certs map[string][]byte) error {
+	current, err := filepath.Glob(filepath.Join(logstashDir, logOutputCertPrefix+"*.crt"))
+	if err != nil {
+		return err
+	}
+	for _, certFile := range current {
+		if _, ok := certs[filepath.Base(certFile)]; !ok {
+			if err := os.Remove(certFile); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	for name, contents := range certs {
+		certFile := filepath.Join(logstashDir, name)
+		if original, err := ioutil.ReadFile(certFile); err == nil && bytes.Equal(original, contents) {
+			continue
+		}
+		if err := ioutil.WriteFile(certFile, contents, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
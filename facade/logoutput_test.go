@@ -0,0 +1,145 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package facade
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/control-center/serviced/domain/servicedefinition"
+	"github.com/control-center/serviced/utils"
+
+	. "gopkg.in/check.v1"
+)
+
+const testLogOutputCA = "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+
+func (t *LogStashTest) Test_getOutputsSection_WithNoOutputs(c *C) {
+	section, certs := getOutputsSection(nil, map[string][]servicedefinition.LogOutput{}, []string{"audit"})
+	c.Assert(section, Equals, "")
+	c.Assert(certs, HasLen, 0)
+}
+
+func (t *LogStashTest) Test_getOutputsSection_ClusterSyslog(c *C) {
+	outputs := []servicedefinition.LogOutput{
+		{Name: "siem", Type: servicedefinition.LogOutputSyslog, Address: "siem.example.com:6514", TLS: true, CACert: testLogOutputCA},
+	}
+	section, certs := getOutputsSection(outputs, nil, nil)
+
+	c.Assert(certs, HasLen, 1)
+	var certName string
+	for name, contents := range certs {
+		certName = name
+		c.Assert(string(contents), Equals, testLogOutputCA)
+	}
+	c.Assert(strings.HasPrefix(certName, "output-cluster-siem-"), Equals, true)
+
+	expected := `
+        # cluster log output siem
+        if [fields][type] {
+            syslog {
+              host => "siem.example.com"
+              port => 6514
+              protocol => "ssl-tcp"
+              rfc => "rfc5424"
+              appname => "%{[fields][type]}"
+              procid => "%{[fields][instance]}"
+              msgid => "%{[fields][service]}"
+              sourcehost => "%{[fields][ccWorkerID]}"
+              ssl_cacert => "` + filepath.Join(utils.LOGSTASH_CONTAINER_DIRECTORY, certName) + `"
+              ssl_verify => true
+            }
+        }
+`
+	c.Assert(section, Equals, expected)
+}
+
+func (t *LogStashTest) Test_getOutputsSection_TenantRouting(c *C) {
+	tenantOutputs := map[string][]servicedefinition.LogOutput{
+		"tenant2": {
+			{Name: "hec", Type: servicedefinition.LogOutputHTTP, Address: "https://hec/collector",
+				Headers: map[string]string{"Authorization": "Splunk abc"}, Audit: servicedefinition.AuditExclude},
+		},
+		"tenant1": {
+			{Name: "bus", Type: servicedefinition.LogOutputKafka, Address: "k1:9092,k2:9092", Topic: "logs",
+				TLS: true, LogTypes: []string{"zope", "zenhub"}},
+		},
+	}
+	section, certs := getOutputsSection(nil, tenantOutputs, []string{"audit"})
+	c.Assert(certs, HasLen, 0)
+
+	expected := `
+        # tenant1 log output bus
+        if [fields][type] and [fields][tenantid] == "tenant1" and ([fields][type] == "zope" or [fields][type] == "zenhub") {
+            kafka {
+              bootstrap_servers => "k1:9092,k2:9092"
+              topic_id => "logs"
+              codec => json
+              security_protocol => "SSL"
+            }
+        }
+
+        # tenant2 log output hec
+        if [fields][type] and [fields][tenantid] == "tenant2" and !([fields][type] == "audit") {
+            http {
+              url => "https://hec/collector"
+              http_method => "post"
+              format => "json"
+              headers => {
+                "Authorization" => "Splunk abc"
+              }
+            }
+        }
+`
+	c.Assert(section, Equals, expected)
+}
+
+func (t *LogStashTest) Test_getOutputsSection_AuditOnly(c *C) {
+	outputs := []servicedefinition.LogOutput{
+		{Name: "siem", Type: servicedefinition.LogOutputSyslog, Address: "siem:514", Audit: servicedefinition.AuditOnly},
+	}
+
+	section, _ := getOutputsSection(outputs, nil, []string{"audit", "zauth"})
+	c.Assert(strings.Contains(section, `if [fields][type] and ([fields][type] == "audit" or [fields][type] == "zauth") {`), Equals, true)
+
+	// nothing is forwarded when no logs are audited
+	section, _ = getOutputsSection(outputs, nil, nil)
+	c.Assert(strings.Contains(section, "syslog"), Equals, false)
+}
+
+func (t *LogStashTest) Test_writeLogOutputCerts(c *C) {
+	dir, err := ioutil.TempDir("", "logstash_test")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	stale := filepath.Join(dir, "output-cluster-old-00000000.crt")
+	c.Assert(ioutil.WriteFile(stale, []byte("old"), 0644), IsNil)
+	other := filepath.Join(dir, "filebeat.crt")
+	c.Assert(ioutil.WriteFile(other, []byte("filebeat"), 0644), IsNil)
+
+	certs := map[string][]byte{"output-tenant1-siem-01020304.crt": []byte(testLogOutputCA)}
+	c.Assert(writeLogOutputCerts(dir, certs), IsNil)
+
+	_, err = os.Stat(stale)
+	c.Assert(os.IsNotExist(err), Equals, true)
+	_, err = os.Stat(other)
+	c.Assert(err, IsNil)
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "output-tenant1-siem-01020304.crt"))
+	c.Assert(err, IsNil)
+	c.Assert(string(contents), Equals, testLogOutputCA)
+}
@@ -87,6 +87,7 @@ func (f *Facade) ReloadLogstashConfig(ctx datastore.Context) error {
 	// in cases where two or more versions of a particular service are deployed, we only use
 	// the most recent version to decide which log filters to install
 	serviceLogs := map[string]serviceLogInfo{}
+	tenantOutputs := map[string][]servicedefinition.LogOutput{}
 	for _, tenantID := range tenantIDs {
 		svcs, err := f.GetServices(ctx, dao.ServiceRequest{TenantID: tenantID})
 		if err != nil {
@@ -99,6 +100,9 @@ func (f *Facade) ReloadLogstashConfig(ctx datastore.Context) error {
 		for _, svc := range svcs {
 			if svc.ID == tenantID {
 				tenantVersion = svc.Version
+				if len(svc.LogOutputs) > 0 {
+					tenantOutputs[tenantID] = svc.LogOutputs
+				}
 				break
 			}
 		}
@@ -118,7 +122,9 @@ func (f *Facade) ReloadLogstashConfig(ctx datastore.Context) error {
 	}
 	plog.Debugf("after checking services, auditLogSection=%s", auditLogSection)
 
-	err = writeLogstashConfiguration(filterSection, auditLogSection)
+	outputsSection, outputCerts := getOutputsSection(f.logOutputs, tenantOutputs, auditableTypes)
+
+	err = writeLogstashConfiguration(filterSection, auditLogSection, outputsSection, outputCerts)
 	if err == ErrLogstashUnchanged {
 		return nil
 	} else if err != nil {
@@ -156,12 +162,13 @@ func addServiceLogs(tenantVersion string, svcs []service.Service, serviceLogs ma
 }
 
 // writeLogstashConfiguration takes an array of LogFilter and writes them to the
-// appropriate place in the logstash.conf.
+// appropriate place in the logstash.conf, along with the log outputs and the
+// CA certificate files they use.
 // This is required before logstash startup
 //
 // This method returns nil of logstash configuration was replaced,
 // ErrLogstashUnchanged if the configuration is unchanged, or other errors if there was an I/O problem
-func writeLogstashConfiguration(filterSection, auditLogSection string) error {
+func writeLogstashConfiguration(filterSection, auditLogSection, outputsSection string, outputCerts map[string][]byte) error {
 
 	logstashDir := getLogstashConfigDirectory()
 	newConfigFile := filepath.Join(logstashDir, "logstash.conf.new")
@@ -171,7 +178,13 @@ func writeLogstashConfiguration(filterSection, auditLogSection string) error {
 		"currentconfigfile": originalFile,
 	})
 
-	err := writeLogStashConfigFile(filterSection, auditLogSection, newConfigFile)
+	// the certificates must be in place before logstash loads the new config
+	if err := writeLogOutputCerts(logstashDir, outputCerts); err != nil {
+		logger.WithError(err).Error("Unable to write logstash output certificates")
+		return err
+	}
+
+	err := writeLogStashConfigFile(filterSection, auditLogSection, outputsSection, newConfigFile)
 	if err != nil {
 		logger.WithError(err).Error("Unable to create new logstash config file")
 		return err
@@ -290,7 +303,7 @@ func getAuditLogSection(configs []servicedefinition.LogConfig, auditTypes *[]str
 
 // This method writes out the config file for logstash. It uses
 // the logstash.conf.template and does a variable replacement.
-func writeLogStashConfigFile(filterSection string, auditLogSection string, outputPath string) error {
+func writeLogStashConfigFile(filterSection string, auditLogSection string, outputsSection string, outputPath string) error {
 	// read the log configuration template
 	templatePath := filepath.Join(getLogstashConfigDirectory(), "logstash.conf.template")
 
@@ -325,6 +338,9 @@ filter {
 	if len(auditLogSection) > 0 {
 		newContents = strings.Replace(string(newContents),"${AUDITLOG_SECTION}", auditLogSection, 1)
 	}
+	if len(outputsSection) > 0 {
+		newContents = strings.Replace(newContents, "${OUTPUTS_SECTION}", outputsSection, 1)
+	}
 	newBytes := []byte(newContents)
 	// generate the filters section
 	// write the log file
@@ -641,7 +641,7 @@ func  (t *LogStashTest) TestWritingConfigFile(c *C) {
 	err = tmpfile.Sync()
 	c.Assert(err, IsNil)
 
-	err = writeLogStashConfigFile(filters, auditLogSection, tmpfile.Name())
+	err = writeLogStashConfigFile(filters, auditLogSection, "", tmpfile.Name())
 	c.Assert(err, IsNil)
 
 	// read the contents
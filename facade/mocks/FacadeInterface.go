@@ -3,6 +3,7 @@ package mocks
 import addressassignment "github.com/control-center/serviced/domain/addressassignment"
 import dao "github.com/control-center/serviced/dao"
 import datastore "github.com/control-center/serviced/datastore"
+import dfs "github.com/control-center/serviced/dfs"
 import domain "github.com/control-center/serviced/domain"
 
 import health "github.com/control-center/serviced/health"
@@ -232,6 +233,20 @@ func (_m *FacadeInterface) SetIPs(ctx datastore.Context, assignmentRequest addre
 	return r0
 }
 
+// CancelRestore provides a mock function with given fields: ctx
+func (_m *FacadeInterface) CancelRestore(ctx datastore.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(datastore.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // ClearEmergencyStopFlag provides a mock function with given fields: ctx, serviceID
 func (_m *FacadeInterface) ClearEmergencyStopFlag(ctx datastore.Context, serviceID string) (int, error) {
 	ret := _m.Called(ctx, serviceID)
@@ -613,6 +628,27 @@ func (_m *FacadeInterface) GetHostInstances(ctx datastore.Context, since time.Ti
 	return r0, r1
 }
 
+// HostRunsTenant provides a mock function with given fields: ctx, hostID, tenantID
+func (_m *FacadeInterface) HostRunsTenant(ctx datastore.Context, hostID string, tenantID string) (bool, error) {
+	ret := _m.Called(ctx, hostID, tenantID)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(datastore.Context, string, string) bool); ok {
+		r0 = rf(ctx, hostID, tenantID)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(datastore.Context, string, string) error); ok {
+		r1 = rf(ctx, hostID, tenantID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetHostKey provides a mock function with given fields: ctx, hostID
 func (_m *FacadeInterface) GetHostKey(ctx datastore.Context, hostID string) ([]byte, error) {
 	ret := _m.Called(ctx, hostID)
@@ -797,6 +833,29 @@ func (_m *FacadeInterface) GetResourcePools(ctx datastore.Context) ([]pool.Resou
 	return r0, r1
 }
 
+// GetRestoreStatus provides a mock function with given fields: ctx
+func (_m *FacadeInterface) GetRestoreStatus(ctx datastore.Context) (*dfs.RestoreStatus, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *dfs.RestoreStatus
+	if rf, ok := ret.Get(0).(func(datastore.Context) *dfs.RestoreStatus); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*dfs.RestoreStatus)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(datastore.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetService provides a mock function with given fields: ctx, id
 func (_m *FacadeInterface) GetService(ctx datastore.Context, id string) (*service.Service, error) {
 	ret := _m.Called(ctx, id)
@@ -1520,6 +1579,20 @@ func (_m *FacadeInterface) SetHostExpiration(ctx datastore.Context, hostID strin
 	_m.Called(ctx, hostID, expiration)
 }
 
+// SetHostMuxCertificateIssued provides a mock function with given fields: ctx, hostID
+func (_m *FacadeInterface) SetHostMuxCertificateIssued(ctx datastore.Context, hostID string) error {
+	ret := _m.Called(ctx, hostID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(datastore.Context, string) error); ok {
+		r0 = rf(ctx, hostID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 //StartService provides a mock function with given fields: ctx, ScheduleServiceRequest
 func (_m *FacadeInterface) StartService(ctx datastore.Context, request dao.ScheduleServiceRequest) (int, error) {
 
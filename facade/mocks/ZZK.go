@@ -3,6 +3,7 @@ package mocks
 import "github.com/stretchr/testify/mock"
 
 import "github.com/control-center/serviced/datastore"
+import "github.com/control-center/serviced/doctor"
 import "github.com/control-center/serviced/domain/host"
 import "github.com/control-center/serviced/domain/pool"
 import "github.com/control-center/serviced/domain/registry"
@@ -565,3 +566,36 @@ func (_m *ZZK) UpdateInstanceCurrentState(ctx datastore.Context, poolID, service
 
 	return r0
 }
+func (_m *ZZK) CheckCoordinator(state doctor.State) ([]doctor.Issue, error) {
+	ret := _m.Called(state)
+
+	var r0 []doctor.Issue
+	if rf, ok := ret.Get(0).(func(doctor.State) []doctor.Issue); ok {
+		r0 = rf(state)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]doctor.Issue)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(doctor.State) error); ok {
+		r1 = rf(state)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *ZZK) RepairCoordinator(issue doctor.Issue) error {
+	ret := _m.Called(issue)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(doctor.Issue) error); ok {
+		r0 = rf(issue)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -581,6 +581,7 @@ func (f *Facade) GetReadPools(ctx datastore.Context) ([]pool.ReadPool, error) {
 				MemoryCapacity:    pools[i].MemoryCapacity,
 				MemoryCommitment:  pools[i].MemoryCommitment,
 				ConnectionTimeout: pools[i].ConnectionTimeout,
+				Registry:          pools[i].Registry,
 				Permissions:       pools[i].Permissions,
 			})
 		}
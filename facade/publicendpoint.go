@@ -58,10 +58,21 @@ func (f *Facade) AddPublicEndpointPort(ctx datastore.Context, serviceID, endpoin
 		return nil, alog.Error(err)
 	}
 
+	// UDP ports relay datagrams as they are and cannot be secured with TLS.
+	network := "tcp"
+	if protocol == "udp" {
+		if usetls {
+			err := fmt.Errorf("Invalid port configuration. UDP ports cannot use TLS.")
+			glog.Error(err)
+			return nil, alog.Error(err)
+		}
+		network = "udp"
+	}
+
 	// Check to make sure the port is available.  Don't allow adding a port if it's already being used.
 	// This has the added benefit of validating the port address before it gets added to the service
 	// definition.
-	if err := checkPort("tcp", fmt.Sprintf("%s", portAddr)); err != nil {
+	if err := checkPort(network, fmt.Sprintf("%s", portAddr)); err != nil {
 		glog.Error(err)
 		return nil, alog.Error(err)
 	}
@@ -131,6 +142,15 @@ func (f *Facade) AddPublicEndpointPort(ctx datastore.Context, serviceID, endpoin
 // Try to open the port.  If the port opens, we're good. Otherwise return the error.
 func checkPort(network string, laddr string) error {
 	glog.V(2).Infof("Checking %s port %s", network, laddr)
+	if network == "udp" {
+		conn, err := net.ListenPacket(network, laddr)
+		if err != nil {
+			glog.V(2).Infof("Port Listen failed; something else is using this port.")
+			return err
+		}
+		conn.Close()
+		return nil
+	}
 	listener, err := net.Listen(network, laddr)
 	if err != nil {
 		// Port isn't available.
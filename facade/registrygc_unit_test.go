@@ -0,0 +1,47 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package facade_test
+
+import (
+	"errors"
+
+	"github.com/control-center/serviced/dfs"
+	"github.com/control-center/serviced/domain/service"
+	. "gopkg.in/check.v1"
+)
+
+func (ft *FacadeUnitTest) Test_CollectRegistryGarbage(c *C) {
+	ft.serviceStore.On("GetServices", ft.ctx).Return([]service.Service{
+		{ID: "tenant", ImageID: "localhost:5000/tenant/repo"},
+		{ID: "child", ParentServiceID: "tenant", ImageID: "localhost:5000/tenant/other:1.0"},
+		{ID: "meta", ParentServiceID: "tenant"},
+	}, nil)
+	expected := &dfs.RegistryGCReport{DryRun: true, Removed: []string{"tenant/repo:old"}}
+	ft.dfs.On("CollectRegistryGarbage", []string{"localhost:5000/tenant/repo", "localhost:5000/tenant/other:1.0"}, true).Return(expected, nil)
+
+	report, err := ft.Facade.CollectRegistryGarbage(ft.ctx, true)
+	c.Assert(err, IsNil)
+	c.Assert(report, Equals, expected)
+}
+
+func (ft *FacadeUnitTest) Test_CollectRegistryGarbageFails(c *C) {
+	ft.serviceStore.On("GetServices", ft.ctx).Return([]service.Service{}, nil)
+	expected := errors.New("registry is down")
+	ft.dfs.On("CollectRegistryGarbage", []string{}, false).Return(nil, expected)
+
+	_, err := ft.Facade.CollectRegistryGarbage(ft.ctx, false)
+	c.Assert(err, Equals, expected)
+}
@@ -0,0 +1,79 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package facade
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&RegistryVersionTest{})
+
+type RegistryVersionTest struct {
+	facade *Facade
+	root   string
+}
+
+func (t *RegistryVersionTest) SetUpTest(c *C) {
+	var err error
+	t.root, err = ioutil.TempDir("", "registryversion-")
+	c.Assert(err, IsNil)
+	t.facade = New()
+	t.facade.SetIsvcsPath(t.root)
+}
+
+func (t *RegistryVersionTest) TearDownTest(c *C) {
+	os.RemoveAll(t.root)
+}
+
+func (t *RegistryVersionTest) mkRegistry(c *C, rootDir string) {
+	c.Assert(os.MkdirAll(filepath.Join(t.root, registryRootSubdir, rootDir), 0755), IsNil)
+}
+
+func (t *RegistryVersionTest) TestInternalRegistry(c *C) {
+	t.mkRegistry(c, "v2")
+	isMigrated, version, err := t.facade.getPreviousRegistryVersion()
+	c.Assert(err, IsNil)
+	c.Assert(isMigrated, Equals, false)
+	c.Assert(version, Equals, t.facade.registryVersionInUse())
+}
+
+func (t *RegistryVersionTest) TestExternalRegistry(c *C) {
+	t.facade.SetExternalRegistry(true)
+	t.mkRegistry(c, "registry")
+	t.mkRegistry(c, "v2")
+	isMigrated, version, err := t.facade.getPreviousRegistryVersion()
+	c.Assert(err, IsNil)
+	c.Assert(isMigrated, Equals, false)
+	c.Assert(version, Equals, currentRegistryVersion)
+
+	c.Assert(t.facade.markLocalDockerRegistryUpgraded(currentRegistryVersion), IsNil)
+	isMigrated, version, err = t.facade.getPreviousRegistryVersion()
+	c.Assert(err, IsNil)
+	c.Assert(isMigrated, Equals, true)
+	c.Assert(version, Equals, currentRegistryVersion)
+}
+
+func (t *RegistryVersionTest) TestExternalRegistryNoInternal(c *C) {
+	t.facade.SetExternalRegistry(true)
+	isMigrated, version, err := t.facade.getPreviousRegistryVersion()
+	c.Assert(err, IsNil)
+	c.Assert(isMigrated, Equals, false)
+	c.Assert(version, Equals, t.facade.registryVersionInUse())
+}
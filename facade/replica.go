@@ -0,0 +1,403 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package facade
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/audit"
+	"github.com/control-center/serviced/datastore"
+	"github.com/control-center/serviced/dfs"
+	"github.com/control-center/serviced/dfs/replica"
+)
+
+const (
+	// replicaTagPrefix tags the snapshots taken for a standby master
+	replicaTagPrefix = "replica-"
+	replicaInfoFile  = "REPLICA.json"
+	promotingFile    = "PROMOTING"
+	promotedFile     = "PROMOTED"
+)
+
+// Replicate sends a snapshot of every tenant, along with the templates and
+// resource pools of the master, to a standby master.  Snapshots are sent as a
+// delta of the last snapshot received by the standby where possible.
+func (f *Facade) Replicate(ctx datastore.Context, standby replica.Standby, snapshotSpacePercent int) error {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.Replicate"))
+	stime := time.Now()
+	logger := plog.WithField("standby", standby.Address())
+	alog := f.auditLogger.Message(ctx, "Replicated to Standby Master").
+		Action(audit.Replicate).
+		WithField("standby", standby.Address())
+
+	status, err := standby.Status()
+	if err != nil {
+		logger.WithError(err).Debug("Could not get the status of the standby master")
+		return alog.Error(err)
+	}
+	templates, _, err := f.GetServiceTemplatesAndImages(ctx)
+	if err != nil {
+		logger.WithError(err).Debug("Could not get service templates")
+		return alog.Error(err)
+	}
+	pools, err := f.GetResourcePools(ctx)
+	if err != nil {
+		logger.WithError(err).Debug("Could not get resource pools")
+		return alog.Error(err)
+	}
+	tenants, err := f.GetTenantIDs(ctx)
+	if err != nil {
+		logger.WithError(err).Debug("Could not get tenants")
+		return alog.Error(err)
+	}
+	snapshots := make([]string, len(tenants))
+	for i, tenant := range tenants {
+		snapshot, err := f.replicateTenant(ctx, standby, status, tenant, stime, snapshotSpacePercent)
+		if err != nil {
+			return alog.Error(err)
+		}
+		snapshots[i] = snapshot
+	}
+	info := dfs.BackupInfo{
+		Templates:     templates,
+		Pools:         pools,
+		Snapshots:     snapshots,
+		Timestamp:     stime,
+		BackupVersion: 1,
+	}
+	if err := standby.SendInfo(info); err != nil {
+		logger.WithError(err).Debug("Could not send replica info to the standby master")
+		return alog.Error(err)
+	}
+	logger.WithField("elapsed", time.Since(stime)).Info("Replicated to standby master")
+	alog.WithField("snapshots", strconv.Itoa(len(snapshots))).Succeeded()
+	return nil
+}
+
+// replicateTenant snapshots a tenant and sends the snapshot to the standby.
+// Older replica snapshots of the tenant are deleted once the standby has the
+// new one.
+func (f *Facade) replicateTenant(ctx datastore.Context, standby replica.Standby, status *dfs.ReplicaStatus, tenantID string, stime time.Time, snapshotSpacePercent int) (string, error) {
+	logger := plog.WithField("tenant", tenantID)
+	previous, err := f.replicaSnapshots(tenantID)
+	if err != nil {
+		logger.WithError(err).Debug("Could not get replica snapshots")
+		return "", err
+	}
+
+	// the parent of the delta is the newest snapshot that the standby has
+	received := make(map[string]struct{})
+	for _, snapshotID := range status.Snapshots[tenantID] {
+		received[snapshotID] = struct{}{}
+	}
+	parentID := ""
+	for i := len(previous) - 1; i >= 0; i-- {
+		if _, ok := received[previous[i]]; ok {
+			parentID = previous[i]
+			break
+		}
+	}
+
+	if err := f.DFSLock(ctx).LockWithTimeout("replicate snapshot", userLockTimeout); err != nil {
+		logger.WithError(err).Debug("Could not lock the dfs")
+		return "", err
+	}
+	tag := replicaTagPrefix + stime.UTC().Format("20060102-150405")
+	snapshotID, err := f.Snapshot(ctx, tenantID, "replica for "+standby.Address(), []string{tag}, snapshotSpacePercent)
+	f.DFSLock(ctx).Unlock()
+	if err != nil {
+		logger.WithError(err).Debug("Could not snapshot tenant")
+		return "", err
+	}
+	logger = logger.WithField("snapshot", snapshotID)
+
+	if err := f.sendReplica(standby, tenantID, snapshotID, parentID, status); err != nil {
+		// keep the parent so the next replication can still send a delta
+		if err := f.dfs.Delete(snapshotID); err != nil {
+			logger.WithError(err).Warn("Could not delete replica snapshot")
+		}
+		return "", err
+	}
+	for _, snapshot := range previous {
+		if err := f.dfs.Delete(snapshot); err != nil {
+			logger.WithError(err).WithField("previous", snapshot).Warn("Could not delete previous replica snapshot")
+		}
+	}
+	return snapshotID, nil
+}
+
+// sendReplica sends a snapshot and the images that it needs to the standby
+func (f *Facade) sendReplica(standby replica.Standby, tenantID, snapshotID, parentID string, status *dfs.ReplicaStatus) error {
+	logger := plog.WithFields(logrus.Fields{
+		"tenant":   tenantID,
+		"snapshot": snapshotID,
+		"parent":   parentID,
+	})
+	images, err := f.dfs.ReplicaImages(snapshotID)
+	if err != nil {
+		logger.WithError(err).Debug("Could not get the images of the snapshot")
+		return err
+	}
+	ids := make([]string, len(images))
+	for i, image := range images {
+		ids[i] = image.ID
+	}
+	missing, err := standby.MissingImages(ids)
+	if err != nil {
+		logger.WithError(err).Debug("Could not get the images missing from the standby master")
+		return err
+	}
+	if len(missing) > 0 {
+		isMissing := make(map[string]struct{})
+		for _, id := range missing {
+			isMissing[id] = struct{}{}
+		}
+		var names []string
+		for _, image := range images {
+			if _, ok := isMissing[image.ID]; ok {
+				names = append(names, image.Name)
+			}
+		}
+		logger.WithField("images", names).Info("Sending images to the standby master")
+		if err := standby.SendImages(func(w io.Writer) error {
+			return f.dfs.SaveImages(names, w)
+		}); err != nil {
+			logger.WithError(err).Debug("Could not send images to the standby master")
+			return err
+		}
+	}
+	format, err := f.dfs.ReplicaFormat(snapshotID, parentID, status.DriverType)
+	if err != nil {
+		logger.WithError(err).Debug("Could not choose a replica format")
+		return err
+	}
+	logger = logger.WithField("format", format)
+	logger.Info("Sending snapshot to the standby master")
+	if err := standby.SendSnapshot(tenantID, snapshotID, format, func(w io.Writer) error {
+		return f.dfs.SendReplica(snapshotID, parentID, format, w)
+	}); err != nil {
+		logger.WithError(err).Debug("Could not send snapshot to the standby master")
+		return err
+	}
+	return nil
+}
+
+// replicaSnapshots returns the replica snapshots of a tenant, oldest first
+func (f *Facade) replicaSnapshots(tenantID string) ([]string, error) {
+	snapshots, err := f.dfs.List(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	var infos []dfs.SnapshotInfo
+	for _, snapshotID := range snapshots {
+		info, err := f.dfs.Info(snapshotID)
+		if err != nil {
+			plog.WithError(err).WithField("snapshot", snapshotID).Debug("Could not get info for snapshot")
+			continue
+		}
+		if isReplicaSnapshot(info) {
+			infos = append(infos, *info)
+		}
+	}
+	sort.Sort(snapshotsByCreated(infos))
+	ids := make([]string, len(infos))
+	for i, info := range infos {
+		ids[i] = info.Name
+	}
+	return ids, nil
+}
+
+func isReplicaSnapshot(info *dfs.SnapshotInfo) bool {
+	for _, tag := range info.Tags {
+		if strings.HasPrefix(tag, replicaTagPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type snapshotsByCreated []dfs.SnapshotInfo
+
+func (s snapshotsByCreated) Len() int           { return len(s) }
+func (s snapshotsByCreated) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s snapshotsByCreated) Less(i, j int) bool { return s[i].Created.Before(s[j].Created) }
+
+// ReplicaStatus returns the snapshots that the standby master has received
+func (f *Facade) ReplicaStatus(ctx datastore.Context) (*dfs.ReplicaStatus, error) {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.ReplicaStatus"))
+	return f.dfs.ReplicaStatus()
+}
+
+// MissingReplicaImages returns the image ids that the standby master does not
+// have.
+func (f *Facade) MissingReplicaImages(ctx datastore.Context, ids []string) ([]string, error) {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.MissingReplicaImages"))
+	return f.dfs.MissingImages(ids)
+}
+
+// ReceiveReplicaImages loads images sent by the primary master
+func (f *Facade) ReceiveReplicaImages(ctx datastore.Context, r io.Reader) error {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.ReceiveReplicaImages"))
+	if f.isPromoting() {
+		return replica.ErrPromoted
+	}
+	return f.dfs.LoadImages(r)
+}
+
+// ReceiveReplica loads a snapshot sent by the primary master
+func (f *Facade) ReceiveReplica(ctx datastore.Context, tenantID, snapshotID, format string, r io.Reader) error {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.ReceiveReplica"))
+	if f.isPromoting() {
+		return replica.ErrPromoted
+	}
+	if err := f.DFSLock(ctx).LockWithTimeout("receive replica", userLockTimeout); err != nil {
+		plog.WithError(err).Debug("Could not lock the dfs")
+		return err
+	}
+	defer f.DFSLock(ctx).Unlock()
+	return f.dfs.ReceiveReplica(tenantID, snapshotID, format, r)
+}
+
+// UpdateReplicaInfo saves the templates, pools and snapshots of the last
+// replication, and deletes the snapshots that it replaces.
+func (f *Facade) UpdateReplicaInfo(ctx datastore.Context, info dfs.BackupInfo) error {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.UpdateReplicaInfo"))
+	if f.isPromoting() {
+		return replica.ErrPromoted
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(f.isvcsPath, "replica")
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		plog.WithError(err).WithField("path", dir).Debug("Could not create replica directory")
+		return err
+	}
+	// write the file atomically so a promotion never reads a partial file
+	tmpFile := filepath.Join(dir, replicaInfoFile+".tmp")
+	if err := ioutil.WriteFile(tmpFile, data, 0640); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile, filepath.Join(dir, replicaInfoFile)); err != nil {
+		return err
+	}
+
+	current := make(map[string]struct{})
+	for _, snapshotID := range info.Snapshots {
+		current[snapshotID] = struct{}{}
+	}
+	status, err := f.dfs.ReplicaStatus()
+	if err != nil {
+		return err
+	}
+	for _, snapshots := range status.Snapshots {
+		for _, snapshotID := range snapshots {
+			if _, ok := current[snapshotID]; ok {
+				continue
+			}
+			if snapshotInfo, err := f.dfs.Info(snapshotID); err == nil && isReplicaSnapshot(snapshotInfo) {
+				if err := f.dfs.Delete(snapshotID); err != nil {
+					plog.WithError(err).WithField("snapshot", snapshotID).Warn("Could not delete previous replica snapshot")
+				}
+			}
+		}
+	}
+	plog.WithField("snapshots", info.Snapshots).Info("Updated replica from the primary master")
+	return nil
+}
+
+// PromoteReplica makes this standby master the primary by loading the
+// templates, pools and services of the last replication.  The master stops
+// accepting replicas when the promotion starts.  A promotion that fails
+// partway can be run again until one succeeds.
+func (f *Facade) PromoteReplica(ctx datastore.Context) error {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.PromoteReplica"))
+	alog := f.auditLogger.Message(ctx, "Promoted Standby Master").Action(audit.Promote)
+	if f.isPromoted() {
+		return alog.Error(replica.ErrPromoted)
+	}
+	dir := filepath.Join(f.isvcsPath, "replica")
+	data, err := ioutil.ReadFile(filepath.Join(dir, replicaInfoFile))
+	if os.IsNotExist(err) {
+		return alog.Error(replica.ErrNoReplica)
+	} else if err != nil {
+		return alog.Error(err)
+	}
+	var info dfs.BackupInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		plog.WithError(err).Debug("Could not decode replica info")
+		return alog.Error(err)
+	}
+	if err := f.DFSLock(ctx).LockWithTimeout("promote replica", userLockTimeout); err != nil {
+		plog.WithError(err).Debug("Could not lock the dfs")
+		return alog.Error(err)
+	}
+	defer f.DFSLock(ctx).Unlock()
+
+	// stop accepting replicas before changing anything.  The marker stays if
+	// the promotion fails, so it can be retried without the primary sending
+	// another replica in the meantime.
+	promoting := filepath.Join(dir, promotingFile)
+	if err := ioutil.WriteFile(promoting, []byte(time.Now().UTC().Format(time.RFC3339)), 0640); err != nil {
+		plog.WithError(err).Debug("Could not mark the standby master as promoting")
+		return alog.Error(err)
+	}
+	if err := f.RestoreServiceTemplates(ctx, info.Templates); err != nil {
+		plog.WithError(err).Debug("Could not restore service templates")
+		return alog.Error(err)
+	}
+	if err := f.RestoreResourcePools(ctx, info.Pools); err != nil {
+		plog.WithError(err).Debug("Could not restore resource pools")
+		return alog.Error(err)
+	}
+	for _, snapshot := range info.Snapshots {
+		if err := f.Rollback(ctx, snapshot, false); err != nil {
+			plog.WithError(err).WithField("snapshot", snapshot).Debug("Could not roll back to replica snapshot")
+			return alog.Error(err)
+		}
+	}
+	if err := os.Rename(promoting, filepath.Join(dir, promotedFile)); err != nil {
+		plog.WithError(err).Debug("Could not mark the standby master as promoted")
+		return alog.Error(err)
+	}
+	plog.WithField("replicatedat", info.Timestamp).Info("Promoted standby master")
+	alog.WithField("replicatedat", info.Timestamp.UTC().Format(time.RFC3339)).Succeeded()
+	return nil
+}
+
+// isPromoted returns true if a promotion has finished
+func (f *Facade) isPromoted() bool {
+	_, err := os.Stat(filepath.Join(f.isvcsPath, "replica", promotedFile))
+	return err == nil
+}
+
+// isPromoting returns true if a promotion has started, whether or not it
+// finished
+func (f *Facade) isPromoting() bool {
+	if f.isPromoted() {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(f.isvcsPath, "replica", promotingFile))
+	return err == nil
+}
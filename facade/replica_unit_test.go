@@ -0,0 +1,123 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package facade_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/control-center/serviced/datastore"
+	"github.com/control-center/serviced/dfs"
+	"github.com/control-center/serviced/dfs/replica"
+	"github.com/control-center/serviced/domain/servicetemplate"
+	"github.com/control-center/serviced/facade"
+	"github.com/control-center/serviced/volume"
+	. "gopkg.in/check.v1"
+)
+
+func (ft *FacadeUnitTest) Test_ReceiveReplica(c *C) {
+	ft.Facade.SetIsvcsPath(c.MkDir())
+	ft.setupMockDFSLocking()
+	r := bytes.NewBufferString("delta")
+	ft.dfs.On("ReceiveReplica", "tenant", "tenant_2", dfs.ReplicaDelta, r).Return(nil)
+
+	err := ft.Facade.ReceiveReplica(ft.ctx, "tenant", "tenant_2", dfs.ReplicaDelta, r)
+	c.Assert(err, IsNil)
+	ft.dfs.AssertCalled(c, "ReceiveReplica", "tenant", "tenant_2", dfs.ReplicaDelta, r)
+}
+
+func (ft *FacadeUnitTest) Test_ReceiveReplicaAfterPromotion(c *C) {
+	isvcsPath := c.MkDir()
+	ft.Facade.SetIsvcsPath(isvcsPath)
+	c.Assert(os.MkdirAll(filepath.Join(isvcsPath, "replica"), 0750), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(isvcsPath, "replica", "PROMOTED"), []byte{}, 0640), IsNil)
+
+	err := ft.Facade.ReceiveReplica(ft.ctx, "tenant", "tenant_2", dfs.ReplicaDelta, bytes.NewBufferString("delta"))
+	c.Assert(err, Equals, replica.ErrPromoted)
+	err = ft.Facade.UpdateReplicaInfo(ft.ctx, dfs.BackupInfo{BackupVersion: 1})
+	c.Assert(err, Equals, replica.ErrPromoted)
+	err = ft.Facade.PromoteReplica(ft.ctx)
+	c.Assert(err, Equals, replica.ErrPromoted)
+	ft.dfs.AssertNotCalled(c, "ReceiveReplica")
+}
+
+func (ft *FacadeUnitTest) Test_UpdateReplicaInfo(c *C) {
+	isvcsPath := c.MkDir()
+	ft.Facade.SetIsvcsPath(isvcsPath)
+	ft.dfs.On("ReplicaStatus").Return(&dfs.ReplicaStatus{
+		Snapshots: map[string][]string{"tenant": {"tenant_1", "tenant_2", "tenant_manual"}},
+	}, nil)
+	ft.dfs.On("Info", "tenant_1").Return(&dfs.SnapshotInfo{
+		SnapshotInfo: &volume.SnapshotInfo{Name: "tenant_1", Tags: []string{"replica-20161010-101010"}},
+	}, nil)
+	ft.dfs.On("Info", "tenant_manual").Return(&dfs.SnapshotInfo{
+		SnapshotInfo: &volume.SnapshotInfo{Name: "tenant_manual", Tags: []string{"before-upgrade"}},
+	}, nil)
+	ft.dfs.On("Delete", "tenant_1").Return(nil)
+
+	info := dfs.BackupInfo{Snapshots: []string{"tenant_2"}, BackupVersion: 1}
+	err := ft.Facade.UpdateReplicaInfo(ft.ctx, info)
+	c.Assert(err, IsNil)
+	ft.dfs.AssertCalled(c, "Delete", "tenant_1")
+	ft.dfs.AssertNotCalled(c, "Delete", "tenant_manual")
+
+	data, err := ioutil.ReadFile(filepath.Join(isvcsPath, "replica", "REPLICA.json"))
+	c.Assert(err, IsNil)
+	var saved dfs.BackupInfo
+	c.Assert(json.Unmarshal(data, &saved), IsNil)
+	c.Assert(saved.Snapshots, DeepEquals, []string{"tenant_2"})
+}
+
+func (ft *FacadeUnitTest) Test_PromoteReplicaWithoutReplica(c *C) {
+	ft.Facade.SetIsvcsPath(c.MkDir())
+	err := ft.Facade.PromoteReplica(ft.ctx)
+	c.Assert(err, Equals, replica.ErrNoReplica)
+}
+
+func (ft *FacadeUnitTest) Test_PromoteReplicaRetryAfterFailure(c *C) {
+	isvcsPath := c.MkDir()
+	ft.Facade.SetIsvcsPath(isvcsPath)
+	ft.setupMockDFSLocking()
+	c.Assert(os.MkdirAll(filepath.Join(isvcsPath, "replica"), 0750), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(isvcsPath, "replica", "REPLICA.json"), []byte(`{"BackupVersion":1}`), 0640), IsNil)
+	ft.templateStore.On("GetServiceTemplates", ft.ctx).Return(nil, errors.New("no datastore")).Once()
+	reloader := facade.LogstashContainerReloader
+	facade.LogstashContainerReloader = func(datastore.Context, facade.FacadeInterface) error { return nil }
+	defer func() { facade.LogstashContainerReloader = reloader }()
+
+	err := ft.Facade.PromoteReplica(ft.ctx)
+	c.Assert(err, ErrorMatches, "no datastore")
+	_, err = os.Stat(filepath.Join(isvcsPath, "replica", "PROMOTED"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	// the primary cannot send replicas while the promotion is unfinished
+	err = ft.Facade.ReceiveReplica(ft.ctx, "tenant", "tenant_2", dfs.ReplicaDelta, bytes.NewBufferString("delta"))
+	c.Assert(err, Equals, replica.ErrPromoted)
+	err = ft.Facade.UpdateReplicaInfo(ft.ctx, dfs.BackupInfo{BackupVersion: 1})
+	c.Assert(err, Equals, replica.ErrPromoted)
+
+	ft.templateStore.On("GetServiceTemplates", ft.ctx).Return([]*servicetemplate.ServiceTemplate{}, nil)
+	c.Assert(ft.Facade.PromoteReplica(ft.ctx), IsNil)
+	_, err = os.Stat(filepath.Join(isvcsPath, "replica", "PROMOTED"))
+	c.Assert(err, IsNil)
+	_, err = os.Stat(filepath.Join(isvcsPath, "replica", "PROMOTING"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+	c.Assert(ft.Facade.PromoteReplica(ft.ctx), Equals, replica.ErrPromoted)
+}
@@ -0,0 +1,294 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package facade
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/audit"
+	"github.com/control-center/serviced/datastore"
+	"github.com/control-center/serviced/dfs"
+)
+
+const restoreStatusFile = "RESTORE.json"
+
+var (
+	// ErrRestoreRunning is returned when a restore is started while another
+	// restore is running
+	ErrRestoreRunning = errors.New("facade: a restore is already running")
+	// ErrNoRestoreRunning is returned when cancelling a restore that is not
+	// running
+	ErrNoRestoreRunning = errors.New("facade: no restore is running")
+	// ErrNoRestoreToResume is returned when there is no unfinished restore of
+	// the backup file
+	ErrNoRestoreToResume = errors.New("facade: no unfinished restore of the backup file")
+	// errRestoreInterrupted is the error of a restore that was running when
+	// the master stopped
+	errRestoreInterrupted = errors.New("restore was interrupted")
+)
+
+// Restore restores application data from a backup.
+func (f *Facade) Restore(ctx datastore.Context, r io.Reader, backupInfo *dfs.BackupInfo, backupFilename string) error {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.Restore"))
+	// Do not DFSLock here, ControlPlaneDao does that
+	return f.runRestore(ctx, r, backupInfo, dfs.RestoreStatus{Filename: backupFilename})
+}
+
+// ResumeRestore restores application data from a backup, skipping the phases
+// that an earlier restore of the same backup file completed before it failed
+// or was cancelled.
+func (f *Facade) ResumeRestore(ctx datastore.Context, r io.Reader, backupInfo *dfs.BackupInfo, backupFilename string) error {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.ResumeRestore"))
+	// Do not DFSLock here, ControlPlaneDao does that
+	status, err := f.loadRestoreStatus()
+	if err != nil {
+		return err
+	} else if status == nil || status.Filename != backupFilename || status.State == dfs.RestoreDone {
+		return ErrNoRestoreToResume
+	}
+	plog.WithField("backupfile", backupFilename).Info("Resuming restore from backup")
+	return f.runRestore(ctx, r, backupInfo, *status)
+}
+
+// GetRestoreStatus returns the progress of the running restore, or of the
+// last restore if none is running.  It returns nil if there has been no
+// restore.
+func (f *Facade) GetRestoreStatus(ctx datastore.Context) (*dfs.RestoreStatus, error) {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.GetRestoreStatus"))
+	f.restoreMu.Lock()
+	defer f.restoreMu.Unlock()
+	if f.restoreJob != nil {
+		status := f.restoreJob.Status()
+		return &status, nil
+	}
+	status, err := f.loadRestoreStatus()
+	if err != nil {
+		return nil, err
+	}
+	if status != nil && status.State == dfs.RestoreRunning {
+		// the master stopped during the restore
+		status.State, status.Error = dfs.RestoreFailed, errRestoreInterrupted.Error()
+	}
+	return status, nil
+}
+
+// CancelRestore stops the running restore at the end of its current unit of
+// work.  The restore can be resumed later.
+func (f *Facade) CancelRestore(ctx datastore.Context) error {
+	defer ctx.Metrics().Stop(ctx.Metrics().Start("Facade.CancelRestore"))
+	alog := f.auditLogger.Message(ctx, "Cancelled Restoring from Backup").Action(audit.Restore)
+	f.restoreMu.Lock()
+	defer f.restoreMu.Unlock()
+	if f.restoreJob == nil {
+		return alog.Error(ErrNoRestoreRunning)
+	}
+	f.restoreJob.Cancel()
+	plog.Info("Cancelled restore from backup")
+	alog.WithField("backupfile", f.restoreJob.Status().Filename).Succeeded()
+	return nil
+}
+
+// runRestore runs the phases of a restore that are not done, and saves the
+// progress of the restore as each phase starts and ends.
+func (f *Facade) runRestore(ctx datastore.Context, r io.Reader, backupInfo *dfs.BackupInfo, status dfs.RestoreStatus) error {
+	job := dfs.NewRestoreJob(status)
+	job.OnUpdate = func(status dfs.RestoreStatus) {
+		if err := f.saveRestoreStatus(status); err != nil {
+			plog.WithError(err).Warn("Could not save the progress of the restore")
+		}
+	}
+	f.restoreMu.Lock()
+	if f.restoreJob != nil {
+		f.restoreMu.Unlock()
+		return ErrRestoreRunning
+	}
+	f.restoreJob = job
+	f.restoreMu.Unlock()
+	defer func() {
+		f.restoreMu.Lock()
+		f.restoreJob = nil
+		f.restoreMu.Unlock()
+	}()
+
+	stime := time.Now()
+	plog.Info("Started restore from backup")
+	alog := f.auditLogger.Message(ctx, "Started Restoring from Backup").Action(audit.Restore).
+		WithFields(logrus.Fields{
+			"backupfile": status.Filename,
+			"starttime":  stime.UTC().Format("2006-01-02-150405"),
+		})
+	alog.Succeeded()
+
+	// show the phases that are left
+	phases := []string{dfs.RestorePhaseImages}
+	if backupInfo.BackupVersion > 0 {
+		for _, snapshot := range backupInfo.Snapshots {
+			phases = append(phases, dfs.RestoreVolumePhase(snapshot))
+		}
+	}
+	for _, snapshot := range backupInfo.Snapshots {
+		phases = append(phases, dfs.RestoreRegistryPhase(snapshot))
+	}
+	phases = append(phases, dfs.RestorePhaseTemplates, dfs.RestorePhasePools)
+	for _, snapshot := range backupInfo.Snapshots {
+		phases = append(phases, dfs.RestoreServicesPhase(snapshot))
+	}
+	job.Plan(phases...)
+
+	err := f.restorePhases(ctx, r, backupInfo, job)
+	job.Complete(err)
+	if err != nil {
+		return alog.Error(err)
+	}
+	restoreDuration := time.Since(stime)
+	plog.Info("Completed restore from backup")
+	alog = f.auditLogger.Message(ctx, "Completed Restoring from Backup").Action(audit.Restore).
+		WithFields(logrus.Fields{
+			"backupfile": status.Filename,
+			"elapsed":    fmt.Sprintf("%fsec", restoreDuration.Seconds()),
+		})
+	alog.Succeeded()
+	return nil
+}
+
+func (f *Facade) restorePhases(ctx datastore.Context, r io.Reader, backupInfo *dfs.BackupInfo, job *dfs.RestoreJob) error {
+	if isRestoreDataDone(job, backupInfo) {
+		plog.Info("Skipped images and volumes restored by an earlier run")
+	} else if err := f.dfs.RestoreWithProgress(r, backupInfo.BackupVersion, job); err != nil {
+		plog.WithError(err).Debug("Could not restore from backup")
+		return err
+	}
+
+	if err := runRestorePhase(job, dfs.RestorePhaseTemplates, len(backupInfo.Templates), "templates", func() error {
+		return f.RestoreServiceTemplates(ctx, backupInfo.Templates)
+	}); err != nil {
+		plog.WithError(err).Debug("Could not restore service templates from backup")
+		return err
+	}
+	plog.Infof("Restored service templates")
+	if err := runRestorePhase(job, dfs.RestorePhasePools, len(backupInfo.Pools), "pools", func() error {
+		return f.RestoreResourcePools(ctx, backupInfo.Pools)
+	}); err != nil {
+		plog.WithError(err).Debug("Could not restore resource pools from backup")
+		return err
+	}
+	plog.Info("Restored resource pools")
+	for _, snapshot := range backupInfo.Snapshots {
+		logger := plog.WithField("snapshot", snapshot)
+		if err := runRestorePhase(job, dfs.RestoreServicesPhase(snapshot), 1, "snapshots", func() error {
+			return f.Rollback(ctx, snapshot, false)
+		}); err != nil {
+			logger.WithError(err).Debug("Could not rollback snapshot")
+			return err
+		}
+		logger.Info("Rolled back snapshot")
+		if err := f.dfs.Delete(snapshot); err != nil {
+			// if we couldn't delete, untag it so the TTL reaper will get it eventually
+			info, err := f.dfs.Info(snapshot)
+			if err != nil {
+				logger.WithError(err).Warning("Could not get info for snapshot.")
+			} else if len(info.Tags) > 0 {
+				if _, err := f.dfs.Untag(info.TenantID, info.Tags[0]); err != nil {
+					logger.WithError(err).Warning("Could not untag snapshot.  Snapshot must be deleted manually!")
+				} else {
+					logger.Info("Snapshot from backup untagged.")
+				}
+			}
+		} else {
+			logger.Info("Removed snapshot after rollback")
+		}
+	}
+	return nil
+}
+
+// runRestorePhase runs a phase of the restore unless it is already done.  It
+// stops before the phase if the restore was cancelled.
+func runRestorePhase(job *dfs.RestoreJob, name string, total int, unit string, do func() error) error {
+	if job.IsDone(name) {
+		return nil
+	}
+	if err := job.Err(); err != nil {
+		return err
+	}
+	job.Start(name, int64(total), unit)
+	err := do()
+	if err == nil {
+		job.Add(name, int64(total))
+	}
+	job.Finish(name, err)
+	return err
+}
+
+// isRestoreDataDone returns true if the images, volumes and registry of the
+// backup were restored by an earlier run of the job.
+func isRestoreDataDone(job *dfs.RestoreJob, backupInfo *dfs.BackupInfo) bool {
+	if backupInfo.BackupVersion == 0 || !job.IsDone(dfs.RestorePhaseImages) {
+		return false
+	}
+	for _, snapshot := range backupInfo.Snapshots {
+		if !job.IsDone(dfs.RestoreVolumePhase(snapshot)) || !job.IsDone(dfs.RestoreRegistryPhase(snapshot)) {
+			return false
+		}
+	}
+	return true
+}
+
+// saveRestoreStatus writes the progress of the restore, so that the restore
+// can be resumed after a failure or a restart of the master.
+func (f *Facade) saveRestoreStatus(status dfs.RestoreStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(f.isvcsPath, "restore")
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		plog.WithError(err).WithField("path", dir).Debug("Could not create restore directory")
+		return err
+	}
+	f.restoreFileMu.Lock()
+	defer f.restoreFileMu.Unlock()
+	// write the file atomically so a resume never reads a partial file
+	tmpFile := filepath.Join(dir, restoreStatusFile+".tmp")
+	if err := ioutil.WriteFile(tmpFile, data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, filepath.Join(dir, restoreStatusFile))
+}
+
+// loadRestoreStatus reads the progress of the last restore, or returns nil if
+// there has been no restore.
+func (f *Facade) loadRestoreStatus() (*dfs.RestoreStatus, error) {
+	f.restoreFileMu.Lock()
+	defer f.restoreFileMu.Unlock()
+	data, err := ioutil.ReadFile(filepath.Join(f.isvcsPath, "restore", restoreStatusFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var status dfs.RestoreStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		plog.WithError(err).Debug("Could not decode restore status")
+		return nil, err
+	}
+	return &status, nil
+}
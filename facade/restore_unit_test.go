@@ -0,0 +1,88 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package facade_test
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/control-center/serviced/datastore"
+	"github.com/control-center/serviced/dfs"
+	"github.com/control-center/serviced/domain/servicetemplate"
+	"github.com/control-center/serviced/facade"
+	"github.com/stretchr/testify/mock"
+	. "gopkg.in/check.v1"
+)
+
+func (ft *FacadeUnitTest) Test_RestoreStatusNoRestore(c *C) {
+	ft.Facade.SetIsvcsPath(c.MkDir())
+
+	status, err := ft.Facade.GetRestoreStatus(ft.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(status, IsNil)
+	err = ft.Facade.CancelRestore(ft.ctx)
+	c.Assert(err, Equals, facade.ErrNoRestoreRunning)
+	err = ft.Facade.ResumeRestore(ft.ctx, bytes.NewBufferString(""), &dfs.BackupInfo{BackupVersion: 1}, "/backups/backup.tgz")
+	c.Assert(err, Equals, facade.ErrNoRestoreToResume)
+}
+
+func (ft *FacadeUnitTest) Test_ResumeRestoreSkipsDonePhases(c *C) {
+	ft.Facade.SetIsvcsPath(c.MkDir())
+	reloader := facade.LogstashContainerReloader
+	facade.LogstashContainerReloader = func(datastore.Context, facade.FacadeInterface) error { return nil }
+	defer func() { facade.LogstashContainerReloader = reloader }()
+	info := &dfs.BackupInfo{BackupVersion: 1}
+	filename := "/backups/backup.tgz"
+
+	// the images load, but the templates fail
+	ft.dfs.On("RestoreWithProgress", mock.Anything, 1, mock.AnythingOfType("*dfs.RestoreJob")).Run(func(args mock.Arguments) {
+		job := args.Get(2).(*dfs.RestoreJob)
+		job.Start(dfs.RestorePhaseImages, 0, "bytes")
+		job.Finish(dfs.RestorePhaseImages, nil)
+	}).Return(nil).Once()
+	ErrTemplates := errors.New("could not get templates")
+	ft.templateStore.On("GetServiceTemplates", ft.ctx).Return(nil, ErrTemplates).Once()
+
+	err := ft.Facade.Restore(ft.ctx, bytes.NewBufferString(""), info, filename)
+	c.Assert(err, Equals, ErrTemplates)
+	status, err := ft.Facade.GetRestoreStatus(ft.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(status.Filename, Equals, filename)
+	c.Assert(status.State, Equals, dfs.RestoreFailed)
+	c.Assert(status.Phase(dfs.RestorePhaseImages).State, Equals, dfs.RestoreDone)
+	c.Assert(status.Phase(dfs.RestorePhaseTemplates).State, Equals, dfs.RestoreFailed)
+	c.Assert(status.Phase(dfs.RestorePhasePools).State, Equals, dfs.RestorePending)
+
+	// the restore of another file cannot be resumed
+	err = ft.Facade.ResumeRestore(ft.ctx, bytes.NewBufferString(""), info, "/backups/other.tgz")
+	c.Assert(err, Equals, facade.ErrNoRestoreToResume)
+
+	// the images are not loaded again
+	ft.templateStore.On("GetServiceTemplates", ft.ctx).Return([]*servicetemplate.ServiceTemplate{}, nil)
+	err = ft.Facade.ResumeRestore(ft.ctx, bytes.NewBufferString(""), info, filename)
+	c.Assert(err, IsNil)
+	ft.dfs.AssertNumberOfCalls(c, "RestoreWithProgress", 1)
+	status, err = ft.Facade.GetRestoreStatus(ft.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(status.State, Equals, dfs.RestoreDone)
+	for _, phase := range status.Phases {
+		c.Assert(phase.State, Equals, dfs.RestoreDone)
+	}
+
+	// a completed restore cannot be resumed
+	err = ft.Facade.ResumeRestore(ft.ctx, bytes.NewBufferString(""), info, filename)
+	c.Assert(err, Equals, facade.ErrNoRestoreToResume)
+}
@@ -255,6 +255,18 @@ func validateServiceOptions(svc *service.Service) error {
 			error: "HostPolicy RequireSeparate cannot be used with ChangeOption RestartAllOnInstanceChanged",
 		}
 	}
+	// Only the tenant service has a volume to put a quota on.
+	if svc.ParentServiceID != "" && svc.StorageQuota.Value > 0 {
+		return ErrInvalidServiceOption{
+			error: "StorageQuota can only be set on the tenant service",
+		}
+	}
+	// Only the tenant's application logs are routed by outputs.
+	if svc.ParentServiceID != "" && len(svc.LogOutputs) > 0 {
+		return ErrInvalidServiceOption{
+			error: "LogOutputs can only be set on the tenant service",
+		}
+	}
 	return nil
 }
 
@@ -352,6 +364,19 @@ func (f *Facade) updateService(ctx datastore.Context, tenantID string, svc servi
 		svc.ConfigFiles = nil
 	}
 
+	// apply a new storage quota to the application volume
+	if svc.ParentServiceID == "" && svc.StorageQuota.Value != cursvc.StorageQuota.Value {
+		if svc.StorageQuota.Value > 0 && svc.StorageQuota.Value < cursvc.StorageQuota.Value && !f.dfs.CanLowerQuota() {
+			return ErrInvalidServiceOption{
+				error: "StorageQuota cannot be lowered with the devicemapper storage driver",
+			}
+		}
+		if err := f.dfs.SetQuota(tenantID, svc.StorageQuota.Value); err != nil {
+			glog.Errorf("Could not set storage quota for service %s (%s): %s", svc.Name, svc.ID, err)
+			return err
+		}
+	}
+
 	// write the service into the database
 	svc.UpdatedAt = time.Now()
 	if err := store.Put(ctx, &svc); err != nil {
@@ -2936,7 +2961,7 @@ func (f *Facade) getServicePublicEndpoints(svc service.Service) []service.Public
 				Enabled:     port.Enabled,
 			}
 
-			if strings.HasPrefix(port.Protocol, "http") {
+			if strings.HasPrefix(port.Protocol, "http") || port.Protocol == "udp" {
 				pub.Protocol = port.Protocol
 			} else if port.UseTLS {
 				pub.Protocol = "Other, secure (TLS)"
@@ -34,6 +34,7 @@ import (
 	zzkmocks "github.com/control-center/serviced/facade/mocks"
 	"github.com/control-center/serviced/health"
 	ssmmocks "github.com/control-center/serviced/scheduler/servicestatemanager/mocks"
+	"github.com/control-center/serviced/utils"
 	zks "github.com/control-center/serviced/zzk/service"
 
 	"github.com/stretchr/testify/mock"
@@ -451,6 +452,53 @@ func (ft *FacadeIntegrationTest) TestFacade_validateServiceUpdate_InvalidService
 	t.Assert(err, NotNil) // This should have returned an ErrInvalidServiceOption error.
 }
 
+// Changing the storage quota of a tenant sets the quota on its volume.
+func (ft *FacadeIntegrationTest) TestFacade_UpdateService_StorageQuota(t *C) {
+	svc := service.Service{
+		ID:           "svc1",
+		Name:         "TestFacade_UpdateService_StorageQuota",
+		DeploymentID: "deployment_id",
+		PoolID:       "pool_id",
+		Launch:       "auto",
+		DesiredState: int(service.SVCStop),
+	}
+	err := ft.Facade.AddService(ft.CTX, svc)
+	t.Assert(err, IsNil)
+
+	ft.dfs.On("SetQuota", "svc1", uint64(1<<30)).Return(nil).Once()
+	svc.StorageQuota = utils.NewEngNotation(1 << 30)
+	err = ft.Facade.UpdateService(ft.CTX, svc)
+	t.Assert(err, IsNil)
+	ft.dfs.AssertExpectations(t)
+
+	// devicemapper cannot lower a quota
+	ft.dfs.On("CanLowerQuota").Return(false).Once()
+	svc.StorageQuota = utils.NewEngNotation(1 << 29)
+	err = ft.Facade.UpdateService(ft.CTX, svc)
+	t.Assert(err, FitsTypeOf, ErrInvalidServiceOption{})
+
+	// but it can remove it
+	ft.dfs.On("SetQuota", "svc1", uint64(0)).Return(nil).Once()
+	svc.StorageQuota = utils.NewEngNotation(0)
+	err = ft.Facade.UpdateService(ft.CTX, svc)
+	t.Assert(err, IsNil)
+	ft.dfs.AssertExpectations(t)
+
+	// a child service cannot have a quota
+	child := service.Service{
+		ID:              "svc2",
+		Name:            "TestFacade_UpdateService_StorageQuota_Child",
+		DeploymentID:    "deployment_id",
+		PoolID:          "pool_id",
+		Launch:          "auto",
+		DesiredState:    int(service.SVCStop),
+		ParentServiceID: "svc1",
+		StorageQuota:    utils.NewEngNotation(1 << 30),
+	}
+	err = ft.Facade.AddService(ft.CTX, child)
+	t.Assert(err, NotNil)
+}
+
 func (ft *FacadeIntegrationTest) TestFacade_migrateServiceConfigs_noConfigs(t *C) {
 	_, newSvc, err := ft.setupMigrationServices(t, nil)
 	t.Assert(err, IsNil)
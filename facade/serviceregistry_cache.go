@@ -108,6 +108,19 @@ func (sc *serviceRegistryCache) BuildSyncRequest(tenantID string, svc *service.S
 					Application: ep.Application,
 					ServiceID:   svc.ID,
 				}
+				for _, r := range v.Routes {
+					route := zkr.VHostRoute{
+						PathPrefix:    r.CleanPathPrefix(),
+						Application:   r.Application,
+						StripPrefix:   r.StripPrefix,
+						SetHeaders:    r.SetHeaders,
+						RemoveHeaders: r.RemoveHeaders,
+					}
+					if route.Application == "" {
+						route.Application = ep.Application
+					}
+					vh.Routes = append(vh.Routes, route)
+				}
 				request.VHostsToPublish[key] = vh
 			}
 		}
@@ -211,6 +211,51 @@ func (t *ServiceRegistryCacheTest) Test_BuildSyncRequest_AddsEndpoints(c *C) {
 	t.assertVHostMapsEqual(c, result.VHostsToPublish, expectedVHosts)
 }
 
+// Verify that vhost routes are added to the request object
+func (t *ServiceRegistryCacheTest) Test_BuildSyncRequest_AddsVHostRoutes(c *C) {
+	svc := t.getTestService()
+	svc.Endpoints[1].VHostList[0].Routes = []servicedefinition.VHostRoute{
+		{
+			PathPrefix:  "/api/",
+			Application: "api",
+			StripPrefix: true,
+			SetHeaders:  map[string]string{"X-Api": "true"},
+		}, {
+			PathPrefix:    "/",
+			RemoveHeaders: []string{"Cookie"},
+		},
+	}
+
+	tenantID := "expectedTenantID"
+	result := t.cache.BuildSyncRequest(tenantID, &svc)
+
+	vhostKey := zkr.VHostKey{
+		HostID:    "master",
+		Subdomain: svc.Endpoints[1].VHostList[0].Name,
+	}
+	vhost := zkr.VHost{
+		TenantID:    tenantID,
+		ServiceID:   svc.ID,
+		Application: svc.Endpoints[1].Application,
+		Routes: []zkr.VHostRoute{
+			{
+				PathPrefix:  "/api",
+				Application: "api",
+				StripPrefix: true,
+				SetHeaders:  map[string]string{"X-Api": "true"},
+			}, {
+				PathPrefix:    "/",
+				Application:   svc.Endpoints[1].Application,
+				RemoveHeaders: []string{"Cookie"},
+			},
+		},
+	}
+	expectedVHosts := map[zkr.VHostKey]zkr.VHost{}
+	expectedVHosts[vhostKey] = vhost
+
+	t.assertVHostMapsEqual(c, result.VHostsToPublish, expectedVHosts)
+}
+
 // Verify that the cached endpoints flagged for removal if all endpoints are disabled
 func (t *ServiceRegistryCacheTest) Test_BuildSyncRequest_EndpointsDisabled(c *C) {
 	// Based on the test service, seed the cache with some initial values
@@ -454,7 +499,7 @@ func (t *ServiceRegistryCacheTest) assertVHostMapsEqual(c *C, actual, expected m
 	for key, value := range expected {
 		actualValue, ok := actual[key]
 		c.Assert(ok, Equals, true)
-		c.Assert(actualValue, Equals, value)
+		c.Assert(actualValue, DeepEquals, value)
 	}
 }
 
@@ -353,6 +353,12 @@ func (f *Facade) DeployTemplate(ctx datastore.Context, poolID string, templateID
 			logger.WithError(err).WithField("tenantid", tenantID).Error("Could not initialize volume for tenant")
 			return nil, alog.Error(err)
 		}
+		if sd.StorageQuota.Value > 0 {
+			if err := f.dfs.SetQuota(tenantID, sd.StorageQuota.Value); err != nil {
+				logger.WithError(err).WithField("tenantid", tenantID).Error("Could not set storage quota for tenant")
+				return nil, alog.Error(err)
+			}
+		}
 		tenantIDs[i] = tenantID
 	}
 
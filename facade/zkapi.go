@@ -24,6 +24,7 @@ import (
 	"github.com/control-center/serviced/coordinator/storage"
 	"github.com/control-center/serviced/datastore"
 	zkimgregistry "github.com/control-center/serviced/dfs/registry"
+	"github.com/control-center/serviced/doctor"
 	"github.com/control-center/serviced/domain/host"
 	"github.com/control-center/serviced/domain/pool"
 	"github.com/control-center/serviced/domain/registry"
@@ -1003,3 +1004,61 @@ func (zk *zkf) UnregisterDfsClients(clients ...host.Host) error {
 func (zk *zkf) RegisterDfsClients(clients ...host.Host) error {
 	return updateDfsClients(clients, false)
 }
+
+// CheckCoordinator reports where the coordinator disagrees with the given
+// datastore state.
+func (zk *zkf) CheckCoordinator(state doctor.State) ([]doctor.Issue, error) {
+	rootconn, err := zzk.GetLocalConnection("/")
+	if err != nil {
+		plog.WithError(err).Debug("Could not acquire a root-based connection to check zookeeper")
+		return nil, err
+	}
+	return doctor.Check(rootconn, state)
+}
+
+// RepairCoordinator fixes an issue found by CheckCoordinator that only
+// involves zookeeper.
+func (zk *zkf) RepairCoordinator(issue doctor.Issue) error {
+	logger := plog.WithFields(log.Fields{
+		"kind":   issue.Kind,
+		"id":     issue.ID,
+		"zkpath": issue.Path,
+	})
+
+	rootconn, err := zzk.GetLocalConnection("/")
+	if err != nil {
+		logger.WithError(err).Debug("Could not acquire a root-based connection to repair zookeeper")
+		return err
+	}
+
+	switch issue.Kind {
+	case "host":
+		// keep services from being scheduled to the host while it is removed
+		poolconn, err := zzk.GetLocalConnection(zzk.GeneratePoolPath(issue.PoolID))
+		if err != nil {
+			return err
+		}
+		locker, err := zks.ServiceLock(poolconn)
+		if err != nil {
+			logger.WithError(err).Debug("Could not initialize service lock")
+			return err
+		}
+		if err := locker.Lock(); err != nil {
+			logger.WithError(err).Debug("Could not disable service scheduling for pool")
+			return err
+		}
+		defer locker.Unlock()
+	case "port", "vhost":
+		// the registry cache has to forget the removed endpoint
+		zk.svcRegistry.Lock()
+		defer zk.svcRegistry.Unlock()
+		defer zk.buildServiceRegistryCache(rootconn)
+	}
+
+	if err := doctor.Repair(rootconn, issue); err != nil {
+		logger.WithError(err).Debug("Could not repair zookeeper")
+		return err
+	}
+	logger.Debug("Repaired zookeeper")
+	return nil
+}
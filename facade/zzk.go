@@ -15,6 +15,7 @@ package facade
 
 import (
 	"github.com/control-center/serviced/datastore"
+	"github.com/control-center/serviced/doctor"
 	"github.com/control-center/serviced/domain/host"
 	"github.com/control-center/serviced/domain/pool"
 	"github.com/control-center/serviced/domain/registry"
@@ -59,4 +60,6 @@ type ZZK interface {
 	UnregisterDfsClients(clients ...host.Host) error
 	GetVirtualIPHostID(poolID, ip string) (string, error)
 	UpdateInstanceCurrentState(ctx datastore.Context, poolID, serviceID string, instanceID int, state service.InstanceCurrentState) error
+	CheckCoordinator(state doctor.State) ([]doctor.Issue, error)
+	RepairCoordinator(issue doctor.Issue) error
 }
@@ -0,0 +1,298 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ha
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/coordinator/client"
+	"github.com/control-center/serviced/node"
+	"github.com/control-center/serviced/zzk"
+)
+
+// Config describes how a master-capable host takes over as the active master
+type Config struct {
+	HostID    string
+	IPAddress string
+
+	// VirtualIP is the address in CIDR notation that follows the active
+	// master, and Interface is the device it is bound to
+	VirtualIP string
+	Interface string
+
+	// FenceCommand is run by a new active master before it takes over from
+	// another host.  The host id and ip address of the previous master are
+	// passed in SERVICED_FENCE_HOSTID and SERVICED_FENCE_IP.
+	FenceCommand string
+
+	// FenceDelay is how long a new active master waits before it takes over
+	// from another host.  The previous master steps down when it cannot
+	// confirm its lead for as long, so the delay fences it even when it
+	// cannot be reached.
+	FenceDelay time.Duration
+}
+
+// Elector runs the master-only subsystems while the host is the active
+// master.
+type Elector struct {
+	cfg      Config
+	vip      node.VIP
+	activate func(stop <-chan interface{})
+	fence    func(cmd string, prev *Active) error
+	interval time.Duration
+
+	mu     sync.Mutex
+	active bool
+}
+
+// NewElector returns an elector that calls activate when the host becomes
+// the active master.  Activate must return after stop is closed, once the
+// subsystems have stopped.
+func NewElector(cfg Config, vip node.VIP, activate func(stop <-chan interface{})) *Elector {
+	return &Elector{
+		cfg:      cfg,
+		vip:      vip,
+		activate: activate,
+		fence:    runFenceCommand,
+		interval: cfg.FenceDelay / 3,
+	}
+}
+
+// IsActive returns true while the host is the active master
+func (e *Elector) IsActive() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.active
+}
+
+func (e *Elector) setActive(active bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.active = active
+}
+
+// Run enters the host into the election until shutdown
+func (e *Elector) Run(shutdown <-chan interface{}) {
+	// a host that restarted may still hold the virtual ip from an earlier
+	// term
+	e.releaseVIP()
+	for {
+		select {
+		case conn := <-zzk.Connect("/", zzk.GetLocalConnection):
+			if conn != nil {
+				e.campaign(shutdown, conn)
+			}
+		case <-shutdown:
+			return
+		}
+		select {
+		case <-shutdown:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// campaign waits to win the election and runs as the active master until it
+// loses the lead
+func (e *Elector) campaign(shutdown <-chan interface{}, conn client.Connection) {
+	logger := plog.WithField("hostid", e.cfg.HostID)
+	leader, err := conn.NewLeader(leaderPath)
+	if err != nil {
+		logger.WithError(err).Error("Could not initialize master election")
+		return
+	}
+	token, err := newToken()
+	if err != nil {
+		logger.WithError(err).Error("Could not generate candidate token")
+		return
+	}
+	candidate := &Candidate{HostID: e.cfg.HostID, IPAddress: e.cfg.IPAddress, Token: token}
+
+	done := make(chan struct{})
+	defer close(done)
+	type result struct {
+		ev  <-chan client.Event
+		err error
+	}
+	resultC := make(chan result, 1)
+	go func() {
+		ev, err := leader.TakeLead(candidate, done)
+		resultC <- result{ev, err}
+	}()
+	logger.Info("Waiting to become the active master")
+	var ev <-chan client.Event
+	select {
+	case r := <-resultC:
+		if r.err != nil {
+			logger.WithError(r.err).Error("Could not take the master lead")
+			return
+		}
+		ev = r.ev
+	case <-shutdown:
+		return
+	}
+	defer leader.ReleaseLead()
+
+	active, err := e.takeOver(shutdown, conn, ev)
+	if err != nil {
+		logger.WithError(err).Warn("Could not take over as the active master")
+		return
+	}
+	logger = logger.WithField("epoch", active.Epoch)
+	e.bindVIP()
+	e.setActive(true)
+	logger.Info("Became the active master")
+
+	stop := make(chan interface{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		e.activate(stop)
+	}()
+
+	err = e.monitor(shutdown, conn, leader, candidate, active.Epoch, ev)
+	logger.WithError(err).Warn("Stepping down as the active master")
+
+	// release the virtual ip first, so that clients stop reaching this host
+	// while the subsystems shut down
+	close(stop)
+	e.releaseVIP()
+	<-stopped
+	e.setActive(false)
+	logger.Info("Stepped down as the active master")
+}
+
+// takeOver fences the previous active master if it was another host, and
+// records this host as the active master
+func (e *Elector) takeOver(shutdown <-chan interface{}, conn client.Connection, ev <-chan client.Event) (*Active, error) {
+	active := &Active{}
+	if err := conn.Get(activePath, active); err == client.ErrNoNode {
+		if err := conn.Create(activePath, active); err != nil && err != client.ErrNodeExists {
+			return nil, err
+		}
+		if err := conn.Get(activePath, active); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if active.HostID != "" && active.HostID != e.cfg.HostID {
+		logger := plog.WithFields(logrus.Fields{
+			"previoushostid": active.HostID,
+			"previousip":     active.IPAddress,
+			"fencedelay":     e.cfg.FenceDelay,
+		})
+		logger.Info("Fencing the previous active master")
+		select {
+		case <-time.After(e.cfg.FenceDelay):
+		case <-ev:
+			return nil, ErrLostLead
+		case <-shutdown:
+			return nil, ErrShutdown
+		}
+		if e.cfg.FenceCommand != "" {
+			if err := e.fence(e.cfg.FenceCommand, active); err != nil {
+				logger.WithError(err).Error("Could not run the fence command")
+				return nil, err
+			}
+		}
+		logger.Info("Fenced the previous active master")
+	}
+
+	active.HostID = e.cfg.HostID
+	active.IPAddress = e.cfg.IPAddress
+	active.Epoch++
+	active.Since = time.Now().UTC()
+	if err := conn.Set(activePath, active); err != nil {
+		return nil, err
+	}
+	return active, nil
+}
+
+// monitor returns when the host is no longer the active master.  The host
+// steps down when it loses the lead, when another host takes over, or when
+// it cannot confirm its lead for the fence delay.
+func (e *Elector) monitor(shutdown <-chan interface{}, conn client.Connection, leader client.Leader, candidate *Candidate, epoch int64, ev <-chan client.Event) error {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	checkC := make(chan error, 1)
+	pending := false
+	confirmed := time.Now()
+	for {
+		select {
+		case <-ev:
+			return ErrLostLead
+		case <-shutdown:
+			return ErrShutdown
+		case err := <-checkC:
+			pending = false
+			if err == nil {
+				confirmed = time.Now()
+			} else if err == ErrSuperseded {
+				return err
+			} else {
+				plog.WithError(err).Warn("Could not confirm the master lead")
+			}
+		case <-ticker.C:
+			if time.Since(confirmed) > e.cfg.FenceDelay {
+				return ErrLostLead
+			}
+			if !pending {
+				pending = true
+				go func() { checkC <- e.check(conn, leader, candidate, epoch) }()
+			}
+		}
+	}
+}
+
+// check returns nil if the host is still the active master
+func (e *Elector) check(conn client.Connection, leader client.Leader, candidate *Candidate, epoch int64) error {
+	current := &Candidate{}
+	if err := leader.Current(current); err != nil {
+		return err
+	} else if current.Token != candidate.Token {
+		return ErrSuperseded
+	}
+	active := &Active{}
+	if err := conn.Get(activePath, active); err != nil {
+		return err
+	} else if active.Epoch != epoch || active.HostID != e.cfg.HostID {
+		return ErrSuperseded
+	}
+	return nil
+}
+
+// GetActive returns the record of the active master
+func GetActive(conn client.Connection) (*Active, error) {
+	active := &Active{}
+	if err := conn.Get(activePath, active); err != nil {
+		return nil, err
+	}
+	return active, nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
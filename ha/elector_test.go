@@ -0,0 +1,337 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package ha
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/control-center/serviced/coordinator/client"
+	"github.com/control-center/serviced/node"
+)
+
+// testConn is an in-memory connection with the calls the elector uses
+type testConn struct {
+	client.Connection
+	mu       sync.Mutex
+	nodes    map[string][]byte
+	versions map[string]int
+	leader   *testLeader
+}
+
+func newTestConn() *testConn {
+	return &testConn{
+		nodes:    make(map[string][]byte),
+		versions: make(map[string]int),
+		leader:   &testLeader{ev: make(chan client.Event, 1)},
+	}
+}
+
+func (c *testConn) NewLeader(p string) (client.Leader, error) {
+	return c.leader, nil
+}
+
+func (c *testConn) Create(p string, n client.Node) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.nodes[p]; ok {
+		return client.ErrNodeExists
+	}
+	c.nodes[p], _ = json.Marshal(n)
+	n.SetVersion(0)
+	return nil
+}
+
+func (c *testConn) Get(p string, n client.Node) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.nodes[p]
+	if !ok {
+		return client.ErrNoNode
+	}
+	json.Unmarshal(data, n)
+	n.SetVersion(c.versions[p])
+	return nil
+}
+
+func (c *testConn) Set(p string, n client.Node) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.nodes[p]; !ok {
+		return client.ErrNoNode
+	} else if n.Version() != c.versions[p] {
+		return client.ErrBadVersion
+	}
+	c.nodes[p], _ = json.Marshal(n)
+	c.versions[p]++
+	return nil
+}
+
+func (c *testConn) setActive(active *Active) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nodes[activePath], _ = json.Marshal(active)
+	c.versions[activePath]++
+}
+
+// testLeader is an election that the candidate wins immediately
+type testLeader struct {
+	mu        sync.Mutex
+	candidate *Candidate
+	ev        chan client.Event
+	released  bool
+	block     chan struct{}
+}
+
+func (l *testLeader) TakeLead(n client.Node, done <-chan struct{}) (<-chan client.Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.candidate = n.(*Candidate)
+	return l.ev, nil
+}
+
+func (l *testLeader) ReleaseLead() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.released = true
+	return nil
+}
+
+func (l *testLeader) Current(n client.Node) error {
+	if l.block != nil {
+		<-l.block
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*n.(*Candidate) = *l.candidate
+	return nil
+}
+
+// testVIP records the virtual ips that are bound
+type testVIP struct {
+	mu    sync.Mutex
+	bound map[string]string
+}
+
+func (v *testVIP) GetAll() []node.IP { return nil }
+
+func (v *testVIP) Find(ipprefix string) *node.IP {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for addr, device := range v.bound {
+		if addr[:len(ipprefix)] == ipprefix {
+			return &node.IP{Addr: addr, Device: device}
+		}
+	}
+	return nil
+}
+
+func (v *testVIP) Release(ipaddr, device string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.bound, ipaddr)
+	return nil
+}
+
+func (v *testVIP) Bind(ipaddr, device string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.bound[ipaddr] = device
+	return nil
+}
+
+func newTestElector(activate func(<-chan interface{})) (*Elector, *testVIP) {
+	vip := &testVIP{bound: make(map[string]string)}
+	e := NewElector(Config{
+		HostID:     "hosta",
+		IPAddress:  "10.0.0.1",
+		VirtualIP:  "10.0.0.100/24",
+		Interface:  "eth0",
+		FenceDelay: 30 * time.Millisecond,
+	}, vip, activate)
+	return e, vip
+}
+
+func TestTakeOverFirstMaster(t *testing.T) {
+	e, _ := newTestElector(nil)
+	e.fence = func(string, *Active) error {
+		t.Errorf("Unexpected fence")
+		return nil
+	}
+	conn := newTestConn()
+	active, err := e.takeOver(nil, conn, nil)
+	if err != nil {
+		t.Fatalf("Could not take over: %s", err)
+	}
+	if active.HostID != "hosta" || active.Epoch != 1 {
+		t.Errorf("Unexpected active master: %+v", active)
+	}
+	if recorded, err := GetActive(conn); err != nil || recorded.Epoch != 1 {
+		t.Errorf("Unexpected record %+v: %v", recorded, err)
+	}
+}
+
+func TestTakeOverFencesPrevious(t *testing.T) {
+	e, _ := newTestElector(nil)
+	e.cfg.FenceCommand = "fence"
+	var fenced *Active
+	e.fence = func(cmd string, prev *Active) error {
+		p := *prev
+		fenced = &p
+		return nil
+	}
+	conn := newTestConn()
+	conn.setActive(&Active{HostID: "hostb", IPAddress: "10.0.0.2", Epoch: 4})
+
+	start := time.Now()
+	active, err := e.takeOver(nil, conn, nil)
+	if err != nil {
+		t.Fatalf("Could not take over: %s", err)
+	}
+	if time.Since(start) < e.cfg.FenceDelay {
+		t.Errorf("Took over before the fence delay")
+	}
+	if fenced == nil || fenced.HostID != "hostb" || fenced.IPAddress != "10.0.0.2" {
+		t.Errorf("Unexpected fenced master: %+v", fenced)
+	}
+	if active.HostID != "hosta" || active.Epoch != 5 {
+		t.Errorf("Unexpected active master: %+v", active)
+	}
+}
+
+func TestTakeOverFenceFails(t *testing.T) {
+	e, _ := newTestElector(nil)
+	e.cfg.FenceCommand = "fence"
+	fenceErr := errors.New("fence failed")
+	e.fence = func(string, *Active) error { return fenceErr }
+	conn := newTestConn()
+	conn.setActive(&Active{HostID: "hostb", Epoch: 4})
+
+	if _, err := e.takeOver(nil, conn, nil); err != fenceErr {
+		t.Errorf("Expected %s, got %v", fenceErr, err)
+	}
+	if active, _ := GetActive(conn); active.HostID != "hostb" || active.Epoch != 4 {
+		t.Errorf("Expected the record to be unchanged: %+v", active)
+	}
+}
+
+func TestTakeOverLostLead(t *testing.T) {
+	e, _ := newTestElector(nil)
+	e.cfg.FenceDelay = time.Minute
+	conn := newTestConn()
+	conn.setActive(&Active{HostID: "hostb", Epoch: 4})
+
+	ev := make(chan client.Event, 1)
+	ev <- client.Event{Type: client.EventNodeDeleted}
+	if _, err := e.takeOver(nil, conn, ev); err != ErrLostLead {
+		t.Errorf("Expected %s, got %v", ErrLostLead, err)
+	}
+}
+
+func TestMonitorSuperseded(t *testing.T) {
+	e, _ := newTestElector(nil)
+	conn := newTestConn()
+	candidate := &Candidate{HostID: "hosta", Token: "a"}
+	conn.leader.candidate = candidate
+	active, err := e.takeOver(nil, conn, nil)
+	if err != nil {
+		t.Fatalf("Could not take over: %s", err)
+	}
+	conn.setActive(&Active{HostID: "hostb", Epoch: active.Epoch + 1})
+
+	errC := make(chan error, 1)
+	go func() { errC <- e.monitor(nil, conn, conn.leader, candidate, active.Epoch, nil) }()
+	select {
+	case err := <-errC:
+		if err != ErrSuperseded {
+			t.Errorf("Expected %s, got %v", ErrSuperseded, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting to step down")
+	}
+}
+
+func TestMonitorUnconfirmed(t *testing.T) {
+	e, _ := newTestElector(nil)
+	conn := newTestConn()
+	candidate := &Candidate{HostID: "hosta", Token: "a"}
+	conn.leader.candidate = candidate
+	conn.leader.block = make(chan struct{})
+	defer close(conn.leader.block)
+
+	// the host steps down when the coordinator does not answer
+	errC := make(chan error, 1)
+	go func() { errC <- e.monitor(nil, conn, conn.leader, candidate, 1, nil) }()
+	select {
+	case err := <-errC:
+		if err != ErrLostLead {
+			t.Errorf("Expected %s, got %v", ErrLostLead, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting to step down")
+	}
+}
+
+func TestCampaign(t *testing.T) {
+	started, stopped := make(chan struct{}), make(chan struct{})
+	e, vip := newTestElector(func(stop <-chan interface{}) {
+		close(started)
+		<-stop
+		close(stopped)
+	})
+	conn := newTestConn()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.campaign(nil, conn)
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting to become the active master")
+	}
+	if !e.IsActive() {
+		t.Errorf("Expected the host to be the active master")
+	}
+	if device, ok := vip.bound["10.0.0.100/24"]; !ok || device != "eth0" {
+		t.Errorf("Expected the virtual ip to be bound: %v", vip.bound)
+	}
+
+	conn.leader.ev <- client.Event{Type: client.EventNodeDeleted}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting to step down")
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Errorf("Expected the subsystems to stop")
+	}
+	if e.IsActive() {
+		t.Errorf("Expected the host to step down")
+	}
+	if len(vip.bound) != 0 {
+		t.Errorf("Expected the virtual ip to be released: %v", vip.bound)
+	}
+	if !conn.leader.released {
+		t.Errorf("Expected the lead to be released")
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ha
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// fenceTimeout is how long the fence command may run
+const fenceTimeout = time.Minute
+
+// VIPLabel is the label of the master virtual ip on its device
+const VIPLabel = "ha"
+
+// runFenceCommand runs the fence command for the previous active master
+func runFenceCommand(command string, prev *Active) error {
+	ctx, cancel := context.WithTimeout(context.Background(), fenceTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"SERVICED_FENCE_HOSTID="+prev.HostID,
+		"SERVICED_FENCE_IP="+prev.IPAddress,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s", err, output)
+	}
+	return nil
+}
+
+// bindVIP binds the master virtual ip and announces it to the network
+func (e *Elector) bindVIP() {
+	if e.cfg.VirtualIP == "" {
+		return
+	}
+	ip, _, err := net.ParseCIDR(e.cfg.VirtualIP)
+	if err != nil {
+		plog.WithError(err).WithField("virtualip", e.cfg.VirtualIP).Error("Could not parse master virtual ip")
+		return
+	}
+	logger := plog.WithFields(logrus.Fields{
+		"virtualip": e.cfg.VirtualIP,
+		"interface": e.cfg.Interface,
+	})
+	if vip := e.vip.Find(ip.String()); vip != nil {
+		if vip.Matches(e.cfg.VirtualIP, e.cfg.Interface) {
+			logger.Debug("Master virtual ip is already bound")
+			return
+		}
+		if err := e.vip.Release(vip.Addr, vip.Device); err != nil {
+			logger.WithError(err).Warn("Could not release stale master virtual ip")
+		}
+	}
+	if err := e.vip.Bind(e.cfg.VirtualIP, e.cfg.Interface); err != nil {
+		logger.WithError(err).Error("Could not bind master virtual ip")
+		return
+	}
+
+	// update the arp caches of the network, which still point to the
+	// previous master
+	cmd := exec.Command("arping", "-U", "-c", "3", "-I", e.cfg.Interface, ip.String())
+	if output, err := cmd.CombinedOutput(); err != nil {
+		logger.WithError(err).WithField("output", string(output)).Debug("Could not announce master virtual ip")
+	}
+	logger.Info("Bound master virtual ip")
+}
+
+// releaseVIP releases the master virtual ip if it is bound to this host
+func (e *Elector) releaseVIP() {
+	if e.cfg.VirtualIP == "" {
+		return
+	}
+	ip, _, err := net.ParseCIDR(e.cfg.VirtualIP)
+	if err != nil {
+		return
+	}
+	if vip := e.vip.Find(ip.String()); vip != nil {
+		logger := plog.WithField("virtualip", vip.Addr)
+		if err := e.vip.Release(vip.Addr, vip.Device); err != nil {
+			logger.WithError(err).Error("Could not release master virtual ip")
+			return
+		}
+		logger.Info("Released master virtual ip")
+	}
+}
+
+// InterfaceFor returns the name of the interface that an ip address is bound
+// to.
+func InterfaceFor(ipaddr string) (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.String() == ipaddr {
+				return iface.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no interface has address %s", ipaddr)
+}
@@ -0,0 +1,81 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ha runs the master-only subsystems of serviced on one of several
+// master-capable hosts.  The hosts hold a leader election in the
+// coordinator; the winner fences the previous active master, takes over the
+// master virtual ip and runs the subsystems until it loses the lead.
+package ha
+
+import (
+	"errors"
+	"time"
+
+	"github.com/control-center/serviced/logging"
+)
+
+var plog = logging.PackageLogger()
+
+const (
+	// leaderPath is where master-capable hosts hold the election
+	leaderPath = "/master/leader"
+
+	// activePath is the record of the active master
+	activePath = "/master/active"
+)
+
+var (
+	// ErrSuperseded is returned when another host became the active master
+	ErrSuperseded = errors.New("another host is the active master")
+
+	// ErrLostLead is returned when the host loses the election while taking
+	// over as the active master
+	ErrLostLead = errors.New("lost the master lead")
+
+	// ErrShutdown is returned when the host shuts down while taking over as
+	// the active master
+	ErrShutdown = errors.New("shutting down")
+)
+
+// Candidate is the node a master-capable host enters into the election.  The
+// token is unique to each candidacy, so that a host can tell whether it is
+// still the leader after reconnecting.
+type Candidate struct {
+	HostID    string
+	IPAddress string
+	Token     string
+	version   interface{}
+}
+
+// Version implements client.Node
+func (node *Candidate) Version() interface{} { return node.version }
+
+// SetVersion implements client.Node
+func (node *Candidate) SetVersion(version interface{}) { node.version = version }
+
+// Active is the record of the active master.  The epoch increments every
+// time a host becomes the active master, so that a master that was fenced
+// while it could not reach the coordinator knows it was superseded.
+type Active struct {
+	HostID    string
+	IPAddress string
+	Epoch     int64
+	Since     time.Time
+	version   interface{}
+}
+
+// Version implements client.Node
+func (node *Active) Version() interface{} { return node.version }
+
+// SetVersion implements client.Node
+func (node *Active) SetVersion(version interface{}) { node.version = version }
@@ -133,6 +133,10 @@ type IServiceDefinition struct {
 	StartGroup     uint16                             // Start up group number
 	StartupTimeout time.Duration                      // How long to wait for the service to start up (this is the timeout for the initial 'startup' healthcheck)
 	CustomStats    CustomStatsFunction                // Function that is run on interval to get custom stats
+
+	// ExternalHealthChecks verify the health of the service at the given
+	// endpoints when it runs outside of serviced; nil if it cannot.
+	ExternalHealthChecks func(endpoints []string) []map[string]healthCheckDefinition
 }
 
 type IService struct {
@@ -151,6 +155,9 @@ type IService struct {
 	lock           *sync.RWMutex
 	healthStatuses []map[string]*domain.HealthCheckStatus
 	customStats    CustomStatsFunction
+
+	endpoints      []string // endpoints of the service when it runs outside of serviced
+	externalExited chan int // receives when the external service is stopped
 }
 
 func NewIService(sd IServiceDefinition) (*IService, error) {
@@ -180,15 +187,41 @@ func NewIService(sd IServiceDefinition) (*IService, error) {
 		customStats:        nil,
 	}
 
-	if len(svc.HealthChecks) > 0 {
-		svc.healthStatuses = make([]map[string]*domain.HealthCheckStatus, len(svc.HealthChecks))
+	svc.healthStatuses = newHealthStatuses(svc.HealthChecks)
 
-		for instIndex, checkMap := range svc.HealthChecks {
+	if sd.CustomStats != nil {
+		svc.customStats = sd.CustomStats
+	}
 
-			svc.healthStatuses[instIndex] = make(map[string]*domain.HealthCheckStatus)
+	envPerService[sd.Name] = make(map[string]string)
+	envPerService[sd.Name]["CONTROLPLANE_SERVICE_ID"] = svc.ID
+
+	if sd.PreStart != nil {
+		if err := sd.PreStart(&svc); err != nil {
+			log.WithFields(logrus.Fields{
+				"isvc": sd.Name,
+			}).WithError(err).Error("Unable to prestart service")
+			return nil, err
+		}
+	}
+	go svc.run()
+
+	return &svc, nil
+}
+
+// newHealthStatuses returns the initial statuses of the health checks of each
+// instance of a service.
+func newHealthStatuses(healthChecks []map[string]healthCheckDefinition) []map[string]*domain.HealthCheckStatus {
+	var healthStatuses []map[string]*domain.HealthCheckStatus
+	if len(healthChecks) > 0 {
+		healthStatuses = make([]map[string]*domain.HealthCheckStatus, len(healthChecks))
+
+		for instIndex, checkMap := range healthChecks {
+
+			healthStatuses[instIndex] = make(map[string]*domain.HealthCheckStatus)
 
 			for name, checkDefinition := range checkMap {
-				svc.healthStatuses[instIndex][name] = &domain.HealthCheckStatus{
+				healthStatuses[instIndex][name] = &domain.HealthCheckStatus{
 					Name:      name,
 					Status:    "unknown",
 					Interval:  checkDefinition.Interval.Seconds(),
@@ -200,9 +233,9 @@ func NewIService(sd IServiceDefinition) (*IService, error) {
 
 	} else {
 		name := DEFAULT_HEALTHCHECK_NAME
-		svc.healthStatuses = make([]map[string]*domain.HealthCheckStatus, 1)
-		svc.healthStatuses[0] = make(map[string]*domain.HealthCheckStatus)
-		svc.healthStatuses[0][name] = &domain.HealthCheckStatus{
+		healthStatuses = make([]map[string]*domain.HealthCheckStatus, 1)
+		healthStatuses[0] = make(map[string]*domain.HealthCheckStatus)
+		healthStatuses[0][name] = &domain.HealthCheckStatus{
 			Name:      name,
 			Status:    "unknown",
 			Interval:  3.156e9,
@@ -210,25 +243,54 @@ func NewIService(sd IServiceDefinition) (*IService, error) {
 			StartedAt: 0,
 		}
 	}
+	return healthStatuses
+}
 
-	if sd.CustomStats != nil {
-		svc.customStats = sd.CustomStats
+// SetExternal uses the service at endpoints, which runs outside of serviced,
+// instead of starting a container.  It must be set before the service starts.
+func (svc *IService) SetExternal(endpoints []string) error {
+	if svc.ExternalHealthChecks == nil {
+		return fmt.Errorf("isvc: %s cannot run outside of serviced", svc.Name)
+	} else if len(endpoints) == 0 {
+		return fmt.Errorf("isvc: no endpoints for %s", svc.Name)
+	} else if svc.IsRunning() {
+		return ErrRunning
 	}
 
-	envPerService[sd.Name] = make(map[string]string)
-	envPerService[sd.Name]["CONTROLPLANE_SERVICE_ID"] = svc.ID
+	healthChecks := svc.ExternalHealthChecks(endpoints)
 
-	if sd.PreStart != nil {
-		if err := sd.PreStart(&svc); err != nil {
-			log.WithFields(logrus.Fields{
-				"isvc": sd.Name,
-			}).WithError(err).Error("Unable to prestart service")
-			return nil, err
-		}
-	}
-	go svc.run()
+	svc.lock.Lock()
+	defer svc.lock.Unlock()
 
-	return &svc, nil
+	svc.endpoints = endpoints
+	svc.HealthChecks = healthChecks
+	svc.healthStatuses = newHealthStatuses(healthChecks)
+
+	// recovery and clean up act on the container's data
+	svc.Recover = nil
+	svc.StartupFailed = nil
+	return nil
+}
+
+// IsExternal returns true if the service runs outside of serviced.
+func (svc *IService) IsExternal() bool {
+	svc.lock.RLock()
+	defer svc.lock.RUnlock()
+
+	return len(svc.endpoints) > 0
+}
+
+// Endpoints returns the endpoints of the service that runs outside of
+// serviced, without their passwords.
+func (svc *IService) Endpoints() []string {
+	svc.lock.RLock()
+	defer svc.lock.RUnlock()
+
+	endpoints := make([]string, len(svc.endpoints))
+	for i, endpoint := range svc.endpoints {
+		endpoints[i] = redactEndpoint(endpoint)
+	}
+	return endpoints
 }
 
 func (svc *IService) SetRoot(root string) {
@@ -261,6 +323,9 @@ func (svc *IService) Restart() error {
 }
 
 func (svc *IService) Exec(command []string) ([]byte, error) {
+	if svc.IsExternal() {
+		return nil, ErrExternal
+	}
 	ctr, err := docker.FindContainer(svc.name())
 	if err != nil {
 		return nil, err
@@ -450,6 +515,10 @@ func (svc *IService) attach() (*docker.Container, error) {
 }
 
 func (svc *IService) start() (<-chan int, error) {
+	if svc.IsExternal() {
+		return svc.startExternal()
+	}
+
 	ctr, err := svc.attach()
 	if err != nil {
 		svc.setStoppedHealthStatus(fmt.Errorf("could not start service: %s", err))
@@ -500,11 +569,36 @@ func (svc *IService) start() (<-chan int, error) {
 	return notify, nil
 }
 
+// startExternal waits for the service that runs outside of serviced to check
+// in healthy.  The returned channel receives when the service is stopped.
+func (svc *IService) startExternal() (<-chan int, error) {
+	log := log.WithFields(logrus.Fields{
+		"isvc":      svc.Name,
+		"endpoints": svc.Endpoints(),
+	})
+	if err := <-svc.startupHealthcheck(); err != nil {
+		log.WithField("timeout", svc.StartupTimeout).WithError(err).Debug("External service failed to check in healthy within the timeout")
+		return nil, err
+	}
+	svc.startTime = time.Now()
+	svc.externalExited = make(chan int, 1)
+	log.Info("Using external service")
+	return svc.externalExited, nil
+}
+
 func (svc *IService) stop() error {
 	log := log.WithFields(logrus.Fields{
 		"isvc":        svc.Name,
 		"containerid": svc.Name,
 	})
+	if svc.IsExternal() {
+		svc.setStoppedHealthStatus(nil)
+		if svc.externalExited != nil {
+			svc.externalExited <- 0
+			svc.externalExited = nil
+		}
+		return nil
+	}
 	ctr, err := docker.FindContainer(svc.name())
 	if err == docker.ErrNoSuchContainer {
 		svc.setStoppedHealthStatus(nil)
@@ -985,6 +1079,12 @@ type containerStat struct {
 }
 
 func (svc *IService) stats(halt <-chan struct{}) {
+	if svc.IsExternal() {
+		// there is no container to collect stats from
+		<-halt
+		return
+	}
+
 	registry := metrics.NewRegistry()
 	tc := time.Tick(10 * time.Second)
 
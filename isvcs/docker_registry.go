@@ -16,6 +16,7 @@ package isvcs
 import (
 	"os"
 	"path/filepath"
+	"sync/atomic"
 
 	"github.com/Sirupsen/logrus"
 
@@ -26,10 +27,16 @@ import (
 
 var dockerRegistry *IService
 
+// registryReadOnly is set while the registry is restarted in read-only
+// maintenance mode to collect garbage
+var registryReadOnly int32
+
 const (
 	registryPort     = 5000
 	v1RegistryVolume = "registry"
 	v2RegistryVolume = "v2"
+	registryBinary   = "/opt/registry/registry"
+	registryConfig   = "/opt/registry/registry-config.yml"
 )
 
 func initDockerRegistry() {
@@ -50,7 +57,6 @@ func initDockerRegistry() {
 		HostIpOverride: "", // docker registry should always be open
 		HostPort:       registryPort,
 	}
-	command := `SETTINGS_FLAVOR=serviced exec /opt/registry/registry /opt/registry/registry-config.yml`
 
 	dockerRegistry, err = NewIService(
 		IServiceDefinition{
@@ -58,7 +64,7 @@ func initDockerRegistry() {
 			Name:         "docker-registry",
 			Repo:         IMAGE_REPO,
 			Tag:          IMAGE_TAG,
-			Command:      func() string { return command },
+			Command:      registryCommand,
 			PortBindings: []portBinding{dockerPortBinding},
 			Volumes:      map[string]string{v2RegistryVolume: "/tmp/registry-dev"},
 			HealthChecks: healthChecks,
@@ -70,6 +76,63 @@ func initDockerRegistry() {
 	}
 }
 
+func registryCommand() string {
+	// deletes are enabled so that registry garbage collection can remove
+	// unreferenced manifests
+	env := "SETTINGS_FLAVOR=serviced REGISTRY_STORAGE_DELETE_ENABLED=true"
+	if atomic.LoadInt32(&registryReadOnly) != 0 {
+		env += ` REGISTRY_STORAGE_MAINTENANCE_READONLY='{"enabled":true}'`
+	}
+	return fmt.Sprintf("%s exec %s %s", env, registryBinary, registryConfig)
+}
+
+// CollectRegistryGarbage runs the docker registry's garbage-collect command,
+// which deletes the blobs that are no longer referenced by a manifest.  The
+// registry is restarted in read-only maintenance mode for the sweep, so that
+// nothing can be pushed while blobs are being deleted, and restarted again
+// afterwards.  The caller must hold the dfs lock so that serviced does not
+// push images meanwhile.
+func CollectRegistryGarbage(dryRun bool) ([]byte, error) {
+	logger := log.WithField("dryrun", dryRun)
+	command := []string{registryBinary, "garbage-collect"}
+	if dryRun {
+		command = append(command, "--dry-run")
+	} else {
+		if err := setRegistryReadOnly(true); err != nil {
+			logger.WithError(err).Error("Unable to restart Docker registry in read-only mode")
+			setRegistryReadOnly(false)
+			return nil, err
+		}
+		defer func() {
+			if err := setRegistryReadOnly(false); err != nil {
+				logger.WithError(err).Error("Unable to restart Docker registry after collecting garbage")
+			}
+		}()
+	}
+	command = append(command, registryConfig)
+	output, err := dockerRegistry.Exec(command)
+	if err != nil {
+		logger.WithError(err).Error("Unable to collect Docker registry garbage")
+		return output, err
+	}
+	return output, nil
+}
+
+// setRegistryReadOnly restarts the registry in or out of read-only
+// maintenance mode, and waits for it to check in healthy
+func setRegistryReadOnly(readOnly bool) error {
+	var value int32
+	if readOnly {
+		value = 1
+	}
+	atomic.StoreInt32(&registryReadOnly, value)
+	if err := dockerRegistry.Restart(); err != nil {
+		return err
+	}
+	log.WithField("readonly", readOnly).Info("Restarted Docker registry")
+	return nil
+}
+
 func checkDockerRegistryPath(svc *IService) error {
 	// does the v2 path exist?
 	v2Path := svc.getResourcePath(v2RegistryVolume)
@@ -0,0 +1,43 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package isvcs
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRegistryCommand(t *testing.T) {
+	defer atomic.StoreInt32(&registryReadOnly, 0)
+
+	command := registryCommand()
+	if !strings.Contains(command, "REGISTRY_STORAGE_DELETE_ENABLED=true") {
+		t.Errorf("Expected deletes to be enabled: %s", command)
+	}
+	if strings.Contains(command, "READONLY") {
+		t.Errorf("Expected the registry to be writable: %s", command)
+	}
+
+	atomic.StoreInt32(&registryReadOnly, 1)
+	command = registryCommand()
+	if !strings.Contains(command, `REGISTRY_STORAGE_MAINTENANCE_READONLY='{"enabled":true}'`) {
+		t.Errorf("Expected the registry to be read-only: %s", command)
+	}
+	if !strings.HasSuffix(command, "exec "+registryBinary+" "+registryConfig) {
+		t.Errorf("Unexpected command: %s", command)
+	}
+}
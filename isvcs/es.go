@@ -102,6 +102,11 @@ func initElasticSearch() {
 			Configuration:  make(map[string]interface{}),
 			HealthChecks:   healthChecks,
 			StartupTimeout: time.Duration(DEFAULT_ES_STARTUP_TIMEOUT_SECONDS) * time.Second,
+			ExternalHealthChecks: func(endpoints []string) []map[string]healthCheckDefinition {
+				check := defaultHealthCheck
+				check.healthCheck = esExternalHealthCheck(endpoints, ESYellow)
+				return []map[string]healthCheckDefinition{{DEFAULT_HEALTHCHECK_NAME: check}}
+			},
 		},
 	)
 	if err != nil {
@@ -217,9 +222,20 @@ func getESShardStatus() {
 }
 
 func getESHealth(url string) <-chan esres {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		esresC := make(chan esres, 1)
+		esresC <- esres{url, nil, err}
+		return esresC
+	}
+	return doESHealth(http.DefaultClient, req)
+}
+
+func doESHealth(client *http.Client, req *http.Request) <-chan esres {
+	url := req.URL.String()
 	esresC := make(chan esres, 1)
 	go func() {
-		resp, err := http.Get(url)
+		resp, err := client.Do(req)
 		if resp != nil {
 			defer resp.Body.Close()
 		}
@@ -282,6 +298,35 @@ func esHealthCheck(host string, port int, minHealth ESHealth) HealthCheckFunctio
 	}
 }
 
+// esExternalHealthCheck passes when any of the endpoints reports the health
+// of the cluster to be at least minHealth.
+func esExternalHealthCheck(endpoints []string, minHealth ESHealth) HealthCheckFunction {
+	return func(cancel <-chan struct{}) error {
+		var failures []string
+		for _, endpoint := range endpoints {
+			req, err := newExternalRequest(endpoint, "/_cluster/health")
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %s", redactEndpoint(endpoint), err))
+				continue
+			}
+			select {
+			case r := <-doESHealth(externalClient, req):
+				if r.err != nil {
+					failures = append(failures, fmt.Sprintf("%s: %s", redactEndpoint(endpoint), r.err))
+				} else if status := GetHealth(r.response.Status); status < minHealth {
+					failures = append(failures, fmt.Sprintf("%s: cluster health is %s", redactEndpoint(endpoint), r.response.Status))
+				} else {
+					return nil
+				}
+			case <-cancel:
+				log.Debug("Canceled health check for external Elastic")
+				return nil
+			}
+		}
+		return fmt.Errorf("no endpoint is healthy: %s", strings.Join(failures, "; "))
+	}
+}
+
 func PurgeLogstashIndices(days int, gb int) {
 	iservice := elasticsearch_logstash
 	port := iservice.PortBindings[0].HostPort
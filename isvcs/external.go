@@ -0,0 +1,224 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package isvcs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/control-center/serviced/config"
+)
+
+// ErrExternal is returned for operations that need the container of an
+// internal service that runs outside of serviced.
+var ErrExternal = errors.New("isvc: service is external")
+
+// errLoggingExternal explains why the logging services always run on the
+// master: serviced renders the logstash pipeline and containers ship their
+// logs to the master, and logstash and kibana reach elasticsearch-logstash
+// through container links.
+var errLoggingExternal = errors.New("the logging services cannot run outside of serviced")
+
+// externalClient checks the health of internal services that run outside of
+// serviced.
+var externalClient = &http.Client{Timeout: DEFAULT_HEALTHCHECK_TIMEOUT}
+
+// ParseExternal parses the internal services that run outside of serviced,
+// each of the form ISVC:ENDPOINT[,ENDPOINT...], into their endpoints by
+// service name.
+func ParseExternal(specs []string) (map[string][]string, error) {
+	external := make(map[string][]string)
+	for _, spec := range specs {
+		result := regexp.MustCompile("^([^:]+):(.+)$").FindStringSubmatch(spec)
+		if result == nil {
+			return nil, fmt.Errorf("Error parsing external internal service: %s", spec)
+		}
+		var endpoints []string
+		for _, endpoint := range strings.Split(result[2], ",") {
+			if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+		if len(endpoints) == 0 {
+			return nil, fmt.Errorf("Error parsing external internal service: %s has no endpoints", spec)
+		}
+		switch result[1] {
+		case "opentsdb":
+			// the metrics client queries a single opentsdb
+			if len(endpoints) > 1 {
+				return nil, fmt.Errorf("Error parsing external internal service: %s has more than one endpoint", spec)
+			}
+		case "zookeeper":
+			// the zookeeper client connects with neither credentials nor tls
+			for _, endpoint := range endpoints {
+				if _, _, err := net.SplitHostPort(endpoint); err != nil || strings.Contains(endpoint, "/") {
+					return nil, fmt.Errorf("Error parsing external internal service: zookeeper endpoint %s is not host:port", endpoint)
+				}
+			}
+		case "logstash", "kibana", "elasticsearch-logstash":
+			return nil, fmt.Errorf("Error parsing external internal service: %s: %s", spec, errLoggingExternal)
+		}
+		external[result[1]] = endpoints
+	}
+	return external, nil
+}
+
+// ExternalEndpoints returns the endpoints of the internal service that runs
+// outside of serviced, or nil if serviced runs the service itself.
+func ExternalEndpoints(name string) []string {
+	external, err := ParseExternal(config.GetOptions().IsvcsExternal)
+	if err != nil {
+		return nil
+	}
+	return external[name]
+}
+
+// RedactedEndpoints returns the external endpoints of the internal service
+// without their passwords.
+func RedactedEndpoints(name string) []string {
+	endpoints := ExternalEndpoints(name)
+	if endpoints == nil {
+		return nil
+	}
+	redacted := make([]string, len(endpoints))
+	for i, endpoint := range endpoints {
+		redacted[i] = redactEndpoint(endpoint)
+	}
+	return redacted
+}
+
+// ExternalTLSConfig returns the tls configuration for reaching internal
+// services that run outside of serviced, trusting the certificate authority
+// in the serviced options as well as the system's.
+func ExternalTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	caFile := config.GetOptions().IsvcsExternalCA
+	if caFile == "" {
+		return tlsConfig, nil
+	}
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	tlsConfig.RootCAs = pool
+	return tlsConfig, nil
+}
+
+// setIsvcsExternal uses the internal services that the serviced options
+// place outside of serviced instead of their containers.
+func setIsvcsExternal() error {
+	external, err := ParseExternal(config.GetOptions().IsvcsExternal)
+	if err != nil || len(external) == 0 {
+		return err
+	}
+	tlsConfig, err := ExternalTLSConfig()
+	if err != nil {
+		return err
+	}
+	externalClient.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+	for name, endpoints := range external {
+		if err := Mgr.SetExternal(name, endpoints); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newExternalRequest creates a GET request for path on the endpoint
+// (scheme://[user:password@]host:port), sending the endpoint's credentials
+// as basic auth rather than in the url.
+func newExternalRequest(endpoint, path string) (*http.Request, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	user := u.User
+	u.User = nil
+	u.Path = strings.TrimRight(u.Path, "/") + path
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
+	}
+	return req, nil
+}
+
+// redactEndpoint returns the endpoint without its password, so that it can
+// be logged and reported.
+func redactEndpoint(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.User == nil {
+		return endpoint
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.User(u.User.Username())
+	}
+	return u.String()
+}
+
+// httpExternalHealthCheck passes when any of the endpoints answers a GET of
+// path without a server error.
+func httpExternalHealthCheck(endpoints []string, path string) HealthCheckFunction {
+	return func(cancel <-chan struct{}) error {
+		var failures []string
+		for _, endpoint := range endpoints {
+			err := func() error {
+				req, err := newExternalRequest(endpoint, path)
+				if err != nil {
+					return err
+				}
+				resp, err := externalClient.Do(req)
+				if err != nil {
+					return err
+				}
+				resp.Body.Close()
+				if resp.StatusCode >= 500 {
+					return fmt.Errorf("received %d status code", resp.StatusCode)
+				}
+				return nil
+			}()
+			if err == nil {
+				return nil
+			}
+			failures = append(failures, fmt.Sprintf("%s: %s", redactEndpoint(endpoint), err))
+			select {
+			case <-cancel:
+				return nil
+			default:
+			}
+		}
+		return fmt.Errorf("no endpoint is healthy: %s", strings.Join(failures, "; "))
+	}
+}
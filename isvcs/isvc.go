@@ -45,6 +45,7 @@ type IServiceHealthResult struct {
 	ServiceName    string
 	ContainerName  string
 	ContainerID    string
+	Endpoints      []string // endpoints of the service when it runs outside of serviced
 	HealthStatuses []domain.HealthCheckStatus
 }
 
@@ -62,65 +63,59 @@ func PreInit(bigtable bool) error {
 	return nil
 }
 
-func Init(esStartupTimeoutInSeconds int, dockerLogDriver string, dockerLogConfig map[string]string, dockerAPI docker.Docker, startZK bool, bigtable bool) {
-	if err := PreInit(bigtable); err != nil {
+// Options configures the internal services that Init registers
+type Options struct {
+	ESStartupTimeout time.Duration     // how long to wait for Elasticsearch to start
+	DockerLogDriver  string            // the log driver of the isvcs containers
+	DockerLogConfig  map[string]string // options for the log driver
+	Docker           docker.Docker     // Docker API, needed to get stats
+	// StartZK is false if ZooKeeper runs elsewhere.  Its container is still
+	// registered, to report the health of the ZooKeeper cluster.
+	StartZK bool
+	// BigTable stores metrics in Bigtable rather than HBase
+	BigTable bool
+	// Skip names the internal services that are not registered, such as
+	// elasticsearch-serviced with the embedded datastore or docker-registry
+	// with an external registry.
+	Skip []string
+}
+
+// Init registers the internal services with a new Manager
+func Init(opts Options) {
+	if err := PreInit(opts.BigTable); err != nil {
 		log.WithFields(logrus.Fields{
 			"isvc": "PreInit",
 		}).WithError(err).Fatal("Unable to initialize ISVCS")
 	}
 
-	elasticsearch_serviced.StartupTimeout = time.Duration(esStartupTimeoutInSeconds) * time.Second
-	elasticsearch_logstash.StartupTimeout = time.Duration(esStartupTimeoutInSeconds) * time.Second
+	elasticsearch_serviced.StartupTimeout = opts.ESStartupTimeout
+	elasticsearch_logstash.StartupTimeout = opts.ESStartupTimeout
 
-	Mgr = NewManager(utils.LocalDir("images"), utils.TempDir("var/isvcs"), dockerLogDriver, dockerLogConfig)
+	Mgr = NewManager(utils.LocalDir("images"), utils.TempDir("var/isvcs"), opts.DockerLogDriver, opts.DockerLogConfig)
 
-	elasticsearch_serviced.docker = dockerAPI
-	if err := Mgr.Register(elasticsearch_serviced); err != nil {
-		log.WithFields(logrus.Fields{
-			"isvc": "elasticsearch-serviced",
-		}).WithError(err).Fatal("Unable to register internal service")
-	}
-	elasticsearch_logstash.docker = dockerAPI
-	if err := Mgr.Register(elasticsearch_logstash); err != nil {
-		log.WithFields(logrus.Fields{
-			"isvc": "elasticsearch-logstash",
-		}).WithError(err).Fatal("Unable to register internal service")
-	}
-	zookeeper.docker = dockerAPI
-	if !startZK {
+	if !opts.StartZK {
 		// Don't start the ZK process but keep the container so that
 		// healtchecks for the ZK cluster are reported.
 		zookeeper.Command = func() string { return "sleep infinity" }
 		zookeeper.PortBindings = []portBinding{}
 	}
-	if err := Mgr.Register(zookeeper); err != nil {
-		log.WithFields(logrus.Fields{
-			"isvc": "zookeeper",
-		}).WithError(err).Fatal("Unable to register internal service")
-	}
-	logstash.docker = dockerAPI
-	if err := Mgr.Register(logstash); err != nil {
-		log.WithFields(logrus.Fields{
-			"isvc": "logstash",
-		}).WithError(err).Fatal("Unable to register internal service")
-	}
-	opentsdb.docker = dockerAPI
-	if err := Mgr.Register(opentsdb); err != nil {
-		log.WithFields(logrus.Fields{
-			"isvc": "opentsdb",
-		}).WithError(err).Fatal("Unable to register internal service")
+	skip := make(map[string]bool)
+	for _, name := range opts.Skip {
+		skip[name] = true
 	}
-	dockerRegistry.docker = dockerAPI
-	if err := Mgr.Register(dockerRegistry); err != nil {
-		log.WithFields(logrus.Fields{
-			"isvc": "docker-registry",
-		}).WithError(err).Fatal("Unable to register internal service")
+	for _, svc := range []*IService{elasticsearch_serviced, elasticsearch_logstash, zookeeper, logstash, opentsdb, dockerRegistry, kibana} {
+		if skip[svc.Name] {
+			continue
+		}
+		svc.docker = opts.Docker
+		if err := Mgr.Register(svc); err != nil {
+			log.WithFields(logrus.Fields{
+				"isvc": svc.Name,
+			}).WithError(err).Fatal("Unable to register internal service")
+		}
 	}
-	kibana.docker = dockerAPI
-	if err := Mgr.Register(kibana); err != nil {
-		log.WithFields(logrus.Fields{
-			"isvc": "kibana",
-		}).WithError(err).Fatal("Unable to register internal service")
+	if err := setIsvcsExternal(); err != nil {
+		log.WithError(err).Fatal("Unable to use external services")
 	}
 }
 
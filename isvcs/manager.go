@@ -125,6 +125,23 @@ func (m *Manager) SetConfigurationOption(name, key string, value interface{}) er
 	return nil
 }
 
+// SetExternal uses the service at endpoints, which runs outside of serviced,
+// in place of the named isvc.
+func (m *Manager) SetExternal(name string, endpoints []string) error {
+	svc, found := m.services[name]
+	if !found {
+		return fmt.Errorf("could not find isvc %q", name)
+	}
+	if err := svc.SetExternal(endpoints); err != nil {
+		return err
+	}
+	log.WithFields(logrus.Fields{
+		"isvc":      name,
+		"endpoints": svc.Endpoints(),
+	}).Info("Using external service in place of internal service")
+	return nil
+}
+
 // Returns a list of iservice names in sorted order
 func (m *Manager) GetServiceNames() []string {
 	names := make([]string, 0, len(m.services))
@@ -151,15 +168,18 @@ func (m *Manager) GetHealthStatus(name string, instIndex int) (IServiceHealthRes
 		return IServiceHealthResult{}, fmt.Errorf("could not find isvc %q", name)
 	}
 
-	if ctr, err := docker.FindContainer(svc.name()); err == nil {
-		result.ContainerID = ctr.ID
+	if svc.IsExternal() {
+		result.Endpoints = svc.Endpoints()
+	} else {
+		if ctr, err := docker.FindContainer(svc.name()); err == nil {
+			result.ContainerID = ctr.ID
+		}
+		result.ContainerName = svc.name()
 	}
 
 	svc.lock.RLock()
 	defer svc.lock.RUnlock()
 
-	result.ContainerName = svc.name()
-
 	if instIndex == HEALTH_STATUS_INDEX_ALL {
 		for _, statusMap := range svc.healthStatuses {
 			for _, value := range statusMap {
@@ -184,6 +204,9 @@ func (m *Manager) GetHealthStatus(name string, instIndex int) (IServiceHealthRes
 // checks for the existence of all the container images
 func (m *Manager) allImagesExist() error {
 	for _, c := range m.services {
+		if c.IsExternal() {
+			continue
+		}
 		if exists, err := m.imageExists(c.Repo, c.Tag); err != nil {
 			return err
 		} else {
@@ -199,6 +222,9 @@ func (m *Manager) allImagesExist() error {
 func (m *Manager) loadImages() error {
 	loadedImages := make(map[string]bool)
 	for _, c := range m.services {
+		if c.IsExternal() {
+			continue
+		}
 		exists, err := m.imageExists(c.Repo, c.Tag)
 		if err != nil {
 			return err
@@ -78,6 +78,14 @@ func initOTSDB(bigtable bool) {
 			Command: func() string { return command },
 			PortBindings: portBindings,
 			Volumes: volumes,
+			ExternalHealthChecks: func(endpoints []string) []map[string]healthCheckDefinition {
+				check := healthCheckDefinition{
+					healthCheck: httpExternalHealthCheck(endpoints, "/"),
+					Interval:    DEFAULT_HEALTHCHECK_INTERVAL,
+					Timeout:     DEFAULT_HEALTHCHECK_TIMEOUT,
+				}
+				return []map[string]healthCheckDefinition{{DEFAULT_HEALTHCHECK_NAME: check}}
+			},
 		})
 	if err != nil {
 		log.WithError(err).Fatal("Unable to initialize opentsdb internal service container")
@@ -67,40 +67,53 @@ func initZK() {
 			},
 		},
 		Volumes:     map[string]string{"data": "/var/zookeeper"},
+		ExternalHealthChecks: zkHealthChecks,
 	}
 	if config.GetOptions().Master {
 		Zookeeper.CustomStats = GetZooKeeperCustomStats
 	}
 
 	keys := GetZooKeeperKeys()
+	connections := make([]string, len(keys))
+	for _, key := range keys {
+		connections[key.InstanceID] = key.Connection
+	}
 
 	// setup the health check definitions
-	Zookeeper.HealthChecks = make([]map[string]healthCheckDefinition, len(keys))
+	Zookeeper.HealthChecks = zkHealthChecks(connections)
 
-	for _, key := range keys {
-		Zookeeper.HealthChecks[key.InstanceID] = make(map[string]healthCheckDefinition)
+	zookeeper, err = NewIService(Zookeeper)
+
+	if err != nil {
+		log.WithError(err).Fatal("Unable to initialize ZooKeeper internal service container")
+	}
+}
+
+// zkHealthChecks returns the health check definitions of each instance of
+// the ensemble, by connection string.
+func zkHealthChecks(connections []string) []map[string]healthCheckDefinition {
+	healthChecks := make([]map[string]healthCheckDefinition, len(connections))
+
+	for instanceID, connection := range connections {
+		healthChecks[instanceID] = make(map[string]healthCheckDefinition)
 
 		defaultHealthCheck := healthCheckDefinition{
-			healthCheck: SetZKHealthCheck(key.Connection),
+			healthCheck: SetZKHealthCheck(connection),
 			Interval:    DEFAULT_HEALTHCHECK_INTERVAL,
 			Timeout:     DEFAULT_HEALTHCHECK_TIMEOUT,
 		}
 
 		quorumHealthCheck := healthCheckDefinition{
-			healthCheck: SetZKQuorumCheck(key.Connection),
+			healthCheck: SetZKQuorumCheck(connection),
 			Interval:    DEFAULT_HEALTHCHECK_INTERVAL,
 			Timeout:     DEFAULT_HEALTHCHECK_TIMEOUT,
 		}
 
-		Zookeeper.HealthChecks[key.InstanceID][DEFAULT_HEALTHCHECK_NAME] = defaultHealthCheck
-		Zookeeper.HealthChecks[key.InstanceID][QUORUM_HEALTHCHECK_NAME] = quorumHealthCheck
+		healthChecks[instanceID][DEFAULT_HEALTHCHECK_NAME] = defaultHealthCheck
+		healthChecks[instanceID][QUORUM_HEALTHCHECK_NAME] = quorumHealthCheck
 	}
 
-	zookeeper, err = NewIService(Zookeeper)
-
-	if err != nil {
-		log.WithError(err).Fatal("Unable to initialize ZooKeeper internal service container")
-	}
+	return healthChecks
 }
 
 type ZooKeeperKey struct {
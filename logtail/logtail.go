@@ -0,0 +1,383 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logtail follows the application logs that filebeat ships to
+// logstash, by polling the logstash elasticsearch for the lines logged since
+// the last poll.
+package logtail
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/domain/service"
+	"github.com/control-center/serviced/logging"
+)
+
+// initialize the package logger
+var plog = logging.PackageLogger()
+
+const (
+	// searchSize is the maximum number of log messages fetched per search
+	searchSize = 1000
+
+	// esTimeFormat is the format of @timestamp in the logstash indices
+	esTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+)
+
+var (
+	// ErrNoServices is returned when there are no services to tail
+	ErrNoServices = errors.New("no services to tail")
+
+	// serviceIDMatcher matches the ids that are safe to put in a query
+	serviceIDMatcher = regexp.MustCompile("\\A[\\w\\-]+\\z")
+
+	// newline splits log messages that span multiple lines
+	newline = regexp.MustCompile("\\r?\\n")
+)
+
+// Line is a single line of an application log
+type Line struct {
+	Timestamp  time.Time
+	HostID     string
+	ServiceID  string
+	InstanceID string
+	File       string
+	Message    string
+}
+
+// Filter selects the log lines to tail
+type Filter struct {
+	// ServiceIDs are the services whose logs are tailed; a service's
+	// children must be listed as well
+	ServiceIDs []string
+
+	// InstanceID only tails the given instance of the services, if set
+	InstanceID string
+
+	// Grep only tails the lines that match, if set
+	Grep *regexp.Regexp
+
+	// Since tails the lines logged after this time
+	Since time.Time
+}
+
+// Client follows the application logs in logstash
+type Client struct {
+	HTTPClient *http.Client
+
+	// PollInterval is the time between searches for new log lines
+	PollInterval time.Duration
+
+	// Lag is how long to look back for log messages that were indexed after
+	// messages logged later than them
+	Lag time.Duration
+
+	address string // host:port of the logstash elasticsearch
+}
+
+// NewClient returns a client for the logstash elasticsearch at the address
+// (host:port)
+func NewClient(address string) *Client {
+	return &Client{
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+		PollInterval: time.Second,
+		Lag:          10 * time.Second,
+		address:      address,
+	}
+}
+
+// Tail sends the log lines that match the filter to lines as they are
+// indexed, until cancel is closed.  It returns an error if logstash cannot be
+// searched at all; failed searches after the first one are retried.
+func (c *Client) Tail(filter Filter, lines chan<- Line, cancel <-chan struct{}) error {
+	query, err := buildQuery(filter)
+	if err != nil {
+		return err
+	}
+	logger := plog.WithFields(logrus.Fields{
+		"address": c.address,
+		"query":   query,
+	})
+
+	// seen holds the messages already sent from the lag window, so that they
+	// are sent only once
+	seen := make(map[string]time.Time)
+	latest := filter.Since
+	searched := false
+	for {
+		from := latest.Add(-c.Lag)
+		if from.Before(filter.Since) {
+			from = filter.Since
+		}
+
+		// page through the lag window.  Each page starts at the timestamp of
+		// the last message of the page before, past the messages with that
+		// timestamp that were already fetched, so that no page is searched
+		// twice however many messages the window holds.
+		skip := 0
+		for {
+			hits, err := c.search(query, from, skip)
+			if err != nil {
+				if !searched {
+					return err
+				}
+				logger.WithError(err).Warn("Unable to search logstash for new log messages")
+				break
+			}
+			searched = true
+
+			for _, hit := range hits {
+				if _, ok := seen[hit.ID]; ok {
+					continue
+				}
+				message, err := parseMessage(hit.Source)
+				if err != nil {
+					logger.WithError(err).WithField("id", hit.ID).Debug("Skipping log message")
+					continue
+				}
+				seen[hit.ID] = message.Timestamp
+				if message.Timestamp.After(latest) {
+					latest = message.Timestamp
+				}
+				for _, line := range message.lines(filter.Grep) {
+					select {
+					case lines <- line:
+					case <-cancel:
+						return nil
+					}
+				}
+			}
+			if len(hits) < searchSize {
+				break
+			}
+			last := hits[len(hits)-1].timestamp()
+			if !last.Equal(from) {
+				from, skip = last, 0
+			}
+			for _, hit := range hits {
+				if hit.timestamp().Equal(last) {
+					skip++
+				}
+			}
+		}
+
+		// forget the messages that have fallen out of the lag window
+		for id, timestamp := range seen {
+			if timestamp.Before(latest.Add(-c.Lag)) {
+				delete(seen, id)
+			}
+		}
+
+		select {
+		case <-time.After(c.PollInterval):
+		case <-cancel:
+			return nil
+		}
+	}
+}
+
+// buildQuery returns the lucene query for the application log messages that
+// the filter selects
+func buildQuery(filter Filter) (string, error) {
+	if len(filter.ServiceIDs) == 0 {
+		return "", ErrNoServices
+	}
+	services := make([]string, len(filter.ServiceIDs))
+	for i, serviceID := range filter.ServiceIDs {
+		if !serviceIDMatcher.MatchString(serviceID) {
+			return "", fmt.Errorf("invalid service ID format: %s", serviceID)
+		}
+		services[i] = fmt.Sprintf("\"%s\"", serviceID)
+	}
+	// sort the services for a predictable query
+	sort.Strings(services)
+
+	// filebeat sets the type of application log messages to "log"
+	query := fmt.Sprintf("type:log AND fields.service:(%s)", strings.Join(services, " OR "))
+	if filter.InstanceID != "" {
+		if !serviceIDMatcher.MatchString(filter.InstanceID) {
+			return "", fmt.Errorf("invalid instance ID format: %s", filter.InstanceID)
+		}
+		query = fmt.Sprintf("%s AND fields.instance:\"%s\"", query, filter.InstanceID)
+	}
+	return query, nil
+}
+
+// searchHit is a log message found by a search
+type searchHit struct {
+	ID     string          `json:"_id"`
+	Source json.RawMessage `json:"_source"`
+	Sort   []interface{}   `json:"sort"`
+}
+
+// timestamp returns the @timestamp that the hit was sorted by
+func (h searchHit) timestamp() time.Time {
+	if len(h.Sort) > 0 {
+		if ms, ok := h.Sort[0].(float64); ok {
+			return time.Unix(0, int64(ms)*int64(time.Millisecond)).UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// searchResult is the response to a search of logstash
+type searchResult struct {
+	Hits struct {
+		Hits []searchHit `json:"hits"`
+	} `json:"hits"`
+}
+
+// search returns the oldest log messages that match the query and were
+// logged at or after from, skipping the first skip of them.  Messages with the
+// same timestamp are sorted by id, so that the order is the same for every
+// search.
+func (c *Client) search(query string, from time.Time, skip int) ([]searchHit, error) {
+	body := map[string]interface{}{
+		"query": map[string]interface{}{
+			"filtered": map[string]interface{}{
+				"query": map[string]interface{}{
+					"query_string": map[string]interface{}{"query": query},
+				},
+				"filter": map[string]interface{}{
+					"range": map[string]interface{}{
+						"@timestamp": map[string]interface{}{"gte": from.UTC().Format(esTimeFormat)},
+					},
+				},
+			},
+		},
+		"sort": []interface{}{
+			map[string]interface{}{"@timestamp": map[string]interface{}{"order": "asc"}},
+			map[string]interface{}{"_uid": map[string]interface{}{"order": "asc"}},
+		},
+		"from": skip,
+		"size": searchSize,
+	}
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("http://%s/logstash-*/_search?ignore_unavailable=true", c.address)
+	resp, err := c.HTTPClient.Post(url, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("logstash search failed (%d): %s", resp.StatusCode, data)
+	}
+	var result searchResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("could not parse logstash search result: %s", err)
+	}
+	return result.Hits.Hits, nil
+}
+
+// logMessage is an application log message in logstash.  Filebeat sends
+// messages with multiple lines either as a single message or as a list.
+type logMessage struct {
+	Timestamp time.Time   `json:"@timestamp"`
+	File      string      `json:"file"`
+	Message   interface{} `json:"message"`
+	Fields    struct {
+		CCWorkerID interface{} `json:"ccWorkerID"`
+		Service    string      `json:"service"`
+		Instance   interface{} `json:"instance"`
+	} `json:"fields"`
+}
+
+// parseMessage parses the source of a log message
+func parseMessage(source []byte) (*logMessage, error) {
+	var message logMessage
+	if err := json.Unmarshal(source, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// lines returns the lines of the message that match grep
+func (m *logMessage) lines(grep *regexp.Regexp) []Line {
+	var texts []string
+	switch msg := m.Message.(type) {
+	case string:
+		texts = newline.Split(msg, -1)
+	case []interface{}:
+		for _, text := range msg {
+			texts = append(texts, newline.Split(fmt.Sprint(text), -1)...)
+		}
+	}
+	lines := make([]Line, 0, len(texts))
+	for _, text := range texts {
+		if grep != nil && !grep.MatchString(text) {
+			continue
+		}
+		lines = append(lines, Line{
+			Timestamp:  m.Timestamp,
+			HostID:     toString(m.Fields.CCWorkerID),
+			ServiceID:  m.Fields.Service,
+			InstanceID: toString(m.Fields.Instance),
+			File:       m.File,
+			Message:    text,
+		})
+	}
+	return lines
+}
+
+// toString formats fields that older versions of serviced sent as numbers
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Descendants returns the ids of the services and all of their descendants
+func Descendants(serviceIDs []string, services []service.ServiceDetails) []string {
+	children := make(map[string][]string)
+	for _, svc := range services {
+		children[svc.ParentServiceID] = append(children[svc.ParentServiceID], svc.ID)
+	}
+	var result []string
+	found := make(map[string]bool)
+	queue := append([]string{}, serviceIDs...)
+	for len(queue) > 0 {
+		serviceID := queue[0]
+		queue = queue[1:]
+		if found[serviceID] {
+			continue
+		}
+		found[serviceID] = true
+		result = append(result, serviceID)
+		queue = append(queue, children[serviceID]...)
+	}
+	return result
+}
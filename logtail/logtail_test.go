@@ -0,0 +1,316 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package logtail
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/control-center/serviced/domain/service"
+)
+
+// fakeLogstash answers searches from a list of log messages
+type fakeLogstash struct {
+	mu       sync.Mutex
+	messages map[string]map[string]interface{}
+	queries  []string
+}
+
+func (f *fakeLogstash) add(id string, timestamp time.Time, message interface{}, instance interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages[id] = map[string]interface{}{
+		"@timestamp": timestamp.UTC().Format(esTimeFormat),
+		"type":       "log",
+		"file":       "/var/log/app.log",
+		"message":    message,
+		"fields": map[string]interface{}{
+			"ccWorkerID": "host1",
+			"service":    "svc1",
+			"instance":   instance,
+		},
+	}
+}
+
+func (f *fakeLogstash) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Query struct {
+			Filtered struct {
+				Query struct {
+					QueryString struct {
+						Query string `json:"query"`
+					} `json:"query_string"`
+				} `json:"query"`
+				Filter struct {
+					Range struct {
+						Timestamp struct {
+							Gte string `json:"gte"`
+						} `json:"@timestamp"`
+					} `json:"range"`
+				} `json:"filter"`
+			} `json:"filtered"`
+		} `json:"query"`
+		From int `json:"from"`
+		Size int `json:"size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || r.URL.Path != "/logstash-*/_search" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	from, err := time.Parse(esTimeFormat, body.Query.Filtered.Filter.Range.Timestamp.Gte)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, body.Query.Filtered.Query.QueryString.Query)
+	var hits []searchHit
+	for id, message := range f.messages {
+		timestamp, _ := time.Parse(esTimeFormat, message["@timestamp"].(string))
+		if timestamp.Before(from) {
+			continue
+		}
+		source, _ := json.Marshal(message)
+		ms := float64(timestamp.UnixNano() / int64(time.Millisecond))
+		hits = append(hits, searchHit{ID: id, Source: source, Sort: []interface{}{ms, "log#" + id}})
+	}
+	sort.Sort(byTimestamp(hits))
+	if body.From < len(hits) {
+		hits = hits[body.From:]
+	} else {
+		hits = nil
+	}
+	if body.Size > 0 && body.Size < len(hits) {
+		hits = hits[:body.Size]
+	}
+	var result searchResult
+	result.Hits.Hits = hits
+	json.NewEncoder(w).Encode(result)
+}
+
+type byTimestamp []searchHit
+
+func (h byTimestamp) Len() int      { return len(h) }
+func (h byTimestamp) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h byTimestamp) Less(i, j int) bool {
+	var a, b logMessage
+	json.Unmarshal(h[i].Source, &a)
+	json.Unmarshal(h[j].Source, &b)
+	if a.Timestamp.Equal(b.Timestamp) {
+		return h[i].ID < h[j].ID
+	}
+	return a.Timestamp.Before(b.Timestamp)
+}
+
+func receive(t *testing.T, lines <-chan Line, count int) []string {
+	var messages []string
+	for i := 0; i < count; i++ {
+		select {
+		case line := <-lines:
+			messages = append(messages, fmt.Sprintf("%s/%s %s %s: %s", line.HostID, line.InstanceID, line.ServiceID, line.File, line.Message))
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for log lines; got %v", messages)
+		}
+	}
+	return messages
+}
+
+func TestTail(t *testing.T) {
+	start := time.Now().Add(-time.Minute).Truncate(time.Second)
+	logstash := &fakeLogstash{messages: make(map[string]map[string]interface{})}
+	logstash.add("old", start.Add(-time.Second), "before the tail", 0)
+	logstash.add("a", start.Add(time.Second), "first\nsecond", 0)
+	logstash.add("b", start.Add(2*time.Second), []interface{}{"third", "fourth"}, 1.0)
+	server := httptest.NewServer(logstash)
+	defer server.Close()
+
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+	client.PollInterval = 10 * time.Millisecond
+	client.Lag = 5 * time.Second
+
+	lines := make(chan Line)
+	cancel := make(chan struct{})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- client.Tail(Filter{ServiceIDs: []string{"svc1", "svc2"}, Since: start}, lines, cancel)
+	}()
+
+	expected := []string{
+		"host1/0 svc1 /var/log/app.log: first",
+		"host1/0 svc1 /var/log/app.log: second",
+		"host1/1 svc1 /var/log/app.log: third",
+		"host1/1 svc1 /var/log/app.log: fourth",
+	}
+	if actual := receive(t, lines, 4); strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+
+	// a message indexed late within the lag window is still sent, once
+	logstash.add("late", start.Add(1500*time.Millisecond), "late", "0")
+	logstash.add("c", start.Add(3*time.Second), "last", "0")
+	expected = []string{
+		"host1/0 svc1 /var/log/app.log: late",
+		"host1/0 svc1 /var/log/app.log: last",
+	}
+	if actual := receive(t, lines, 2); strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+	select {
+	case line := <-lines:
+		t.Errorf("Unexpected line %v", line)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(cancel)
+	if err := <-errc; err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	logstash.mu.Lock()
+	defer logstash.mu.Unlock()
+	if query := logstash.queries[0]; query != `type:log AND fields.service:("svc1" OR "svc2")` {
+		t.Errorf("Unexpected query %s", query)
+	}
+}
+
+func TestTailPages(t *testing.T) {
+	start := time.Now().Add(-time.Minute).Truncate(time.Second)
+	logstash := &fakeLogstash{messages: make(map[string]map[string]interface{})}
+	// more messages than a search returns, most of them with the same
+	// timestamp, all within one lag window
+	count := 2*searchSize + searchSize/2
+	for i := 0; i < count; i++ {
+		timestamp := start.Add(time.Second)
+		if i >= 2*searchSize {
+			timestamp = start.Add(time.Second + time.Duration(i)*time.Millisecond)
+		}
+		logstash.add(fmt.Sprintf("%05d", i), timestamp, fmt.Sprintf("message %d", i), 0)
+	}
+	server := httptest.NewServer(logstash)
+	defer server.Close()
+
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+	client.PollInterval = 10 * time.Millisecond
+	client.Lag = 10 * time.Second
+
+	lines := make(chan Line)
+	cancel := make(chan struct{})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- client.Tail(Filter{ServiceIDs: []string{"svc1"}, Since: start}, lines, cancel)
+	}()
+
+	received := make(map[string]bool)
+	for _, line := range receive(t, lines, count) {
+		if received[line] {
+			t.Errorf("Line %s was sent twice", line)
+		}
+		received[line] = true
+	}
+	for i := 0; i < count; i++ {
+		if line := fmt.Sprintf("host1/0 svc1 /var/log/app.log: message %d", i); !received[line] {
+			t.Errorf("Line %s was not sent", line)
+		}
+	}
+	select {
+	case line := <-lines:
+		t.Errorf("Unexpected line %v", line)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(cancel)
+	if err := <-errc; err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestTailUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+	err := client.Tail(Filter{ServiceIDs: []string{"svc1"}}, make(chan Line), make(chan struct{}))
+	if err == nil {
+		t.Errorf("Expected an error")
+	}
+}
+
+func TestBuildQuery(t *testing.T) {
+	if _, err := buildQuery(Filter{}); err != ErrNoServices {
+		t.Errorf("Expected %s, got %v", ErrNoServices, err)
+	}
+	if _, err := buildQuery(Filter{ServiceIDs: []string{"svc1) OR (*"}}); err == nil {
+		t.Errorf("Expected an error for an invalid service ID")
+	}
+	if _, err := buildQuery(Filter{ServiceIDs: []string{"svc1"}, InstanceID: "0 OR *"}); err == nil {
+		t.Errorf("Expected an error for an invalid instance ID")
+	}
+	query, err := buildQuery(Filter{ServiceIDs: []string{"svc-2", "svc-1"}, InstanceID: "3"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if expected := `type:log AND fields.service:("svc-1" OR "svc-2") AND fields.instance:"3"`; query != expected {
+		t.Errorf("Expected %s, got %s", expected, query)
+	}
+}
+
+func TestLinesGrep(t *testing.T) {
+	message, err := parseMessage([]byte(`{"@timestamp":"2016-10-19T12:00:00.000Z","file":"app.log","message":"ok\r\nERROR: failed\nok","fields":{"ccWorkerID":123,"service":"svc1","instance":2}}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	lines := message.lines(regexp.MustCompile("ERROR"))
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 line, got %v", lines)
+	}
+	line := lines[0]
+	if line.Message != "ERROR: failed" || line.HostID != "123" || line.InstanceID != "2" || line.File != "app.log" {
+		t.Errorf("Unexpected line %+v", line)
+	}
+	if len(message.lines(nil)) != 3 {
+		t.Errorf("Expected 3 lines")
+	}
+}
+
+func TestDescendants(t *testing.T) {
+	services := []service.ServiceDetails{
+		{ID: "root"},
+		{ID: "a", ParentServiceID: "root"},
+		{ID: "b", ParentServiceID: "root"},
+		{ID: "a1", ParentServiceID: "a"},
+		{ID: "other"},
+	}
+	expected := []string{"a", "a1"}
+	if actual := Descendants([]string{"a"}, services); strings.Join(actual, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+	expected = []string{"root", "a1", "a", "b"}
+	if actual := Descendants([]string{"root", "a1"}, services); strings.Join(actual, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
@@ -35,6 +35,7 @@ import (
 	"github.com/control-center/serviced/commons/docker"
 	"github.com/control-center/serviced/commons/iptables"
 	coordclient "github.com/control-center/serviced/coordinator/client"
+	coordetcd "github.com/control-center/serviced/coordinator/client/etcd"
 	coordzk "github.com/control-center/serviced/coordinator/client/zookeeper"
 	"github.com/control-center/serviced/dfs/registry"
 	"github.com/control-center/serviced/domain/addressassignment"
@@ -92,6 +93,8 @@ type HostAgent struct {
 	delegateKeyFile      string
 	tokenFile            string
 	conntrackFlush       bool
+	drainTimeout         time.Duration
+	muxMultiplex         bool
 	serviceCache         *ServiceCache
 	vip                  VIP
 }
@@ -128,6 +131,7 @@ type AgentOptions struct {
 	Mount                []string
 	FSType               volume.DriverType
 	Zookeepers           []string
+	Etcd                 []string
 	Mux                  *proxy.TCPMux
 	MuxPort              string
 	UseTLS               bool
@@ -146,6 +150,8 @@ type AgentOptions struct {
 	DelegateKeyFile      string
 	TokenFile            string
 	ConntrackFlush       bool
+	DrainTimeout         time.Duration // How long a stopping instance waits for its connections to drain
+	MuxMultiplex         bool          // Multiplex connections to remote muxes over persistent sessions
 }
 
 // NewHostAgent creates a new HostAgent given a connection string
@@ -174,6 +180,8 @@ func NewHostAgent(options AgentOptions, reg registry.Registry) (*HostAgent, erro
 	agent.delegateKeyFile = options.DelegateKeyFile
 	agent.tokenFile = options.TokenFile
 	agent.conntrackFlush = options.ConntrackFlush
+	agent.drainTimeout = options.DrainTimeout
+	agent.muxMultiplex = options.MuxMultiplex
 	agent.serviceCache = NewServiceCache(options.Master)
 
 	var err error
@@ -183,7 +191,13 @@ func NewHostAgent(options AgentOptions, reg registry.Registry) (*HostAgent, erro
 		options.ZKPerHostConnectDelay,
 		options.ZKReconnectStartDelay,
 		options.ZKReconnectMaxDelay)
-	if agent.zkClient, err = coordclient.New("zookeeper", dsn, "", nil); err != nil {
+	if len(options.Etcd) > 0 {
+		dsn = coordetcd.NewDSN(options.Etcd,
+			time.Duration(agent.zkSessionTimeout)*time.Second,
+			time.Duration(options.ZKConnectTimeout)*time.Second,
+		).String()
+	}
+	if agent.zkClient, err = coordclient.New(coordclient.DriverName(dsn), dsn, "", nil); err != nil {
 		return nil, err
 	}
 	if agent.storage, err = volume.GetDriver(options.VolumesPath); err != nil {
@@ -314,6 +328,7 @@ func (a *HostAgent) setupVolume(tenantID string, service *service.Service, volum
 	if len(strings.TrimSpace(containerPath)) == 0 {
 		containerPath = volume.ContainerPath
 	}
+	a.pullreg.SetConnection(conn)
 	image, err := a.pullreg.ImagePath(service.ImageID)
 	if err != nil {
 		glog.Errorf("Could not get registry image for %s: %s", service.ImageID, err)
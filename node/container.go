@@ -79,7 +79,7 @@ func (a *HostAgent) StopContainer(serviceID string, instanceID int) error {
 	}
 
 	a.setInstanceState(serviceID, instanceID, service.StateStopping)
-	err = ctr.Stop(45 * time.Second)
+	err = ctr.Stop(45*time.Second + a.drainTimeout)
 	if _, ok := err.(*dockerclient.ContainerNotRunning); ok {
 		logger.Debug("Container already stopped")
 		return nil
@@ -250,7 +250,7 @@ func (a *HostAgent) RestartContainer(cancel <-chan interface{}, serviceID string
 		// deleted before the pull is successful, then this will just be a
 		// no-op.  The restart of the container is handled by the delegate once
 		// it is notified that the container has stopped.
-		if err := ctr.Stop(45 * time.Second); err != nil {
+		if err := ctr.Stop(45*time.Second + a.drainTimeout); err != nil {
 			logger.WithError(err).Debug("Could not stop container")
 		}
 	}()
@@ -604,6 +604,7 @@ func (a *HostAgent) createContainerConfig(tenantID string, svc *service.Service,
 				state.Imports = append(state.Imports, zkservice.ImportBinding{
 					Application:    endpoint.Application,
 					Purpose:        endpoint.Purpose,
+					Protocol:       endpoint.Protocol,
 					PortNumber:     endpoint.PortNumber,
 					PortTemplate:   endpoint.PortTemplate,
 					VirtualAddress: endpoint.VirtualAddress,
@@ -747,7 +748,9 @@ func (a *HostAgent) createContainerConfig(tenantID string, svc *service.Service,
 		fmt.Sprintf("SERVICED_SERVICE_IMAGE=%s", svc.ImageID),
 		fmt.Sprintf("SERVICED_MAX_RPC_CLIENTS=1"),
 		fmt.Sprintf("SERVICED_MUX_PORT=%s", a.muxport),
+		fmt.Sprintf("SERVICED_MUX_MULTIPLEX=%t", a.muxMultiplex),
 		fmt.Sprintf("SERVICED_RPC_PORT=%s", a.rpcport),
+		fmt.Sprintf("SERVICED_DRAIN_TIMEOUT=%d", int(a.drainTimeout.Seconds())),
 		fmt.Sprintf("SERVICED_LOG_ADDRESS=%s", a.logstashURL),
 		//The SERVICED_UI_PORT environment variable is deprecated and services should always use port 443 to contact serviced from inside a container
 		"SERVICED_UI_PORT=443",
@@ -14,8 +14,14 @@
 package proxy
 
 import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+
+	"github.com/control-center/serviced/auth"
 )
 
 var (
@@ -95,3 +101,56 @@ func TempKeyFile() (string, error) {
 	fmt.Fprint(f, InsecureKeyPEM)
 	return f.Name(), nil
 }
+
+// DialMuxTLS connects to a remote mux over TLS. If this host has been issued
+// a mux certificate, it is presented to the mux and the mux must present one
+// issued by the same CA, unless it still presents the default certificate
+// because it has not been issued one yet or runs an older release. Otherwise
+// the connection is not verified.
+func DialMuxTLS(network, address string) (*tls.Conn, error) {
+	config := &tls.Config{InsecureSkipVerify: true}
+	cert, err := auth.MuxCertificate()
+	if err != nil {
+		return tls.Dial(network, address, config)
+	}
+	config.Certificates = []tls.Certificate{*cert}
+	conn, err := tls.Dial(network, address, config)
+	if err != nil {
+		return nil, err
+	}
+	chain := conn.ConnectionState().PeerCertificates
+	if _, err := auth.VerifyMuxCertificate(chain); err != nil {
+		if len(chain) > 0 && isInsecureCertificate(chain[0]) {
+			log.WithField("address", address).Debug("Mux has no certificate yet, connecting without verifying it")
+			return conn, nil
+		}
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// isInsecureCertificate returns true if the certificate is the default one
+// that muxes present until they are issued their own.
+func isInsecureCertificate(cert *x509.Certificate) bool {
+	block, _ := pem.Decode([]byte(InsecureCertPEM))
+	return block != nil && bytes.Equal(block.Bytes, cert.Raw)
+}
+
+// MuxServerTLSConfig updates the tls configuration of the mux listener so
+// that it presents this host's mux certificate once it has been issued, and
+// asks callers for theirs. The default certificate is used until then.
+// Callers are not required to present a certificate during the handshake;
+// the mux decides whether they must have one once it knows their host.
+func MuxServerTLSConfig(config *tls.Config) *tls.Config {
+	defaults := config.Certificates
+	config.Certificates = nil
+	config.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if cert, err := auth.MuxCertificate(); err == nil {
+			return cert, nil
+		}
+		return &defaults[0], nil
+	}
+	config.ClientAuth = tls.RequestClientCert
+	return config
+}
@@ -0,0 +1,294 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+/*
+UDP traffic is carried across the TCP mux by framing each datagram with its
+length, so that datagram boundaries survive the stream:
+
+   ---------------------------------------------
+   | Length (2 bytes)  |  Datagram (N bytes)   |
+   ---------------------------------------------
+*/
+
+// MaxDatagramSize is the largest datagram that can be relayed.
+const MaxDatagramSize = 65535
+
+// DefaultDatagramTimeout is how long a datagram session may be idle before
+// its upstream connection is closed.
+const DefaultDatagramTimeout = 60 * time.Second
+
+// ErrDatagramTooLarge is returned when a datagram cannot be framed.
+var ErrDatagramTooLarge = errors.New("datagram too large")
+
+// datagramConn frames datagrams over a stream connection.
+type datagramConn struct {
+	net.Conn
+	rmu sync.Mutex
+	wmu sync.Mutex
+}
+
+// NewDatagramConn wraps a stream connection so that each Write sends one
+// framed datagram and each Read returns one datagram.
+func NewDatagramConn(conn net.Conn) net.Conn {
+	return &datagramConn{Conn: conn}
+}
+
+// Read reads a single datagram from the stream. If b is too small to hold
+// the datagram, the remainder is discarded, as it would be for a UDP socket.
+func (c *datagramConn) Read(b []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	var size uint16
+	if err := binary.Read(c.Conn, binary.BigEndian, &size); err != nil {
+		return 0, err
+	}
+	n := int(size)
+	if n > len(b) {
+		if _, err := io.ReadFull(c.Conn, b); err != nil {
+			return 0, err
+		}
+		if _, err := io.CopyN(ioutil.Discard, c.Conn, int64(n-len(b))); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	return io.ReadFull(c.Conn, b[:n])
+}
+
+// Write sends b as a single framed datagram.
+func (c *datagramConn) Write(b []byte) (int, error) {
+	if len(b) > MaxDatagramSize {
+		return 0, ErrDatagramTooLarge
+	}
+	frame := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(frame, uint16(len(b)))
+	copy(frame[2:], b)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := c.Conn.Write(frame); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// DatagramLoop relays datagrams between two connections that preserve
+// datagram boundaries, until either side fails or quit is closed.
+func DatagramLoop(client net.Conn, backend net.Conn, quit chan bool) {
+	done := make(chan struct{}, 2)
+	var broker = func(to, from net.Conn) {
+		buf := make([]byte, MaxDatagramSize)
+		for {
+			n, err := from.Read(buf)
+			if err != nil {
+				break
+			}
+			if _, err := to.Write(buf[:n]); err != nil {
+				break
+			}
+		}
+		done <- struct{}{}
+	}
+
+	go broker(client, backend)
+	go broker(backend, client)
+
+	select {
+	case <-done:
+	case <-quit:
+	}
+	client.Close()
+	backend.Close()
+}
+
+// datagramQueueSize is how many datagrams from a client are held while its
+// upstream connection is being set up.  Datagrams beyond that are dropped.
+const datagramQueueSize = 64
+
+// datagramSession tracks the upstream connection for a single client
+// address.
+type datagramSession struct {
+	packets  chan []byte   // datagrams from the client waiting to be forwarded
+	quit     chan struct{} // closed when the session is shut down
+	once     sync.Once
+	lastSeen int64 // unix nanoseconds of the last datagram in either direction
+}
+
+func newDatagramSession() *datagramSession {
+	s := &datagramSession{
+		packets: make(chan []byte, datagramQueueSize),
+		quit:    make(chan struct{}),
+	}
+	s.touch()
+	return s
+}
+
+func (s *datagramSession) touch() {
+	atomic.StoreInt64(&s.lastSeen, time.Now().UnixNano())
+}
+
+func (s *datagramSession) idle() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&s.lastSeen)))
+}
+
+func (s *datagramSession) close() {
+	s.once.Do(func() { close(s.quit) })
+}
+
+// ServeDatagrams reads datagrams off the packet listener and relays them to
+// an upstream connection created by dial, one per client address. Replies
+// are written back to the client. Sessions that are idle for longer than
+// timeout are closed. ServeDatagrams returns when the listener is closed.
+//
+// Upstream connections are dialed in the background, so that a slow dial
+// for one client does not hold up the others; the client's datagrams are
+// queued until its connection is ready.
+func ServeDatagrams(listener net.PacketConn, dial func() (net.Conn, error), timeout time.Duration) error {
+	logger := log.WithFields(logrus.Fields{
+		"address": listener.LocalAddr(),
+	})
+	if timeout <= 0 {
+		timeout = DefaultDatagramTimeout
+	}
+
+	mu := &sync.Mutex{}
+	sessions := make(map[string]*datagramSession)
+	defer func() {
+		mu.Lock()
+		for _, s := range sessions {
+			s.close()
+		}
+		mu.Unlock()
+	}()
+
+	buf := make([]byte, MaxDatagramSize)
+	for {
+		n, addr, err := listener.ReadFrom(buf)
+		if err != nil {
+			logger.WithError(err).Debug("Stopped reading datagrams")
+			return err
+		}
+
+		key := addr.String()
+		mu.Lock()
+		s, ok := sessions[key]
+		if !ok {
+			s = newDatagramSession()
+			sessions[key] = s
+			logger.WithField("clientaddr", key).Debug("Started datagram session")
+			go func(key string, addr net.Addr, s *datagramSession) {
+				serveDatagramSession(listener, addr, s, dial, timeout, logger.WithField("clientaddr", key))
+				mu.Lock()
+				if sessions[key] == s {
+					delete(sessions, key)
+				}
+				mu.Unlock()
+				logger.WithField("clientaddr", key).Debug("Closed datagram session")
+			}(key, addr, s)
+		}
+		mu.Unlock()
+
+		s.touch()
+		packet := make([]byte, n)
+		copy(packet, buf[:n])
+		select {
+		case s.packets <- packet:
+		default:
+			logger.WithField("clientaddr", key).Debug("Datagram queue is full; dropping datagram")
+		}
+	}
+}
+
+// serveDatagramSession dials the upstream connection of a session, then
+// forwards the client's datagrams to it and its replies back to the client
+// until the connection fails, the session goes idle or it is shut down.
+func serveDatagramSession(listener net.PacketConn, addr net.Addr, s *datagramSession, dial func() (net.Conn, error), timeout time.Duration, logger *logrus.Entry) {
+	defer s.close()
+
+	conn, err := dial()
+	if err != nil {
+		logger.WithError(err).Warn("Could not set up upstream connection; dropping datagrams")
+		return
+	}
+
+	go func() {
+		defer conn.Close()
+		for {
+			select {
+			case packet := <-s.packets:
+				if _, err := conn.Write(packet); err != nil {
+					logger.WithError(err).Debug("Could not forward datagram")
+					return
+				}
+			case <-s.quit:
+				return
+			}
+		}
+	}()
+
+	relayDatagrams(listener, addr, conn, s, timeout)
+}
+
+// relayDatagrams writes replies from the session's upstream connection back
+// to the client until the connection fails or the session goes idle.
+func relayDatagrams(listener net.PacketConn, addr net.Addr, conn net.Conn, s *datagramSession, timeout time.Duration) {
+	defer conn.Close()
+
+	// close the upstream connection once the session has been idle for
+	// longer than the timeout.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(timeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if s.idle() > timeout {
+					conn.Close()
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, MaxDatagramSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		s.touch()
+		if _, err := listener.WriteTo(buf[:n], addr); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package proxy
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDatagramConn(t *testing.T) {
+	a, b := net.Pipe()
+	client, server := NewDatagramConn(a), NewDatagramConn(b)
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		client.Write([]byte("hello"))
+		client.Write([]byte("world!"))
+	}()
+
+	buf := make([]byte, 16)
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(buf[:n]) != "hello" {
+		t.Fatalf("expected %q, got %q", "hello", buf[:n])
+	}
+
+	// short reads truncate the datagram
+	n, err = server.Read(buf[:5])
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(buf[:n]) != "world" {
+		t.Fatalf("expected %q, got %q", "world", buf[:n])
+	}
+}
+
+// startUDPEcho starts a udp server that echoes every datagram it receives
+func startUDPEcho(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %s", err)
+	}
+	go func() {
+		buf := make([]byte, MaxDatagramSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(buf[:n], addr)
+		}
+	}()
+	return conn
+}
+
+func TestServeDatagrams(t *testing.T) {
+	echo := startUDPEcho(t)
+	defer echo.Close()
+
+	listener, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %s", err)
+	}
+	defer listener.Close()
+
+	// relay the datagrams through a framed stream, as the mux does
+	dial := func() (net.Conn, error) {
+		backend, err := net.Dial("udp4", echo.LocalAddr().String())
+		if err != nil {
+			return nil, err
+		}
+		a, b := net.Pipe()
+		go DatagramLoop(NewDatagramConn(b), backend, make(chan bool))
+		return NewDatagramConn(a), nil
+	}
+	go ServeDatagrams(listener, dial, time.Minute)
+
+	client, err := net.Dial("udp4", listener.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("could not dial: %s", err)
+	}
+	defer client.Close()
+
+	buf := make([]byte, 64)
+	for _, msg := range []string{"ping", "pong"} {
+		if _, err := client.Write([]byte(msg)); err != nil {
+			t.Fatalf("could not write: %s", err)
+		}
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := client.Read(buf)
+		if err != nil {
+			t.Fatalf("could not read: %s", err)
+		}
+		if string(buf[:n]) != msg {
+			t.Fatalf("expected %q, got %q", msg, buf[:n])
+		}
+	}
+}
+
+func TestServeDatagrams_SlowDial(t *testing.T) {
+	echo := startUDPEcho(t)
+	defer echo.Close()
+
+	listener, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %s", err)
+	}
+	defer listener.Close()
+
+	// the first dial blocks until it is released
+	var calls int32
+	release := make(chan struct{})
+	dial := func() (net.Conn, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-release
+		}
+		backend, err := net.Dial("udp4", echo.LocalAddr().String())
+		if err != nil {
+			return nil, err
+		}
+		a, b := net.Pipe()
+		go DatagramLoop(NewDatagramConn(b), backend, make(chan bool))
+		return NewDatagramConn(a), nil
+	}
+	go ServeDatagrams(listener, dial, time.Minute)
+
+	slow, err := net.Dial("udp4", listener.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("could not dial: %s", err)
+	}
+	defer slow.Close()
+	if _, err := slow.Write([]byte("slow")); err != nil {
+		t.Fatalf("could not write: %s", err)
+	}
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// another client is served while the first one is still dialing
+	fast, err := net.Dial("udp4", listener.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("could not dial: %s", err)
+	}
+	defer fast.Close()
+	if _, err := fast.Write([]byte("fast")); err != nil {
+		t.Fatalf("could not write: %s", err)
+	}
+	buf := make([]byte, 64)
+	fast.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := fast.Read(buf)
+	if err != nil {
+		t.Fatalf("could not read: %s", err)
+	}
+	if string(buf[:n]) != "fast" {
+		t.Fatalf("expected %q, got %q", "fast", buf[:n])
+	}
+
+	// the queued datagram is delivered once the dial finishes
+	close(release)
+	slow.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err = slow.Read(buf)
+	if err != nil {
+		t.Fatalf("could not read: %s", err)
+	}
+	if string(buf[:n]) != "slow" {
+		t.Fatalf("expected %q, got %q", "slow", buf[:n])
+	}
+}
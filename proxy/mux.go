@@ -19,30 +19,61 @@ import (
 	"github.com/control-center/serviced/logging"
 	"github.com/control-center/serviced/utils"
 
+	"bytes"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
 var (
 	log = logging.PackageLogger()
+
+	// ErrMuxHostMismatch is returned when the mux header was signed by a
+	// different host than the one that presented the certificate.
+	ErrMuxHostMismatch = errors.New("mux header identity does not match the peer certificate")
+
+	// ErrMuxCertificateRequired is returned when a caller does not present a
+	// certificate although its host has been issued one.
+	ErrMuxCertificateRequired = errors.New("host has been issued a mux certificate but did not present it")
 )
 
+// MuxAuthorizer decides whether a caller may reach a container address
+// through the mux.
+type MuxAuthorizer interface {
+	// Authorize returns an error if the host of the identity may not reach
+	// the address.  The tenant and application named by the caller, if any,
+	// only help to find the endpoint at the address and must not be trusted.
+	Authorize(identity auth.Identity, tenantID, application, address string) error
+
+	// AllowWithoutCertificate returns true if the host may call the mux
+	// without presenting a certificate, which is only until the master has
+	// issued it one.
+	AllowWithoutCertificate(hostID string) (bool, error)
+}
+
 // TCPMux is an implementation of tcp muxing RFC 1078.
 type TCPMux struct {
 	listener    net.Listener    // the connection this mux listens on
 	connections chan net.Conn   // stream of accepted connections
 	closing     chan chan error // shutdown noticiation
+	authorizer  MuxAuthorizer   // checks callers, nil if they are not verified
 	log         *logrus.Entry
 }
 
 // NewTCPMux creates a new tcp mux with the given listener. If it succees, it
 // is expected that this object is the owner of the listener and will close it
-// when Close() is called on the TCPMux.
-func NewTCPMux(listener net.Listener) (mux *TCPMux, err error) {
+// when Close() is called on the TCPMux. If an authorizer is given, callers
+// that present a certificate on TLS connections must have been issued it by
+// the mux CA, and may only reach the addresses the authorizer allows for
+// their host. Callers without a certificate are accepted only while the
+// authorizer allows their host to call without one.
+func NewTCPMux(listener net.Listener, authorizer MuxAuthorizer) (mux *TCPMux, err error) {
 	log.Debug("Starting TCP multiplexer")
 	if listener == nil {
 		return nil, fmt.Errorf("listener can not be nil")
@@ -51,6 +82,7 @@ func NewTCPMux(listener net.Listener) (mux *TCPMux, err error) {
 		listener:    listener,
 		connections: make(chan net.Conn),
 		closing:     make(chan chan error),
+		authorizer:  authorizer,
 		log: log.WithFields(logrus.Fields{
 			"address": listener.Addr(),
 		}),
@@ -133,7 +165,8 @@ func (mux *TCPMux) loop() {
 // then attempts to set up a connection to the service specified by the
 // line. The service is specified in the form "IP:PORT\n". If the connection
 // to the service is sucessful, all traffic continues to be proxied between
-// two connections.
+// two connections. UDP services receive the framed datagrams carried by the
+// connection.
 func (mux *TCPMux) muxConnection(conn net.Conn) {
 
 	log := mux.log.WithFields(logrus.Fields{
@@ -142,25 +175,171 @@ func (mux *TCPMux) muxConnection(conn net.Conn) {
 	// make sure that we don't block indefinitely
 	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
 
-	// TODO retrieve and validate the identity of the sender
-	addrPacked, _, err := auth.ReadMuxHeader(conn)
+	// Verify the certificate of the sender
+	peerHostID := ""
+	noPeerCert := false
+	if tlsConn, ok := conn.(*tls.Conn); ok && mux.authorizer != nil {
+		if err := tlsConn.Handshake(); err != nil {
+			log.WithError(err).Warn("TLS handshake failed. Closing connection")
+			conn.Close()
+			return
+		}
+		chain := tlsConn.ConnectionState().PeerCertificates
+		if len(chain) == 0 {
+			// Checked against the host in the header
+			noPeerCert = true
+		} else if hostID, err := auth.VerifyMuxCertificate(chain); err == auth.ErrNoMuxCertificate {
+			// This host cannot verify certificates until it has been
+			// issued its own, so the caller is known by its token.
+			log.Debug("No mux certificate to verify the peer with")
+		} else if err != nil {
+			log.WithError(err).Warn("Unable to verify peer certificate. Closing connection")
+			conn.Close()
+			return
+		} else {
+			peerHostID = hostID
+			log = log.WithField("peerhostid", peerHostID)
+		}
+	}
+
+	addrPacked, identity, err := auth.ReadMuxHeader(conn)
 	if err != nil {
 		log.WithError(err).Warn("Unable to read valid mux header. Closing connection")
 		conn.Close()
 		return
 	}
 
-	address := utils.UnpackTCPAddressToString(addrPacked)
+	// Make sure the header was signed by the host with the certificate
+	if peerHostID != "" && identity.HostID() != peerHostID {
+		log.WithError(ErrMuxHostMismatch).WithField("hostid", identity.HostID()).Warn("Rejecting mux connection. Closing connection")
+		conn.Close()
+		return
+	}
+
+	// Callers may only leave out their certificate until they are issued one
+	if noPeerCert {
+		if err := mux.allowWithoutCertificate(identity); err != nil {
+			log.WithError(err).WithField("hostid", identity.HostID()).Warn("Rejecting mux connection without a peer certificate. Closing connection")
+			conn.Close()
+			return
+		}
+	}
 
 	// Restore the read deadline
 	conn.SetReadDeadline(time.Time{})
 
-	// Dial the requested address
+	// Serve the streams of a multiplexed session
+	if auth.MuxProtocol(addrPacked) == "session" {
+		log.Debug("Starting multiplexed session")
+		go mux.serveSession(NewServerSession(conn, DefaultSessionConfig), identity)
+		return
+	}
+
+	mux.proxyConnection(log, identity, conn, addrPacked)
+}
+
+// serveSession proxies each stream opened on the session to the container
+// address in the stream's header, as long as the caller keeps the session's
+// token current.  Each stream is authorized on its own.
+func (mux *TCPMux) serveSession(session *Session, identity auth.Identity) {
+	log := mux.log.WithFields(logrus.Fields{
+		"remoteaddr": session.conn.RemoteAddr(),
+		"hostid":     identity.HostID(),
+	})
+	defer log.Debug("Multiplexed session closed")
+	current := &sessionIdentity{identity: identity}
+	go mux.checkSessionToken(log, session, current)
+	for {
+		stream, err := session.Accept()
+		if err != nil {
+			return
+		}
+		if len(stream.Header()) < auth.ADDRESS_BYTES {
+			log.Warn("Received stream with an invalid header. Closing stream")
+			stream.Close()
+			continue
+		}
+		go mux.proxyConnection(log, current.get(), stream, stream.Header())
+	}
+}
+
+// sessionTokenCheckInterval is how often a session's token is checked for
+// expiration
+var sessionTokenCheckInterval = 10 * time.Second
+
+// sessionIdentity is the identity of the latest token sent on a session
+type sessionIdentity struct {
+	mu       sync.Mutex
+	identity auth.Identity
+}
+
+func (s *sessionIdentity) get() auth.Identity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.identity
+}
+
+func (s *sessionIdentity) set(identity auth.Identity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.identity = identity
+}
+
+// checkSessionToken updates the identity of the session with the tokens sent
+// by the caller, and closes the session once its token expires or if the
+// caller sends a token that is not valid for the same host.
+func (mux *TCPMux) checkSessionToken(log *logrus.Entry, session *Session, current *sessionIdentity) {
+	identity := current.get()
+	ticker := time.NewTicker(sessionTokenCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case header := <-session.Tokens():
+			_, id, err := auth.ReadMuxHeader(bytes.NewReader(header))
+			if err != nil {
+				log.WithError(err).Warn("Unable to read valid token on mux session. Closing session")
+				session.Close()
+				return
+			}
+			if id.HostID() != identity.HostID() {
+				log.WithError(ErrMuxHostMismatch).WithField("tokenhostid", id.HostID()).Warn("Rejecting token on mux session. Closing session")
+				session.Close()
+				return
+			}
+			identity = id
+			current.set(id)
+		case <-ticker.C:
+			if identity.Expired() {
+				log.Info("Mux session token expired. Closing session")
+				session.Close()
+				return
+			}
+		case <-session.Closed():
+			return
+		}
+	}
+}
+
+// proxyConnection dials the container address and relays the connection to
+// it.
+func (mux *TCPMux) proxyConnection(log *logrus.Entry, identity auth.Identity, conn net.Conn, addrPacked []byte) {
+	address := utils.UnpackTCPAddressToString(addrPacked)
+	protocol := auth.MuxProtocol(addrPacked)
+
 	log = log.WithFields(logrus.Fields{
-		"remoteaddr":    conn.RemoteAddr(),
 		"containeraddr": address,
+		"protocol":      protocol,
 	})
-	svc, err := net.Dial("tcp4", address)
+
+	// Make sure the caller may reach the address
+	if err := mux.authorize(identity, addrPacked, address); err != nil {
+		log.WithError(err).Warn("Caller is not authorized to reach the container address. Closing connection")
+		conn.Close()
+		return
+	}
+
+	// Dial the requested address
+	svc, err := net.Dial(protocol+"4", address)
 	if err != nil {
 		log.Debug("Unable to dial container address. Perhaps the container is still starting?")
 		conn.Close()
@@ -169,7 +348,39 @@ func (mux *TCPMux) muxConnection(conn net.Conn) {
 
 	// Wire up the incoming connection to the one we just dialed
 	quit := make(chan bool)
-	go ProxyLoop(conn, svc, quit)
+	if protocol == "udp" {
+		go DatagramLoop(NewDatagramConn(conn), svc, quit)
+	} else {
+		go ProxyLoop(conn, svc, quit)
+	}
+}
+
+// authorize checks that the caller's host may reach the address.  Streams on
+// a session are authorized with the identity of the session, which must not
+// have expired.
+func (mux *TCPMux) authorize(identity auth.Identity, addrPacked []byte, address string) error {
+	if mux.authorizer == nil {
+		return nil
+	}
+	if identity.Expired() {
+		return auth.ErrIdentityTokenExpired
+	}
+	tenantID, application, _ := auth.MuxScope(addrPacked)
+	return mux.authorizer.Authorize(identity, tenantID, application, address)
+}
+
+// allowWithoutCertificate checks that the caller's host has not been issued
+// a mux certificate, so it is allowed to call without one.
+func (mux *TCPMux) allowWithoutCertificate(identity auth.Identity) error {
+	if identity.Expired() {
+		return auth.ErrIdentityTokenExpired
+	}
+	if ok, err := mux.authorizer.AllowWithoutCertificate(identity.HostID()); err != nil {
+		return err
+	} else if !ok {
+		return ErrMuxCertificateRequired
+	}
+	return nil
 }
 
 func ProxyLoop(client net.Conn, backend net.Conn, quit chan bool) {
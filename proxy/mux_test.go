@@ -16,10 +16,16 @@
 package proxy
 
 import (
+	"bytes"
+	"crypto/tls"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -130,7 +136,7 @@ func TestTCPMux(t *testing.T) {
 	if err != nil {
 		t.Fatalf("could not create tcpmux endpoint: %s", err)
 	}
-	mux, err := NewTCPMux(muxEndpoint)
+	mux, err := NewTCPMux(muxEndpoint, nil)
 	if err != nil {
 		t.Fatalf("did not expect failure creating TCPMux: %s", err)
 	}
@@ -161,3 +167,376 @@ func TestTCPMux(t *testing.T) {
 	conn.Close()
 
 }
+
+type testAuthorizer struct {
+	hostID string
+	mu     sync.Mutex
+	issued map[string]bool
+}
+
+func (a *testAuthorizer) Authorize(identity auth.Identity, tenantID, application, address string) error {
+	if identity.HostID() != a.hostID {
+		return fmt.Errorf("unauthorized")
+	}
+	return nil
+}
+
+func (a *testAuthorizer) AllowWithoutCertificate(hostID string) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return !a.issued[hostID], nil
+}
+
+func (a *testAuthorizer) issue(hostID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.issued == nil {
+		a.issued = make(map[string]bool)
+	}
+	a.issued[hostID] = true
+}
+
+func TestTCPMuxAuthorizer(t *testing.T) {
+
+	pub, priv, _ := auth.GenerateRSAKeyPairPEM(nil)
+	auth.LoadMasterKeysFromPEM(pub, priv)
+
+	dpub, priv, _ := auth.GenerateRSAKeyPairPEM(nil)
+	auth.LoadDelegateKeysFromPEM(pub, priv)
+
+	target := newEchoListener(t)
+	defer target.Close()
+
+	muxEndpoint, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("could not create tcpmux endpoint: %s", err)
+	}
+	mux, err := NewTCPMux(muxEndpoint, &testAuthorizer{hostID: "host"})
+	if err != nil {
+		t.Fatalf("did not expect failure creating TCPMux: %s", err)
+	}
+	defer mux.Close()
+
+	addr, err := utils.PackTCPAddressString(fmt.Sprintf("127.0.0.1:%s", listenerToPort(target.listener)))
+	if err != nil {
+		t.Fatalf("could not pack address: %s", err)
+	}
+	token, _, err := auth.CreateJWTIdentity("host", "pool", true, true, dpub, time.Hour)
+	if err != nil {
+		t.Fatalf("could not create token: %s", err)
+	}
+	otherToken, _, err := auth.CreateJWTIdentity("otherhost", "pool", true, true, dpub, time.Hour)
+	if err != nil {
+		t.Fatalf("could not create token: %s", err)
+	}
+
+	tryConnect := func(write func(conn net.Conn) error) bool {
+		conn := mux.testConnect(t)
+		defer conn.Close()
+		if err := write(conn); err != nil {
+			t.Fatalf("could not write mux header: %s", err)
+		}
+		conn.Write([]byte("hello"))
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buffer := make([]byte, 16)
+		n, _ := conn.Read(buffer)
+		return string(buffer[:n]) == "hello"
+	}
+
+	// the caller's host is authorized, whatever tenant it names
+	if tryConnect(func(conn net.Conn) error {
+		return auth.AddSignedMuxHeaderScope(conn, addr, "tcp", "tenant", "app", otherToken)
+	}) {
+		t.Errorf("expected a connection from another host to be rejected")
+	}
+	if !tryConnect(func(conn net.Conn) error {
+		return auth.AddSignedMuxHeaderScope(conn, addr, "tcp", "tenant", "app", token)
+	}) {
+		t.Errorf("expected the connection to be proxied")
+	}
+	if !tryConnect(func(conn net.Conn) error { return auth.AddSignedMuxHeader(conn, addr, token) }) {
+		t.Errorf("expected a connection without a scope to be proxied")
+	}
+}
+
+func TestTCPMuxBootstrapWindow(t *testing.T) {
+	defer auth.ClearMuxCertificates()
+
+	pub, priv, _ := auth.GenerateRSAKeyPairPEM(nil)
+	auth.LoadMasterKeysFromPEM(pub, priv)
+
+	dpub, priv, _ := auth.GenerateRSAKeyPairPEM(nil)
+	auth.LoadDelegateKeysFromPEM(pub, priv)
+
+	target := newEchoListener(t)
+	defer target.Close()
+
+	cert, err := tls.X509KeyPair([]byte(InsecureCertPEM), []byte(InsecureKeyPEM))
+	if err != nil {
+		t.Fatalf("could not load default certificate: %s", err)
+	}
+	config := MuxServerTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}})
+	muxEndpoint, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("could not create tcpmux endpoint: %s", err)
+	}
+	authorizer := &testAuthorizer{hostID: "host"}
+	mux, err := NewTCPMux(muxEndpoint, authorizer)
+	if err != nil {
+		t.Fatalf("did not expect failure creating TCPMux: %s", err)
+	}
+	defer mux.Close()
+	muxAddr := muxEndpoint.Addr().String()
+
+	addr, err := utils.PackTCPAddressString(fmt.Sprintf("127.0.0.1:%s", listenerToPort(target.listener)))
+	if err != nil {
+		t.Fatalf("could not pack address: %s", err)
+	}
+	token, _, err := auth.CreateJWTIdentity("host", "pool", true, true, dpub, time.Hour)
+	if err != nil {
+		t.Fatalf("could not create token: %s", err)
+	}
+
+	tryConnect := func(dial func() (net.Conn, error)) bool {
+		conn, err := dial()
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		if err := auth.AddSignedMuxHeader(conn, addr, token); err != nil {
+			t.Fatalf("could not write mux header: %s", err)
+		}
+		conn.Write([]byte("hello"))
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buffer := make([]byte, 16)
+		n, _ := conn.Read(buffer)
+		return string(buffer[:n]) == "hello"
+	}
+	dialWithoutCert := func() (net.Conn, error) {
+		return tls.Dial("tcp", muxAddr, &tls.Config{InsecureSkipVerify: true})
+	}
+	dialMux := func() (net.Conn, error) {
+		return DialMuxTLS("tcp", muxAddr)
+	}
+
+	// until the host is issued a certificate, it may call without one
+	if !tryConnect(dialWithoutCert) {
+		t.Errorf("expected a caller without a certificate to be proxied before it is issued one")
+	}
+
+	// the master records the certificate before issuing it
+	authorizer.issue("host")
+	if tryConnect(dialWithoutCert) {
+		t.Errorf("expected a caller without a certificate to be rejected after it is issued one")
+	}
+
+	tmpdir, err := ioutil.TempDir("", "serviced-mux-ca-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	cafile := filepath.Join(tmpdir, auth.MuxCAFileName)
+	if err := auth.CreateOrLoadMuxCA(cafile); err != nil {
+		t.Fatalf("could not create mux CA: %s", err)
+	}
+	csrPEM, keyPEM, err := auth.NewMuxCertificateRequest("host")
+	if err != nil {
+		t.Fatalf("could not create certificate request: %s", err)
+	}
+	certPEM, caPEM, err := auth.IssueMuxCertificate("host", "pool", csrPEM, time.Hour)
+	if err != nil {
+		t.Fatalf("could not issue certificate: %s", err)
+	}
+	if err := auth.LoadMuxCertificateFromPEM(certPEM, keyPEM, caPEM); err != nil {
+		t.Fatalf("could not load certificate: %s", err)
+	}
+	if !tryConnect(dialMux) {
+		t.Errorf("expected a caller with a certificate to be proxied")
+	}
+	if tryConnect(dialWithoutCert) {
+		t.Errorf("expected a caller without a certificate to be rejected")
+	}
+}
+
+func TestDialMuxTLS(t *testing.T) {
+	defer auth.ClearMuxCertificates()
+
+	listen := func(certPEM, keyPEM []byte) net.Listener {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatalf("could not load certificate: %s", err)
+		}
+		listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+		if err != nil {
+			t.Fatalf("could not listen: %s", err)
+		}
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					conn.(*tls.Conn).Handshake()
+					conn.Close()
+				}()
+			}
+		}()
+		return listener
+	}
+	dial := func(listener net.Listener) error {
+		conn, err := DialMuxTLS("tcp", listener.Addr().String())
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+
+	defaultMux := listen([]byte(InsecureCertPEM), []byte(InsecureKeyPEM))
+	defer defaultMux.Close()
+	otherPEM, otherKeyPEM, err := auth.GenerateMuxCA()
+	if err != nil {
+		t.Fatalf("could not create certificate: %s", err)
+	}
+	otherMux := listen(otherPEM, otherKeyPEM)
+	defer otherMux.Close()
+
+	// callers without a certificate do not verify the mux
+	if err := dial(otherMux); err != nil {
+		t.Errorf("expected to connect without a certificate: %s", err)
+	}
+
+	tmpdir, err := ioutil.TempDir("", "serviced-mux-ca-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	cafile := filepath.Join(tmpdir, auth.MuxCAFileName)
+	if err := auth.CreateOrLoadMuxCA(cafile); err != nil {
+		t.Fatalf("could not create mux CA: %s", err)
+	}
+	csrPEM, keyPEM, err := auth.NewMuxCertificateRequest("host")
+	if err != nil {
+		t.Fatalf("could not create certificate request: %s", err)
+	}
+	certPEM, caPEM, err := auth.IssueMuxCertificate("host", "pool", csrPEM, time.Hour)
+	if err != nil {
+		t.Fatalf("could not issue certificate: %s", err)
+	}
+	if err := auth.LoadMuxCertificateFromPEM(certPEM, keyPEM, caPEM); err != nil {
+		t.Fatalf("could not load certificate: %s", err)
+	}
+
+	// muxes that have not been issued a certificate present the default one
+	if err := dial(defaultMux); err != nil {
+		t.Errorf("expected to connect to a mux with the default certificate: %s", err)
+	}
+	if err := dial(otherMux); err != auth.ErrBadMuxCertificate {
+		t.Errorf("expected a mux with another certificate to be rejected, got %v", err)
+	}
+}
+
+func TestTCPMuxSessionToken(t *testing.T) {
+
+	pub, priv, _ := auth.GenerateRSAKeyPairPEM(nil)
+	auth.LoadMasterKeysFromPEM(pub, priv)
+
+	dpub, priv, _ := auth.GenerateRSAKeyPairPEM(nil)
+	auth.LoadDelegateKeysFromPEM(pub, priv)
+
+	defer func(interval time.Duration) { sessionTokenCheckInterval = interval }(sessionTokenCheckInterval)
+	sessionTokenCheckInterval = 50 * time.Millisecond
+
+	target := newEchoListener(t)
+	defer target.Close()
+
+	muxEndpoint, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("could not create tcpmux endpoint: %s", err)
+	}
+	mux, err := NewTCPMux(muxEndpoint, nil)
+	if err != nil {
+		t.Fatalf("did not expect failure creating TCPMux: %s", err)
+	}
+	defer mux.Close()
+
+	// tokens are good for the clock drift past their expiration, so this
+	// one expires 2 seconds from now
+	shortToken, _, err := auth.CreateJWTIdentity("host", "pool", true, true, dpub, 2*time.Second-auth.ClockDriftDelta)
+	if err != nil {
+		t.Fatalf("could not create token: %s", err)
+	}
+	longToken, _, err := auth.CreateJWTIdentity("host", "pool", true, true, dpub, time.Hour)
+	if err != nil {
+		t.Fatalf("could not create token: %s", err)
+	}
+	otherToken, _, err := auth.CreateJWTIdentity("otherhost", "pool", true, true, dpub, time.Hour)
+	if err != nil {
+		t.Fatalf("could not create token: %s", err)
+	}
+
+	openSession := func(token string) *Session {
+		conn := mux.testConnect(t)
+		if err := auth.AddSignedMuxSessionHeader(conn, token); err != nil {
+			t.Fatalf("could not write mux header: %s", err)
+		}
+		s := NewClientSession(conn, DefaultSessionConfig)
+		if _, err := s.Ping(5 * time.Second); err != nil {
+			t.Fatalf("could not start session: %s", err)
+		}
+		return s
+	}
+	reauthenticate := func(s *Session, token string) {
+		var buf bytes.Buffer
+		if err := auth.AddSignedMuxSessionHeader(&buf, token); err != nil {
+			t.Fatalf("could not sign header: %s", err)
+		}
+		if err := s.Reauthenticate(buf.Bytes()); err != nil {
+			t.Fatalf("could not reauthenticate session: %s", err)
+		}
+	}
+	waitClosed := func(s *Session) bool {
+		select {
+		case <-s.Closed():
+			return true
+		case <-time.After(10 * time.Second):
+			return false
+		}
+	}
+
+	// a token for another host closes the session
+	other := openSession(longToken)
+	defer other.Close()
+	reauthenticate(other, otherToken)
+	if !waitClosed(other) {
+		t.Errorf("expected a token for another host to close the session")
+	}
+
+	// a session that is reauthenticated outlives its first token
+	renewed := openSession(shortToken)
+	defer renewed.Close()
+	reauthenticate(renewed, longToken)
+
+	// a session that is not reauthenticated is closed when its token expires
+	expired := openSession(shortToken)
+	defer expired.Close()
+	if !waitClosed(expired) {
+		t.Fatalf("expected the session to be closed when its token expired")
+	}
+
+	addr, err := utils.PackTCPAddressString(fmt.Sprintf("127.0.0.1:%s", listenerToPort(target.listener)))
+	if err != nil {
+		t.Fatalf("could not pack address: %s", err)
+	}
+	stream, err := renewed.Open(addr)
+	if err != nil {
+		t.Fatalf("expected the reauthenticated session to stay open: %s", err)
+	}
+	defer stream.Close()
+	stream.Write([]byte("hello"))
+	stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buffer := make([]byte, 5)
+	if _, err := io.ReadFull(stream, buffer); err != nil || string(buffer) != "hello" {
+		t.Errorf("expected the stream to be proxied, got %q: %v", buffer, err)
+	}
+}
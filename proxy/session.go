@@ -0,0 +1,708 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rcrowley/go-metrics"
+)
+
+/*
+A session multiplexes many logical streams over a single mux connection
+between two hosts, so that connections to remote endpoints do not each need
+their own TCP connection and TLS handshake. Every frame on the session
+connection has the form:
+
+   -------------------------------------------------------------------------------------
+   | Version (1 byte) | Type (1 byte) | Stream ID (4 bytes) | Length (4 bytes) | Data  |
+   -------------------------------------------------------------------------------------
+
+The client opens a stream with an open frame whose data is the packed
+container address (and protocol flag) that would otherwise be sent in the mux
+header. Data frames are flow controlled per stream by window updates, close
+frames half-close a stream and ping frames keep the session alive.
+
+The session is authorized by the token in the mux header that started it.
+The client sends a token frame with a freshly signed mux header before that
+token expires; the server closes sessions whose token has expired.
+*/
+
+const (
+	sessionVersion byte = 0
+
+	frameOpen   byte = 1
+	frameData   byte = 2
+	frameWindow byte = 3
+	frameClose  byte = 4
+	frameReset  byte = 5
+	framePing   byte = 6
+	framePong   byte = 7
+	frameGoAway byte = 8
+	frameToken  byte = 9
+
+	frameHeaderSize = 10
+
+	// maxFrameSize is the largest data frame sent on a session
+	maxFrameSize = 32 * 1024
+
+	// streamWindowSize is the number of bytes that may be in flight on a
+	// stream before the receiver acknowledges them
+	streamWindowSize = 256 * 1024
+)
+
+var (
+	// ErrSessionClosed is returned when using a session that has shut down
+	ErrSessionClosed = errors.New("session closed")
+
+	// ErrStreamClosed is returned when using a stream that has been closed
+	ErrStreamClosed = errors.New("stream closed")
+
+	// ErrStreamReset is returned when the remote side aborts a stream
+	ErrStreamReset = errors.New("stream reset by peer")
+
+	// ErrSessionProtocol is returned when the remote side violates the
+	// session protocol
+	ErrSessionProtocol = errors.New("session protocol error")
+
+	// ErrPingTimeout is returned when the remote side does not answer a ping
+	ErrPingTimeout = errors.New("ping timeout")
+)
+
+// MuxMetrics keeps track of the sessions and streams on this host.
+var MuxMetrics = metrics.NewRegistry()
+
+// timeoutError is returned when a stream deadline passes.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// SessionConfig describes the keepalive behavior of a session.
+type SessionConfig struct {
+	KeepAliveInterval time.Duration // how often to ping the remote side, 0 to disable
+	KeepAliveTimeout  time.Duration // how long to wait for a ping response
+	AcceptBacklog     int           // the number of unaccepted streams to queue
+}
+
+// DefaultSessionConfig is the configuration used if none is specified.
+var DefaultSessionConfig = SessionConfig{
+	KeepAliveInterval: 30 * time.Second,
+	KeepAliveTimeout:  10 * time.Second,
+	AcceptBacklog:     256,
+}
+
+// Session multiplexes streams over a single connection.
+type Session struct {
+	conn   net.Conn
+	config SessionConfig
+	log    *logrus.Entry
+
+	wmu sync.Mutex // serializes frame writes
+
+	mu      sync.Mutex
+	streams map[uint32]*Stream
+	nextID  uint32
+	pings   map[uint32]chan struct{}
+	pingID  uint32
+	accept  chan *Stream
+	tokens  chan []byte
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewClientSession starts a session on a connection to a remote mux. Only
+// client sessions may open streams.
+func NewClientSession(conn net.Conn, config SessionConfig) *Session {
+	s := newSession(conn, config)
+	s.nextID = 1
+	go s.recvLoop()
+	go s.keepalive()
+	return s
+}
+
+// NewServerSession starts a session on a connection accepted by the mux.
+// Streams opened by the client are returned by Accept.
+func NewServerSession(conn net.Conn, config SessionConfig) *Session {
+	s := newSession(conn, config)
+	s.accept = make(chan *Stream, config.AcceptBacklog)
+	s.tokens = make(chan []byte, 1)
+	go s.recvLoop()
+	go s.keepalive()
+	return s
+}
+
+func newSession(conn net.Conn, config SessionConfig) *Session {
+	metrics.GetOrRegisterCounter("mux.sessions.total", MuxMetrics).Inc(1)
+	metrics.GetOrRegisterGauge("mux.sessions.active", MuxMetrics).Update(
+		atomic.AddInt64(&activeSessions, 1))
+	return &Session{
+		conn:    conn,
+		config:  config,
+		log:     log.WithField("remoteaddr", conn.RemoteAddr()),
+		streams: make(map[uint32]*Stream),
+		pings:   make(map[uint32]chan struct{}),
+		closed:  make(chan struct{}),
+	}
+}
+
+var activeSessions, activeStreams int64
+
+// Open starts a new stream on the session. The header describes the
+// destination of the stream to the remote mux.
+func (s *Session) Open(header []byte) (*Stream, error) {
+	s.mu.Lock()
+	if s.IsClosed() {
+		s.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	id := s.nextID
+	s.nextID += 2
+	st := newStream(s, id, header)
+	s.streams[id] = st
+	s.mu.Unlock()
+
+	if err := s.writeFrame(frameOpen, id, header); err != nil {
+		s.removeStream(id)
+		return nil, err
+	}
+	return st, nil
+}
+
+// Accept waits for the client to open a stream.
+func (s *Session) Accept() (*Stream, error) {
+	select {
+	case st := <-s.accept:
+		return st, nil
+	case <-s.closed:
+		return nil, ErrSessionClosed
+	}
+}
+
+// Reauthenticate sends a freshly signed mux header to the remote mux, so that
+// it keeps the session open past the expiration of the previous token.
+func (s *Session) Reauthenticate(header []byte) error {
+	return s.writeFrame(frameToken, 0, header)
+}
+
+// Tokens returns the mux headers sent by the client to reauthenticate the
+// session.  Only the latest unread header is kept.
+func (s *Session) Tokens() <-chan []byte {
+	return s.tokens
+}
+
+// Closed returns a channel that is closed when the session shuts down.
+func (s *Session) Closed() <-chan struct{} {
+	return s.closed
+}
+
+// Ping sends a ping to the remote side and returns the round trip time.
+func (s *Session) Ping(timeout time.Duration) (time.Duration, error) {
+	s.mu.Lock()
+	s.pingID++
+	id := s.pingID
+	ch := make(chan struct{})
+	s.pings[id] = ch
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.pings, id)
+		s.mu.Unlock()
+	}()
+
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, id)
+
+	start := time.Now()
+	if err := s.writeFrame(framePing, 0, payload); err != nil {
+		return 0, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-ch:
+		return time.Since(start), nil
+	case <-timer.C:
+		return 0, ErrPingTimeout
+	case <-s.closed:
+		return 0, ErrSessionClosed
+	}
+}
+
+// NumStreams returns the number of open streams on the session.
+func (s *Session) NumStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+// IsClosed returns true if the session has shut down.
+func (s *Session) IsClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close shuts down the session and all of its streams.
+func (s *Session) Close() error {
+	if !s.IsClosed() {
+		s.writeFrame(frameGoAway, 0, nil)
+	}
+	s.shutdown(nil)
+	return nil
+}
+
+// shutdown closes the connection and aborts all of the streams.
+func (s *Session) shutdown(err error) {
+	s.closeOnce.Do(func() {
+		if err != nil && err != io.EOF {
+			s.log.WithError(err).Debug("Closing mux session")
+		} else {
+			s.log.Debug("Closing mux session")
+		}
+		close(s.closed)
+		s.conn.Close()
+
+		s.mu.Lock()
+		streams := s.streams
+		s.streams = make(map[uint32]*Stream)
+		s.mu.Unlock()
+		for _, st := range streams {
+			st.abort(ErrSessionClosed)
+		}
+		metrics.GetOrRegisterGauge("mux.streams.active", MuxMetrics).Update(
+			atomic.AddInt64(&activeStreams, -int64(len(streams))))
+		metrics.GetOrRegisterGauge("mux.sessions.active", MuxMetrics).Update(
+			atomic.AddInt64(&activeSessions, -1))
+	})
+}
+
+// keepalive pings the remote side periodically and shuts down the session
+// if it stops responding.
+func (s *Session) keepalive() {
+	if s.config.KeepAliveInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.config.KeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			rtt, err := s.Ping(s.config.KeepAliveTimeout)
+			if err != nil {
+				s.log.WithError(err).Warn("Mux session keepalive failed")
+				s.shutdown(err)
+				return
+			}
+			metrics.GetOrRegisterGauge("mux.sessions.rtt", MuxMetrics).Update(int64(rtt / time.Microsecond))
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// writeFrame writes a single frame to the connection.
+func (s *Session) writeFrame(typ byte, id uint32, data []byte) error {
+	frame := make([]byte, frameHeaderSize+len(data))
+	frame[0] = sessionVersion
+	frame[1] = typ
+	binary.BigEndian.PutUint32(frame[2:6], id)
+	binary.BigEndian.PutUint32(frame[6:10], uint32(len(data)))
+	copy(frame[frameHeaderSize:], data)
+
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	if s.IsClosed() {
+		return ErrSessionClosed
+	}
+	if _, err := s.conn.Write(frame); err != nil {
+		go s.shutdown(err)
+		return err
+	}
+	return nil
+}
+
+// recvLoop reads frames off of the connection and dispatches them to the
+// streams.
+func (s *Session) recvLoop() {
+	hdr := make([]byte, frameHeaderSize)
+	for {
+		if _, err := io.ReadFull(s.conn, hdr); err != nil {
+			s.shutdown(err)
+			return
+		}
+		if hdr[0] != sessionVersion {
+			s.shutdown(ErrSessionProtocol)
+			return
+		}
+		typ := hdr[1]
+		id := binary.BigEndian.Uint32(hdr[2:6])
+		length := binary.BigEndian.Uint32(hdr[6:10])
+		if length > streamWindowSize {
+			s.shutdown(ErrSessionProtocol)
+			return
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(s.conn, data); err != nil {
+			s.shutdown(err)
+			return
+		}
+
+		switch typ {
+		case frameOpen:
+			if s.accept == nil {
+				s.shutdown(ErrSessionProtocol)
+				return
+			}
+			st := newStream(s, id, data)
+			s.mu.Lock()
+			s.streams[id] = st
+			s.mu.Unlock()
+			select {
+			case s.accept <- st:
+			default:
+				s.log.Warn("Mux session accept backlog is full; resetting stream")
+				s.removeStream(id)
+				go s.writeFrame(frameReset, id, nil)
+			}
+		case frameData:
+			if st := s.getStream(id); st != nil {
+				if !st.receive(data) {
+					s.removeStream(id)
+					st.abort(ErrSessionProtocol)
+					go s.writeFrame(frameReset, id, nil)
+				}
+			}
+		case frameWindow:
+			if st := s.getStream(id); st != nil && len(data) == 4 {
+				st.updateWindow(binary.BigEndian.Uint32(data))
+			}
+		case frameClose:
+			if st := s.getStream(id); st != nil {
+				st.remoteClose()
+			}
+		case frameReset:
+			if st := s.getStream(id); st != nil {
+				s.removeStream(id)
+				st.abort(ErrStreamReset)
+			}
+		case framePing:
+			go s.writeFrame(framePong, 0, data)
+		case framePong:
+			if len(data) == 4 {
+				s.mu.Lock()
+				ch, ok := s.pings[binary.BigEndian.Uint32(data)]
+				s.mu.Unlock()
+				if ok {
+					close(ch)
+				}
+			}
+		case frameGoAway:
+			s.shutdown(io.EOF)
+			return
+		case frameToken:
+			if s.tokens == nil {
+				s.shutdown(ErrSessionProtocol)
+				return
+			}
+			// replace any header that has not been read yet
+			select {
+			case <-s.tokens:
+			default:
+			}
+			s.tokens <- data
+		default:
+			s.shutdown(ErrSessionProtocol)
+			return
+		}
+	}
+}
+
+func (s *Session) getStream(id uint32) *Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams[id]
+}
+
+func (s *Session) removeStream(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.streams[id]; ok {
+		delete(s.streams, id)
+		metrics.GetOrRegisterGauge("mux.streams.active", MuxMetrics).Update(
+			atomic.AddInt64(&activeStreams, -1))
+	}
+}
+
+// Stream is a logical connection carried by a session. It implements
+// net.Conn.
+type Stream struct {
+	id      uint32
+	session *Session
+	header  []byte
+
+	mu            sync.Mutex
+	buf           bytes.Buffer
+	consumed      uint32 // bytes read since the last window update
+	sendWindow    uint32
+	localClosed   bool
+	remoteClosed  bool
+	err           error
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	recvNotify chan struct{}
+	sendNotify chan struct{}
+}
+
+func newStream(s *Session, id uint32, header []byte) *Stream {
+	metrics.GetOrRegisterCounter("mux.streams.total", MuxMetrics).Inc(1)
+	metrics.GetOrRegisterGauge("mux.streams.active", MuxMetrics).Update(
+		atomic.AddInt64(&activeStreams, 1))
+	return &Stream{
+		id:         id,
+		session:    s,
+		header:     header,
+		sendWindow: streamWindowSize,
+		recvNotify: make(chan struct{}, 1),
+		sendNotify: make(chan struct{}, 1),
+	}
+}
+
+// Header returns the header the stream was opened with.
+func (st *Stream) Header() []byte {
+	return st.header
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// deadlineTimer returns a channel that fires when the deadline passes.
+func deadlineTimer(deadline time.Time) (<-chan time.Time, func()) {
+	if deadline.IsZero() {
+		return nil, func() {}
+	}
+	timer := time.NewTimer(deadline.Sub(time.Now()))
+	return timer.C, func() { timer.Stop() }
+}
+
+// Read implements net.Conn
+func (st *Stream) Read(b []byte) (int, error) {
+	for {
+		st.mu.Lock()
+		if st.buf.Len() > 0 {
+			n, _ := st.buf.Read(b)
+			st.consumed += uint32(n)
+			var delta uint32
+			if st.consumed >= streamWindowSize/2 {
+				delta, st.consumed = st.consumed, 0
+			}
+			st.mu.Unlock()
+			if delta > 0 {
+				payload := make([]byte, 4)
+				binary.BigEndian.PutUint32(payload, delta)
+				st.session.writeFrame(frameWindow, st.id, payload)
+			}
+			return n, nil
+		}
+		if st.err != nil {
+			err := st.err
+			st.mu.Unlock()
+			return 0, err
+		}
+		if st.localClosed {
+			st.mu.Unlock()
+			return 0, ErrStreamClosed
+		}
+		if st.remoteClosed {
+			st.mu.Unlock()
+			return 0, io.EOF
+		}
+		timeout, stop := deadlineTimer(st.readDeadline)
+		st.mu.Unlock()
+
+		select {
+		case <-st.recvNotify:
+			stop()
+		case <-timeout:
+			return 0, timeoutError{}
+		}
+	}
+}
+
+// Write implements net.Conn
+func (st *Stream) Write(b []byte) (int, error) {
+	total := 0
+	for total < len(b) {
+		st.mu.Lock()
+		if st.err != nil {
+			err := st.err
+			st.mu.Unlock()
+			return total, err
+		}
+		if st.localClosed {
+			st.mu.Unlock()
+			return total, ErrStreamClosed
+		}
+		if st.sendWindow == 0 {
+			timeout, stop := deadlineTimer(st.writeDeadline)
+			st.mu.Unlock()
+			select {
+			case <-st.sendNotify:
+				stop()
+			case <-timeout:
+				return total, timeoutError{}
+			}
+			continue
+		}
+		n := len(b) - total
+		if n > maxFrameSize {
+			n = maxFrameSize
+		}
+		if uint32(n) > st.sendWindow {
+			n = int(st.sendWindow)
+		}
+		st.sendWindow -= uint32(n)
+		st.mu.Unlock()
+
+		if err := st.session.writeFrame(frameData, st.id, b[total:total+n]); err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// Close implements net.Conn; it tells the remote side that no more data
+// will be sent and stops reading from the stream.
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	if st.localClosed || st.err != nil {
+		st.mu.Unlock()
+		return nil
+	}
+	st.localClosed = true
+	remoteClosed := st.remoteClosed
+	st.buf.Reset()
+	st.mu.Unlock()
+
+	notify(st.recvNotify)
+	notify(st.sendNotify)
+	if remoteClosed {
+		st.session.removeStream(st.id)
+	}
+	return st.session.writeFrame(frameClose, st.id, nil)
+}
+
+// receive buffers incoming data; returns false if the remote side has
+// overrun the window.
+func (st *Stream) receive(data []byte) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.localClosed {
+		// nobody is reading anymore
+		return true
+	}
+	if uint32(st.buf.Len()+len(data))+st.consumed > streamWindowSize {
+		return false
+	}
+	st.buf.Write(data)
+	notify(st.recvNotify)
+	return true
+}
+
+func (st *Stream) updateWindow(delta uint32) {
+	st.mu.Lock()
+	st.sendWindow += delta
+	st.mu.Unlock()
+	notify(st.sendNotify)
+}
+
+func (st *Stream) remoteClose() {
+	st.mu.Lock()
+	st.remoteClosed = true
+	localClosed := st.localClosed
+	st.mu.Unlock()
+	notify(st.recvNotify)
+	if localClosed {
+		st.session.removeStream(st.id)
+	}
+}
+
+func (st *Stream) abort(err error) {
+	st.mu.Lock()
+	if st.err == nil {
+		st.err = err
+	}
+	st.mu.Unlock()
+	notify(st.recvNotify)
+	notify(st.sendNotify)
+}
+
+// LocalAddr implements net.Conn
+func (st *Stream) LocalAddr() net.Addr {
+	return st.session.conn.LocalAddr()
+}
+
+// RemoteAddr implements net.Conn
+func (st *Stream) RemoteAddr() net.Addr {
+	return st.session.conn.RemoteAddr()
+}
+
+// SetDeadline implements net.Conn
+func (st *Stream) SetDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline, st.writeDeadline = t, t
+	st.mu.Unlock()
+	notify(st.recvNotify)
+	notify(st.sendNotify)
+	return nil
+}
+
+// SetReadDeadline implements net.Conn
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline = t
+	st.mu.Unlock()
+	notify(st.recvNotify)
+	return nil
+}
+
+// SetWriteDeadline implements net.Conn
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.writeDeadline = t
+	st.mu.Unlock()
+	notify(st.sendNotify)
+	return nil
+}
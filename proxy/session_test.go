@@ -0,0 +1,253 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startEchoSession serves a session that echoes every stream back to the
+// client.
+func startEchoSession(t *testing.T, conn net.Conn) *Session {
+	server := NewServerSession(conn, DefaultSessionConfig)
+	go func() {
+		for {
+			stream, err := server.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(stream, stream)
+				stream.Close()
+			}()
+		}
+	}()
+	return server
+}
+
+func TestSessionStreams(t *testing.T) {
+	a, b := net.Pipe()
+	server := startEchoSession(t, b)
+	defer server.Close()
+	client := NewClientSession(a, DefaultSessionConfig)
+	defer client.Close()
+
+	if _, err := client.Ping(time.Second); err != nil {
+		t.Fatalf("ping failed: %s", err)
+	}
+
+	// send more than a window's worth of data on several streams at once
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		stream, err := client.Open([]byte("header"))
+		if err != nil {
+			t.Fatalf("could not open stream: %s", err)
+		}
+		wg.Add(1)
+		go func(stream *Stream) {
+			defer wg.Done()
+			go func() {
+				stream.Write(payload)
+			}()
+			received := make([]byte, len(payload))
+			stream.SetReadDeadline(time.Now().Add(10 * time.Second))
+			if _, err := io.ReadFull(stream, received); err != nil {
+				t.Errorf("could not read from stream: %s", err)
+				return
+			}
+			if !bytes.Equal(received, payload) {
+				t.Errorf("stream %d received the wrong data", stream.id)
+			}
+			stream.Close()
+		}(stream)
+	}
+	wg.Wait()
+}
+
+func TestSessionStreamHeaderAndClose(t *testing.T) {
+	a, b := net.Pipe()
+	server := NewServerSession(b, DefaultSessionConfig)
+	defer server.Close()
+	client := NewClientSession(a, DefaultSessionConfig)
+	defer client.Close()
+
+	stream, err := client.Open([]byte("address"))
+	if err != nil {
+		t.Fatalf("could not open stream: %s", err)
+	}
+	stream.Write([]byte("hello"))
+	stream.Close()
+
+	accepted, err := server.Accept()
+	if err != nil {
+		t.Fatalf("could not accept stream: %s", err)
+	}
+	if string(accepted.Header()) != "address" {
+		t.Fatalf("expected header %q, got %q", "address", accepted.Header())
+	}
+	data, err := ioutil.ReadAll(accepted)
+	if err != nil {
+		t.Fatalf("could not read stream: %s", err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("expected %q, got %q", "hello", data)
+	}
+
+	// closing the session aborts the streams
+	other, err := client.Open([]byte("address"))
+	if err != nil {
+		t.Fatalf("could not open stream: %s", err)
+	}
+	client.Close()
+	if _, err := other.Read(make([]byte, 1)); err != ErrSessionClosed {
+		t.Fatalf("expected %s, got %v", ErrSessionClosed, err)
+	}
+	if _, err := client.Open(nil); err != ErrSessionClosed {
+		t.Fatalf("expected %s, got %v", ErrSessionClosed, err)
+	}
+}
+
+func TestSessionPoolFallback(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %s", err)
+	}
+	defer listener.Close()
+
+	// an old mux hangs up on session requests
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	dials := 0
+	pool := NewSessionPool(func(address string) (net.Conn, error) {
+		dials++
+		return net.Dial("tcp", address)
+	}, DefaultSessionConfig)
+	defer pool.Close()
+
+	address := listener.Addr().String()
+	if _, err := pool.Open(address, nil); err != ErrMultiplexUnsupported {
+		t.Fatalf("expected %s, got %v", ErrMultiplexUnsupported, err)
+	}
+
+	// the host is not retried until the retry interval has passed
+	if _, err := pool.Open(address, nil); err != ErrMultiplexUnsupported {
+		t.Fatalf("expected %s, got %v", ErrMultiplexUnsupported, err)
+	}
+	if dials != 1 {
+		t.Fatalf("expected 1 dial, got %d", dials)
+	}
+}
+
+func TestSessionPoolReuse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %s", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			startEchoSession(t, conn)
+		}
+	}()
+
+	dials := 0
+	pool := NewSessionPool(func(address string) (net.Conn, error) {
+		dials++
+		return net.Dial("tcp", address)
+	}, DefaultSessionConfig)
+	defer pool.Close()
+
+	address := listener.Addr().String()
+	for i := 0; i < 3; i++ {
+		stream, err := pool.Open(address, nil)
+		if err != nil {
+			t.Fatalf("could not open stream: %s", err)
+		}
+		stream.Write([]byte("ping"))
+		buf := make([]byte, 4)
+		stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadFull(stream, buf); err != nil {
+			t.Fatalf("could not read from stream: %s", err)
+		}
+		stream.Close()
+	}
+	if dials != 1 {
+		t.Fatalf("expected 1 dial, got %d", dials)
+	}
+}
+
+func TestSessionPoolReauthenticate(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %s", err)
+	}
+	defer listener.Close()
+
+	servers := make(chan *Session, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		servers <- startEchoSession(t, conn)
+	}()
+
+	pool := NewSessionPool(func(address string) (net.Conn, error) {
+		return net.Dial("tcp", address)
+	}, DefaultSessionConfig)
+	pool.Authenticate = func() ([]byte, error) {
+		return []byte("token"), nil
+	}
+	pool.ReauthInterval = 10 * time.Millisecond
+	defer pool.Close()
+
+	stream, err := pool.Open(listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("could not open stream: %s", err)
+	}
+	defer stream.Close()
+
+	server := <-servers
+	defer server.Close()
+	select {
+	case header := <-server.Tokens():
+		if string(header) != "token" {
+			t.Fatalf("expected header %q, got %q", "token", header)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the session to be reauthenticated")
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rcrowley/go-metrics"
+)
+
+// ErrMultiplexUnsupported is returned when the remote mux does not accept
+// multiplexed sessions, so the caller should connect the old way.
+var ErrMultiplexUnsupported = errors.New("remote mux does not support multiplexed sessions")
+
+// SessionDialer opens a connection to the mux at the address and sends the
+// header requesting a multiplexed session.
+type SessionDialer func(address string) (net.Conn, error)
+
+// SessionAuthenticator returns a freshly signed mux header that keeps a
+// session authorized.
+type SessionAuthenticator func() ([]byte, error)
+
+// SessionPool keeps a persistent multiplexed session to each remote mux.
+type SessionPool struct {
+	dial   SessionDialer
+	config SessionConfig
+
+	// HandshakeTimeout is how long to wait for a new session to answer its
+	// first ping before falling back.
+	HandshakeTimeout time.Duration
+
+	// RetryInterval is how long to wait before trying to set up a session
+	// with a mux that did not support it.
+	RetryInterval time.Duration
+
+	// Authenticate, if set, signs the headers that are sent on each session
+	// every ReauthInterval, so that the remote mux does not close the
+	// session when the token it was opened with expires.
+	Authenticate   SessionAuthenticator
+	ReauthInterval time.Duration
+
+	mu          sync.Mutex
+	sessions    map[string]*Session
+	unsupported map[string]time.Time
+}
+
+// NewSessionPool creates a new pool of sessions that are set up with the
+// dialer.
+func NewSessionPool(dial SessionDialer, config SessionConfig) *SessionPool {
+	return &SessionPool{
+		dial:             dial,
+		config:           config,
+		HandshakeTimeout: 5 * time.Second,
+		RetryInterval:    5 * time.Minute,
+		ReauthInterval:   time.Minute,
+		sessions:         make(map[string]*Session),
+		unsupported:      make(map[string]time.Time),
+	}
+}
+
+// Open opens a stream to the mux at the address, setting up a session if
+// there isn't one already. Returns ErrMultiplexUnsupported if the remote
+// mux cannot multiplex connections.
+func (p *SessionPool) Open(address string, header []byte) (net.Conn, error) {
+	session, err := p.get(address)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := session.Open(header)
+	if err == ErrSessionClosed {
+		// the session went away; try again with a new one
+		if session, err = p.get(address); err != nil {
+			return nil, err
+		}
+		stream, err = session.Open(header)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// get returns an open session to the address.
+func (p *SessionPool) get(address string) (*Session, error) {
+	logger := log.WithField("muxaddress", address)
+
+	p.mu.Lock()
+	if s, ok := p.sessions[address]; ok && !s.IsClosed() {
+		p.mu.Unlock()
+		return s, nil
+	}
+	if retry, ok := p.unsupported[address]; ok {
+		if time.Now().Before(retry) {
+			p.mu.Unlock()
+			return nil, ErrMultiplexUnsupported
+		}
+		delete(p.unsupported, address)
+	}
+	p.mu.Unlock()
+
+	conn, err := p.dial(address)
+	if err != nil {
+		logger.WithError(err).Debug("Could not connect to mux")
+		return nil, err
+	}
+
+	// make sure the remote mux understands the session, otherwise it will
+	// just close the connection.
+	s := NewClientSession(conn, p.config)
+	if _, err := s.Ping(p.HandshakeTimeout); err != nil {
+		s.Close()
+		logger.WithError(err).WithField("retry", p.RetryInterval).Info("Remote mux does not support multiplexed sessions; falling back to a connection per stream")
+		metrics.GetOrRegisterCounter("mux.sessions.fallbacks", MuxMetrics).Inc(1)
+		p.mu.Lock()
+		p.unsupported[address] = time.Now().Add(p.RetryInterval)
+		p.mu.Unlock()
+		return nil, ErrMultiplexUnsupported
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if current, ok := p.sessions[address]; ok && !current.IsClosed() {
+		// someone else beat us to it
+		s.Close()
+		return current, nil
+	}
+	p.sessions[address] = s
+	if p.Authenticate != nil {
+		go p.reauthenticate(logger, s)
+	}
+	logger.WithFields(logrus.Fields{
+		"keepalive": p.config.KeepAliveInterval,
+	}).Debug("Started multiplexed mux session")
+	return s, nil
+}
+
+// reauthenticate sends a fresh token on the session every ReauthInterval
+// until the session is closed.
+func (p *SessionPool) reauthenticate(logger *logrus.Entry, s *Session) {
+	ticker := time.NewTicker(p.ReauthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			header, err := p.Authenticate()
+			if err != nil {
+				logger.WithError(err).Warn("Could not sign a token to reauthenticate the mux session")
+				continue
+			}
+			if err := s.Reauthenticate(header); err != nil {
+				logger.WithError(err).Debug("Could not reauthenticate the mux session")
+				return
+			}
+		case <-s.Closed():
+			return
+		}
+	}
+}
+
+// Close shuts down all of the sessions in the pool.
+func (p *SessionPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for address, s := range p.sessions {
+		s.Close()
+		delete(p.sessions, address)
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package master
+
+// ExportApp writes a tenant application to a gzipped archive on the master
+func (c *Client) ExportApp(tenantID, filename string, snapshotSpacePercent int) error {
+	req := ExportAppRequest{
+		TenantID:             tenantID,
+		Filename:             filename,
+		SnapshotSpacePercent: snapshotSpacePercent,
+	}
+	return c.call("ExportApp", req, new(int))
+}
+
+// ImportApp loads an application from a gzipped archive on the master into
+// a resource pool, and returns the tenant id of the imported application
+func (c *Client) ImportApp(filename, poolID string) (string, error) {
+	var tenantID string
+	err := c.call("ImportApp", ImportAppRequest{Filename: filename, PoolID: poolID}, &tenantID)
+	return tenantID, err
+}
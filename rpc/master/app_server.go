@@ -0,0 +1,76 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package master
+
+import (
+	"os"
+
+	gzip "github.com/klauspost/pgzip"
+)
+
+// ExportAppRequest is the request to export a tenant application to a file
+// on the master
+type ExportAppRequest struct {
+	TenantID             string
+	Filename             string
+	SnapshotSpacePercent int
+}
+
+// ImportAppRequest is the request to import an application from a file on
+// the master
+type ImportAppRequest struct {
+	Filename string
+	PoolID   string
+}
+
+// ExportApp writes a tenant application to a gzipped archive
+func (s *Server) ExportApp(req ExportAppRequest, reply *int) (err error) {
+	fh, err := os.Create(req.Filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		fh.Close()
+		if err != nil {
+			os.Remove(req.Filename)
+		}
+	}()
+	w := gzip.NewWriter(fh)
+	if err = s.f.ExportApp(s.context(), req.TenantID, w, req.SnapshotSpacePercent); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// ImportApp loads an application from a gzipped archive and returns the
+// tenant id of the imported application
+func (s *Server) ImportApp(req ImportAppRequest, tenantID *string) error {
+	fh, err := os.Open(req.Filename)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	gz, err := gzip.NewReader(fh)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	id, err := s.f.ImportApp(s.context(), gz, req.PoolID)
+	if err != nil {
+		return err
+	}
+	*tenantID = id
+	return nil
+}
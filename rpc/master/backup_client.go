@@ -0,0 +1,45 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package master
+
+import (
+	"github.com/control-center/serviced/dfs"
+)
+
+// VerifyBackup test-restores a backup file on the master and reports its
+// problems
+func (c *Client) VerifyBackup(filename string) (*dfs.BackupReport, error) {
+	report := &dfs.BackupReport{}
+	if err := c.call("VerifyBackup", filename, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// GetRestoreStatus returns the progress of the running or last restore, or
+// nil if there has been no restore
+func (c *Client) GetRestoreStatus() (*dfs.RestoreStatus, error) {
+	status := &dfs.RestoreStatus{}
+	if err := c.call("GetRestoreStatus", struct{}{}, status); err != nil {
+		return nil, err
+	} else if status.State == "" {
+		return nil, nil
+	}
+	return status, nil
+}
+
+// CancelRestore stops the running restore
+func (c *Client) CancelRestore() error {
+	return c.call("CancelRestore", struct{}{}, new(int))
+}
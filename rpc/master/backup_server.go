@@ -0,0 +1,58 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package master
+
+import (
+	"os"
+
+	"github.com/control-center/serviced/dfs"
+	gzip "github.com/klauspost/pgzip"
+)
+
+// VerifyBackup test-restores a backup file on the master and reports its
+// problems
+func (s *Server) VerifyBackup(filename string, reply *dfs.BackupReport) error {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	gz, err := gzip.NewReader(fh)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	report, err := s.f.VerifyBackup(s.context(), gz, filename)
+	if err != nil {
+		return err
+	}
+	*reply = *report
+	return nil
+}
+
+// GetRestoreStatus returns the progress of the running or last restore
+func (s *Server) GetRestoreStatus(unused struct{}, reply *dfs.RestoreStatus) error {
+	status, err := s.f.GetRestoreStatus(s.context())
+	if err != nil {
+		return err
+	} else if status != nil {
+		*reply = *status
+	}
+	return nil
+}
+
+// CancelRestore stops the running restore
+func (s *Server) CancelRestore(unused struct{}, reply *int) error {
+	return s.f.CancelRestore(s.context())
+}
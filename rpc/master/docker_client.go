@@ -13,6 +13,8 @@
 
 package master
 
+import "github.com/control-center/serviced/dfs"
+
 // ResetRegistry pulls latest from the running docker registry and updates the
 // index.
 func (c *Client) ResetRegistry() error {
@@ -40,3 +42,13 @@ func (c *Client) DockerOverride(newImage, oldImage string) error {
 	}
 	return c.call("DockerOverride", req, new(int))
 }
+
+// CollectRegistryGarbage removes the images that are not used by any service
+// or snapshot from the docker registry.
+func (c *Client) CollectRegistryGarbage(dryRun bool) (*dfs.RegistryGCReport, error) {
+	report := &dfs.RegistryGCReport{}
+	if err := c.call("CollectRegistryGarbage", dryRun, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -13,6 +13,8 @@
 
 package master
 
+import "github.com/control-center/serviced/dfs"
+
 // UpgradeDockerRequest are options for upgrading/migrating the docker registry.
 type UpgradeDockerRequest struct {
 	Endpoint string
@@ -47,3 +49,14 @@ func (s *Server) UpgradeRegistry(req UpgradeDockerRequest, reply *int) error {
 func (s *Server) DockerOverride(overrideReq DockerOverrideRequest, _ *int) error {
 	return s.f.DockerOverride(s.context(), overrideReq.NewImage, overrideReq.OldImage)
 }
+
+// CollectRegistryGarbage removes the images that are not used by any service
+// or snapshot from the docker registry.
+func (s *Server) CollectRegistryGarbage(dryRun bool, report *dfs.RegistryGCReport) error {
+	result, err := s.f.CollectRegistryGarbage(s.context(), dryRun)
+	if err != nil {
+		return err
+	}
+	*report = *result
+	return nil
+}
@@ -102,6 +102,34 @@ func (c *Client) AuthenticateHost(hostID string) (string, int64, error) {
 	return response.Token, response.Expires, nil
 }
 
+// IssueMuxCertificate asks the master to sign the host's certificate request
+// for its mux, and returns the certificate and the CA certificate.
+func (c *Client) IssueMuxCertificate(hostID string, csrPEM []byte) ([]byte, []byte, error) {
+	req := MuxCertificateRequest{
+		HostID:    hostID,
+		Timestamp: time.Now().UTC().Unix(),
+		CSR:       csrPEM,
+	}
+	sig, err := auth.SignAsDelegate(req.toMessage())
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Signature = sig
+	var response MuxCertificateResponse
+	if err := c.call("IssueMuxCertificate", req, &response); err != nil {
+		return nil, nil, err
+	}
+	return response.Certificate, response.CA, nil
+}
+
+// HostCanReachTenant returns true if the host may connect to the endpoints of
+// the tenant.
+func (c *Client) HostCanReachTenant(hostID, tenantID string) (bool, error) {
+	var response bool
+	err := c.call("HostCanReachTenant", HostTenantRequest{hostID, tenantID}, &response)
+	return response, err
+}
+
 func (c *Client) GetHostPublicKey(hostID string) ([]byte, error) {
 	response := []byte{}
 	err := c.call("GetHostPublicKey", hostID, &response)
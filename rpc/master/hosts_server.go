@@ -14,6 +14,7 @@
 package master
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"time"
 
@@ -119,15 +120,43 @@ func (req HostAuthenticationRequest) toMessage() []byte {
 }
 
 func (req HostAuthenticationRequest) valid(publicKeyPEM []byte) error {
+	return validHostRequest(req.HostID, req.Timestamp, req.toMessage(), req.Signature, publicKeyPEM)
+}
+
+// MuxCertificateRequest asks the master to sign a certificate for the mux on
+// the host. Like a HostAuthenticationRequest, it is signed with the host's
+// delegate key.
+type MuxCertificateRequest struct {
+	HostID    string
+	Timestamp int64
+	CSR       []byte
+	Signature []byte
+}
+
+type MuxCertificateResponse struct {
+	Certificate []byte
+	CA          []byte
+}
+
+func (req MuxCertificateRequest) toMessage() []byte {
+	return []byte(fmt.Sprintf("%s:%d:%x", req.HostID, req.Timestamp, sha256.Sum256(req.CSR)))
+}
+
+func (req MuxCertificateRequest) valid(publicKeyPEM []byte) error {
+	return validHostRequest(req.HostID, req.Timestamp, req.toMessage(), req.Signature, publicKeyPEM)
+}
+
+// validHostRequest checks that a request was signed by the host recently.
+func validHostRequest(hostID string, timestamp int64, message, signature, publicKeyPEM []byte) error {
 	verifier, err := auth.RSAVerifierFromPEM(publicKeyPEM)
 	if err != nil {
 		return err
 	}
-	if err := verifier.Verify(req.toMessage(), req.Signature); err != nil {
+	if err := verifier.Verify(message, signature); err != nil {
 		return err
 	}
-	logger := plog.WithField("hostid", req.HostID)
-	timeDiff := time.Now().UTC().Unix() - req.Timestamp
+	logger := plog.WithField("hostid", hostID)
+	timeDiff := time.Now().UTC().Unix() - timestamp
 	if timeDiff > int64(auth.ClockDriftDelta/time.Second) {
 		logger.WithField("clockdriftsec", timeDiff).Error("Delegate time behind master, re-sync clocks")
 		return ErrRequestExpired
@@ -176,6 +205,59 @@ func (s *Server) AuthenticateHost(req HostAuthenticationRequest, resp *HostAuthe
 	return nil
 }
 
+// IssueMuxCertificate signs a certificate for the mux on the host.
+func (s *Server) IssueMuxCertificate(req MuxCertificateRequest, resp *MuxCertificateResponse) error {
+	keypem, err := s.f.GetHostKey(s.context(), req.HostID)
+	if err != nil {
+		return err
+	}
+	if err := req.valid(keypem); err != nil {
+		return err
+	}
+
+	host, err := s.f.GetHost(s.context(), req.HostID)
+	if err != nil {
+		return err
+	}
+	if host == nil {
+		return facade.ErrHostDoesNotExist
+	}
+	// From now on, muxes require the host to present its certificate
+	if err := s.f.SetHostMuxCertificateIssued(s.context(), host.ID); err != nil {
+		plog.WithField("hostid", host.ID).WithError(err).Error("Unable to record the mux certificate of the host")
+		return err
+	}
+	cert, ca, err := auth.IssueMuxCertificate(host.ID, host.PoolID, req.CSR, auth.MuxCertificateExpiration)
+	if err != nil {
+		plog.WithField("hostid", host.ID).WithError(err).Error("Unable to issue mux certificate")
+		return err
+	}
+	*resp = MuxCertificateResponse{cert, ca}
+	return nil
+}
+
+// HostTenantRequest names a host and a tenant
+type HostTenantRequest struct {
+	HostID   string
+	TenantID string
+}
+
+// HostCanReachTenant returns true if the host may connect to the endpoints of
+// the tenant.  The master's host serves the public endpoints and virtual
+// hosts of every tenant; any other host must run an instance of the tenant.
+func (s *Server) HostCanReachTenant(req HostTenantRequest, reply *bool) error {
+	if req.HostID == s.hostID {
+		*reply = true
+		return nil
+	}
+	ok, err := s.f.HostRunsTenant(s.context(), req.HostID, req.TenantID)
+	if err != nil {
+		return err
+	}
+	*reply = ok
+	return nil
+}
+
 // Return host's public key
 func (s *Server) GetHostPublicKey(hostID string, key *[]byte) error {
 	publicKey, err := s.f.GetHostKey(s.context(), hostID)
@@ -16,6 +16,8 @@ package master
 import (
 	"time"
 
+	"github.com/control-center/serviced/dfs"
+	"github.com/control-center/serviced/doctor"
 	"github.com/control-center/serviced/domain/addressassignment"
 	"github.com/control-center/serviced/domain/applicationendpoint"
 	"github.com/control-center/serviced/domain/host"
@@ -66,6 +68,14 @@ type ClientInterface interface {
 	// Authenticate a host and receive an identity token and expiration
 	AuthenticateHost(hostID string) (string, int64, error)
 
+	// IssueMuxCertificate signs a certificate request for the host's mux and
+	// returns the certificate and the CA certificate
+	IssueMuxCertificate(hostID string, csrPEM []byte) ([]byte, []byte, error)
+
+	// HostCanReachTenant returns true if the host may connect to the
+	// endpoints of the tenant
+	HostCanReachTenant(hostID, tenantID string) (bool, error)
+
 	// Get hostID's public key
 	GetHostPublicKey(hostID string) ([]byte, error)
 
@@ -169,6 +179,46 @@ type ClientInterface interface {
 	// GetVolumeStatus gets status information for the given volume or nil
 	GetVolumeStatus() (*volume.Statuses, error)
 
+	//--------------------------------------------------------------------------
+	// Snapshot Management Functions
+
+	// ListSnapshotFiles lists the files at a path in a snapshot
+	ListSnapshotFiles(snapshotID, path string) ([]volume.SnapshotFile, error)
+
+	// DiffSnapshots returns the files that changed between two snapshots
+	DiffSnapshots(fromSnapshotID, toSnapshotID, path string) ([]volume.SnapshotChange, error)
+
+	// RestoreSnapshotPath restores a file or directory from a snapshot
+	RestoreSnapshotPath(snapshotID, path, dest string) (int, error)
+
+	// PromoteReplica brings up a standby master with the applications
+	// replicated from the primary master
+	PromoteReplica() error
+
+	//--------------------------------------------------------------------------
+	// Application Management Functions
+
+	// ExportApp writes a tenant application to a gzipped archive on the master
+	ExportApp(tenantID, filename string, snapshotSpacePercent int) error
+
+	// ImportApp loads an application from a gzipped archive on the master
+	// into a resource pool, and returns the tenant id of the application
+	ImportApp(filename, poolID string) (string, error)
+
+	//--------------------------------------------------------------------------
+	// Backup Management Functions
+
+	// VerifyBackup test-restores a backup file on the master and reports its
+	// problems
+	VerifyBackup(filename string) (*dfs.BackupReport, error)
+
+	// GetRestoreStatus returns the progress of the running or last restore,
+	// or nil if there has been no restore
+	GetRestoreStatus() (*dfs.RestoreStatus, error)
+
+	// CancelRestore stops the running restore
+	CancelRestore() error
+
 	//--------------------------------------------------------------------------
 	// Endpoint Management Functions
 
@@ -192,6 +242,10 @@ type ClientInterface interface {
 	// DockerOverride replaces an image in the docker registry with a new image
 	DockerOverride(newImage, oldImage string) error
 
+	// CollectRegistryGarbage removes the images that are not used by any
+	// service or snapshot from the docker registry.
+	CollectRegistryGarbage(dryRun bool) (*dfs.RegistryGCReport, error)
+
 	//--------------------------------------------------------------------------
 	// Public Endpoint Management Functions
 	AddPublicEndpointPort(serviceid, endpointName, portAddr string, usetls bool, protocol string, isEnabled bool, restart bool) (*servicedefinition.Port, error)
@@ -232,6 +286,13 @@ type ClientInterface interface {
 	// ReportInstanceDead removes stopped instances from the health check status cache.
 	ReportInstanceDead(serviceID string, instanceID int) error
 
+	//--------------------------------------------------------------------------
+	// Consistency Functions
+
+	// Doctor reports the inconsistencies between the datastore and the
+	// coordinator, repairing them if asked to
+	Doctor(repair bool) (*doctor.Report, error)
+
 	//--------------------------------------------------------------------------
 	// Debug Management Functions
 
@@ -1,6 +1,8 @@
 package mocks
 
 import applicationendpoint "github.com/control-center/serviced/domain/applicationendpoint"
+import dfs "github.com/control-center/serviced/dfs"
+import doctor "github.com/control-center/serviced/doctor"
 import health "github.com/control-center/serviced/health"
 import host "github.com/control-center/serviced/domain/host"
 import isvcs "github.com/control-center/serviced/isvcs"
@@ -189,6 +191,20 @@ func (_m *ClientInterface) AuthenticateHost(hostID string) (string, int64, error
 	return r0, r1, r2
 }
 
+// CancelRestore provides a mock function with given fields:
+func (_m *ClientInterface) CancelRestore() error {
+	ret := _m.Called()
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // ClearEmergency provides a mock function with given fields: serviceID
 func (_m *ClientInterface) ClearEmergency(serviceID string) (int, error) {
 	ret := _m.Called(serviceID)
@@ -210,6 +226,29 @@ func (_m *ClientInterface) ClearEmergency(serviceID string) (int, error) {
 	return r0, r1
 }
 
+// CollectRegistryGarbage provides a mock function with given fields: dryRun
+func (_m *ClientInterface) CollectRegistryGarbage(dryRun bool) (*dfs.RegistryGCReport, error) {
+	ret := _m.Called(dryRun)
+
+	var r0 *dfs.RegistryGCReport
+	if rf, ok := ret.Get(0).(func(bool) *dfs.RegistryGCReport); ok {
+		r0 = rf(dryRun)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*dfs.RegistryGCReport)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(bool) error); ok {
+		r1 = rf(dryRun)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Close provides a mock function with given fields:
 func (_m *ClientInterface) Close() error {
 	ret := _m.Called()
@@ -303,6 +342,29 @@ func (_m *ClientInterface) DockerOverride(newImage string, oldImage string) erro
 	return r0
 }
 
+// Doctor provides a mock function with given fields: repair
+func (_m *ClientInterface) Doctor(repair bool) (*doctor.Report, error) {
+	ret := _m.Called(repair)
+
+	var r0 *doctor.Report
+	if rf, ok := ret.Get(0).(func(bool) *doctor.Report); ok {
+		r0 = rf(repair)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*doctor.Report)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(bool) error); ok {
+		r1 = rf(repair)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // EnablePublicEndpointPort provides a mock function with given fields: serviceid, endpointName, portAddr, isEnabled
 func (_m *ClientInterface) EnablePublicEndpointPort(serviceid string, endpointName string, portAddr string, isEnabled bool) error {
 	ret := _m.Called(serviceid, endpointName, portAddr, isEnabled)
@@ -331,6 +393,20 @@ func (_m *ClientInterface) EnablePublicEndpointVHost(serviceid string, endpointN
 	return r0
 }
 
+// ExportApp provides a mock function with given fields: tenantID, filename, snapshotSpacePercent
+func (_m *ClientInterface) ExportApp(tenantID string, filename string, snapshotSpacePercent int) error {
+	ret := _m.Called(tenantID, filename, snapshotSpacePercent)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, int) error); ok {
+		r0 = rf(tenantID, filename, snapshotSpacePercent)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // FindHostsInPool provides a mock function with given fields: poolID
 func (_m *ClientInterface) FindHostsInPool(poolID string) ([]host.Host, error) {
 	ret := _m.Called(poolID)
@@ -621,6 +697,29 @@ func (_m *ClientInterface) GetResourcePools() ([]pool.ResourcePool, error) {
 	return r0, r1
 }
 
+// GetRestoreStatus provides a mock function with given fields:
+func (_m *ClientInterface) GetRestoreStatus() (*dfs.RestoreStatus, error) {
+	ret := _m.Called()
+
+	var r0 *dfs.RestoreStatus
+	if rf, ok := ret.Get(0).(func() *dfs.RestoreStatus); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*dfs.RestoreStatus)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetServiceDetails provides a mock function with given fields: serviceID
 func (_m *ClientInterface) GetServiceDetails(serviceID string) (*service.ServiceDetails, error) {
 	ret := _m.Called(serviceID)
@@ -824,6 +923,73 @@ func (_m *ClientInterface) GetVolumeStatus() (*volume.Statuses, error) {
 	return r0, r1
 }
 
+// ListSnapshotFiles provides a mock function with given fields: snapshotID, path
+func (_m *ClientInterface) ListSnapshotFiles(snapshotID string, path string) ([]volume.SnapshotFile, error) {
+	ret := _m.Called(snapshotID, path)
+
+	var r0 []volume.SnapshotFile
+	if rf, ok := ret.Get(0).(func(string, string) []volume.SnapshotFile); ok {
+		r0 = rf(snapshotID, path)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]volume.SnapshotFile)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(snapshotID, path)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DiffSnapshots provides a mock function with given fields: fromSnapshotID, toSnapshotID, path
+func (_m *ClientInterface) DiffSnapshots(fromSnapshotID string, toSnapshotID string, path string) ([]volume.SnapshotChange, error) {
+	ret := _m.Called(fromSnapshotID, toSnapshotID, path)
+
+	var r0 []volume.SnapshotChange
+	if rf, ok := ret.Get(0).(func(string, string, string) []volume.SnapshotChange); ok {
+		r0 = rf(fromSnapshotID, toSnapshotID, path)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]volume.SnapshotChange)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, string) error); ok {
+		r1 = rf(fromSnapshotID, toSnapshotID, path)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreSnapshotPath provides a mock function with given fields: snapshotID, path, dest
+func (_m *ClientInterface) RestoreSnapshotPath(snapshotID string, path string, dest string) (int, error) {
+	ret := _m.Called(snapshotID, path, dest)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(string, string, string) int); ok {
+		r0 = rf(snapshotID, path, dest)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, string) error); ok {
+		r1 = rf(snapshotID, path, dest)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // HostsAuthenticated provides a mock function with given fields: hostIDs
 func (_m *ClientInterface) HostsAuthenticated(hostIDs []string) (map[string]bool, error) {
 	ret := _m.Called(hostIDs)
@@ -847,6 +1013,80 @@ func (_m *ClientInterface) HostsAuthenticated(hostIDs []string) (map[string]bool
 	return r0, r1
 }
 
+// ImportApp provides a mock function with given fields: filename, poolID
+func (_m *ClientInterface) ImportApp(filename string, poolID string) (string, error) {
+	ret := _m.Called(filename, poolID)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string, string) string); ok {
+		r0 = rf(filename, poolID)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(filename, poolID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// HostCanReachTenant provides a mock function with given fields: hostID, tenantID
+func (_m *ClientInterface) HostCanReachTenant(hostID string, tenantID string) (bool, error) {
+	ret := _m.Called(hostID, tenantID)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string, string) bool); ok {
+		r0 = rf(hostID, tenantID)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(hostID, tenantID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IssueMuxCertificate provides a mock function with given fields: hostID, csrPEM
+func (_m *ClientInterface) IssueMuxCertificate(hostID string, csrPEM []byte) ([]byte, []byte, error) {
+	ret := _m.Called(hostID, csrPEM)
+
+	var r0 []byte
+	if rf, ok := ret.Get(0).(func(string, []byte) []byte); ok {
+		r0 = rf(hostID, csrPEM)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]byte)
+		}
+	}
+
+	var r1 []byte
+	if rf, ok := ret.Get(1).(func(string, []byte) []byte); ok {
+		r1 = rf(hostID, csrPEM)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).([]byte)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(string, []byte) error); ok {
+		r2 = rf(hostID, csrPEM)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
 // LocateServiceInstance provides a mock function with given fields: serviceID, instanceID
 func (_m *ClientInterface) LocateServiceInstance(serviceID string, instanceID int) (*service.LocationInstance, error) {
 	ret := _m.Called(serviceID, instanceID)
@@ -870,6 +1110,20 @@ func (_m *ClientInterface) LocateServiceInstance(serviceID string, instanceID in
 	return r0, r1
 }
 
+// PromoteReplica provides a mock function with given fields:
+func (_m *ClientInterface) PromoteReplica() error {
+	ret := _m.Called()
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // RemoveHost provides a mock function with given fields: hostID
 func (_m *ClientInterface) RemoveHost(hostID string) error {
 	ret := _m.Called(hostID)
@@ -1168,6 +1422,29 @@ func (_m *ClientInterface) ValidateCredentials(_a0 user.User) (bool, error) {
 	return r0, r1
 }
 
+// VerifyBackup provides a mock function with given fields: filename
+func (_m *ClientInterface) VerifyBackup(filename string) (*dfs.BackupReport, error) {
+	ret := _m.Called(filename)
+
+	var r0 *dfs.BackupReport
+	if rf, ok := ret.Get(0).(func(string) *dfs.BackupReport); ok {
+		r0 = rf(filename)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*dfs.BackupReport)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(filename)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // WaitService provides a mock function with given fields: serviceIDs, state, timeout, recursive
 func (_m *ClientInterface) WaitService(serviceIDs []string, state service.DesiredState, timeout time.Duration, recursive bool) error {
 	ret := _m.Called(serviceIDs, state, timeout, recursive)
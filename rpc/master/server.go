@@ -24,14 +24,16 @@ import (
 // instantiate the package logger
 var plog = logging.PackageLogger()
 
-// NewServer creates a new serviced master rpc server
-func NewServer(f *facade.Facade, tokenExpiration time.Duration) *Server {
-	return &Server{f, tokenExpiration}
+// NewServer creates a new serviced master rpc server.  hostID is the host the
+// master runs on.
+func NewServer(f *facade.Facade, hostID string, tokenExpiration time.Duration) *Server {
+	return &Server{f, hostID, tokenExpiration}
 }
 
 // Server is the RPC type for the master(s)
 type Server struct {
 	f          *facade.Facade
+	hostID     string
 	expiration time.Duration
 }
 
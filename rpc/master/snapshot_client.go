@@ -0,0 +1,67 @@
+// Copyright 2015 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package master
+
+import (
+	"github.com/control-center/serviced/volume"
+)
+
+// ListSnapshotFiles lists the files at a path in a snapshot
+func (c *Client) ListSnapshotFiles(snapshotID, path string) ([]volume.SnapshotFile, error) {
+	req := SnapshotFilesRequest{
+		SnapshotID: snapshotID,
+		Path:       path,
+	}
+	files := []volume.SnapshotFile{}
+	if err := c.call("ListSnapshotFiles", req, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// DiffSnapshots returns the files that changed between two snapshots
+func (c *Client) DiffSnapshots(fromSnapshotID, toSnapshotID, path string) ([]volume.SnapshotChange, error) {
+	req := SnapshotDiffRequest{
+		FromSnapshotID: fromSnapshotID,
+		ToSnapshotID:   toSnapshotID,
+		Path:           path,
+	}
+	changes := []volume.SnapshotChange{}
+	if err := c.call("DiffSnapshots", req, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// RestoreSnapshotPath restores a file or directory from a snapshot into a
+// directory on the master, or into the application's volume if dest is empty
+func (c *Client) RestoreSnapshotPath(snapshotID, path, dest string) (int, error) {
+	req := RestoreSnapshotPathRequest{
+		SnapshotID:  snapshotID,
+		Path:        path,
+		Destination: dest,
+	}
+	var count int
+	if err := c.call("RestoreSnapshotPath", req, &count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// PromoteReplica brings up a standby master with the applications replicated
+// from the primary master
+func (c *Client) PromoteReplica() error {
+	return c.call("PromoteReplica", struct{}{}, new(int))
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package master
+
+import (
+	"github.com/control-center/serviced/volume"
+)
+
+// SnapshotFilesRequest is the request to list files in a snapshot
+type SnapshotFilesRequest struct {
+	SnapshotID string
+	Path       string
+}
+
+// SnapshotDiffRequest is the request to compare two snapshots
+type SnapshotDiffRequest struct {
+	FromSnapshotID string
+	ToSnapshotID   string
+	Path           string
+}
+
+// RestoreSnapshotPathRequest is the request to restore a path from a snapshot
+type RestoreSnapshotPathRequest struct {
+	SnapshotID  string
+	Path        string
+	Destination string
+}
+
+// ListSnapshotFiles lists the files at a path in a snapshot
+func (s *Server) ListSnapshotFiles(req SnapshotFilesRequest, reply *[]volume.SnapshotFile) error {
+	files, err := s.f.ListSnapshotFiles(s.context(), req.SnapshotID, req.Path)
+	if err != nil {
+		return err
+	}
+	*reply = files
+	return nil
+}
+
+// DiffSnapshots returns the files that changed between two snapshots
+func (s *Server) DiffSnapshots(req SnapshotDiffRequest, reply *[]volume.SnapshotChange) error {
+	changes, err := s.f.DiffSnapshots(s.context(), req.FromSnapshotID, req.ToSnapshotID, req.Path)
+	if err != nil {
+		return err
+	}
+	*reply = changes
+	return nil
+}
+
+// RestoreSnapshotPath restores a file or directory from a snapshot
+func (s *Server) RestoreSnapshotPath(req RestoreSnapshotPathRequest, reply *int) error {
+	count, err := s.f.RestoreSnapshotPath(s.context(), req.SnapshotID, req.Path, req.Destination)
+	if err != nil {
+		return err
+	}
+	*reply = count
+	return nil
+}
+
+// PromoteReplica brings up a standby master with the applications replicated
+// from the primary master
+func (s *Server) PromoteReplica(unused struct{}, reply *int) error {
+	return s.f.PromoteReplica(s.context())
+}
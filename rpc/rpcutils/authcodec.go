@@ -30,6 +30,7 @@ var (
 	// RPC Calls that do not require authentication or who handle authentication separately:
 	NonAuthenticatingCalls = []string{
 		"Master.AuthenticateHost",
+		"Master.IssueMuxCertificate",
 		"Agent.BuildHost",
 		"ControlCenterAgent.Ping",
 		"Master.AddHostPrivate",
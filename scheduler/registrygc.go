@@ -0,0 +1,45 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/datastore"
+)
+
+// collectRegistryGarbage periodically removes the images that are not used by
+// any service or snapshot from the docker registry.
+func (s *scheduler) collectRegistryGarbage(shutdown <-chan interface{}, interval time.Duration) {
+	logger := plog.WithField("interval", interval)
+	for {
+		select {
+		case <-time.After(interval):
+		case <-shutdown:
+			return
+		}
+		ctx := datastore.Get()
+		report, err := s.facade.CollectRegistryGarbage(ctx, false)
+		if err != nil {
+			logger.WithError(err).Warn("Could not collect docker registry garbage, will retry later")
+			continue
+		}
+		logger.WithFields(logrus.Fields{
+			"images":    len(report.Removed),
+			"manifests": len(report.Manifests),
+			"blobs":     len(report.Blobs),
+		}).Info("Collected docker registry garbage")
+	}
+}
@@ -50,6 +50,7 @@ type scheduler struct {
 	started       bool             // is the loop running
 	zkleaderFunc  leaderFunc       // multiple implementations of leader function possible
 	snapshotTTL   int
+	registryGC    int
 	facade        *facade.Facade
 	stopped       chan interface{}
 	storageServer *storage.Server
@@ -59,7 +60,7 @@ type scheduler struct {
 }
 
 // NewScheduler creates a new scheduler master
-func NewScheduler(poolID string, instance_id string, storageServer *storage.Server, cpDao dao.ControlPlane, facade *facade.Facade, pushreg *imgreg.RegistryListener, snapshotTTL int) (*scheduler, error) {
+func NewScheduler(poolID string, instance_id string, storageServer *storage.Server, cpDao dao.ControlPlane, facade *facade.Facade, pushreg *imgreg.RegistryListener, snapshotTTL, registryGC int) (*scheduler, error) {
 	s := &scheduler{
 		cpDao:         cpDao,
 		poolID:        poolID,
@@ -69,6 +70,7 @@ func NewScheduler(poolID string, instance_id string, storageServer *storage.Serv
 		zkleaderFunc:  Lead, // random scheduler implementation
 		facade:        facade,
 		snapshotTTL:   snapshotTTL,
+		registryGC:    registryGC,
 		storageServer: storageServer,
 		pushreg:       pushreg,
 	}
@@ -201,6 +203,16 @@ func (s *scheduler) mainloop(conn coordclient.Connection) {
 		}()
 	}
 
+	// kicks off the docker registry garbage collection goroutine
+	if s.registryGC > 0 {
+		wg.Add(1)
+		go func() {
+			defer glog.Infof("Stopping registry garbage collection")
+			defer wg.Done()
+			s.collectRegistryGarbage(_shutdown, time.Duration(s.registryGC)*time.Hour)
+		}()
+	}
+
 	// wait for something to happen
 	for {
 		select {
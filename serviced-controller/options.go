@@ -27,6 +27,7 @@ type ControllerOptions struct {
 	MuxPort                 int      // the TCP port for the remote mux
 	Mux                     bool     // True if a remote mux is used
 	MUXDisableTLS           bool     // True if TLS should be disabled on the mux
+	MUXMultiplex            bool     // True if connections to remote muxes are multiplexed
 	KeyPEMFile              string   // path to the KeyPEMfile
 	CertPEMFile             string   // path to the CertPEMfile
 	ServicedEndpoint        string
@@ -42,6 +43,7 @@ type ControllerOptions struct {
 	VirtualAddressSubnet    string // The subnet of virtual addresses, 10.3
 	MetricForwardingEnabled bool   // Enable metric forwarding from the container
 	HostIPs			string // The ip addresses of the host
+	DrainTimeout            int    // Seconds to wait for exported connections to drain on stop
 }
 
 func (c ControllerOptions) toContainerControllerOptions() (options container.ControllerOptions, err error) {
@@ -54,6 +56,7 @@ func (c ControllerOptions) toContainerControllerOptions() (options container.Con
 	options.Mux.Port = c.MuxPort
 	options.Mux.Enabled = c.Mux
 	options.Mux.DisableTLS = c.MUXDisableTLS
+	options.Mux.Multiplex = c.MUXMultiplex
 	options.Mux.KeyPEMFile = c.KeyPEMFile
 	options.Mux.CertPEMFile = c.CertPEMFile
 	options.Logforwarder.Enabled = c.Logstash
@@ -64,6 +67,7 @@ func (c ControllerOptions) toContainerControllerOptions() (options container.Con
 	options.Metric.RemoteEndoint = "http://localhost:8444/api/metrics/store"
 	options.VirtualAddressSubnet = c.VirtualAddressSubnet
 	options.HostIPs = c.HostIPs
+	options.DrainTimeout = time.Duration(c.DrainTimeout) * time.Second
 	options.Logforwarder.SettleTime, err = time.ParseDuration(c.LogstashSettleTime)
 	if err != nil {
 		return options, err
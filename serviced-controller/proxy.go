@@ -62,12 +62,14 @@ func CmdServiceProxy(ctx *cli.Context) {
 
 	options.MuxPort = cfg.IntVal("MUX_PORT", options.MuxPort)
 	options.RPCPort = cfg.IntVal("RPC_PORT", options.RPCPort)
+	options.MUXMultiplex = cfg.BoolVal("MUX_MULTIPLEX", false)
 	options.KeyPEMFile = cfg.StringVal("KEY_FILE", options.KeyPEMFile)		// TODO: Is this set in container.go?
 	options.CertPEMFile = cfg.StringVal("CERT_FILE", options.CertPEMFile)		// TODO: Is this set in container.go?
 	options.LogstashURL = cfg.StringVal("LOG_ADDRESS", options.LogstashURL)
 	options.VirtualAddressSubnet = cfg.StringVal("VIRTUAL_ADDRESS_SUBNET", options.VirtualAddressSubnet)
 	options.ServicedEndpoint = utils.GetGateway(options.RPCPort)
 	options.HostIPs = os.Getenv("CONTROLPLANE_HOST_IPS")
+	options.DrainTimeout = cfg.IntVal("DRAIN_TIMEOUT", options.DrainTimeout)
 
 	if ctx.IsSet("logtostderr") {
 		glog.SetToStderr(ctx.GlobalBool("logtostderr"))
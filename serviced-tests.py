@@ -11,6 +11,11 @@ from contextlib import contextmanager
 
 import uuid
 
+try:
+    from urllib2 import urlopen
+except ImportError:
+    from urllib.request import urlopen
+
 log = logging.getLogger("serviced-tests")
 
 
@@ -50,6 +55,43 @@ def elastic_server(port):
         subprocess.call(["docker", "stop", container_name])
 
 
+@contextmanager
+def etcd_server(port):
+    try:
+        log.info("Starting etcd on port %d " % port)
+        container_name = str(uuid.uuid4())
+        cmd = ["docker", "run", "-d", "--name", container_name,
+               "-p", "%d:2379" % port, "quay.io/coreos/etcd:v3.4.14",
+               "/usr/local/bin/etcd",
+               "--listen-client-urls", "http://0.0.0.0:2379",
+               "--advertise-client-urls", "http://127.0.0.1:%d" % port]
+        try:
+            subprocess.check_call(cmd)
+        except subprocess.CalledProcessError:
+            fail("Could not start etcd; not running the suites against it")
+        endpoint = "127.0.0.1:%d" % port
+        wait_etcd(endpoint)
+        os.environ["SERVICED_TEST_COORDINATOR"] = "etcd"
+        os.environ["SERVICED_TEST_ETCD_ENDPOINT"] = endpoint
+        yield
+    finally:
+        log.info("Stopping etcd")
+        subprocess.call(["docker", "rm", "-f", container_name])
+
+
+def wait_etcd(endpoint, timeout=30):
+    url = "http://%s/health" % endpoint
+    deadline = time.time() + timeout
+    while time.time() < deadline:
+        try:
+            if urlopen(url, timeout=1).getcode() == 200:
+                return
+        except Exception:
+            pass
+        time.sleep(0.5)
+    fail("etcd did not answer at %s; not running the suites against it" % url)
+
+
 @contextmanager
 def dummy(*args, **kwargs):
     yield
@@ -112,6 +154,8 @@ def args():
     fixtures = parser.add_argument_group("Fixture Options")
     fixtures.add_argument("--elastic", action="store_true", help="start an elastic server before the test run")
     fixtures.add_argument("--elastic-port", type=int, help="elastic server port", default=9202)
+    fixtures.add_argument("--etcd", action="store_true", help="start an etcd server and run the zzk suites against it")
+    fixtures.add_argument("--etcd-port", type=int, help="etcd server port", default=2389)
 
     parser.add_argument("--packages", nargs="*", help="serviced packages to test, relative to the serviced root (defaults to ./...)")
     parser.add_argument("arguments", nargs=argparse.REMAINDER, help="optional arguments to be passed through to the test runner")
@@ -221,9 +265,10 @@ def main(options):
     log.debug("Running command: %s" % cmd)
     log.debug("Running in directory: %s" % SERVICED_ROOT)
 
-    fixture = elastic_server if options.elastic else dummy
+    elastic = elastic_server if options.elastic else dummy
+    etcd = etcd_server if options.etcd else dummy
 
-    with fixture(options.elastic_port):
+    with elastic(options.elastic_port), etcd(options.etcd_port):
         try:
                 subprocess.check_call(
                     cmd,
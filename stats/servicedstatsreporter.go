@@ -23,6 +23,7 @@ import (
 	"github.com/control-center/go-procfs/linux"
 	coordclient "github.com/control-center/serviced/coordinator/client"
 	"github.com/control-center/serviced/dfs/docker"
+	"github.com/control-center/serviced/proxy"
 	"github.com/control-center/serviced/utils"
 	zkservice "github.com/control-center/serviced/zzk/service"
 	"github.com/rcrowley/go-metrics"
@@ -147,6 +148,19 @@ func (sr *ServicedStatsReporter) gatherStats(t time.Time) []Sample {
 			stats = append(stats, Sample{name, strconv.FormatFloat(metric.Value(), 'f', -1, 32), t.Unix(), tagmap})
 		}
 	})
+	// Handle the mux session metrics.
+	muxReg, _ := proxy.MuxMetrics.(*metrics.StandardRegistry)
+	muxReg.Each(func(name string, i interface{}) {
+		tagmap := map[string]string{
+			"controlplane_host_id": sr.hostID,
+		}
+		switch metric := i.(type) {
+		case metrics.Gauge:
+			stats = append(stats, Sample{name, strconv.FormatInt(metric.Value(), 10), t.Unix(), tagmap})
+		case metrics.Counter:
+			stats = append(stats, Sample{name, strconv.FormatInt(metric.Count(), 10), t.Unix(), tagmap})
+		}
+	})
 	// Handle each container's metrics.
 	for key, registry := range sr.containerRegistries {
 		reg, _ := registry.(*metrics.StandardRegistry)
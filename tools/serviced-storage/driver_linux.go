@@ -20,6 +20,8 @@ import (
 	_ "github.com/control-center/serviced/volume/btrfs"
 	// Need to do rsync driver initializations
 	_ "github.com/control-center/serviced/volume/rsync"
+	// Need to do reflink driver initializations
+	_ "github.com/control-center/serviced/volume/reflink"
 
 	"errors"
 	log "github.com/Sirupsen/logrus"
@@ -24,6 +24,7 @@ Commands:
 	create   NAME [-d PATH]
 	mount    NAME [-d PATH]
 	remove   NAME [-d PATH]
+	migrate  --from PATH --to PATH [-t TYPE]
 	version
 */
 package main
@@ -75,6 +76,7 @@ func init() {
 	App.Parser.AddCommand("remove", "Remove an existing volume from a driver", "Remove an existing volume from a driver", &VolumeRemove{})
 	App.Parser.AddCommand("resize", "Resize an existing volume", "Resize an existing volume", &VolumeResize{})
 	App.Parser.AddCommand("sync", "Sync data from a volume to another volume", "Sync data from a volume to another volume", &DriverSync{})
+	App.Parser.AddCommand("migrate", "Migrate all volumes to another driver", "Copy all volumes, snapshots and snapshot metadata from one driver to another. serviced must be stopped.", &DriverMigrate{})
 	App.Parser.AddCommand("version", "Print the version and exit", "Print the version and exit", &ServicedStorageVersion{})
 	App.Parser.AddCommand("create-thin-pool", "Create thin pool", "Create a thin pool from a set of block devices", &ThinPoolCreate{})
 	App.Parser.AddCommand("check", "Check for orphaned devices", "Manage orphaned volumes", &CheckOrphans{})
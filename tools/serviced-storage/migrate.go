@@ -0,0 +1,507 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/control-center/serviced/volume"
+	"github.com/docker/go-units"
+	"github.com/jessevdk/go-flags"
+)
+
+var (
+	// ErrMigrateSameDriver is returned when the source and destination of a
+	// migration are the same driver.
+	ErrMigrateSameDriver = errors.New("source and destination are the same driver")
+	// ErrMigrateVerify is returned when the data on the destination does not
+	// match the source.
+	ErrMigrateVerify = errors.New("migrated data does not match the source")
+)
+
+// migrationStateFile is the file in the root of the destination driver that
+// tracks the snapshots that have been copied, so an interrupted migration can
+// be resumed.
+const migrationStateFile = ".migrate.json"
+
+// DriverMigrate is the subcommand for moving all volumes and snapshots from one
+// driver to another
+type DriverMigrate struct {
+	From     flags.Filename `description:"Path of the source driver" long:"from" required:"yes"`
+	To       flags.Filename `description:"Path of the destination driver" long:"to" required:"yes"`
+	Type     string         `description:"Type of the destination driver, if it needs to be created (btrfs|devicemapper|rsync|reflink)" long:"type" short:"t"`
+	NoVerify bool           `description:"Do not verify the data after it is copied" long:"no-verify"`
+}
+
+// Execute migrates every volume from one driver to another.  serviced must be
+// stopped while the volumes are being copied.
+func (c *DriverMigrate) Execute(args []string) error {
+	App.initializeLogging()
+	fromPath, toPath := string(c.From), string(c.To)
+	logger := log.WithFields(log.Fields{
+		"source":      fromPath,
+		"destination": toPath,
+	})
+	source, err := InitDriverIfExists(fromPath)
+	if err != nil {
+		logger.WithError(err).Fatal("Could not load the source driver")
+	}
+	if _, err := volume.DetectDriverType(toPath); err == volume.ErrDriverNotInit {
+		if c.Type == "" {
+			logger.Fatal("Destination driver is not initialized; specify its type with --type")
+		}
+		driverType, err := volume.StringToDriverType(c.Type)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid destination driver type")
+		}
+		if err := volume.InitDriver(driverType, toPath, App.Options.Options); err != nil {
+			logger.WithError(err).Fatal("Could not create the destination driver")
+		}
+	}
+	destination, err := InitDriverIfExists(toPath)
+	if err != nil {
+		logger.WithError(err).Fatal("Could not load the destination driver")
+	}
+	m := &Migration{Source: source, Destination: destination, Verify: !c.NoVerify, Out: os.Stdout}
+	if err := m.Run(); err != nil {
+		logger.WithError(err).Fatal("Migration failed; run the command again to resume")
+	}
+	fmt.Println("Migration complete. Set the new driver as the default and restart serviced to apply tenant quotas.")
+	return nil
+}
+
+// Migration copies the tenant volumes of one driver, with their snapshots and
+// snapshot metadata, to another driver.  Snapshots are moved with the
+// drivers' Export and Import, which is the same format used by backups, so
+// any two drivers can be used.
+type Migration struct {
+	Source      volume.Driver
+	Destination volume.Driver
+	Verify      bool
+	Out         io.Writer
+
+	state *migrationState
+}
+
+// migrationState is the progress of a migration.
+type migrationState struct {
+	Source    string
+	Snapshots map[string][]string // snapshots that have been copied, by tenant
+}
+
+func (s *migrationState) done(tenant, label string) bool {
+	for _, l := range s.Snapshots[tenant] {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// Run migrates all of the volumes.
+func (m *Migration) Run() error {
+	if filepath.Clean(m.Source.Root()) == filepath.Clean(m.Destination.Root()) {
+		return ErrMigrateSameDriver
+	}
+	if err := m.loadState(); err != nil {
+		return err
+	}
+	tenants := migrationTenants(m.Source)
+	for i, tenant := range tenants {
+		m.printf("Migrating volume %s (%d of %d)\n", tenant, i+1, len(tenants))
+		if err := m.migrateVolume(tenant); err != nil {
+			return err
+		}
+	}
+	return os.Remove(m.statePath())
+}
+
+func (m *Migration) printf(format string, args ...interface{}) {
+	if m.Out != nil {
+		fmt.Fprintf(m.Out, format, args...)
+	}
+}
+
+func (m *Migration) statePath() string {
+	return filepath.Join(m.Destination.Root(), migrationStateFile)
+}
+
+// loadState reads the progress of a previous migration from the same source.
+func (m *Migration) loadState() error {
+	m.state = &migrationState{Source: m.Source.Root(), Snapshots: make(map[string][]string)}
+	data, err := ioutil.ReadFile(m.statePath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	state := &migrationState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		log.WithError(err).Warn("Ignoring unreadable migration state")
+		return nil
+	}
+	if state.Source != m.Source.Root() {
+		log.WithField("previoussource", state.Source).Warn("Ignoring migration state from a different source")
+		return nil
+	}
+	if state.Snapshots != nil {
+		m.state.Snapshots = state.Snapshots
+	}
+	m.printf("Resuming migration from %s\n", state.Source)
+	return nil
+}
+
+func (m *Migration) saveState() error {
+	data, err := json.Marshal(m.state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(m.statePath(), data, 0600)
+}
+
+// migrationTenants returns the tenant volumes of a driver, which also lists
+// snapshots as volumes.
+func migrationTenants(driver volume.Driver) []string {
+	seen := make(map[string]struct{})
+	var tenants []string
+	for _, name := range driver.List() {
+		tenant := strings.Split(name, "_")[0]
+		if _, ok := seen[tenant]; !ok {
+			seen[tenant] = struct{}{}
+			tenants = append(tenants, tenant)
+		}
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// migrateVolume copies the snapshots and the current data of a volume.
+func (m *Migration) migrateVolume(tenant string) error {
+	logger := log.WithField("tenant", tenant)
+	srcVol, err := m.Source.Get(tenant)
+	if err != nil {
+		logger.WithError(err).Error("Could not get source volume")
+		return err
+	}
+	var dstVol volume.Volume
+	if m.Destination.Exists(tenant) {
+		dstVol, err = m.Destination.Get(tenant)
+	} else {
+		dstVol, err = m.Destination.Create(tenant)
+	}
+	if err != nil {
+		logger.WithError(err).Error("Could not get destination volume")
+		return err
+	}
+
+	infos, err := snapshotsByCreation(srcVol)
+	if err != nil {
+		logger.WithError(err).Error("Could not list snapshots")
+		return err
+	}
+	for i, info := range infos {
+		m.printf("  Snapshot %s (%d of %d)", info.Label, i+1, len(infos))
+		if m.state.done(tenant, info.Name) {
+			m.printf(": already copied\n")
+			continue
+		}
+		if err := m.migrateSnapshot(srcVol, dstVol, info); err != nil {
+			m.printf(": failed\n")
+			logger.WithField("snapshot", info.Name).WithError(err).Error("Could not copy snapshot")
+			return err
+		}
+		m.state.Snapshots[tenant] = append(m.state.Snapshots[tenant], info.Name)
+		if err := m.saveState(); err != nil {
+			return err
+		}
+	}
+
+	m.printf("  Copying current data\n")
+	if err := syncDirectory(srcVol.Path(), dstVol.Path()); err != nil {
+		logger.WithError(err).Error("Could not copy volume data")
+		return err
+	}
+
+	if m.Verify {
+		m.printf("  Verifying")
+		if err := verifyVolume(srcVol, dstVol, infos); err != nil {
+			m.printf(": failed\n")
+			logger.WithError(err).Error("Migrated volume does not match the source")
+			return err
+		}
+		m.printf(": ok\n")
+	}
+	return nil
+}
+
+// snapshotsByCreation returns the info of the valid snapshots of a volume,
+// oldest first, so that the destination keeps the same order.
+func snapshotsByCreation(vol volume.Volume) ([]volume.SnapshotInfo, error) {
+	labels, err := vol.Snapshots()
+	if err != nil {
+		return nil, err
+	}
+	var infos []volume.SnapshotInfo
+	for _, label := range labels {
+		info, err := vol.SnapshotInfo(label)
+		if err == volume.ErrInvalidSnapshot {
+			log.WithField("snapshot", label).Warn("Skipping invalid snapshot")
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		infos = append(infos, *info)
+	}
+	sort.Sort(snapshotInfoByCreated(infos))
+	return infos, nil
+}
+
+type snapshotInfoByCreated []volume.SnapshotInfo
+
+func (s snapshotInfoByCreated) Len() int           { return len(s) }
+func (s snapshotInfoByCreated) Less(i, j int) bool { return s[i].Created.Before(s[j].Created) }
+func (s snapshotInfoByCreated) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+	return n, err
+}
+
+// migrateSnapshot streams the export of a snapshot into an import on the
+// destination volume.
+func (m *Migration) migrateSnapshot(srcVol, dstVol volume.Volume, info volume.SnapshotInfo) error {
+	// clean up a snapshot that was partially copied by an earlier run
+	if _, err := dstVol.SnapshotInfo(info.Name); err != volume.ErrSnapshotDoesNotExist {
+		if err := dstVol.RemoveSnapshot(info.Name); err != nil && err != volume.ErrSnapshotDoesNotExist {
+			return err
+		}
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(srcVol.Export(info.Name, "", w, []string{}))
+	}()
+	counter := &countingReader{Reader: r}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Second):
+				m.printf(".. %s", units.HumanSize(float64(atomic.LoadInt64(&counter.n))))
+			}
+		}
+	}()
+
+	if err := dstVol.Import(info.Name, counter); err != nil {
+		r.CloseWithError(err)
+		return err
+	}
+	// drain anything the import did not read, so the export can finish
+	io.Copy(ioutil.Discard, r)
+	m.printf(": %s copied\n", units.HumanSize(float64(atomic.LoadInt64(&counter.n))))
+	return nil
+}
+
+// syncDirectory makes the destination directory a copy of the source.
+func syncDirectory(src, dst string) error {
+	rsync := exec.Command("rsync", "-a", "--delete", "--stats", "--human-readable", src+"/", dst+"/")
+	output, err := rsync.CombinedOutput()
+	if err != nil {
+		log.WithField("output", string(output)).WithError(err).Error("Could not rsync volume")
+	}
+	return err
+}
+
+// verifyVolume checks that the snapshots and data on the destination match
+// the source.
+func verifyVolume(srcVol, dstVol volume.Volume, infos []volume.SnapshotInfo) error {
+	for _, info := range infos {
+		dstInfo, err := dstVol.SnapshotInfo(info.Name)
+		if err != nil {
+			return err
+		}
+		if dstInfo.Label != info.Label || dstInfo.Message != info.Message || !reflect.DeepEqual(dstInfo.Tags, info.Tags) {
+			log.WithField("snapshot", info.Name).Error("Snapshot metadata does not match")
+			return ErrMigrateVerify
+		}
+		srcDigest, err := exportDigest(srcVol, info.Name)
+		if err != nil {
+			return err
+		}
+		dstDigest, err := exportDigest(dstVol, info.Name)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(srcDigest, dstDigest) {
+			log.WithField("snapshot", info.Name).Error("Snapshot data does not match")
+			return ErrMigrateVerify
+		}
+	}
+	srcDigest, err := directoryDigest(srcVol.Path())
+	if err != nil {
+		return err
+	}
+	dstDigest, err := directoryDigest(dstVol.Path())
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(srcDigest, dstDigest) {
+		log.WithField("volume", srcVol.Name()).Error("Volume data does not match")
+		return ErrMigrateVerify
+	}
+	return nil
+}
+
+// entryDigests collects a digest of each file in a tree, keyed by its path
+// relative to the root of the tree.
+type entryDigests map[string][]byte
+
+// add records a file, unless it is one that drivers create on their own.
+func (d entryDigests) add(name string, mode int64, uid, gid int, link string, content io.Reader) error {
+	name = strings.Trim(filepath.Clean("/"+name), "/")
+	switch name {
+	case "", "lost+found", ".SNAPSHOTINFO":
+		return nil
+	}
+	if strings.HasPrefix(name, "lost+found/") {
+		return nil
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%o\x00%d\x00%d\x00%s\x00", name, mode, uid, gid, link)
+	if content != nil {
+		if _, err := io.Copy(h, content); err != nil {
+			return err
+		}
+	}
+	d[name] = h.Sum(nil)
+	return nil
+}
+
+// sum combines the digests of all the files in order of their path.
+func (d entryDigests) sum() []byte {
+	names := make([]string, 0, len(d))
+	for name := range d {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		h.Write(d[name])
+	}
+	return h.Sum(nil)
+}
+
+// exportDigest computes a digest of the data of a snapshot from its export,
+// which has the same layout for every driver.
+func exportDigest(vol volume.Volume, label string) ([]byte, error) {
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(vol.Export(label, "", w, []string{}))
+	}()
+	defer r.Close()
+	prefix := label + "-volume"
+	digests := make(entryDigests)
+	tarfile := tar.NewReader(r)
+	for {
+		header, err := tarfile.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(header.Name, prefix) {
+			continue
+		}
+		name := strings.TrimPrefix(header.Name, prefix)
+		mode := int64(header.FileInfo().Mode())
+		var content io.Reader
+		if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA {
+			content = tarfile
+		}
+		if err := digests.add(name, mode, header.Uid, header.Gid, header.Linkname, content); err != nil {
+			return nil, err
+		}
+	}
+	return digests.sum(), nil
+}
+
+// directoryDigest computes a digest of the files in a directory.
+func directoryDigest(root string) ([]byte, error) {
+	digests := make(entryDigests)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		uid, gid := fileOwner(info)
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		if info.Mode().IsRegular() {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return digests.add(name, int64(info.Mode()), uid, gid, link, f)
+		}
+		return digests.add(name, int64(info.Mode()), uid, gid, link, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return digests.sum(), nil
+}
+
+// fileOwner returns the uid and gid of a file.
+func fileOwner(info os.FileInfo) (int, int) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(stat.Uid), int(stat.Gid)
+	}
+	return 0, 0
+}
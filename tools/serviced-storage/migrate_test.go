@@ -0,0 +1,120 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build integration,root
+
+package main_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/control-center/serviced/tools/serviced-storage"
+	"github.com/control-center/serviced/volume"
+	"github.com/control-center/serviced/volume/reflink"
+	. "gopkg.in/check.v1"
+)
+
+type MigrateSuite struct {
+	root string
+}
+
+var _ = Suite(&MigrateSuite{})
+
+func (s *MigrateSuite) SetUpTest(c *C) {
+	var err error
+	s.root, err = ioutil.TempDir("", "serviced-storage-migrate-")
+	c.Assert(err, IsNil)
+}
+
+func (s *MigrateSuite) TearDownTest(c *C) {
+	os.RemoveAll(s.root)
+}
+
+func (s *MigrateSuite) driver(c *C, name string) volume.Driver {
+	driver, err := reflink.Init(filepath.Join(s.root, name), nil)
+	c.Assert(err, IsNil)
+	return driver
+}
+
+func (s *MigrateSuite) TestMigrate(c *C) {
+	source := s.driver(c, "source")
+	vol, err := source.Create("tenant")
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(vol.Path(), "a"), []byte("first"), 0644), IsNil)
+	c.Assert(vol.Snapshot("one", "first snapshot", []string{"v1"}), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(vol.Path(), "a"), []byte("second"), 0644), IsNil)
+	c.Assert(vol.Snapshot("two", "second snapshot", []string{"v2", "latest"}), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(vol.Path(), "b"), []byte("current"), 0600), IsNil)
+
+	destination := s.driver(c, "destination")
+	m := &Migration{Source: source, Destination: destination, Verify: true}
+	c.Assert(m.Run(), IsNil)
+
+	c.Assert(destination.Exists("tenant"), Equals, true)
+	dstVol, err := destination.Get("tenant")
+	c.Assert(err, IsNil)
+	snapshots, err := dstVol.Snapshots()
+	c.Assert(err, IsNil)
+	c.Assert(snapshots, HasLen, 2)
+	info, err := dstVol.SnapshotInfo("tenant_two")
+	c.Assert(err, IsNil)
+	c.Assert(info.Message, Equals, "second snapshot")
+	c.Assert(info.Tags, DeepEquals, []string{"v2", "latest"})
+	data, err := ioutil.ReadFile(filepath.Join(dstVol.Path(), "b"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "current")
+
+	// the state file is removed when the migration finishes
+	_, err = os.Stat(filepath.Join(destination.Root(), ".migrate.json"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	// rolling back on the destination restores the snapshot data
+	c.Assert(dstVol.Rollback("tenant_one"), IsNil)
+	data, err = ioutil.ReadFile(filepath.Join(dstVol.Path(), "a"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "first")
+}
+
+func (s *MigrateSuite) TestMigrateResume(c *C) {
+	source := s.driver(c, "source")
+	vol, err := source.Create("tenant")
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(vol.Path(), "a"), []byte("first"), 0644), IsNil)
+	c.Assert(vol.Snapshot("one", "", []string{}), IsNil)
+	c.Assert(vol.Snapshot("two", "", []string{}), IsNil)
+
+	// simulate an interrupted migration that copied the first snapshot and
+	// left a partial copy of the second
+	destination := s.driver(c, "destination")
+	dstVol, err := destination.Create("tenant")
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dstVol.Path(), "a"), []byte("first"), 0644), IsNil)
+	c.Assert(dstVol.Snapshot("one", "", []string{}), IsNil)
+	c.Assert(dstVol.Snapshot("two", "partial", []string{}), IsNil)
+	state := `{"Source":"` + source.Root() + `","Snapshots":{"tenant":["tenant_one"]}}`
+	c.Assert(ioutil.WriteFile(filepath.Join(destination.Root(), ".migrate.json"), []byte(state), 0600), IsNil)
+
+	m := &Migration{Source: source, Destination: destination, Verify: true}
+	c.Assert(m.Run(), IsNil)
+	info, err := dstVol.SnapshotInfo("tenant_two")
+	c.Assert(err, IsNil)
+	c.Assert(info.Message, Equals, "")
+}
+
+func (s *MigrateSuite) TestMigrateSameDriver(c *C) {
+	source := s.driver(c, "source")
+	m := &Migration{Source: source, Destination: source}
+	c.Assert(m.Run(), Equals, ErrMigrateSameDriver)
+}
@@ -216,6 +216,7 @@ func (d *BtrfsDriver) Status() (volume.Status, error) {
 		Driver:     volume.DriverTypeBtrFS,
 		UsageData:  usage,
 		DriverData: map[string]string{"DataFile": rootDir},
+		Tenants:    d.tenantStats(),
 	}
 	return response, nil
 }
@@ -233,9 +234,76 @@ func (d *BtrfsDriver) GetTenant(volumeName string) (volume.Volume, error) {
 	return d.Get(getTenant(volumeName))
 }
 
-// Resize implements volume.Driver.Resize. For btrfs it's a noop.
+// Resize implements volume.Driver.Resize.  Btrfs subvolumes share the space of
+// the filesystem, so the size is set as a qgroup limit on the subvolume.
 func (d *BtrfsDriver) Resize(volumeName string, size uint64) error {
-	return nil
+	if !d.Exists(volumeName) {
+		return volume.ErrVolumeNotExists
+	}
+	vdir := filepath.Join(d.root, volumeName)
+	limit := "none"
+	if size > 0 {
+		if output, err := volume.RunBtrFSCmd(d.sudoer, "quota", "enable", d.root); err != nil {
+			glog.Errorf("Could not enable quotas on %s: %s (%s)", d.root, output, err)
+			return err
+		}
+		limit = strconv.FormatUint(size, 10)
+	}
+	if output, err := volume.RunBtrFSCmd(d.sudoer, "qgroup", "limit", limit, vdir); err != nil {
+		glog.Errorf("Could not set qgroup limit on %s: %s (%s)", vdir, output, err)
+		return err
+	}
+	mdir := filepath.Join(d.MetadataDir(), volumeName)
+	if err := os.MkdirAll(mdir, 0755); err != nil {
+		return err
+	}
+	return volume.WriteQuota(mdir, size)
+}
+
+// tenantStats returns the storage stats of each tenant volume.  Usage comes
+// from the qgroup of the subvolume, so it is only reported for volumes that
+// have a quota.
+func (d *BtrfsDriver) tenantStats() []volume.TenantStorageStats {
+	var result []volume.TenantStorageStats
+	for _, volumeName := range d.List() {
+		if getTenant(volumeName) != volumeName {
+			// this is a snapshot
+			continue
+		}
+		vdir := filepath.Join(d.root, volumeName)
+		tss := volume.TenantStorageStats{TenantID: volumeName, VolumePath: vdir}
+		quota, err := volume.ReadQuota(filepath.Join(d.MetadataDir(), volumeName))
+		if err != nil {
+			tss.Errors = append(tss.Errors, fmt.Sprintf("Could not read quota: %s", err))
+		} else if quota > 0 {
+			tss.Quota = quota
+			output, err := volume.RunBtrFSCmd(d.sudoer, "qgroup", "show", "-f", "--raw", vdir)
+			if err == nil {
+				tss.FilesystemUsed, err = parseQgroupShow(string(output))
+			}
+			if err != nil {
+				tss.Errors = append(tss.Errors, fmt.Sprintf("Could not get usage: %s", err))
+			}
+		}
+		result = append(result, tss)
+	}
+	return result
+}
+
+// parseQgroupShow returns the referenced bytes from the output of
+// "btrfs qgroup show -f --raw", which is a header followed by a row with the
+// qgroup id, referenced and exclusive bytes.
+func parseQgroupShow(output string) (uint64, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 3 {
+		return 0, volume.ErrBadQuotaOutput
+	}
+	rfer, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, volume.ErrBadQuotaOutput
+	}
+	return rfer, nil
 }
 
 // Get implements volume.Driver.Get
@@ -615,6 +683,17 @@ func (v *BtrfsVolume) Export(label, parent string, writer io.Writer, excludes []
 	return nil
 }
 
+// SnapshotDir implements volume.SnapshotDirVolume with the read-only
+// subvolume of the snapshot
+func (v *BtrfsVolume) SnapshotDir(label string) (string, error) {
+	if exists, err := v.snapshotExists(label); err != nil {
+		return "", err
+	} else if !exists {
+		return "", volume.ErrSnapshotDoesNotExist
+	}
+	return v.snapshotPath(label), nil
+}
+
 // Import implements volume.Volume.Import
 func (v *BtrfsVolume) Import(label string, reader io.Reader) error {
 	if exists, err := v.snapshotExists(label); err != nil {
@@ -639,6 +718,45 @@ func (v *BtrfsVolume) Import(label string, reader io.Reader) error {
 	return nil
 }
 
+// ExportDelta implements volume.DeltaVolume by sending the snapshot relative
+// to its parent
+func (v *BtrfsVolume) ExportDelta(label, parent string, writer io.Writer) error {
+	if exists, err := v.snapshotExists(label); err != nil {
+		return err
+	} else if !exists {
+		return volume.ErrSnapshotDoesNotExist
+	}
+	var parentPath string
+	if parent != "" {
+		if exists, err := v.snapshotExists(parent); err != nil {
+			return err
+		} else if !exists {
+			return volume.ErrSnapshotDoesNotExist
+		}
+		parentPath = v.snapshotPath(parent)
+	}
+	if err := runBtrfsSend(writer, v.sudoer, parentPath, v.snapshotPath(label)); err != nil {
+		glog.Errorf("Could not send snapshot %s from %s: %s", label, parent, err)
+		return err
+	}
+	return nil
+}
+
+// ImportDelta implements volume.DeltaVolume.  The stream is received in place,
+// so that it can be the parent of the next one.
+func (v *BtrfsVolume) ImportDelta(label string, reader io.Reader) error {
+	if exists, err := v.snapshotExists(label); err != nil {
+		return err
+	} else if exists {
+		return volume.ErrSnapshotExists
+	}
+	if err := runBtrfsRecv(reader, v.sudoer, v.Driver().Root()); err != nil {
+		glog.Errorf("Could not receive snapshot %s: %s", label, err)
+		return err
+	}
+	return nil
+}
+
 // snapshotExists queries the snapshot existence for the given label
 func (v *BtrfsVolume) snapshotExists(label string) (exists bool, err error) {
 	rlabel := v.rawSnapshotLabel(label)
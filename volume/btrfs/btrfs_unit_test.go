@@ -236,3 +236,16 @@ func TestParseDF(t *testing.T) {
 		assert.Equal(t, result, tc.out, fmt.Sprintf("%s: %s", tc.label, tc.outmsg))
 	}
 }
+
+func TestParseQgroupShow(t *testing.T) {
+	output := `qgroupid         rfer         excl 
+--------         ----         ---- 
+0/258           16384        16384 
+`
+	rfer, err := parseQgroupShow(output)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(16384), rfer)
+
+	_, err = parseQgroupShow("")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,186 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package volume
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/zenoss/glog"
+)
+
+// DeltaMetadataFile is the first entry of a snapshot delta
+const DeltaMetadataFile = ".DELTA"
+
+var ErrInvalidDelta = errors.New("stream is not a snapshot delta")
+
+// DeltaVolume is implemented by volumes that can write the changes between two
+// snapshots in a format native to the driver, such as a btrfs send stream or
+// the thin_delta blocks of a devicemapper snapshot.
+type DeltaVolume interface {
+	// ExportDelta writes the changes from snapshot <parent> to snapshot
+	// <label>, or all of <label> if parent is empty.
+	ExportDelta(label, parent string, writer io.Writer) error
+	// ImportDelta loads a stream written by ExportDelta as snapshot <label>.
+	// The parent of the stream must have been imported the same way.
+	ImportDelta(label string, reader io.Reader) error
+}
+
+// deltaInfo describes the files of a snapshot that are not in the delta
+type deltaInfo struct {
+	Parent  string
+	Removed []string // files in the parent that are not in the snapshot
+	Changed []string // files in the delta that replace those of the parent
+}
+
+// A snapshot delta has the same layout as an export, but only has the
+// directories of the volume and the files that were added or changed since the
+// parent snapshot.  It works for any driver, at the cost of reading both
+// snapshots to find the changes.
+
+// ExportSnapshotDelta writes the changes to a volume from snapshot <parent> to
+// snapshot <label>.
+func ExportSnapshotDelta(vol Volume, label, parent string, writer io.Writer) error {
+	from, err := snapshotFiles(vol, parent, "")
+	if err != nil {
+		return err
+	}
+	to, err := snapshotFiles(vol, label, "")
+	if err != nil {
+		return err
+	}
+	info := deltaInfo{Parent: parent}
+	changed := make(map[string]struct{})
+	for name, file := range to {
+		if old, ok := from[name]; !ok || fileChanged(old, file) {
+			changed[name] = struct{}{}
+			info.Changed = append(info.Changed, name)
+		}
+	}
+	for name := range from {
+		if _, ok := to[name]; !ok {
+			info.Removed = append(info.Removed, name)
+		}
+	}
+	sort.Strings(info.Changed)
+	sort.Strings(info.Removed)
+	glog.Infof("Exporting delta of snapshot %s from %s: %d changed, %d removed", label, parent, len(info.Changed), len(info.Removed))
+
+	tarOut := tar.NewWriter(writer)
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err := tarOut.WriteHeader(&tar.Header{Name: DeltaMetadataFile, Mode: 0644, Size: int64(len(data))}); err != nil {
+		return err
+	}
+	if _, err := tarOut.Write(data); err != nil {
+		return err
+	}
+	err = walkExport(vol, label, func(header *tar.Header, r io.Reader) error {
+		// directories are always sent, so the delta has the whole tree
+		if name, ok := snapshotVolumePath(header.Name); ok && header.Typeflag != tar.TypeDir {
+			if _, ok := changed[name]; !ok {
+				return nil
+			}
+		}
+		return copyTarEntry(tarOut, header, r)
+	})
+	if err != nil {
+		glog.Errorf("Could not export delta of snapshot %s: %s", label, err)
+		return err
+	}
+	return tarOut.Close()
+}
+
+// ImportSnapshotDelta loads a delta written by ExportSnapshotDelta as snapshot
+// <label>.  The parent of the delta must exist on the volume.
+func ImportSnapshotDelta(vol Volume, label string, reader io.Reader) error {
+	delta := tar.NewReader(reader)
+	header, err := delta.Next()
+	if err != nil || header.Name != DeltaMetadataFile {
+		return ErrInvalidDelta
+	}
+	var info deltaInfo
+	if err := json.NewDecoder(delta).Decode(&info); err != nil {
+		glog.Errorf("Could not decode delta for snapshot %s: %s", label, err)
+		return ErrInvalidDelta
+	}
+	skip := make(map[string]struct{})
+	for _, name := range info.Removed {
+		skip[name] = struct{}{}
+	}
+	for _, name := range info.Changed {
+		skip[name] = struct{}{}
+	}
+
+	// The snapshot is imported from the delta, followed by the unchanged
+	// files of the parent.
+	r, w := io.Pipe()
+	imported := make(chan error, 1)
+	go func() {
+		err := vol.Import(label, r)
+		r.CloseWithError(err)
+		imported <- err
+	}()
+	err = func() error {
+		tarOut := tar.NewWriter(w)
+		var prefix string
+		if err := readExport(delta, func(header *tar.Header, r io.Reader) error {
+			if entry := path.Clean(header.Name); prefix == "" && strings.HasSuffix(entry, "-driver") {
+				prefix = strings.TrimSuffix(entry, "-driver") + "-volume"
+			}
+			return copyTarEntry(tarOut, header, r)
+		}); err != nil {
+			return err
+		} else if prefix == "" {
+			return ErrInvalidDelta
+		}
+		if err := walkSnapshot(vol, info.Parent, "", func(name string, header *tar.Header, r io.Reader) error {
+			if _, ok := skip[name]; ok || header.Typeflag == tar.TypeDir {
+				return nil
+			}
+			hdr := *header
+			hdr.Name = path.Join(prefix, name)
+			if hdr.Typeflag == tar.TypeLink {
+				link, _ := snapshotVolumePath(hdr.Linkname)
+				hdr.Linkname = path.Join(prefix, link)
+			}
+			return copyTarEntry(tarOut, &hdr, r)
+		}); err != nil {
+			return err
+		}
+		return tarOut.Close()
+	}()
+	w.CloseWithError(err)
+	importErr := <-imported
+	if err != nil {
+		glog.Errorf("Could not import delta of snapshot %s from %s: %s", label, info.Parent, err)
+		return err
+	}
+	return importErr
+}
+
+func copyTarEntry(tarOut *tar.Writer, header *tar.Header, r io.Reader) error {
+	if err := tarOut.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.Copy(tarOut, r)
+	return err
+}
@@ -0,0 +1,103 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package volume_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path"
+
+	. "github.com/control-center/serviced/volume"
+	"github.com/stretchr/testify/mock"
+	. "gopkg.in/check.v1"
+)
+
+type DeltaSuite struct {
+	SnapshotFilesSuite
+}
+
+var _ = Suite(&DeltaSuite{})
+
+// readVolumeFiles returns the contents of the volume files in an export
+func readVolumeFiles(r io.Reader) (map[string]string, error) {
+	files := make(map[string]string)
+	tarfile := tar.NewReader(r)
+	for {
+		header, err := tarfile.Next()
+		if err == io.EOF {
+			return files, nil
+		} else if err != nil {
+			return nil, err
+		}
+		dir, name := path.Split(path.Clean(header.Name))
+		if dir == "" {
+			continue
+		}
+		data, err := ioutil.ReadAll(tarfile)
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeDir {
+			files[path.Join(dir, name)+"/"] = ""
+		} else {
+			files[path.Join(dir, name)] = string(data)
+		}
+	}
+}
+
+func (s *DeltaSuite) TestSnapshotDelta(c *C) {
+	buf := &bytes.Buffer{}
+	err := ExportSnapshotDelta(s.volume(), "snapB", "snapA", buf)
+	c.Assert(err, IsNil)
+
+	// only the changed files are in the delta
+	delta, err := readVolumeFiles(bytes.NewReader(buf.Bytes()))
+	c.Assert(err, IsNil)
+	c.Check(delta, DeepEquals, map[string]string{
+		"tenant_snapB-volume/etc/":       "",
+		"tenant_snapB-volume/etc/b.conf": "bigger",
+		"tenant_snapB-volume/data/":      "",
+		"tenant_snapB-volume/data/d":     "d",
+	})
+
+	// the import has the unchanged files of the parent
+	var imported map[string]string
+	vol := s.volume()
+	vol.On("Import", "snapB", mock.Anything).Return(func(_ string, r io.Reader) error {
+		var err error
+		imported, err = readVolumeFiles(r)
+		return err
+	})
+	err = ImportSnapshotDelta(vol, "snapB", buf)
+	c.Assert(err, IsNil)
+	c.Check(imported, DeepEquals, map[string]string{
+		"tenant_snapB-volume/etc/":       "",
+		"tenant_snapB-volume/etc/a.conf": "a",
+		"tenant_snapB-volume/etc/b.conf": "bigger",
+		"tenant_snapB-volume/data/":      "",
+		"tenant_snapB-volume/data/d":     "d",
+	})
+}
+
+func (s *DeltaSuite) TestImportSnapshotDeltaInvalid(c *C) {
+	buf := &bytes.Buffer{}
+	err := s.volume().Export("snapA", "", buf, nil)
+	c.Assert(err, IsNil)
+	err = ImportSnapshotDelta(s.volume(), "snapA", buf)
+	c.Check(err, Equals, ErrInvalidDelta)
+}
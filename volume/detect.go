@@ -31,7 +31,7 @@ func DetectDriverType(root string) (DriverType, error) {
 		}
 		return "", err
 	}
-	for _, drivertype := range []DriverType{DriverTypeBtrFS, DriverTypeRsync, DriverTypeDeviceMapper} {
+	for _, drivertype := range []DriverType{DriverTypeBtrFS, DriverTypeRsync, DriverTypeDeviceMapper, DriverTypeReflink} {
 		dirname := filepath.Join(root, fmt.Sprintf(".%s", drivertype))
 		flagfile := FlagFilePath(dirname)
 		if fi, err := os.Stat(flagfile); !os.IsNotExist(err) && fi != nil {
@@ -0,0 +1,516 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// +build linux,!darwin
+
+package devicemapper
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/control-center/serviced/volume"
+	"github.com/docker/docker/pkg/devicemapper"
+	"github.com/zenoss/glog"
+)
+
+// A thin delta is a tar stream of the blocks of a snapshot device that differ
+// from those of its parent, as reported by thin_delta, or of all of the
+// blocks that the device maps if there is no parent.  Its first entry is the
+// thinDeltaInfo, followed by the snapshot metadata under metadata/ and the
+// data of each changed range under blocks/<byte offset>.  It is loaded as a
+// thin snapshot of the parent, so the parent on the receiving end must not
+// have been written to since it was received.
+
+const (
+	thinDeltaFile   = ".THINDELTA"
+	thinMetadataDir = "metadata"
+	thinBlocksDir   = "blocks"
+)
+
+// blkDiscard is the BLKDISCARD ioctl, which unmaps a range of a thin device
+const blkDiscard = 0x1277
+
+// blockRange is a range of blocks of a thin device
+type blockRange struct {
+	Begin  uint64
+	Length uint64
+}
+
+// thinDeltaInfo describes a thin delta
+type thinDeltaInfo struct {
+	Parent    string       // raw label of the parent snapshot, if any
+	Size      uint64       // size of the device in bytes
+	BlockSize uint64       // size of a block in bytes
+	Discarded []blockRange // blocks that the parent maps but the device does not
+}
+
+// thinDiff is the set of blocks of a device that a thin delta sends or
+// discards
+type thinDiff struct {
+	blockSize uint64
+	changed   []blockRange
+	discarded []blockRange
+}
+
+// ExportDelta implements volume.DeltaVolume
+func (v *DeviceMapperVolume) ExportDelta(label, parent string, writer io.Writer) error {
+	glog.V(2).Infof("ExportDelta() (%s) START", v.name)
+	defer glog.V(2).Infof("ExportDelta() (%s) END", v.name)
+	if !v.snapshotExists(label) {
+		return volume.ErrSnapshotDoesNotExist
+	}
+	label = v.rawSnapshotLabel(label)
+	deviceHash, err := v.Metadata.LookupSnapshotDevice(label)
+	if err != nil {
+		return err
+	}
+	info := thinDeltaInfo{}
+	parentID := -1
+	if parent != "" {
+		if !v.snapshotExists(parent) {
+			return volume.ErrSnapshotDoesNotExist
+		}
+		info.Parent = v.rawSnapshotLabel(parent)
+		parentHash, err := v.Metadata.LookupSnapshotDevice(info.Parent)
+		if err != nil {
+			return err
+		}
+		var parentInfo devInfo
+		if err := v.driver.readDeviceInfo(parentHash, &parentInfo); err != nil {
+			return err
+		}
+		parentID = parentInfo.DeviceID
+	}
+
+	// Activate the snapshot device to read its blocks
+	status, err := v.driver.DeviceSet.GetDeviceStatus(deviceHash)
+	if err != nil {
+		glog.Errorf("Could not activate device %s for snapshot %s: %s", deviceHash, label, err)
+		return err
+	}
+	defer v.driver.deactivate(deviceHash)
+	info.Size = status.SizeInSectors * 512
+
+	diff, err := v.driver.thinDiff(parentID, status.DeviceID)
+	if err != nil {
+		glog.Errorf("Could not get the changed blocks of snapshot %s from %s: %s", label, info.Parent, err)
+		return err
+	}
+	info.BlockSize, info.Discarded = diff.blockSize, diff.discarded
+	glog.Infof("Exporting thin delta of snapshot %s from %s: %d changed ranges, %d discarded", label, info.Parent, len(diff.changed), len(diff.discarded))
+
+	dev, err := os.Open(v.driver.devicePath(deviceHash))
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+
+	tarOut := tar.NewWriter(writer)
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err := tarOut.WriteHeader(&tar.Header{Name: thinDeltaFile, Mode: 0644, Size: int64(len(data))}); err != nil {
+		return err
+	}
+	if _, err := tarOut.Write(data); err != nil {
+		return err
+	}
+	mdpath := filepath.Join(v.driver.MetadataDir(), label)
+	if err := exportDirectoryAsTar(mdpath, thinMetadataDir, tarOut, []string{}); err != nil {
+		glog.Errorf("Could not export metadata of snapshot %s: %s", label, err)
+		return err
+	}
+	if err := writeThinBlocks(tarOut, dev, info.Size, diff); err != nil {
+		glog.Errorf("Could not export blocks of snapshot %s: %s", label, err)
+		return err
+	}
+	return tarOut.Close()
+}
+
+// ImportDelta implements volume.DeltaVolume.  The snapshot is created as a
+// thin snapshot of its parent with the blocks of the delta written over it.
+func (v *DeviceMapperVolume) ImportDelta(label string, reader io.Reader) (err error) {
+	glog.V(2).Infof("ImportDelta() (%s) START", v.name)
+	defer glog.V(2).Infof("ImportDelta() (%s) END", v.name)
+	if v.snapshotExists(label) {
+		return volume.ErrSnapshotExists
+	}
+	label = v.rawSnapshotLabel(label)
+
+	tarIn := tar.NewReader(reader)
+	header, err := tarIn.Next()
+	if err != nil || header.Name != thinDeltaFile {
+		return volume.ErrInvalidDelta
+	}
+	var info thinDeltaInfo
+	if err := json.NewDecoder(tarIn).Decode(&info); err != nil {
+		glog.Errorf("Could not decode thin delta for snapshot %s: %s", label, err)
+		return volume.ErrInvalidDelta
+	}
+	var parentHash string
+	if info.Parent != "" {
+		if parentHash, err = v.Metadata.LookupSnapshotDevice(v.rawSnapshotLabel(info.Parent)); err != nil {
+			glog.Errorf("Could not find parent %s of snapshot %s: %s", info.Parent, label, err)
+			return err
+		}
+	}
+
+	// Set up the device of the snapshot
+	deviceHash, err := v.driver.addDevice(parentHash)
+	if err != nil {
+		glog.Errorf("Unable to create device for snapshot %s: %s", label, err)
+		return err
+	}
+	glog.V(2).Infof("Created device %s from %q for snapshot %s", deviceHash, parentHash, label)
+	defer func() {
+		if err != nil {
+			v.driver.deleteDevice(deviceHash, false)
+		}
+	}()
+
+	// Set up the metadata directory
+	metaPath, err := ioutil.TempDir(v.driver.MetadataDir(), label+"_import-")
+	if err != nil {
+		glog.Errorf("Could not create metadata path for snapshot %s: %s", label, err)
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(metaPath)
+		}
+	}()
+
+	if err = v.loadThinDelta(tarIn, &info, deviceHash, metaPath); err != nil {
+		glog.Errorf("Could not load thin delta of snapshot %s: %s", label, err)
+		return err
+	}
+
+	// Add device as a snapshot of this volume.
+	if err = v.Metadata.AddSnapshot(label, deviceHash); err != nil {
+		glog.Errorf("Could not save device %s as snapshot %s: %s", deviceHash, label, err)
+		return err
+	}
+	if err = os.Rename(metaPath, filepath.Join(v.driver.MetadataDir(), label)); err != nil {
+		glog.Errorf("Could not set device metadata for snapshot %s: %s", label, err)
+		v.Metadata.RemoveSnapshot(label)
+		return err
+	}
+	glog.V(2).Infof("Successfully loaded thin delta of snapshot %s", label)
+	return nil
+}
+
+// loadThinDelta writes the blocks and the metadata of a thin delta to a device
+// and a metadata directory.
+func (v *DeviceMapperVolume) loadThinDelta(tarIn *tar.Reader, info *thinDeltaInfo, deviceHash, metaPath string) error {
+	if _, err := v.driver.DeviceSet.GetDeviceStatus(deviceHash); err != nil {
+		return err
+	}
+	defer v.driver.deactivate(deviceHash)
+	if _, err := v.driver.growDevice(deviceHash, info.Size); err != nil && err != ErrNoShrinkage {
+		return err
+	}
+	devicePath := v.driver.devicePath(deviceHash)
+
+	// A delta without a parent has every block of the device, which is
+	// created from the base device, so clear it first.
+	if info.Parent == "" {
+		if err := devicemapper.BlockDeviceDiscard(devicePath); err != nil {
+			return err
+		}
+	}
+	dev, err := os.OpenFile(devicePath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+	for _, r := range info.Discarded {
+		if err := discardRange(dev, r.Begin*info.BlockSize, r.Length*info.BlockSize); err != nil {
+			return err
+		}
+	}
+	if err := readThinBlocks(tarIn, dev, metaPath); err != nil {
+		return err
+	}
+	return dev.Sync()
+}
+
+// deactivate deactivates a device that was activated to read or write its
+// blocks.
+func (d *DeviceMapperDriver) deactivate(deviceHash string) {
+	d.DeviceSet.Lock()
+	defer d.DeviceSet.Unlock()
+	if err := d.DeactivateDevice(deviceHash); err != nil {
+		glog.V(2).Infof("Error deactivating device %s: %s", deviceHash, err)
+	}
+}
+
+// thinDiff returns the blocks of device toID that differ from those of device
+// fromID, or all of the blocks that it maps if fromID is negative.
+func (d *DeviceMapperDriver) thinDiff(fromID, toID int) (*thinDiff, error) {
+	status := d.DeviceSet.Status()
+	pool := fmt.Sprintf("/dev/mapper/%s", strings.TrimPrefix(status.PoolName, "/dev/mapper/"))
+	mdDevice := metadataDevice(status)
+	statscache.locks.LockKey(pool)
+	defer statscache.locks.UnlockKey(pool)
+
+	var diff *thinDiff
+	err := d.withMetadataSnap(pool, func(block string) error {
+		var cmd *exec.Cmd
+		if fromID < 0 {
+			cmd = exec.Command("thin_dump", "-f", "xml", mdDevice, "-m", block)
+		} else {
+			cmd = exec.Command("thin_delta", "--metadata-snap", "--snap1", strconv.Itoa(fromID), "--snap2", strconv.Itoa(toID), mdDevice)
+		}
+		cmd.Stderr = os.Stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		if fromID < 0 {
+			diff, err = parseThinMappings(stdout, toID)
+		} else {
+			diff, err = parseThinDelta(stdout)
+		}
+		if err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return err
+		}
+		return cmd.Wait()
+	})
+	return diff, err
+}
+
+// parseThinDelta parses the xml output of thin_delta.  Blocks that only the
+// second device maps or that differ are changed; blocks that only the first
+// device maps are discarded.
+func parseThinDelta(r io.Reader) (*thinDiff, error) {
+	diff := &thinDiff{}
+	decoder := xml.NewDecoder(r)
+	for {
+		t, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		se, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "superblock":
+			if diff.blockSize, err = blockSizeAttr(se); err != nil {
+				return nil, err
+			}
+		case "different", "right_only", "left_only":
+			var r blockRange
+			for _, attr := range se.Attr {
+				switch attr.Name.Local {
+				case "begin":
+					r.Begin, err = strconv.ParseUint(attr.Value, 10, 64)
+				case "length":
+					r.Length, err = strconv.ParseUint(attr.Value, 10, 64)
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+			if se.Name.Local == "left_only" {
+				diff.discarded = appendRange(diff.discarded, r)
+			} else {
+				diff.changed = appendRange(diff.changed, r)
+			}
+		}
+	}
+	if diff.blockSize == 0 {
+		return nil, fmt.Errorf("thin_delta output has no data block size")
+	}
+	return diff, nil
+}
+
+// parseThinMappings parses the xml output of thin_dump into the blocks that
+// a device maps.
+func parseThinMappings(r io.Reader, deviceID int) (*thinDiff, error) {
+	diff := &thinDiff{}
+	decoder := xml.NewDecoder(r)
+	found, inDevice := false, false
+	for {
+		t, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch se := t.(type) {
+		case xml.EndElement:
+			if se.Name.Local == "device" {
+				inDevice = false
+			}
+		case xml.StartElement:
+			switch se.Name.Local {
+			case "superblock":
+				if diff.blockSize, err = blockSizeAttr(se); err != nil {
+					return nil, err
+				}
+			case "device":
+				for _, attr := range se.Attr {
+					if attr.Name.Local == "dev_id" {
+						inDevice = attr.Value == strconv.Itoa(deviceID)
+						found = found || inDevice
+					}
+				}
+			case "range_mapping":
+				if inDevice {
+					var m RangeMapping
+					if err := decoder.DecodeElement(&m, &se); err != nil {
+						return nil, err
+					}
+					diff.changed = appendRange(diff.changed, blockRange{uint64(m.OriginBegin), uint64(m.Length)})
+				}
+			case "single_mapping":
+				if inDevice {
+					var m SingleMapping
+					if err := decoder.DecodeElement(&m, &se); err != nil {
+						return nil, err
+					}
+					diff.changed = appendRange(diff.changed, blockRange{uint64(m.OriginBlock), 1})
+				}
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("device %d is not in the thin pool metadata", deviceID)
+	}
+	if diff.blockSize == 0 {
+		return nil, fmt.Errorf("thin_dump output has no data block size")
+	}
+	return diff, nil
+}
+
+// blockSizeAttr returns the data block size of a superblock in bytes
+func blockSizeAttr(se xml.StartElement) (uint64, error) {
+	for _, attr := range se.Attr {
+		if attr.Name.Local == "data_block_size" {
+			sectors, err := strconv.ParseUint(attr.Value, 10, 64)
+			return sectors * 512, err
+		}
+	}
+	return 0, nil
+}
+
+// appendRange adds a range to a list of ranges, merging it with the last one
+// if they are adjacent.
+func appendRange(ranges []blockRange, r blockRange) []blockRange {
+	if r.Length == 0 {
+		return ranges
+	}
+	if n := len(ranges); n > 0 && ranges[n-1].Begin+ranges[n-1].Length == r.Begin {
+		ranges[n-1].Length += r.Length
+		return ranges
+	}
+	return append(ranges, r)
+}
+
+// writeThinBlocks writes the changed ranges of a device of the given size as
+// entries of a thin delta.
+func writeThinBlocks(tarOut *tar.Writer, dev io.ReaderAt, size uint64, diff *thinDiff) error {
+	for _, r := range diff.changed {
+		offset := r.Begin * diff.blockSize
+		if offset >= size {
+			continue
+		}
+		length := r.Length * diff.blockSize
+		if offset+length > size {
+			length = size - offset
+		}
+		header := &tar.Header{
+			Name:     fmt.Sprintf("%s/%d", thinBlocksDir, offset),
+			Mode:     0600,
+			Size:     int64(length),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tarOut.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tarOut, io.NewSectionReader(dev, int64(offset), int64(length))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readThinBlocks writes the blocks of a thin delta to a device and its
+// metadata to a directory.
+func readThinBlocks(tarIn *tar.Reader, dev io.WriterAt, metaPath string) error {
+	buf := make([]byte, 1<<20)
+	for {
+		header, err := tarIn.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if strings.HasPrefix(header.Name, thinMetadataDir+"/") {
+			header.Name = strings.TrimPrefix(header.Name, thinMetadataDir)
+			if err := volume.ImportArchiveHeader(header, tarIn, metaPath); err != nil {
+				return err
+			}
+		} else if strings.HasPrefix(header.Name, thinBlocksDir+"/") {
+			offset, err := strconv.ParseInt(strings.TrimPrefix(header.Name, thinBlocksDir+"/"), 10, 64)
+			if err != nil {
+				return volume.ErrInvalidDelta
+			}
+			for {
+				n, err := tarIn.Read(buf)
+				if n > 0 {
+					if _, err := dev.WriteAt(buf[:n], offset); err != nil {
+						return err
+					}
+					offset += int64(n)
+				}
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// discardRange unmaps a range of bytes of a thin device, which then reads as
+// zeroes.
+func discardRange(dev *os.File, offset, length uint64) error {
+	r := [2]uint64{offset, length}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dev.Fd(), blkDiscard, uintptr(unsafe.Pointer(&r[0]))); errno != 0 {
+		return errno
+	}
+	return nil
+}
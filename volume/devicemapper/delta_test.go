@@ -0,0 +1,137 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit,linux,!darwin
+
+package devicemapper
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var thinDeltaXML = `<superblock uuid="" time="3" transaction="5" data_block_size="128" nr_data_blocks="1024">
+  <diff left="4" right="7">
+    <same begin="0" length="2"/>
+    <different begin="2" length="1"/>
+    <right_only begin="3" length="2"/>
+    <same begin="5" length="1"/>
+    <left_only begin="6" length="1"/>
+    <different begin="9" length="1"/>
+  </diff>
+</superblock>`
+
+var thinDumpXML = `<superblock uuid="" time="3" transaction="5" data_block_size="128" nr_data_blocks="1024">
+  <device dev_id="4" mapped_blocks="3" transaction="1" creation_time="0" snap_time="1">
+    <range_mapping origin_begin="0" data_begin="10" length="3" time="0"/>
+  </device>
+  <device dev_id="7" mapped_blocks="4" transaction="2" creation_time="1" snap_time="3">
+    <range_mapping origin_begin="0" data_begin="10" length="2" time="0"/>
+    <single_mapping origin_block="2" data_block="20" time="1"/>
+    <single_mapping origin_block="8" data_block="21" time="1"/>
+  </device>
+</superblock>`
+
+func TestParseThinDelta(t *testing.T) {
+	diff, err := parseThinDelta(strings.NewReader(thinDeltaXML))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if diff.blockSize != 128*512 {
+		t.Errorf("Expected block size %d, got %d", 128*512, diff.blockSize)
+	}
+	if expected := []blockRange{{2, 3}, {9, 1}}; !reflect.DeepEqual(diff.changed, expected) {
+		t.Errorf("Expected changed %v, got %v", expected, diff.changed)
+	}
+	if expected := []blockRange{{6, 1}}; !reflect.DeepEqual(diff.discarded, expected) {
+		t.Errorf("Expected discarded %v, got %v", expected, diff.discarded)
+	}
+
+	if _, err := parseThinDelta(strings.NewReader("<superblock></superblock>")); err == nil {
+		t.Errorf("Expected an error without a block size")
+	}
+}
+
+func TestParseThinMappings(t *testing.T) {
+	diff, err := parseThinMappings(strings.NewReader(thinDumpXML), 7)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if expected := []blockRange{{0, 3}, {8, 1}}; !reflect.DeepEqual(diff.changed, expected) {
+		t.Errorf("Expected changed %v, got %v", expected, diff.changed)
+	}
+	if len(diff.discarded) != 0 {
+		t.Errorf("Expected nothing discarded, got %v", diff.discarded)
+	}
+
+	if _, err := parseThinMappings(strings.NewReader(thinDumpXML), 9); err == nil {
+		t.Errorf("Expected an error for a missing device")
+	}
+}
+
+func TestThinBlocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "thindelta-")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a device of 10 blocks of 4 bytes, the last one short
+	from := []byte("aaaabbbbccccddddeeeeffffgggghhhhiiiijj")
+	to := []byte("aaaaBBBBccccddddeeeeffffgggghhhhiiiiJJ")
+	diff := &thinDiff{blockSize: 4, changed: []blockRange{{1, 1}, {9, 1}}}
+
+	buf := &bytes.Buffer{}
+	tarOut := tar.NewWriter(buf)
+	if err := writeThinBlocks(tarOut, bytes.NewReader(to), uint64(len(to)), diff); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	data := []byte("info")
+	tarOut.WriteHeader(&tar.Header{Name: thinMetadataDir + "/./.SNAPSHOTINFO", Mode: 0644, Size: int64(len(data))})
+	tarOut.Write(data)
+	tarOut.Close()
+
+	dev, err := os.Create(filepath.Join(dir, "dev"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer dev.Close()
+	dev.Write(from)
+	metaPath := filepath.Join(dir, "meta")
+	os.MkdirAll(metaPath, 0755)
+	if err := readThinBlocks(tar.NewReader(buf), dev, metaPath); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if actual, _ := ioutil.ReadFile(dev.Name()); !bytes.Equal(actual, to) {
+		t.Errorf("Expected device %q, got %q", to, actual)
+	}
+	if actual, _ := ioutil.ReadFile(filepath.Join(metaPath, ".SNAPSHOTINFO")); !bytes.Equal(actual, data) {
+		t.Errorf("Expected metadata %q, got %q", data, actual)
+	}
+}
+
+func TestAppendRange(t *testing.T) {
+	var ranges []blockRange
+	for _, r := range []blockRange{{0, 2}, {2, 1}, {3, 0}, {5, 1}, {6, 2}} {
+		ranges = appendRange(ranges, r)
+	}
+	if expected := []blockRange{{0, 3}, {5, 3}}; !reflect.DeepEqual(ranges, expected) {
+		t.Errorf("Expected %v, got %v", expected, ranges)
+	}
+}
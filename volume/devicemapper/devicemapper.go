@@ -377,19 +377,23 @@ func (d *DeviceMapperDriver) GetTenant(volumeName string) (volume.Volume, error)
 	return d.Get(getTenant(volumeName))
 }
 
-// Resize implements volume.Driver.Resize.
+// Resize implements volume.Driver.Resize.  The size of the device is the
+// quota of the volume, so a quota can only be raised; a smaller size returns
+// ErrNoShrinkage.  A size of 0 clears the quota without shrinking the device.
 func (d *DeviceMapperDriver) Resize(volumeName string, size uint64) error {
 	vol, err := d.getVolume(volumeName, false)
 	if err != nil {
 		return err
 	}
-	if err := d.resize(vol.deviceHash(), size); err != nil {
-		return err
+	if size > 0 {
+		if err := d.resize(vol.deviceHash(), size); err != nil {
+			return err
+		}
+		newSize := volume.FilesystemBytesSize(vol.Path())
+		human := units.BytesSize(float64(newSize))
+		glog.Infof("Resized filesystem. New size: %s", human)
 	}
-	newSize := volume.FilesystemBytesSize(vol.Path())
-	human := units.BytesSize(float64(newSize))
-	glog.Infof("Resized filesystem. New size: %s", human)
-	return nil
+	return volume.WriteQuota(filepath.Join(d.MetadataDir(), volumeName), size)
 }
 
 func (d *DeviceMapperDriver) resize(deviceHash string, size uint64) error {
@@ -400,18 +404,44 @@ func (d *DeviceMapperDriver) resize(deviceHash string, size uint64) error {
 		glog.Errorf("Could not get the current size of the device %s: %s", deviceHash, err)
 		return err
 	}
+	if grown, err := d.growDevice(deviceHash, size); err != nil || !grown {
+		return err
+	}
+
+	// Resize the filesystem to use the new space
+	if err := resize2fs(d.devicePath(deviceHash)); err != nil {
+		glog.Errorf("Unable to resize filesystem: %s", err)
+		d.resizeDevice(deviceHash, curSize)
+		return err
+	}
+	return nil
+}
+
+// growDevice grows a device to size without resizing its filesystem, and
+// returns false if the device already has that size.
+func (d *DeviceMapperDriver) growDevice(deviceHash string, size uint64) (bool, error) {
+
+	// Get the current size of the device
+	curSize, err := d.deviceSize(deviceHash)
+	if err != nil {
+		glog.Errorf("Could not get the current size of the device %s: %s", deviceHash, err)
+		return false, err
+	}
 
 	// Get the active table for the device
 	deviceName := d.deviceName(deviceHash)
 	start, oldSectors, targetType, params, err := devicemapper.GetTable(deviceName)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	// Figure out how many sectors we need
 	newSectors := size / 512
-	if newSectors <= oldSectors {
-		return ErrNoShrinkage
+	if newSectors == oldSectors {
+		// already the right size
+		return false, nil
+	} else if newSectors < oldSectors {
+		return false, ErrNoShrinkage
 	}
 
 	// Create the new table description using the sectors computed
@@ -422,7 +452,7 @@ func (d *DeviceMapperDriver) resize(deviceHash string, size uint64) error {
 	// Update the device info
 	if err := d.resizeDevice(deviceHash, size); err != nil {
 		glog.Errorf("Could not reset size of device %s: %s", deviceName, err)
-		return err
+		return false, err
 	}
 	if err := func() (err error) {
 
@@ -441,18 +471,12 @@ func (d *DeviceMapperDriver) resize(deviceHash string, size uint64) error {
 			return err
 		}
 		glog.V(2).Infof("Loaded inactive table into the active slot")
-
-		// Resize the filesystem to use the new space
-		if err := resize2fs(d.devicePath(deviceHash)); err != nil {
-			glog.Errorf("Unable to resize filesystem: %s", err)
-			return err
-		}
 		return nil
 	}(); err != nil {
 		d.resizeDevice(deviceHash, curSize)
-		return err
+		return false, err
 	}
-	return nil
+	return true, nil
 }
 
 // Get implements volume.Driver.Get
@@ -1525,6 +1549,9 @@ func (d *DeviceMapperDriver) GetTenantStorageStats() ([]volume.TenantStorageStat
 		tss.FilesystemUsed = used
 		tss.DeviceTotalBlocks = volume.BytesToBlocks(size)
 		tss.DeviceName = devicename
+		if tss.Quota, err = volume.ReadQuota(filepath.Join(d.MetadataDir(), tenant)); err != nil {
+			tss.Errors = append(tss.Errors, fmt.Sprintf("Could not read quota: %s", err))
+		}
 
 		//tss.DeviceUnallocatedBlocks = tss.DeviceTotalBlocks - tss.DeviceAllocatedBlocks
 		/* CC-2417
@@ -0,0 +1,57 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// +build linux,!darwin
+
+package devicemapper
+
+import (
+	"github.com/control-center/serviced/volume"
+)
+
+// ThinPoolMonitor extends the LVM thin pool of a devicemapper driver from the
+// free extents of its volume group as the pool fills up.
+type ThinPoolMonitor struct {
+	driver *DeviceMapperDriver
+	policy ExtendPolicy
+}
+
+// NewThinPoolMonitor returns a monitor for the thin pool of the driver.
+// Returns ErrNotDeviceMapper if the driver is not devicemapper.
+func NewThinPoolMonitor(driver volume.Driver, policy ExtendPolicy) (*ThinPoolMonitor, error) {
+	d, ok := driver.(*DeviceMapperDriver)
+	if !ok {
+		return nil, ErrNotDeviceMapper
+	}
+	return &ThinPoolMonitor{driver: d, policy: policy}, nil
+}
+
+// Usage returns the current usage of the thin pool
+func (m *ThinPoolMonitor) Usage() ThinPoolUsage {
+	status := m.driver.DeviceSet.Status()
+	return ThinPoolUsage{
+		PoolName:      status.PoolName,
+		Loopback:      status.DataLoopback != "" || status.MetadataLoopback != "",
+		DataUsed:      status.Data.Used,
+		DataTotal:     status.Data.Total,
+		MetadataUsed:  status.Metadata.Used,
+		MetadataTotal: status.Metadata.Total,
+	}
+}
+
+// Check extends the thin pool if its usage is over the thresholds of the
+// policy.  The extension is returned along with ErrInsufficientFreeSpace if
+// the volume group did not have enough space for all of it.
+func (m *ThinPoolMonitor) Check() (ThinPoolExtension, error) {
+	return extendThinPool(m.Usage(), m.policy)
+}
@@ -29,6 +29,7 @@ import (
 
 	"github.com/control-center/serviced/commons/diet"
 	"github.com/control-center/serviced/utils"
+	"github.com/control-center/serviced/volume/devicemapper/devmapper"
 	"github.com/zenoss/glog"
 )
 
@@ -112,6 +113,47 @@ func (d *DeviceMapperDriver) releaseMetadataSnap(pool string) error {
 	return nil
 }
 
+// metadataDevice returns the metadata device of the thin pool
+func metadataDevice(status *devmapper.Status) string {
+	// If this is loop-lvm, the metadata device will be in status.MetadataFile
+	if status.MetadataFile != "" {
+		return status.MetadataFile
+	}
+	// It's direct-lvm, so build the metadata device from the pool name
+	return fmt.Sprintf("/dev/mapper/%s_tmeta", status.PoolName)
+}
+
+// withMetadataSnap calls fn with the block at which a userspace snapshot of
+// a thin pool's metadata is accessible, and releases the snapshot when fn
+// returns.  Callers hold the pool's key in statscache.locks, so that only one
+// snapshot is used at a time.
+func (d *DeviceMapperDriver) withMetadataSnap(pool string, fn func(block string) error) error {
+	// Check for an existing snapshot of the metadata device.
+	hasSnap, err := hasMetadataSnap(pool)
+	if err != nil {
+		return err
+	}
+	// TODO: Implement file locking to avoid stomping on metadata snaps by out
+	// of band processes
+	if hasSnap {
+		// Release the existing snapshot.
+		if err := d.releaseMetadataSnap(pool); err != nil {
+			return err
+		}
+	}
+	// Take a userspace-accessible snapshot of the metadata device.
+	if err := d.reserveMetadataSnap(pool); err != nil {
+		return err
+	}
+	defer d.releaseMetadataSnap(pool)
+	// Ask for the block at which the metadata snap is accessible
+	block, err := getMetadataBlock(pool)
+	if err != nil {
+		return err
+	}
+	return fn(block)
+}
+
 // getDevices acts on an existing userspace metadata snapshot, and has no
 // potential devicemapper conflicts. It simply dumps the XML and parses it.
 func getDevices(pool, block, metadatadev string) (map[int]*DeviceBlockStats, error) {
@@ -523,33 +565,12 @@ func (d *DeviceMapperDriver) getDeviceBlockStats(pool, metadatadev string) (map[
 	val, ok := statscache.cache[pool]
 	if !ok || time.Now().After(val.expiry) {
 		glog.Infof("Refreshing storage stats cache from thin pool metadata")
-		// Check for an existing snapshot of the metadata device.
-		hasSnap, err := hasMetadataSnap(pool)
-		if err != nil {
-			return nil, err
-		}
-		// TODO: Implement file locking to avoid stomping on metadata snaps by out
-		// of band processes
-		if hasSnap {
-			// Release the existing snapshot.
-			if err := d.releaseMetadataSnap(pool); err != nil {
-				return nil, err
-			}
-		}
-		// Take a userspace-accessible snapshot of the metadata device.
-		if err := d.reserveMetadataSnap(pool); err != nil {
-			return nil, err
-		}
-		defer d.releaseMetadataSnap(pool)
-		// Ask for the block at which the metadata snap is accessible
-		block, err := getMetadataBlock(pool)
-		if err != nil {
-			return nil, err
-		}
-		// Dump the metadata from the snapshot to XML, parse it, and return the
+		// Dump the metadata from a snapshot to XML, parse it, and return the
 		// resulting DeviceBlockStats objects.
-		value, err = getDevices(pool, block, metadatadev)
-		if err != nil {
+		if err := d.withMetadataSnap(pool, func(block string) (err error) {
+			value, err = getDevices(pool, block, metadatadev)
+			return err
+		}); err != nil {
 			return nil, err
 		}
 		// Don't cache if there aren't any devices besides the base device yet
@@ -0,0 +1,229 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package devicemapper
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/zenoss/glog"
+)
+
+var (
+	// ErrNotDeviceMapper is returned when a thin pool monitor is created for
+	// a driver that is not devicemapper.
+	ErrNotDeviceMapper = errors.New("driver is not devicemapper")
+	// ErrNotLVMPool is returned when the thin pool is not a logical volume,
+	// such as a loop-lvm pool, and cannot be extended.
+	ErrNotLVMPool = errors.New("thin pool is not an LVM logical volume")
+	// ErrInsufficientFreeSpace is returned when the volume group does not
+	// have enough free extents to extend the thin pool.
+	ErrInsufficientFreeSpace = errors.New("not enough free space in the volume group to extend the thin pool")
+)
+
+// ThinPoolUsage is the data and metadata usage of a thin pool in bytes
+type ThinPoolUsage struct {
+	PoolName      string
+	Loopback      bool
+	DataUsed      uint64
+	DataTotal     uint64
+	MetadataUsed  uint64
+	MetadataTotal uint64
+}
+
+// DataPercent returns the percent of the data volume that is used
+func (u ThinPoolUsage) DataPercent() int {
+	return percentUsed(u.DataUsed, u.DataTotal)
+}
+
+// MetadataPercent returns the percent of the metadata volume that is used
+func (u ThinPoolUsage) MetadataPercent() int {
+	return percentUsed(u.MetadataUsed, u.MetadataTotal)
+}
+
+func percentUsed(used, total uint64) int {
+	if total == 0 {
+		return 0
+	}
+	return int(used * 100 / total)
+}
+
+// ExtendPolicy decides when and by how much a thin pool is extended
+type ExtendPolicy struct {
+	DataThreshold     int // percent of the data volume used before it is extended; 0 disables
+	MetadataThreshold int // percent of the metadata volume used before it is extended; 0 disables
+	ExtendPercent     int // percent of the current size to add
+}
+
+// Plan returns the number of bytes to add to the data and metadata volumes
+// of a thin pool with the given usage.
+func (p ExtendPolicy) Plan(usage ThinPoolUsage) (data, metadata uint64) {
+	if p.ExtendPercent <= 0 {
+		return 0, 0
+	}
+	if p.DataThreshold > 0 && usage.DataPercent() >= p.DataThreshold {
+		data = usage.DataTotal * uint64(p.ExtendPercent) / 100
+	}
+	if p.MetadataThreshold > 0 && usage.MetadataPercent() >= p.MetadataThreshold {
+		metadata = usage.MetadataTotal * uint64(p.ExtendPercent) / 100
+	}
+	return
+}
+
+// ThinPoolExtension describes an attempt to extend a thin pool
+type ThinPoolExtension struct {
+	Usage             ThinPoolUsage
+	VolumeGroup       string
+	LogicalVolume     string
+	DataRequested     uint64
+	MetadataRequested uint64
+	DataAdded         uint64
+	MetadataAdded     uint64
+}
+
+// Requested returns true if the thin pool needed to be extended
+func (e ThinPoolExtension) Requested() bool {
+	return e.DataRequested > 0 || e.MetadataRequested > 0
+}
+
+// extendThinPool extends a thin pool with the given usage if it is over the
+// thresholds of the policy.  The extension is returned along with
+// ErrInsufficientFreeSpace if the volume group did not have enough space for
+// all of it.
+func extendThinPool(usage ThinPoolUsage, policy ExtendPolicy) (ThinPoolExtension, error) {
+	ext := ThinPoolExtension{Usage: usage}
+	ext.DataRequested, ext.MetadataRequested = policy.Plan(ext.Usage)
+	if !ext.Requested() {
+		return ext, nil
+	}
+	if ext.Usage.Loopback {
+		return ext, ErrNotLVMPool
+	}
+	var err error
+	if ext.VolumeGroup, ext.LogicalVolume, err = splitLVMName(ext.Usage.PoolName); err != nil {
+		return ext, err
+	}
+	free, extent, err := volumeGroupFree(ext.VolumeGroup)
+	if err != nil {
+		return ext, err
+	}
+	data, metadata := allocateExtents(free, extent, ext.DataRequested, ext.MetadataRequested)
+	lv := fmt.Sprintf("%s/%s", ext.VolumeGroup, ext.LogicalVolume)
+	// metadata is extended first, since the pool fails when it runs out
+	if metadata > 0 {
+		if err := lvextend("--poolmetadatasize", fmt.Sprintf("+%db", metadata), lv); err != nil {
+			return ext, err
+		}
+		ext.MetadataAdded = metadata
+	}
+	if data > 0 {
+		if err := lvextend("--size", fmt.Sprintf("+%db", data), lv); err != nil {
+			return ext, err
+		}
+		ext.DataAdded = data
+	}
+	if ext.DataAdded < ext.DataRequested || ext.MetadataAdded < ext.MetadataRequested {
+		return ext, ErrInsufficientFreeSpace
+	}
+	return ext, nil
+}
+
+// allocateExtents splits the free space of a volume group between the data and
+// metadata requests, in whole extents.  Requests are rounded up to the next
+// extent and metadata is allocated first.
+func allocateExtents(free, extent, data, metadata uint64) (uint64, uint64) {
+	if extent == 0 {
+		return 0, 0
+	}
+	roundUp := func(n uint64) uint64 {
+		return (n + extent - 1) / extent * extent
+	}
+	avail := free / extent * extent
+	metadata = roundUp(metadata)
+	if metadata > avail {
+		metadata = avail
+	}
+	avail -= metadata
+	data = roundUp(data)
+	if data > avail {
+		data = avail
+	}
+	return data, metadata
+}
+
+// splitLVMName returns the volume group and logical volume of a device mapper
+// name that was created by LVM.  LVM joins the names with a dash and escapes
+// dashes in the names by doubling them, and may add a layer suffix such as
+// "-tpool".
+func splitLVMName(name string) (vg, lv string, err error) {
+	name = strings.TrimPrefix(name, "/dev/mapper/")
+	var parts []string
+	var part []byte
+	for i := 0; i < len(name); i++ {
+		if name[i] == '-' {
+			if i+1 < len(name) && name[i+1] == '-' {
+				part = append(part, '-')
+				i++
+				continue
+			}
+			parts = append(parts, string(part))
+			part = nil
+			continue
+		}
+		part = append(part, name[i])
+	}
+	parts = append(parts, string(part))
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return "", "", ErrNotLVMPool
+	}
+	return parts[0], parts[1], nil
+}
+
+// volumeGroupFree returns the free space and the extent size of a volume
+// group in bytes.
+func volumeGroupFree(vg string) (free, extent uint64, err error) {
+	output, err := exec.Command("vgs", "--noheadings", "--nosuffix", "--units", "b",
+		"--separator", ",", "--options", "vg_free,vg_extent_size", vg).CombinedOutput()
+	if err != nil {
+		glog.Errorf("Could not get free space of volume group %s: %s (%s)", vg, string(output), err)
+		return 0, 0, err
+	}
+	return parseVolumeGroupFree(string(output))
+}
+
+func parseVolumeGroupFree(output string) (free, extent uint64, err error) {
+	fields := strings.Split(strings.TrimSpace(output), ",")
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("could not parse vgs output %q", output)
+	}
+	if free, err = strconv.ParseUint(strings.TrimSpace(fields[0]), 10, 64); err != nil {
+		return 0, 0, err
+	}
+	if extent, err = strconv.ParseUint(strings.TrimSpace(fields[1]), 10, 64); err != nil {
+		return 0, 0, err
+	}
+	return free, extent, nil
+}
+
+func lvextend(args ...string) error {
+	glog.V(1).Infof("Executing: lvextend %s", strings.Join(args, " "))
+	output, err := exec.Command("lvextend", args...).CombinedOutput()
+	if err != nil {
+		glog.Errorf("Could not extend thin pool: %s (%s)", string(output), err)
+	}
+	return err
+}
@@ -0,0 +1,31 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package devicemapper
+
+import (
+	"github.com/control-center/serviced/volume"
+)
+
+// ThinPoolMonitor is not supported on OSX
+type ThinPoolMonitor struct{}
+
+// NewThinPoolMonitor always returns ErrNotDeviceMapper on OSX
+func NewThinPoolMonitor(_ volume.Driver, _ ExtendPolicy) (*ThinPoolMonitor, error) {
+	return nil, ErrNotDeviceMapper
+}
+
+// Check does nothing on OSX
+func (m *ThinPoolMonitor) Check() (ThinPoolExtension, error) {
+	return ThinPoolExtension{}, ErrNotDeviceMapper
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit,linux,!darwin
+
+package devicemapper
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type ThinPoolSuite struct{}
+
+var _ = Suite(&ThinPoolSuite{})
+
+func (s *ThinPoolSuite) TestPlan(c *C) {
+	policy := ExtendPolicy{DataThreshold: 80, MetadataThreshold: 70, ExtendPercent: 25}
+	usage := ThinPoolUsage{DataUsed: 79, DataTotal: 100, MetadataUsed: 7, MetadataTotal: 10}
+	data, metadata := policy.Plan(usage)
+	c.Check(data, Equals, uint64(0))
+	c.Check(metadata, Equals, uint64(2))
+
+	usage.DataUsed = 80
+	data, metadata = policy.Plan(usage)
+	c.Check(data, Equals, uint64(25))
+	c.Check(metadata, Equals, uint64(2))
+
+	// a threshold of 0 disables extension
+	policy.MetadataThreshold = 0
+	data, metadata = policy.Plan(usage)
+	c.Check(data, Equals, uint64(25))
+	c.Check(metadata, Equals, uint64(0))
+}
+
+func (s *ThinPoolSuite) TestAllocateExtents(c *C) {
+	// enough space; requests are rounded up to whole extents
+	data, metadata := allocateExtents(100, 4, 10, 3)
+	c.Check(data, Equals, uint64(12))
+	c.Check(metadata, Equals, uint64(4))
+
+	// metadata is allocated before data
+	data, metadata = allocateExtents(18, 4, 40, 5)
+	c.Check(data, Equals, uint64(8))
+	c.Check(metadata, Equals, uint64(8))
+
+	// no free extents
+	data, metadata = allocateExtents(3, 4, 40, 5)
+	c.Check(data, Equals, uint64(0))
+	c.Check(metadata, Equals, uint64(0))
+}
+
+func (s *ThinPoolSuite) TestSplitLVMName(c *C) {
+	vg, lv, err := splitLVMName("serviced-serviced--pool")
+	c.Assert(err, IsNil)
+	c.Check(vg, Equals, "serviced")
+	c.Check(lv, Equals, "serviced-pool")
+
+	vg, lv, err = splitLVMName("/dev/mapper/my--vg-pool-tpool")
+	c.Assert(err, IsNil)
+	c.Check(vg, Equals, "my-vg")
+	c.Check(lv, Equals, "pool")
+
+	// docker loop-lvm pool names
+	_, _, err = splitLVMName("docker-8:1-1234-pool")
+	c.Check(err, Equals, ErrNotLVMPool)
+	_, _, err = splitLVMName("pool")
+	c.Check(err, Equals, ErrNotLVMPool)
+}
+
+func (s *ThinPoolSuite) TestParseVolumeGroupFree(c *C) {
+	free, extent, err := parseVolumeGroupFree("  10737418240,4194304\n")
+	c.Assert(err, IsNil)
+	c.Check(free, Equals, uint64(10737418240))
+	c.Check(extent, Equals, uint64(4194304))
+
+	_, _, err = parseVolumeGroupFree("")
+	c.Check(err, NotNil)
+}
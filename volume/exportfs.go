@@ -154,7 +154,8 @@ func ImportArchiveHeader(header *tar.Header, reader io.Reader, path string) erro
 		}
 	case tar.TypeReg:
 		err := func() error {
-			writer, err := os.Create(filename)
+			// never write through a symlink at the path
+			writer, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC|syscall.O_NOFOLLOW, 0666)
 			if err != nil {
 				glog.Errorf("Could not create file at %s: %s", filename, err)
 				return err
@@ -173,9 +174,13 @@ func ImportArchiveHeader(header *tar.Header, reader io.Reader, path string) erro
 		glog.Errorf("Found unxepected file type %b: will not import %s", header.Typeflag, filename)
 		return nil
 	}
-	if err := os.Chown(filename, header.Uid, header.Gid); err != nil {
+	// change the symlinks themselves, not their targets
+	if err := os.Lchown(filename, header.Uid, header.Gid); err != nil {
 		glog.Warningf("Could not change file ownership for %s: %s", filename, err)
 	}
+	if header.Typeflag == tar.TypeSymlink {
+		return nil
+	}
 	if err := os.Chmod(filename, header.FileInfo().Mode()); err != nil {
 		glog.Warningf("Could not set permissions for file %s: %s", filename, err)
 	}
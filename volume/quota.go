@@ -0,0 +1,244 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package volume
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/zenoss/glog"
+)
+
+var (
+	ErrQuotaUnsupported = errors.New("filesystem does not support quotas")
+	ErrBadQuotaOutput   = errors.New("could not parse quota output")
+)
+
+// QuotaFileName is the name of the file in a volume's metadata directory that
+// holds the quota of the volume in bytes.
+const QuotaFileName = ".QUOTA"
+
+// xfsSuperMagic is the filesystem type reported by statfs for xfs
+const xfsSuperMagic = 0x58465342
+
+// WriteQuota saves the quota of the volume whose metadata is in dir.  A size
+// of 0 removes the quota.
+func WriteQuota(dir string, size uint64) error {
+	filename := filepath.Join(dir, QuotaFileName)
+	if size == 0 {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return ioutil.WriteFile(filename, []byte(strconv.FormatUint(size, 10)), 0644)
+}
+
+// ReadQuota returns the quota of the volume whose metadata is in dir, or 0
+// if the volume has no quota.
+func ReadQuota(dir string) (uint64, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, QuotaFileName))
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// ProjectID returns the xfs project id that is used for the quota of a
+// volume.
+func ProjectID(volumeName string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(volumeName))
+	// project id 0 is the default project
+	if id := h.Sum32() & 0x7fffffff; id != 0 {
+		return id
+	}
+	return 1
+}
+
+// mountPoint returns the mount point of the filesystem that path is on.
+func mountPoint(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return "", err
+	}
+	for path != "/" {
+		var parent syscall.Stat_t
+		if err := syscall.Stat(filepath.Dir(path), &parent); err != nil {
+			return "", err
+		}
+		if parent.Dev != st.Dev {
+			break
+		}
+		path = filepath.Dir(path)
+	}
+	return path, nil
+}
+
+// xfsProjectQuotaMount returns the mount point of the xfs filesystem under
+// path, if the filesystem enforces project quotas.
+func xfsProjectQuotaMount(path string) (string, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return "", err
+	}
+	if fs.Type != xfsSuperMagic {
+		return "", ErrQuotaUnsupported
+	}
+	mnt, err := mountPoint(path)
+	if err != nil {
+		return "", err
+	}
+	output, err := runXFSQuota(mnt, "state -p")
+	if err != nil || !strings.Contains(output, "Enforcement: ON") {
+		glog.V(2).Infof("Project quotas are not enforced on %s: %s", mnt, output)
+		return "", ErrQuotaUnsupported
+	}
+	return mnt, nil
+}
+
+func runXFSQuota(mnt, command string) (string, error) {
+	glog.V(4).Infof("Executing: xfs_quota -x -c %q %s", command, mnt)
+	output, err := exec.Command("xfs_quota", "-x", "-c", command, mnt).CombinedOutput()
+	if err != nil {
+		glog.Errorf("Could not run xfs_quota %q on %s: %s (%s)", command, mnt, string(output), err)
+	}
+	return string(output), err
+}
+
+// SetProjectQuota limits the space used by the directory tree at path with
+// an xfs project quota.  Returns ErrQuotaUnsupported if the filesystem is not
+// xfs or was not mounted with project quotas.
+func SetProjectQuota(path, volumeName string, size uint64) error {
+	mnt, err := xfsProjectQuotaMount(path)
+	if err != nil {
+		return err
+	}
+	id := ProjectID(volumeName)
+	if _, err := runXFSQuota(mnt, fmt.Sprintf("project -s -p %s %d", path, id)); err != nil {
+		return err
+	}
+	// xfs_quota takes the limit in kilobytes
+	limit := (size + 1023) / 1024
+	if _, err := runXFSQuota(mnt, fmt.Sprintf("limit -p bhard=%dk %d", limit, id)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ProjectQuotaUsage returns the bytes used by the xfs project of a volume.
+func ProjectQuotaUsage(path, volumeName string) (uint64, error) {
+	mnt, err := xfsProjectQuotaMount(path)
+	if err != nil {
+		return 0, err
+	}
+	output, err := runXFSQuota(mnt, fmt.Sprintf("quota -p -N -b %d", ProjectID(volumeName)))
+	if err != nil {
+		return 0, err
+	}
+	return parseXFSQuotaUsage(output)
+}
+
+// parseXFSQuotaUsage parses the output of "xfs_quota -c 'quota -N -b'", which
+// is the device followed by the used, soft and hard limits in kilobytes.
+func parseXFSQuotaUsage(output string) (uint64, error) {
+	fields := strings.Fields(output)
+	if len(fields) < 4 {
+		return 0, ErrBadQuotaOutput
+	}
+	used, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, ErrBadQuotaOutput
+	}
+	return used * 1024, nil
+}
+
+// DirectoryBytesUsed returns the disk space allocated to the files under
+// path.
+func DirectoryBytesUsed(path string) (uint64, error) {
+	var used uint64
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			used += uint64(stat.Blocks) * 512
+		}
+		return nil
+	})
+	return used, err
+}
+
+// SetDirectoryQuota sets the quota of a volume that is a directory on the
+// host filesystem with an xfs project quota, and records it in the volume's
+// metadata directory.  Returns ErrQuotaUnsupported if the filesystem does not
+// enforce project quotas, in which case only a size of 0 may be set.
+func SetDirectoryQuota(metadataDir, path, volumeName string, size uint64) error {
+	if err := SetProjectQuota(path, volumeName, size); err == ErrQuotaUnsupported {
+		if size > 0 {
+			glog.Errorf("Filesystem under %s does not enforce project quotas; cannot set a quota for %s", path, volumeName)
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	if err := WriteQuota(metadataDir, size); err != nil {
+		glog.Errorf("Could not save quota for volume %s: %s", volumeName, err)
+		return err
+	}
+	return nil
+}
+
+// DirectoryTenantStats returns the storage stats of a tenant volume that is a
+// directory on the host filesystem.  Usage is only computed for volumes that
+// have a quota, since walking the tree of a large volume is expensive.
+func DirectoryTenantStats(metadataDir, path, tenantID string) TenantStorageStats {
+	tss := TenantStorageStats{
+		TenantID:   tenantID,
+		VolumePath: path,
+	}
+	quota, err := ReadQuota(metadataDir)
+	if err != nil {
+		tss.Errors = append(tss.Errors, fmt.Sprintf("Could not read quota: %s", err))
+		return tss
+	} else if quota == 0 {
+		return tss
+	}
+	tss.Quota = quota
+	used, err := ProjectQuotaUsage(path, tenantID)
+	if err != nil {
+		if used, err = DirectoryBytesUsed(path); err != nil {
+			tss.Errors = append(tss.Errors, fmt.Sprintf("Could not get usage: %s", err))
+		}
+	}
+	tss.FilesystemUsed = used
+	return tss
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type QuotaSuite struct{}
+
+var _ = Suite(&QuotaSuite{})
+
+func (s *QuotaSuite) TestReadWriteQuota(c *C) {
+	dir := c.MkDir()
+	quota, err := ReadQuota(dir)
+	c.Assert(err, IsNil)
+	c.Check(quota, Equals, uint64(0))
+
+	c.Assert(WriteQuota(dir, 1<<30), IsNil)
+	quota, err = ReadQuota(dir)
+	c.Assert(err, IsNil)
+	c.Check(quota, Equals, uint64(1<<30))
+
+	c.Assert(WriteQuota(dir, 0), IsNil)
+	quota, err = ReadQuota(dir)
+	c.Assert(err, IsNil)
+	c.Check(quota, Equals, uint64(0))
+	c.Assert(WriteQuota(dir, 0), IsNil)
+}
+
+func (s *QuotaSuite) TestParseXFSQuotaUsage(c *C) {
+	used, err := parseXFSQuotaUsage("/dev/sdb1   2048   0   10485760   00 [--------] /opt/serviced/var/volumes\n")
+	c.Assert(err, IsNil)
+	c.Check(used, Equals, uint64(2048*1024))
+
+	_, err = parseXFSQuotaUsage("")
+	c.Check(err, Equals, ErrBadQuotaOutput)
+}
+
+func (s *QuotaSuite) TestDirectoryTenantStats(c *C) {
+	root := c.MkDir()
+	mdir, vdir := filepath.Join(root, "md"), filepath.Join(root, "tenant")
+	c.Assert(os.Mkdir(mdir, 0755), IsNil)
+	c.Assert(os.Mkdir(vdir, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(vdir, "data"), make([]byte, 64*1024), 0644), IsNil)
+
+	// no quota, no usage
+	tss := DirectoryTenantStats(mdir, vdir, "tenant")
+	c.Check(tss.TenantID, Equals, "tenant")
+	c.Check(tss.Quota, Equals, uint64(0))
+	c.Check(tss.FilesystemUsed, Equals, uint64(0))
+
+	// the quota is not recorded if the filesystem cannot enforce it
+	if err := SetDirectoryQuota(mdir, vdir, "tenant", 1<<20); err == ErrQuotaUnsupported {
+		tss = DirectoryTenantStats(mdir, vdir, "tenant")
+		c.Check(tss.Quota, Equals, uint64(0))
+		c.Assert(SetDirectoryQuota(mdir, vdir, "tenant", 0), IsNil)
+		c.Assert(WriteQuota(mdir, 1<<20), IsNil)
+	} else {
+		c.Assert(err, IsNil)
+	}
+	tss = DirectoryTenantStats(mdir, vdir, "tenant")
+	c.Check(tss.Quota, Equals, uint64(1<<20))
+	c.Check(tss.FilesystemUsed >= 64*1024, Equals, true)
+	c.Check(tss.Errors, HasLen, 0)
+}
+
+func (s *QuotaSuite) TestSimpleStatusTenants(c *C) {
+	status := SimpleStatus{
+		Driver: DriverTypeRsync,
+		Tenants: []TenantStorageStats{
+			{TenantID: "tenant1", VolumePath: "/volumes/tenant1", Quota: 1 << 30, FilesystemUsed: 1 << 29},
+			{TenantID: "tenant2", VolumePath: "/volumes/tenant2"},
+		},
+	}
+	out := status.String()
+	c.Check(strings.Contains(out, "Tenant tenant1:\n\tVolume Mount Point: /volumes/tenant1\n\tQuota (used/total): 512 MiB / 1 GiB (50%)\n"), Equals, true)
+	c.Check(strings.Contains(out, "Tenant tenant2:\n\tVolume Mount Point: /volumes/tenant2\n\tQuota: none\n"), Equals, true)
+}
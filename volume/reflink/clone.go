@@ -0,0 +1,195 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reflink
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/zenoss/glog"
+)
+
+// cloner copies directory trees, sharing the file data between the source
+// and the copy when the filesystem supports reflinks.
+type cloner struct {
+	reflinks bool
+}
+
+// dirAttrs are the attributes of a directory that are set after all of its
+// contents have been copied, so that the copy does not change its mtime.
+type dirAttrs struct {
+	path string
+	info os.FileInfo
+}
+
+// CloneTree copies the contents of the directory at src into the existing
+// directory at dst.  Files that vanish while the tree is being copied are
+// skipped.
+func (c *cloner) CloneTree(src, dst string) error {
+	var dirs []dirAttrs
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				glog.V(2).Infof("Skipping %s: file vanished", path)
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		mode := info.Mode()
+		switch {
+		case mode.IsDir():
+			if rel != "." {
+				if err := os.Mkdir(target, 0700); err != nil {
+					return err
+				}
+			}
+			dirs = append(dirs, dirAttrs{target, info})
+			return nil
+		case mode.IsRegular():
+			err = c.cloneFile(path, target, info)
+		case mode&os.ModeSymlink != 0:
+			err = cloneSymlink(path, target, info)
+		default:
+			err = cloneSpecial(target, info)
+		}
+		if os.IsNotExist(err) {
+			glog.V(2).Infof("Skipping %s: file vanished", path)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// set the directory attributes from the bottom up
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := setAttrs(dirs[i].path, dirs[i].info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cloneFile copies a regular file, using a reflink if possible.
+func (c *cloner) cloneFile(src, dst string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if c.reflinks {
+		if err := reflink(out, in); err == nil {
+			return setAttrs(dst, info)
+		} else if !isReflinkUnsupported(err) {
+			glog.Errorf("Could not reflink %s to %s: %s", src, dst, err)
+			return err
+		}
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return setAttrs(dst, info)
+}
+
+// cloneSymlink recreates a symbolic link.
+func cloneSymlink(src, dst string, info os.FileInfo) error {
+	link, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if err := os.Symlink(link, dst); err != nil {
+		return err
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return os.Lchown(dst, int(stat.Uid), int(stat.Gid))
+	}
+	return nil
+}
+
+// cloneSpecial recreates device nodes, fifos and sockets.
+func cloneSpecial(dst string, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		glog.Warningf("Skipping special file %s", dst)
+		return nil
+	}
+	if err := syscall.Mknod(dst, uint32(stat.Mode), int(stat.Rdev)); err != nil {
+		return err
+	}
+	return setAttrs(dst, info)
+}
+
+// setAttrs sets the owner, mode and modification time of a file or
+// directory.  The owner is set first, because changing it clears the setuid
+// and setgid bits.
+func setAttrs(path string, info os.FileInfo) error {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		if err := os.Lchown(path, int(stat.Uid), int(stat.Gid)); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(path, info.Mode()); err != nil {
+		return err
+	}
+	return os.Chtimes(path, time.Now(), info.ModTime())
+}
+
+// clearDirectory removes the contents of a directory, but not the directory
+// itself, so that bind mounts of the directory stay valid.
+func clearDirectory(path string) error {
+	fis, err := ioutil.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if err := os.RemoveAll(filepath.Join(path, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// supportsReflinks checks whether files in the directory can be reflinked.
+func supportsReflinks(dir string) bool {
+	src, err := ioutil.TempFile(dir, ".reflink-probe")
+	if err != nil {
+		return false
+	}
+	defer os.Remove(src.Name())
+	defer src.Close()
+	if _, err := src.Write([]byte("reflink")); err != nil {
+		return false
+	}
+	dst, err := ioutil.TempFile(dir, ".reflink-probe")
+	if err != nil {
+		return false
+	}
+	defer os.Remove(dst.Name())
+	defer dst.Close()
+	return reflink(dst, src) == nil
+}
@@ -0,0 +1,34 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !linux
+
+package reflink
+
+import (
+	"errors"
+	"os"
+)
+
+var errReflinkUnsupported = errors.New("reflinks are not supported on this platform")
+
+// reflink is not supported outside of linux.
+func reflink(dst, src *os.File) error {
+	return errReflinkUnsupported
+}
+
+// isReflinkUnsupported returns true if the error means that the files cannot
+// be reflinked, so the data has to be copied instead.
+func isReflinkUnsupported(err error) bool {
+	return err == errReflinkUnsupported
+}
@@ -0,0 +1,79 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package reflink
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloneTree(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reflink")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+	src, dst := filepath.Join(tmp, "src"), filepath.Join(tmp, "dst")
+	assert.Nil(t, os.MkdirAll(filepath.Join(src, "a", "b"), 0755))
+	assert.Nil(t, os.Mkdir(dst, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(src, "a", "b", "file"), []byte("data"), 0640))
+	assert.Nil(t, os.Symlink("b/file", filepath.Join(src, "a", "link")))
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	assert.Nil(t, os.Chtimes(filepath.Join(src, "a"), mtime, mtime))
+	assert.Nil(t, os.Chmod(src, 0711))
+
+	for _, c := range []*cloner{{reflinks: supportsReflinks(tmp)}, {reflinks: false}} {
+		assert.Nil(t, clearDirectory(dst))
+		assert.Nil(t, c.CloneTree(src, dst))
+
+		data, err := ioutil.ReadFile(filepath.Join(dst, "a", "b", "file"))
+		assert.Nil(t, err)
+		assert.Equal(t, "data", string(data))
+		fi, err := os.Stat(filepath.Join(dst, "a", "b", "file"))
+		assert.Nil(t, err)
+		assert.Equal(t, os.FileMode(0640), fi.Mode())
+
+		link, err := os.Readlink(filepath.Join(dst, "a", "link"))
+		assert.Nil(t, err)
+		assert.Equal(t, "b/file", link)
+
+		fi, err = os.Stat(filepath.Join(dst, "a"))
+		assert.Nil(t, err)
+		assert.Equal(t, mtime, fi.ModTime())
+		fi, err = os.Stat(dst)
+		assert.Nil(t, err)
+		assert.Equal(t, os.ModeDir|0711, fi.Mode())
+	}
+}
+
+func TestClearDirectory(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reflink")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+	assert.Nil(t, os.MkdirAll(filepath.Join(tmp, "a", "b"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(tmp, "file"), []byte("data"), 0644))
+	assert.Nil(t, clearDirectory(tmp))
+	fis, err := ioutil.ReadDir(tmp)
+	assert.Nil(t, err)
+	assert.Empty(t, fis)
+}
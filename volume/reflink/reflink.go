@@ -0,0 +1,681 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reflink implements a volume driver that keeps volumes and snapshots
+// as plain directories on the host filesystem, like the rsync driver, but
+// takes snapshots with copy-on-write reflinks.  On filesystems that support
+// reflinks (xfs with reflink=1, btrfs) a snapshot only costs the metadata of
+// the copied tree; on other filesystems the file data is copied.
+package reflink
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/control-center/serviced/volume"
+	"github.com/zenoss/glog"
+)
+
+var (
+	ErrDeletingVolume      = errors.New("could not delete volume")
+	ErrReflinkInvalidLabel = errors.New("invalid label")
+)
+
+// ReflinkDriver is a driver for reflink volumes
+type ReflinkDriver struct {
+	sync.Mutex
+	root   string
+	cloner *cloner
+}
+
+// ReflinkVolume is a reflink volume
+type ReflinkVolume struct {
+	sync.Mutex
+	name   string
+	path   string
+	tenant string
+	driver *ReflinkDriver
+}
+
+func init() {
+	volume.Register(volume.DriverTypeReflink, Init)
+}
+
+// Init initializes the reflink driver
+func Init(root string, _ []string) (volume.Driver, error) {
+	driver := &ReflinkDriver{
+		root: root,
+	}
+	if err := os.MkdirAll(driver.MetadataDir(), 0755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	if err := volume.TouchFlagFile(driver.poolDir()); err != nil {
+		return nil, err
+	}
+	reflinks := supportsReflinks(driver.poolDir())
+	if !reflinks {
+		glog.Warningf("Filesystem at %s does not support reflinks; snapshots will be full copies", root)
+	}
+	driver.cloner = &cloner{reflinks: reflinks}
+	return driver, nil
+}
+
+// Root implements volume.Driver.Root
+func (d *ReflinkDriver) Root() string {
+	return d.root
+}
+
+// DriverType implements volume.Driver.DriverType
+func (d *ReflinkDriver) DriverType() volume.DriverType {
+	return volume.DriverTypeReflink
+}
+
+// Create implements volume.Driver.Create
+func (d *ReflinkDriver) Create(volumeName string) (volume.Volume, error) {
+	d.Lock()
+	defer d.Unlock()
+	if d.Exists(volumeName) {
+		return nil, volume.ErrVolumeExists
+	}
+	if err := os.MkdirAll(filepath.Join(d.MetadataDir(), volumeName), 0755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	volumePath := filepath.Join(d.root, volumeName)
+	if err := os.MkdirAll(volumePath, 0755); err != nil {
+		return nil, err
+	}
+	return d.Get(volumeName)
+}
+
+// Remove implements volume.Driver.Remove
+func (d *ReflinkDriver) Remove(volumeName string) error {
+	v, err := d.Get(volumeName)
+	if err != nil {
+		return err
+	}
+	// Delete all of the snapshots
+	snapshots, err := v.Snapshots()
+	if err != nil {
+		return err
+	}
+	for _, snapshot := range snapshots {
+		if err := v.RemoveSnapshot(snapshot); err != nil {
+			return err
+		}
+	}
+	// Delete the volume
+	v.(*ReflinkVolume).Lock()
+	defer v.(*ReflinkVolume).Unlock()
+	if err := os.RemoveAll(filepath.Join(d.MetadataDir(), volumeName)); err != nil {
+		return err
+	} else if err := os.RemoveAll(v.Path()); err != nil {
+		glog.Errorf("Could not delete volume %s: %s", volumeName, err)
+		return ErrDeletingVolume
+	}
+	return nil
+}
+
+func (d *ReflinkDriver) poolDir() string {
+	return filepath.Join(d.root, ".reflink")
+}
+
+// MetadataDir returns the path to a volume's metadata directory
+func (d *ReflinkDriver) MetadataDir() string {
+	return filepath.Join(d.poolDir(), "volumes")
+}
+
+// Status implements volume.Driver.Status
+func (d *ReflinkDriver) Status() (volume.Status, error) {
+	glog.V(2).Info("reflink.Status()")
+	label := fmt.Sprintf("%s on %s", d.root, d.root)
+	response := &volume.SimpleStatus{
+		Driver: volume.DriverTypeReflink,
+		UsageData: []volume.Usage{
+			volume.UsageInt{Label: label, Type: "Total Bytes", Value: volume.FilesystemBytesSize(d.root)},
+			volume.UsageInt{Label: label, Type: "Used Bytes", Value: volume.FilesystemBytesUsed(d.root)},
+			volume.UsageInt{Label: label, Type: "Available Bytes", Value: volume.FilesystemBytesAvailable(d.root)},
+		},
+		DriverData: map[string]string{
+			"DataFile": d.root,
+			"Reflinks": fmt.Sprintf("%t", d.cloner.reflinks),
+		},
+		Tenants: d.tenantStats(),
+	}
+	return response, nil
+}
+
+func getTenant(from string) string {
+	parts := strings.Split(from, "_")
+	return parts[0]
+}
+
+// GetTenant implements volume.Driver.GetTenant
+func (d *ReflinkDriver) GetTenant(volumeName string) (volume.Volume, error) {
+	if !d.Exists(volumeName) {
+		return nil, volume.ErrVolumeNotExists
+	}
+	return d.Get(getTenant(volumeName))
+}
+
+// Resize implements volume.Driver.Resize.  Reflink volumes share the space of the
+// host filesystem, so the size is set as a quota on the volume.
+func (d *ReflinkDriver) Resize(volumeName string, size uint64) error {
+	if !d.Exists(volumeName) {
+		return volume.ErrVolumeNotExists
+	}
+	return volume.SetDirectoryQuota(filepath.Join(d.MetadataDir(), volumeName), filepath.Join(d.root, volumeName), volumeName, size)
+}
+
+// tenantStats returns the storage stats of each tenant volume
+func (d *ReflinkDriver) tenantStats() []volume.TenantStorageStats {
+	var result []volume.TenantStorageStats
+	for _, volumeName := range d.List() {
+		if getTenant(volumeName) != volumeName {
+			// this is a snapshot
+			continue
+		}
+		result = append(result, volume.DirectoryTenantStats(filepath.Join(d.MetadataDir(), volumeName), filepath.Join(d.root, volumeName), volumeName))
+	}
+	return result
+}
+
+// Get implements volume.Driver.Get
+func (d *ReflinkDriver) Get(volumeName string) (volume.Volume, error) {
+	volumePath := filepath.Join(d.root, volumeName)
+	volume := &ReflinkVolume{
+		name:   volumeName,
+		path:   volumePath,
+		driver: d,
+		tenant: getTenant(volumeName),
+	}
+	return volume, nil
+}
+
+// Release implements volume.Driver.Release
+func (d *ReflinkDriver) Release(volumeName string) error {
+	// reflink volumes are just a directory; nothing to release
+	return nil
+}
+
+// List implements volume.Driver.List
+func (d *ReflinkDriver) List() (result []string) {
+	files, err := ioutil.ReadDir(d.MetadataDir())
+	if err != nil {
+		glog.Errorf("Error trying to read from root directory: %s", d.root)
+		return
+	}
+	for _, fi := range files {
+		if fi.IsDir() {
+			result = append(result, fi.Name())
+		}
+	}
+	return
+}
+
+// Exists implements volume.Driver.Exists
+func (d *ReflinkDriver) Exists(volumeName string) bool {
+	finfo, err := os.Stat(filepath.Join(d.MetadataDir(), volumeName))
+	if err != nil {
+		return false
+	}
+	return finfo.IsDir()
+}
+
+// Cleanup implements volume.Driver.Cleanup
+func (d *ReflinkDriver) Cleanup() error {
+	// Reflink driver has no hold on system resources
+	return nil
+}
+
+// Name implements volume.Volume.Name
+func (v *ReflinkVolume) Name() string {
+	return v.name
+}
+
+// Path implements volume.Volume.Path
+func (v *ReflinkVolume) Path() string {
+	return v.path
+}
+
+// Driver implements volume.Volume.Driver
+func (v *ReflinkVolume) Driver() volume.Driver {
+	return v.driver
+}
+
+// Tenant implements volume.Volume.Tenant
+func (v *ReflinkVolume) Tenant() string {
+	return v.tenant
+}
+
+// WriteMetadata writes the metadata info for a snapshot on the base volume.
+func (v *ReflinkVolume) WriteMetadata(label, name string) (io.WriteCloser, error) {
+	label = v.rawSnapshotLabel(label)
+	filePath := filepath.Join(v.driver.MetadataDir(), label, name)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil && !os.IsExist(err) {
+		glog.Errorf("Could not create path for file %s: %s", name, err)
+		return nil, err
+	}
+	return os.Create(filePath)
+}
+
+// ReadMetadata reads the metadata info from a snapshot.
+func (v *ReflinkVolume) ReadMetadata(label, name string) (io.ReadCloser, error) {
+	// check the metadata directory first
+	label = v.rawSnapshotLabel(label)
+	filename := filepath.Join(v.driver.MetadataDir(), label, name)
+
+	return os.Open(filename)
+}
+
+func (v *ReflinkVolume) getSnapshotPrefix() string {
+	return v.Tenant() + "_"
+}
+
+// rawSnapshotLabel ensures that <label> has the tenant prefix for this volume
+func (v *ReflinkVolume) rawSnapshotLabel(label string) string {
+	prefix := v.getSnapshotPrefix()
+	if !strings.HasPrefix(label, prefix) {
+		return prefix + label
+	}
+	return label
+}
+
+// prettySnapshotLabel ensures that <label> does not have the tenant prefix for
+func (v *ReflinkVolume) prettySnapshotLabel(rawLabel string) string {
+	return strings.TrimPrefix(rawLabel, v.getSnapshotPrefix())
+}
+
+// snapshotPath gets the path to the directory holding the snapshot <label>
+func (v *ReflinkVolume) snapshotPath(label string) string {
+	root := v.Driver().Root()
+	rawLabel := v.rawSnapshotLabel(label)
+	return filepath.Join(root, rawLabel)
+}
+
+// isSnapshot checks to see if <rawLabel> describes a snapshot (i.e., begins
+// with the tenant prefix)
+func (v *ReflinkVolume) isSnapshot(rawLabel string) bool {
+	return strings.HasPrefix(rawLabel, v.getSnapshotPrefix())
+}
+
+// isInvalidSnapshot checks to see if <rawLabel> describes a snapshot (i.e., begins
+// with the tenant prefix but does NOT have a valid metadata file
+func (v *ReflinkVolume) isInvalidSnapshot(rawLabel string) bool {
+	if strings.HasPrefix(rawLabel, v.getSnapshotPrefix()) {
+		reader, err := v.ReadMetadata(rawLabel, ".SNAPSHOTINFO")
+		if err != nil {
+			return true
+		}
+		reader.Close()
+	}
+	return false
+}
+
+// writeSnapshotInfo writes metadata about a snapshot
+func (v *ReflinkVolume) writeSnapshotInfo(label string, info *volume.SnapshotInfo) error {
+	writer, err := v.WriteMetadata(label, ".SNAPSHOTINFO")
+	if err != nil {
+		glog.Errorf("Could not write meta info for snapshot %s: %s", label, err)
+		return err
+	}
+	defer writer.Close()
+	encoder := json.NewEncoder(writer)
+	if err := encoder.Encode(info); err != nil {
+		glog.Errorf("Could not export meta info for snapshot %s: %s", label, err)
+		return err
+	}
+	return nil
+}
+
+// SnapshotInfo returns the meta info for a snapshot
+func (v *ReflinkVolume) SnapshotInfo(label string) (*volume.SnapshotInfo, error) {
+	if v.isInvalidSnapshot(label) {
+		return nil, volume.ErrInvalidSnapshot
+	}
+
+	reader, err := v.ReadMetadata(label, ".SNAPSHOTINFO")
+	if err != nil {
+		glog.Errorf("Could not get info for snapshot %s: %s", label, err)
+		return nil, err
+	}
+	defer reader.Close()
+	decoder := json.NewDecoder(reader)
+	var info volume.SnapshotInfo
+	if err := decoder.Decode(&info); err != nil {
+		glog.Errorf("Could not decode snapshot info for %s: %s", label, err)
+		return nil, err
+	}
+	return &info, err
+}
+
+// Snapshot implements volume.Volume.Snapshot
+func (v *ReflinkVolume) Snapshot(label, message string, tags []string) (err error) {
+	v.Lock()
+	defer v.Unlock()
+	// does the snapshot already exist
+	label = v.rawSnapshotLabel(label)
+	dest := v.snapshotPath(label)
+	if exists, err := volume.IsDir(dest); exists || err != nil {
+		if exists {
+			glog.Errorf("Snapshot exists: %s", label)
+			return volume.ErrSnapshotExists
+		}
+		return err
+	}
+	// check the tags for duplicates
+	for _, tagName := range tags {
+		if tagInfo, err := v.getSnapshotWithTag(tagName, false); err != volume.ErrSnapshotDoesNotExist {
+			if err != nil {
+				glog.Errorf("Could not look up snapshot for tag %s: %s", tagName, err)
+				return err
+			}
+			glog.Errorf("Tag '%s' is already in use by snapshot %s", tagName, tagInfo.Name)
+			return volume.ErrTagAlreadyExists
+		}
+	}
+	// write snapshot info
+	info := volume.SnapshotInfo{
+		Name:     label,
+		TenantID: v.Tenant(),
+		Label:    v.prettySnapshotLabel(label),
+		Tags:     tags,
+		Message:  message,
+		Created:  time.Now(),
+	}
+	if err := v.writeSnapshotInfo(label, &info); err != nil {
+		return err
+	}
+	// clone the volume
+	glog.Infof("Cloning %s to snapshot %s", v.Path(), dest)
+	if err := os.Mkdir(dest, 0755); err != nil {
+		return err
+	}
+	if err := v.driver.cloner.CloneTree(v.Path(), dest); err != nil {
+		glog.Errorf("Could not clone volume %s to snapshot %s: %s", v.Name(), label, err)
+		os.RemoveAll(dest)
+		os.RemoveAll(filepath.Join(v.driver.MetadataDir(), label))
+		return err
+	}
+	return nil
+}
+
+// TagSnapshot implements volume.Volume.TagSnapshot
+func (v *ReflinkVolume) TagSnapshot(label, tagName string) error {
+	v.Lock()
+	defer v.Unlock()
+	// get the snapshot
+	info, err := v.SnapshotInfo(label)
+	if err != nil {
+		glog.Errorf("Could not look up snapshot %s: %s", label, err)
+		return err
+	}
+	// verify the tag doesn't already exist
+	if tagInfo, err := v.getSnapshotWithTag(tagName, false); err != volume.ErrSnapshotDoesNotExist {
+		if err != nil {
+			glog.Errorf("Could not look up snapshot for tag %s: %s", tagName, err)
+			return err
+		} else {
+			glog.Errorf("Tag '%s' is already in use by snapshot %s", tagName, tagInfo.Name)
+			return volume.ErrTagAlreadyExists
+		}
+	}
+	// add the tag and update the snapshot
+	info.Tags = append(info.Tags, tagName)
+	if err := v.writeSnapshotInfo(info.Label, info); err != nil {
+		glog.Errorf("Could not update tags for snapshot %s: %s", info.Label, err)
+		return err
+	}
+	return nil
+}
+
+// UntagSnapshot implements volume.Volume.UntagSnapshot
+func (v *ReflinkVolume) UntagSnapshot(tagName string) (string, error) {
+	v.Lock()
+	defer v.Unlock()
+	// find the snapshot with the provided tag
+	info, err := v.getSnapshotWithTag(tagName, false)
+	if err != nil {
+		glog.Errorf("Could not find snapshot with tag %s: %s", tagName, err)
+		return "", err
+	}
+	// remove the tag and update the snapshot
+	var tags []string
+	for _, tag := range info.Tags {
+		if tag != tagName {
+			tags = append(tags, tag)
+		}
+	}
+	info.Tags = tags
+	if err := v.writeSnapshotInfo(info.Label, info); err != nil {
+		glog.Errorf("Could not remove tag '%s' from snapshot %s: %s", tagName, info.Name, err)
+		return "", err
+	}
+	return info.Label, err
+}
+
+// GetSnapshotWithTag implements volume.Volume.GetSnapshotWithTag
+func (v *ReflinkVolume) GetSnapshotWithTag(tagName string) (*volume.SnapshotInfo, error) {
+	return v.getSnapshotWithTag(tagName, true)
+}
+
+// Snapshots implements volume.Volume.Snapshots
+func (v *ReflinkVolume) Snapshots() ([]string, error) {
+	v.Lock()
+	defer v.Unlock()
+	return v.getSnapshotList()
+}
+
+// getSnapshotWithTag internal impl without locking calls
+func (v *ReflinkVolume) getSnapshotWithTag(tagName string, lock bool) (*volume.SnapshotInfo, error) {
+	// Get all snapshots on the volume
+	var err error
+	var snapshotLabels []string
+	if lock {
+		snapshotLabels, err = v.Snapshots()
+	} else {
+		snapshotLabels, err = v.getSnapshotList()
+	}
+
+	if err != nil {
+		glog.Errorf("Could not get current snapshot list: %s", err)
+		return nil, err
+	}
+	// Get info for each snapshot and return if a matching tag is found
+	for _, snapshotLabel := range snapshotLabels {
+		if info, err := v.SnapshotInfo(snapshotLabel); err != volume.ErrInvalidSnapshot {
+			if err != nil {
+				glog.Errorf("Could not get info for snaphot %s: %s", snapshotLabel, err)
+				return nil, err
+			}
+			for _, tag := range info.Tags {
+				if tag == tagName {
+					return info, nil
+				}
+			}
+		}
+	}
+	return nil, volume.ErrSnapshotDoesNotExist
+}
+
+// Internal method for retrieving the snapshot list without obtaining a lock.  Assumes caller has already obtained a lock on the volume.
+func (v *ReflinkVolume) getSnapshotList() ([]string, error) {
+	files, err := ioutil.ReadDir(v.driver.MetadataDir())
+	if err != nil {
+		return nil, err
+	}
+	var labels []string
+	for _, file := range files {
+		fh, err := os.Stat(v.snapshotPath(file.Name()))
+		if err != nil {
+			glog.Info(err)
+			continue
+		}
+		if file.IsDir() && v.isSnapshot(file.Name()) && fh.IsDir() {
+			labels = append(labels, file.Name())
+		}
+	}
+
+	return labels, nil
+}
+
+// RemoveSnapshot implements volume.Volume.RemoveSnapshot
+func (v *ReflinkVolume) RemoveSnapshot(label string) error {
+	v.Lock()
+	defer v.Unlock()
+	label = v.rawSnapshotLabel(label)
+	dest := v.snapshotPath(label)
+	if exists, _ := volume.IsDir(dest); !exists {
+		return volume.ErrSnapshotDoesNotExist
+	}
+	if err := os.RemoveAll(filepath.Join(v.driver.MetadataDir(), label)); err != nil {
+		return err
+	} else if err := os.RemoveAll(dest); err != nil {
+		glog.Errorf("Could not remove snapshot %s: %s", label, err)
+		return volume.ErrRemovingSnapshot
+	}
+	return nil
+}
+
+// Rollback implements volume.Volume.Rollback
+func (v *ReflinkVolume) Rollback(label string) (err error) {
+	if v.isInvalidSnapshot(label) {
+		return volume.ErrInvalidSnapshot
+	}
+
+	v.Lock()
+	defer v.Unlock()
+	src := v.snapshotPath(label)
+	if exists, err := volume.IsDir(src); !exists || err != nil {
+		if !exists {
+			return volume.ErrSnapshotDoesNotExist
+		}
+		return err
+	}
+	// replace the contents of the volume in place, so that containers that
+	// have the volume mounted see the rollback.
+	glog.Infof("Rolling back %s to snapshot %s", v.Path(), src)
+	if err := clearDirectory(v.Path()); err != nil {
+		glog.Errorf("Could not clear volume %s: %s", v.Name(), err)
+		return err
+	}
+	if err := v.driver.cloner.CloneTree(src, v.Path()); err != nil {
+		glog.Errorf("Could not clone snapshot %s to volume %s: %s", label, v.Name(), err)
+		return err
+	}
+	return nil
+}
+
+// Export implements volume.Volume.Export
+func (v *ReflinkVolume) Export(label, parent string, writer io.Writer, excludes []string) error {
+	if len(excludes) > 0 {
+		glog.Warning("reflink backups do not support excluding directories")
+	}
+	v.Lock()
+	defer v.Unlock()
+	if label = strings.TrimSpace(label); label == "" {
+		glog.Errorf("%s: label cannot be empty", volume.DriverTypeReflink)
+		return ErrReflinkInvalidLabel
+	}
+	label = v.rawSnapshotLabel(label)
+	tarfile := tar.NewWriter(writer)
+	defer tarfile.Close()
+	// Set the driver type
+	header := &tar.Header{Name: fmt.Sprintf("%s-driver", label), Size: int64(len([]byte(v.Driver().DriverType())))}
+	if err := tarfile.WriteHeader(header); err != nil {
+		glog.Errorf("Could not export driver type header: %s", err)
+		return err
+	}
+	if _, err := fmt.Fprint(tarfile, v.Driver().DriverType()); err != nil {
+		glog.Errorf("Could not export driver type: %s", err)
+		return err
+	}
+	// write metadata
+	mdpath := filepath.Join(v.driver.MetadataDir(), label)
+	if err := volume.ExportDirectory(tarfile, mdpath, fmt.Sprintf("%s-metadata", label)); err != nil {
+		return err
+	}
+	// write volume
+	volpath := v.snapshotPath(label)
+	if err := volume.ExportDirectory(tarfile, volpath, fmt.Sprintf("%s-volume", label)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SnapshotDir implements volume.SnapshotDirVolume
+func (v *ReflinkVolume) SnapshotDir(label string) (string, error) {
+	path := v.snapshotPath(label)
+	if exists, err := volume.IsDir(path); err != nil {
+		return "", err
+	} else if !exists {
+		return "", volume.ErrSnapshotDoesNotExist
+	}
+	return path, nil
+}
+
+// Import implements volume.Volume.Import
+func (v *ReflinkVolume) Import(label string, reader io.Reader) error {
+	v.Lock()
+	defer v.Unlock()
+	label = v.rawSnapshotLabel(label)
+	if exists, err := volume.IsDir(v.snapshotPath(label)); err != nil {
+		return err
+	} else if exists {
+		return volume.ErrSnapshotExists
+	}
+	driverfile := fmt.Sprintf("%s-driver", label)
+	volumedir := fmt.Sprintf("%s-volume", label)
+	metadatadir := fmt.Sprintf("%s-metadata", label)
+	var drivertype string
+	tarfile := tar.NewReader(reader)
+	for {
+		header, err := tarfile.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			glog.Errorf("Could not import archive: %s", err)
+			return err
+		}
+		if header.Name == driverfile {
+			buf := bytes.NewBufferString("")
+			if _, err := buf.ReadFrom(tarfile); err != nil {
+				return err
+			}
+			drivertype = buf.String()
+		} else if strings.HasPrefix(header.Name, volumedir) {
+			header.Name = strings.Replace(header.Name, volumedir, label, 1)
+			if err := volume.ImportArchiveHeader(header, tarfile, v.driver.Root()); err != nil {
+				return err
+			}
+		} else if strings.HasPrefix(header.Name, metadatadir) {
+			header.Name = strings.Replace(header.Name, metadatadir, label, 1)
+			if err := volume.ImportArchiveHeader(header, tarfile, v.driver.MetadataDir()); err != nil {
+				return err
+			}
+		}
+	}
+	if drivertype == "" {
+		return errors.New("incompatible snapshot")
+	}
+	return nil
+}
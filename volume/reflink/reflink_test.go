@@ -0,0 +1,75 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build root,integration
+
+package reflink_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/control-center/serviced/volume"
+	"github.com/control-center/serviced/volume/drivertest"
+	// Register the reflink driver
+	_ "github.com/control-center/serviced/volume/reflink"
+)
+
+var (
+	reflinkArgs []string = make([]string, 0)
+)
+
+// Wire in gocheck
+func Test(t *testing.T) { TestingT(t) }
+
+type ReflinkSuite struct{}
+
+var _ = Suite(&ReflinkSuite{})
+
+func (s *ReflinkSuite) TestReflinkCreateEmpty(c *C) {
+	drivertest.DriverTestCreateEmpty(c, "reflink", "", reflinkArgs)
+}
+
+func (s *ReflinkSuite) TestReflinkCreateBase(c *C) {
+	drivertest.DriverTestCreateBase(c, "reflink", "", reflinkArgs)
+}
+
+func (s *ReflinkSuite) TestReflinkSnapshots(c *C) {
+	drivertest.DriverTestSnapshots(c, "reflink", "", reflinkArgs)
+}
+
+func (s *ReflinkSuite) TestReflinkSnapshotTags(c *C) {
+	drivertest.DriverTestSnapshotTags(c, "reflink", "", reflinkArgs)
+}
+
+func (s *ReflinkSuite) TestReflinkExportImport(c *C) {
+	drivertest.DriverTestExportImport(c, "reflink", "", "", reflinkArgs)
+}
+
+func (s *ReflinkSuite) TestReflinkBadSnapshots(c *C) {
+	badsnapshot := func(label string, vol volume.Volume) error {
+		//create an invalid snapshot by snapshotting and then removing .SnapshotInfo
+		if err := vol.Snapshot(label, "", []string{}); err != nil {
+			return err
+		}
+		filePath := filepath.Join(vol.Driver().Root(), ".reflink", "volumes", fmt.Sprintf("%s_%s", vol.Name(), label), ".SNAPSHOTINFO")
+		err := os.Remove(filePath)
+		return err
+	}
+
+	drivertest.DriverTestBadSnapshot(c, "reflink", "", badsnapshot, reflinkArgs)
+}
@@ -213,6 +213,7 @@ func (d *RsyncDriver) Status() (volume.Status, error) {
 		Driver:     volume.DriverTypeRsync,
 		UsageData:  dfResult,
 		DriverData: map[string]string{"DataFile": d.root},
+		Tenants:    d.tenantStats(),
 	}
 
 	return response, nil
@@ -231,9 +232,26 @@ func (d *RsyncDriver) GetTenant(volumeName string) (volume.Volume, error) {
 	return d.Get(getTenant(volumeName))
 }
 
-// Resize implements volume.Driver.Resize. For rsync it's a noop.
+// Resize implements volume.Driver.Resize.  Rsync volumes share the space of the
+// host filesystem, so the size is set as a quota on the volume.
 func (d *RsyncDriver) Resize(volumeName string, size uint64) error {
-	return nil
+	if !d.Exists(volumeName) {
+		return volume.ErrVolumeNotExists
+	}
+	return volume.SetDirectoryQuota(filepath.Join(d.MetadataDir(), volumeName), filepath.Join(d.root, volumeName), volumeName, size)
+}
+
+// tenantStats returns the storage stats of each tenant volume
+func (d *RsyncDriver) tenantStats() []volume.TenantStorageStats {
+	var result []volume.TenantStorageStats
+	for _, volumeName := range d.List() {
+		if getTenant(volumeName) != volumeName {
+			// this is a snapshot
+			continue
+		}
+		result = append(result, volume.DirectoryTenantStats(filepath.Join(d.MetadataDir(), volumeName), filepath.Join(d.root, volumeName), volumeName))
+	}
+	return result
 }
 
 // Get implements volume.Driver.Get
@@ -685,6 +703,17 @@ func (v *RsyncVolume) Export(label, parent string, writer io.Writer, excludes []
 	return nil
 }
 
+// SnapshotDir implements volume.SnapshotDirVolume
+func (v *RsyncVolume) SnapshotDir(label string) (string, error) {
+	path := v.snapshotPath(label)
+	if exists, err := volume.IsDir(path); err != nil {
+		return "", err
+	} else if !exists {
+		return "", volume.ErrSnapshotDoesNotExist
+	}
+	return path, nil
+}
+
 // Import implements volume.Volume.Import
 func (v *RsyncVolume) Import(label string, reader io.Reader) error {
 	v.Lock()
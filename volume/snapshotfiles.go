@@ -0,0 +1,436 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package volume
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zenoss/glog"
+)
+
+var (
+	ErrSnapshotPathNotFound = errors.New("path does not exist in snapshot")
+	ErrInvalidSnapshotPath  = errors.New("a path within the volume is required")
+	ErrSnapshotPathSymlink  = errors.New("a parent of the path is a symlink")
+	errStopWalk             = errors.New("stop walking snapshot")
+)
+
+// The kinds of changes to a file between two snapshots
+const (
+	FileAdded    = "added"
+	FileModified = "modified"
+	FileRemoved  = "removed"
+)
+
+// SnapshotFile describes a file in a snapshot.  Path is relative to the root
+// of the volume.
+type SnapshotFile struct {
+	Path    string
+	Mode    os.FileMode
+	Size    int64
+	ModTime time.Time
+	Link    string `json:",omitempty"`
+	Digest  string `json:",omitempty"` // sha256 of the contents of a regular file
+}
+
+// SnapshotChange describes a file that differs between two snapshots
+type SnapshotChange struct {
+	Path    string
+	Change  string
+	OldSize int64
+	NewSize int64
+}
+
+// SnapshotDirVolume is implemented by volumes that keep the files of each
+// snapshot in a directory that can be read in place.
+type SnapshotDirVolume interface {
+	// SnapshotDir returns the directory holding the files of snapshot <label>
+	SnapshotDir(label string) (string, error)
+}
+
+// The files of a snapshot are read from its directory if the volume has one,
+// or otherwise from its export, which has the same layout for every driver,
+// so these work for any Volume.
+
+// walkSnapshot calls fn with each file of a snapshot that is p or within p,
+// parents before their contents.  The files within a directory are skipped if
+// fn returns filepath.SkipDir for it, and the walk stops without an error if
+// fn returns errStopWalk.
+func walkSnapshot(vol Volume, label, p string, fn func(name string, header *tar.Header, r io.Reader) error) error {
+	if dirvol, ok := vol.(SnapshotDirVolume); ok {
+		dir, err := dirvol.SnapshotDir(label)
+		if err != nil {
+			return err
+		}
+		return walkSnapshotDir(dir, p, fn)
+	}
+	var skipped []string
+	return walkExport(vol, label, func(header *tar.Header, r io.Reader) error {
+		name, ok := snapshotVolumePath(header.Name)
+		if !ok || !isUnder(name, p) {
+			return nil
+		}
+		for _, s := range skipped {
+			if name != s && isUnder(name, s) {
+				return nil
+			}
+		}
+		err := fn(name, header, r)
+		if err == filepath.SkipDir {
+			skipped = append(skipped, name)
+			return nil
+		}
+		return err
+	})
+}
+
+// walkSnapshotDir calls fn with each file that is p or within p in the
+// directory of a snapshot.  Symlinks in the snapshot are never followed.
+func walkSnapshotDir(dir, p string, fn func(name string, header *tar.Header, r io.Reader) error) error {
+	if err := checkParents(dir, p, false); os.IsNotExist(err) || err == ErrSnapshotPathSymlink || err == ErrNotADirectory {
+		// the path is not in the snapshot, as in its export
+		return nil
+	} else if err != nil {
+		return err
+	}
+	root := filepath.Join(dir, p)
+	err := filepath.Walk(root, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if fpath == root && os.IsNotExist(err) {
+				return nil
+			}
+			glog.Errorf("Could not read %s: %s", fpath, err)
+			return err
+		}
+		// sockets, pipes and devices are not exported
+		if fi.Mode()&(os.ModeSocket|os.ModeNamedPipe|os.ModeDevice) != 0 {
+			return nil
+		}
+		var link string
+		if isSymLink(fi) {
+			if link, err = os.Readlink(fpath); err != nil {
+				glog.Errorf("Could not read link %s: %s", fpath, err)
+				return err
+			}
+		}
+		rel, err := filepath.Rel(dir, fpath)
+		if err != nil {
+			return err
+		}
+		name := cleanSnapshotPath(filepath.ToSlash(rel))
+		header, err := getHeader(name, link, fi)
+		if err != nil {
+			glog.Errorf("Could not create file header %s: %s", fpath, err)
+			return err
+		}
+		r := &lazyFile{path: fpath}
+		defer r.Close()
+		return fn(name, header, r)
+	})
+	if err == errStopWalk {
+		return nil
+	}
+	return err
+}
+
+// lazyFile opens a file the first time it is read, so that walking a
+// snapshot only opens the files whose contents are needed.
+type lazyFile struct {
+	path string
+	file *os.File
+}
+
+func (f *lazyFile) Read(b []byte) (int, error) {
+	if f.file == nil {
+		file, err := os.Open(f.path)
+		if err != nil {
+			return 0, err
+		}
+		f.file = file
+	}
+	return f.file.Read(b)
+}
+
+func (f *lazyFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+
+// checkParents returns ErrSnapshotPathSymlink if a directory between root and
+// p is a symlink, so that p cannot resolve outside of root.  Directories that
+// do not exist are created if create is true.
+func checkParents(root, p string, create bool) error {
+	parent := root
+	for _, part := range strings.Split(path.Dir("/"+p), "/")[1:] {
+		if part == "" {
+			continue
+		}
+		parent = filepath.Join(parent, part)
+		fi, err := os.Lstat(parent)
+		if os.IsNotExist(err) && create {
+			if err := os.Mkdir(parent, 0755); err != nil {
+				glog.Errorf("Could not create directory %s: %s", parent, err)
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		if isSymLink(fi) {
+			return ErrSnapshotPathSymlink
+		} else if !fi.IsDir() {
+			return ErrNotADirectory
+		}
+	}
+	return nil
+}
+
+// walkExport calls fn with each entry of the export of a snapshot.  The walk
+// stops without an error if fn returns errStopWalk.
+func walkExport(vol Volume, label string, fn func(header *tar.Header, r io.Reader) error) error {
+	r, w := io.Pipe()
+	exported := make(chan error, 1)
+	go func() {
+		err := vol.Export(label, "", w, []string{})
+		w.CloseWithError(err)
+		exported <- err
+	}()
+	err := readExport(tar.NewReader(r), fn)
+	// unblock the export if the walk ended early
+	r.CloseWithError(errStopWalk)
+	exportErr := <-exported
+	if err == errStopWalk {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if exportErr != nil {
+		glog.Errorf("Could not export snapshot %s: %s", label, exportErr)
+	}
+	return exportErr
+}
+
+func readExport(tarfile *tar.Reader, fn func(header *tar.Header, r io.Reader) error) error {
+	for {
+		header, err := tarfile.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(header, tarfile); err != nil {
+			return err
+		}
+	}
+}
+
+// snapshotVolumePath returns the path relative to the root of the volume of
+// an entry in a snapshot export, which are named <label>-volume/<path>.
+func snapshotVolumePath(entry string) (string, bool) {
+	parts := strings.SplitN(path.Clean(entry), "/", 2)
+	if !strings.HasSuffix(parts[0], "-volume") {
+		return "", false
+	}
+	if len(parts) == 2 {
+		return cleanSnapshotPath(parts[1]), true
+	}
+	return "", true
+}
+
+// cleanSnapshotPath returns a path relative to the root of the volume
+func cleanSnapshotPath(p string) string {
+	return strings.Trim(path.Clean("/"+p), "/")
+}
+
+// isUnder returns true if name is p or is within p
+func isUnder(name, p string) bool {
+	return p == "" || name == p || strings.HasPrefix(name, p+"/")
+}
+
+func newSnapshotFile(name string, header *tar.Header) SnapshotFile {
+	file := SnapshotFile{
+		Path:    name,
+		Mode:    header.FileInfo().Mode(),
+		Size:    header.Size,
+		ModTime: header.ModTime,
+		Link:    header.Linkname,
+	}
+	// hard links name another entry of the export
+	if header.Typeflag == tar.TypeLink {
+		file.Link, _ = snapshotVolumePath(header.Linkname)
+	}
+	return file
+}
+
+// fileChanged returns true if the contents, mode or link target of a file
+// differ between two snapshots
+func fileChanged(old, file SnapshotFile) bool {
+	return file.Mode != old.Mode || file.Link != old.Link || file.Digest != old.Digest
+}
+
+// ListSnapshotFiles returns the files in a directory of a snapshot, or the
+// file itself if the path is not a directory.
+func ListSnapshotFiles(vol Volume, label, p string) ([]SnapshotFile, error) {
+	p = cleanSnapshotPath(p)
+	var files []SnapshotFile
+	var found bool
+	err := walkSnapshot(vol, label, p, func(name string, header *tar.Header, _ io.Reader) error {
+		if name == p {
+			found = true
+			if header.Typeflag != tar.TypeDir {
+				files = append(files, newSnapshotFile(name, header))
+			}
+		} else if path.Dir("/"+name) == "/"+p {
+			files = append(files, newSnapshotFile(name, header))
+			if header.Typeflag == tar.TypeDir {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	} else if !found {
+		return nil, ErrSnapshotPathNotFound
+	}
+	sort.Sort(snapshotFilesByPath(files))
+	return files, nil
+}
+
+type snapshotFilesByPath []SnapshotFile
+
+func (s snapshotFilesByPath) Len() int           { return len(s) }
+func (s snapshotFilesByPath) Less(i, j int) bool { return s[i].Path < s[j].Path }
+func (s snapshotFilesByPath) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// snapshotFiles returns all of the files under a path of a snapshot, with
+// the digests of regular files.
+func snapshotFiles(vol Volume, label, p string) (map[string]SnapshotFile, error) {
+	files := make(map[string]SnapshotFile)
+	err := walkSnapshot(vol, label, p, func(name string, header *tar.Header, r io.Reader) error {
+		if name == "" {
+			return nil
+		}
+		file := newSnapshotFile(name, header)
+		if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA {
+			h := sha256.New()
+			if _, err := io.Copy(h, r); err != nil {
+				return err
+			}
+			file.Digest = hex.EncodeToString(h.Sum(nil))
+		}
+		files[name] = file
+		return nil
+	})
+	return files, err
+}
+
+// DiffSnapshotFiles returns the files under a path that were added, modified
+// or removed between two snapshots of a volume.  Only the contents, mode and
+// link targets of files are compared.
+func DiffSnapshotFiles(vol Volume, fromLabel, toLabel, p string) ([]SnapshotChange, error) {
+	p = cleanSnapshotPath(p)
+	from, err := snapshotFiles(vol, fromLabel, p)
+	if err != nil {
+		return nil, err
+	}
+	to, err := snapshotFiles(vol, toLabel, p)
+	if err != nil {
+		return nil, err
+	}
+	var changes []SnapshotChange
+	for name, old := range from {
+		file, ok := to[name]
+		if !ok {
+			changes = append(changes, SnapshotChange{Path: name, Change: FileRemoved, OldSize: old.Size})
+		} else if fileChanged(old, file) {
+			changes = append(changes, SnapshotChange{Path: name, Change: FileModified, OldSize: old.Size, NewSize: file.Size})
+		}
+	}
+	for name, file := range to {
+		if _, ok := from[name]; !ok {
+			changes = append(changes, SnapshotChange{Path: name, Change: FileAdded, NewSize: file.Size})
+		}
+	}
+	sort.Sort(snapshotChangesByPath(changes))
+	return changes, nil
+}
+
+type snapshotChangesByPath []SnapshotChange
+
+func (s snapshotChangesByPath) Len() int           { return len(s) }
+func (s snapshotChangesByPath) Less(i, j int) bool { return s[i].Path < s[j].Path }
+func (s snapshotChangesByPath) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// RestoreSnapshotPath copies a file or directory from a snapshot into the
+// directory dest, at the same path relative to dest as it had in the volume.
+// Files that exist in dest are replaced; files that are not in the snapshot
+// are kept.  Symlinks in dest are replaced rather than followed, and the
+// restore fails with ErrSnapshotPathSymlink if a parent of the path in dest is
+// a symlink.  Returns the number of files that were restored.
+func RestoreSnapshotPath(vol Volume, label, p, dest string) (int, error) {
+	if p = cleanSnapshotPath(p); p == "" {
+		return 0, ErrInvalidSnapshotPath
+	}
+	if err := checkParents(dest, p, true); err != nil {
+		glog.Errorf("Could not create directory for %s in %s: %s", p, dest, err)
+		return 0, err
+	}
+	count := 0
+	err := walkSnapshot(vol, label, p, func(name string, header *tar.Header, r io.Reader) error {
+		// the parents were restored before their contents, but may have
+		// been replaced since
+		if err := checkParents(dest, name, false); err != nil {
+			glog.Errorf("Could not restore %s in %s: %s", name, dest, err)
+			return err
+		}
+		target := filepath.Join(dest, name)
+		// replace anything in the way, unless it is a directory being
+		// restored as a directory
+		if fi, err := os.Lstat(target); err == nil && !(fi.IsDir() && header.Typeflag == tar.TypeDir) {
+			if err := os.RemoveAll(target); err != nil {
+				glog.Errorf("Could not remove %s: %s", target, err)
+				return err
+			}
+		}
+		hdr := *header
+		hdr.Name = name
+		if err := ImportArchiveHeader(&hdr, r, dest); err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeSymlink {
+			os.Chtimes(target, time.Now(), header.ModTime)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, err
+	} else if count == 0 {
+		return 0, ErrSnapshotPathNotFound
+	}
+	return count, nil
+}
@@ -0,0 +1,282 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package volume_test
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/control-center/serviced/volume"
+	"github.com/control-center/serviced/volume/mocks"
+	"github.com/stretchr/testify/mock"
+	. "gopkg.in/check.v1"
+)
+
+type SnapshotFilesSuite struct{}
+
+var _ = Suite(&SnapshotFilesSuite{})
+
+type testFile struct {
+	name    string
+	content string
+	dir     bool
+}
+
+// exportSnapshot returns an export function that writes the files in the
+// layout of a snapshot export.
+func exportSnapshot(label string, files ...testFile) func(string, string, io.Writer) error {
+	return func(_, _ string, w io.Writer) error {
+		tarfile := tar.NewWriter(w)
+		defer tarfile.Close()
+		driver := "rsync"
+		tarfile.WriteHeader(&tar.Header{Name: label + "-driver", Size: int64(len(driver)), Typeflag: tar.TypeReg})
+		tarfile.Write([]byte(driver))
+		tarfile.WriteHeader(&tar.Header{Name: label + "-metadata", Mode: 0755, Typeflag: tar.TypeDir})
+		tarfile.WriteHeader(&tar.Header{Name: label + "-volume", Mode: 0755, Typeflag: tar.TypeDir})
+		for _, f := range files {
+			hdr := &tar.Header{Name: label + "-volume/" + f.name, ModTime: time.Unix(1500000000, 0)}
+			if f.dir {
+				hdr.Mode, hdr.Typeflag = 0755, tar.TypeDir
+			} else {
+				hdr.Mode, hdr.Typeflag, hdr.Size = 0644, tar.TypeReg, int64(len(f.content))
+			}
+			if err := tarfile.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := tarfile.Write([]byte(f.content)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (s *SnapshotFilesSuite) volume() *mocks.Volume {
+	vol := &mocks.Volume{}
+	vol.On("Export", "snapA", "", mock.Anything).Return(exportSnapshot("tenant_snapA",
+		testFile{name: "etc", dir: true},
+		testFile{name: "etc/a.conf", content: "a"},
+		testFile{name: "etc/b.conf", content: "b"},
+		testFile{name: "etc/sub", dir: true},
+		testFile{name: "etc/sub/c.conf", content: "c"},
+		testFile{name: "data", dir: true},
+	))
+	// devicemapper exports prefix the paths with ./
+	vol.On("Export", "snapB", "", mock.Anything).Return(exportSnapshot("tenant_snapB",
+		testFile{name: "./etc", dir: true},
+		testFile{name: "./etc/a.conf", content: "a"},
+		testFile{name: "./etc/b.conf", content: "bigger"},
+		testFile{name: "./data", dir: true},
+		testFile{name: "./data/d", content: "d"},
+	))
+	vol.On("Export", "missing", "", mock.Anything).Return(ErrSnapshotDoesNotExist)
+	return vol
+}
+
+func (s *SnapshotFilesSuite) TestListSnapshotFiles(c *C) {
+	vol := s.volume()
+	files, err := ListSnapshotFiles(vol, "snapA", "")
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 2)
+	c.Check(files[0].Path, Equals, "data")
+	c.Check(files[0].Mode.IsDir(), Equals, true)
+	c.Check(files[1].Path, Equals, "etc")
+
+	files, err = ListSnapshotFiles(vol, "snapA", "/etc/")
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 3)
+	c.Check(files[0].Path, Equals, "etc/a.conf")
+	c.Check(files[0].Size, Equals, int64(1))
+	c.Check(files[2].Path, Equals, "etc/sub")
+
+	files, err = ListSnapshotFiles(vol, "snapB", "etc/b.conf")
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 1)
+	c.Check(files[0].Size, Equals, int64(6))
+
+	_, err = ListSnapshotFiles(vol, "snapA", "nothere")
+	c.Check(err, Equals, ErrSnapshotPathNotFound)
+	_, err = ListSnapshotFiles(vol, "missing", "")
+	c.Check(err, Equals, ErrSnapshotDoesNotExist)
+}
+
+func (s *SnapshotFilesSuite) TestDiffSnapshotFiles(c *C) {
+	vol := s.volume()
+	changes, err := DiffSnapshotFiles(vol, "snapA", "snapB", "")
+	c.Assert(err, IsNil)
+	c.Check(changes, DeepEquals, []SnapshotChange{
+		{Path: "data/d", Change: FileAdded, NewSize: 1},
+		{Path: "etc/b.conf", Change: FileModified, OldSize: 1, NewSize: 6},
+		{Path: "etc/sub", Change: FileRemoved},
+		{Path: "etc/sub/c.conf", Change: FileRemoved, OldSize: 1},
+	})
+
+	changes, err = DiffSnapshotFiles(vol, "snapA", "snapB", "data")
+	c.Assert(err, IsNil)
+	c.Check(changes, DeepEquals, []SnapshotChange{
+		{Path: "data/d", Change: FileAdded, NewSize: 1},
+	})
+}
+
+func (s *SnapshotFilesSuite) TestRestoreSnapshotPath(c *C) {
+	vol := s.volume()
+	dest := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(dest, "etc"), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dest, "etc", "a.conf"), []byte("changed"), 0600), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dest, "etc", "new.conf"), []byte("new"), 0600), IsNil)
+
+	count, err := RestoreSnapshotPath(vol, "snapA", "etc", dest)
+	c.Assert(err, IsNil)
+	c.Check(count, Equals, 5)
+	data, err := ioutil.ReadFile(filepath.Join(dest, "etc", "a.conf"))
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "a")
+	data, err = ioutil.ReadFile(filepath.Join(dest, "etc", "sub", "c.conf"))
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "c")
+	// files that are not in the snapshot are kept
+	_, err = os.Stat(filepath.Join(dest, "etc", "new.conf"))
+	c.Check(err, IsNil)
+	// files outside of the path are not restored
+	_, err = os.Stat(filepath.Join(dest, "data"))
+	c.Check(os.IsNotExist(err), Equals, true)
+
+	// restore a single file into a new directory
+	dest = c.MkDir()
+	count, err = RestoreSnapshotPath(vol, "snapB", "/etc/b.conf", dest)
+	c.Assert(err, IsNil)
+	c.Check(count, Equals, 1)
+	data, err = ioutil.ReadFile(filepath.Join(dest, "etc", "b.conf"))
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "bigger")
+
+	_, err = RestoreSnapshotPath(vol, "snapB", "nothere", dest)
+	c.Check(err, Equals, ErrSnapshotPathNotFound)
+	_, err = RestoreSnapshotPath(vol, "snapB", "/", dest)
+	c.Check(err, Equals, ErrInvalidSnapshotPath)
+}
+
+func (s *SnapshotFilesSuite) TestRestoreSnapshotPathSymlinks(c *C) {
+	vol := s.volume()
+	outside := c.MkDir()
+
+	// a parent of the path is a symlink
+	dest := c.MkDir()
+	c.Assert(os.Symlink(outside, filepath.Join(dest, "etc")), IsNil)
+	_, err := RestoreSnapshotPath(vol, "snapA", "etc/a.conf", dest)
+	c.Check(err, Equals, ErrSnapshotPathSymlink)
+	_, err = os.Lstat(filepath.Join(outside, "a.conf"))
+	c.Check(os.IsNotExist(err), Equals, true)
+
+	// symlinks within the path are replaced
+	dest = c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(dest, "etc"), 0755), IsNil)
+	c.Assert(os.Symlink(outside, filepath.Join(dest, "etc", "sub")), IsNil)
+	c.Assert(os.Symlink(filepath.Join(outside, "b.conf"), filepath.Join(dest, "etc", "b.conf")), IsNil)
+	count, err := RestoreSnapshotPath(vol, "snapA", "etc", dest)
+	c.Assert(err, IsNil)
+	c.Check(count, Equals, 5)
+	fi, err := os.Lstat(filepath.Join(dest, "etc", "sub"))
+	c.Assert(err, IsNil)
+	c.Check(fi.IsDir(), Equals, true)
+	fi, err = os.Lstat(filepath.Join(dest, "etc", "b.conf"))
+	c.Assert(err, IsNil)
+	c.Check(fi.Mode().IsRegular(), Equals, true)
+	files, err := ioutil.ReadDir(outside)
+	c.Assert(err, IsNil)
+	c.Check(files, HasLen, 0)
+}
+
+// dirVolume keeps its snapshots in directories
+type dirVolume struct {
+	*mocks.Volume
+	dirs map[string]string
+}
+
+func (v *dirVolume) SnapshotDir(label string) (string, error) {
+	if dir, ok := v.dirs[label]; ok {
+		return dir, nil
+	}
+	return "", ErrSnapshotDoesNotExist
+}
+
+func writeSnapshotDir(c *C, files ...testFile) string {
+	dir := c.MkDir()
+	for _, f := range files {
+		if f.dir {
+			c.Assert(os.MkdirAll(filepath.Join(dir, f.name), 0755), IsNil)
+		} else {
+			c.Assert(ioutil.WriteFile(filepath.Join(dir, f.name), []byte(f.content), 0644), IsNil)
+		}
+	}
+	return dir
+}
+
+func (s *SnapshotFilesSuite) TestSnapshotDir(c *C) {
+	outside := c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0600), IsNil)
+	snapA := writeSnapshotDir(c,
+		testFile{name: "etc", dir: true},
+		testFile{name: "etc/a.conf", content: "a"},
+		testFile{name: "etc/sub", dir: true},
+		testFile{name: "etc/sub/c.conf", content: "c"},
+	)
+	c.Assert(os.Symlink(outside, filepath.Join(snapA, "etc", "host")), IsNil)
+	snapB := writeSnapshotDir(c,
+		testFile{name: "etc", dir: true},
+		testFile{name: "etc/a.conf", content: "changed"},
+	)
+	// the volume is never exported
+	vol := &dirVolume{Volume: &mocks.Volume{}, dirs: map[string]string{"snapA": snapA, "snapB": snapB}}
+
+	files, err := ListSnapshotFiles(vol, "snapA", "etc")
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 3)
+	c.Check(files[0].Path, Equals, "etc/a.conf")
+	c.Check(files[1].Path, Equals, "etc/host")
+	c.Check(files[1].Link, Equals, outside)
+	c.Check(files[2].Path, Equals, "etc/sub")
+
+	// symlinks in the snapshot are not followed
+	_, err = ListSnapshotFiles(vol, "snapA", "etc/host/secret")
+	c.Check(err, Equals, ErrSnapshotPathNotFound)
+	_, err = ListSnapshotFiles(vol, "missing", "")
+	c.Check(err, Equals, ErrSnapshotDoesNotExist)
+
+	changes, err := DiffSnapshotFiles(vol, "snapA", "snapB", "etc")
+	c.Assert(err, IsNil)
+	c.Check(changes, DeepEquals, []SnapshotChange{
+		{Path: "etc/a.conf", Change: FileModified, OldSize: 1, NewSize: 7},
+		{Path: "etc/host", Change: FileRemoved},
+		{Path: "etc/sub", Change: FileRemoved, OldSize: files[2].Size},
+		{Path: "etc/sub/c.conf", Change: FileRemoved, OldSize: 1},
+	})
+
+	dest := c.MkDir()
+	count, err := RestoreSnapshotPath(vol, "snapA", "etc", dest)
+	c.Assert(err, IsNil)
+	c.Check(count, Equals, 5)
+	data, err := ioutil.ReadFile(filepath.Join(dest, "etc", "sub", "c.conf"))
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "c")
+	link, err := os.Readlink(filepath.Join(dest, "etc", "host"))
+	c.Assert(err, IsNil)
+	c.Check(link, Equals, outside)
+}
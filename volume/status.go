@@ -34,6 +34,7 @@ type SimpleStatus struct { // see Docker - look at their status struct and borro
 	Driver     DriverType
 	DriverData map[string]string
 	UsageData  UsageData
+	Tenants    []TenantStorageStats
 }
 
 // UsageData implements Unmarshaler allowing us to unmarshal a []Usage indirectly
@@ -245,6 +246,18 @@ func (s SimpleStatus) String() string {
 		}
 
 	}
+	for _, tenant := range s.Tenants {
+		buffer.WriteString(fmt.Sprintf("Tenant %s:\n", tenant.TenantID))
+		buffer.WriteString(fmt.Sprintf("\tVolume Mount Point: %s\n", tenant.VolumePath))
+		if tenant.Quota > 0 {
+			buffer.WriteString(fmt.Sprintf("\tQuota (used/total): %s / %s (%s)\n", ToBytes(tenant.FilesystemUsed), ToBytes(tenant.Quota), Percent(tenant.FilesystemUsed, tenant.Quota)))
+		} else {
+			buffer.WriteString("\tQuota: none\n")
+		}
+		for _, e := range tenant.Errors {
+			buffer.WriteString(fmt.Sprintf("\t%s\n", e))
+		}
+	}
 	return buffer.String()
 }
 
@@ -264,6 +277,10 @@ type TenantStorageStats struct {
 	FilesystemUsed      uint64
 	FilesystemAvailable uint64
 
+	// Quota is the most space the tenant may use, in bytes.  0 means the
+	// tenant has no quota.
+	Quota uint64
+
 	Errors []string
 
 	NumberSnapshots         int
@@ -311,6 +328,8 @@ Data (total/used/avail):	{{bytes .PoolDataTotal}}	/ {{bytes .PoolDataUsed}}	({{p
 Volume Mount Point:	{{.VolumePath}}
 Filesystem (total/used/avail):	{{bytes .FilesystemTotal}} / {{bytes .FilesystemUsed}}	({{percent .FilesystemUsed .FilesystemTotal | noescape}}) / {{bytes .FilesystemAvailable}}	({{percent .FilesystemAvailable .FilesystemTotal | noescape}})
 Virtual device size:	{{blocksToBytes .DeviceTotalBlocks}}
+{{if .Quota}}Quota:	{{bytes .Quota}}
+{{end -}}
 {{range .Errors}}
 {{.}}
 {{end -}}
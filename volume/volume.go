@@ -52,6 +52,7 @@ const (
 	DriverTypeRsync        DriverType = "rsync"
 	DriverTypeDeviceMapper DriverType = "devicemapper"
 	DriverTypeNFS          DriverType = "nfs"
+	DriverTypeReflink      DriverType = "reflink"
 )
 
 var (
@@ -102,7 +103,10 @@ type Driver interface {
 	// Remove removes an existing device. If the device doesn't exist, the
 	// removal is a no-op
 	Remove(volumeName string) error
-	// Resize resizes an existing volume.
+	// Resize limits the space an existing volume may use.  Drivers that
+	// share the space of the host filesystem set it as a quota and return
+	// ErrQuotaUnsupported if the filesystem cannot enforce it.  Devicemapper
+	// grows the volume's device to the size, and cannot shrink it.
 	Resize(volumeName string, size uint64) error
 	// GetTenant returns the parent volume or the volume if it is the
 	// parent.
@@ -429,6 +433,8 @@ func StringToDriverType(name string) (DriverType, error) {
 		return DriverTypeRsync, nil
 	case "devicemapper":
 		return DriverTypeDeviceMapper, nil
+	case "reflink":
+		return DriverTypeReflink, nil
 	}
 	return "", ErrDriverNotSupported
 }
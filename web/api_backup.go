@@ -0,0 +1,55 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"net/http"
+
+	"github.com/control-center/serviced/facade"
+	"github.com/zenoss/go-json-rest"
+)
+
+// getRestoreStatus returns the progress of the running restore, or of the
+// last restore, by phase.
+func getRestoreStatus(w *rest.ResponseWriter, r *rest.Request, ctx *requestContext) {
+	facade := ctx.getFacade()
+	dataCtx := ctx.getDatastoreContext()
+
+	status, err := facade.GetRestoreStatus(dataCtx)
+	if err != nil {
+		restServerError(w, err)
+		return
+	} else if status == nil {
+		writeJSON(w, "No restore has been run.", http.StatusNotFound)
+		return
+	}
+
+	w.WriteJson(status)
+}
+
+// cancelRestore stops the running restore.  The restore can be resumed.
+func cancelRestore(w *rest.ResponseWriter, r *rest.Request, ctx *requestContext) {
+	f := ctx.getFacade()
+	dataCtx := ctx.getDatastoreContext()
+
+	if err := f.CancelRestore(dataCtx); err == facade.ErrNoRestoreRunning {
+		writeJSON(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		restServerError(w, err)
+		return
+	}
+
+	restSuccess(w)
+}
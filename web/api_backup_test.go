@@ -0,0 +1,65 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package web
+
+import (
+	"net/http"
+
+	"github.com/control-center/serviced/dfs"
+	"github.com/control-center/serviced/facade"
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestWebSuite) TestGetRestoreStatusShouldReturnStatusOK(c *C) {
+	request := s.buildRequest("GET", "/api/v2/restore", "")
+	status := &dfs.RestoreStatus{
+		Filename: "backup.tgz",
+		State:    dfs.RestoreRunning,
+		Phases:   []dfs.RestorePhase{{Name: dfs.RestorePhaseImages, State: dfs.RestoreDone}},
+	}
+
+	s.mockFacade.
+		On("GetRestoreStatus", s.ctx.getDatastoreContext()).
+		Return(status, nil)
+
+	getRestoreStatus(&(s.writer), &request, s.ctx)
+
+	c.Assert(s.recorder.Code, Equals, http.StatusOK)
+}
+
+func (s *TestWebSuite) TestGetRestoreStatusShouldReturnNotFound(c *C) {
+	request := s.buildRequest("GET", "/api/v2/restore", "")
+
+	s.mockFacade.
+		On("GetRestoreStatus", s.ctx.getDatastoreContext()).
+		Return(nil, nil)
+
+	getRestoreStatus(&(s.writer), &request, s.ctx)
+
+	c.Assert(s.recorder.Code, Equals, http.StatusNotFound)
+}
+
+func (s *TestWebSuite) TestCancelRestoreShouldReturnConflict(c *C) {
+	request := s.buildRequest("POST", "/api/v2/restore/cancel", "")
+
+	s.mockFacade.
+		On("CancelRestore", s.ctx.getDatastoreContext()).
+		Return(facade.ErrNoRestoreRunning)
+
+	cancelRestore(&(s.writer), &request, s.ctx)
+
+	c.Assert(s.recorder.Code, Equals, http.StatusConflict)
+}
@@ -92,6 +92,7 @@ func getInternalServiceInstances(w *rest.ResponseWriter, r *rest.Request, ctx *r
 					CurrentState string
 					HealthStatus map[string]health.Status
 					Started      time.Time
+					Endpoints    []string
 				}{
 					InstanceID:   running.InstanceID,
 					ServiceID:    running.ServiceID,
@@ -101,6 +102,7 @@ func getInternalServiceInstances(w *rest.ResponseWriter, r *rest.Request, ctx *r
 					CurrentState: string(service.SVCCSRunning),
 					HealthStatus: getHealthStatus(running),
 					Started:      running.StartedAt,
+					Endpoints:    isvcs.RedactedEndpoints(strings.TrimPrefix(running.ServiceID, "isvc-")),
 				}
 
 				instances = append(instances, instance)
@@ -269,6 +271,7 @@ func getService(s service.Service) interface{} {
 		DeploymentID      string
 		HasChildren       bool
 		MonitoringProfile domain.MonitorProfile
+		Endpoints         []string
 	}{
 		ID:                s.ID,
 		Name:              s.Name,
@@ -278,6 +281,7 @@ func getService(s service.Service) interface{} {
 		DeploymentID:      s.DeploymentID,
 		HasChildren:       false,
 		MonitoringProfile: s.MonitoringProfile,
+		Endpoints:         isvcs.RedactedEndpoints(strings.TrimPrefix(s.ID, "isvc-")),
 	}
 }
 
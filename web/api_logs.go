@@ -0,0 +1,202 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/control-center/serviced/config"
+	"github.com/control-center/serviced/domain/service"
+	"github.com/control-center/serviced/logtail"
+	"github.com/zenoss/go-json-rest"
+)
+
+// logTailPath is the path of the streaming log tail endpoint.  It is served
+// outside of the rest handler, whose response writer cannot flush, so that
+// each line reaches the client as soon as it is logged.
+var logTailPath = regexp.MustCompile("^/api/v2/services/([^/]+)/logs/tail$")
+
+// logTailer follows application logs; see logtail.Client
+type logTailer interface {
+	Tail(filter logtail.Filter, lines chan<- logtail.Line, cancel <-chan struct{}) error
+}
+
+// newLogTailer returns the log tailer for the logstash elasticsearch
+var newLogTailer = func() logTailer {
+	return logtail.NewClient(config.GetOptions().LogstashES)
+}
+
+// tailedLine is a line of an application log streamed to the client
+type tailedLine struct {
+	Timestamp   time.Time
+	HostID      string
+	HostName    string
+	ServiceID   string
+	ServiceName string
+	InstanceID  string
+	File        string
+	Message     string
+}
+
+// serveLogTail handles requests for the streaming log tail endpoint, if the
+// request is for it
+func (sc *ServiceConfig) serveLogTail(w http.ResponseWriter, r *http.Request) bool {
+	match := logTailPath.FindStringSubmatch(r.URL.Path)
+	if match == nil {
+		return false
+	}
+	writer := rest.NewResponseWriter(w, false)
+	if r.Method != "GET" {
+		writeJSON(&writer, "Method not allowed", http.StatusMethodNotAllowed)
+		return true
+	}
+	request := rest.Request{Request: r, PathParams: map[string]string{"serviceId": match[1]}}
+	sc.checkAuth(tailServiceLogs)(&writer, &request)
+	return true
+}
+
+// tailServiceLogs streams the application logs of a service and its
+// children as they are logged, one json object per line, until the client
+// goes away.
+//   instance: only stream the logs of this instance
+//   grep:     only stream the lines that match this regular expression
+//   since:    start with the lines logged this long ago (e.g. 5m)
+func tailServiceLogs(w *rest.ResponseWriter, r *rest.Request, ctx *requestContext) {
+	serviceID, err := url.QueryUnescape(r.PathParam("serviceId"))
+	if err != nil {
+		writeJSON(w, err, http.StatusBadRequest)
+		return
+	} else if len(serviceID) == 0 {
+		writeJSON(w, "serviceId must be specified", http.StatusBadRequest)
+		return
+	}
+
+	filter, err := getLogTailFilter(r.URL.Query())
+	if err != nil {
+		writeJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	facade := ctx.getFacade()
+	dataCtx := ctx.getDatastoreContext()
+
+	services, err := facade.QueryServiceDetails(dataCtx, service.Query{})
+	if err != nil {
+		restServerError(w, err)
+		return
+	}
+	serviceNames := make(map[string]string)
+	for _, svc := range services {
+		serviceNames[svc.ID] = svc.Name
+	}
+	if _, ok := serviceNames[serviceID]; !ok {
+		writeJSON(w, "Service not found", http.StatusNotFound)
+		return
+	}
+	filter.ServiceIDs = logtail.Descendants([]string{serviceID}, services)
+
+	hostNames := make(map[string]string)
+	hosts, err := facade.GetReadHosts(dataCtx)
+	if err != nil {
+		// the lines still have the host ids
+		plog.WithError(err).Debug("Could not get hosts for the log tail")
+	}
+	for _, h := range hosts {
+		hostNames[h.ID] = h.Name
+	}
+
+	lines := make(chan logtail.Line)
+	errc := make(chan error, 1)
+	cancel := make(chan struct{})
+	defer close(cancel)
+	go func() {
+		errc <- newLogTailer().Tail(filter, lines, cancel)
+	}()
+
+	var gone <-chan bool
+	if notifier, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		gone = notifier.CloseNotify()
+	}
+	flusher, _ := w.ResponseWriter.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	started := false
+	for {
+		select {
+		case line := <-lines:
+			if !started {
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				w.WriteHeader(http.StatusOK)
+				started = true
+			}
+			if err := encoder.Encode(tailedLine{
+				Timestamp:   line.Timestamp,
+				HostID:      line.HostID,
+				HostName:    hostNames[line.HostID],
+				ServiceID:   line.ServiceID,
+				ServiceName: serviceNames[line.ServiceID],
+				InstanceID:  line.InstanceID,
+				File:        line.File,
+				Message:     line.Message,
+			}); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case err := <-errc:
+			if err != nil && !started {
+				restServerError(w, err)
+			} else if err != nil {
+				plog.WithError(err).WithField("serviceid", serviceID).Warn("Stopped tailing service logs")
+			}
+			return
+		case <-gone:
+			return
+		}
+	}
+}
+
+// getLogTailFilter returns the log tail filter from the query parameters
+func getLogTailFilter(values url.Values) (logtail.Filter, error) {
+	var filter logtail.Filter
+	if instance := values.Get("instance"); instance != "" {
+		if _, err := strconv.Atoi(instance); err != nil {
+			return filter, fmt.Errorf("invalid instance: %s", instance)
+		}
+		filter.InstanceID = instance
+	}
+	if grep := values.Get("grep"); grep != "" {
+		re, err := regexp.Compile(grep)
+		if err != nil {
+			return filter, fmt.Errorf("invalid grep pattern: %s", err)
+		}
+		filter.Grep = re
+	}
+	since := time.Duration(0)
+	if value := values.Get("since"); value != "" {
+		var err error
+		if since, err = time.ParseDuration(value); err != nil || since < 0 {
+			return filter, errors.New("invalid since: " + value)
+		}
+	}
+	filter.Since = time.Now().Add(-since)
+	return filter, nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/control-center/serviced/domain/host"
+	"github.com/control-center/serviced/domain/service"
+	"github.com/control-center/serviced/logtail"
+	. "gopkg.in/check.v1"
+)
+
+// fakeLogTailer sends its lines and stops
+type fakeLogTailer struct {
+	filter logtail.Filter
+	lines  []logtail.Line
+}
+
+func (f *fakeLogTailer) Tail(filter logtail.Filter, lines chan<- logtail.Line, cancel <-chan struct{}) error {
+	f.filter = filter
+	for _, line := range f.lines {
+		select {
+		case lines <- line:
+		case <-cancel:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *TestWebSuite) useLogTailer(tailer logTailer) func() {
+	saved := newLogTailer
+	newLogTailer = func() logTailer { return tailer }
+	return func() { newLogTailer = saved }
+}
+
+func (s *TestWebSuite) TestTailServiceLogsShouldStreamLines(c *C) {
+	timestamp := time.Date(2016, 10, 19, 12, 0, 0, 0, time.UTC)
+	tailer := &fakeLogTailer{lines: []logtail.Line{
+		{Timestamp: timestamp, HostID: "host1", ServiceID: "firstService", InstanceID: "0", File: "/var/log/app.log", Message: "started"},
+		{Timestamp: timestamp, HostID: "host2", ServiceID: "secondService", InstanceID: "1", File: "/var/log/app.log", Message: "ERROR failed"},
+	}}
+	defer s.useLogTailer(tailer)()
+
+	request := s.buildRequest("GET", "http://www.example.com/api/v2/services/tenant/logs/tail?instance=1&grep=ERROR&since=5m", "")
+	request.PathParams["serviceId"] = "tenant"
+
+	s.mockFacade.
+		On("QueryServiceDetails", s.ctx.getDatastoreContext(), service.Query{}).
+		Return(allServices, nil)
+	s.mockFacade.
+		On("GetReadHosts", s.ctx.getDatastoreContext()).
+		Return([]host.ReadHost{{ID: "host1", Name: "Host One"}}, nil)
+
+	tailServiceLogs(&(s.writer), &request, s.ctx)
+
+	c.Assert(s.recorder.Code, Equals, http.StatusOK)
+	c.Assert(s.recorder.HeaderMap.Get("Content-Type"), Equals, "application/x-ndjson")
+
+	sort.Strings(tailer.filter.ServiceIDs)
+	c.Assert(tailer.filter.ServiceIDs, DeepEquals, []string{"firstService", "secondService", "tenant"})
+	c.Assert(tailer.filter.InstanceID, Equals, "1")
+	c.Assert(tailer.filter.Grep.String(), Equals, "ERROR")
+	c.Assert(time.Since(tailer.filter.Since) >= 5*time.Minute, Equals, true)
+
+	decoder := json.NewDecoder(s.recorder.Body)
+	var first, second tailedLine
+	c.Assert(decoder.Decode(&first), IsNil)
+	c.Assert(decoder.Decode(&second), IsNil)
+	c.Assert(first, DeepEquals, tailedLine{
+		Timestamp:   timestamp,
+		HostID:      "host1",
+		HostName:    "Host One",
+		ServiceID:   "firstService",
+		ServiceName: "First Service Name",
+		InstanceID:  "0",
+		File:        "/var/log/app.log",
+		Message:     "started",
+	})
+	c.Assert(second.HostName, Equals, "")
+	c.Assert(second.ServiceName, Equals, "Second Service Name")
+	c.Assert(second.Message, Equals, "ERROR failed")
+}
+
+func (s *TestWebSuite) TestTailServiceLogsShouldReturnBadRequestForInvalidParameters(c *C) {
+	defer s.useLogTailer(&fakeLogTailer{})()
+
+	for _, query := range []string{"instance=first", "grep=(", "since=yesterday", "since=-5m"} {
+		s.SetUpTest(c)
+		request := s.buildRequest("GET", "http://www.example.com/api/v2/services/tenant/logs/tail?"+query, "")
+		request.PathParams["serviceId"] = "tenant"
+
+		tailServiceLogs(&(s.writer), &request, s.ctx)
+
+		c.Assert(s.recorder.Code, Equals, http.StatusBadRequest, Commentf("query %s", query))
+	}
+}
+
+func (s *TestWebSuite) TestTailServiceLogsShouldReturnNotFoundIfNoService(c *C) {
+	defer s.useLogTailer(&fakeLogTailer{})()
+
+	request := s.buildRequest("GET", "http://www.example.com/api/v2/services/missing/logs/tail", "")
+	request.PathParams["serviceId"] = "missing"
+
+	s.mockFacade.
+		On("QueryServiceDetails", s.ctx.getDatastoreContext(), service.Query{}).
+		Return(allServices, nil)
+
+	tailServiceLogs(&(s.writer), &request, s.ctx)
+
+	c.Assert(s.recorder.Code, Equals, http.StatusNotFound)
+}
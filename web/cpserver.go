@@ -198,6 +198,9 @@ func (sc *ServiceConfig) Serve(shutdown <-chan (interface{})) {
 			return
 		}
 		r.URL.Path = cleanPath(r.URL.Path)
+		if sc.serveLogTail(w, r) {
+			return
+		}
 		uiHandler.ServeHTTP(w, r)
 	}
 
@@ -218,34 +221,41 @@ func (sc *ServiceConfig) Serve(shutdown <-chan (interface{})) {
 	// FIXME: bubble up these errors to the caller
 	certFile, keyFile := GetCertFiles(sc.certPEMFile, sc.keyPEMFile)
 
+	redirect := func(w http.ResponseWriter, req *http.Request) {
+		// bindPort has already been validated, so the Split/access below won't break.
+		http.Redirect(w, req, fmt.Sprintf("https://%s:%s%s", req.Host, strings.Split(sc.bindPort, ":")[1], req.URL), http.StatusMovedPermanently)
+	}
+	redirectServer := &http.Server{Addr: ":80", Handler: http.HandlerFunc(redirect)}
 	go func() {
-		redirect := func(w http.ResponseWriter, req *http.Request) {
-			// bindPort has already been validated, so the Split/access below won't break.
-			http.Redirect(w, req, fmt.Sprintf("https://%s:%s%s", req.Host, strings.Split(sc.bindPort, ":")[1], req.URL), http.StatusMovedPermanently)
-		}
-		err := http.ListenAndServe(":80", http.HandlerFunc(redirect))
-		if err != nil {
+		err := redirectServer.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
 			logger.WithError(err).Error("Could not setup HTTP webserver")
 		}
 	}()
+
+	// This cipher suites and tls min version change may not be needed with golang 1.5
+	// https://github.com/golang/go/issues/10094
+	// https://github.com/golang/go/issues/9364
+	config := &tls.Config{
+		MinVersion:               utils.MinTLS("http"),
+		PreferServerCipherSuites: true,
+		CipherSuites:             utils.CipherSuites("http"),
+	}
+	server := &http.Server{Addr: sc.bindPort, TLSConfig: config, Handler: http.HandlerFunc(httphandler)}
 	go func() {
-		// This cipher suites and tls min version change may not be needed with golang 1.5
-		// https://github.com/golang/go/issues/10094
-		// https://github.com/golang/go/issues/9364
-		config := &tls.Config{
-			MinVersion:               utils.MinTLS("http"),
-			PreferServerCipherSuites: true,
-			CipherSuites:             utils.CipherSuites("http"),
-		}
-		server := &http.Server{Addr: sc.bindPort, TLSConfig: config, Handler: http.HandlerFunc(httphandler)}
 		logger.WithField("ciphersuite", utils.CipherSuitesByName(config)).Info("Creating HTTP server")
 		err := server.ListenAndServeTLS(certFile, keyFile)
-		if err != nil {
+		if err != nil && err != http.ErrServerClosed {
 			logger.WithError(err).Error("Could not setup HTTPS webserver")
 		}
 	}()
-	blockerChan := make(chan bool)
-	<-blockerChan
+
+	// stop serving when the master shuts down or steps down, so that a
+	// standby master can take over the ports
+	<-shutdown
+	redirectServer.Close()
+	server.Close()
+	logger.Info("Stopped HTTP server")
 }
 
 var methods = []string{"GET", "POST", "PUT", "DELETE", "HEAD"}
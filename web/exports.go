@@ -55,16 +55,25 @@ func (e *RoundRobinExports) Set(data []registry.ExportDetails) {
 }
 
 // set updates the export list, but first randomizes the order and resets the
-// counter.
+// counter.  Exports that are draining are left out, so they do not receive
+// any new connections.
 func (e *RoundRobinExports) set(data []registry.ExportDetails) {
 
 	// reset the counter
 	e.xid = 0
 
+	// drop the draining exports
+	active := []registry.ExportDetails{}
+	for _, export := range data {
+		if !export.Draining {
+			active = append(active, export)
+		}
+	}
+
 	// randomize the exports
-	e.data = make([]registry.ExportDetails, len(data))
-	for i, j := range rand.Perm(len(data)) {
-		e.data[i] = data[j]
+	e.data = make([]registry.ExportDetails, len(active))
+	for i, j := range rand.Perm(len(active)) {
+		e.data[i] = active[j]
 	}
 }
 
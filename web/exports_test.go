@@ -0,0 +1,38 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package web
+
+import (
+	"github.com/control-center/serviced/zzk/registry"
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestWebSuite) TestRoundRobinExportsSkipsDraining(c *C) {
+	exports := NewRoundRobinExports([]registry.ExportDetails{
+		{InstanceID: 0, Draining: true},
+		{InstanceID: 1},
+	})
+	for i := 0; i < 3; i++ {
+		export := exports.Next()
+		c.Assert(export, NotNil)
+		c.Assert(export.InstanceID, Equals, 1)
+	}
+
+	exports.Set([]registry.ExportDetails{
+		{InstanceID: 1, Draining: true},
+	})
+	c.Assert(exports.Next(), IsNil)
+}
@@ -130,6 +130,26 @@ func (h *PublicPortHandler) Serve(protocol string, useTLS bool, certFile, keyFil
 		return ErrPortServerRunning
 	}
 
+	// udp ports relay datagrams without tls
+	if protocol == "udp" {
+		listener, err := net.ListenPacket("udp", h.portAddr)
+		if err != nil {
+			logger.WithError(err).Debug("Could not start UDP listener")
+			return err
+		}
+
+		h.wg.Add(1)
+		go func() {
+			logger.Info("Starting port server")
+			defer logger.Debug("Port server exited")
+
+			ServeUDP(h.cancel, listener, h.exports)
+			h.wg.Done()
+		}()
+
+		return nil
+	}
+
 	var tlsConfig *tls.Config
 	if useTLS {
 
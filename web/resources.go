@@ -942,6 +942,7 @@ func RestBackupRestore(w *rest.ResponseWriter, r *rest.Request, client *daoclien
 	req := dao.RestoreRequest{
 		Filename: filePath,
 		Username: username,
+		Resume:   r.FormValue("resume") == "true",
 	}
 	err = client.AsyncRestore(req, &unused)
 	if err != nil {
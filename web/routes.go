@@ -130,6 +130,8 @@ func (sc *ServiceConfig) getRoutes() []rest.Route {
 		rest.Route{"GET", "/api/v2/internalservices/:id", gz(sc.checkAuth(getInternalService))},
 		rest.Route{"GET", "/api/v2/internalservices/:id/instances", gz(sc.checkAuth(getInternalServiceInstances))},
 		rest.Route{"GET", "/api/v2/internalservicestatuses", gz(sc.checkAuth(getInternalServiceStatuses))},
+		rest.Route{"GET", "/api/v2/restore", gz(sc.checkAuth(getRestoreStatus))},
+		rest.Route{"POST", "/api/v2/restore/cancel", gz(sc.checkAuth(cancelRestore))},
 		rest.Route{"GET", "/api/v2/services", gz(sc.checkAuth(getAllServiceDetails))},
 		rest.Route{"GET", "/api/v2/services/:serviceId", gz(sc.checkAuth(getServiceDetails))},
 		rest.Route{"PUT", "/api/v2/services/:serviceId", gz(sc.checkAuth(putServiceDetails))},
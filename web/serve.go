@@ -15,6 +15,7 @@ package web
 
 import (
 	"crypto/tls"
+	"errors"
 	"net"
 	"net/http"
 	"sync"
@@ -98,6 +99,45 @@ func ServeTCP(cancel <-chan struct{}, listener net.Listener, tlsConfig *tls.Conf
 	wg.Wait()
 }
 
+// ServeUDP relays datagrams received on the packet listener to a given set
+// of exports. Each client address is pinned to a single export for the
+// duration of its session.
+func ServeUDP(cancel <-chan struct{}, listener net.PacketConn, exports Exports) {
+	dial := func() (net.Conn, error) {
+		export := exports.Next()
+		if export == nil {
+			// This happens if the endpoint is accessed and the containers
+			// have died or not come up yet.
+			return nil, errors.New("could not retrieve endpoint")
+		}
+
+		logger := plog.WithFields(log.Fields{
+			"application": export.Application,
+			"hostip":      export.HostIP,
+			"privateip":   export.PrivateIP,
+		})
+
+		remote, err := GetRemoteDatagramConnection(config.MuxTLSIsEnabled(), export)
+		if err != nil {
+			logger.WithError(err).Error("Could not get remote connection for endpoint")
+			return nil, err
+		}
+
+		logger.WithField("remoteaddress", remote.RemoteAddr()).Debug("Established remote connection")
+		return remote, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		proxy.ServeDatagrams(listener, dial, proxy.DefaultDatagramTimeout)
+		close(done)
+	}()
+
+	<-cancel
+	listener.Close()
+	<-done
+}
+
 // ServeHTTP sets up an http server for handling a collection of endpoints
 func ServeHTTP(cancel <-chan struct{}, address, protocol string, listener net.Listener, tlsConfig *tls.Config, exports Exports) {
 	logger := plog.WithFields(log.Fields{
@@ -14,7 +14,6 @@
 package web
 
 import (
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
@@ -89,36 +88,59 @@ func newNetDialer() dialerInterface {
 	return &netDialer{}
 }
 
-type tlsDialer struct {
-	config *tls.Config
-}
+// muxTLSDialer connects to remote muxes over TLS with this host's mux
+// certificate.
+type muxTLSDialer struct{}
 
-func (d *tlsDialer) Dial(network, address string) (net.Conn, error) {
-	return tls.Dial(network, address, d.config)
+func (d *muxTLSDialer) Dial(network, address string) (net.Conn, error) {
+	return proxy.DialMuxTLS(network, address)
 }
 
-func newTlsDialer(config *tls.Config) dialerInterface {
-	return &tlsDialer{config: config}
+func newMuxTLSDialer() dialerInterface {
+	return &muxTLSDialer{}
 }
 
 // GetRemoteConnection returns a connection to a remote address
 func GetRemoteConnection(useTLS bool, export *registry.ExportDetails) (remote net.Conn, err error) {
 	var dialer dialerInterface
 	if useTLS && !IsLocalAddress(export.HostIP) {
-		config := tls.Config{InsecureSkipVerify: true}
-		dialer = newTlsDialer(&config)
+		dialer = newMuxTLSDialer()
 	} else {
 		dialer = newNetDialer()
 	}
 	return getRemoteConnection(export, dialer)
 }
 
+// GetRemoteDatagramConnection returns a connection that relays datagrams to
+// a remote udp address. Each read and write on the connection is a single
+// datagram.
+func GetRemoteDatagramConnection(useTLS bool, export *registry.ExportDetails) (net.Conn, error) {
+	var dialer dialerInterface
+	if useTLS && !IsLocalAddress(export.HostIP) {
+		dialer = newMuxTLSDialer()
+	} else {
+		dialer = newNetDialer()
+	}
+	remote, err := getRemoteProtocolConnection(export, "udp", dialer)
+	if err != nil {
+		return nil, err
+	}
+	if !IsLocalAddress(export.HostIP) {
+		remote = proxy.NewDatagramConn(remote)
+	}
+	return remote, nil
+}
+
 func getRemoteConnection(export *registry.ExportDetails, dialer dialerInterface) (net.Conn, error) {
+	return getRemoteProtocolConnection(export, "tcp", dialer)
+}
+
+func getRemoteProtocolConnection(export *registry.ExportDetails, protocol string, dialer dialerInterface) (net.Conn, error) {
 	// If the exported endpoint is on this Host, we don't go through the mux.
 	if IsLocalAddress(export.HostIP) {
 		// if the address is local return a connection directly to the container
 		address := fmt.Sprintf("%s:%d", export.PrivateIP, export.PortNumber)
-		return dialer.Dial("tcp4", address)
+		return dialer.Dial(protocol+"4", address)
 	}
 
 	// Set up the remote address for the mux
@@ -149,7 +171,7 @@ func getRemoteConnection(export *registry.ExportDetails, dialer dialerInterface)
 		return nil, err
 	}
 
-	if err := auth.AddSignedMuxHeader(remote, muxAddr, token); err != nil {
+	if err := auth.AddSignedMuxHeaderScope(remote, muxAddr, protocol, export.TenantID, export.Application, token); err != nil {
 		plog.WithError(err).Error("Unable to send authenticated mux header")
 		return nil, err
 	}
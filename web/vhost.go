@@ -15,11 +15,12 @@ package web
 
 import (
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/control-center/serviced/zzk/registry"
-	"strings"
 )
 
 // VHostManager manages all vhosts on a host
@@ -76,6 +77,19 @@ func (m *VHostManager) Set(name string, data []registry.ExportDetails) {
 	}
 }
 
+// SetRoutes updates the path-based routes of the vhost
+func (m *VHostManager) SetRoutes(name string, routes []registry.VHostRouteExports) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, ok := m.vhosts[name]
+	if !ok {
+		h = NewVHostHandler()
+		m.vhosts[name] = h
+	}
+	h.SetRoutes(routes)
+}
+
 // Handle manages a vhost request and returns true if the vhost is enabled
 func (m *VHostManager) Handle(httphost string, w http.ResponseWriter, r *http.Request) bool {
 	m.mu.RLock()
@@ -99,10 +113,51 @@ func (m *VHostManager) handle(name string, w http.ResponseWriter, r *http.Reques
 // VHostHandler manages a vhost endpoint
 type VHostHandler struct {
 	exports Exports
+	routes  []*VHostRoute
 	mu      *sync.RWMutex
 	enabled bool
 }
 
+// VHostRoute manages the exports for a path-based route on a vhost
+type VHostRoute struct {
+	registry.VHostRoute
+	exports Exports
+}
+
+// Match returns true if the url path is handled by the route
+func (route *VHostRoute) Match(urlpath string) bool {
+	prefix := route.PathPrefix
+	if prefix == "/" || urlpath == prefix {
+		return true
+	}
+	return strings.HasPrefix(urlpath, strings.TrimRight(prefix, "/")+"/")
+}
+
+// Rewrite updates the request according to the route's path and header
+// rules
+func (route *VHostRoute) Rewrite(r *http.Request) {
+	if route.StripPrefix && route.PathPrefix != "/" {
+		prefix := strings.TrimRight(route.PathPrefix, "/")
+		r.URL.Path = "/" + strings.TrimLeft(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		if len(r.URL.RawPath) > 0 {
+			r.URL.RawPath = "/" + strings.TrimLeft(strings.TrimPrefix(r.URL.RawPath, prefix), "/")
+		}
+
+		// let the downstream server know where it is mounted
+		if _, found := r.Header["X-Forwarded-Prefix"]; !found {
+			r.Header.Set("X-Forwarded-Prefix", prefix)
+		}
+	}
+
+	for _, name := range route.RemoveHeaders {
+		r.Header.Del(name)
+	}
+
+	for name, value := range route.SetHeaders {
+		r.Header.Set(name, value)
+	}
+}
+
 // NewVHostHandler instantiates a new vhost handler
 func NewVHostHandler(data ...registry.ExportDetails) *VHostHandler {
 	return &VHostHandler{
@@ -131,6 +186,42 @@ func (h *VHostHandler) SetExports(data []registry.ExportDetails) {
 	h.exports.Set(data)
 }
 
+// SetRoutes updates the path-based routes for a vhost endpoint.  Routes are
+// kept in order of the longest path prefix first, so that the most specific
+// route matches a request.
+func (h *VHostHandler) SetRoutes(data []registry.VHostRouteExports) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	routes := make([]*VHostRoute, len(data))
+	for i, route := range data {
+		routes[i] = &VHostRoute{
+			VHostRoute: route.VHostRoute,
+			exports:    NewRoundRobinExports(route.Exports),
+		}
+	}
+	sort.Stable(vhostRoutes(routes))
+	h.routes = routes
+}
+
+// vhostRoutes sorts vhost routes by the longest path prefix
+type vhostRoutes []*VHostRoute
+
+func (r vhostRoutes) Len() int           { return len(r) }
+func (r vhostRoutes) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r vhostRoutes) Less(i, j int) bool { return len(r[i].PathPrefix) > len(r[j].PathPrefix) }
+
+// Route returns the route that matches the url path or nil if the request
+// should go to the default exports of the vhost.
+func (h *VHostHandler) Route(urlpath string) *VHostRoute {
+	for _, route := range h.routes {
+		if route.Match(urlpath) {
+			return route
+		}
+	}
+	return nil
+}
+
 // Handle is the vhost handler, returns true if the vhost is enabled
 func (h *VHostHandler) Handle(useTLS bool, w http.ResponseWriter, r *http.Request) bool {
 	h.mu.RLock()
@@ -141,13 +232,24 @@ func (h *VHostHandler) Handle(useTLS bool, w http.ResponseWriter, r *http.Reques
 		return false
 	}
 
+	// find the exports for the request path
+	exports := h.exports
+	route := h.Route(r.URL.Path)
+	if route != nil {
+		exports = route.exports
+	}
+
 	// get the next available export
-	export := h.exports.Next()
+	export := exports.Next()
 	if export == nil {
 		http.Error(w, "endpoint not available", http.StatusNotFound)
 		return true
 	}
 
+	if route != nil {
+		route.Rewrite(r)
+	}
+
 	RouteOriginalURL(r)
 
 	logger := plog.WithFields(log.Fields{
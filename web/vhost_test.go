@@ -0,0 +1,76 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package web
+
+import (
+	"net/http"
+
+	"github.com/control-center/serviced/zzk/registry"
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestWebSuite) TestVHostHandlerRoute(c *C) {
+	h := NewVHostHandler()
+	h.SetRoutes([]registry.VHostRouteExports{
+		{VHostRoute: registry.VHostRoute{PathPrefix: "/", Application: "ui"}},
+		{VHostRoute: registry.VHostRoute{PathPrefix: "/api", Application: "api"}},
+		{VHostRoute: registry.VHostRoute{PathPrefix: "/api/v2", Application: "apiv2"}},
+	})
+
+	c.Assert(h.Route("/api").Application, Equals, "api")
+	c.Assert(h.Route("/api/hosts").Application, Equals, "api")
+	c.Assert(h.Route("/api/v2/hosts").Application, Equals, "apiv2")
+	c.Assert(h.Route("/apis").Application, Equals, "ui")
+	c.Assert(h.Route("/index.html").Application, Equals, "ui")
+
+	h.SetRoutes([]registry.VHostRouteExports{
+		{VHostRoute: registry.VHostRoute{PathPrefix: "/api", Application: "api"}},
+	})
+	c.Assert(h.Route("/index.html"), IsNil)
+}
+
+func (s *TestWebSuite) TestVHostRouteRewrite(c *C) {
+	route := &VHostRoute{
+		VHostRoute: registry.VHostRoute{
+			PathPrefix:    "/api",
+			StripPrefix:   true,
+			SetHeaders:    map[string]string{"X-Api-Version": "2"},
+			RemoveHeaders: []string{"Cookie"},
+		},
+	}
+
+	r, err := http.NewRequest("GET", "https://app.example.com/api/hosts?x=1", nil)
+	c.Assert(err, IsNil)
+	r.Header.Set("Cookie", "session=abc")
+	route.Rewrite(r)
+	c.Check(r.URL.Path, Equals, "/hosts")
+	c.Check(r.URL.RawQuery, Equals, "x=1")
+	c.Check(r.Header.Get("X-Forwarded-Prefix"), Equals, "/api")
+	c.Check(r.Header.Get("X-Api-Version"), Equals, "2")
+	c.Check(r.Header.Get("Cookie"), Equals, "")
+
+	r, err = http.NewRequest("GET", "https://app.example.com/api", nil)
+	c.Assert(err, IsNil)
+	route.Rewrite(r)
+	c.Check(r.URL.Path, Equals, "/")
+
+	route.StripPrefix = false
+	r, err = http.NewRequest("GET", "https://app.example.com/api/hosts", nil)
+	c.Assert(err, IsNil)
+	route.Rewrite(r)
+	c.Check(r.URL.Path, Equals, "/api/hosts")
+	c.Check(r.Header.Get("X-Forwarded-Prefix"), Equals, "")
+}
@@ -16,6 +16,7 @@ package registry
 import (
 	"fmt"
 	"path"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/control-center/serviced/coordinator/client"
@@ -26,10 +27,12 @@ import (
 // presented on the coordinator.
 type ExportDetails struct {
 	service.ExportBinding
+	TenantID   string
 	PrivateIP  string
 	HostIP     string
 	MuxPort    uint16
 	InstanceID int
+	Draining   bool // true if the instance is stopping and should not receive new connections
 	version    interface{}
 }
 
@@ -43,14 +46,22 @@ func (node *ExportDetails) SetVersion(version interface{}) {
 	node.version = version
 }
 
-// RegisterExport exposes an exported endpoint
-func RegisterExport(shutdown <-chan struct{}, conn client.Connection, tenantID string, export ExportDetails) {
+// drainRetryInterval is how long to wait before trying again to mark an
+// export as draining
+var drainRetryInterval = time.Second
+
+// RegisterExport exposes an exported endpoint.  When the drain channel is
+// closed, the export is re-registered as draining so that importers stop
+// sending new connections to the instance.  Marking the export as draining
+// is retried until it succeeds.
+func RegisterExport(shutdown, drain <-chan struct{}, conn client.Connection, tenantID string, export ExportDetails) {
 	logger := plog.WithFields(log.Fields{
 		"TenantID":    tenantID,
 		"Application": export.Application,
 		"InstanceID":  export.InstanceID,
 	})
 
+	export.TenantID = tenantID
 	basepth := path.Join("/net/export", tenantID, export.Application, fmt.Sprintf("%s-%s-%d", tenantID, export.Application, export.InstanceID))
 	pth := basepth
 	defer func() {
@@ -59,6 +70,33 @@ func RegisterExport(shutdown <-chan struct{}, conn client.Connection, tenantID s
 		}
 	}()
 
+	// drained is true once the node on the coordinator is marked as draining
+	drained := false
+	var retry <-chan time.Time
+
+	// markDraining replaces the node with one that is marked as draining,
+	// and schedules a retry if it cannot.
+	markDraining := func(epLogger *log.Entry) {
+		retry = nil
+
+		// Replace the node instead of updating it, so that listeners
+		// that cache export data by node name pick up the change.
+		export.Draining = true
+		export.SetVersion(nil)
+		drainpth, err := conn.CreateEphemeral(basepth, &export)
+		if err != nil {
+			epLogger.WithError(err).Warn("Could not mark endpoint as draining, retrying")
+			retry = time.After(drainRetryInterval)
+			return
+		}
+		if err := conn.Delete(pth); err != nil && err != client.ErrNoNode {
+			epLogger.WithError(err).Warn("Could not remove endpoint before draining")
+		}
+		pth = drainpth
+		drained = true
+		epLogger.Debug("Marked endpoint as draining")
+	}
+
 	done := make(chan struct{})
 	defer func() { close(done) }()
 	for {
@@ -81,6 +119,11 @@ func RegisterExport(shutdown <-chan struct{}, conn client.Connection, tenantID s
 				epLogger.WithError(err).Error("Could not create endpoint")
 				return
 			}
+			if export.Draining {
+				// the new node already carries the draining mark
+				drained = true
+				retry = nil
+			}
 			continue
 		}
 
@@ -88,6 +131,15 @@ func RegisterExport(shutdown <-chan struct{}, conn client.Connection, tenantID s
 
 		select {
 		case <-ev:
+		case <-drain:
+			drain = nil
+			if !drained {
+				markDraining(epLogger)
+			}
+		case <-retry:
+			if !drained {
+				markDraining(epLogger)
+			}
 		case <-shutdown:
 			epLogger.Debug("Listener shutting down")
 			return
@@ -98,6 +150,68 @@ func RegisterExport(shutdown <-chan struct{}, conn client.Connection, tenantID s
 	}
 }
 
+// LookupExport returns the export registered at the container address.  If
+// the tenant and application are given, only the exports of that application
+// are searched.  The tenant of the export is taken from where it is
+// registered.
+func LookupExport(conn client.Connection, tenantID, application, address string) (*ExportDetails, error) {
+	if tenantID != "" && application != "" {
+		return lookupApplicationExport(conn, tenantID, application, address)
+	}
+
+	tenantIDs, err := conn.Children("/net/export")
+	if err == client.ErrNoNode {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, tID := range tenantIDs {
+		if tenantID != "" && tID != tenantID {
+			continue
+		}
+		applications, err := conn.Children(path.Join("/net/export", tID))
+		if err == client.ErrNoNode {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, app := range applications {
+			export, err := lookupApplicationExport(conn, tID, app, address)
+			if err != nil {
+				return nil, err
+			} else if export != nil {
+				return export, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// lookupApplicationExport returns the export of the application in the tenant
+// at the container address, or nil if there is none.
+func lookupApplicationExport(conn client.Connection, tenantID, application, address string) (*ExportDetails, error) {
+	pth := path.Join("/net/export", tenantID, application)
+	ch, err := conn.Children(pth)
+	if err == client.ErrNoNode {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, name := range ch {
+		export := &ExportDetails{}
+		if err := conn.Get(path.Join(pth, name), export); err == client.ErrNoNode {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if fmt.Sprintf("%s:%d", export.PrivateIP, export.PortNumber) == address {
+			export.TenantID = tenantID
+			return export, nil
+		}
+	}
+	return nil, nil
+}
+
 // TrackExports keeps track of changes to the list of exports for given import
 func TrackExports(shutdown <-chan struct{}, conn client.Connection, tenantID, application string) <-chan []ExportDetails {
 	exportsChan := make(chan []ExportDetails)
@@ -38,8 +38,9 @@ func (t *ZZKTest) TestRegisterExport(c *C) {
 
 	// start
 	shutdown := make(chan struct{})
+	drain := make(chan struct{})
 	go func() {
-		RegisterExport(shutdown, conn, "tenantid", ExportDetails{
+		RegisterExport(shutdown, drain, conn, "tenantid", ExportDetails{
 			ExportBinding: service.ExportBinding{Application: "app"},
 			InstanceID:    1,
 		})
@@ -96,6 +97,30 @@ func (t *ZZKTest) TestRegisterExport(c *C) {
 	}
 	c.Assert(ch, HasLen, 1)
 	c.Assert(ch[0], Not(Equals), node)
+	node = ch[0]
+
+	// drain
+	ok, ev, err = conn.ExistsW("/net/export/tenantid/app/"+node, done)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+	close(drain)
+	timer.Reset(time.Second)
+	select {
+	case <-ev:
+	case <-done:
+		c.Fatalf("Listener exited unexpectedly")
+	case <-timer.C:
+		close(shutdown)
+		c.Fatalf("Listener timed out")
+	}
+	ch, err = conn.Children("/net/export/tenantid/app")
+	c.Assert(err, IsNil)
+	c.Assert(ch, HasLen, 1)
+	c.Assert(ch[0], Not(Equals), node)
+	export := &ExportDetails{}
+	err = conn.Get("/net/export/tenantid/app/"+ch[0], export)
+	c.Assert(err, IsNil)
+	c.Assert(export.Draining, Equals, true)
 
 	// shutdown
 	close(shutdown)
@@ -181,3 +206,40 @@ func (t *ZZKTest) TestTrackExports(c *C) {
 		c.Fatalf("Timed out waiting for exports")
 	}
 }
+
+func (t *ZZKTest) TestLookupExport(c *C) {
+	conn, err := zzk.GetLocalConnection("/")
+	c.Assert(err, IsNil)
+
+	export, err := LookupExport(conn, "tenantid", "app", "10.0.0.2:8080")
+	c.Assert(err, IsNil)
+	c.Check(export, IsNil)
+	export, err = LookupExport(conn, "", "", "10.0.0.2:8080")
+	c.Assert(err, IsNil)
+	c.Check(export, IsNil)
+
+	err = conn.Create("/net/export/tenantid/app/0", &ExportDetails{
+		ExportBinding: service.ExportBinding{Application: "app", PortNumber: 8080},
+		PrivateIP:     "10.0.0.2",
+		HostIP:        "192.168.0.2",
+	})
+	c.Assert(err, IsNil)
+
+	export, err = LookupExport(conn, "tenantid", "app", "10.0.0.2:8080")
+	c.Assert(err, IsNil)
+	c.Assert(export, NotNil)
+	c.Check(export.TenantID, Equals, "tenantid")
+	c.Check(export.HostIP, Equals, "192.168.0.2")
+	export, err = LookupExport(conn, "tenantid", "app", "10.0.0.2:8081")
+	c.Assert(err, IsNil)
+	c.Check(export, IsNil)
+	export, err = LookupExport(conn, "othertenant", "app", "10.0.0.2:8080")
+	c.Assert(err, IsNil)
+	c.Check(export, IsNil)
+
+	// without a tenant and application, every export is searched
+	export, err = LookupExport(conn, "", "", "10.0.0.2:8080")
+	c.Assert(err, IsNil)
+	c.Assert(export, NotNil)
+	c.Check(export.TenantID, Equals, "tenantid")
+}
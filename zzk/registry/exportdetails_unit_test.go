@@ -0,0 +1,130 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build unit
+
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/control-center/serviced/coordinator/client"
+	"github.com/control-center/serviced/zzk/service"
+)
+
+// drainConn is a coordinator connection that fails to create the draining
+// node a number of times
+type drainConn struct {
+	client.Connection
+	mu       sync.Mutex
+	nodes    map[string]ExportDetails
+	seq      int
+	failures int
+	attempts int
+	created  chan ExportDetails
+}
+
+func (conn *drainConn) ExistsW(pth string, done <-chan struct{}) (bool, <-chan client.Event, error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	_, ok := conn.nodes[pth]
+	return ok, make(chan client.Event), nil
+}
+
+func (conn *drainConn) CreateEphemeral(pth string, node client.Node) (string, error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	export := *node.(*ExportDetails)
+	if export.Draining {
+		conn.attempts++
+		if conn.failures > 0 {
+			conn.failures--
+			return "", errors.New("create failed")
+		}
+	}
+	conn.seq++
+	name := fmt.Sprintf("%s%010d", pth, conn.seq)
+	conn.nodes[name] = export
+	conn.created <- export
+	return name, nil
+}
+
+func (conn *drainConn) Delete(pth string) error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if _, ok := conn.nodes[pth]; !ok {
+		return client.ErrNoNode
+	}
+	delete(conn.nodes, pth)
+	return nil
+}
+
+func TestRegisterExport_RetriesDrain(t *testing.T) {
+	defer func(interval time.Duration) { drainRetryInterval = interval }(drainRetryInterval)
+	drainRetryInterval = 10 * time.Millisecond
+
+	conn := &drainConn{
+		nodes:    make(map[string]ExportDetails),
+		failures: 2,
+		created:  make(chan ExportDetails, 4),
+	}
+	shutdown := make(chan struct{})
+	drain := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		RegisterExport(shutdown, drain, conn, "tenantid", ExportDetails{
+			ExportBinding: service.ExportBinding{Application: "app"},
+			InstanceID:    1,
+		})
+		close(done)
+	}()
+
+	select {
+	case export := <-conn.created:
+		if export.Draining {
+			t.Fatalf("Export was registered as draining")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Export was not registered")
+	}
+
+	close(drain)
+	select {
+	case export := <-conn.created:
+		if !export.Draining {
+			t.Fatalf("Export was not marked as draining")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Export was not marked as draining after failures")
+	}
+
+	close(shutdown)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Listener did not shut down")
+	}
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.attempts != 3 {
+		t.Errorf("Expected 3 attempts to mark the export as draining, got %d", conn.attempts)
+	}
+	if len(conn.nodes) != 0 {
+		t.Errorf("Expected all nodes to be removed, got %v", conn.nodes)
+	}
+}
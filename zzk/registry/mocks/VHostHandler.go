@@ -16,3 +16,6 @@ func (_m *VHostHandler) Disable(name string) {
 func (_m *VHostHandler) Set(name string, exports []registry.ExportDetails) {
 	_m.Called(name, exports)
 }
+func (_m *VHostHandler) SetRoutes(name string, routes []registry.VHostRouteExports) {
+	_m.Called(name, routes)
+}
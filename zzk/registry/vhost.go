@@ -15,6 +15,7 @@ package registry
 
 import (
 	"path"
+	"reflect"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/control-center/serviced/coordinator/client"
@@ -25,6 +26,7 @@ type VHost struct {
 	TenantID    string
 	ServiceID   string
 	Application string
+	Routes      []VHostRoute
 	version     interface{}
 }
 
@@ -38,11 +40,50 @@ func (node *VHost) SetVersion(version interface{}) {
 	node.version = version
 }
 
+// Applications returns the distinct applications that the vhost proxies to,
+// starting with the default application.
+func (node *VHost) Applications() []string {
+	apps := []string{node.Application}
+	seen := map[string]struct{}{node.Application: {}}
+	for _, route := range node.Routes {
+		app := node.RouteApplication(route)
+		if _, ok := seen[app]; !ok {
+			seen[app] = struct{}{}
+			apps = append(apps, app)
+		}
+	}
+	return apps
+}
+
+// RouteApplication returns the application that a route proxies to
+func (node *VHost) RouteApplication(route VHostRoute) string {
+	if route.Application != "" {
+		return route.Application
+	}
+	return node.Application
+}
+
+// VHostRoute describes a path-based route on a vhost endpoint
+type VHostRoute struct {
+	PathPrefix    string
+	Application   string
+	StripPrefix   bool
+	SetHeaders    map[string]string
+	RemoveHeaders []string
+}
+
+// VHostRouteExports are the exports available to a vhost route
+type VHostRouteExports struct {
+	VHostRoute
+	Exports []ExportDetails
+}
+
 // VHostHandler manages the vhosts for a host
 type VHostHandler interface {
 	Enable(name string)
 	Disable(name string)
 	Set(name string, exports []ExportDetails)
+	SetRoutes(name string, routes []VHostRouteExports)
 }
 
 // VHostListener listens for vhosts on a host
@@ -91,9 +132,11 @@ func (l *VHostListener) Spawn(shutdown <-chan interface{}, subdomain string) {
 		"subdomain": subdomain,
 	})
 
-	// keep a cache of exports that have already been
+	// keep a cache of exports per application that have already been
 	// looked up.
-	exportMap := make(map[string]ExportDetails)
+	exportMaps := make(map[string]map[string]ExportDetails)
+	var application string
+	var routes []VHostRoute
 
 	// keep track of the on/off state of the export
 	isEnabled := false
@@ -120,72 +163,55 @@ func (l *VHostListener) Spawn(shutdown <-chan interface{}, subdomain string) {
 			return
 		}
 
-		// track the exports
-		exLogger := logger.WithFields(log.Fields{
-			"tenantid":    dat.TenantID,
-			"application": dat.Application,
-		})
-
-		var exevt <-chan client.Event
-		var ch []string
-
-		expth := path.Join("/net/export", dat.TenantID, dat.Application)
-
-		// keep checking until we have an event or an error
-		for {
-			var ok bool
-			var err error
-
-			ok, exevt, err = l.conn.ExistsW(expth, done)
-			if err != nil {
-				exLogger.WithError(err).Error("Could not check exports for endpoint")
+		// track the exports of every application on the vhost
+		exevt := make(chan client.Event, 1)
+		exportsByApp := make(map[string][]ExportDetails)
+		changedApps := make(map[string]bool)
+		chMaps := make(map[string]map[string]ExportDetails)
+		for _, app := range dat.Applications() {
+			exports, chMap, ev, changed, ok := l.watchExports(logger, dat.TenantID, app, exportMaps[app], done)
+			if !ok {
 				return
 			}
-
-			if ok {
-				ch, exevt, err = l.conn.ChildrenW(expth, done)
-				if err == client.ErrNoNode {
-					logger.Debug("VHost suddenly deleted, retrying")
-					close(done)
-					done = make(chan struct{})
-
-					// we need an event, so try again
-					continue
-				} else if err != nil {
-					exLogger.WithFields(log.Fields{
-						"Error": err,
-					}).Error("Could not track exports for endpoint")
-					return
+			exportsByApp[app] = exports
+			chMaps[app] = chMap
+			changedApps[app] = changed
+
+			go func(ev <-chan client.Event, done <-chan struct{}) {
+				select {
+				case e := <-ev:
+					select {
+					case exevt <- e:
+					default:
+					}
+				case <-done:
 				}
-			}
-			break
+			}(ev, done)
 		}
+		exportMaps = chMaps
 
-		exports := []ExportDetails{}
-
-		// get the exports and update the cache
-		sendUpdate := len(ch) != len(exportMap)
-		chMap := make(map[string]ExportDetails)
-		for _, name := range ch {
-			export, ok := exportMap[name]
-			if !ok {
-				sendUpdate = true
-				if err := l.conn.Get(path.Join(expth, name), &export); err == client.ErrNoNode {
-					continue
-				} else if err != nil {
-					exLogger.WithField("exportkey", name).WithError(err).Error("Could not look up export")
-					return
-				}
+		// only send an update if the exports have changed
+		if changedApps[dat.Application] || (application != "" && application != dat.Application) {
+			l.handler.Set(subdomain, exportsByApp[dat.Application])
+		}
+		application = dat.Application
+
+		// only send a route update if the routes or their exports have
+		// changed
+		sendRoutes := !reflect.DeepEqual(routes, dat.Routes)
+		routeExports := make([]VHostRouteExports, len(dat.Routes))
+		for i, route := range dat.Routes {
+			app := dat.RouteApplication(route)
+			sendRoutes = sendRoutes || changedApps[app]
+			routeExports[i] = VHostRouteExports{
+				VHostRoute: route,
+				Exports:    exportsByApp[app],
 			}
-			chMap[name] = export
-			exports = append(exports, export)
 		}
+		routes = dat.Routes
 
-		exportMap = chMap
-
-		// only send an update if the exports have changed
-		if sendUpdate {
-			l.handler.Set(subdomain, exports)
+		if sendRoutes {
+			l.handler.SetRoutes(subdomain, routeExports)
 		}
 
 		// do something if the state of the vhost has changed
@@ -206,3 +232,68 @@ func (l *VHostListener) Spawn(shutdown <-chan interface{}, subdomain string) {
 		done = make(chan struct{})
 	}
 }
+
+// watchExports looks up the exports of an application, reusing the cached
+// export data where possible, and sets a watch on the application's export
+// path.  Returns false if the exports could not be tracked.
+func (l *VHostListener) watchExports(logger *log.Entry, tenantID, application string, exportMap map[string]ExportDetails, done <-chan struct{}) ([]ExportDetails, map[string]ExportDetails, <-chan client.Event, bool, bool) {
+	exLogger := logger.WithFields(log.Fields{
+		"tenantid":    tenantID,
+		"application": application,
+	})
+
+	var exevt <-chan client.Event
+	var ch []string
+
+	expth := path.Join("/net/export", tenantID, application)
+
+	// keep checking until we have an event or an error
+	for {
+		var ok bool
+		var err error
+
+		ok, exevt, err = l.conn.ExistsW(expth, done)
+		if err != nil {
+			exLogger.WithError(err).Error("Could not check exports for endpoint")
+			return nil, nil, nil, false, false
+		}
+
+		if ok {
+			ch, exevt, err = l.conn.ChildrenW(expth, done)
+			if err == client.ErrNoNode {
+				exLogger.Debug("Exports suddenly deleted, retrying")
+
+				// we need an event, so try again
+				continue
+			} else if err != nil {
+				exLogger.WithFields(log.Fields{
+					"Error": err,
+				}).Error("Could not track exports for endpoint")
+				return nil, nil, nil, false, false
+			}
+		}
+		break
+	}
+
+	exports := []ExportDetails{}
+
+	// get the exports and update the cache
+	changed := len(ch) != len(exportMap)
+	chMap := make(map[string]ExportDetails)
+	for _, name := range ch {
+		export, ok := exportMap[name]
+		if !ok {
+			changed = true
+			if err := l.conn.Get(path.Join(expth, name), &export); err == client.ErrNoNode {
+				continue
+			} else if err != nil {
+				exLogger.WithField("exportkey", name).WithError(err).Error("Could not look up export")
+				return nil, nil, nil, false, false
+			}
+		}
+		chMap[name] = export
+		exports = append(exports, export)
+	}
+
+	return exports, chMap, exevt, changed, true
+}
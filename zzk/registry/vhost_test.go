@@ -98,3 +98,89 @@ func (t *ZZKTest) TestVHostListener(c *C) {
 		c.Fatalf("Listener timed out waiting to shutdown")
 	}
 }
+
+func (t *ZZKTest) TestVHostListener_Routes(c *C) {
+	// pre-reqs
+	conn, err := zzk.GetLocalConnection("/")
+	c.Assert(err, IsNil)
+
+	handler := &mocks.VHostHandler{}
+	listener := NewVHostListener("master", handler)
+	listener.SetConnection(conn)
+
+	route := VHostRoute{
+		PathPrefix:  "/api",
+		Application: "api",
+		StripPrefix: true,
+	}
+	handler.On("SetRoutes", "myroutedhost", mock.AnythingOfType("[]registry.VHostRouteExports")).Return().Run(func(a mock.Arguments) {
+		actual := a.Get(1).([]VHostRouteExports)
+		c.Check(actual, HasLen, 1)
+		c.Check(actual[0].VHostRoute, DeepEquals, route)
+		c.Check(actual[0].Exports, HasLen, 0)
+	}).Once()
+	handler.On("Enable", "myroutedhost").Return().Once()
+	vhost := &VHost{
+		TenantID:    "tenantid",
+		Application: "ui",
+		Routes:      []VHostRoute{route},
+	}
+	err = conn.Create("/net/vhost/master/myroutedhost", vhost)
+	c.Assert(err, IsNil)
+
+	shutdown := make(chan interface{})
+	done := make(chan struct{})
+	go func() {
+		listener.Spawn(shutdown, "myroutedhost")
+		close(done)
+	}()
+
+	timer := time.NewTimer(time.Second)
+	select {
+	case <-done:
+		c.Fatalf("Listener exited unexpectedly")
+	case <-timer.C:
+	}
+
+	// exports for the routed application changed
+	export := &ExportDetails{
+		ExportBinding: service.ExportBinding{
+			Application: "api",
+			Protocol:    "tcp",
+			PortNumber:  8080,
+		},
+		HostIP:     "10.112.15.87",
+		PrivateIP:  "17.147.12.128",
+		MuxPort:    44181,
+		InstanceID: 0,
+	}
+	handler.On("SetRoutes", "myroutedhost", mock.AnythingOfType("[]registry.VHostRouteExports")).Return().Run(func(a mock.Arguments) {
+		actual := a.Get(1).([]VHostRouteExports)
+		c.Check(actual, HasLen, 1)
+		c.Check(actual[0].Exports, HasLen, 1)
+		c.Check(actual[0].Exports[0].ExportBinding, DeepEquals, export.ExportBinding)
+	}).Once()
+
+	err = conn.Create("/net/export/tenantid/api/0", export)
+	c.Assert(err, IsNil)
+
+	timer.Reset(time.Second)
+	select {
+	case <-done:
+		c.Fatalf("Listener exited unexpectedly")
+	case <-timer.C:
+	}
+
+	// shutdown
+	handler.On("Disable", "myroutedhost").Return().Once()
+
+	close(shutdown)
+
+	timer.Reset(time.Second)
+	select {
+	case <-done:
+		handler.AssertExpectations(c)
+	case <-timer.C:
+		c.Fatalf("Listener timed out waiting to shutdown")
+	}
+}
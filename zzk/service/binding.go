@@ -39,6 +39,7 @@ func (err TemplateError) Error() string {
 type ImportBinding struct {
 	Application    string
 	Purpose        string // import or import_all
+	Protocol       string // tcp or udp; defaults to the protocol of the exports
 	PortNumber     uint16
 	PortTemplate   string
 	VirtualAddress string
@@ -40,6 +40,7 @@ func (err ServiceError) Error() string {
 type ServiceNode struct {
 	ID                          string
 	Name                        string
+	ParentID                    string
 	DesiredState                int
 	HostPolicy                  servicedefinition.HostPolicy
 	Instances                   int
@@ -57,6 +58,7 @@ func NewServiceNodeFromService(s *service.Service) (*ServiceNode, error) {
 	sn := ServiceNode{
 		ID:            s.ID,
 		Name:          s.Name,
+		ParentID:      s.ParentServiceID,
 		DesiredState:  s.DesiredState,
 		Instances:     s.Instances,
 		CPUCommitment: int(s.CPUCommitment),
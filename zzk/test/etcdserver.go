@@ -0,0 +1,117 @@
+// Copyright 2016 The Serviced Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build integration
+
+package zzktest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// EtcdServer provides an etcd server for integration tests that use the etcd
+// coordinator driver.  It uses the server at Endpoint, such as the one that
+// serviced-tests.py --etcd starts, or else runs etcd from the PATH.  The
+// server is not embedded; see zzk/testutils.go.
+type EtcdServer struct {
+	Endpoint string
+	Port     int
+	cmd      *exec.Cmd
+	dataDir  string
+}
+
+// Start starts etcd on free ports, unless an endpoint is set, and waits for
+// it to answer
+func (s *EtcdServer) Start() error {
+	if s.Endpoint != "" {
+		return waitHealthy("http://" + s.Endpoint)
+	}
+	bin, err := exec.LookPath("etcd")
+	if err != nil {
+		return fmt.Errorf("Could not find etcd: %s", err)
+	}
+	if s.Port == 0 {
+		if s.Port, err = freePort(); err != nil {
+			return err
+		}
+	}
+	peerPort, err := freePort()
+	if err != nil {
+		return err
+	}
+	if s.dataDir, err = ioutil.TempDir("", "etcdtest"); err != nil {
+		return err
+	}
+	clientURL := fmt.Sprintf("http://127.0.0.1:%d", s.Port)
+	peerURL := fmt.Sprintf("http://127.0.0.1:%d", peerPort)
+	s.cmd = exec.Command(bin,
+		"--name", "zzktest",
+		"--data-dir", s.dataDir,
+		"--listen-client-urls", clientURL,
+		"--advertise-client-urls", clientURL,
+		"--listen-peer-urls", peerURL,
+		"--initial-advertise-peer-urls", peerURL,
+		"--initial-cluster", "zzktest="+peerURL,
+	)
+	if err := s.cmd.Start(); err != nil {
+		os.RemoveAll(s.dataDir)
+		return fmt.Errorf("Could not start etcd: %s", err)
+	}
+	if err := waitHealthy(clientURL); err != nil {
+		s.Stop()
+		return err
+	}
+	s.Endpoint = fmt.Sprintf("127.0.0.1:%d", s.Port)
+	return nil
+}
+
+// Stop kills the etcd that Start ran and removes its data
+func (s *EtcdServer) Stop() error {
+	if s.cmd == nil {
+		return nil
+	}
+	if s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+		s.cmd.Wait()
+	}
+	s.cmd = nil
+	return os.RemoveAll(s.dataDir)
+}
+
+func waitHealthy(clientURL string) error {
+	for i := 0; i < 100; i++ {
+		if resp, err := http.Get(clientURL + "/health"); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("etcd did not answer at %s", clientURL)
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -16,24 +16,69 @@
 package zzk
 
 import (
+	"os"
 	"time"
 
 	"github.com/control-center/serviced/coordinator/client"
+	"github.com/control-center/serviced/coordinator/client/etcd"
 	"github.com/control-center/serviced/coordinator/client/zookeeper"
 	"github.com/control-center/serviced/isvcs"
+	zzktest "github.com/control-center/serviced/zzk/test"
 	. "gopkg.in/check.v1"
 )
 
 // NOTE: this constant can be adjusted to satisfy race conditions
 const ZKTestTimeout = 5 * time.Second
 
+// Set SERVICED_TEST_COORDINATOR=etcd to run the suites against the etcd server
+// at SERVICED_TEST_ETCD_ENDPOINT, or else one from the PATH, instead of the
+// zookeeper isvc.  serviced-tests.py --etcd sets both.  The suites fail rather
+// than fall back to zookeeper if no etcd server is available.
+//
+// The etcd server is a separate process rather than one embedded in the test
+// binary.  Embedding it would mean vendoring the etcd server along with grpc,
+// raft and their dependencies, while the etcd driver itself only needs the
+// standard library to talk to etcd's JSON gateway.
+const (
+	testCoordinatorEnv  = "SERVICED_TEST_COORDINATOR"
+	testEtcdEndpointEnv = "SERVICED_TEST_ETCD_ENDPOINT"
+)
+
 type ZZKTestSuite struct {
 	isvcs.ManagerTestSuite
+	etcd *zzktest.EtcdServer
 }
 
 func (t *ZZKTestSuite) SetUpSuite(c *C) {
 	t.ManagerTestSuite.AddTestService(t)
-	t.ManagerTestSuite.SetUpSuite(c)
+	switch driver := os.Getenv(testCoordinatorEnv); driver {
+	case etcd.DriverName:
+		endpoint := os.Getenv(testEtcdEndpointEnv)
+		t.etcd = &zzktest.EtcdServer{Endpoint: endpoint}
+		if err := t.etcd.Start(); err != nil {
+			if endpoint == "" {
+				c.Fatalf("%s=%s, but %s is not set and etcd could not be run: %s", testCoordinatorEnv, driver, testEtcdEndpointEnv, err)
+			}
+			c.Fatalf("%s=%s, but no etcd server is available at %s=%s: %s", testCoordinatorEnv, driver, testEtcdEndpointEnv, endpoint, err)
+		}
+		c.Logf("Running against etcd at %s", t.etcd.Endpoint)
+		t.Create(c)
+	case "", "zookeeper":
+		t.ManagerTestSuite.SetUpSuite(c)
+	default:
+		c.Fatalf("Unknown coordinator %s=%s; use zookeeper or %s", testCoordinatorEnv, driver, etcd.DriverName)
+	}
+}
+
+func (t *ZZKTestSuite) TearDownSuite(c *C) {
+	switch os.Getenv(testCoordinatorEnv) {
+	case etcd.DriverName:
+		t.Destroy(c)
+		t.etcd.Stop()
+		t.etcd = nil
+	case "", "zookeeper":
+		t.ManagerTestSuite.TearDownSuite(c)
+	}
 }
 
 func (t *ZZKTestSuite) GetService(c *C) *isvcs.IService {
@@ -49,6 +94,16 @@ func (t *ZZKTestSuite) GetService(c *C) *isvcs.IService {
 }
 
 func (t *ZZKTestSuite) Create(c *C) {
+	if t.etcd != nil {
+		dsn := etcd.NewDSN([]string{t.etcd.Endpoint}, time.Second*15, time.Second).String()
+		c.Logf("etcd dsn: %s", dsn)
+		zclient, err := client.New(etcd.DriverName, dsn, "", nil)
+		if err != nil {
+			c.Fatalf("Could not connect to etcd: %s", err)
+		}
+		InitializeLocalClient(zclient)
+		return
+	}
 	dsn := zookeeper.NewDSN([]string{"127.0.0.1:2181"},
 		time.Second*15,
 		1*time.Second,
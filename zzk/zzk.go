@@ -17,7 +17,6 @@ import (
 	"errors"
 
 	"github.com/control-center/serviced/coordinator/client"
-	"github.com/control-center/serviced/coordinator/client/zookeeper"
 	"github.com/zenoss/glog"
 )
 
@@ -73,7 +72,7 @@ func MonitorRealm(shutdown <-chan interface{}, conn client.Connection, path stri
 
 			// Get the current leader and check for changes in its realm
 			var hl HostLeader
-			if err := leader.Current(&hl); err == zookeeper.ErrNoLeaderFound {
+			if err := leader.Current(&hl); err == client.ErrNoLeaderFound {
 				// pass
 			} else if err != nil {
 				return